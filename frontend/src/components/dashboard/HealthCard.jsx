@@ -8,6 +8,23 @@ function latencyColor(ms) {
   return 'bg-red-100 text-red-800';
 }
 
+function cacheLabel(cache) {
+  const total = cache.hits + cache.misses;
+  const rate = total ? Math.round((cache.hits / total) * 100) : 0;
+  return `${rate}% hits (${cache.hits}/${total})`;
+}
+
+function formatBytes(n) {
+  if (n >= 1 << 30) return `${(n / (1 << 30)).toFixed(1)} GB`;
+  if (n >= 1 << 20) return `${(n / (1 << 20)).toFixed(1)} MB`;
+  return `${Math.round(n / 1024)} KB`;
+}
+
+function budgetLabel(budget) {
+  if (budget.waiting > 0) return `${budget.remaining}/${budget.limit} (${budget.waiting} waiting)`;
+  return `${budget.remaining}/${budget.limit}`;
+}
+
 function HealthCard({ data, loading, error }) {
   if (loading) {
     return (
@@ -54,6 +71,39 @@ function HealthCard({ data, loading, error }) {
             {data ? `${data.latency_p95}ms` : 'N/A'}
           </Badge>
       </div>
+      {data?.artifact_cache && (
+        <div className='flex items-center justify-between'>
+          <span>Jar cache</span>
+          <span
+            className='text-sm text-muted-foreground'
+            title={`${data.artifact_cache.blobs} jars, ${formatBytes(data.artifact_cache.bytes)} of ${formatBytes(data.artifact_cache.max_bytes)}`}
+          >
+            {cacheLabel(data.artifact_cache)}
+          </span>
+        </div>
+      )}
+      {data?.modrinth_mirror && (
+        <div className='flex items-center justify-between'>
+          <span>Modrinth</span>
+          <span
+            className='text-sm text-muted-foreground'
+            title={`Offline mirror exported ${new Date(data.modrinth_mirror.generated_at).toLocaleString()}`}
+          >
+            Offline mirror ({data.modrinth_mirror.projects.length} projects)
+          </span>
+        </div>
+      )}
+      {data?.modrinth_budget?.known && (
+        <div className='flex items-center justify-between'>
+          <span>Modrinth budget</span>
+          <span
+            className='text-sm text-muted-foreground'
+            title={`Resets ${new Date(data.modrinth_budget.reset_at).toLocaleTimeString()}; background checks pause when the budget runs low`}
+          >
+            {budgetLabel(data.modrinth_budget)}
+          </span>
+        </div>
+      )}
       <div className='flex items-center justify-between'>
         <span>Last check</span>
         <span
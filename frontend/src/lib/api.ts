@@ -7,12 +7,20 @@ export interface ModVersion {
   loaders: string[];
 }
 
+// Kinds of server backend an instance can be bound to; Pelican panels use
+// the Pterodactyl backend.
+export type ServerBackend = "pufferpanel" | "pterodactyl" | "local" | "sftp";
+
 export interface Instance {
   id: number;
   name: string;
   loader: string;
   requires_loader?: boolean;
+  // Server ID on the instance's backend
   pufferpanel_server_id?: string;
+  backend?: ServerBackend;
+  // PufferPanel connection; absent means the default one
+  connection_id?: string;
   enforce_same_loader: boolean;
   created_at: string;
   mod_count: number;
@@ -20,6 +28,10 @@ export interface Instance {
   last_sync_added?: number;
   last_sync_updated?: number;
   last_sync_failed?: number;
+  // Previous jars kept per mod for rollback
+  rollback_retention?: number;
+  // Restart the PufferPanel server once updates apply
+  restart_after_update?: boolean;
   // Optional enriched fields from backend projection
   gameVersion?: string;
   gameVersionKey?: string;
@@ -39,6 +51,12 @@ export interface Mod {
   available_channel: string;
   download_url: string;
   instance_id: number;
+  // How sync identified the jar: "hash", "fingerprint", "metadata" or "filename"
+  match_method?: string;
+  source?: "modrinth" | "curseforge" | "hangar";
+  // Modrinth side support: "required", "optional", "unsupported" or "unknown"
+  client_side?: string;
+  server_side?: string;
 }
 
 export interface ModMetadata {
@@ -55,6 +73,46 @@ export interface DashboardData {
   last_sync: number;
   latency_p50: number;
   latency_p95: number;
+  artifact_cache?: ArtifactCacheStats;
+  last_update_check?: UpdateCheckRun;
+  modrinth_budget: ModrinthBudget;
+  modrinth_mirror?: ModrinthMirror;
+}
+
+// Modrinth rate-limit state; background work waits once remaining falls to
+// a fifth of the limit, so interactive requests stay fast.
+export interface ModrinthMirror {
+  format: number;
+  generated_at: string;
+  projects: string[];
+}
+
+export interface ModrinthBudget {
+  known: boolean;
+  limit: number;
+  remaining: number;
+  reset_at: string;
+  waiting: number;
+  throttled: number;
+}
+
+// One pass of the hourly update check and the Modrinth requests it used.
+export interface UpdateCheckRun {
+  id: number;
+  started_at: string;
+  finished_at: string;
+  mods: number;
+  batched: number;
+  fallback: number;
+  requests: number;
+}
+
+export interface ArtifactCacheStats {
+  hits: number;
+  misses: number;
+  blobs: number;
+  bytes: number;
+  max_bytes: number;
 }
 
 export interface ModUpdate {
@@ -68,7 +126,7 @@ export interface ModEvent {
   id: number;
   instance_id: number;
   mod_id?: number;
-  action: "added" | "deleted" | "updated";
+  action: "added" | "deleted" | "updated" | "rolled_back";
   mod_name: string;
   from_version?: string;
   to_version?: string;
@@ -195,12 +253,16 @@ export interface NewMod {
   // Optional: exact Modrinth version id chosen in wizard
   version_id?: string;
   instance_id: number;
+  // Install only the requested mod, not its required dependencies
+  skip_dependencies?: boolean;
 }
 
 export interface NewInstance {
   name: string;
   loader: string;
   pufferpanel_server_id?: string;
+  backend?: ServerBackend;
+  connection_id?: string;
 }
 
 export interface UpdateInstance {
@@ -211,11 +273,47 @@ export interface UpdateInstance {
   // Mark how loader was set and whether a loader is still required
   loader_status?: string;
   requires_loader?: boolean;
+  rollback_retention?: number;
+  restart_after_update?: boolean;
+}
+
+export interface DependencyInstall {
+  project_id: string;
+  slug: string;
+  name: string;
+  icon_url: string;
+  version_id: string;
+  version: string;
+  channel: string;
+  download_url: string;
+  required_by: string;
+  hashes?: Record<string, string>;
+}
+
+export interface DependencyPlan {
+  install: DependencyInstall[];
+  warnings?: string[];
+  blockers?: string[];
 }
 
 export interface AddModResponse {
   mods: Mod[];
   warning?: string;
+  warnings?: string[];
+  dependencies?: DependencyInstall[];
+}
+
+export async function getModDependencies(
+  payload: NewMod,
+): Promise<DependencyPlan> {
+  const res = await apiFetch("/api/mods/dependencies", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(payload),
+  });
+  if (res.status === 401) throw new Error("token required");
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
 }
 
 export async function addMod(payload: NewMod): Promise<AddModResponse> {
@@ -239,6 +337,130 @@ export async function addInstance(payload: NewInstance): Promise<Instance> {
   return parseJSON(res);
 }
 
+export interface MrpackImport {
+  instance: Instance;
+  mods: Mod[];
+  untracked: string[];
+  pushed: number;
+  overrides: number;
+  failed?: Record<string, string>;
+}
+
+export async function importMrpack(
+  file: File,
+  opts: { name?: string; serverId?: string; push?: boolean } = {},
+): Promise<MrpackImport> {
+  const form = new FormData();
+  form.append("file", file);
+  if (opts.name) form.append("name", opts.name);
+  if (opts.serverId) form.append("server_id", opts.serverId);
+  if (opts.push) form.append("push", "true");
+  const res = await apiFetch("/api/instances/import/mrpack", {
+    method: "POST",
+    body: form,
+  });
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export function mrpackExportURL(
+  id: number,
+  opts: { loaderVersion?: string; client?: boolean } = {},
+): string {
+  const params = new URLSearchParams();
+  if (opts.loaderVersion) params.set("loader_version", opts.loaderVersion);
+  if (opts.client) params.set("side", "client");
+  const qs = params.toString();
+  return `/api/instances/${id}/export.mrpack${qs ? `?${qs}` : ""}`;
+}
+
+export async function exportMrpack(
+  id: number,
+  opts: { loaderVersion?: string; client?: boolean } = {},
+): Promise<{ blob: Blob; skipped: number }> {
+  const res = await apiFetch(mrpackExportURL(id, opts));
+  if (!res.ok) throw await parseError(res);
+  return {
+    blob: await res.blob(),
+    skipped: Number(res.headers.get("X-Mrpack-Skipped") ?? 0),
+  };
+}
+
+export interface PackwizImport {
+  instance: Instance;
+  added: Mod[];
+  updated: Mod[];
+  unchanged: number;
+  untracked: string[];
+  warnings?: string[];
+}
+
+export interface DriftItem {
+  name: string;
+  pack?: string;
+  current?: string;
+}
+
+export interface DriftReport {
+  missing: DriftItem[];
+  extra: DriftItem[];
+  changed: DriftItem[];
+  in_sync: number;
+}
+
+export interface PackwizDrift {
+  source?: string;
+  tracked: DriftReport;
+  server?: DriftReport;
+  server_error?: string;
+}
+
+// packwizBody sends an uploaded pack or a pack.toml URL; with neither the
+// server uses the URL the instance was imported from.
+function packwizBody(src: { file?: File; url?: string }): RequestInit {
+  if (src.file) {
+    const form = new FormData();
+    form.append("file", src.file);
+    return { method: "POST", body: form };
+  }
+  return {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(src.url ? { url: src.url } : {}),
+  };
+}
+
+export async function importPackwiz(
+  id: number,
+  src: { file?: File; url?: string },
+): Promise<PackwizImport> {
+  const res = await apiFetch(
+    `/api/instances/${id}/packwiz/import`,
+    packwizBody(src),
+  );
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export async function reconcilePackwiz(
+  id: number,
+  src: { file?: File; url?: string } = {},
+): Promise<PackwizDrift> {
+  const res = await apiFetch(
+    `/api/instances/${id}/packwiz/reconcile`,
+    packwizBody(src),
+  );
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export function packwizExportURL(id: number, loaderVersion?: string): string {
+  const qs = loaderVersion
+    ? `?loader_version=${encodeURIComponent(loaderVersion)}`
+    : "";
+  return `/api/instances/${id}/packwiz/export${qs}`;
+}
+
 export async function updateInstance(
   id: number,
   payload: UpdateInstance,
@@ -285,6 +507,346 @@ export async function startModUpdate(
   return parseJSON(res);
 }
 
+export async function rollbackMod(id: number): Promise<UpdateJobAck> {
+  const res = await apiFetch(`/api/mods/${id}/rollback`, { method: "POST" });
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export interface UpdatePlanItem {
+  // Set on manifest plans; empty for available updates
+  action?: "install" | "update" | "remove";
+  mod_id: number;
+  source?: string;
+  name: string;
+  slug: string;
+  from_version: string;
+  to_version: string;
+  channel: string;
+  version_id?: string;
+  file?: string;
+  url?: string;
+  size: number;
+  dependencies: DependencyInstall[];
+  warnings?: string[];
+  blockers?: string[];
+}
+
+export interface UpdatePlan {
+  instance_id: number;
+  items: UpdatePlanItem[];
+  total_size: number;
+}
+
+export type BatchFailurePolicy = "stop" | "continue";
+
+export interface UpdatesRequest {
+  mod_ids?: number[];
+  on_failure?: BatchFailurePolicy;
+}
+
+export interface UpdateBatchAck {
+  batch_id: number;
+  plan: UpdatePlan;
+}
+
+export async function planUpdates(
+  instanceId: number,
+  payload: UpdatesRequest = {},
+): Promise<UpdatePlan> {
+  const res = await apiFetch(`/api/instances/${instanceId}/updates/plan`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(payload),
+  });
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export async function applyUpdates(
+  instanceId: number,
+  payload: UpdatesRequest = {},
+): Promise<UpdateBatchAck> {
+  const res = await apiFetch(`/api/instances/${instanceId}/updates/apply`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(payload),
+  });
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export interface ManifestFieldChange {
+  from: string;
+  to: string;
+}
+
+export interface ManifestPlan {
+  instance_id: number;
+  loader?: ManifestFieldChange;
+  game_version?: ManifestFieldChange;
+  items: UpdatePlanItem[];
+  unchanged: number;
+  total_size: number;
+  server_drift?: ServerDriftReport;
+  warnings?: string[];
+}
+
+export interface ManifestApplyAck {
+  // Absent when only instance settings changed
+  batch_id?: number;
+  plan: ManifestPlan;
+}
+
+// The manifest is sent as written, YAML or JSON.
+export async function planManifest(
+  instanceId: number,
+  manifest: string,
+): Promise<ManifestPlan> {
+  const res = await apiFetch(`/api/instances/${instanceId}/manifest/plan`, {
+    method: "POST",
+    headers: { "Content-Type": "application/yaml" },
+    body: manifest,
+  });
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export async function applyManifest(
+  instanceId: number,
+  manifest: string,
+  onFailure: BatchFailurePolicy = "stop",
+): Promise<ManifestApplyAck> {
+  const res = await apiFetch(
+    `/api/instances/${instanceId}/manifest/apply?on_failure=${onFailure}`,
+    {
+      method: "POST",
+      headers: { "Content-Type": "application/yaml" },
+      body: manifest,
+    },
+  );
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export type PolicyChannel = "release" | "beta" | "alpha";
+
+export interface UpdatePolicy {
+  pin?: string;
+  min_channel?: PolicyChannel;
+  allow_major?: boolean;
+  auto_apply?: boolean;
+}
+
+export interface EffectivePolicy {
+  pin?: string;
+  min_channel: PolicyChannel;
+  allow_major: boolean;
+  auto_apply: boolean;
+}
+
+export interface ModPolicy {
+  policy: UpdatePolicy;
+  effective: EffectivePolicy;
+}
+
+export async function getInstancePolicy(
+  instanceId: number,
+): Promise<UpdatePolicy> {
+  const res = await apiFetch(`/api/instances/${instanceId}/policy`);
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export async function setInstancePolicy(
+  instanceId: number,
+  policy: UpdatePolicy,
+): Promise<UpdatePolicy> {
+  const res = await apiFetch(`/api/instances/${instanceId}/policy`, {
+    method: "PUT",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(policy),
+  });
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export async function getModPolicy(id: number): Promise<ModPolicy> {
+  const res = await apiFetch(`/api/mods/${id}/policy`);
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export async function setModPolicy(
+  id: number,
+  policy: UpdatePolicy,
+): Promise<ModPolicy> {
+  const res = await apiFetch(`/api/mods/${id}/policy`, {
+    method: "PUT",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(policy),
+  });
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export async function deleteModPolicy(id: number): Promise<ModPolicy> {
+  const res = await apiFetch(`/api/mods/${id}/policy`, { method: "DELETE" });
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export interface MaintenanceWindow {
+  instance_id: number;
+  schedule: string;
+  duration_minutes: number;
+  timezone: string;
+  restart_server: boolean;
+  updated_at?: string;
+  open: boolean;
+  next_open: string;
+  closes_at?: string;
+}
+
+export interface MaintenanceWindowInput {
+  schedule: string;
+  duration_minutes: number;
+  timezone?: string;
+  restart_server?: boolean;
+}
+
+export async function getMaintenanceWindow(
+  instanceId: number,
+): Promise<MaintenanceWindow | null> {
+  const res = await apiFetch(`/api/instances/${instanceId}/maintenance-window`);
+  if (res.status === 404) return null;
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export async function setMaintenanceWindow(
+  instanceId: number,
+  window: MaintenanceWindowInput,
+): Promise<MaintenanceWindow> {
+  const res = await apiFetch(`/api/instances/${instanceId}/maintenance-window`, {
+    method: "PUT",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(window),
+  });
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export async function deleteMaintenanceWindow(instanceId: number): Promise<void> {
+  const res = await apiFetch(`/api/instances/${instanceId}/maintenance-window`, {
+    method: "DELETE",
+  });
+  if (!res.ok) throw await parseError(res);
+}
+
+export interface ServerDriftFile {
+  // Jar now on the server, and the one last seen there
+  file?: string;
+  previous?: string;
+  mod_id?: number;
+  name: string;
+  from_version?: string;
+  to_version?: string;
+}
+
+export interface ServerDriftReport {
+  instance_id: number;
+  checked_at: string;
+  folder: string;
+  added: ServerDriftFile[];
+  removed: ServerDriftFile[];
+  changed: ServerDriftFile[];
+  sync_job_id?: number;
+}
+
+export interface DriftCheck {
+  instance_id: number;
+  // 0 when the instance is only checked on demand
+  interval_minutes: number;
+  auto_reconcile: boolean;
+  last_checked_at?: string;
+  updated_at?: string;
+  report?: ServerDriftReport;
+}
+
+export async function getDriftCheck(
+  instanceId: number,
+): Promise<DriftCheck | null> {
+  const res = await apiFetch(`/api/instances/${instanceId}/drift-check`);
+  if (res.status === 404) return null;
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export async function setDriftCheck(
+  instanceId: number,
+  check: { interval_minutes: number; auto_reconcile?: boolean },
+): Promise<DriftCheck> {
+  const res = await apiFetch(`/api/instances/${instanceId}/drift-check`, {
+    method: "PUT",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(check),
+  });
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export async function deleteDriftCheck(instanceId: number): Promise<void> {
+  const res = await apiFetch(`/api/instances/${instanceId}/drift-check`, {
+    method: "DELETE",
+  });
+  if (!res.ok) throw await parseError(res);
+}
+
+export async function runDriftCheck(
+  instanceId: number,
+  reconcile = false,
+): Promise<ServerDriftReport> {
+  const qs = reconcile ? "?reconcile=true" : "";
+  const res = await apiFetch(`/api/instances/${instanceId}/drift-check/run${qs}`, {
+    method: "POST",
+  });
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export interface ScanFinding {
+  rule: string;
+  severity: "high" | "medium";
+  entry?: string;
+  detail: string;
+}
+
+export interface JarScan {
+  id: number;
+  instance_id: number;
+  mod_id?: number;
+  file: string;
+  sha256: string;
+  scanned_at: string;
+  findings: ScanFinding[];
+}
+
+export interface InstanceScan {
+  instance_id: number;
+  flagged: number;
+  blocked: number;
+  scans: JarScan[];
+}
+
+export async function getInstanceScan(instanceId: number): Promise<InstanceScan> {
+  const res = await apiFetch(`/api/instances/${instanceId}/scan`, {
+    cache: "no-store",
+  });
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
 export async function deleteMod(
   id: number,
   instanceId: number,
@@ -313,9 +875,71 @@ export async function getDashboard(): Promise<DashboardData> {
   return parseJSON(res);
 }
 
+export async function getModrinthBudget(): Promise<ModrinthBudget> {
+  const res = await apiFetch("/api/meta/modrinth/budget", { cache: "no-store" });
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export interface ModrinthCacheStats {
+  endpoint: string;
+  entries: number;
+  expired: number;
+  bytes: number;
+}
+
+export interface ModrinthCacheEntry {
+  key: string;
+  endpoint: string;
+  size: number;
+  etag: string;
+  fetched_at: string;
+  expires_at: string;
+}
+
+export interface ModrinthCache {
+  endpoints: ModrinthCacheStats[];
+  entries: ModrinthCacheEntry[];
+  ttl_seconds: Record<string, number>;
+}
+
+export async function getModrinthCache(endpoint?: string): Promise<ModrinthCache> {
+  const qs = endpoint ? `?endpoint=${encodeURIComponent(endpoint)}` : "";
+  const res = await apiFetch(`/api/admin/modrinth-cache${qs}`, { cache: "no-store" });
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
+export async function purgeModrinthCache(opts: { endpoint?: string; key?: string } = {}): Promise<{ removed: number }> {
+  const params = new URLSearchParams();
+  if (opts.endpoint) params.set("endpoint", opts.endpoint);
+  if (opts.key) params.set("key", opts.key);
+  const qs = params.toString();
+  const res = await apiFetch(`/api/admin/modrinth-cache${qs ? `?${qs}` : ""}`, { method: "DELETE" });
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
+}
+
 export interface PufferServer {
   id: string;
   name: string;
+  // Named PufferPanel connection the server was listed from
+  connection?: string;
+}
+
+export interface PufferConnection {
+  id: string;
+  name: string;
+  base_url: string;
+}
+
+export async function getPufferConnections(): Promise<PufferConnection[]> {
+  const res = await apiFetch("/api/pufferpanel/connections", {
+    headers: { ...adminAuth() },
+    credentials: "same-origin",
+  });
+  if (!res.ok) throw await parseError(res);
+  return parseJSON(res);
 }
 
 // Historical: SyncResult was returned when sync ran inline.
@@ -362,8 +986,15 @@ export const jobs = {
   retry: retryJob,
 };
 
-export async function getPufferServers(): Promise<PufferServer[]> {
-  const res = await apiFetch("/api/instances/sync", {
+export async function getPufferServers(
+  backend?: ServerBackend,
+  connection?: string,
+): Promise<PufferServer[]> {
+  const params = new URLSearchParams();
+  if (backend) params.set("backend", backend);
+  if (connection) params.set("connection", connection);
+  const qs = params.toString();
+  const res = await apiFetch(`/api/instances/sync${qs ? `?${qs}` : ""}`, {
     method: "POST",
     headers: { ...adminAuth() },
     credentials: "same-origin",
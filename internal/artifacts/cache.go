@@ -0,0 +1,265 @@
+package artifacts
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// digestLen maps the hash algorithms the cache can look up by to their hex
+// digest length. Blobs are keyed by sha512; the others are aliases.
+var digestLen = map[string]int{"sha512": 128, "sha256": 64, "sha1": 40}
+
+// Cache is a content-addressed jar store shared by all instances. Blobs are
+// keyed by their SHA-512 and may also be found by published SHA-1 or SHA-256
+// digests. Once the cache grows past its limit, the least recently used
+// blobs that are not kept are evicted.
+type Cache struct {
+	dir string
+	max int64
+
+	mu   sync.Mutex
+	size int64 // bytes of blobs on disk; -1 until first counted
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// CacheStats reports cache usage since startup.
+type CacheStats struct {
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+	Blobs    int   `json:"blobs"`
+	Bytes    int64 `json:"bytes"`
+	MaxBytes int64 `json:"max_bytes"`
+}
+
+// NewCache returns a Cache rooted at dir holding up to maxBytes of blobs.
+func NewCache(dir string, maxBytes int64) *Cache {
+	return &Cache{dir: dir, max: maxBytes, size: -1}
+}
+
+func validDigest(algo, digest string) bool {
+	n, ok := digestLen[algo]
+	if !ok || len(digest) != n {
+		return false
+	}
+	_, err := hex.DecodeString(digest)
+	return err == nil
+}
+
+func (c *Cache) blobPath(sum string) string {
+	return filepath.Join(c.dir, "sha512", sum[:2], sum)
+}
+
+func (c *Cache) aliasPath(algo, digest string) string {
+	return filepath.Join(c.dir, "alias", algo, digest)
+}
+
+// Get returns the blob with the given digest and counts a hit or miss.
+// Blobs that no longer match their key are dropped.
+func (c *Cache) Get(algo, digest string) ([]byte, bool) {
+	data, ok := c.get(algo, strings.ToLower(digest))
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return data, ok
+}
+
+func (c *Cache) get(algo, digest string) ([]byte, bool) {
+	if !validDigest(algo, digest) {
+		return nil, false
+	}
+	sum := digest
+	if algo != "sha512" {
+		b, err := os.ReadFile(c.aliasPath(algo, digest))
+		if err != nil {
+			return nil, false
+		}
+		sum = strings.TrimSpace(string(b))
+		if !validDigest("sha512", sum) {
+			return nil, false
+		}
+	}
+	p := c.blobPath(sum)
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if algo != "sha512" {
+			_ = os.Remove(c.aliasPath(algo, digest))
+		}
+		return nil, false
+	}
+	if got := sha512.Sum512(data); hex.EncodeToString(got[:]) != sum {
+		c.remove(p, int64(len(data)))
+		return nil, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(p, now, now)
+	return data, true
+}
+
+// Has reports whether a blob with the given SHA-512 is cached, without
+// counting a hit or miss.
+func (c *Cache) Has(sum string) bool {
+	sum = strings.ToLower(sum)
+	if !validDigest("sha512", sum) {
+		return false
+	}
+	_, err := os.Stat(c.blobPath(sum))
+	return err == nil
+}
+
+// Put stores data and returns its SHA-512. aliases maps "sha1" or "sha256"
+// to digests the blob can also be found by; other entries are ignored.
+func (c *Cache) Put(data []byte, aliases map[string]string) (string, error) {
+	s := sha512.Sum512(data)
+	sum := hex.EncodeToString(s[:])
+	p := c.blobPath(sum)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.countLocked()
+	if _, err := os.Stat(p); err != nil {
+		if err := writeFileAtomic(p, data); err != nil {
+			return "", err
+		}
+		c.size += int64(len(data))
+	} else {
+		now := time.Now()
+		_ = os.Chtimes(p, now, now)
+	}
+	for algo, digest := range aliases {
+		digest = strings.ToLower(strings.TrimSpace(digest))
+		if algo == "sha512" || !validDigest(algo, digest) {
+			continue
+		}
+		if err := writeFileAtomic(c.aliasPath(algo, digest), []byte(sum)); err != nil {
+			return sum, err
+		}
+	}
+	return sum, nil
+}
+
+func writeFileAtomic(full string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return err
+	}
+	tmp := full + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, full); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+type blobInfo struct {
+	path string
+	sum  string
+	size int64
+	used time.Time
+}
+
+// blobs lists cached blobs.
+func (c *Cache) blobs() ([]blobInfo, error) {
+	var out []blobInfo
+	err := filepath.WalkDir(filepath.Join(c.dir, "sha512"), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !validDigest("sha512", d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		out = append(out, blobInfo{path: p, sum: d.Name(), size: info.Size(), used: info.ModTime()})
+		return nil
+	})
+	return out, err
+}
+
+// countLocked totals the blobs on disk the first time it is needed.
+func (c *Cache) countLocked() {
+	if c.size >= 0 {
+		return
+	}
+	c.size = 0
+	if bs, err := c.blobs(); err == nil {
+		for _, b := range bs {
+			c.size += b.size
+		}
+	}
+}
+
+func (c *Cache) remove(p string, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.Remove(p); err == nil && c.size >= 0 {
+		c.size -= size
+	}
+}
+
+// Evict removes least recently used blobs until the cache fits its limit.
+// Blobs whose SHA-512 is in keep are never removed, so the cache may stay
+// over the limit when everything left is kept. It returns how many blobs
+// were removed.
+func (c *Cache) Evict(keep map[string]bool) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.countLocked()
+	if c.size <= c.max {
+		return 0, nil
+	}
+	bs, err := c.blobs()
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(bs, func(i, j int) bool { return bs[i].used.Before(bs[j].used) })
+	removed := 0
+	for _, b := range bs {
+		if c.size <= c.max {
+			break
+		}
+		if keep[b.sum] {
+			continue
+		}
+		if err := os.Remove(b.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, err
+		}
+		c.size -= b.size
+		removed++
+	}
+	return removed, nil
+}
+
+// Stats returns hit and miss counts and the current cache size.
+func (c *Cache) Stats() CacheStats {
+	st := CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), MaxBytes: c.max}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if bs, err := c.blobs(); err == nil {
+		st.Blobs = len(bs)
+		c.size = 0
+		for _, b := range bs {
+			c.size += b.size
+		}
+	}
+	st.Bytes = c.size
+	return st
+}
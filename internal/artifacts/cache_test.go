@@ -0,0 +1,70 @@
+package artifacts
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCachePutGetByAlias(t *testing.T) {
+	c := NewCache(t.TempDir(), 1<<20)
+	s1 := sha1.Sum([]byte("jar"))
+	sha1Hex := hex.EncodeToString(s1[:])
+	sum, err := c.Put([]byte("jar"), map[string]string{"sha1": sha1Hex, "md5": "ignored"})
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if b, ok := c.Get("sha512", sum); !ok || string(b) != "jar" {
+		t.Fatalf("get by sha512 = %q, %v", b, ok)
+	}
+	if b, ok := c.Get("sha1", sha1Hex); !ok || string(b) != "jar" {
+		t.Fatalf("get by sha1 = %q, %v", b, ok)
+	}
+	if _, ok := c.Get("sha256", sha1Hex); ok {
+		t.Fatal("hit with wrong algorithm")
+	}
+	st := c.Stats()
+	if st.Hits != 2 || st.Misses != 1 || st.Blobs != 1 || st.Bytes != 3 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
+
+func TestCacheDropsCorruptBlob(t *testing.T) {
+	c := NewCache(t.TempDir(), 1<<20)
+	sum, _ := c.Put([]byte("jar"), nil)
+	if err := os.WriteFile(c.blobPath(sum), []byte("jaz"), 0o644); err != nil {
+		t.Fatalf("corrupt: %v", err)
+	}
+	if _, ok := c.Get("sha512", sum); ok {
+		t.Fatal("corrupt blob served")
+	}
+	if _, err := os.Stat(c.blobPath(sum)); !os.IsNotExist(err) {
+		t.Fatalf("corrupt blob kept: %v", err)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewCache(t.TempDir(), 8)
+	old, _ := c.Put([]byte("aaaa"), nil)
+	kept, _ := c.Put([]byte("bbbb"), nil)
+	recent, _ := c.Put([]byte("cccc"), nil)
+	base := time.Now().Add(-time.Hour)
+	for i, sum := range []string{kept, old, recent} {
+		at := base.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(c.blobPath(sum), at, at)
+	}
+	n, err := c.Evict(map[string]bool{kept: true})
+	if err != nil || n != 1 {
+		t.Fatalf("evict = %d, %v", n, err)
+	}
+	if _, ok := c.Get("sha512", old); ok {
+		t.Fatal("least recently used blob kept")
+	}
+	for _, sum := range []string{kept, recent} {
+		if _, ok := c.Get("sha512", sum); !ok {
+			t.Fatalf("blob %s evicted", sum[:8])
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Package artifacts keeps mod jars on local disk so updates can be undone
+// and downloads reused across instances.
+package artifacts
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidPath is returned for store paths that escape the store root.
+var ErrInvalidPath = errors.New("invalid artifact path")
+
+// Store saves jars under a root directory. Paths returned by Put are
+// relative to the root so the data dir can move without touching the DB.
+type Store struct {
+	dir string
+}
+
+// New returns a Store rooted at dir. The directory is created on first write.
+func New(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Dir returns the store root.
+func (s *Store) Dir() string { return s.dir }
+
+// UpdateKey returns the store key for jars retained by a mod_updates row.
+func UpdateKey(updateID int) string {
+	return fmt.Sprintf("updates/%d", updateID)
+}
+
+// Put writes data as key/name and returns its store path.
+func (s *Store) Put(key, name string, data []byte) (string, error) {
+	name = filepath.Base(strings.TrimSpace(name))
+	if name == "." || name == string(filepath.Separator) || name == "" {
+		return "", ErrInvalidPath
+	}
+	rel := filepath.ToSlash(filepath.Join(key, name))
+	full, err := s.resolve(rel)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return "", err
+	}
+	tmp := full + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, full); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return rel, nil
+}
+
+// Get reads a stored artifact.
+func (s *Store) Get(path string) ([]byte, error) {
+	full, err := s.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(full)
+}
+
+// Remove deletes a stored artifact and its directory when left empty.
+// Missing artifacts are not an error.
+func (s *Store) Remove(path string) error {
+	full, err := s.resolve(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(full); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	// Best-effort: drop the now-empty key directory.
+	_ = os.Remove(filepath.Dir(full))
+	return nil
+}
+
+func (s *Store) resolve(path string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(path))
+	if clean == "." || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", ErrInvalidPath
+	}
+	return filepath.Join(s.dir, clean), nil
+}
@@ -0,0 +1,44 @@
+package artifacts
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStorePutGetRemove(t *testing.T) {
+	s := New(t.TempDir())
+	p, err := s.Put(UpdateKey(7), "sodium-0.5.2.jar", []byte("jar"))
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if p != "updates/7/sodium-0.5.2.jar" {
+		t.Fatalf("path = %q", p)
+	}
+	b, err := s.Get(p)
+	if err != nil || string(b) != "jar" {
+		t.Fatalf("get = %q, %v", b, err)
+	}
+	if err := s.Remove(p); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(s.Dir(), "updates", "7")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("key dir still present: %v", err)
+	}
+	if err := s.Remove(p); err != nil {
+		t.Fatalf("remove missing: %v", err)
+	}
+}
+
+func TestStoreRejectsEscapingPaths(t *testing.T) {
+	s := New(t.TempDir())
+	for _, p := range []string{"../secret.key", "/etc/passwd", "updates/../../x"} {
+		if _, err := s.Get(p); !errors.Is(err, ErrInvalidPath) {
+			t.Fatalf("Get(%q) err = %v, want ErrInvalidPath", p, err)
+		}
+	}
+	if _, err := s.Put("../up", "x.jar", nil); !errors.Is(err, ErrInvalidPath) {
+		t.Fatalf("Put escaping key err = %v", err)
+	}
+}
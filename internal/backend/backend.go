@@ -0,0 +1,125 @@
+// Package backend defines how ModSentinel reaches the game servers whose
+// mods it manages. Each instance is bound to a server on one backend, such
+// as a PufferPanel or Pterodactyl panel, a local directory or an SFTP host.
+package backend
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+	"time"
+)
+
+// Kinds of backend an instance can be bound to.
+const (
+	PufferPanel = "pufferpanel"
+	// Pterodactyl also covers Pelican, which kept its client API.
+	Pterodactyl = "pterodactyl"
+	// Local serves servers from directories on the ModSentinel host.
+	Local = "local"
+	SFTP  = "sftp"
+)
+
+// Kinds lists the known backend kinds.
+var Kinds = []string{PufferPanel, Pterodactyl, Local, SFTP}
+
+// Kind returns the canonical kind for s and whether it is known. Empty means
+// PufferPanel, which instances used before backends were configurable.
+func Kind(s string) (string, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "":
+		return PufferPanel, true
+	case "pelican":
+		return Pterodactyl, true
+	}
+	for _, k := range Kinds {
+		if s == k {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// Server is a game server a backend exposes.
+type Server struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Connection names the panel connection serving the server when
+	// servers are listed across several.
+	Connection string `json:"connection,omitempty"`
+}
+
+// FileEntry is a file or directory in a server's file tree. Size and
+// ModTime are zero when the backend does not list them.
+type FileEntry struct {
+	Name    string    `json:"name"`
+	IsDir   bool      `json:"is_dir"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"mod_time,omitzero"`
+}
+
+// ServerBackend lists servers and manages their files. Paths are relative
+// to the server root and use forward slashes.
+type ServerBackend interface {
+	// ListServers returns the servers the stored credentials can access.
+	ListServers(ctx context.Context) ([]Server, error)
+	// GetServer returns a single server, or ErrNotFound.
+	GetServer(ctx context.Context, serverID string) (*Server, error)
+	ListPath(ctx context.Context, serverID, path string) ([]FileEntry, error)
+	FetchFile(ctx context.Context, serverID, path string) ([]byte, error)
+	PutFile(ctx context.Context, serverID, path string, data []byte) error
+	DeleteFile(ctx context.Context, serverID, path string) error
+	// ServerStatus reports whether the server's process is running.
+	ServerStatus(ctx context.Context, serverID string) (bool, error)
+}
+
+// PowerController is implemented by backends that can stop and start
+// servers.
+type PowerController interface {
+	// StopServer stops a server and waits for its process to exit.
+	StopServer(ctx context.Context, serverID string) error
+	// StartServer starts a server without waiting for it to come online.
+	StartServer(ctx context.Context, serverID string) error
+	RestartServer(ctx context.Context, serverID string) error
+}
+
+var (
+	// ErrNotFound is returned when the requested resource does not exist.
+	ErrNotFound = errors.New("not_found")
+	// ErrForbidden is returned when access is denied.
+	ErrForbidden = errors.New("forbidden")
+	// ErrUnsupported is returned for operations a backend cannot perform.
+	ErrUnsupported = errors.New("not supported by this server backend")
+	// ErrTooLarge is returned when a file exceeds the size a backend reads.
+	ErrTooLarge = errors.New("file too large")
+)
+
+// InRoots reports whether dir is one of roots or lies beneath one. Paths
+// are compared lexically after cleaning, using forward slashes.
+func InRoots(roots []string, dir string) bool {
+	dir = path.Clean(dir)
+	for _, r := range roots {
+		r = path.Clean(r)
+		if dir == r || strings.HasPrefix(dir, strings.TrimSuffix(r, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// RelPath cleans a server-relative path, dropping leading slashes and any
+// ".." that would climb above the server root. The root itself is ".".
+func RelPath(p string) string {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// ConfigError represents a configuration problem before reaching a backend.
+type ConfigError struct{ Reason string }
+
+func (e *ConfigError) Error() string { return e.Reason }
@@ -0,0 +1,619 @@
+// Package curseforge is a client for the CurseForge Core API, used as a second
+// mod source next to Modrinth.
+package curseforge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	urlpkg "net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"modsentinel/internal/telemetry"
+)
+
+const (
+	userAgent      = "ModSentinel/1.0 (+https://github.com/nl2109/ModSentinel)"
+	defaultBaseURL = "https://api.curseforge.com"
+	// MinecraftGameID is CurseForge's game ID for Minecraft.
+	MinecraftGameID = 432
+	// filesPageSize is the page size used when listing files.
+	filesPageSize = 50
+)
+
+// Client wraps HTTP access to the CurseForge API.
+type Client struct {
+	http    *http.Client
+	base    string
+	sf      singleflight.Group
+	ttl     time.Duration
+	cache   map[string]cacheEntry
+	mu      sync.Mutex
+	backoff time.Duration
+}
+
+type cacheEntry struct {
+	data []byte
+	exp  time.Time
+}
+
+// NewClient returns a Client with sane defaults.
+func NewClient() *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = 5 * time.Second
+	transport.ResponseHeaderTimeout = 10 * time.Second
+	transport.ExpectContinueTimeout = 1 * time.Second
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 10
+	transport.MaxConnsPerHost = 10
+	transport.IdleConnTimeout = 90 * time.Second
+
+	return &Client{
+		http:  &http.Client{Timeout: 30 * time.Second, Transport: transport},
+		base:  defaultBaseURL,
+		ttl:   5 * time.Minute,
+		cache: make(map[string]cacheEntry),
+	}
+}
+
+// Kind categorizes CurseForge errors.
+type Kind string
+
+const (
+	KindTimeout     Kind = "timeout"
+	KindCanceled    Kind = "canceled"
+	KindRateLimited Kind = "rate_limited"
+	KindServer      Kind = "server_error"
+	KindClient      Kind = "client_error"
+)
+
+// Error represents a normalized CurseForge API error.
+type Error struct {
+	Kind    Kind
+	Status  int
+	Message string
+	Err     error
+}
+
+// IsNotFound reports whether err is a CurseForge 404.
+func IsNotFound(err error) bool {
+	var ce *Error
+	return errors.As(err, &ce) && ce.Status == http.StatusNotFound
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return "curseforge error"
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+var (
+	// ErrNoAPIKey is returned when no API key is stored.
+	ErrNoAPIKey = errors.New("curseforge API key not set")
+	// ErrDistributionDisabled is returned for files whose authors disabled
+	// third-party downloads.
+	ErrDistributionDisabled = errors.New("file is not available for third-party download")
+)
+
+// randDuration returns a random duration between 0 and max.
+// It is declared as a variable to allow tests to stub out randomness.
+var randDuration = func(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// sleep is declared as a variable so tests can stub out actual sleeping.
+var sleep = time.Sleep
+
+func (c *Client) url(path string, params urlpkg.Values) string {
+	base := c.base
+	if base == "" {
+		base = defaultBaseURL
+	}
+	u := strings.TrimRight(base, "/") + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	return u
+}
+
+// do executes the request with retry/backoff and decodes JSON into v.
+// Request bodies are buffered so they can be replayed on retry and are part
+// of the cache/singleflight key.
+func (c *Client) do(req *http.Request, v interface{}) error {
+	key, err := GetAPIKey()
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(key) == "" {
+		return &Error{Kind: KindClient, Status: http.StatusUnauthorized, Err: ErrNoAPIKey}
+	}
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+		body = b
+	}
+	cacheKey := req.Method + " " + req.URL.String()
+	if len(body) > 0 {
+		cacheKey += " " + string(body)
+	}
+	if c.ttl > 0 {
+		c.mu.Lock()
+		if e, ok := c.cache[cacheKey]; ok {
+			if time.Now().Before(e.exp) {
+				data := e.data
+				c.mu.Unlock()
+				if v != nil {
+					return json.Unmarshal(data, v)
+				}
+				return nil
+			}
+			delete(c.cache, cacheKey)
+		}
+		c.mu.Unlock()
+	}
+	data, err, _ := c.sf.Do(cacheKey, func() (interface{}, error) {
+		c.mu.Lock()
+		bo := c.backoff
+		c.mu.Unlock()
+		if bo > 0 {
+			sleep(bo + randDuration(bo))
+		}
+		req.Header.Set("x-api-key", key)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("User-Agent", userAgent)
+		var resp *http.Response
+		var err error
+		var dur time.Duration
+		urlStr := req.URL.Redacted()
+		for i := 0; i < 3; i++ {
+			if body != nil {
+				req.Body = io.NopCloser(bytes.NewReader(body))
+			}
+			start := time.Now()
+			resp, err = c.http.Do(req)
+			dur = time.Since(start)
+			attempt := strconv.Itoa(i + 1)
+			if err != nil {
+				telemetry.Event("curseforge_request", map[string]string{
+					"method":      req.Method,
+					"url":         urlStr,
+					"status":      "error",
+					"duration_ms": strconv.FormatInt(dur.Milliseconds(), 10),
+					"attempt":     attempt,
+				})
+				kind := KindClient
+				switch {
+				case errors.Is(err, context.Canceled):
+					kind = KindCanceled
+				case errors.Is(err, context.DeadlineExceeded):
+					kind = KindTimeout
+				case func() bool {
+					ne, ok := err.(net.Error)
+					return ok && ne.Timeout()
+				}():
+					kind = KindTimeout
+				}
+				telemetry.Event("curseforge_result", map[string]string{
+					"outcome":     "error",
+					"kind":        string(kind),
+					"duration_ms": strconv.FormatInt(dur.Milliseconds(), 10),
+				})
+				return nil, &Error{Kind: kind, Err: err}
+			}
+			telemetry.Event("curseforge_request", map[string]string{
+				"method":      req.Method,
+				"url":         urlStr,
+				"status":      strconv.Itoa(resp.StatusCode),
+				"duration_ms": strconv.FormatInt(dur.Milliseconds(), 10),
+				"attempt":     attempt,
+			})
+			if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+				delay := time.Duration(1<<i) * 250 * time.Millisecond
+				if ra := resp.Header.Get("Retry-After"); ra != "" {
+					if secs, err := strconv.Atoi(ra); err == nil {
+						if raDelay := time.Duration(secs) * time.Second; raDelay > delay {
+							delay = raDelay
+						}
+					} else if t, err := http.ParseTime(ra); err == nil {
+						if raDelay := time.Until(t); raDelay > delay {
+							delay = raDelay
+						}
+					}
+				}
+				resp.Body.Close()
+				if i == 2 {
+					break
+				}
+				sleep(delay + randDuration(delay))
+				continue
+			}
+			break
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			kind := KindClient
+			c.mu.Lock()
+			if resp.StatusCode == http.StatusTooManyRequests {
+				kind = KindRateLimited
+				if c.backoff == 0 {
+					c.backoff = time.Second
+				} else {
+					c.backoff *= 2
+					if c.backoff > time.Minute {
+						c.backoff = time.Minute
+					}
+				}
+			} else {
+				if resp.StatusCode >= 500 {
+					kind = KindServer
+				}
+				c.backoff = 0
+			}
+			c.mu.Unlock()
+			telemetry.Event("curseforge_result", map[string]string{
+				"outcome":     "error",
+				"kind":        string(kind),
+				"status":      strconv.Itoa(resp.StatusCode),
+				"duration_ms": strconv.FormatInt(dur.Milliseconds(), 10),
+			})
+			var apiErr struct {
+				ErrorMessage string `json:"errorMessage"`
+			}
+			b, _ := io.ReadAll(resp.Body)
+			if err := json.Unmarshal(b, &apiErr); err == nil && apiErr.ErrorMessage != "" {
+				return nil, &Error{Kind: kind, Status: resp.StatusCode, Message: apiErr.ErrorMessage}
+			}
+			return nil, &Error{Kind: kind, Status: resp.StatusCode, Message: resp.Status}
+		}
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		if c.ttl > 0 {
+			if c.cache == nil {
+				c.cache = make(map[string]cacheEntry)
+			}
+			c.cache[cacheKey] = cacheEntry{data: b, exp: time.Now().Add(c.ttl)}
+		}
+		c.backoff = 0
+		c.mu.Unlock()
+		telemetry.Event("curseforge_result", map[string]string{
+			"outcome":     "success",
+			"status":      strconv.Itoa(resp.StatusCode),
+			"duration_ms": strconv.FormatInt(dur.Milliseconds(), 10),
+		})
+		return b, nil
+	})
+	if err != nil {
+		return err
+	}
+	if v != nil {
+		return json.Unmarshal(data.([]byte), v)
+	}
+	return nil
+}
+
+// Mod is a CurseForge project.
+type Mod struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Slug  string `json:"slug"`
+	Links struct {
+		WebsiteURL string `json:"websiteUrl"`
+	} `json:"links"`
+	Logo struct {
+		ThumbnailURL string `json:"thumbnailUrl"`
+	} `json:"logo"`
+}
+
+// Release types reported on files.
+const (
+	ReleaseTypeRelease = 1
+	ReleaseTypeBeta    = 2
+	ReleaseTypeAlpha   = 3
+)
+
+// Hash algorithms reported on files.
+const (
+	HashAlgoSHA1 = 1
+	HashAlgoMD5  = 2
+)
+
+// Dependency relation types reported on files.
+const (
+	RelationEmbedded     = 1
+	RelationOptional     = 2
+	RelationRequired     = 3
+	RelationTool         = 4
+	RelationIncompatible = 5
+	RelationInclude      = 6
+)
+
+// File is a downloadable file of a project.
+type File struct {
+	ID              int       `json:"id"`
+	ModID           int       `json:"modId"`
+	DisplayName     string    `json:"displayName"`
+	FileName        string    `json:"fileName"`
+	ReleaseType     int       `json:"releaseType"`
+	FileDate        time.Time `json:"fileDate"`
+	FileLength      int64     `json:"fileLength"`
+	DownloadURL     string    `json:"downloadUrl"`
+	GameVersions    []string  `json:"gameVersions"`
+	FileFingerprint uint32    `json:"fileFingerprint"`
+	Hashes          []struct {
+		Value string `json:"value"`
+		Algo  int    `json:"algo"`
+	} `json:"hashes"`
+	Dependencies []struct {
+		ModID        int `json:"modId"`
+		RelationType int `json:"relationType"`
+	} `json:"dependencies"`
+}
+
+// Channel maps the file's release type to release, beta or alpha.
+func (f File) Channel() string {
+	switch f.ReleaseType {
+	case ReleaseTypeBeta:
+		return "beta"
+	case ReleaseTypeAlpha:
+		return "alpha"
+	}
+	return "release"
+}
+
+var mcVersionRe = regexp.MustCompile(`^\d+\.\d+(?:\.\d+)?$`)
+
+// MinecraftVersions returns the game versions the file supports. CurseForge
+// mixes loaders and environments into gameVersions; those are dropped.
+func (f File) MinecraftVersions() []string {
+	var out []string
+	for _, v := range f.GameVersions {
+		if mcVersionRe.MatchString(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Loaders returns the lowercase mod loaders listed in gameVersions.
+func (f File) Loaders() []string {
+	var out []string
+	for _, v := range f.GameVersions {
+		if _, ok := modLoaderTypes[strings.ToLower(v)]; ok {
+			out = append(out, strings.ToLower(v))
+		}
+	}
+	return out
+}
+
+// SHA1 returns the file's SHA-1 hash, if reported.
+func (f File) SHA1() string {
+	for _, h := range f.Hashes {
+		if h.Algo == HashAlgoSHA1 {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// modLoaderTypes maps loader names to CurseForge's modLoaderType filter.
+var modLoaderTypes = map[string]int{
+	"forge":    1,
+	"fabric":   4,
+	"quilt":    5,
+	"neoforge": 6,
+}
+
+// Mod fetches a project by ID.
+func (c *Client) Mod(ctx context.Context, id int) (*Mod, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(fmt.Sprintf("/v1/mods/%d", id), nil), nil)
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Data Mod `json:"data"`
+	}
+	if err := c.do(req, &res); err != nil {
+		return nil, err
+	}
+	return &res.Data, nil
+}
+
+// ModBySlug finds a Minecraft project by its slug.
+func (c *Client) ModBySlug(ctx context.Context, slug string) (*Mod, error) {
+	params := urlpkg.Values{}
+	params.Set("gameId", strconv.Itoa(MinecraftGameID))
+	params.Set("slug", slug)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url("/v1/mods/search", params), nil)
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Data []Mod `json:"data"`
+	}
+	if err := c.do(req, &res); err != nil {
+		return nil, err
+	}
+	for _, m := range res.Data {
+		if strings.EqualFold(m.Slug, slug) {
+			m := m
+			return &m, nil
+		}
+	}
+	return nil, &Error{Kind: KindClient, Status: http.StatusNotFound, Message: "project not found"}
+}
+
+// Files lists a project's files, newest first, optionally filtered by game
+// version and loader. Unknown loaders are not sent as a filter.
+func (c *Client) Files(ctx context.Context, modID int, gameVersion, loader string) ([]File, error) {
+	params := urlpkg.Values{}
+	if gameVersion != "" {
+		params.Set("gameVersion", gameVersion)
+	}
+	if t, ok := modLoaderTypes[strings.ToLower(loader)]; ok {
+		params.Set("modLoaderType", strconv.Itoa(t))
+	}
+	params.Set("pageSize", strconv.Itoa(filesPageSize))
+	var out []File
+	for index := 0; ; index += filesPageSize {
+		params.Set("index", strconv.Itoa(index))
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(fmt.Sprintf("/v1/mods/%d/files", modID), params), nil)
+		if err != nil {
+			return nil, err
+		}
+		var res struct {
+			Data       []File `json:"data"`
+			Pagination struct {
+				TotalCount int `json:"totalCount"`
+			} `json:"pagination"`
+		}
+		if err := c.do(req, &res); err != nil {
+			return nil, err
+		}
+		out = append(out, res.Data...)
+		if len(res.Data) == 0 || len(out) >= res.Pagination.TotalCount {
+			break
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].FileDate.After(out[j].FileDate) })
+	return out, nil
+}
+
+// File fetches a single file of a project.
+func (c *Client) File(ctx context.Context, modID, fileID int) (*File, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(fmt.Sprintf("/v1/mods/%d/files/%d", modID, fileID), nil), nil)
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Data File `json:"data"`
+	}
+	if err := c.do(req, &res); err != nil {
+		return nil, err
+	}
+	return &res.Data, nil
+}
+
+// FingerprintMatches looks up the files owning the given fingerprints in a
+// single request. The result is keyed by fingerprint; unknown fingerprints
+// are omitted.
+func (c *Client) FingerprintMatches(ctx context.Context, fingerprints []uint32) (map[uint32]File, error) {
+	if len(fingerprints) == 0 {
+		return map[uint32]File{}, nil
+	}
+	// Sort a copy so equal sets share cache and singleflight entries.
+	sorted := append([]uint32(nil), fingerprints...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	body, err := json.Marshal(struct {
+		Fingerprints []uint32 `json:"fingerprints"`
+	}{sorted})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url(fmt.Sprintf("/v1/fingerprints/%d", MinecraftGameID), nil), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var res struct {
+		Data struct {
+			ExactMatches []struct {
+				ID   int  `json:"id"`
+				File File `json:"file"`
+			} `json:"exactMatches"`
+		} `json:"data"`
+	}
+	if err := c.do(req, &res); err != nil {
+		return nil, err
+	}
+	out := make(map[uint32]File, len(res.Data.ExactMatches))
+	for _, m := range res.Data.ExactMatches {
+		out[m.File.FileFingerprint] = m.File
+	}
+	return out, nil
+}
+
+// DownloadURL returns the download URL of a file. It fails with
+// ErrDistributionDisabled when the author does not allow third-party
+// downloads.
+func (c *Client) DownloadURL(ctx context.Context, modID, fileID int) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(fmt.Sprintf("/v1/mods/%d/files/%d/download-url", modID, fileID), nil), nil)
+	if err != nil {
+		return "", err
+	}
+	var res struct {
+		Data string `json:"data"`
+	}
+	if err := c.do(req, &res); err != nil {
+		var apiErr *Error
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusForbidden {
+			return "", &Error{Kind: KindClient, Status: apiErr.Status, Err: ErrDistributionDisabled}
+		}
+		return "", err
+	}
+	if strings.TrimSpace(res.Data) == "" {
+		return "", &Error{Kind: KindClient, Status: http.StatusForbidden, Err: ErrDistributionDisabled}
+	}
+	return res.Data, nil
+}
+
+// Download fetches the contents of f.
+func (c *Client) Download(ctx context.Context, f File) ([]byte, error) {
+	u := f.DownloadURL
+	if u == "" {
+		var err error
+		if u, err = c.DownloadURL(ctx, f.ModID, f.ID); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, &Error{Kind: KindClient, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		kind := KindClient
+		if resp.StatusCode >= 500 {
+			kind = KindServer
+		}
+		return nil, &Error{Kind: kind, Status: resp.StatusCode, Message: fmt.Sprintf("download failed: %d", resp.StatusCode)}
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,137 @@
+package curseforge
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	dbpkg "modsentinel/internal/db"
+	"modsentinel/internal/secrets"
+
+	_ "modernc.org/sqlite"
+)
+
+func withAPIKey(t *testing.T, key string) {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := dbpkg.Init(db); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	if err := dbpkg.Migrate(db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	old := svc
+	Init(secrets.NewService(db, filepath.Join(t.TempDir(), "key")))
+	t.Cleanup(func() { svc = old })
+	if err := SetAPIKey(key); err != nil {
+		t.Fatalf("set key: %v", err)
+	}
+}
+
+func TestFingerprintIgnoresWhitespace(t *testing.T) {
+	if got := Fingerprint([]byte("hello world\n")); got != 2824650221 {
+		t.Fatalf("Fingerprint = %d", got)
+	}
+	if Fingerprint([]byte("a b\tc\r\n")) != Fingerprint([]byte("abc")) {
+		t.Fatalf("whitespace changed fingerprint")
+	}
+}
+
+func TestRequestsRequireAPIKey(t *testing.T) {
+	old := svc
+	svc = nil
+	defer func() { svc = old }()
+	c := &Client{http: http.DefaultClient, base: "http://127.0.0.1:0"}
+	_, err := c.Mod(context.Background(), 1)
+	if !errors.Is(err, ErrNoAPIKey) {
+		t.Fatalf("err = %v, want ErrNoAPIKey", err)
+	}
+}
+
+func TestFilesPaginatesAndFilters(t *testing.T) {
+	withAPIKey(t, "cf-key")
+	var gotKey, gotLoader string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("x-api-key")
+		gotLoader = r.URL.Query().Get("modLoaderType")
+		index, _ := strconv.Atoi(r.URL.Query().Get("index"))
+		var files []File
+		for i := index; i < index+filesPageSize && i < 60; i++ {
+			files = append(files, File{ID: i, FileDate: time.Unix(int64(i), 0)})
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"data":       files,
+			"pagination": map[string]int{"index": index, "totalCount": 60},
+		})
+	}))
+	defer ts.Close()
+	c := &Client{http: ts.Client(), base: ts.URL}
+	files, err := c.Files(context.Background(), 7, "1.20.1", "Fabric")
+	if err != nil {
+		t.Fatalf("Files: %v", err)
+	}
+	if len(files) != 60 || files[0].ID != 59 {
+		t.Fatalf("files = %d, first = %d", len(files), files[0].ID)
+	}
+	if gotKey != "cf-key" || gotLoader != "4" {
+		t.Fatalf("key = %q, loader = %q", gotKey, gotLoader)
+	}
+}
+
+func TestFingerprintMatches(t *testing.T) {
+	withAPIKey(t, "cf-key")
+	var body struct {
+		Fingerprints []uint32 `json:"fingerprints"`
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/fingerprints/432" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"data":{"exactMatches":[{"id":10,"file":{"id":99,"modId":10,"fileFingerprint":3000000000,"releaseType":2,"gameVersions":["1.20.1","Fabric","Client"]}}]}}`))
+	}))
+	defer ts.Close()
+	c := &Client{http: ts.Client(), base: ts.URL}
+	got, err := c.FingerprintMatches(context.Background(), []uint32{3000000000, 5})
+	if err != nil {
+		t.Fatalf("FingerprintMatches: %v", err)
+	}
+	if len(body.Fingerprints) != 2 || body.Fingerprints[0] != 5 {
+		t.Fatalf("request fingerprints = %v", body.Fingerprints)
+	}
+	f, ok := got[3000000000]
+	if !ok || f.ID != 99 || f.Channel() != "beta" {
+		t.Fatalf("matches = %+v", got)
+	}
+	if l := f.Loaders(); len(l) != 1 || l[0] != "fabric" {
+		t.Fatalf("loaders = %v", l)
+	}
+	if v := f.MinecraftVersions(); len(v) != 1 || v[0] != "1.20.1" {
+		t.Fatalf("game versions = %v", v)
+	}
+}
+
+func TestDownloadURLDistributionDisabled(t *testing.T) {
+	withAPIKey(t, "cf-key")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errorCode":403,"errorMessage":"forbidden"}`))
+	}))
+	defer ts.Close()
+	c := &Client{http: ts.Client(), base: ts.URL}
+	_, err := c.Download(context.Background(), File{ID: 1, ModID: 2})
+	if !errors.Is(err, ErrDistributionDisabled) {
+		t.Fatalf("err = %v, want ErrDistributionDisabled", err)
+	}
+}
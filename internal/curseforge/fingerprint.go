@@ -0,0 +1,48 @@
+package curseforge
+
+// Fingerprint returns the CurseForge fingerprint of a file: a 32-bit
+// MurmurHash2 with seed 1 over the contents with tab, newline, carriage return
+// and space bytes removed.
+func Fingerprint(data []byte) uint32 {
+	buf := make([]byte, 0, len(data))
+	for _, b := range data {
+		switch b {
+		case 9, 10, 13, 32:
+			continue
+		}
+		buf = append(buf, b)
+	}
+	return murmur2(buf, 1)
+}
+
+func murmur2(data []byte, seed uint32) uint32 {
+	const (
+		m = 0x5bd1e995
+		r = 24
+	)
+	h := seed ^ uint32(len(data))
+	for len(data) >= 4 {
+		k := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+		data = data[4:]
+	}
+	switch len(data) {
+	case 3:
+		h ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
@@ -0,0 +1,40 @@
+package curseforge
+
+import (
+	"context"
+
+	"modsentinel/internal/secrets"
+)
+
+// secretName is the secrets.Service entry holding the CurseForge API key.
+const secretName = "curseforge"
+
+var svc *secrets.Service
+
+// Init sets the secrets service used to store the API key.
+func Init(s *secrets.Service) { svc = s }
+
+// SetAPIKey stores the CurseForge API key.
+func SetAPIKey(key string) error {
+	if svc == nil {
+		return nil
+	}
+	return svc.Set(context.Background(), secretName, []byte(key))
+}
+
+// GetAPIKey retrieves the CurseForge API key for internal use.
+func GetAPIKey() (string, error) {
+	if svc == nil {
+		return "", nil
+	}
+	b, err := svc.Get(context.Background(), secretName)
+	return string(b), err
+}
+
+// ClearAPIKey removes the stored CurseForge API key.
+func ClearAPIKey() error {
+	if svc == nil {
+		return nil
+	}
+	return svc.Delete(context.Background(), secretName)
+}
@@ -14,7 +14,14 @@ type Instance struct {
     ID                  int    `json:"id"`
     Name                string `json:"name" validate:"max=128"`
     Loader              string `json:"loader"`
+    // PufferpanelServerID is the ID of the bound server on Backend; the
+    // name predates other backends.
     PufferpanelServerID string `json:"pufferpanel_server_id"`
+    // Backend names the server backend kind, PufferPanel unless set.
+    Backend             string `json:"backend"`
+    // ConnectionID names the PufferPanel connection of the server; empty
+    // means the default connection.
+    ConnectionID        string `json:"connection_id,omitempty"`
     RequiresLoader      bool   `json:"requires_loader"`
     // GameVersion stores the detected game (Minecraft) version for this instance.
     GameVersion         string `json:"game_version"`
@@ -26,6 +33,21 @@ type Instance struct {
     LastSyncAdded       int    `json:"last_sync_added"`
     LastSyncUpdated     int    `json:"last_sync_updated"`
 	LastSyncFailed      int    `json:"last_sync_failed"`
+	// RollbackRetention is how many previous jars are kept per mod for rollback.
+	RollbackRetention   int    `json:"rollback_retention"`
+	// RestartAfterUpdate restarts the PufferPanel server once updates apply.
+	RestartAfterUpdate  bool   `json:"restart_after_update"`
+}
+
+// DefaultRollbackRetention is the rollback retention of new instances.
+const DefaultRollbackRetention = 3
+
+// instanceColumns lists the instances columns read into an Instance, in
+// scanInstance order before the trailing mod count.
+const instanceColumns = `i.id, IFNULL(i.name, ''), IFNULL(i.loader, ''), IFNULL(i.pufferpanel_server_id, ''), IFNULL(i.requires_loader, 0), IFNULL(i.game_version, ''), IFNULL(i.puffer_version_key, ''), IFNULL(i.created_at, ''), IFNULL(i.last_sync_at, ''), IFNULL(i.last_sync_added, 0), IFNULL(i.last_sync_updated, 0), IFNULL(i.last_sync_failed, 0), IFNULL(i.rollback_retention, 3), IFNULL(i.restart_after_update, 0), IFNULL(NULLIF(i.backend, ''), 'pufferpanel'), IFNULL(i.connection_id, '')`
+
+func scanInstance(sc rowScanner, inst *Instance) error {
+	return sc.Scan(&inst.ID, &inst.Name, &inst.Loader, &inst.PufferpanelServerID, &inst.RequiresLoader, &inst.GameVersion, &inst.PufferVersionKey, &inst.CreatedAt, &inst.LastSyncAt, &inst.LastSyncAdded, &inst.LastSyncUpdated, &inst.LastSyncFailed, &inst.RollbackRetention, &inst.RestartAfterUpdate, &inst.Backend, &inst.ConnectionID, &inst.ModCount)
 }
 
 // Mod represents a tracked mod entry.
@@ -42,6 +64,37 @@ type Mod struct {
 	AvailableChannel string `json:"available_channel"`
 	DownloadURL      string `json:"download_url"`
 	InstanceID       int    `json:"instance_id"`
+	// MatchMethod records how sync identified the jar: hash, fingerprint,
+	// metadata or filename.
+	MatchMethod      string `json:"match_method"`
+	// Source names the provider the mod is tracked on; empty means Modrinth.
+	Source           string `json:"source"`
+	// ClientSide and ServerSide cache the project's side support:
+	// required, optional, unsupported or unknown.
+	ClientSide       string `json:"client_side"`
+	ServerSide       string `json:"server_side"`
+	// ProjectID and VersionID are the source's identifiers for the project
+	// and the installed version, when known.
+	ProjectID        string `json:"project_id,omitempty"`
+	VersionID        string `json:"version_id,omitempty"`
+}
+
+// Mod sources.
+const (
+	SourceModrinth   = "modrinth"
+	SourceCurseForge = "curseforge"
+	SourceHangar     = "hangar"
+)
+
+// modColumns lists the mods columns read into a Mod, in scanMod order.
+const modColumns = `id, IFNULL(name, ''), IFNULL(icon_url, ''), url, IFNULL(game_version, ''), IFNULL(loader, ''), IFNULL(channel, ''), IFNULL(current_version, ''), IFNULL(available_version, ''), IFNULL(available_channel, ''), IFNULL(download_url, ''), IFNULL(instance_id, 0), IFNULL(match_method, ''), IFNULL(NULLIF(source, ''), 'modrinth'), IFNULL(client_side, ''), IFNULL(server_side, ''), IFNULL(project_id, ''), IFNULL(version_id, '')`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMod(sc rowScanner, m *Mod) error {
+	return sc.Scan(&m.ID, &m.Name, &m.IconURL, &m.URL, &m.GameVersion, &m.Loader, &m.Channel, &m.CurrentVersion, &m.AvailableVersion, &m.AvailableChannel, &m.DownloadURL, &m.InstanceID, &m.MatchMethod, &m.Source, &m.ClientSide, &m.ServerSide, &m.ProjectID, &m.VersionID)
 }
 
 // ModUpdate represents a recently applied mod update.
@@ -96,6 +149,10 @@ func Init(db *sql.DB) error {
         "last_sync_added":       "INTEGER DEFAULT 0",
         "last_sync_updated":     "INTEGER DEFAULT 0",
         "last_sync_failed":      "INTEGER DEFAULT 0",
+        "rollback_retention":    "INTEGER DEFAULT 3",
+        "restart_after_update":  "INTEGER DEFAULT 0",
+        "backend":               "TEXT",
+        "connection_id":         "TEXT",
 	}
 
 	rows, err := db.Query(`SELECT name FROM pragma_table_info('instances')`)
@@ -159,6 +216,14 @@ func Init(db *sql.DB) error {
 		"instance_id":       "INTEGER",
 		"installed_file":    "TEXT",
 		"installed_version": "TEXT",
+		"match_method":      "TEXT",
+		"source":            "TEXT",
+		// content_sha512 keys the installed jar in the artifact cache
+		"content_sha512":    "TEXT",
+		"client_side":       "TEXT",
+		"server_side":       "TEXT",
+		"project_id":        "TEXT",
+		"version_id":        "TEXT",
 	}
 
 	rows, err = db.Query(`SELECT name FROM pragma_table_info('mods')`)
@@ -214,6 +279,162 @@ func Init(db *sql.DB) error {
     if err != nil {
         return err
     }
+    // Rollback bookkeeping: what an update replaced and where its jar is kept
+    if err := ensureColumns(db, "mod_updates", map[string]string{
+        "kind":                  "TEXT DEFAULT 'update'",
+        "previous_file":         "TEXT",
+        "previous_download_url": "TEXT",
+        "previous_channel":      "TEXT",
+        "artifact_path":         "TEXT",
+        "rollback_of":           "INTEGER",
+        "rollback_ready":        "INTEGER DEFAULT 0",
+        "batch_id":              "INTEGER",
+        // deferred jobs wait for their instance's maintenance window
+        "deferred":              "INTEGER DEFAULT 0",
+        "previous_sha512":       "TEXT",
+        // removed_mod snapshots the mod a removal stopped tracking
+        "removed_mod":           "TEXT",
+    }); err != nil {
+        return err
+    }
+
+    // Bulk update batches; items are mod_updates rows sharing a batch_id
+    _, err = db.Exec(`CREATE TABLE IF NOT EXISTS update_batches (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        instance_id INTEGER NOT NULL,
+        on_failure TEXT NOT NULL DEFAULT 'stop',
+        status TEXT NOT NULL,
+        total INTEGER DEFAULT 0,
+        succeeded INTEGER DEFAULT 0,
+        failed INTEGER DEFAULT 0,
+        skipped INTEGER DEFAULT 0,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        finished_at DATETIME
+    )`)
+    if err != nil {
+        return err
+    }
+
+    // Update policies: instance defaults and per-mod overrides. NULL columns
+    // inherit from the next level up.
+    _, err = db.Exec(`CREATE TABLE IF NOT EXISTS instance_policies (
+        instance_id INTEGER PRIMARY KEY,
+        min_channel TEXT,
+        allow_major INTEGER,
+        auto_apply INTEGER,
+        updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    )`)
+    if err != nil {
+        return err
+    }
+    _, err = db.Exec(`CREATE TABLE IF NOT EXISTS mod_policies (
+        mod_id INTEGER PRIMARY KEY,
+        pin TEXT,
+        min_channel TEXT,
+        allow_major INTEGER,
+        auto_apply INTEGER,
+        updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    )`)
+    if err != nil {
+        return err
+    }
+
+    // Maintenance windows: a cron schedule in a timezone marks when deferred
+    // updates of an instance may run.
+    _, err = db.Exec(`CREATE TABLE IF NOT EXISTS maintenance_windows (
+        instance_id INTEGER PRIMARY KEY,
+        schedule TEXT NOT NULL,
+        duration_minutes INTEGER NOT NULL,
+        timezone TEXT NOT NULL DEFAULT 'UTC',
+        restart_server INTEGER NOT NULL DEFAULT 0,
+        updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    )`)
+    if err != nil {
+        return err
+    }
+
+    // Drift checks: how often an instance's server folder is compared with
+    // its tracked mods, and the latest report.
+    _, err = db.Exec(`CREATE TABLE IF NOT EXISTS drift_checks (
+        instance_id INTEGER PRIMARY KEY,
+        interval_minutes INTEGER NOT NULL,
+        auto_reconcile INTEGER NOT NULL DEFAULT 0,
+        last_checked_at TEXT,
+        last_report TEXT,
+        updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    )`)
+    if err != nil {
+        return err
+    }
+
+    // Jar scans: the latest malware scan of each jar on an instance and its
+    // findings.
+    _, err = db.Exec(`CREATE TABLE IF NOT EXISTS jar_scans (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        instance_id INTEGER NOT NULL,
+        mod_id INTEGER,
+        file TEXT NOT NULL,
+        sha256 TEXT NOT NULL,
+        scanned_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE(instance_id, file)
+    )`)
+    if err != nil {
+        return err
+    }
+    _, err = db.Exec(`CREATE TABLE IF NOT EXISTS scan_findings (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        scan_id INTEGER NOT NULL,
+        rule TEXT NOT NULL,
+        severity TEXT NOT NULL,
+        entry TEXT,
+        detail TEXT
+    )`)
+    if err != nil {
+        return err
+    }
+    _, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_scan_findings_scan ON scan_findings(scan_id)`)
+    if err != nil {
+        return err
+    }
+
+    // Scheduled update checks and the Modrinth requests each one used.
+    _, err = db.Exec(`CREATE TABLE IF NOT EXISTS update_check_runs (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        started_at DATETIME NOT NULL,
+        finished_at DATETIME NOT NULL,
+        mods INTEGER NOT NULL DEFAULT 0,
+        batched INTEGER NOT NULL DEFAULT 0,
+        fallback INTEGER NOT NULL DEFAULT 0,
+        requests INTEGER NOT NULL DEFAULT 0
+    )`)
+    if err != nil {
+        return err
+    }
+
+    // modrinth_cache persists Modrinth GET responses with their ETag so
+    // restarts do not refetch and stale entries are revalidated cheaply.
+    _, err = db.Exec(`CREATE TABLE IF NOT EXISTS modrinth_cache (
+        key TEXT PRIMARY KEY,
+        endpoint TEXT NOT NULL,
+        body BLOB NOT NULL,
+        etag TEXT NOT NULL DEFAULT '',
+        fetched_at DATETIME NOT NULL,
+        expires_at DATETIME NOT NULL
+    )`)
+    if err != nil {
+        return err
+    }
+
+    // packwiz_sources remembers the pack.toml URL an instance was imported
+    // from so it can be reconciled against later.
+    _, err = db.Exec(`CREATE TABLE IF NOT EXISTS packwiz_sources (
+        instance_id INTEGER PRIMARY KEY,
+        url TEXT NOT NULL,
+        updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+    )`)
+    if err != nil {
+        return err
+    }
 
     _, err = db.Exec(`CREATE TABLE IF NOT EXISTS secrets (
        name TEXT PRIMARY KEY,
@@ -395,6 +616,37 @@ func Init(db *sql.DB) error {
 	return nil
 }
 
+// ensureColumns adds any of cols missing from table.
+func ensureColumns(db *sql.DB, table string, cols map[string]string) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]struct{})
+	for rows.Next() {
+		var n string
+		if err := rows.Scan(&n); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[n] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+	rows.Close()
+	for col, typ := range cols {
+		if _, ok := existing[col]; !ok {
+			stmt := fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, col, typ)
+			if _, err := db.Exec(stmt); err != nil {
+				return fmt.Errorf("add column %s.%s: %w", table, col, err)
+			}
+		}
+	}
+	return nil
+}
+
 // SetInstalledState persists the currently installed file path and version for a mod.
 func SetInstalledState(db *sql.DB, modID int, file, version string) error {
     _, err := db.Exec(`UPDATE mods SET installed_file=?, installed_version=? WHERE id=?`, file, version, modID)
@@ -403,7 +655,7 @@ func SetInstalledState(db *sql.DB, modID int, file, version string) error {
 
 // InsertMod inserts a new mod record.
 func InsertMod(db *sql.DB, m *Mod) error {
-	res, err := db.Exec(`INSERT INTO mods(name, icon_url, url, game_version, loader, channel, current_version, available_version, available_channel, download_url, instance_id) VALUES(?,?,?,?,?,?,?,?,?,?,?)`, m.Name, m.IconURL, m.URL, m.GameVersion, m.Loader, m.Channel, m.CurrentVersion, m.AvailableVersion, m.AvailableChannel, m.DownloadURL, m.InstanceID)
+	res, err := db.Exec(`INSERT INTO mods(name, icon_url, url, game_version, loader, channel, current_version, available_version, available_channel, download_url, instance_id, match_method, source, client_side, server_side, project_id, version_id) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,NULLIF(?, ''),NULLIF(?, ''),NULLIF(?, ''),NULLIF(?, ''),NULLIF(?, ''))`, m.Name, m.IconURL, m.URL, m.GameVersion, m.Loader, m.Channel, m.CurrentVersion, m.AvailableVersion, m.AvailableChannel, m.DownloadURL, m.InstanceID, m.MatchMethod, m.Source, m.ClientSide, m.ServerSide, m.ProjectID, m.VersionID)
 	if err != nil {
 		return err
 	}
@@ -414,21 +666,35 @@ func InsertMod(db *sql.DB, m *Mod) error {
 	return nil
 }
 
-// UpdateMod updates an existing mod.
+// RestoreMod tracks a removed mod again under its previous ID.
+func RestoreMod(db *sql.DB, m *Mod) error {
+	_, err := db.Exec(`INSERT INTO mods(id, name, icon_url, url, game_version, loader, channel, current_version, available_version, available_channel, download_url, instance_id, match_method, source, client_side, server_side, project_id, version_id) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,NULLIF(?, ''),NULLIF(?, ''),NULLIF(?, ''),NULLIF(?, ''),NULLIF(?, ''))`, m.ID, m.Name, m.IconURL, m.URL, m.GameVersion, m.Loader, m.Channel, m.CurrentVersion, m.AvailableVersion, m.AvailableChannel, m.DownloadURL, m.InstanceID, m.MatchMethod, m.Source, m.ClientSide, m.ServerSide, m.ProjectID, m.VersionID)
+	return err
+}
+
+// UpdateMod updates an existing mod. An empty MatchMethod, Source,
+// ClientSide, ServerSide or ProjectID keeps the stored value, as does an
+// empty VersionID unless the current version changes.
 func UpdateMod(db *sql.DB, m *Mod) error {
-	_, err := db.Exec(`UPDATE mods SET name=?, icon_url=?, url=?, game_version=?, loader=?, channel=?, current_version=?, available_version=?, available_channel=?, download_url=?, instance_id=? WHERE id=?`, m.Name, m.IconURL, m.URL, m.GameVersion, m.Loader, m.Channel, m.CurrentVersion, m.AvailableVersion, m.AvailableChannel, m.DownloadURL, m.InstanceID, m.ID)
+	_, err := db.Exec(`UPDATE mods SET name=?, icon_url=?, url=?, game_version=?, loader=?, channel=?, current_version=?, available_version=?, available_channel=?, download_url=?, instance_id=?, match_method=COALESCE(NULLIF(?, ''), match_method), source=COALESCE(NULLIF(?, ''), source), client_side=COALESCE(NULLIF(?, ''), client_side), server_side=COALESCE(NULLIF(?, ''), server_side), project_id=COALESCE(NULLIF(?, ''), project_id), version_id=CASE WHEN IFNULL(current_version, '')=? THEN COALESCE(NULLIF(?, ''), version_id) ELSE NULLIF(?, '') END WHERE id=?`, m.Name, m.IconURL, m.URL, m.GameVersion, m.Loader, m.Channel, m.CurrentVersion, m.AvailableVersion, m.AvailableChannel, m.DownloadURL, m.InstanceID, m.MatchMethod, m.Source, m.ClientSide, m.ServerSide, m.ProjectID, m.CurrentVersion, m.VersionID, m.VersionID, m.ID)
 	return err
 }
 
 // DeleteMod removes a mod by ID.
 func DeleteMod(db *sql.DB, id int) error {
+	if _, err := db.Exec(`DELETE FROM mod_policies WHERE mod_id=?`, id); err != nil {
+		return err
+	}
+	if err := deleteJarScans(db, `mod_id=?`, id); err != nil {
+		return err
+	}
 	_, err := db.Exec(`DELETE FROM mods WHERE id=?`, id)
 	return err
 }
 
 // InsertInstance inserts a new instance record.
 func InsertInstance(db *sql.DB, i *Instance) error {
-    res, err := db.Exec(`INSERT INTO instances(name, loader, pufferpanel_server_id) VALUES(?,?,?)`, i.Name, i.Loader, i.PufferpanelServerID)
+    res, err := db.Exec(`INSERT INTO instances(name, loader, pufferpanel_server_id, backend, connection_id) VALUES(?,?,?,NULLIF(?,''),NULLIF(?,''))`, i.Name, i.Loader, i.PufferpanelServerID, i.Backend, i.ConnectionID)
 	if err != nil {
 		return err
 	}
@@ -442,7 +708,7 @@ func InsertInstance(db *sql.DB, i *Instance) error {
 // UpdateInstance updates an existing instance.
 func UpdateInstance(db *sql.DB, i *Instance) error {
     // Update core editable fields including loader and requires_loader. Also persist optional game_version and puffer_version_key
-    _, err := db.Exec(`UPDATE instances SET name=?, loader=?, requires_loader=?, game_version=?, puffer_version_key=? WHERE id=?`, i.Name, i.Loader, boolToInt(i.RequiresLoader), i.GameVersion, i.PufferVersionKey, i.ID)
+    _, err := db.Exec(`UPDATE instances SET name=?, loader=?, requires_loader=?, game_version=?, puffer_version_key=?, rollback_retention=?, restart_after_update=? WHERE id=?`, i.Name, i.Loader, boolToInt(i.RequiresLoader), i.GameVersion, i.PufferVersionKey, i.RollbackRetention, boolToInt(i.RestartAfterUpdate), i.ID)
     return err
 }
 
@@ -462,10 +728,28 @@ func DeleteInstance(db *sql.DB, id int, targetID *int) error {
 			return err
 		}
 	} else {
+		if _, err := db.Exec(`DELETE FROM mod_policies WHERE mod_id IN (SELECT id FROM mods WHERE instance_id=?)`, id); err != nil {
+			return err
+		}
 		if _, err := db.Exec(`DELETE FROM mods WHERE instance_id=?`, id); err != nil {
 			return err
 		}
 	}
+	if _, err := db.Exec(`DELETE FROM instance_policies WHERE instance_id=?`, id); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`DELETE FROM maintenance_windows WHERE instance_id=?`, id); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`DELETE FROM packwiz_sources WHERE instance_id=?`, id); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`DELETE FROM drift_checks WHERE instance_id=?`, id); err != nil {
+		return err
+	}
+	if err := deleteJarScans(db, `instance_id=?`, id); err != nil {
+		return err
+	}
 	_, err := db.Exec(`DELETE FROM instances WHERE id=?`, id)
 	return err
 }
@@ -473,9 +757,9 @@ func DeleteInstance(db *sql.DB, id int, targetID *int) error {
 // GetInstance returns an instance by ID.
 func GetInstance(db *sql.DB, id int) (*Instance, error) {
     var inst Instance
-    err := db.QueryRow(`SELECT i.id, IFNULL(i.name, ''), IFNULL(i.loader, ''), IFNULL(i.pufferpanel_server_id, ''), IFNULL(i.requires_loader, 0), IFNULL(i.game_version, ''), IFNULL(i.puffer_version_key, ''), IFNULL(i.created_at, ''), IFNULL(i.last_sync_at, ''), IFNULL(i.last_sync_added, 0), IFNULL(i.last_sync_updated, 0), IFNULL(i.last_sync_failed, 0),
+    err := scanInstance(db.QueryRow(`SELECT `+instanceColumns+`,
              (SELECT COUNT(*) FROM mods m WHERE m.instance_id = i.id)
-             FROM instances i WHERE i.id=?`, id).Scan(&inst.ID, &inst.Name, &inst.Loader, &inst.PufferpanelServerID, &inst.RequiresLoader, &inst.GameVersion, &inst.PufferVersionKey, &inst.CreatedAt, &inst.LastSyncAt, &inst.LastSyncAdded, &inst.LastSyncUpdated, &inst.LastSyncFailed, &inst.ModCount)
+             FROM instances i WHERE i.id=?`, id), &inst)
     if err != nil {
         return nil, err
     }
@@ -484,7 +768,7 @@ func GetInstance(db *sql.DB, id int) (*Instance, error) {
 
 // ListInstances returns all instances sorted by ID descending.
 func ListInstances(db *sql.DB) ([]Instance, error) {
-    rows, err := db.Query(`SELECT i.id, IFNULL(i.name, ''), IFNULL(i.loader, ''), IFNULL(i.pufferpanel_server_id, ''), IFNULL(i.requires_loader, 0), IFNULL(i.game_version, ''), IFNULL(i.puffer_version_key, ''), IFNULL(i.created_at, ''), IFNULL(i.last_sync_at, ''), IFNULL(i.last_sync_added, 0), IFNULL(i.last_sync_updated, 0), IFNULL(i.last_sync_failed, 0), COUNT(m.id)
+    rows, err := db.Query(`SELECT `+instanceColumns+`, COUNT(m.id)
               FROM instances i LEFT JOIN mods m ON m.instance_id = i.id GROUP BY i.id ORDER BY i.id DESC`)
     if err != nil {
         return nil, err
@@ -493,7 +777,7 @@ func ListInstances(db *sql.DB) ([]Instance, error) {
     out := []Instance{}
     for rows.Next() {
         var inst Instance
-        if err := rows.Scan(&inst.ID, &inst.Name, &inst.Loader, &inst.PufferpanelServerID, &inst.RequiresLoader, &inst.GameVersion, &inst.PufferVersionKey, &inst.CreatedAt, &inst.LastSyncAt, &inst.LastSyncAdded, &inst.LastSyncUpdated, &inst.LastSyncFailed, &inst.ModCount); err != nil {
+        if err := scanInstance(rows, &inst); err != nil {
             return nil, err
         }
         out = append(out, inst)
@@ -506,7 +790,7 @@ func ListInstances(db *sql.DB) ([]Instance, error) {
 
 // ListMods returns mods for the provided instance sorted by ID descending.
 func ListMods(db *sql.DB, instanceID int) ([]Mod, error) {
-	rows, err := db.Query(`SELECT id, IFNULL(name, ''), IFNULL(icon_url, ''), url, IFNULL(game_version, ''), IFNULL(loader, ''), IFNULL(channel, ''), IFNULL(current_version, ''), IFNULL(available_version, ''), IFNULL(available_channel, ''), IFNULL(download_url, ''), IFNULL(instance_id, 0) FROM mods WHERE instance_id=? ORDER BY id DESC`, instanceID)
+	rows, err := db.Query(`SELECT `+modColumns+` FROM mods WHERE instance_id=? ORDER BY id DESC`, instanceID)
 	if err != nil {
 		return nil, err
 	}
@@ -514,7 +798,7 @@ func ListMods(db *sql.DB, instanceID int) ([]Mod, error) {
 	mods := []Mod{}
 	for rows.Next() {
 		var m Mod
-		if err := rows.Scan(&m.ID, &m.Name, &m.IconURL, &m.URL, &m.GameVersion, &m.Loader, &m.Channel, &m.CurrentVersion, &m.AvailableVersion, &m.AvailableChannel, &m.DownloadURL, &m.InstanceID); err != nil {
+		if err := scanMod(rows, &m); err != nil {
 			return nil, err
 		}
 		mods = append(mods, m)
@@ -555,7 +839,7 @@ func ListModSyncStates(db *sql.DB, instanceID int) ([]ModSyncState, error) {
 
 // ListAllMods returns all mods across instances sorted by ID descending.
 func ListAllMods(db *sql.DB) ([]Mod, error) {
-	rows, err := db.Query(`SELECT id, IFNULL(name, ''), IFNULL(icon_url, ''), url, IFNULL(game_version, ''), IFNULL(loader, ''), IFNULL(channel, ''), IFNULL(current_version, ''), IFNULL(available_version, ''), IFNULL(available_channel, ''), IFNULL(download_url, ''), IFNULL(instance_id, 0) FROM mods ORDER BY id DESC`)
+	rows, err := db.Query(`SELECT `+modColumns+` FROM mods ORDER BY id DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -563,7 +847,7 @@ func ListAllMods(db *sql.DB) ([]Mod, error) {
 	mods := []Mod{}
 	for rows.Next() {
 		var m Mod
-		if err := rows.Scan(&m.ID, &m.Name, &m.IconURL, &m.URL, &m.GameVersion, &m.Loader, &m.Channel, &m.CurrentVersion, &m.AvailableVersion, &m.AvailableChannel, &m.DownloadURL, &m.InstanceID); err != nil {
+		if err := scanMod(rows, &m); err != nil {
 			return nil, err
 		}
 		mods = append(mods, m)
@@ -577,7 +861,7 @@ func ListAllMods(db *sql.DB) ([]Mod, error) {
 // GetMod returns a mod by ID.
 func GetMod(db *sql.DB, id int) (*Mod, error) {
 	var m Mod
-	err := db.QueryRow(`SELECT id, IFNULL(name, ''), IFNULL(icon_url, ''), url, IFNULL(game_version, ''), IFNULL(loader, ''), IFNULL(channel, ''), IFNULL(current_version, ''), IFNULL(available_version, ''), IFNULL(available_channel, ''), IFNULL(download_url, ''), IFNULL(instance_id, 0) FROM mods WHERE id=?`, id).Scan(&m.ID, &m.Name, &m.IconURL, &m.URL, &m.GameVersion, &m.Loader, &m.Channel, &m.CurrentVersion, &m.AvailableVersion, &m.AvailableChannel, &m.DownloadURL, &m.InstanceID)
+	err := scanMod(db.QueryRow(`SELECT `+modColumns+` FROM mods WHERE id=?`, id), &m)
 	if err != nil {
 		return nil, err
 	}
@@ -590,7 +874,7 @@ func ApplyUpdate(db *sql.DB, id int) (*Mod, error) {
 	if err != nil {
 		return nil, err
 	}
-	if _, err := db.Exec(`UPDATE mods SET current_version=available_version, channel=available_channel WHERE id=?`, id); err != nil {
+	if _, err := db.Exec(`UPDATE mods SET current_version=available_version, channel=available_channel, version_id=NULL WHERE id=?`, id); err != nil {
 		return nil, err
 	}
 	if _, err := db.Exec(`INSERT INTO updates(mod_id, version) VALUES(?, ?)`, id, m.AvailableVersion); err != nil {
@@ -704,6 +988,29 @@ ON CONFLICT(id) DO UPDATE SET name=excluded.name, icon=excluded.icon, types=excl
     return tx.Commit()
 }
 
+// DeferModUpdate marks a queued job to wait for its instance's maintenance
+// window.
+func DeferModUpdate(db *sql.DB, id int) error {
+    _, err := db.Exec(`UPDATE mod_updates SET deferred=1 WHERE id=? AND status='Queued'`, id)
+    return err
+}
+
+// ListDeferredModUpdates returns queued deferred job IDs grouped by the
+// instance of their mod, oldest first.
+func ListDeferredModUpdates(db *sql.DB) (map[int][]int, error) {
+    rows, err := db.Query(`SELECT mu.id, m.instance_id FROM mod_updates mu JOIN mods m ON m.id=mu.mod_id WHERE mu.status='Queued' AND mu.deferred=1 ORDER BY mu.id ASC`)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := map[int][]int{}
+    for rows.Next() {
+        var id, instID int
+        if err := rows.Scan(&id, &instID); err != nil { return nil, err }
+        out[instID] = append(out[instID], id)
+    }
+    if err := rows.Err(); err != nil { return nil, err }
+    return out, nil
+}
+
 // LeaseModUpdate attempts to transition a queued job to running; returns true if lease obtained.
 func LeaseModUpdate(db *sql.DB, id int) (bool, error) {
     res, err := db.Exec(`UPDATE mod_updates SET status='Running', started_at=COALESCE(started_at, CURRENT_TIMESTAMP) WHERE id=? AND status='Queued'`, id)
@@ -712,6 +1019,14 @@ func LeaseModUpdate(db *sql.DB, id int) (bool, error) {
     return n > 0, nil
 }
 
+// Mod update kinds.
+const (
+    ModUpdateKindUpdate   = "update"
+    ModUpdateKindRollback = "rollback"
+    // ModUpdateKindRemove deletes a mod's jar and stops tracking it.
+    ModUpdateKindRemove   = "remove"
+)
+
 // GetModUpdate returns mod_id and status for a mod update row.
 type ModUpdateRow struct {
     ID int
@@ -721,16 +1036,569 @@ type ModUpdateRow struct {
     Status string
     StartedAt string
     EndedAt string
+    Kind string
+    // PreviousFile is the server path of the jar the update replaced.
+    PreviousFile string
+    PreviousDownloadURL string
+    PreviousChannel string
+    // ArtifactPath locates the retained previous jar in the artifact store.
+    ArtifactPath string
+    // PreviousSHA512 keys the previous jar in the artifact cache.
+    PreviousSHA512 string
+    // RollbackOf is the update row a rollback job reverts.
+    RollbackOf int
+    RollbackReady bool
+    BatchID int
+    Error string
+    // Deferred jobs run only inside the instance's maintenance window.
+    Deferred bool
+    // RemovedMod is the JSON of the mod a removal stopped tracking.
+    RemovedMod string
+}
+
+const modUpdateColumns = `id, mod_id, IFNULL(from_version,''), IFNULL(to_version,''), IFNULL(status,''), IFNULL(started_at,''), IFNULL(ended_at,''), IFNULL(kind,'update'), IFNULL(previous_file,''), IFNULL(previous_download_url,''), IFNULL(previous_channel,''), IFNULL(artifact_path,''), IFNULL(rollback_of,0), IFNULL(rollback_ready,0), IFNULL(batch_id,0), IFNULL(error,''), IFNULL(deferred,0), IFNULL(previous_sha512,''), IFNULL(removed_mod,'')`
+
+func scanModUpdate(sc rowScanner, mu *ModUpdateRow) error {
+    return sc.Scan(&mu.ID, &mu.ModID, &mu.FromVersion, &mu.ToVersion, &mu.Status, &mu.StartedAt, &mu.EndedAt, &mu.Kind, &mu.PreviousFile, &mu.PreviousDownloadURL, &mu.PreviousChannel, &mu.ArtifactPath, &mu.RollbackOf, &mu.RollbackReady, &mu.BatchID, &mu.Error, &mu.Deferred, &mu.PreviousSHA512, &mu.RemovedMod)
+}
+
+// UpdateBatch tracks a bulk update of an instance.
+type UpdateBatch struct {
+    ID         int    `json:"id"`
+    InstanceID int    `json:"instance_id"`
+    OnFailure  string `json:"on_failure"`
+    Status     string `json:"status"`
+    Total      int    `json:"total"`
+    Succeeded  int    `json:"succeeded"`
+    Failed     int    `json:"failed"`
+    Skipped    int    `json:"skipped"`
+    CreatedAt  string `json:"created_at"`
+    FinishedAt string `json:"finished_at,omitempty"`
+}
+
+// InsertUpdateBatch creates a running batch of total items.
+func InsertUpdateBatch(db *sql.DB, instanceID int, onFailure string, total int) (int, error) {
+    res, err := db.Exec(`INSERT INTO update_batches(instance_id, on_failure, status, total) VALUES(?,?,?,?)`, instanceID, onFailure, "Running", total)
+    if err != nil { return 0, err }
+    id, err := res.LastInsertId()
+    if err != nil { return 0, err }
+    return int(id), nil
+}
+
+// UpdateBatchProgress stores a batch's counters and status; finished stamps
+// finished_at.
+func UpdateBatchProgress(db *sql.DB, b *UpdateBatch, finished bool) error {
+    q := `UPDATE update_batches SET status=?, succeeded=?, failed=?, skipped=? WHERE id=?`
+    if finished {
+        q = `UPDATE update_batches SET status=?, succeeded=?, failed=?, skipped=?, finished_at=CURRENT_TIMESTAMP WHERE id=?`
+    }
+    _, err := db.Exec(q, b.Status, b.Succeeded, b.Failed, b.Skipped, b.ID)
+    return err
+}
+
+// GetUpdateBatch returns a batch by ID.
+func GetUpdateBatch(db *sql.DB, id int) (*UpdateBatch, error) {
+    var b UpdateBatch
+    err := db.QueryRow(`SELECT id, instance_id, on_failure, status, IFNULL(total,0), IFNULL(succeeded,0), IFNULL(failed,0), IFNULL(skipped,0), IFNULL(created_at,''), IFNULL(finished_at,'') FROM update_batches WHERE id=?`, id).
+        Scan(&b.ID, &b.InstanceID, &b.OnFailure, &b.Status, &b.Total, &b.Succeeded, &b.Failed, &b.Skipped, &b.CreatedAt, &b.FinishedAt)
+    if err != nil { return nil, err }
+    return &b, nil
+}
+
+// UpdatePolicy governs which versions a mod may update to and whether
+// updates apply unattended. Unset fields inherit: a mod's override falls
+// back to its instance's policy, which falls back to the defaults. Pin is
+// only meaningful on mods.
+type UpdatePolicy struct {
+    Pin        string `json:"pin,omitempty"`
+    MinChannel string `json:"min_channel,omitempty"`
+    AllowMajor *bool  `json:"allow_major,omitempty"`
+    AutoApply  *bool  `json:"auto_apply,omitempty"`
+}
+
+// EffectivePolicy is an UpdatePolicy with inheritance resolved.
+type EffectivePolicy struct {
+    Pin        string `json:"pin,omitempty"`
+    MinChannel string `json:"min_channel"`
+    AllowMajor bool   `json:"allow_major"`
+    AutoApply  bool   `json:"auto_apply"`
+}
+
+// ResolvePolicy merges a mod override over its instance policy. Without
+// either, the floor is the mod's tracked channel, major bumps are allowed
+// and updates are applied manually.
+func ResolvePolicy(inst, mod UpdatePolicy, channel string) EffectivePolicy {
+    eff := EffectivePolicy{Pin: mod.Pin, MinChannel: channel, AllowMajor: true}
+    for _, p := range []UpdatePolicy{inst, mod} {
+        if p.MinChannel != "" {
+            eff.MinChannel = p.MinChannel
+        }
+        if p.AllowMajor != nil {
+            eff.AllowMajor = *p.AllowMajor
+        }
+        if p.AutoApply != nil {
+            eff.AutoApply = *p.AutoApply
+        }
+    }
+    return eff
+}
+
+func nullBoolPtr(b sql.NullBool) *bool {
+    if !b.Valid { return nil }
+    v := b.Bool
+    return &v
+}
+
+func boolPtrArg(b *bool) any {
+    if b == nil { return nil }
+    return boolToInt(*b)
+}
+
+// GetInstancePolicy returns an instance's policy; instances without one get
+// an empty policy.
+func GetInstancePolicy(db *sql.DB, instanceID int) (*UpdatePolicy, error) {
+    var p UpdatePolicy
+    var allowMajor, autoApply sql.NullBool
+    err := db.QueryRow(`SELECT IFNULL(min_channel,''), allow_major, auto_apply FROM instance_policies WHERE instance_id=?`, instanceID).
+        Scan(&p.MinChannel, &allowMajor, &autoApply)
+    if err == sql.ErrNoRows { return &p, nil }
+    if err != nil { return nil, err }
+    p.AllowMajor, p.AutoApply = nullBoolPtr(allowMajor), nullBoolPtr(autoApply)
+    return &p, nil
+}
+
+// SetInstancePolicy stores an instance's policy, replacing any previous one.
+func SetInstancePolicy(db *sql.DB, instanceID int, p *UpdatePolicy) error {
+    _, err := db.Exec(`INSERT INTO instance_policies(instance_id, min_channel, allow_major, auto_apply, updated_at) VALUES(?,NULLIF(?,''),?,?,CURRENT_TIMESTAMP)
+        ON CONFLICT(instance_id) DO UPDATE SET min_channel=excluded.min_channel, allow_major=excluded.allow_major, auto_apply=excluded.auto_apply, updated_at=CURRENT_TIMESTAMP`,
+        instanceID, p.MinChannel, boolPtrArg(p.AllowMajor), boolPtrArg(p.AutoApply))
+    return err
+}
+
+// GetModPolicy returns a mod's policy override; mods without one get an
+// empty policy.
+func GetModPolicy(db *sql.DB, modID int) (*UpdatePolicy, error) {
+    var p UpdatePolicy
+    var allowMajor, autoApply sql.NullBool
+    err := db.QueryRow(`SELECT IFNULL(pin,''), IFNULL(min_channel,''), allow_major, auto_apply FROM mod_policies WHERE mod_id=?`, modID).
+        Scan(&p.Pin, &p.MinChannel, &allowMajor, &autoApply)
+    if err == sql.ErrNoRows { return &p, nil }
+    if err != nil { return nil, err }
+    p.AllowMajor, p.AutoApply = nullBoolPtr(allowMajor), nullBoolPtr(autoApply)
+    return &p, nil
+}
+
+// SetModPolicy stores a mod's policy override, replacing any previous one.
+func SetModPolicy(db *sql.DB, modID int, p *UpdatePolicy) error {
+    _, err := db.Exec(`INSERT INTO mod_policies(mod_id, pin, min_channel, allow_major, auto_apply, updated_at) VALUES(?,NULLIF(?,''),NULLIF(?,''),?,?,CURRENT_TIMESTAMP)
+        ON CONFLICT(mod_id) DO UPDATE SET pin=excluded.pin, min_channel=excluded.min_channel, allow_major=excluded.allow_major, auto_apply=excluded.auto_apply, updated_at=CURRENT_TIMESTAMP`,
+        modID, p.Pin, p.MinChannel, boolPtrArg(p.AllowMajor), boolPtrArg(p.AutoApply))
+    return err
+}
+
+// DeleteModPolicy removes a mod's override so it inherits its instance policy.
+func DeleteModPolicy(db *sql.DB, modID int) error {
+    _, err := db.Exec(`DELETE FROM mod_policies WHERE mod_id=?`, modID)
+    return err
+}
+
+// GetEffectivePolicy resolves the policy that applies to m.
+func GetEffectivePolicy(db *sql.DB, m *Mod) (EffectivePolicy, error) {
+    ip, err := GetInstancePolicy(db, m.InstanceID)
+    if err != nil { return EffectivePolicy{}, err }
+    mp, err := GetModPolicy(db, m.ID)
+    if err != nil { return EffectivePolicy{}, err }
+    return ResolvePolicy(*ip, *mp, m.Channel), nil
+}
+
+// MaintenanceWindow is when deferred updates of an instance may run: each
+// match of the cron Schedule in Timezone opens the window for
+// DurationMinutes. RestartServer stops the server before applying and starts
+// it afterwards.
+type MaintenanceWindow struct {
+    InstanceID      int    `json:"instance_id"`
+    Schedule        string `json:"schedule"`
+    DurationMinutes int    `json:"duration_minutes"`
+    Timezone        string `json:"timezone"`
+    RestartServer   bool   `json:"restart_server"`
+    UpdatedAt       string `json:"updated_at,omitempty"`
+}
+
+// GetMaintenanceWindow returns an instance's window, or sql.ErrNoRows when
+// it has none.
+func GetMaintenanceWindow(db *sql.DB, instanceID int) (*MaintenanceWindow, error) {
+    var w MaintenanceWindow
+    err := db.QueryRow(`SELECT instance_id, schedule, duration_minutes, timezone, restart_server, IFNULL(updated_at,'') FROM maintenance_windows WHERE instance_id=?`, instanceID).
+        Scan(&w.InstanceID, &w.Schedule, &w.DurationMinutes, &w.Timezone, &w.RestartServer, &w.UpdatedAt)
+    if err != nil { return nil, err }
+    return &w, nil
+}
+
+// SetMaintenanceWindow stores an instance's window, replacing any previous one.
+func SetMaintenanceWindow(db *sql.DB, w *MaintenanceWindow) error {
+    _, err := db.Exec(`INSERT INTO maintenance_windows(instance_id, schedule, duration_minutes, timezone, restart_server, updated_at) VALUES(?,?,?,?,?,CURRENT_TIMESTAMP)
+        ON CONFLICT(instance_id) DO UPDATE SET schedule=excluded.schedule, duration_minutes=excluded.duration_minutes, timezone=excluded.timezone, restart_server=excluded.restart_server, updated_at=CURRENT_TIMESTAMP`,
+        w.InstanceID, w.Schedule, w.DurationMinutes, w.Timezone, boolToInt(w.RestartServer))
+    return err
+}
+
+// DeleteMaintenanceWindow removes an instance's window; its deferred updates
+// then run as soon as the queue picks them up.
+func DeleteMaintenanceWindow(db *sql.DB, instanceID int) error {
+    _, err := db.Exec(`DELETE FROM maintenance_windows WHERE instance_id=?`, instanceID)
+    return err
+}
+
+// DriftCheck schedules comparing an instance's server folder with its
+// tracked mods every IntervalMinutes. AutoReconcile queues a sync when drift
+// is found. Report holds the latest report as JSON.
+type DriftCheck struct {
+    InstanceID      int    `json:"instance_id"`
+    IntervalMinutes int    `json:"interval_minutes"`
+    AutoReconcile   bool   `json:"auto_reconcile"`
+    LastCheckedAt   string `json:"last_checked_at,omitempty"`
+    Report          string `json:"-"`
+    UpdatedAt       string `json:"updated_at,omitempty"`
+}
+
+const driftCheckColumns = `instance_id, interval_minutes, auto_reconcile, IFNULL(last_checked_at,''), IFNULL(last_report,''), IFNULL(updated_at,'')`
+
+func scanDriftCheck(sc rowScanner, c *DriftCheck) error {
+    return sc.Scan(&c.InstanceID, &c.IntervalMinutes, &c.AutoReconcile, &c.LastCheckedAt, &c.Report, &c.UpdatedAt)
+}
+
+// GetDriftCheck returns an instance's drift check, or sql.ErrNoRows when it
+// has none.
+func GetDriftCheck(db *sql.DB, instanceID int) (*DriftCheck, error) {
+    var c DriftCheck
+    if err := scanDriftCheck(db.QueryRow(`SELECT `+driftCheckColumns+` FROM drift_checks WHERE instance_id=?`, instanceID), &c); err != nil {
+        return nil, err
+    }
+    return &c, nil
+}
+
+// ListDriftChecks returns all scheduled drift checks.
+func ListDriftChecks(db *sql.DB) ([]DriftCheck, error) {
+    rows, err := db.Query(`SELECT ` + driftCheckColumns + ` FROM drift_checks ORDER BY instance_id`)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []DriftCheck
+    for rows.Next() {
+        var c DriftCheck
+        if err := scanDriftCheck(rows, &c); err != nil { return nil, err }
+        out = append(out, c)
+    }
+    return out, rows.Err()
+}
+
+// SetDriftCheck stores an instance's drift check schedule, keeping its last
+// report.
+func SetDriftCheck(db *sql.DB, c *DriftCheck) error {
+    _, err := db.Exec(`INSERT INTO drift_checks(instance_id, interval_minutes, auto_reconcile, updated_at) VALUES(?,?,?,CURRENT_TIMESTAMP)
+        ON CONFLICT(instance_id) DO UPDATE SET interval_minutes=excluded.interval_minutes, auto_reconcile=excluded.auto_reconcile, updated_at=CURRENT_TIMESTAMP`,
+        c.InstanceID, c.IntervalMinutes, boolToInt(c.AutoReconcile))
+    return err
+}
+
+// RecordDriftReport stores the report of a drift check run at checkedAt.
+// Instances without a schedule keep only their latest report.
+func RecordDriftReport(db *sql.DB, instanceID int, checkedAt, report string) error {
+    _, err := db.Exec(`INSERT INTO drift_checks(instance_id, interval_minutes, last_checked_at, last_report) VALUES(?,0,?,?)
+        ON CONFLICT(instance_id) DO UPDATE SET last_checked_at=excluded.last_checked_at, last_report=excluded.last_report`,
+        instanceID, checkedAt, report)
+    return err
+}
+
+// DeleteDriftCheck removes an instance's drift check and its report.
+func DeleteDriftCheck(db *sql.DB, instanceID int) error {
+    _, err := db.Exec(`DELETE FROM drift_checks WHERE instance_id=?`, instanceID)
+    return err
+}
+
+// SetModContentHash records the SHA-512 of a mod's installed jar.
+func SetModContentHash(db *sql.DB, id int, sha512 string) error {
+    _, err := db.Exec(`UPDATE mods SET content_sha512=? WHERE id=?`, sha512, id)
+    return err
+}
+
+// SetModSides caches the client and server side support of a mod's project.
+func SetModSides(db *sql.DB, id int, client, server string) error {
+    _, err := db.Exec(`UPDATE mods SET client_side=?, server_side=? WHERE id=?`, client, server, id)
+    return err
+}
+
+// SetModVersionRef records the source's project and version IDs of a mod's
+// installed version.
+func SetModVersionRef(db *sql.DB, id int, projectID, versionID string) error {
+    _, err := db.Exec(`UPDATE mods SET project_id=?, version_id=? WHERE id=?`, projectID, versionID, id)
+    return err
+}
+
+// GetModContentHash returns the SHA-512 of a mod's installed jar, or "" when
+// it is not known.
+func GetModContentHash(db *sql.DB, id int) (string, error) {
+    var sum string
+    err := db.QueryRow(`SELECT IFNULL(content_sha512,'') FROM mods WHERE id=?`, id).Scan(&sum)
+    return sum, err
+}
+
+// ListReferencedBlobs returns the SHA-512 of every jar still needed: those
+// installed for tracked mods and those an update can be rolled back to.
+func ListReferencedBlobs(db *sql.DB) (map[string]bool, error) {
+    rows, err := db.Query(`SELECT content_sha512 FROM mods WHERE IFNULL(content_sha512,'')<>''
+        UNION SELECT previous_sha512 FROM mod_updates WHERE rollback_ready=1 AND IFNULL(previous_sha512,'')<>''`)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := map[string]bool{}
+    for rows.Next() {
+        var sum string
+        if err := rows.Scan(&sum); err != nil { return nil, err }
+        out[sum] = true
+    }
+    return out, rows.Err()
+}
+
+// ScanFinding is a rule match recorded for a scanned jar.
+type ScanFinding struct {
+    Rule     string `json:"rule"`
+    Severity string `json:"severity"`
+    Entry    string `json:"entry,omitempty"`
+    Detail   string `json:"detail"`
+}
+
+// JarScan is the latest scan of a jar on an instance. ModID is nil for jars
+// that did not match a tracked mod.
+type JarScan struct {
+    ID         int           `json:"id"`
+    InstanceID int           `json:"instance_id"`
+    ModID      *int          `json:"mod_id,omitempty"`
+    File       string        `json:"file"`
+    SHA256     string        `json:"sha256"`
+    ScannedAt  string        `json:"scanned_at"`
+    Findings   []ScanFinding `json:"findings"`
+}
+
+// RecordJarScan stores a scan, replacing earlier scans of the same file and,
+// for tracked mods, of the mod's previous jar.
+func RecordJarScan(db *sql.DB, s *JarScan) error {
+    tx, err := db.Begin()
+    if err != nil { return err }
+    defer tx.Rollback()
+    var modID any
+    cond, args := `instance_id=? AND file=?`, []any{s.InstanceID, s.File}
+    if s.ModID != nil {
+        modID = *s.ModID
+        cond, args = `instance_id=? AND (file=? OR mod_id=?)`, append(args, *s.ModID)
+    }
+    if _, err := tx.Exec(`DELETE FROM scan_findings WHERE scan_id IN (SELECT id FROM jar_scans WHERE `+cond+`)`, args...); err != nil {
+        return err
+    }
+    if _, err := tx.Exec(`DELETE FROM jar_scans WHERE `+cond, args...); err != nil {
+        return err
+    }
+    res, err := tx.Exec(`INSERT INTO jar_scans(instance_id, mod_id, file, sha256) VALUES(?,?,?,?)`, s.InstanceID, modID, s.File, s.SHA256)
+    if err != nil { return err }
+    id, err := res.LastInsertId()
+    if err != nil { return err }
+    for _, f := range s.Findings {
+        if _, err := tx.Exec(`INSERT INTO scan_findings(scan_id, rule, severity, entry, detail) VALUES(?,?,?,?,?)`, id, f.Rule, f.Severity, f.Entry, f.Detail); err != nil {
+            return err
+        }
+    }
+    if err := tx.Commit(); err != nil { return err }
+    s.ID = int(id)
+    return nil
+}
+
+// ListInstanceScans returns the scans of an instance's jars by file name,
+// each with its findings.
+func ListInstanceScans(db *sql.DB, instanceID int) ([]JarScan, error) {
+    rows, err := db.Query(`SELECT id, instance_id, mod_id, file, sha256, IFNULL(scanned_at,'') FROM jar_scans WHERE instance_id=? ORDER BY file`, instanceID)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []JarScan{}
+    byID := map[int]int{}
+    for rows.Next() {
+        var s JarScan
+        var modID sql.NullInt64
+        if err := rows.Scan(&s.ID, &s.InstanceID, &modID, &s.File, &s.SHA256, &s.ScannedAt); err != nil {
+            return nil, err
+        }
+        if modID.Valid {
+            id := int(modID.Int64)
+            s.ModID = &id
+        }
+        s.Findings = []ScanFinding{}
+        byID[s.ID] = len(out)
+        out = append(out, s)
+    }
+    if err := rows.Err(); err != nil { return nil, err }
+    frows, err := db.Query(`SELECT f.scan_id, f.rule, f.severity, IFNULL(f.entry,''), IFNULL(f.detail,'') FROM scan_findings f JOIN jar_scans s ON s.id=f.scan_id WHERE s.instance_id=? ORDER BY f.id`, instanceID)
+    if err != nil { return nil, err }
+    defer frows.Close()
+    for frows.Next() {
+        var scanID int
+        var f ScanFinding
+        if err := frows.Scan(&scanID, &f.Rule, &f.Severity, &f.Entry, &f.Detail); err != nil {
+            return nil, err
+        }
+        if i, ok := byID[scanID]; ok {
+            out[i].Findings = append(out[i].Findings, f)
+        }
+    }
+    return out, frows.Err()
+}
+
+// PruneJarScans drops scans of an instance's jars that are no longer among
+// files.
+func PruneJarScans(db *sql.DB, instanceID int, files []string) error {
+    cond, args := `instance_id=?`, []any{instanceID}
+    if len(files) > 0 {
+        cond += ` AND file NOT IN (?` + strings.Repeat(`,?`, len(files)-1) + `)`
+        for _, f := range files {
+            args = append(args, f)
+        }
+    }
+    return deleteJarScans(db, cond, args...)
+}
+
+func deleteJarScans(db *sql.DB, cond string, args ...any) error {
+    if _, err := db.Exec(`DELETE FROM scan_findings WHERE scan_id IN (SELECT id FROM jar_scans WHERE `+cond+`)`, args...); err != nil {
+        return err
+    }
+    _, err := db.Exec(`DELETE FROM jar_scans WHERE `+cond, args...)
+    return err
+}
+
+// SetModUpdateBatch assigns a mod update row to a batch.
+func SetModUpdateBatch(db *sql.DB, id, batchID int) error {
+    _, err := db.Exec(`UPDATE mod_updates SET batch_id=? WHERE id=?`, batchID, id)
+    return err
+}
+
+// ListBatchModUpdates returns the mod updates run by a batch in order.
+func ListBatchModUpdates(db *sql.DB, batchID int) ([]ModUpdateRow, error) {
+    rows, err := db.Query(`SELECT `+modUpdateColumns+` FROM mod_updates WHERE batch_id=? ORDER BY id ASC`, batchID)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []ModUpdateRow{}
+    for rows.Next() {
+        var mu ModUpdateRow
+        if err := scanModUpdate(rows, &mu); err != nil { return nil, err }
+        out = append(out, mu)
+    }
+    return out, rows.Err()
 }
 
 func GetModUpdate(db *sql.DB, id int) (*ModUpdateRow, error) {
     var mu ModUpdateRow
-    err := db.QueryRow(`SELECT id, mod_id, IFNULL(from_version,''), IFNULL(to_version,''), IFNULL(status,''), IFNULL(started_at,''), IFNULL(ended_at,'') FROM mod_updates WHERE id=?`, id).
-        Scan(&mu.ID, &mu.ModID, &mu.FromVersion, &mu.ToVersion, &mu.Status, &mu.StartedAt, &mu.EndedAt)
+    err := scanModUpdate(db.QueryRow(`SELECT `+modUpdateColumns+` FROM mod_updates WHERE id=?`, id), &mu)
+    if err != nil { return nil, err }
+    return &mu, nil
+}
+
+// SetModUpdateRollback records what a finished update replaced and marks it
+// as the mod's rollback point. artifactPath may be empty when no jar was kept.
+func SetModUpdateRollback(db *sql.DB, id int, prevFile, prevURL, prevChannel, artifactPath, prevSHA512 string) error {
+    _, err := db.Exec(`UPDATE mod_updates SET previous_file=?, previous_download_url=?, previous_channel=?, artifact_path=?, previous_sha512=?, rollback_ready=1 WHERE id=?`, prevFile, prevURL, prevChannel, artifactPath, prevSHA512, id)
+    return err
+}
+
+// LatestRollbackPoint returns the newest succeeded update of a mod that has
+// not been rolled back, or sql.ErrNoRows.
+func LatestRollbackPoint(db *sql.DB, modID int) (*ModUpdateRow, error) {
+    var mu ModUpdateRow
+    err := scanModUpdate(db.QueryRow(`SELECT `+modUpdateColumns+` FROM mod_updates WHERE mod_id=? AND IFNULL(kind,'update')='update' AND status='Succeeded' AND rollback_ready=1 ORDER BY id DESC LIMIT 1`, modID), &mu)
+    if err != nil { return nil, err }
+    return &mu, nil
+}
+
+// SetModUpdateRemovedMod stores the snapshot of the mod removal id stopped
+// tracking.
+func SetModUpdateRemovedMod(db *sql.DB, id int, snapshot string) error {
+    _, err := db.Exec(`UPDATE mod_updates SET removed_mod=? WHERE id=?`, snapshot, id)
+    return err
+}
+
+// LatestRemovalPoint returns the succeeded removal of a mod that can still be
+// reverted.
+func LatestRemovalPoint(db *sql.DB, modID int) (*ModUpdateRow, error) {
+    var mu ModUpdateRow
+    err := scanModUpdate(db.QueryRow(`SELECT `+modUpdateColumns+` FROM mod_updates WHERE mod_id=? AND kind=? AND status='Succeeded' AND rollback_ready=1 AND IFNULL(removed_mod,'')<>'' ORDER BY id DESC LIMIT 1`, modID, ModUpdateKindRemove), &mu)
     if err != nil { return nil, err }
     return &mu, nil
 }
 
+// ConsumeRollbackPoint clears a rollback point once it has been reverted.
+func ConsumeRollbackPoint(db *sql.DB, id int) error {
+    _, err := db.Exec(`UPDATE mod_updates SET rollback_ready=0, artifact_path='' WHERE id=?`, id)
+    return err
+}
+
+// ListRetainedArtifacts returns updates of a mod that still hold a retained
+// jar, newest first.
+func ListRetainedArtifacts(db *sql.DB, modID int) ([]ModUpdateRow, error) {
+    rows, err := db.Query(`SELECT `+modUpdateColumns+` FROM mod_updates WHERE mod_id=? AND IFNULL(artifact_path,'')<>'' ORDER BY id DESC`, modID)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []ModUpdateRow{}
+    for rows.Next() {
+        var mu ModUpdateRow
+        if err := scanModUpdate(rows, &mu); err != nil { return nil, err }
+        out = append(out, mu)
+    }
+    return out, rows.Err()
+}
+
+// ClearModUpdateArtifact forgets the retained jar of an update row.
+func ClearModUpdateArtifact(db *sql.DB, id int) error {
+    _, err := db.Exec(`UPDATE mod_updates SET artifact_path='' WHERE id=?`, id)
+    return err
+}
+
+// InsertModRollbackQueued queues a rollback of update row rollbackOf. A
+// rollback that previously failed is requeued instead of duplicated.
+func InsertModRollbackQueued(db *sql.DB, modID, rollbackOf int, fromVersion, toVersion string) (int, error) {
+    key := fmt.Sprintf("rollback:%d", rollbackOf)
+    var id int
+    var status string
+    err := db.QueryRow(`SELECT id, IFNULL(status,'') FROM mod_updates WHERE idempotency_key=?`, key).Scan(&id, &status)
+    switch {
+    case err == nil:
+        if status == "Failed" || status == "PartialSuccess" {
+            if _, err := db.Exec(`UPDATE mod_updates SET status='Queued', error=NULL, started_at=NULL, ended_at=NULL WHERE id=?`, id); err != nil {
+                return 0, err
+            }
+        }
+        return id, nil
+    case err != sql.ErrNoRows:
+        return 0, err
+    }
+    res, err := db.Exec(`INSERT INTO mod_updates(mod_id, from_version, to_version, status, idempotency_key, kind, rollback_of) VALUES(?,?,?,?,?,?,?)`, modID, fromVersion, toVersion, "Queued", key, ModUpdateKindRollback, rollbackOf)
+    if err != nil { return 0, err }
+    lid, err := res.LastInsertId()
+    if err != nil { return 0, err }
+    return int(lid), nil
+}
+
+// InsertModRemoveQueued queues removal of a mod, returning the existing job
+// when key was used before.
+func InsertModRemoveQueued(db *sql.DB, modID int, fromVersion, key string) (int, error) {
+    var id int
+    err := db.QueryRow(`SELECT id FROM mod_updates WHERE idempotency_key=?`, key).Scan(&id)
+    switch {
+    case err == nil:
+        return id, nil
+    case err != sql.ErrNoRows:
+        return 0, err
+    }
+    res, err := db.Exec(`INSERT INTO mod_updates(mod_id, from_version, to_version, status, idempotency_key, kind) VALUES(?,?,?,?,?,?)`, modID, fromVersion, "", "Queued", key, ModUpdateKindRemove)
+    if err != nil { return 0, err }
+    lid, err := res.LastInsertId()
+    if err != nil { return 0, err }
+    return int(lid), nil
+}
+
 // InsertEvent stores a mod activity log entry.
 func InsertEvent(db *sql.DB, ev *ModEvent) error {
     var modID any
@@ -821,13 +1689,13 @@ func GetDashboardStats(db *sql.DB) (*DashboardStats, error) {
 		return nil, err
 	}
 
-	rows, err := db.Query(`SELECT id, IFNULL(name, ''), IFNULL(icon_url, ''), url, IFNULL(game_version, ''), IFNULL(loader, ''), IFNULL(channel, ''), IFNULL(current_version, ''), IFNULL(available_version, ''), IFNULL(available_channel, ''), IFNULL(download_url, ''), IFNULL(instance_id, 0) FROM mods WHERE IFNULL(current_version, '') <> IFNULL(available_version, '') ORDER BY id DESC LIMIT 5`)
+	rows, err := db.Query(`SELECT `+modColumns+` FROM mods WHERE IFNULL(current_version, '') <> IFNULL(available_version, '') ORDER BY id DESC LIMIT 5`)
 	if err != nil {
 		return nil, err
 	}
 	for rows.Next() {
 		var m Mod
-		if err := rows.Scan(&m.ID, &m.Name, &m.IconURL, &m.URL, &m.GameVersion, &m.Loader, &m.Channel, &m.CurrentVersion, &m.AvailableVersion, &m.AvailableChannel, &m.DownloadURL, &m.InstanceID); err != nil {
+		if err := scanMod(rows, &m); err != nil {
 			rows.Close()
 			return nil, err
 		}
@@ -942,3 +1810,188 @@ func RequeueSyncJob(db *sql.DB, id int) error {
 	_, err := db.Exec(`UPDATE sync_jobs SET status='queued', error='', started_at=NULL, finished_at=NULL WHERE id=?`, id)
 	return err
 }
+
+// UpdateCheckRun records one pass of the scheduled update check. Batched
+// mods were resolved by the bulk hash lookup, Fallback mods by per-project
+// version listings; Requests counts Modrinth HTTP requests sent.
+type UpdateCheckRun struct {
+    ID         int       `json:"id"`
+    StartedAt  time.Time `json:"started_at"`
+    FinishedAt time.Time `json:"finished_at"`
+    Mods       int       `json:"mods"`
+    Batched    int       `json:"batched"`
+    Fallback   int       `json:"fallback"`
+    Requests   int64     `json:"requests"`
+}
+
+// InsertUpdateCheckRun stores a finished update check.
+func InsertUpdateCheckRun(db *sql.DB, r *UpdateCheckRun) error {
+    res, err := db.Exec(`INSERT INTO update_check_runs(started_at, finished_at, mods, batched, fallback, requests) VALUES(?,?,?,?,?,?)`,
+        r.StartedAt.UTC(), r.FinishedAt.UTC(), r.Mods, r.Batched, r.Fallback, r.Requests)
+    if err != nil { return err }
+    id, err := res.LastInsertId()
+    if err != nil { return err }
+    r.ID = int(id)
+    return nil
+}
+
+// LastUpdateCheckRun returns the most recent update check, or nil when none
+// has run.
+func LastUpdateCheckRun(db *sql.DB) (*UpdateCheckRun, error) {
+    var r UpdateCheckRun
+    err := db.QueryRow(`SELECT id, started_at, finished_at, mods, batched, fallback, requests FROM update_check_runs ORDER BY id DESC LIMIT 1`).
+        Scan(&r.ID, &r.StartedAt, &r.FinishedAt, &r.Mods, &r.Batched, &r.Fallback, &r.Requests)
+    if err == sql.ErrNoRows { return nil, nil }
+    if err != nil { return nil, err }
+    return &r, nil
+}
+
+// ListModContentHashes returns the SHA-512 of each mod's installed jar keyed
+// by mod ID. Mods without a known hash are omitted.
+func ListModContentHashes(db *sql.DB) (map[int]string, error) {
+    rows, err := db.Query(`SELECT id, content_sha512 FROM mods WHERE IFNULL(content_sha512,'')<>''`)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := map[int]string{}
+    for rows.Next() {
+        var id int
+        var sum string
+        if err := rows.Scan(&id, &sum); err != nil { return nil, err }
+        out[id] = sum
+    }
+    return out, rows.Err()
+}
+
+// PolicyChangesSince returns the instances and mods whose update policy was
+// set at or after t.
+func PolicyChangesSince(db *sql.DB, t time.Time) (instances, mods map[int]bool, err error) {
+    ts := t.UTC().Format("2006-01-02 15:04:05")
+    instances, mods = map[int]bool{}, map[int]bool{}
+    for _, q := range []struct {
+        query string
+        out   map[int]bool
+    }{
+        {`SELECT instance_id FROM instance_policies WHERE updated_at >= ?`, instances},
+        {`SELECT mod_id FROM mod_policies WHERE updated_at >= ?`, mods},
+    } {
+        rows, err := db.Query(q.query, ts)
+        if err != nil { return nil, nil, err }
+        for rows.Next() {
+            var id int
+            if err := rows.Scan(&id); err != nil {
+                rows.Close()
+                return nil, nil, err
+            }
+            q.out[id] = true
+        }
+        if err := rows.Err(); err != nil {
+            rows.Close()
+            return nil, nil, err
+        }
+        rows.Close()
+    }
+    return instances, mods, nil
+}
+
+// ModrinthCacheEntry is a persisted Modrinth response. Body is omitted from
+// JSON listings.
+type ModrinthCacheEntry struct {
+    Key       string    `json:"key"`
+    Endpoint  string    `json:"endpoint"`
+    Body      []byte    `json:"-"`
+    Size      int       `json:"size"`
+    ETag      string    `json:"etag"`
+    FetchedAt time.Time `json:"fetched_at"`
+    ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ModrinthCacheStats summarises the persisted responses of one endpoint.
+type ModrinthCacheStats struct {
+    Endpoint string `json:"endpoint"`
+    Entries  int    `json:"entries"`
+    Expired  int    `json:"expired"`
+    Bytes    int64  `json:"bytes"`
+}
+
+// GetModrinthCacheEntry returns the persisted response for key, or nil.
+func GetModrinthCacheEntry(db *sql.DB, key string) (*ModrinthCacheEntry, error) {
+    var e ModrinthCacheEntry
+    err := db.QueryRow(`SELECT key, endpoint, body, etag, fetched_at, expires_at FROM modrinth_cache WHERE key=?`, key).
+        Scan(&e.Key, &e.Endpoint, &e.Body, &e.ETag, &e.FetchedAt, &e.ExpiresAt)
+    if err == sql.ErrNoRows { return nil, nil }
+    if err != nil { return nil, err }
+    e.Size = len(e.Body)
+    return &e, nil
+}
+
+// PutModrinthCacheEntry stores or replaces a persisted response.
+func PutModrinthCacheEntry(db *sql.DB, e *ModrinthCacheEntry) error {
+    _, err := db.Exec(`INSERT INTO modrinth_cache(key, endpoint, body, etag, fetched_at, expires_at) VALUES(?,?,?,?,?,?)
+        ON CONFLICT(key) DO UPDATE SET endpoint=excluded.endpoint, body=excluded.body, etag=excluded.etag, fetched_at=excluded.fetched_at, expires_at=excluded.expires_at`,
+        e.Key, e.Endpoint, e.Body, e.ETag, e.FetchedAt.UTC(), e.ExpiresAt.UTC())
+    return err
+}
+
+// ModrinthCacheStatsByEndpoint summarises persisted responses per endpoint.
+func ModrinthCacheStatsByEndpoint(db *sql.DB, now time.Time) ([]ModrinthCacheStats, error) {
+    rows, err := db.Query(`SELECT endpoint, COUNT(*), SUM(CASE WHEN expires_at <= ? THEN 1 ELSE 0 END), IFNULL(SUM(LENGTH(body)),0)
+        FROM modrinth_cache GROUP BY endpoint ORDER BY endpoint`, now.UTC())
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []ModrinthCacheStats
+    for rows.Next() {
+        var st ModrinthCacheStats
+        if err := rows.Scan(&st.Endpoint, &st.Entries, &st.Expired, &st.Bytes); err != nil { return nil, err }
+        out = append(out, st)
+    }
+    return out, rows.Err()
+}
+
+// ListModrinthCacheEntries returns persisted responses, newest first,
+// optionally limited to one endpoint. Bodies are not loaded.
+func ListModrinthCacheEntries(db *sql.DB, endpoint string, limit int) ([]ModrinthCacheEntry, error) {
+    rows, err := db.Query(`SELECT key, endpoint, LENGTH(body), etag, fetched_at, expires_at FROM modrinth_cache
+        WHERE ?='' OR endpoint=? ORDER BY fetched_at DESC LIMIT ?`, endpoint, endpoint, limit)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []ModrinthCacheEntry
+    for rows.Next() {
+        var e ModrinthCacheEntry
+        if err := rows.Scan(&e.Key, &e.Endpoint, &e.Size, &e.ETag, &e.FetchedAt, &e.ExpiresAt); err != nil { return nil, err }
+        out = append(out, e)
+    }
+    return out, rows.Err()
+}
+
+// PurgeModrinthCache deletes persisted responses matching key, or endpoint
+// when key is empty, or all of them when both are empty. It returns the
+// number of entries removed.
+func PurgeModrinthCache(db *sql.DB, endpoint, key string) (int64, error) {
+    var res sql.Result
+    var err error
+    switch {
+    case key != "":
+        res, err = db.Exec(`DELETE FROM modrinth_cache WHERE key=?`, key)
+    case endpoint != "":
+        res, err = db.Exec(`DELETE FROM modrinth_cache WHERE endpoint=?`, endpoint)
+    default:
+        res, err = db.Exec(`DELETE FROM modrinth_cache`)
+    }
+    if err != nil { return 0, err }
+    return res.RowsAffected()
+}
+
+// SetPackwizSource records the pack.toml URL an instance follows.
+func SetPackwizSource(db *sql.DB, instanceID int, url string) error {
+    _, err := db.Exec(`INSERT INTO packwiz_sources(instance_id, url, updated_at) VALUES(?,?,CURRENT_TIMESTAMP)
+        ON CONFLICT(instance_id) DO UPDATE SET url=excluded.url, updated_at=excluded.updated_at`, instanceID, url)
+    return err
+}
+
+// GetPackwizSource returns the pack.toml URL an instance follows, or "".
+func GetPackwizSource(db *sql.DB, instanceID int) (string, error) {
+    var url string
+    err := db.QueryRow(`SELECT url FROM packwiz_sources WHERE instance_id=?`, instanceID).Scan(&url)
+    if err == sql.ErrNoRows { return "", nil }
+    return url, err
+}
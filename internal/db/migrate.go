@@ -11,6 +11,14 @@ import (
 //go:embed migrations/*.sql
 var migrationFiles embed.FS
 
+// supersededMigrations were folded into the schema Init creates. Running
+// them against that schema would rebuild instances without the columns
+// added since, so they are recorded as applied without being executed.
+var supersededMigrations = map[string]bool{
+	"002_instance_name_required.up.sql":   true,
+	"003_drop_enforce_same_loader.up.sql": true,
+}
+
 // Migrate runs SQL migrations found in the migrations directory.
 func Migrate(db *sql.DB) error {
 	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (id TEXT PRIMARY KEY)`); err != nil {
@@ -33,12 +41,14 @@ func Migrate(db *sql.DB) error {
 		if exists > 0 {
 			continue
 		}
-		b, err := migrationFiles.ReadFile("migrations/" + name)
-		if err != nil {
-			return err
-		}
-		if _, err := db.Exec(string(b)); err != nil {
-			return fmt.Errorf("apply %s: %w", name, err)
+		if !supersededMigrations[name] {
+			b, err := migrationFiles.ReadFile("migrations/" + name)
+			if err != nil {
+				return err
+			}
+			if _, err := db.Exec(string(b)); err != nil {
+				return fmt.Errorf("apply %s: %w", name, err)
+			}
 		}
 		if _, err := db.Exec(`INSERT INTO schema_migrations(id) VALUES(?)`, name); err != nil {
 			return err
@@ -77,3 +77,28 @@ func TestInitCreatesSecretsTable(t *testing.T) {
 		}
 	}
 }
+
+func TestMigrateSkipsSupersededMigrations(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:memdb3?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	if err := Init(db); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for name := range supersededMigrations {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(1) FROM schema_migrations WHERE id=?`, name).Scan(&n); err != nil || n != 1 {
+			t.Fatalf("%s recorded %d times: %v", name, n, err)
+		}
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(1) FROM pragma_table_info('instances') WHERE name='backend'`).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("instances lost the backend column: %d, %v", n, err)
+	}
+}
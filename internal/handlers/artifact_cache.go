@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"crypto/sha1"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+
+	"github.com/rs/zerolog/log"
+
+	"modsentinel/internal/artifacts"
+	dbpkg "modsentinel/internal/db"
+	mr "modsentinel/internal/modrinth"
+)
+
+// blobCache shares downloaded and synced jars across instances by content;
+// nil disables caching.
+var blobCache *artifacts.Cache
+
+// SetBlobCache configures the content-addressed jar cache.
+func SetBlobCache(c *artifacts.Cache) {
+	blobCache = c
+}
+
+// cacheLookupOrder prefers the cache key itself, then published aliases.
+var cacheLookupOrder = []string{"sha512", "sha256", "sha1"}
+
+// cachedArtifact returns the jar f describes when the cache holds one of its
+// published hashes and the cached data still matches them.
+func cachedArtifact(f mr.VersionFile) ([]byte, bool) {
+	if blobCache == nil {
+		return nil, false
+	}
+	for _, algo := range cacheLookupOrder {
+		if d := f.Hashes[algo]; d != "" {
+			data, ok := blobCache.Get(algo, d)
+			if !ok {
+				return nil, false
+			}
+			if _, err := f.Verify(data); err != nil {
+				return nil, false
+			}
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+// completeHashes returns f with its sha1 and sha512 filled in from the
+// cached jar when the source published only one of them.
+func completeHashes(f mr.VersionFile) mr.VersionFile {
+	hashes := make(map[string]string, len(f.Hashes)+1)
+	for k, v := range f.Hashes {
+		hashes[k] = v
+	}
+	f.Hashes = hashes
+	if blobCache == nil || (hashes["sha1"] != "") == (hashes["sha512"] != "") {
+		return f
+	}
+	algo := "sha1"
+	if hashes[algo] == "" {
+		algo = "sha512"
+	}
+	data, ok := blobCache.Get(algo, hashes[algo])
+	if !ok {
+		return f
+	}
+	s1 := sha1.Sum(data)
+	s512 := sha512.Sum512(data)
+	hashes["sha1"], hashes["sha512"] = hex.EncodeToString(s1[:]), hex.EncodeToString(s512[:])
+	return f
+}
+
+// cacheJar stores a jar under its SHA-512 and the given published hashes.
+func cacheJar(data []byte, hashes map[string]string) {
+	if blobCache == nil || len(data) == 0 {
+		return
+	}
+	if _, err := blobCache.Put(data, hashes); err != nil {
+		log.Warn().Err(err).Msg("cache jar failed")
+	}
+}
+
+// gcBlobCache evicts least recently used jars beyond the cache limit,
+// keeping those tracked mods are installed with or can roll back to.
+func gcBlobCache(db *sql.DB) {
+	if blobCache == nil {
+		return
+	}
+	keep, err := dbpkg.ListReferencedBlobs(db)
+	if err != nil {
+		log.Warn().Err(err).Msg("list referenced jars failed")
+		return
+	}
+	if n, err := blobCache.Evict(keep); err != nil {
+		log.Warn().Err(err).Msg("evict cached jars failed")
+	} else if n > 0 {
+		log.Info().Int("evicted", n).Msg("artifact cache trimmed")
+	}
+}
+
+// blobCacheStats reports cache usage for the dashboard, or nil when caching
+// is disabled.
+func blobCacheStats() *artifacts.CacheStats {
+	if blobCache == nil {
+		return nil
+	}
+	st := blobCache.Stats()
+	return &st
+}
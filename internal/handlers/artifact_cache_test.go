@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"modsentinel/internal/artifacts"
+	"modsentinel/internal/backend"
+	dbpkg "modsentinel/internal/db"
+	mr "modsentinel/internal/modrinth"
+)
+
+func useBlobCache(t *testing.T, maxBytes int64) *artifacts.Cache {
+	t.Helper()
+	c := artifacts.NewCache(t.TempDir(), maxBytes)
+	old := blobCache
+	SetBlobCache(c)
+	t.Cleanup(func() { SetBlobCache(old) })
+	return c
+}
+
+func TestRunUpdateJob_ReusesCachedJar(t *testing.T) {
+	c := useBlobCache(t, 1<<20)
+	db := setupDB(t)
+	defer db.Close()
+	m, _ := pendingUpdate(t, db, "jar", map[string]string{"sha512": sha512Hex("jar")})
+
+	uj := &updateJob{id: 1, db: db}
+	runUpdateJob(context.Background(), db, uj, m.ID)
+	if uj.state != StateSucceeded {
+		t.Fatalf("state = %s, events = %+v", uj.state, uj.snapshotEvents())
+	}
+	if st := c.Stats(); st.Misses != 1 || st.Hits != 0 || st.Blobs != 1 {
+		t.Fatalf("first run stats = %+v", st)
+	}
+	if sum, _ := dbpkg.GetModContentHash(db, m.ID); sum != sha512Hex("jar") {
+		t.Fatalf("content hash = %q", sum)
+	}
+
+	// A second instance gets the same version from the cache; its CDN only
+	// serves a corrupt copy.
+	m2, server2 := pendingUpdate(t, db, "offline", map[string]string{"sha512": sha512Hex("jar")})
+	uj = &updateJob{id: 2, db: db}
+	runUpdateJob(context.Background(), db, uj, m2.ID)
+	if uj.state != StateSucceeded {
+		t.Fatalf("state = %s, events = %+v", uj.state, uj.snapshotEvents())
+	}
+	if got := string(server2["mods/lib-1.1.0.jar"]); got != "jar" {
+		t.Fatalf("installed %q, want cached jar", got)
+	}
+	if st := c.Stats(); st.Hits != 1 {
+		t.Fatalf("second run stats = %+v", st)
+	}
+}
+
+func TestRollbackFromCacheWhenNotRetained(t *testing.T) {
+	c := useBlobCache(t, 1<<20)
+	db := setupDB(t)
+	defer db.Close()
+	old := artifactStore
+	artifactStore = nil
+	defer func() { artifactStore = old }()
+
+	inst := &dbpkg.Instance{Name: "rb", Loader: "fabric", PufferpanelServerID: "srv"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	m := &dbpkg.Mod{Name: "Sodium", URL: "https://modrinth.com/mod/sodium", Channel: "release", CurrentVersion: "0.5.3", DownloadURL: "https://cdn.example/sodium-0.5.3.jar", InstanceID: inst.ID}
+	if err := dbpkg.InsertMod(db, m); err != nil {
+		t.Fatalf("insert mod: %v", err)
+	}
+	server := fakeServer{"mods/sodium-0.5.3.jar": []byte("new")}
+	server.install(t)
+	updID := appliedUpdate(t, db, m, []byte("old"))
+	if _, err := c.Put([]byte("old"), nil); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if keep, _ := dbpkg.ListReferencedBlobs(db); !keep[sha512Hex("old")] {
+		t.Fatalf("rollback jar not referenced: %v", keep)
+	}
+
+	id, err := dbpkg.InsertModRollbackQueued(db, m.ID, updID, m.CurrentVersion, "0.5.2")
+	if err != nil {
+		t.Fatalf("queue rollback: %v", err)
+	}
+	mu, _ := dbpkg.GetModUpdate(db, id)
+	uj := &updateJob{id: id, db: db}
+	runRollbackJob(context.Background(), db, uj, mu)
+	if uj.state != StateSucceeded {
+		t.Fatalf("state = %s, events = %+v", uj.state, uj.snapshotEvents())
+	}
+	if string(server["mods/sodium-0.5.2.jar"]) != "old" {
+		t.Fatalf("previous jar not restored: %v", server)
+	}
+}
+
+func TestFetchArtifact_ServesCachedJar(t *testing.T) {
+	c := useBlobCache(t, 1<<20)
+	db := setupDB(t)
+	defer db.Close()
+	inst := &dbpkg.Instance{Name: "deps", Loader: "fabric", Backend: backend.Local, PufferpanelServerID: "srv"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	requests := 0
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("jar:" + r.URL.Path))
+	}))
+	defer cdn.Close()
+	server := fakeBackend{}
+	server.install(t, backend.Local)
+	if _, err := c.Put([]byte("cached"), map[string]string{"sha1": "aliased"}); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	plan := &depPlan{Install: []depInstall{{Slug: "lib", Name: "Lib", Version: "1", DownloadURL: cdn.URL + "/lib-1.jar", Hashes: map[string]string{"sha512": sha512Hex("cached")}}}}
+	if _, err := installDependencies(context.Background(), db, inst, plan); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	if got := string(server["mods/lib-1.jar"]); got != "cached" || requests != 0 {
+		t.Fatalf("installed %q after %d downloads", got, requests)
+	}
+
+	// Sources download through the cache too, and a stale alias falls back
+	// to the network.
+	v := depVersion("lib-1", "lib", "release", time.Now())
+	v.Files[0] = mr.VersionFile{URL: cdn.URL + "/lib-1.jar", Hashes: map[string]string{"sha512": sha512Hex("cached")}}
+	if data, cached, err := (modrinthSource{}).Download(context.Background(), v); err != nil || string(data) != "cached" || !cached || requests != 0 {
+		t.Fatalf("download = %q, %v, %v after %d requests", data, cached, err, requests)
+	}
+	v.Files[0].Hashes = map[string]string{"sha1": "aliased"}
+	if data, cached, err := (modrinthSource{}).Download(context.Background(), v); err != nil || string(data) != "jar:/lib-1.jar" || cached || requests != 1 {
+		t.Fatalf("download = %q, %v, %v after %d requests", data, cached, err, requests)
+	}
+}
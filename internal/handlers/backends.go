@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+
+	"modsentinel/internal/backend"
+	dbpkg "modsentinel/internal/db"
+	"modsentinel/internal/pterodactyl"
+	pppkg "modsentinel/internal/pufferpanel"
+	"modsentinel/internal/sftp"
+)
+
+// serverBackends maps backend kinds to their implementation. Local
+// directories are served only once roots are allowlisted at startup.
+var serverBackends = map[string]backend.ServerBackend{
+	backend.PufferPanel: ppBackend{},
+	backend.Pterodactyl: pterodactyl.Backend{},
+	backend.Local:       disabledBackend(backend.Local),
+	backend.SFTP:        sftp.Backend{},
+}
+
+// SetServerBackend sets the implementation of a backend kind.
+func SetServerBackend(kind string, b backend.ServerBackend) {
+	serverBackends[kind] = b
+}
+
+// backendOf returns the backend of a kind, as accepted by backend.Kind.
+func backendOf(kind string) (backend.ServerBackend, string, bool) {
+	kind, ok := backend.Kind(kind)
+	if !ok {
+		return nil, "", false
+	}
+	b, ok := serverBackends[kind]
+	return b, kind, ok
+}
+
+// backendFor returns the backend an instance's server lives on. Kinds are
+// validated when instances are created, so unknown ones only come from
+// databases written by newer versions and fail as unconfigured.
+func backendFor(inst *dbpkg.Instance) backend.ServerBackend {
+	if b, _, ok := backendOf(inst.Backend); ok {
+		return onConnection(b, inst.ConnectionID)
+	}
+	return disabledBackend(inst.Backend)
+}
+
+// onConnection binds the PufferPanel backend to a named connection; other
+// backends are returned unchanged.
+func onConnection(b backend.ServerBackend, conn string) backend.ServerBackend {
+	if pb, ok := b.(ppBackend); ok && conn != "" {
+		pb.conn = conn
+		return pb
+	}
+	return b
+}
+
+// connectionContext selects an instance's PufferPanel connection for
+// direct PufferPanel calls made with the returned context.
+func connectionContext(ctx context.Context, inst *dbpkg.Instance) context.Context {
+	if inst.ConnectionID == "" || !usesPufferPanel(inst) {
+		return ctx
+	}
+	return pppkg.WithConnection(ctx, inst.ConnectionID)
+}
+
+// backendBaseURL returns the location stored for a backend kind and, for
+// PufferPanel, connection, which keys server list caches.
+func backendBaseURL(kind, conn string) (string, error) {
+	switch kind {
+	case backend.Pterodactyl:
+		c, err := pterodactyl.Config()
+		return c.BaseURL, err
+	case backend.SFTP:
+		c, err := sftp.Config()
+		return c.User + "@" + c.Host, err
+	case backend.Local:
+		return "", nil
+	}
+	c, err := pppkg.GetConnection(conn)
+	return c.BaseURL, err
+}
+
+// usesPufferPanel reports whether an instance is bound to PufferPanel, whose
+// server definitions sync reads for loader and game version detection.
+func usesPufferPanel(inst *dbpkg.Instance) bool {
+	kind, _ := backend.Kind(inst.Backend)
+	return kind == backend.PufferPanel
+}
+
+// serverDefinition fetches the template definition of a PufferPanel
+// server; other backends have none.
+func serverDefinition(ctx context.Context, inst *dbpkg.Instance, serverID string) (*pppkg.ServerDefinition, error) {
+	if !usesPufferPanel(inst) {
+		return nil, backend.ErrUnsupported
+	}
+	return ppGetServerDefinition(connectionContext(ctx, inst), serverID)
+}
+
+// powerFor returns the power controls of an instance's backend.
+func powerFor(inst *dbpkg.Instance) (backend.PowerController, error) {
+	if pc, ok := backendFor(inst).(backend.PowerController); ok {
+		return pc, nil
+	}
+	return nil, backend.ErrUnsupported
+}
+
+// ppBackend is the PufferPanel backend on a connection, the default one
+// unless conn is set. It calls through the pp* hooks so tests can stub
+// single PufferPanel calls.
+type ppBackend struct{ conn string }
+
+func (b ppBackend) ctx(ctx context.Context) context.Context {
+	if b.conn == "" {
+		return ctx
+	}
+	return pppkg.WithConnection(ctx, b.conn)
+}
+
+func (b ppBackend) ListServers(ctx context.Context) ([]backend.Server, error) {
+	return pppkg.ListServers(b.ctx(ctx))
+}
+
+func (b ppBackend) GetServer(ctx context.Context, serverID string) (*backend.Server, error) {
+	s, err := ppGetServer(b.ctx(ctx), serverID)
+	if err != nil {
+		return nil, err
+	}
+	return &backend.Server{ID: s.ID, Name: s.Name}, nil
+}
+
+func (b ppBackend) ListPath(ctx context.Context, serverID, path string) ([]backend.FileEntry, error) {
+	return ppListPath(b.ctx(ctx), serverID, path)
+}
+
+func (b ppBackend) FetchFile(ctx context.Context, serverID, path string) ([]byte, error) {
+	return ppFetchFile(b.ctx(ctx), serverID, path)
+}
+
+func (b ppBackend) PutFile(ctx context.Context, serverID, path string, data []byte) error {
+	return ppPutFile(b.ctx(ctx), serverID, path, data)
+}
+
+func (b ppBackend) DeleteFile(ctx context.Context, serverID, path string) error {
+	return ppDeleteFile(b.ctx(ctx), serverID, path)
+}
+
+func (b ppBackend) ServerStatus(ctx context.Context, serverID string) (bool, error) {
+	return ppServerStatus(b.ctx(ctx), serverID)
+}
+
+func (b ppBackend) StopServer(ctx context.Context, serverID string) error {
+	return ppStopServer(b.ctx(ctx), serverID)
+}
+
+func (b ppBackend) StartServer(ctx context.Context, serverID string) error {
+	return ppStartServer(b.ctx(ctx), serverID)
+}
+
+func (b ppBackend) RestartServer(ctx context.Context, serverID string) error {
+	return ppRestartServer(b.ctx(ctx), serverID)
+}
+
+// disabledBackend is a backend kind that is not configured; every call
+// fails with a ConfigError naming it.
+type disabledBackend string
+
+func (d disabledBackend) err() error {
+	return &backend.ConfigError{Reason: "server backend " + string(d) + " is not configured"}
+}
+
+func (d disabledBackend) ListServers(ctx context.Context) ([]backend.Server, error) {
+	return nil, d.err()
+}
+
+func (d disabledBackend) GetServer(ctx context.Context, serverID string) (*backend.Server, error) {
+	return nil, d.err()
+}
+
+func (d disabledBackend) ListPath(ctx context.Context, serverID, path string) ([]backend.FileEntry, error) {
+	return nil, d.err()
+}
+
+func (d disabledBackend) FetchFile(ctx context.Context, serverID, path string) ([]byte, error) {
+	return nil, d.err()
+}
+
+func (d disabledBackend) PutFile(ctx context.Context, serverID, path string, data []byte) error {
+	return d.err()
+}
+
+func (d disabledBackend) DeleteFile(ctx context.Context, serverID, path string) error {
+	return d.err()
+}
+
+func (d disabledBackend) ServerStatus(ctx context.Context, serverID string) (bool, error) {
+	return false, d.err()
+}
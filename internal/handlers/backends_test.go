@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/time/rate"
+
+	"modsentinel/internal/backend"
+	cf "modsentinel/internal/curseforge"
+	dbpkg "modsentinel/internal/db"
+	"modsentinel/internal/localfs"
+	pppkg "modsentinel/internal/pufferpanel"
+)
+
+// fakeBackend is an in-memory server "srv" without power controls.
+type fakeBackend map[string][]byte
+
+func (fb fakeBackend) install(t *testing.T, kind string) {
+	t.Helper()
+	orig := serverBackends[kind]
+	serverBackends[kind] = fb
+	t.Cleanup(func() { serverBackends[kind] = orig })
+}
+
+func (fb fakeBackend) ListServers(ctx context.Context) ([]backend.Server, error) {
+	return []backend.Server{{ID: "srv", Name: "Fake"}}, nil
+}
+
+func (fb fakeBackend) GetServer(ctx context.Context, id string) (*backend.Server, error) {
+	if id != "srv" {
+		return nil, backend.ErrNotFound
+	}
+	return &backend.Server{ID: id, Name: "Fake"}, nil
+}
+
+func (fb fakeBackend) ListPath(ctx context.Context, id, dir string) ([]backend.FileEntry, error) {
+	var out []backend.FileEntry
+	for p := range fb {
+		if strings.HasPrefix(p, dir) {
+			out = append(out, backend.FileEntry{Name: strings.TrimPrefix(p, dir)})
+		}
+	}
+	if out == nil {
+		return nil, backend.ErrNotFound
+	}
+	return out, nil
+}
+
+func (fb fakeBackend) FetchFile(ctx context.Context, id, p string) ([]byte, error) {
+	data, ok := fb[p]
+	if !ok {
+		return nil, backend.ErrNotFound
+	}
+	return data, nil
+}
+
+func (fb fakeBackend) PutFile(ctx context.Context, id, p string, data []byte) error {
+	fb[p] = data
+	return nil
+}
+
+func (fb fakeBackend) DeleteFile(ctx context.Context, id, p string) error {
+	if _, ok := fb[p]; !ok {
+		return backend.ErrNotFound
+	}
+	delete(fb, p)
+	return nil
+}
+
+func (fb fakeBackend) ServerStatus(ctx context.Context, id string) (bool, error) { return true, nil }
+
+func TestPerformSync_UsesInstanceBackend(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+	inst := &dbpkg.Instance{Name: "ptero", Loader: "forge", Backend: backend.Pterodactyl}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	if got, _ := dbpkg.GetInstance(db, inst.ID); got.Backend != backend.Pterodactyl {
+		t.Fatalf("backend = %q", got.Backend)
+	}
+	jar := []byte("curseforge only jar")
+	fakeBackend{"mods/jei-forge.jar": jar}.install(t, backend.Pterodactyl)
+	origDef, origRaw := ppGetServerDefinition, ppGetServerDefinitionRaw
+	defer func() { ppGetServerDefinition, ppGetServerDefinitionRaw = origDef, origRaw }()
+	ppGetServerDefinition = func(ctx context.Context, id string) (*pppkg.ServerDefinition, error) {
+		t.Fatal("PufferPanel definition fetched for a Pterodactyl server")
+		return nil, nil
+	}
+	ppGetServerDefinitionRaw = func(ctx context.Context, id string) (map[string]any, error) {
+		t.Fatal("PufferPanel definition fetched for a Pterodactyl server")
+		return nil, nil
+	}
+	current := cf.File{ID: 100, ModID: 238222, DisplayName: "jei-15.2.0", FileName: "jei-15.2.0.jar", ReleaseType: cf.ReleaseTypeRelease, FileDate: time.Now(), GameVersions: []string{"1.20.1", "Forge"}}
+	oldCF := cfClient
+	cfClient = fakeCFClient{
+		mod:     cf.Mod{ID: 238222, Name: "Just Enough Items", Slug: "jei"},
+		files:   []cf.File{current},
+		printed: map[uint32]cf.File{cf.Fingerprint(jar): current},
+	}
+	defer func() { cfClient = oldCF }()
+	resolved := 0
+	old := modClient
+	modClient = hashClient{resolved: &resolved}
+	defer func() { modClient = old }()
+
+	w := httptest.NewRecorder()
+	performSync(context.Background(), w, httptest.NewRequest(http.MethodPost, "/", nil), db, inst, "srv", newJobProgress(), nil)
+	mods, err := dbpkg.ListMods(db, inst.ID)
+	if err != nil || len(mods) != 1 || mods[0].CurrentVersion != "jei-15.2.0" {
+		t.Fatalf("mods = %+v, %v (status %d: %s)", mods, err, w.Code, w.Body.String())
+	}
+
+	// The backend is validated with the server, and servers without power
+	// controls cannot be stopped for maintenance.
+	if d := validateInstanceReq(context.Background(), &instanceReq{PufferpanelServerID: "srv", Backend: "pelican"}); len(d) != 0 {
+		t.Fatalf("validate details = %v", d)
+	}
+	if d := validateInstanceReq(context.Background(), &instanceReq{Name: "x", Backend: "ftp"}); d["backend"] != "invalid" {
+		t.Fatalf("validate details = %v", d)
+	}
+	inst.PufferpanelServerID = "srv"
+	err = applyWithServerControl(context.Background(), db, inst, true, func() bool { t.Fatal("applied without stopping"); return true })
+	if !errors.Is(err, backend.ErrUnsupported) {
+		t.Fatalf("stop err = %v", err)
+	}
+}
+
+func TestBackendFor_LocalAndUnconfigured(t *testing.T) {
+	var ce *backend.ConfigError
+	inst := &dbpkg.Instance{Backend: backend.Local, PufferpanelServerID: "/srv/mc"}
+	if _, err := backendFor(inst).ListPath(context.Background(), inst.PufferpanelServerID, "mods/"); !errors.As(err, &ce) {
+		t.Fatalf("local without roots err = %v", err)
+	}
+	if _, err := backendFor(&dbpkg.Instance{Backend: "ftp"}).GetServer(context.Background(), "x"); !errors.As(err, &ce) {
+		t.Fatalf("unknown backend err = %v", err)
+	}
+
+	root := t.TempDir()
+	local, err := localfs.New([]string{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := serverBackends[backend.Local]
+	SetServerBackend(backend.Local, local)
+	defer SetServerBackend(backend.Local, orig)
+	inst.PufferpanelServerID = root
+	if _, err := backendFor(inst).ListPath(context.Background(), root, "mods/"); !errors.Is(err, backend.ErrNotFound) {
+		t.Fatalf("missing mods folder err = %v", err)
+	}
+}
+
+// fakePufferPanel serves one server, "<name>1", to clients with secret.
+func fakePufferPanel(t *testing.T, secret, name string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/oauth2/token":
+			r.ParseForm()
+			if r.PostForm.Get("client_secret") != secret {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error":"invalid_client"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"access_token":"tok-%s","expires_in":3600}`, secret)
+		case r.Header.Get("Authorization") != "Bearer tok-"+secret:
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/api/servers":
+			fmt.Fprintf(w, `{"paging":{"page":1,"size":1,"total":1},"servers":[{"id":"%s1","name":"%s"}]}`, name, name)
+		case r.URL.Path == "/api/servers/"+name+"1":
+			fmt.Fprintf(w, `{"id":"%s1","name":"%s"}`, name, name)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestListServersHandler_AcrossConnections(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+	initSecrets(t, db)
+	// Leave the shared write limiter to the tests asserting on it.
+	limiter := writeLimiter
+	writeLimiter = rate.NewLimiter(rate.Inf, 0)
+	t.Cleanup(func() { writeLimiter = limiter })
+	eu := fakePufferPanel(t, "eu-secret", "eu")
+	us := fakePufferPanel(t, "us-secret", "us")
+	if err := pppkg.Set(pppkg.Credentials{BaseURL: eu.URL, ClientID: "id", ClientSecret: "eu-secret"}); err != nil {
+		t.Fatal(err)
+	}
+	body := fmt.Sprintf(`{"name":"US","base_url":%q,"client_id":"id","client_secret":"us-secret"}`, us.URL)
+	req := httptest.NewRequest(http.MethodPut, "/api/pufferpanel/connections/us", strings.NewReader(body))
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("conn", "us")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+	setConnectionHandler()(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("set connection status %d: %s", w.Code, w.Body.String())
+	}
+
+	list := func(query string) (int, []backend.Server) {
+		w := httptest.NewRecorder()
+		listServersHandler(db)(w, httptest.NewRequest(http.MethodPost, "/api/instances/sync"+query, nil))
+		var servers []backend.Server
+		json.NewDecoder(w.Body).Decode(&servers)
+		return w.Code, servers
+	}
+	if code, servers := list(""); code != http.StatusOK || len(servers) != 2 || servers[0].Connection != "" || servers[1].Connection != "us" {
+		t.Fatalf("all servers = %d %+v", code, servers)
+	}
+	if code, servers := list("?connection=us"); code != http.StatusOK || len(servers) != 1 || servers[0].ID != "us1" {
+		t.Fatalf("us servers = %d %+v", code, servers)
+	}
+	if code, _ := list("?connection=Nope!"); code != http.StatusBadRequest {
+		t.Fatalf("invalid connection status %d", code)
+	}
+
+	// Instances reach their server through their connection.
+	d := validateInstanceReq(context.Background(), &instanceReq{PufferpanelServerID: "us1", ConnectionID: "us"})
+	if d["serverId"] != "" || d["upstream"] != "" {
+		t.Fatalf("validate details = %v", d)
+	}
+	inst := &dbpkg.Instance{Name: "us", PufferpanelServerID: "us1", ConnectionID: "us"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := dbpkg.GetInstance(db, inst.ID)
+	if s, err := backendFor(got).GetServer(context.Background(), "us1"); err != nil || s.Name != "us" {
+		t.Fatalf("server via connection = %+v, %v", s, err)
+	}
+	if _, err := backendFor(&dbpkg.Instance{}).GetServer(context.Background(), "us1"); !errors.Is(err, backend.ErrNotFound) {
+		t.Fatalf("server via default connection err = %v", err)
+	}
+
+	// Connections in use cannot be deleted.
+	req = httptest.NewRequest(http.MethodDelete, "/api/pufferpanel/connections/us", nil)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w = httptest.NewRecorder()
+	deleteConnectionHandler(db)(w, req)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("delete used connection status %d", w.Code)
+	}
+}
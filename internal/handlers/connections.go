@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"modsentinel/internal/httpx"
+	pppkg "modsentinel/internal/pufferpanel"
+	"modsentinel/internal/telemetry"
+)
+
+type connectionRequest struct {
+	Name string `json:"name"`
+	pufferRequest
+}
+
+// listConnectionsHandler lists the PufferPanel connections without their
+// client credentials.
+func listConnectionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conns, err := pppkg.Connections()
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		if conns == nil {
+			conns = []pppkg.Connection{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(conns)
+	}
+}
+
+// setConnectionHandler creates or replaces a PufferPanel connection after
+// testing its credentials.
+func setConnectionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !writeLimiter.Allow() {
+			httpx.Write(w, r, httpx.TooManyRequests("rate limit exceeded"))
+			return
+		}
+		id := chi.URLParam(r, "conn")
+		if !pppkg.ValidConnectionID(id) {
+			httpx.Write(w, r, httpx.BadRequest("invalid connection id"))
+			return
+		}
+		var req connectionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpx.Write(w, r, httpx.BadRequest("invalid json"))
+			return
+		}
+		if err := validatePayload(&req.pufferRequest); err != nil {
+			httpx.Write(w, r, err)
+			return
+		}
+		creds := pppkg.Credentials{BaseURL: req.BaseURL, ClientID: req.ClientID, ClientSecret: req.ClientSecret, Scopes: req.Scopes, DeepScan: req.DeepScan}
+		if err := pppkg.TestConnection(r.Context(), creds); err != nil {
+			writePPError(w, r, err)
+			return
+		}
+		if err := pppkg.SetConnection(id, req.Name, creds); err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		telemetry.Event("pufferpanel_connection_set", map[string]string{"connection": id})
+		log.Info().Str("connection", id).Msg("pufferpanel connection set")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// deleteConnectionHandler removes a PufferPanel connection no instance
+// uses.
+func deleteConnectionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !writeLimiter.Allow() {
+			httpx.Write(w, r, httpx.TooManyRequests("rate limit exceeded"))
+			return
+		}
+		id := chi.URLParam(r, "conn")
+		if !pppkg.ValidConnectionID(id) {
+			httpx.Write(w, r, httpx.BadRequest("invalid connection id"))
+			return
+		}
+		if id != pppkg.DefaultConnection {
+			var n int
+			if err := db.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM instances WHERE connection_id=?`, id).Scan(&n); err != nil {
+				httpx.Write(w, r, httpx.Internal(err))
+				return
+			}
+			if n > 0 {
+				httpx.Write(w, r, httpx.Conflict("connection is used by instances"))
+				return
+			}
+		}
+		if err := pppkg.ClearConnection(id); err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		telemetry.Event("pufferpanel_connection_cleared", map[string]string{"connection": id})
+		log.Info().Str("connection", id).Msg("pufferpanel connection deleted")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
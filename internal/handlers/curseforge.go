@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	urlpkg "net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	cf "modsentinel/internal/curseforge"
+	dbpkg "modsentinel/internal/db"
+	mr "modsentinel/internal/modrinth"
+)
+
+type curseforgeClient interface {
+	Mod(ctx context.Context, id int) (*cf.Mod, error)
+	ModBySlug(ctx context.Context, slug string) (*cf.Mod, error)
+	Files(ctx context.Context, modID int, gameVersion, loader string) ([]cf.File, error)
+	File(ctx context.Context, modID, fileID int) (*cf.File, error)
+	FingerprintMatches(ctx context.Context, fingerprints []uint32) (map[uint32]cf.File, error)
+}
+
+var cfClient curseforgeClient = cf.NewClient()
+
+// curseforgeSource adapts cfClient to Source.
+type curseforgeSource struct{}
+
+func (curseforgeSource) Name() string { return dbpkg.SourceCurseForge }
+
+// ParseURL accepts project URLs such as
+// https://www.curseforge.com/minecraft/mc-mods/jei.
+func (curseforgeSource) ParseURL(raw string) (string, bool) {
+	u, err := urlpkg.Parse(raw)
+	if err != nil || !strings.HasSuffix(strings.ToLower(u.Hostname()), "curseforge.com") {
+		return "", false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, p := range parts {
+		if p == "mc-mods" || p == "bukkit-plugins" {
+			if i+1 < len(parts) && parts[i+1] != "" {
+				return parts[i+1], true
+			}
+		}
+	}
+	return "", false
+}
+
+func (curseforgeSource) ProjectURL(slug string) string {
+	return "https://www.curseforge.com/minecraft/mc-mods/" + slug
+}
+
+func (curseforgeSource) Project(ctx context.Context, slug string) (*mr.Project, error) {
+	mod, err := cfClient.ModBySlug(ctx, slug)
+	if err != nil {
+		return nil, projectNotFound(err, cf.IsNotFound(err))
+	}
+	return curseForgeProject(mod), nil
+}
+
+func (curseforgeSource) Versions(ctx context.Context, slug, gameVersion, loader string) ([]mr.Version, error) {
+	return curseForgeVersions(ctx, slug, gameVersion, loader)
+}
+
+func (curseforgeSource) Identify(ctx context.Context, jars map[string]*jarInfo) map[string]*jarMatch {
+	out := make(map[string]*jarMatch)
+	for name, f := range lookupJarFingerprints(ctx, jars) {
+		m, err := matchJarByFingerprint(ctx, f, jars[name])
+		if err != nil {
+			if ctx.Err() != nil {
+				return out
+			}
+			log.Ctx(ctx).Debug().Str("file", name).Err(err).Msg("curseforge project fetch for fingerprint match failed")
+			continue
+		}
+		out[name] = m
+	}
+	return out
+}
+
+// Download fetches the version's file. Versions without files are those
+// whose authors disabled third-party downloads.
+func (curseforgeSource) Download(ctx context.Context, v mr.Version) ([]byte, bool, error) {
+	f, ok := v.PrimaryFile()
+	if !ok || f.URL == "" {
+		return nil, false, cf.ErrDistributionDisabled
+	}
+	return fetchArtifact(ctx, f)
+}
+
+func curseForgeProject(mod *cf.Mod) *mr.Project {
+	return &mr.Project{ID: strconv.Itoa(mod.ID), Slug: mod.Slug, Title: mod.Name, IconURL: mod.Logo.ThumbnailURL}
+}
+
+func curseForgeVersions(ctx context.Context, slug, gameVersion, loader string) ([]mr.Version, error) {
+	mod, err := cfClient.ModBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	files, err := cfClient.Files(ctx, mod.ID, gameVersion, loader)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]mr.Version, 0, len(files))
+	for _, f := range files {
+		out = append(out, curseForgeVersion(f))
+	}
+	return out, nil
+}
+
+// curseForgeVersion converts a CurseForge file to a version. Files whose
+// authors disabled third-party downloads have no download URL and therefore
+// no files.
+func curseForgeVersion(f cf.File) mr.Version {
+	num := strings.TrimSpace(f.DisplayName)
+	if num == "" {
+		num = strings.TrimSuffix(f.FileName, ".jar")
+	}
+	v := mr.Version{
+		ID:            strconv.Itoa(f.ID),
+		ProjectID:     strconv.Itoa(f.ModID),
+		VersionNumber: num,
+		VersionType:   f.Channel(),
+		DatePublished: f.FileDate,
+		GameVersions:  f.MinecraftVersions(),
+		Loaders:       f.Loaders(),
+	}
+	if f.DownloadURL != "" {
+		file := mr.VersionFile{URL: f.DownloadURL, Filename: f.FileName, Size: f.FileLength, Primary: true}
+		if h := f.SHA1(); h != "" {
+			file.Hashes = map[string]string{"sha1": h}
+		}
+		v.Files = []mr.VersionFile{file}
+	}
+	return v
+}
+
+// lookupJarFingerprints resolves jars through CurseForge's fingerprint
+// endpoint, keyed by jar filename. Lookup errors, including a missing API
+// key, are logged and leave jars unresolved.
+func lookupJarFingerprints(ctx context.Context, jars map[string]*jarInfo) map[string]cf.File {
+	hits := make(map[string]cf.File)
+	byPrint := make(map[uint32][]string)
+	for name, j := range jars {
+		byPrint[j.fingerprint] = append(byPrint[j.fingerprint], name)
+	}
+	if len(byPrint) == 0 {
+		return hits
+	}
+	prints := make([]uint32, 0, len(byPrint))
+	for p := range byPrint {
+		prints = append(prints, p)
+	}
+	sort.Slice(prints, func(i, j int) bool { return prints[i] < prints[j] })
+	for start := 0; start < len(prints); start += hashLookupBatch {
+		end := start + hashLookupBatch
+		if end > len(prints) {
+			end = len(prints)
+		}
+		res, err := cfClient.FingerprintMatches(ctx, prints[start:end])
+		if err != nil {
+			log.Ctx(ctx).Debug().Err(err).Int("fingerprints", end-start).Msg("curseforge fingerprint lookup failed")
+			if errors.Is(err, cf.ErrNoAPIKey) {
+				break
+			}
+			continue
+		}
+		for p, f := range res {
+			for _, name := range byPrint[p] {
+				hits[name] = f
+			}
+		}
+	}
+	return hits
+}
+
+// matchJarByFingerprint completes a CurseForge fingerprint hit with its
+// project details.
+func matchJarByFingerprint(ctx context.Context, f cf.File, jar *jarInfo) (*jarMatch, error) {
+	mod, err := cfClient.Mod(ctx, f.ModID)
+	if err != nil {
+		return nil, err
+	}
+	v := curseForgeVersion(f)
+	m := &jarMatch{proj: curseForgeProject(mod), slug: mod.Slug, ver: v.VersionNumber, version: v, method: MatchFingerprint}
+	if jar != nil {
+		m.loader = jar.loader
+	}
+	return m, nil
+}
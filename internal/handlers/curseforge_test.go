@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cf "modsentinel/internal/curseforge"
+	dbpkg "modsentinel/internal/db"
+	pppkg "modsentinel/internal/pufferpanel"
+)
+
+// fakeCFClient serves one CurseForge project with the given files.
+type fakeCFClient struct {
+	mod     cf.Mod
+	files   []cf.File
+	printed map[uint32]cf.File
+}
+
+func (c fakeCFClient) Mod(ctx context.Context, id int) (*cf.Mod, error) {
+	m := c.mod
+	return &m, nil
+}
+
+func (c fakeCFClient) ModBySlug(ctx context.Context, slug string) (*cf.Mod, error) {
+	if slug != c.mod.Slug {
+		return nil, &cf.Error{Status: http.StatusNotFound, Message: "project not found"}
+	}
+	m := c.mod
+	return &m, nil
+}
+
+func (c fakeCFClient) Files(ctx context.Context, modID int, gameVersion, loader string) ([]cf.File, error) {
+	return c.files, nil
+}
+
+func (c fakeCFClient) File(ctx context.Context, modID, fileID int) (*cf.File, error) {
+	for _, f := range c.files {
+		if f.ID == fileID {
+			return &f, nil
+		}
+	}
+	return nil, &cf.Error{Status: http.StatusNotFound, Message: "file not found"}
+}
+
+func (c fakeCFClient) FingerprintMatches(ctx context.Context, fingerprints []uint32) (map[uint32]cf.File, error) {
+	out := map[uint32]cf.File{}
+	for _, p := range fingerprints {
+		if f, ok := c.printed[p]; ok {
+			out[p] = f
+		}
+	}
+	return out, nil
+}
+
+func TestPerformSync_MatchesCurseForgeFingerprint(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+
+	inst := &dbpkg.Instance{Name: "cf", Loader: "forge"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	jar := []byte("curseforge only jar")
+	origGet, origList, origFetch := ppGetServer, ppListPath, ppFetchFile
+	defer func() { ppGetServer, ppListPath, ppFetchFile = origGet, origList, origFetch }()
+	ppGetServer = func(ctx context.Context, id string) (*pppkg.ServerDetail, error) {
+		return &pppkg.ServerDetail{ID: id}, nil
+	}
+	ppListPath = func(ctx context.Context, id, path string) ([]pppkg.FileEntry, error) {
+		return []pppkg.FileEntry{{Name: "jei-forge.jar"}}, nil
+	}
+	ppFetchFile = func(ctx context.Context, id, path string) ([]byte, error) { return jar, nil }
+
+	now := time.Now()
+	current := cf.File{ID: 100, ModID: 238222, DisplayName: "jei-15.2.0", FileName: "jei-15.2.0.jar", ReleaseType: cf.ReleaseTypeRelease, FileDate: now.Add(-time.Hour), DownloadURL: "https://edge.forgecdn.net/files/100/jei-15.2.0.jar", GameVersions: []string{"1.20.1", "Forge"}}
+	newer := current
+	newer.ID, newer.DisplayName, newer.FileName, newer.FileDate, newer.DownloadURL = 101, "jei-15.3.0", "jei-15.3.0.jar", now, "https://edge.forgecdn.net/files/101/jei-15.3.0.jar"
+	oldCF := cfClient
+	cfClient = fakeCFClient{
+		mod:     cf.Mod{ID: 238222, Name: "Just Enough Items", Slug: "jei"},
+		files:   []cf.File{newer, current},
+		printed: map[uint32]cf.File{cf.Fingerprint(jar): current},
+	}
+	defer func() { cfClient = oldCF }()
+	resolved := 0
+	old := modClient
+	modClient = hashClient{resolved: &resolved}
+	defer func() { modClient = old }()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	performSync(context.Background(), w, req, db, inst, "srv", newJobProgress(), nil)
+
+	mods, err := dbpkg.ListMods(db, inst.ID)
+	if err != nil {
+		t.Fatalf("list mods: %v", err)
+	}
+	if len(mods) != 1 {
+		t.Fatalf("mods len=%d, want 1", len(mods))
+	}
+	m := mods[0]
+	if m.Source != dbpkg.SourceCurseForge || m.URL != "https://www.curseforge.com/minecraft/mc-mods/jei" || m.MatchMethod != MatchFingerprint {
+		t.Fatalf("unexpected mod: %+v", m)
+	}
+	if m.CurrentVersion != "jei-15.2.0" || m.AvailableVersion != "jei-15.3.0" || !strings.HasSuffix(m.DownloadURL, "jei-15.3.0.jar") {
+		t.Fatalf("versions not resolved on CurseForge: %+v", m)
+	}
+	if resolved != 0 {
+		t.Fatalf("name resolution ran %d times for a fingerprint hit", resolved)
+	}
+}
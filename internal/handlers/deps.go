@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	urlpkg "net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	dbpkg "modsentinel/internal/db"
+	hg "modsentinel/internal/hangar"
+	mr "modsentinel/internal/modrinth"
+)
+
+// depInstall is a required dependency that is not yet tracked on the
+// instance and will be installed alongside the requested mod.
+type depInstall struct {
+	ProjectID   string `json:"project_id"`
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	IconURL     string `json:"icon_url"`
+	VersionID   string `json:"version_id"`
+	Version     string `json:"version"`
+	Channel     string `json:"channel"`
+	DownloadURL string `json:"download_url"`
+	RequiredBy  string `json:"required_by"`
+	// Hashes are the digests published for the download, keyed by algorithm.
+	Hashes map[string]string `json:"hashes,omitempty"`
+}
+
+// depPlan is the transitive dependency closure of a version on an instance.
+// Blockers are incompatibilities or unsatisfiable requirements; a plan with
+// blockers must not be installed.
+type depPlan struct {
+	Install  []depInstall `json:"install"`
+	Warnings []string     `json:"warnings,omitempty"`
+	Blockers []string     `json:"blockers,omitempty"`
+}
+
+// resolveDependencies walks the dependency graph of root, which belongs to
+// rootSlug, and plans the required projects missing from inst. Versions are
+// chosen for the instance's game version and loader. Optional dependencies
+// that are absent become warnings; incompatible projects that are installed
+// or planned become blockers.
+func resolveDependencies(ctx context.Context, db *sql.DB, inst *dbpkg.Instance, rootSlug string, root mr.Version) (*depPlan, error) {
+	plan := &depPlan{Install: []depInstall{}}
+	mods, err := dbpkg.ListMods(db, inst.ID)
+	if err != nil {
+		return nil, err
+	}
+	present := map[string]bool{}
+	for _, m := range mods {
+		if s, err := parseModrinthSlug(m.URL); err == nil {
+			present[strings.ToLower(s)] = true
+		}
+	}
+	present[strings.ToLower(rootSlug)] = true
+
+	type node struct {
+		name    string
+		version mr.Version
+	}
+	queue := []node{{name: rootSlug, version: root}}
+	seen := map[string]bool{root.ProjectID: true}
+	type conflict struct{ from, slug, name string }
+	var incompatible []conflict
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, dep := range cur.version.Dependencies {
+			if dep.DependencyType == mr.DependencyEmbedded {
+				continue
+			}
+			pid := dep.ProjectID
+			var pinned *mr.Version
+			if dep.VersionID != "" {
+				v, err := modClient.Version(ctx, dep.VersionID)
+				if err != nil {
+					return nil, err
+				}
+				pinned = v
+				if pid == "" {
+					pid = v.ProjectID
+				}
+			}
+			if pid == "" {
+				continue
+			}
+			proj, err := modClient.Project(ctx, pid)
+			if err != nil {
+				return nil, err
+			}
+			slug := proj.Slug
+			if slug == "" {
+				slug = pid
+			}
+			name := proj.Title
+			if name == "" {
+				name = slug
+			}
+			installed := present[strings.ToLower(slug)]
+			switch dep.DependencyType {
+			case mr.DependencyOptional:
+				if !installed {
+					plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s optionally depends on %s, which is not installed", cur.name, name))
+				}
+			case mr.DependencyIncompatible:
+				// Checked once the full plan is known so planned installs count too.
+				incompatible = append(incompatible, conflict{from: cur.name, slug: slug, name: name})
+			case mr.DependencyRequired:
+				if installed || seen[pid] {
+					continue
+				}
+				seen[pid] = true
+				v, ok, err := pickDependencyVersion(ctx, slug, pinned, inst)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					plan.Blockers = append(plan.Blockers, fmt.Sprintf("%s requires %s, which has no version for %s %s", cur.name, name, inst.Loader, inst.GameVersion))
+					continue
+				}
+				item := depInstall{
+					ProjectID:  pid,
+					Slug:       slug,
+					Name:       name,
+					IconURL:    proj.IconURL,
+					VersionID:  v.ID,
+					Version:    v.VersionNumber,
+					Channel:    strings.ToLower(v.VersionType),
+					RequiredBy: cur.name,
+				}
+				if f, ok := v.PrimaryFile(); ok {
+					item.DownloadURL, item.Hashes = f.URL, f.Hashes
+					if !f.Verifiable() {
+						plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s %s publishes no hash; it will be installed unverified", name, v.VersionNumber))
+					}
+				}
+				plan.Install = append(plan.Install, item)
+				present[strings.ToLower(slug)] = true
+				queue = append(queue, node{name: name, version: v})
+			}
+		}
+	}
+	for _, c := range incompatible {
+		if present[strings.ToLower(c.slug)] {
+			plan.Blockers = append(plan.Blockers, fmt.Sprintf("%s is incompatible with %s", c.from, c.name))
+		}
+	}
+	return plan, nil
+}
+
+// pickDependencyVersion returns the version to install for a dependency. A
+// pinned version is used when compatible; otherwise the newest compatible
+// release is preferred over pre-releases.
+func pickDependencyVersion(ctx context.Context, slug string, pinned *mr.Version, inst *dbpkg.Instance) (mr.Version, bool, error) {
+	if pinned != nil {
+		return *pinned, versionCompatible(*pinned, inst.GameVersion, inst.Loader), nil
+	}
+	versions, err := modClient.Versions(ctx, slug, "", "")
+	if err != nil {
+		return mr.Version{}, false, err
+	}
+	var best mr.Version
+	found := false
+	for _, v := range versions {
+		if !versionCompatible(v, inst.GameVersion, inst.Loader) {
+			continue
+		}
+		if !found {
+			best, found = v, true
+			continue
+		}
+		bestRelease := strings.EqualFold(best.VersionType, "release")
+		vRelease := strings.EqualFold(v.VersionType, "release")
+		if (vRelease && !bestRelease) || (vRelease == bestRelease && v.DatePublished.After(best.DatePublished)) {
+			best = v
+		}
+	}
+	return best, found, nil
+}
+
+// versionCompatible reports whether v supports the game version and loader.
+// Empty requirements and versions without loader data are not filtered.
+func versionCompatible(v mr.Version, gameVersion, loader string) bool {
+	if gv := strings.TrimSpace(gameVersion); gv != "" && len(v.GameVersions) > 0 {
+		ok := false
+		for _, g := range v.GameVersions {
+			if g == gv {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if ld := strings.TrimSpace(loader); ld != "" && len(v.Loaders) > 0 {
+		for _, l := range v.Loaders {
+			if strings.EqualFold(l, ld) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// installDependencies uploads planned dependencies to the instance's
+// PufferPanel server, when linked, and tracks them as mods. Downloads are
+// verified against their published hashes and scanned before upload; those
+// without a hash are logged as unverified. It stops at the first failure and
+// returns the mods installed so far.
+func installDependencies(ctx context.Context, db *sql.DB, inst *dbpkg.Instance, plan *depPlan) ([]dbpkg.Mod, error) {
+	var out []dbpkg.Mod
+	for _, d := range plan.Install {
+		if strings.TrimSpace(inst.PufferpanelServerID) != "" && d.DownloadURL != "" {
+			f := mr.VersionFile{URL: d.DownloadURL, Hashes: d.Hashes}
+			data, _, err := fetchArtifact(ctx, f)
+			if err != nil {
+				return out, fmt.Errorf("dependency %s: %w", d.Name, err)
+			}
+			algo, err := f.Verify(data)
+			if err != nil {
+				return out, fmt.Errorf("dependency %s: %w", d.Name, err)
+			}
+			if algo == "" {
+				log.Warn().Int("instance_id", inst.ID).Str("dependency", d.Slug).Str("version", d.Version).Msg("installing dependency without a published hash; jar is unverified")
+			}
+			name := artifactFileName(d.DownloadURL, d.Slug, d.Version)
+			if err := uploadJar(ctx, db, inst, nil, instanceModFolder(inst)+name, data); err != nil {
+				return out, fmt.Errorf("dependency %s: %w", d.Name, err)
+			}
+			cacheJar(data, d.Hashes)
+		}
+		m := dbpkg.Mod{
+			Name:             d.Name,
+			IconURL:          d.IconURL,
+			URL:              "https://modrinth.com/mod/" + d.Slug,
+			GameVersion:      inst.GameVersion,
+			Loader:           inst.Loader,
+			Channel:          d.Channel,
+			CurrentVersion:   d.Version,
+			AvailableVersion: d.Version,
+			AvailableChannel: d.Channel,
+			DownloadURL:      d.DownloadURL,
+			InstanceID:       inst.ID,
+			ProjectID:        d.ProjectID,
+			VersionID:        d.VersionID,
+		}
+		if err := dbpkg.InsertMod(db, &m); err != nil {
+			return out, err
+		}
+		_ = dbpkg.InsertEvent(db, &dbpkg.ModEvent{InstanceID: inst.ID, ModID: &m.ID, Action: "added", ModName: m.Name, To: m.CurrentVersion})
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// instanceModFolder returns the server folder holding jars for the instance.
+func instanceModFolder(inst *dbpkg.Instance) string {
+	return loaderModFolder(inst.Loader)
+}
+
+// loaderModFolder returns the server folder holding jars for a loader:
+// plugins/ for every platform Hangar serves plugins to, mods/ otherwise.
+func loaderModFolder(loader string) string {
+	if hg.PlatformForLoader(loader) != "" {
+		return "plugins/"
+	}
+	return "mods/"
+}
+
+// artifactFileName derives a jar name from its download URL, falling back to
+// slug-version.jar.
+func artifactFileName(rawURL, slug, version string) string {
+	if u, err := urlpkg.Parse(rawURL); err == nil {
+		if i := strings.LastIndex(u.Path, "/"); i != -1 && i+1 < len(u.Path) {
+			return u.Path[i+1:]
+		}
+	}
+	base := strings.TrimSpace(slug)
+	if base == "" {
+		base = "mod"
+	}
+	ver := strings.TrimSpace(version)
+	if ver == "" {
+		ver = "latest"
+	}
+	return base + "-" + ver + ".jar"
+}
+
+// downloadError reports a non-2xx artifact download. Rate limits and server
+// errors are temporary so withRetryCount retries them.
+type downloadError struct{ Status int }
+
+func (e *downloadError) Error() string { return fmt.Sprintf("download failed: %d", e.Status) }
+
+func (e *downloadError) Temporary() bool { return e.Status == 429 || e.Status >= 500 }
+
+// maxArtifactSize bounds a downloaded mod file.
+const maxArtifactSize = 128 << 20 // 128 MiB
+
+// errArtifactTooLarge reports a download larger than maxArtifactSize.
+var errArtifactTooLarge = errors.New("download failed: file too large")
+
+// artifactClient downloads mod files. The timeout covers the whole transfer.
+var artifactClient = &http.Client{Timeout: 5 * time.Minute}
+
+// fetchArtifact returns the mod file f from the jar cache when one of its
+// published hashes is cached, downloading it otherwise. The bool reports a
+// cache hit. Callers verify downloads and cache them once accepted.
+func fetchArtifact(ctx context.Context, f mr.VersionFile) ([]byte, bool, error) {
+	if data, ok := cachedArtifact(f); ok {
+		return data, true, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.URL, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := artifactClient.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, false, &downloadError{Status: resp.StatusCode}
+	}
+	if resp.ContentLength > maxArtifactSize {
+		return nil, false, errArtifactTooLarge
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxArtifactSize+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) > maxArtifactSize {
+		return nil, false, errArtifactTooLarge
+	}
+	if len(data) == 0 {
+		return nil, false, fmt.Errorf("download failed: empty file")
+	}
+	return data, false, nil
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"modsentinel/internal/backend"
+	dbpkg "modsentinel/internal/db"
+	mr "modsentinel/internal/modrinth"
+)
+
+// depClient serves a fixed project graph keyed by project ID (which doubles
+// as the slug).
+type depClient struct {
+	fakeModClient
+	versions map[string][]mr.Version
+	byID     map[string]mr.Version
+}
+
+func (c depClient) Project(ctx context.Context, id string) (*mr.Project, error) {
+	return &mr.Project{ID: id, Slug: id, Title: strings.ToUpper(id)}, nil
+}
+
+func (c depClient) Versions(ctx context.Context, slug, gameVersion, loader string) ([]mr.Version, error) {
+	return c.versions[slug], nil
+}
+
+func (c depClient) Version(ctx context.Context, id string) (*mr.Version, error) {
+	v, ok := c.byID[id]
+	if !ok {
+		return nil, &mr.Error{Status: http.StatusNotFound}
+	}
+	return &v, nil
+}
+
+func depVersion(id, project, typ string, published time.Time, deps ...mr.Dependency) mr.Version {
+	return mr.Version{
+		ID:            id,
+		ProjectID:     project,
+		VersionNumber: id,
+		VersionType:   typ,
+		DatePublished: published,
+		GameVersions:  []string{"1.20.1"},
+		Loaders:       []string{"fabric"},
+		Files: []mr.VersionFile{{
+			URL:    "https://cdn.example/" + id + ".jar",
+			Hashes: map[string]string{"sha512": sha512Hex("jar:/" + id + ".jar")},
+		}},
+		Dependencies: deps,
+	}
+}
+
+func TestResolveDependencies(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	inst := &dbpkg.Instance{Name: "deps", Loader: "fabric", GameVersion: "1.20.1"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	if err := dbpkg.InsertMod(db, &dbpkg.Mod{Name: "Installed", URL: "https://modrinth.com/mod/installed", InstanceID: inst.ID}); err != nil {
+		t.Fatalf("insert mod: %v", err)
+	}
+
+	now := time.Now()
+	req := func(p string) mr.Dependency {
+		return mr.Dependency{ProjectID: p, DependencyType: mr.DependencyRequired}
+	}
+	old := modClient
+	modClient = depClient{versions: map[string][]mr.Version{
+		// Newest is a beta; the newer-than-old release must still win.
+		"api": {
+			depVersion("api-beta", "api", "beta", now, req("lib")),
+			depVersion("api-new", "api", "release", now.Add(-time.Hour), req("lib")),
+			depVersion("api-old", "api", "release", now.Add(-2*time.Hour)),
+		},
+		"lib": {depVersion("lib-1", "lib", "release", now, req("installed"), req("api"))},
+	}}
+	defer func() { modClient = old }()
+
+	root := depVersion("root-1", "root", "release", now,
+		req("api"),
+		mr.Dependency{ProjectID: "extras", DependencyType: mr.DependencyOptional},
+		mr.Dependency{ProjectID: "bundled", DependencyType: mr.DependencyEmbedded},
+	)
+	plan, err := resolveDependencies(context.Background(), db, inst, "root", root)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if len(plan.Blockers) != 0 {
+		t.Fatalf("unexpected blockers: %v", plan.Blockers)
+	}
+	if len(plan.Install) != 2 || plan.Install[0].VersionID != "api-new" || plan.Install[1].VersionID != "lib-1" || plan.Install[1].RequiredBy != "API" {
+		t.Fatalf("unexpected install plan: %+v", plan.Install)
+	}
+	if len(plan.Warnings) != 1 || !strings.Contains(plan.Warnings[0], "EXTRAS") {
+		t.Fatalf("unexpected warnings: %v", plan.Warnings)
+	}
+}
+
+func TestResolveDependencies_WarnsUnverified(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	inst := &dbpkg.Instance{Name: "deps", Loader: "fabric", GameVersion: "1.20.1"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+
+	now := time.Now()
+	bare := depVersion("bare-1", "bare", "release", now)
+	bare.Files[0].Hashes = nil
+	old := modClient
+	modClient = depClient{versions: map[string][]mr.Version{"bare": {bare}}}
+	defer func() { modClient = old }()
+
+	root := depVersion("root-1", "root", "release", now,
+		mr.Dependency{ProjectID: "bare", DependencyType: mr.DependencyRequired},
+	)
+	plan, err := resolveDependencies(context.Background(), db, inst, "root", root)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if len(plan.Install) != 1 || plan.Install[0].VersionID != "bare-1" {
+		t.Fatalf("unexpected install plan: %+v", plan.Install)
+	}
+	if len(plan.Warnings) != 1 || !strings.Contains(plan.Warnings[0], "installed unverified") {
+		t.Fatalf("unexpected warnings: %v", plan.Warnings)
+	}
+}
+
+func TestResolveDependencies_Blockers(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	inst := &dbpkg.Instance{Name: "deps", Loader: "fabric", GameVersion: "1.20.1"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	if err := dbpkg.InsertMod(db, &dbpkg.Mod{Name: "Optifine", URL: "https://modrinth.com/mod/optifine", InstanceID: inst.ID}); err != nil {
+		t.Fatalf("insert mod: %v", err)
+	}
+
+	now := time.Now()
+	forge := depVersion("forgeonly-1", "forgeonly", "release", now)
+	forge.Loaders = []string{"forge"}
+	pinned := depVersion("pinned-old", "pinned", "release", now)
+	pinned.GameVersions = []string{"1.19.2"}
+	old := modClient
+	modClient = depClient{
+		versions: map[string][]mr.Version{"forgeonly": {forge}},
+		byID:     map[string]mr.Version{"pinned-old": pinned},
+	}
+	defer func() { modClient = old }()
+
+	root := depVersion("root-1", "root", "release", now,
+		mr.Dependency{ProjectID: "forgeonly", DependencyType: mr.DependencyRequired},
+		mr.Dependency{VersionID: "pinned-old", DependencyType: mr.DependencyRequired},
+		mr.Dependency{ProjectID: "optifine", DependencyType: mr.DependencyIncompatible},
+		mr.Dependency{ProjectID: "absent", DependencyType: mr.DependencyIncompatible},
+	)
+	plan, err := resolveDependencies(context.Background(), db, inst, "root", root)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if len(plan.Install) != 0 {
+		t.Fatalf("unexpected install plan: %+v", plan.Install)
+	}
+	if len(plan.Blockers) != 3 {
+		t.Fatalf("blockers = %v, want 3", plan.Blockers)
+	}
+	if !strings.Contains(plan.Blockers[2], "incompatible with OPTIFINE") {
+		t.Fatalf("unexpected blocker: %q", plan.Blockers[2])
+	}
+}
+
+func TestInstallDependencies_VerifiesHashes(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	inst := &dbpkg.Instance{Name: "deps", Loader: "fabric", Backend: backend.Local, PufferpanelServerID: "srv"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("jar:" + r.URL.Path))
+	}))
+	defer cdn.Close()
+	server := fakeBackend{}
+	server.install(t, backend.Local)
+
+	plan := &depPlan{Install: []depInstall{
+		{Slug: "api", Name: "API", Version: "1", DownloadURL: cdn.URL + "/api-1.jar", Hashes: map[string]string{"sha512": sha512Hex("jar:/api-1.jar")}},
+		{Slug: "lib", Name: "Lib", Version: "1", DownloadURL: cdn.URL + "/lib-1.jar", Hashes: map[string]string{"sha512": sha512Hex("tampered")}},
+	}}
+	mods, err := installDependencies(context.Background(), db, inst, plan)
+	var mismatch *mr.HashMismatchError
+	if !errors.As(err, &mismatch) || len(mods) != 1 || mods[0].Name != "API" {
+		t.Fatalf("installed %+v, err %v", mods, err)
+	}
+	if _, ok := server["mods/lib-1.jar"]; ok {
+		t.Fatal("mismatched dependency was uploaded")
+	}
+	if _, ok := server["mods/api-1.jar"]; !ok {
+		t.Fatal("verified dependency was not uploaded")
+	}
+}
@@ -55,13 +55,16 @@ func setupDB(t *testing.T) *sql.DB {
     t.Helper()
     db, err := sql.Open("sqlite", ":memory:")
     if err != nil { t.Fatal(err) }
+    // Each connection to :memory: is a separate database; keep one so
+    // background workers see the same tables.
+    db.SetMaxOpenConns(1)
     if err := dbpkg.Init(db); err != nil { t.Fatal(err) }
     return db
 }
 
 func createInstance(t *testing.T, db *sql.DB, name string) *dbpkg.Instance {
     t.Helper()
-    inst := &dbpkg.Instance{Name: name, Loader: "fabric", EnforceSameLoader: true}
+    inst := &dbpkg.Instance{Name: name, Loader: "fabric"}
     if err := dbpkg.InsertInstance(db, inst); err != nil { t.Fatal(err) }
     return inst
 }
@@ -0,0 +1,548 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"modsentinel/internal/backend"
+	dbpkg "modsentinel/internal/db"
+	"modsentinel/internal/httpx"
+	"modsentinel/internal/telemetry"
+)
+
+var (
+	// driftTick is how often scheduled drift checks are looked for.
+	driftTick = time.Minute
+	// driftNow allows tests to move the clock.
+	driftNow = time.Now
+	// driftLocks serializes drift checks per instance.
+	driftLocks sync.Map // map[int]chan struct{}
+)
+
+// Bounds of a drift check schedule.
+const (
+	driftMinInterval = 5
+	driftMaxInterval = 7 * 24 * 60
+)
+
+var errDriftNoServer = errors.New("instance has no linked server")
+
+func driftLock(instID int) chan struct{} {
+	v, _ := driftLocks.LoadOrStore(instID, make(chan struct{}, 1))
+	return v.(chan struct{})
+}
+
+// serverDriftFile is a jar that differs between the server folder and the tracked
+// state. File is the jar on the server and Previous the one last seen.
+type serverDriftFile struct {
+	File     string `json:"file,omitempty"`
+	Previous string `json:"previous,omitempty"`
+	ModID    *int   `json:"mod_id,omitempty"`
+	Name     string `json:"name"`
+	From     string `json:"from_version,omitempty"`
+	To       string `json:"to_version,omitempty"`
+
+	slug string
+}
+
+// driftHashes remembers the hash of each jar diffDrift read, so jars the
+// backend lists with an unchanged size and modification time are not
+// downloaded again.
+var driftHashes sync.Map // driftHashKey -> driftHash
+
+type driftHashKey struct {
+	instanceID int
+	path       string
+	algo       string
+}
+
+type driftHash struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// serverDriftReport lists the jars added to, removed from and replaced by another
+// version in an instance's server folder since ModSentinel last saw it.
+type serverDriftReport struct {
+	InstanceID int               `json:"instance_id"`
+	CheckedAt  time.Time         `json:"checked_at"`
+	Folder     string            `json:"folder"`
+	Added      []serverDriftFile `json:"added"`
+	Removed    []serverDriftFile `json:"removed"`
+	Changed    []serverDriftFile `json:"changed"`
+	// SyncJobID is the sync queued to reconcile the drift.
+	SyncJobID int `json:"sync_job_id,omitempty"`
+}
+
+func (r *serverDriftReport) drifted() bool {
+	return len(r.Added)+len(r.Removed)+len(r.Changed) > 0
+}
+
+// diffDrift compares the jars in an instance's server folder with the jars
+// last recorded for it and its tracked mods. Jars are known by name: the
+// scans stored by syncs, updates and pack imports, and for tracked mods
+// never scanned, the names sync would look for. A removed jar and an added
+// one that parse to the same slug are reported as a version change. Jars
+// whose content hash is stored, as the installed jar of a tracked mod or
+// from a scan, are read back and reported as changed when the content was
+// replaced under the same name; a jar listed with the size and modification
+// time it had when last read is not read again.
+func diffDrift(ctx context.Context, db *sql.DB, inst *dbpkg.Instance) (*serverDriftReport, error) {
+	serverID := strings.TrimSpace(inst.PufferpanelServerID)
+	if serverID == "" {
+		return nil, errDriftNoServer
+	}
+	rep := &serverDriftReport{InstanceID: inst.ID, CheckedAt: driftNow().UTC(), Folder: instanceModFolder(inst), Added: []serverDriftFile{}, Removed: []serverDriftFile{}, Changed: []serverDriftFile{}}
+	entries, err := backendFor(inst).ListPath(ctx, serverID, rep.Folder)
+	if err != nil {
+		return nil, err
+	}
+	onServer := map[string]string{}
+	listed := map[string]backend.FileEntry{}
+	for _, e := range entries {
+		if !e.IsDir && strings.HasSuffix(strings.ToLower(e.Name), ".jar") {
+			onServer[strings.ToLower(e.Name)] = e.Name
+			listed[strings.ToLower(e.Name)] = e
+		}
+	}
+	mods, err := dbpkg.ListMods(db, inst.ID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*dbpkg.Mod, len(mods))
+	for i := range mods {
+		byID[mods[i].ID] = &mods[i]
+	}
+	scans, err := dbpkg.ListInstanceScans(db, inst.ID)
+	if err != nil {
+		return nil, err
+	}
+	states, err := dbpkg.ListModSyncStates(db, inst.ID)
+	if err != nil {
+		return nil, err
+	}
+	lastVersion := make(map[string]string, len(states))
+	for _, st := range states {
+		lastVersion[strings.ToLower(st.Slug)] = st.LastVersion
+	}
+
+	sums, err := dbpkg.ListModContentHashes(db)
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{}
+	scanned := map[int]bool{}
+	// stored holds the content hash last recorded for jars still present.
+	type storedJar struct {
+		algo, sum string
+		mod       *dbpkg.Mod
+	}
+	stored := map[string]storedJar{}
+	expect := func(name string, m *dbpkg.Mod, sum256 string) {
+		switch {
+		case m != nil && sums[m.ID] != "":
+			stored[name] = storedJar{algo: "sha512", sum: sums[m.ID], mod: m}
+		case sum256 != "":
+			stored[name] = storedJar{algo: "sha256", sum: sum256, mod: m}
+		}
+	}
+	removed := func(file string, m *dbpkg.Mod) {
+		d := serverDriftFile{Previous: file, Name: file}
+		if m != nil {
+			id := m.ID
+			d.ModID, d.Name, d.From = &id, m.Name, m.CurrentVersion
+			d.slug, _ = modSlug(m)
+		}
+		if d.slug == "" && file != "" {
+			meta := parseJarFilename(file)
+			d.slug = meta.Slug
+			if d.From = lastVersion[strings.ToLower(meta.Slug)]; d.From == "" {
+				d.From = meta.Version
+			}
+		}
+		rep.Removed = append(rep.Removed, d)
+	}
+	for _, sc := range scans {
+		name := strings.ToLower(sc.File)
+		known[name] = true
+		var m *dbpkg.Mod
+		if sc.ModID != nil {
+			m = byID[*sc.ModID]
+			scanned[*sc.ModID] = true
+		}
+		if _, ok := onServer[name]; !ok {
+			removed(sc.File, m)
+		} else {
+			expect(name, m, sc.SHA256)
+		}
+	}
+	for i := range mods {
+		m := &mods[i]
+		if scanned[m.ID] {
+			continue
+		}
+		present := false
+		for _, c := range modFileCandidates(m) {
+			if _, ok := onServer[c]; ok {
+				known[c], present = true, true
+				expect(c, m, "")
+			}
+		}
+		if !present {
+			removed("", m)
+		}
+	}
+	for name, want := range stored {
+		file := onServer[name]
+		got, err := driftJarHash(ctx, inst, rep.Folder+file, listed[name], want.algo)
+		if errors.Is(err, backend.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(got, want.sum) {
+			continue
+		}
+		d := serverDriftFile{File: file, Previous: file, Name: file}
+		if m := want.mod; m != nil {
+			id := m.ID
+			d.ModID, d.Name, d.From = &id, m.Name, m.CurrentVersion
+		} else {
+			meta := parseJarFilename(file)
+			if d.From = lastVersion[strings.ToLower(meta.Slug)]; d.From == "" {
+				d.From = meta.Version
+			}
+		}
+		d.To = d.From
+		rep.Changed = append(rep.Changed, d)
+	}
+	for name, file := range onServer {
+		if known[name] {
+			continue
+		}
+		meta := parseJarFilename(file)
+		rep.Added = append(rep.Added, serverDriftFile{File: file, Name: file, To: meta.Version, slug: meta.Slug})
+	}
+
+	// Pair replaced jars into version changes.
+	sortDrift(rep.Added)
+	sortDrift(rep.Removed)
+	added := rep.Added[:0]
+	for _, a := range rep.Added {
+		i := -1
+		if a.slug != "" {
+			for j, rm := range rep.Removed {
+				if strings.EqualFold(rm.slug, a.slug) || (rm.Previous != "" && strings.EqualFold(parseJarFilename(rm.Previous).Slug, a.slug)) {
+					i = j
+					break
+				}
+			}
+		}
+		if i < 0 {
+			added = append(added, a)
+			continue
+		}
+		rm := rep.Removed[i]
+		rep.Removed = append(rep.Removed[:i], rep.Removed[i+1:]...)
+		rep.Changed = append(rep.Changed, serverDriftFile{File: a.File, Previous: rm.Previous, ModID: rm.ModID, Name: rm.Name, From: rm.From, To: a.To})
+	}
+	rep.Added = added
+	sortDrift(rep.Changed)
+	return rep, nil
+}
+
+// driftJarHash returns the algo hash of the server jar at p, reusing the hash
+// last read while the listing shows the same size and modification time.
+// Jars listed without a modification time are always read.
+func driftJarHash(ctx context.Context, inst *dbpkg.Instance, p string, e backend.FileEntry, algo string) (string, error) {
+	key := driftHashKey{inst.ID, p, algo}
+	if v, ok := driftHashes.Load(key); ok && !e.ModTime.IsZero() {
+		if h := v.(driftHash); h.size == e.Size && h.modTime.Equal(e.ModTime) {
+			return h.sum, nil
+		}
+	}
+	data, err := backendFor(inst).FetchFile(ctx, strings.TrimSpace(inst.PufferpanelServerID), p)
+	if err != nil {
+		driftHashes.Delete(key)
+		return "", err
+	}
+	var sum string
+	if algo == "sha512" {
+		d := sha512.Sum512(data)
+		sum = hex.EncodeToString(d[:])
+	} else {
+		d := sha256.Sum256(data)
+		sum = hex.EncodeToString(d[:])
+	}
+	if !e.ModTime.IsZero() {
+		driftHashes.Store(key, driftHash{size: e.Size, modTime: e.ModTime, sum: sum})
+	}
+	return sum, nil
+}
+
+func sortDrift(l []serverDriftFile) {
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].File != l[j].File {
+			return l[i].File < l[j].File
+		}
+		return l[i].Previous+l[i].Name < l[j].Previous+l[j].Name
+	})
+}
+
+// lastDriftReport returns the stored report of an instance, if any.
+func lastDriftReport(c *dbpkg.DriftCheck) *serverDriftReport {
+	if c == nil || c.Report == "" {
+		return nil
+	}
+	var rep serverDriftReport
+	if err := json.Unmarshal([]byte(c.Report), &rep); err != nil {
+		return nil
+	}
+	return &rep
+}
+
+// recordDriftEvents adds drift_added, drift_removed and drift_changed
+// entries to mod_events for differences prev did not already report, so
+// drift left in place is logged once.
+func recordDriftEvents(db *sql.DB, inst *dbpkg.Instance, rep, prev *serverDriftReport) {
+	seen := map[string]bool{}
+	key := func(action string, d serverDriftFile) string {
+		return action + "\x00" + d.File + "\x00" + d.Previous + "\x00" + d.Name
+	}
+	if prev != nil {
+		for action, l := range map[string][]serverDriftFile{"drift_added": prev.Added, "drift_removed": prev.Removed, "drift_changed": prev.Changed} {
+			for _, d := range l {
+				seen[key(action, d)] = true
+			}
+		}
+	}
+	record := func(action string, l []serverDriftFile) {
+		for _, d := range l {
+			if seen[key(action, d)] {
+				continue
+			}
+			_ = dbpkg.InsertEvent(db, &dbpkg.ModEvent{InstanceID: inst.ID, ModID: d.ModID, Action: action, ModName: d.Name, From: d.From, To: d.To})
+		}
+	}
+	record("drift_added", rep.Added)
+	record("drift_removed", rep.Removed)
+	record("drift_changed", rep.Changed)
+}
+
+// runDriftCheck compares an instance's server folder with its tracked state,
+// records new differences in mod_events and stores the report. With
+// reconcile set, drift queues a sync, which brings the tracked mods in line
+// with the server.
+func runDriftCheck(ctx context.Context, db *sql.DB, inst *dbpkg.Instance, reconcile bool) (*serverDriftReport, error) {
+	rep, err := diffDrift(ctx, db, inst)
+	if err != nil {
+		telemetry.Event("drift_check", map[string]string{"instance_id": strconv.Itoa(inst.ID), "error": err.Error()})
+		return nil, err
+	}
+	var prev *serverDriftReport
+	if c, err := dbpkg.GetDriftCheck(db, inst.ID); err == nil {
+		prev = lastDriftReport(c)
+	}
+	recordDriftEvents(db, inst, rep, prev)
+	if reconcile && rep.drifted() && ctx.Err() == nil {
+		id, _, err := EnqueueSync(ctx, db, inst, inst.PufferpanelServerID, uuid.NewString())
+		if err != nil {
+			log.Error().Err(err).Int("instance_id", inst.ID).Msg("queue drift reconcile")
+		} else {
+			rep.SyncJobID = id
+		}
+	}
+	b, err := json.Marshal(rep)
+	if err != nil {
+		return nil, err
+	}
+	if err := dbpkg.RecordDriftReport(db, inst.ID, rep.CheckedAt.Format(time.RFC3339), string(b)); err != nil {
+		return nil, err
+	}
+	telemetry.Event("drift_check", map[string]string{
+		"instance_id": strconv.Itoa(inst.ID),
+		"added":       strconv.Itoa(len(rep.Added)),
+		"removed":     strconv.Itoa(len(rep.Removed)),
+		"changed":     strconv.Itoa(len(rep.Changed)),
+		"reconciled":  strconv.FormatBool(rep.SyncJobID != 0),
+	})
+	return rep, nil
+}
+
+// runDriftLoop runs due drift checks every driftTick until ctx ends.
+func runDriftLoop(ctx context.Context, db *sql.DB) {
+	t := time.NewTicker(driftTick)
+	defer t.Stop()
+	for {
+		runDueDriftChecks(ctx, db)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// runDueDriftChecks checks every instance whose schedule is due, one at a
+// time. Instances with a check already running are skipped until the next
+// tick.
+func runDueDriftChecks(ctx context.Context, db *sql.DB) {
+	checks, err := dbpkg.ListDriftChecks(db)
+	if err != nil {
+		log.Error().Err(err).Msg("list drift checks")
+		return
+	}
+	now := driftNow()
+	for _, c := range checks {
+		if ctx.Err() != nil {
+			return
+		}
+		if c.IntervalMinutes <= 0 {
+			continue
+		}
+		if last, err := time.Parse(time.RFC3339, c.LastCheckedAt); err == nil && now.Sub(last) < time.Duration(c.IntervalMinutes)*time.Minute {
+			continue
+		}
+		inst, err := dbpkg.GetInstance(db, c.InstanceID)
+		if err != nil {
+			continue
+		}
+		lock := driftLock(inst.ID)
+		select {
+		case lock <- struct{}{}:
+		default:
+			continue
+		}
+		if _, err := runDriftCheck(ctx, db, inst, c.AutoReconcile); err != nil {
+			log.Warn().Err(err).Int("instance_id", inst.ID).Msg("drift check")
+		}
+		<-lock
+	}
+}
+
+// driftCheckOut is the API shape of a drift check with its latest report.
+type driftCheckOut struct {
+	*dbpkg.DriftCheck
+	Report *serverDriftReport `json:"report,omitempty"`
+}
+
+func getDriftCheckHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inst := loadWindowInstance(w, r, db)
+		if inst == nil {
+			return
+		}
+		c, err := dbpkg.GetDriftCheck(db, inst.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			httpx.Write(w, r, httpx.NotFound("no drift check"))
+			return
+		}
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(driftCheckOut{DriftCheck: c, Report: lastDriftReport(c)})
+	}
+}
+
+func setDriftCheckHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inst := loadWindowInstance(w, r, db)
+		if inst == nil {
+			return
+		}
+		var c dbpkg.DriftCheck
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			httpx.Write(w, r, httpx.BadRequest("invalid json"))
+			return
+		}
+		if c.IntervalMinutes < driftMinInterval || c.IntervalMinutes > driftMaxInterval {
+			httpx.Write(w, r, httpx.BadRequest("validation failed").WithDetails(map[string]string{"interval_minutes": "must be between 5 and 10080"}))
+			return
+		}
+		if strings.TrimSpace(inst.PufferpanelServerID) == "" {
+			httpx.Write(w, r, httpx.BadRequest("validation failed").WithDetails(map[string]string{"instance": errDriftNoServer.Error()}))
+			return
+		}
+		c.InstanceID = inst.ID
+		if err := dbpkg.SetDriftCheck(db, &c); err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		stored, err := dbpkg.GetDriftCheck(db, inst.ID)
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(driftCheckOut{DriftCheck: stored, Report: lastDriftReport(stored)})
+	}
+}
+
+func deleteDriftCheckHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inst := loadWindowInstance(w, r, db)
+		if inst == nil {
+			return
+		}
+		if err := dbpkg.DeleteDriftCheck(db, inst.ID); err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// runDriftCheckHandler checks an instance now. It reconciles when the
+// instance's schedule auto-reconciles or reconcile=true is passed.
+func runDriftCheckHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inst := loadWindowInstance(w, r, db)
+		if inst == nil {
+			return
+		}
+		reconcile := r.URL.Query().Get("reconcile") == "true"
+		if c, err := dbpkg.GetDriftCheck(db, inst.ID); err == nil && c.AutoReconcile {
+			reconcile = true
+		}
+		lock := driftLock(inst.ID)
+		select {
+		case lock <- struct{}{}:
+		default:
+			httpx.Write(w, r, httpx.Conflict("drift check already running"))
+			return
+		}
+		rep, err := runDriftCheck(r.Context(), db, inst, reconcile)
+		<-lock
+		if errors.Is(err, errDriftNoServer) {
+			httpx.Write(w, r, httpx.BadRequest("validation failed").WithDetails(map[string]string{"instance": err.Error()}))
+			return
+		}
+		if err != nil {
+			writePPError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(rep)
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"modsentinel/internal/backend"
+	dbpkg "modsentinel/internal/db"
+)
+
+func TestDriftCheck_ReportsRecordsAndReconciles(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+	inst := &dbpkg.Instance{Name: "drift", Loader: "fabric", Backend: backend.Local, PufferpanelServerID: "srv"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatal(err)
+	}
+	addMod := func(slug, version, download, file string) *dbpkg.Mod {
+		m := &dbpkg.Mod{Name: slug, URL: "https://modrinth.com/mod/" + slug, CurrentVersion: version, DownloadURL: download, InstanceID: inst.ID}
+		if err := dbpkg.InsertMod(db, m); err != nil {
+			t.Fatal(err)
+		}
+		if file != "" {
+			if err := dbpkg.RecordJarScan(db, &dbpkg.JarScan{InstanceID: inst.ID, ModID: &m.ID, File: file, SHA256: "x"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return m
+	}
+	sodium := addMod("sodium", "0.5.3", "", "sodium-fabric-0.5.3.jar")
+	lithium := addMod("lithium", "0.11.2", "https://cdn.modrinth.com/data/a/versions/b/lithium-fabric-mc1.20.1-0.11.2.jar", "")
+	addMod("ferritecore", "6.0.0", "", "ferritecore-6.0.0-fabric.jar")
+	custom := sha256.Sum256([]byte("custom"))
+	if err := dbpkg.RecordJarScan(db, &dbpkg.JarScan{InstanceID: inst.ID, File: "custom-1.0.jar", SHA256: hex.EncodeToString(custom[:])}); err != nil {
+		t.Fatal(err)
+	}
+	// Lithium's jar was replaced in place.
+	if err := dbpkg.SetModContentHash(db, lithium.ID, sha512Hex("lithium")); err != nil {
+		t.Fatal(err)
+	}
+	fakeBackend{
+		"mods/sodium-fabric-0.5.8.jar":            nil,
+		"mods/lithium-fabric-mc1.20.1-0.11.2.jar": []byte("patched"),
+		"mods/custom-1.0.jar":                     []byte("custom"),
+		"mods/newmod-2.0.jar":                     nil,
+		"mods/readme.txt":                         nil,
+	}.install(t, backend.Local)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	origNow := driftNow
+	driftNow = func() time.Time { return now }
+	defer func() { driftNow = origNow }()
+
+	ctx := context.Background()
+	rep, err := runDriftCheck(ctx, db, inst, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Added) != 1 || rep.Added[0].File != "newmod-2.0.jar" || rep.Added[0].To != "2.0" {
+		t.Fatalf("added = %+v", rep.Added)
+	}
+	if len(rep.Removed) != 1 || rep.Removed[0].Name != "ferritecore" || rep.Removed[0].From != "6.0.0" {
+		t.Fatalf("removed = %+v", rep.Removed)
+	}
+	if len(rep.Changed) != 2 || *rep.Changed[1].ModID != sodium.ID || rep.Changed[1].From != "0.5.3" || rep.Changed[1].To != "0.5.8" || rep.Changed[1].File != "sodium-fabric-0.5.8.jar" {
+		t.Fatalf("changed = %+v", rep.Changed)
+	}
+	if ch := rep.Changed[0]; *ch.ModID != lithium.ID || ch.File != "lithium-fabric-mc1.20.1-0.11.2.jar" || ch.Previous != ch.File || ch.From != "0.11.2" {
+		t.Fatalf("replaced in place = %+v", ch)
+	}
+
+	// Drift left in place is reported again but recorded once.
+	if _, err := runDriftCheck(ctx, db, inst, false); err != nil {
+		t.Fatal(err)
+	}
+	driftEvents := func() []string {
+		evs, err := dbpkg.ListEvents(db, inst.ID, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, ev := range evs {
+			if strings.HasPrefix(ev.Action, "drift_") {
+				out = append(out, ev.Action+":"+ev.ModName)
+			}
+		}
+		return out
+	}
+	if evs := driftEvents(); len(evs) != 4 {
+		t.Fatalf("drift events = %v", evs)
+	}
+
+	// Scheduled checks run once their interval has passed and reconcile by
+	// queueing a sync.
+	if err := dbpkg.SetDriftCheck(db, &dbpkg.DriftCheck{InstanceID: inst.ID, IntervalMinutes: 30, AutoReconcile: true}); err != nil {
+		t.Fatal(err)
+	}
+	origJobs := jobsCh
+	jobsCh = make(chan int, 1)
+	defer func() { jobsCh = origJobs }()
+	now = now.Add(10 * time.Minute)
+	runDueDriftChecks(ctx, db)
+	if len(jobsCh) != 0 {
+		t.Fatal("drift check ran before its interval")
+	}
+	now = now.Add(30 * time.Minute)
+	runDueDriftChecks(ctx, db)
+	c, err := dbpkg.GetDriftCheck(db, inst.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := lastDriftReport(c)
+	if c.LastCheckedAt != now.Format(time.RFC3339) || last == nil || last.SyncJobID == 0 {
+		t.Fatalf("check = %+v, report = %+v", c, last)
+	}
+	if id := <-jobsCh; id != last.SyncJobID {
+		t.Fatalf("queued job %d, report %d", id, last.SyncJobID)
+	}
+
+	// Schedules are validated.
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"interval_minutes":1}`))
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", strconv.Itoa(inst.ID))
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+	setDriftCheckHandler(db)(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("short interval status %d", w.Code)
+	}
+}
+
+// statBackend lists a fakeBackend's files with their size and a set
+// modification time, counting the files read.
+type statBackend struct {
+	fakeBackend
+	modTime *time.Time
+	reads   *int
+}
+
+func (b statBackend) ListPath(ctx context.Context, id, dir string) ([]backend.FileEntry, error) {
+	out, err := b.fakeBackend.ListPath(ctx, id, dir)
+	for i := range out {
+		out[i].Size, out[i].ModTime = int64(len(b.fakeBackend[dir+out[i].Name])), *b.modTime
+	}
+	return out, err
+}
+
+func (b statBackend) FetchFile(ctx context.Context, id, p string) ([]byte, error) {
+	*b.reads++
+	return b.fakeBackend.FetchFile(ctx, id, p)
+}
+
+func TestDiffDrift_ReadsOnlyJarsListedAsChanged(t *testing.T) {
+	driftHashes.Range(func(k, _ any) bool { driftHashes.Delete(k); return true })
+	db := openTestDB(t)
+	defer db.Close()
+	inst := &dbpkg.Instance{Name: "drift", Loader: "fabric", Backend: backend.Local, PufferpanelServerID: "srv"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatal(err)
+	}
+	m := &dbpkg.Mod{Name: "lib", URL: "https://modrinth.com/mod/lib", CurrentVersion: "1.0", InstanceID: inst.ID}
+	if err := dbpkg.InsertMod(db, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbpkg.RecordJarScan(db, &dbpkg.JarScan{InstanceID: inst.ID, ModID: &m.ID, File: "lib-1.0.jar", SHA256: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbpkg.SetModContentHash(db, m.ID, sha512Hex("jar")); err != nil {
+		t.Fatal(err)
+	}
+	files := fakeBackend{"mods/lib-1.0.jar": []byte("jar")}
+	modTime, reads := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), 0
+	orig := serverBackends[backend.Local]
+	serverBackends[backend.Local] = statBackend{files, &modTime, &reads}
+	defer func() { serverBackends[backend.Local] = orig }()
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		rep, err := diffDrift(ctx, db, inst)
+		if err != nil || rep.drifted() {
+			t.Fatalf("check %d: report = %+v, %v", i, rep, err)
+		}
+	}
+	if reads != 1 {
+		t.Fatalf("unchanged jar read %d times", reads)
+	}
+
+	// Replaced in place with a jar of the same size.
+	files["mods/lib-1.0.jar"], modTime = []byte("JAR"), modTime.Add(time.Minute)
+	rep, err := diffDrift(ctx, db, inst)
+	if err != nil || len(rep.Changed) != 1 || rep.Changed[0].File != "lib-1.0.jar" {
+		t.Fatalf("report = %+v, %v", rep, err)
+	}
+	if reads != 2 {
+		t.Fatalf("replaced jar read %d times in total", reads)
+	}
+}
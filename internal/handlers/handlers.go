@@ -29,11 +29,17 @@ import (
 
 	singleflight "golang.org/x/sync/singleflight"
 	rate "golang.org/x/time/rate"
+	"modsentinel/internal/artifacts"
+	"modsentinel/internal/backend"
+	cf "modsentinel/internal/curseforge"
 	dbpkg "modsentinel/internal/db"
 	"modsentinel/internal/httpx"
 	mr "modsentinel/internal/modrinth"
+	"modsentinel/internal/pterodactyl"
 	pppkg "modsentinel/internal/pufferpanel"
+	"modsentinel/internal/scan"
 	"modsentinel/internal/secrets"
+	"modsentinel/internal/sftp"
 	"modsentinel/internal/telemetry"
 	tokenpkg "modsentinel/internal/token"
 )
@@ -41,8 +47,16 @@ import (
 type modrinthClient interface {
     Project(ctx context.Context, slug string) (*mr.Project, error)
     Versions(ctx context.Context, slug, gameVersion, loader string) ([]mr.Version, error)
+    Version(ctx context.Context, id string) (*mr.Version, error)
     Resolve(ctx context.Context, slug string) (*mr.Project, string, error)
     Search(ctx context.Context, query string) (*mr.SearchResult, error)
+    VersionsByHashes(ctx context.Context, hashes []string, algorithm string) (map[string]mr.Version, error)
+    LatestVersionsByHashes(ctx context.Context, hashes []string, algorithm string, loaders, gameVersions []string) (map[string]mr.Version, error)
+    Projects(ctx context.Context, ids []string) ([]mr.Project, error)
+    VersionsByIDs(ctx context.Context, ids []string) ([]mr.Version, error)
+    Loaders(ctx context.Context) ([]mr.LoaderTag, error)
+    Requests() int64
+    Budget() mr.Budget
 }
 
 var modClient modrinthClient = mr.NewClient()
@@ -52,6 +66,13 @@ var (
     ppGetServer = pppkg.GetServer
     ppListPath  = pppkg.ListPath
     ppFetchFile = pppkg.FetchFile
+    ppPutFile   = pppkg.PutFile
+    ppDeleteFile = pppkg.DeleteFile
+    // power control for maintenance and post-update restarts
+    ppStopServer    = pppkg.StopServer
+    ppStartServer   = pppkg.StartServer
+    ppRestartServer = pppkg.RestartServer
+    ppServerStatus  = pppkg.ServerStatus
     // fetch template definition and data
     ppGetServerDefinition = pppkg.GetServerDefinition
     ppGetServerDefinitionRaw = pppkg.GetServerDefinitionRaw
@@ -91,7 +112,7 @@ var csrfToken string
 var (
 	listServersTTL   = 2 * time.Second
 	listServersSF    singleflight.Group
-	listServersCache sync.Map // map[baseURL]listServersEntry
+	listServersCache sync.Map // map[kind|connection|baseURL]listServersEntry
 )
 
 // Cache for Modrinth loader tags
@@ -116,7 +137,7 @@ var autoDetectableLoaders = map[string]struct{}{
 }
 
 type listServersEntry struct {
-	servers []pppkg.Server
+	servers []backend.Server
 	exp     time.Time
 }
 
@@ -143,19 +164,33 @@ func writeModrinthError(w http.ResponseWriter, r *http.Request, err error) {
 }
 
 func writePPError(w http.ResponseWriter, r *http.Request, err error) int {
-	var ce *pppkg.ConfigError
+	var ce *backend.ConfigError
 	if errors.As(err, &ce) {
 		httpx.Write(w, r, httpx.BadRequest(ce.Error()))
 		return http.StatusBadRequest
 	}
-	if errors.Is(err, pppkg.ErrForbidden) {
+	if errors.Is(err, backend.ErrForbidden) {
 		httpx.Write(w, r, httpx.Forbidden("insufficient PufferPanel permissions"))
 		return http.StatusForbidden
 	}
-	if errors.Is(err, pppkg.ErrNotFound) {
+	if errors.Is(err, backend.ErrNotFound) {
 		http.NotFound(w, r)
 		return http.StatusNotFound
 	}
+	var pte *pterodactyl.Error
+	if errors.As(err, &pte) {
+		if pte.Status == http.StatusUnauthorized {
+			httpx.Write(w, r, httpx.Unauthorized("invalid Pterodactyl API key"))
+			return http.StatusUnauthorized
+		}
+		httpx.Write(w, r, httpx.BadGateway(pte.Error()))
+		return http.StatusBadGateway
+	}
+	var se *sftp.StatusError
+	if errors.As(err, &se) {
+		httpx.Write(w, r, httpx.BadGateway(se.Error()))
+		return http.StatusBadGateway
+	}
 	var pe *pppkg.Error
 	if errors.As(err, &pe) {
 		switch {
@@ -235,6 +270,19 @@ type tokenRequest struct {
 	Token string `json:"token" validate:"required"`
 }
 
+type pterodactylRequest struct {
+	BaseURL string `json:"base_url" validate:"required,url"`
+	APIKey  string `json:"api_key" validate:"required"`
+}
+
+type sftpRequest struct {
+	Host       string   `json:"host" validate:"required"`
+	User       string   `json:"user" validate:"required"`
+	PrivateKey string   `json:"private_key" validate:"required"`
+	HostKey    string   `json:"host_key"`
+	Paths      []string `json:"paths"`
+}
+
 type pufferRequest struct {
 	BaseURL      string `json:"base_url" validate:"required,url"`
 	ClientID     string `json:"client_id" validate:"required"`
@@ -271,6 +319,25 @@ func setSecretHandler() http.HandlerFunc {
 				httpx.Write(w, r, httpx.Internal(err))
 				return
 			}
+		case "curseforge":
+			var req tokenRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				httpx.Write(w, r, httpx.BadRequest("invalid json"))
+				return
+			}
+			if err := validatePayload(&req); err != nil {
+				httpx.Write(w, r, err)
+				return
+			}
+			if n := len(req.Token); n > 4 {
+				last4 = req.Token[n-4:]
+			} else {
+				last4 = req.Token
+			}
+			if err := cf.SetAPIKey(req.Token); err != nil {
+				httpx.Write(w, r, httpx.Internal(err))
+				return
+			}
 		case "pufferpanel":
 			var req pufferRequest
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -295,6 +362,55 @@ func setSecretHandler() http.HandlerFunc {
 				httpx.Write(w, r, httpx.Internal(err))
 				return
 			}
+		case "pterodactyl":
+			var req pterodactylRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				httpx.Write(w, r, httpx.BadRequest("invalid json"))
+				return
+			}
+			if err := validatePayload(&req); err != nil {
+				httpx.Write(w, r, err)
+				return
+			}
+			if n := len(req.APIKey); n > 4 {
+				last4 = req.APIKey[n-4:]
+			} else {
+				last4 = req.APIKey
+			}
+			creds := pterodactyl.Credentials{BaseURL: req.BaseURL, APIKey: req.APIKey}
+			if err := pterodactyl.TestConnection(r.Context(), creds); err != nil {
+				writePPError(w, r, err)
+				return
+			}
+			if err := pterodactyl.Set(creds); err != nil {
+				httpx.Write(w, r, httpx.Internal(err))
+				return
+			}
+		case "sftp":
+			var req sftpRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				httpx.Write(w, r, httpx.BadRequest("invalid json"))
+				return
+			}
+			if err := validatePayload(&req); err != nil {
+				httpx.Write(w, r, err)
+				return
+			}
+			// Keys end in a fixed footer, so log the host key's tail.
+			if n := len(req.HostKey); n > 4 {
+				last4 = req.HostKey[n-4:]
+			} else {
+				last4 = req.HostKey
+			}
+			creds := sftp.Credentials{Host: req.Host, User: req.User, PrivateKey: req.PrivateKey, HostKey: req.HostKey, Paths: req.Paths}
+			if err := sftp.TestConnection(r.Context(), creds); err != nil {
+				writePPError(w, r, err)
+				return
+			}
+			if err := sftp.Set(creds); err != nil {
+				httpx.Write(w, r, httpx.Internal(err))
+				return
+			}
 		default:
 			httpx.Write(w, r, httpx.BadRequest("unknown secret type"))
 			return
@@ -317,8 +433,14 @@ func deleteSecretHandler() http.HandlerFunc {
 		switch typ {
 		case "modrinth":
 			err = tokenpkg.ClearToken()
+		case "curseforge":
+			err = cf.ClearAPIKey()
 		case "pufferpanel":
 			err = pppkg.Clear()
+		case "pterodactyl":
+			err = pterodactyl.Clear()
+		case "sftp":
+			err = sftp.Clear()
 		default:
 			httpx.Write(w, r, httpx.BadRequest("unknown secret type"))
 			return
@@ -343,9 +465,14 @@ func secretStatusHandler(svc *secrets.Service) http.HandlerFunc {
 			updatedAt time.Time
 			err       error
 		)
-		if typ == "pufferpanel" {
+		switch typ {
+		case "pufferpanel":
 			exists, last4, updatedAt, err = svc.Status(r.Context(), "puffer.oauth_client_secret")
-		} else {
+		case "pterodactyl":
+			exists, last4, updatedAt, err = svc.Status(r.Context(), pterodactyl.APIKeySecret)
+		case "sftp":
+			exists, last4, updatedAt, err = svc.Status(r.Context(), sftp.PrivateKeySecret)
+		default:
 			exists, last4, updatedAt, err = svc.Status(r.Context(), typ)
 		}
 		if err != nil {
@@ -369,7 +496,7 @@ func secretStatusHandler(svc *secrets.Service) http.HandlerFunc {
 
 func testPufferHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		creds, err := pppkg.Get()
+		creds, err := pppkg.GetConnection(r.URL.Query().Get("connection"))
 		if err != nil {
 			writePPError(w, r, err)
 			return
@@ -403,41 +530,113 @@ func listServersHandler(db *sql.DB) http.HandlerFunc {
 			})
 		}()
 
-		creds, err := pppkg.Config()
+		srv, kind, ok := backendOf(r.URL.Query().Get("backend"))
+		if !ok {
+			status = http.StatusBadRequest
+			httpx.Write(w, r, httpx.BadRequest("unknown backend"))
+			return
+		}
+		conns, err := listConnections(kind, r.URL.Query().Get("connection"))
 		if err != nil {
 			status = writePPError(w, r, err)
 			return
 		}
-		var servers []pppkg.Server
-		if v, ok := listServersCache.Load(creds.BaseURL); ok {
-			ent := v.(listServersEntry)
-			if time.Now().Before(ent.exp) {
-				cacheHit = true
-				servers = ent.servers
+		// Listing several panels skips the ones that fail, unless all do.
+		servers := []backend.Server{}
+		var firstErr error
+		for _, conn := range conns {
+			svs, us, hit, shared, err := listConnServers(r.Context(), kind, onConnection(srv, conn), conn)
+			upstreamStatus = max(upstreamStatus, us)
+			cacheHit = cacheHit || hit
+			deduped = deduped || shared
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				log.Warn().Err(err).Str("connection", conn).Msg("list pufferpanel servers")
+				continue
 			}
+			servers = append(servers, svs...)
 		}
-            if servers == nil {
-                var shared bool
-                var v any
-                v, err, shared = listServersSF.Do(creds.BaseURL, func() (any, error) {
-                    svs, us, err := pppkg.ListServersWithStatus(r.Context())
-                    upstreamStatus = us
-                    if err != nil {
-                        return nil, err
-                    }
-                    return svs, nil
-                })
-                deduped = shared
-                if err != nil {
-                    status = writePPError(w, r, err)
-                    return
-                }
-                servers = v.([]pppkg.Server)
-                listServersCache.Store(creds.BaseURL, listServersEntry{servers: servers, exp: time.Now().Add(listServersTTL)})
-            }
-            w.Header().Set("Content-Type", "application/json")
-            json.NewEncoder(w).Encode(servers)
-        }
+		if firstErr != nil && (len(conns) == 1 || len(servers) == 0) {
+			status = writePPError(w, r, firstErr)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(servers)
+	}
+}
+
+// listConnections returns the PufferPanel connections a server listing
+// covers: the requested one, or all configured ones. Other backends have a
+// single unnamed connection.
+func listConnections(kind, conn string) ([]string, error) {
+	conn = strings.TrimSpace(conn)
+	if conn == pppkg.DefaultConnection {
+		conn = ""
+	}
+	if kind != backend.PufferPanel || conn != "" {
+		if conn != "" && (kind != backend.PufferPanel || !pppkg.ValidConnectionID(conn)) {
+			return nil, &backend.ConfigError{Reason: "invalid connection"}
+		}
+		return []string{conn}, nil
+	}
+	all, err := pppkg.Connections()
+	if err != nil || len(all) == 0 {
+		return []string{""}, err
+	}
+	ids := make([]string, 0, len(all))
+	for _, c := range all {
+		if c.ID == pppkg.DefaultConnection {
+			c.ID = ""
+		}
+		ids = append(ids, c.ID)
+	}
+	return ids, nil
+}
+
+// listConnServers lists the servers of one connection through the short
+// lived cache, tagging them with the connection when it is named.
+func listConnServers(ctx context.Context, kind string, srv backend.ServerBackend, conn string) (servers []backend.Server, upstreamStatus int, cacheHit, deduped bool, err error) {
+	baseURL, err := backendBaseURL(kind, conn)
+	if err != nil {
+		return nil, 0, false, false, err
+	}
+	cacheKey := kind + "|" + conn + "|" + baseURL
+	if v, ok := listServersCache.Load(cacheKey); ok {
+		ent := v.(listServersEntry)
+		if time.Now().Before(ent.exp) {
+			return ent.servers, 0, true, false, nil
+		}
+	}
+	v, err, shared := listServersSF.Do(cacheKey, func() (any, error) {
+		if kind != backend.PufferPanel {
+			return srv.ListServers(ctx)
+		}
+		if conn != "" {
+			ctx = pppkg.WithConnection(ctx, conn)
+		}
+		svs, us, err := pppkg.ListServersWithStatus(ctx)
+		upstreamStatus = us
+		if err != nil {
+			return nil, err
+		}
+		if conn == "" {
+			return svs, nil
+		}
+		tagged := make([]backend.Server, len(svs))
+		for i, sv := range svs {
+			sv.Connection = conn
+			tagged[i] = sv
+		}
+		return tagged, nil
+	})
+	if err != nil {
+		return nil, upstreamStatus, false, shared, err
+	}
+	servers = v.([]backend.Server)
+	listServersCache.Store(cacheKey, listServersEntry{servers: servers, exp: time.Now().Add(listServersTTL)})
+	return servers, upstreamStatus, false, shared, nil
 }
 
 func syncHandler(db *sql.DB) http.HandlerFunc {
@@ -549,6 +748,53 @@ func jobProgressHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
+// streamUpdateJob replays an update job's events as SSE and follows new ones
+// until the client goes away or a terminal event arrives.
+func streamUpdateJob(w http.ResponseWriter, r *http.Request, uj *updateJob) {
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        http.Error(w, "stream unsupported", http.StatusInternalServerError)
+        return
+    }
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("Connection", "keep-alive")
+    ch := uj.subscribe()
+    defer uj.unsubscribe(ch)
+    write := func(ev sseMsg) {
+        if ev.Event != "" {
+            fmt.Fprintf(w, "event: %s\n", ev.Event)
+        }
+        if ev.Data != nil {
+            b, _ := json.Marshal(ev.Data)
+            fmt.Fprintf(w, "data: %s\n\n", b)
+        } else {
+            fmt.Fprintf(w, "data: {}\n\n")
+        }
+    }
+    // replay existing events
+    for _, ev := range uj.snapshotEvents() {
+        write(ev)
+        if ev.Event == "done" {
+            flusher.Flush()
+            return
+        }
+    }
+    flusher.Flush()
+    for {
+        select {
+        case <-r.Context().Done():
+            return
+        case ev := <-ch:
+            write(ev)
+            flusher.Flush()
+            if ev.Event == "succeeded" || ev.Event == "failed" || ev.Event == "done" {
+                return
+            }
+        }
+    }
+}
+
 func jobEventsHandler(db *sql.DB) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         idStr := chi.URLParam(r, "id")
@@ -560,49 +806,8 @@ func jobEventsHandler(db *sql.DB) http.HandlerFunc {
         if _, err := dbpkg.GetSyncJob(db, id); err != nil {
             // If not a sync job, try in-memory update job stream
             if uj := getUpdateJob(id); uj != nil {
-                flusher, ok := w.(http.Flusher)
-                if !ok {
-                    http.Error(w, "stream unsupported", http.StatusInternalServerError)
-                    return
-                }
-                w.Header().Set("Content-Type", "text/event-stream")
-                w.Header().Set("Cache-Control", "no-cache")
-                w.Header().Set("Connection", "keep-alive")
-                ch := uj.subscribe()
-                defer uj.unsubscribe(ch)
-                // replay existing events
-                for _, ev := range uj.snapshotEvents() {
-                    if ev.Event != "" {
-                        fmt.Fprintf(w, "event: %s\n", ev.Event)
-                    }
-                    if ev.Data != nil {
-                        b, _ := json.Marshal(ev.Data)
-                        fmt.Fprintf(w, "data: %s\n\n", b)
-                    } else {
-                        fmt.Fprintf(w, "data: {}\n\n")
-                    }
-                }
-                flusher.Flush()
-                for {
-                    select {
-                    case <-r.Context().Done():
-                        return
-                    case ev := <-ch:
-                        if ev.Event != "" {
-                            fmt.Fprintf(w, "event: %s\n", ev.Event)
-                        }
-                        if ev.Data != nil {
-                            b, _ := json.Marshal(ev.Data)
-                            fmt.Fprintf(w, "data: %s\n\n", b)
-                        } else {
-                            fmt.Fprintf(w, "data: {}\n\n")
-                        }
-                        flusher.Flush()
-                        if ev.Event == "succeeded" || ev.Event == "failed" {
-                            return
-                        }
-                    }
-                }
+                streamUpdateJob(w, r, uj)
+                return
             }
             httpx.Write(w, r, httpx.NotFound("job not found"))
             return
@@ -741,7 +946,9 @@ func retryFailedHandler(db *sql.DB) http.HandlerFunc {
 }
 
 func performSync(ctx context.Context, w http.ResponseWriter, r *http.Request, db *sql.DB, inst *dbpkg.Instance, serverID string, prog *jobProgress, only []string) {
-    _, err := ppGetServer(ctx, serverID)
+    ctx = connectionContext(ctx, inst)
+    srv := backendFor(inst)
+    _, err := srv.GetServer(ctx, serverID)
     if err != nil {
         writePPError(w, r, err)
         return
@@ -803,22 +1010,25 @@ func performSync(ctx context.Context, w http.ResponseWriter, r *http.Request, db
     source := ""
     envDisplay := ""
     topDisplay := ""
-    // Load definition (raw) and structured (for variables)
+    // Load definition (raw) and structured (for variables); only PufferPanel
+    // servers have template definitions.
     var def *pppkg.ServerDefinition
     defFetched := 0
-    // Log: start fetching definition
-    log.Ctx(ctx).Info().
-        Int("instance_id", inst.ID).
-        Str("server_id", serverID).
-        Msg("definition_fetch_start")
-    if d, err := ppGetServerDefinition(ctx, serverID); err == nil {
-        def = d
-        defFetched++
-    }
     defRaw := map[string]any{}
-    if raw, err := ppGetServerDefinitionRaw(ctx, serverID); err == nil {
-        defRaw = raw
-        defFetched++
+    if usesPufferPanel(inst) {
+        // Log: start fetching definition
+        log.Ctx(ctx).Info().
+            Int("instance_id", inst.ID).
+            Str("server_id", serverID).
+            Msg("definition_fetch_start")
+        if d, err := ppGetServerDefinition(ctx, serverID); err == nil {
+            def = d
+            defFetched++
+        }
+        if raw, err := ppGetServerDefinitionRaw(ctx, serverID); err == nil {
+            defRaw = raw
+            defFetched++
+        }
     }
     // Log: fetched definition summary
     {
@@ -899,7 +1109,7 @@ func performSync(ctx context.Context, w http.ResponseWriter, r *http.Request, db
     }
     // run.command
     runCmdLower := ""
-    if dataRC, errRC := ppFetchFile(ctx, serverID, "run.command"); errRC == nil {
+    if dataRC, errRC := srv.FetchFile(ctx, serverID, "run.command"); errRC == nil {
         runCmdLower = strings.ToLower(string(dataRC))
     }
     // Combine haystack
@@ -1024,7 +1234,7 @@ func performSync(ctx context.Context, w http.ResponseWriter, r *http.Request, db
     }
     // Try to detect game version from PufferPanel server definition/data; best-effort.
     var detectedKey, detectedVal string
-    if def, err1 := ppGetServerDefinition(ctx, serverID); err1 == nil {
+    if def, err1 := serverDefinition(ctx, inst, serverID); err1 == nil {
         if data, err2 := ppGetServerData(ctx, serverID); err2 == nil {
             if k, v, ok := detectGameVersion(def, data); ok {
                 detectedKey, detectedVal = k, v
@@ -1120,18 +1330,14 @@ func performSync(ctx context.Context, w http.ResponseWriter, r *http.Request, db
         httpx.Write(w, r, httpx.LoaderRequired())
         return
     }
-    folder := "mods/"
-	switch inst.Loader {
-	case "paper", "spigot":
-		folder = "plugins/"
-	}
+    folder := instanceModFolder(inst)
 	var files []string
 	if len(only) > 0 {
 		files = append([]string(nil), only...)
 	} else {
-		entries, err := ppListPath(ctx, serverID, folder)
+		entries, err := srv.ListPath(ctx, serverID, folder)
 		if err != nil {
-			if errors.Is(err, pppkg.ErrNotFound) {
+			if errors.Is(err, backend.ErrNotFound) {
 				msg := strings.TrimSuffix(folder, "/") + " folder missing"
 				httpx.Write(w, r, httpx.NotFound(msg))
 				return
@@ -1175,243 +1381,64 @@ func performSync(ctx context.Context, w http.ResponseWriter, r *http.Request, db
     }
 	unmatched := make([]string, 0, len(files))
 
+    // Fetch each jar once and identify it by content through the registered
+    // sources; name heuristics only run for jars no source knows.
+    // Each jar is also scanned for malware and cached while its content is
+    // at hand.
+    jars := make(map[string]*jarInfo, len(files))
+    findings := make(map[string][]scan.Finding, len(files))
+    fileMods := make(map[string]int, len(files))
     for _, f := range files {
         if ctx.Err() != nil {
             return
         }
-        meta := parseJarFilename(f)
-        slug, ver := meta.Slug, meta.Version
-        detectedLoader := ""
-        // Prefer metadata in jar over filename when available
-        if data, err := ppFetchFile(ctx, serverID, folder+f); err == nil {
-            if s2, v2, l2 := parseJarMetadata(data); s2 != "" || v2 != "" || l2 != "" {
-                if s2 != "" { slug = s2 }
-                if v2 != "" { ver = v2 }
-                if ml := mapLoader(l2); ml != "" { detectedLoader = ml }
-            }
+        if data, err := srv.FetchFile(ctx, serverID, folder+f); err == nil {
+            j := newJarInfo(data)
+            jars[f] = j
+            findings[f] = jarScanner.Scan(data)
+            cacheJar(data, map[string]string{"sha1": j.sha1, "sha256": j.sha256})
         }
-        // Build candidate alias key
-        base := strings.TrimSuffix(strings.ToLower(f), ".jar")
-        cand := meta.Slug
-        if cand == "" { cand = base }
-        cand = normalizeCandidate(cand)
-        // Check alias map first to avoid repeated searches
-        if cand != "" {
-            if mapped, ok, _ := dbpkg.GetAlias(db, inst.ID, cand); ok && mapped != "" {
-                slug = mapped
-            }
-        }
-        scanned := false
-        if slug == "" || ver == "" {
-            scanned = true
-            time.Sleep(100 * time.Millisecond)
-            data, err := ppFetchFile(ctx, serverID, folder+f)
-            if err == nil {
-                s2, v2, l2 := parseJarMetadata(data)
-                if s2 != "" { slug = s2 }
-                if v2 != "" { ver = v2 }
-                if ml := mapLoader(l2); ml != "" { detectedLoader = ml }
-            }
+    }
+    ids := identifyJars(ctx, jars)
+
+    for _, f := range files {
+        if ctx.Err() != nil {
+            return
         }
-               if slug == "" || ver == "" {
-                        unmatched = append(unmatched, f)
-                        prog.fail(f, errors.New("missing slug or version"))
-                        log.Debug().
-                            Int("instance_id", inst.ID).
-                            Str("server_id", serverID).
-                            Str("file", f).
-                            Bool("deep_scanned", scanned).
-                            Msg("modrinth match failed: missing slug or version")
-                        if slug != "" {
-                                _ = dbpkg.SetModSyncState(db, inst.ID, slug, ver, JobFailed)
-                        }
-                        continue
-               }
-               // Resolve canonical slug and remember alias on success
-               proj, slug, err := modClient.Resolve(ctx, slug)
-               if err != nil && !scanned {
-                    time.Sleep(100 * time.Millisecond)
-                    data, err2 := ppFetchFile(ctx, serverID, folder+f)
-                    if err2 == nil {
-                        s2, v2, l2 := parseJarMetadata(data)
-                        if s2 != "" { slug = s2 }
-                        if v2 != "" { ver = v2 }
-                        if ml := mapLoader(l2); ml != "" { detectedLoader = ml }
-                        proj, slug, err = modClient.Resolve(ctx, slug)
-                    }
+        match := ids[f]
+        if match == nil {
+            nm, err := matchJarByName(ctx, db, inst, serverID, f, jars[f])
+            if err != nil {
+                if ctx.Err() != nil {
+                    return
                 }
-               if err != nil {
-                        if ctx.Err() != nil {
-                                return
-                        }
-                        unmatched = append(unmatched, f)
-                        prog.fail(f, err)
-                        log.Debug().
-                            Int("instance_id", inst.ID).
-                            Str("server_id", serverID).
-                            Str("file", f).
-                            Str("slug", slug).
-                            Str("version", ver).
-                            Err(err).
-                            Msg("modrinth resolve failed")
-                        _ = dbpkg.SetModSyncState(db, inst.ID, slug, ver, JobFailed)
-                        continue
-               }
-               // Remember alias mapping for future runs
-               if cand != "" && slug != "" { _ = dbpkg.SetAlias(db, inst.ID, cand, slug) }
-        versions, err := modClient.Versions(ctx, slug, "", "")
-        if err != nil {
-            if ctx.Err() != nil {
-                return
+                unmatched = append(unmatched, f)
+                prog.fail(f, err)
+                if nm.slug != "" {
+                    _ = dbpkg.SetModSyncState(db, inst.ID, nm.slug, nm.ver, JobFailed)
+                }
+                continue
             }
-            unmatched = append(unmatched, f)
-            prog.fail(f, err)
-            log.Debug().
-                Int("instance_id", inst.ID).
-                Str("server_id", serverID).
-                Str("file", f).
-                Str("slug", slug).
-                Str("version", ver).
-                Err(err).
-                Msg("modrinth versions fetch failed")
-            _ = dbpkg.SetModSyncState(db, inst.ID, slug, ver, JobFailed)
-            continue
+            match = nm
         }
-        var v mr.Version
-        found := false
-        // First try normalized exact version match
-        verNorm := normalizeVersion(ver)
-        for _, vv := range versions {
-            if normalizeVersion(vv.VersionNumber) == verNorm {
-                v = vv
-                found = true
-                break
-            }
+        proj, slug, ver, v, detectedLoader := match.proj, match.slug, match.ver, match.version, match.loader
+        modURL := match.url
+        if modURL == "" {
+            modURL = sourceModURL(match.source, slug)
         }
-               if !found {
-                        // Attempt: deep scan if not already done
-                        if !scanned {
-                            time.Sleep(100 * time.Millisecond)
-                            if data, err2 := pppkg.FetchFile(ctx, serverID, folder+f); err2 == nil {
-                                if s2, v2, l2 := parseJarMetadata(data); s2 != "" || v2 != "" || l2 != "" {
-                                    if s2 != "" { slug = s2 }
-                                    if v2 != "" { ver = v2 }
-                                    if l2 != "" { detectedLoader = l2 }
-                                    if proj2, slug2, err2 := modClient.Resolve(ctx, slug); err2 == nil {
-                                        proj = proj2
-                                        slug = slug2
-                                        if vers2, err3 := modClient.Versions(ctx, slug, "", ""); err3 == nil {
-                                            verNorm = normalizeVersion(ver)
-                                            for _, vv := range vers2 {
-                                                if normalizeVersion(vv.VersionNumber) == verNorm { v = vv; found = true; break }
-                                            }
-                                        }
-                                    }
-                                }
-                            }
-                        }
-                        // Fallback: search by normalized filename and try hits
-                        if !found {
-                            query := meta.Slug
-                            if strings.TrimSpace(query) == "" { query = strings.TrimSuffix(f, ".jar") }
-                            query = normalizeCandidate(query)
-                            if res, errS := modClient.Search(ctx, query); errS == nil && len(res.Hits) > 0 {
-                                tried := 0
-                                for _, hit := range res.Hits {
-                                    tried++
-                                    if tried > 10 { break }
-                                    if vers3, errV := modClient.Versions(ctx, hit.Slug, "", ""); errV == nil {
-                                        // First try normalized exact
-                                        for _, vv := range vers3 {
-                                            if normalizeVersion(vv.VersionNumber) == verNorm {
-                                                if proj3, errP := modClient.Project(ctx, hit.Slug); errP == nil {
-                                                    proj = proj3
-                                                    slug = hit.Slug
-                                                    if cand != "" { _ = dbpkg.SetAlias(db, inst.ID, cand, slug) }
-                                                    v = vv
-                                                    found = true
-                                                }
-                                                break
-                                            }
-                                        }
-                                        // Then heuristic newest with filename similarity and loader
-                                        if !found {
-                                            var best mr.Version
-                                            var bestTime time.Time
-                                            nameTokens := tokenizeFilename(f)
-                                            // Build candidates prioritizing instance loader, then filename loader, then detected loader
-                                            preferred := mapLoader(inst.Loader)
-                                            fileHint := mapLoader(meta.Loader)
-                                            candidates := vers3
-                                            // Helper to filter by a specific loader id
-                                            filterBy := func(list []mr.Version, want string) []mr.Version {
-                                                if strings.TrimSpace(want) == "" { return nil }
-                                                out := make([]mr.Version, 0, len(list))
-                                                for _, x := range list {
-                                                    if len(x.Loaders) == 0 { out = append(out, x); continue }
-                                                    okL := false
-                                                    for _, ld := range x.Loaders { if mapLoader(ld) == want { okL = true; break } }
-                                                    if okL { out = append(out, x) }
-                                                }
-                                                return out
-                                            }
-                                            if pl := strings.TrimSpace(preferred); pl != "" {
-                                                if flt := filterBy(candidates, pl); len(flt) > 0 { candidates = flt }
-                                            }
-                                            if candidates == nil || len(candidates) == 0 {
-                                                if fl := strings.TrimSpace(fileHint); fl != "" {
-                                                    if flt := filterBy(vers3, fl); len(flt) > 0 { candidates = flt }
-                                                }
-                                            }
-                                            if (candidates == nil || len(candidates) == 0) && strings.TrimSpace(detectedLoader) != "" {
-                                                if flt := filterBy(vers3, detectedLoader); len(flt) > 0 { candidates = flt }
-                                            }
-                                            if candidates == nil || len(candidates) == 0 { candidates = vers3 }
-                                            for _, vv := range candidates {
-                                                sim := 0.0
-                                                if len(vv.Files) > 0 {
-                                                    b := basenameFromURL(vv.Files[0].URL)
-                                                    sim = jaccard(nameTokens, tokenizeFilename(b))
-                                                }
-                                                if sim < 0.3 { continue }
-                                                if vv.DatePublished.After(bestTime) { best = vv; bestTime = vv.DatePublished }
-                                            }
-                                            if best.ID != "" {
-                                                if proj3, errP := modClient.Project(ctx, hit.Slug); errP == nil {
-                                                    proj = proj3
-                                                    slug = hit.Slug
-                                                    if cand != "" { _ = dbpkg.SetAlias(db, inst.ID, cand, slug) }
-                                                    v = best
-                                                    found = true
-                                                }
-                                            }
-                                        }
-                                    }
-                                    if found { break }
-                                }
-                            }
-                        }
-                        if !found {
-                            unmatched = append(unmatched, f)
-                            prog.fail(f, fmt.Errorf("version %s not found", ver))
-                            log.Debug().
-                                Int("instance_id", inst.ID).
-                                Str("server_id", serverID).
-                                Str("file", f).
-                                Str("slug", slug).
-                                Str("version", ver).
-                                Msg("modrinth match failed: version not found")
-                            _ = dbpkg.SetModSyncState(db, inst.ID, slug, ver, JobFailed)
-                            continue
-                        }
-               }
         m := dbpkg.Mod{
             Name:           proj.Title,
             IconURL:        proj.IconURL,
-            URL:            fmt.Sprintf("https://modrinth.com/mod/%s", slug),
+            URL:            modURL,
             InstanceID:     inst.ID,
             Channel:        strings.ToLower(v.VersionType),
             CurrentVersion: v.VersionNumber,
+            MatchMethod:    match.method,
+            Source:         match.source,
+            ClientSide:     proj.ClientSide,
+            ServerSide:     proj.ServerSide,
+            ProjectID:      v.ProjectID,
+            VersionID:      v.ID,
         }
 		if len(v.GameVersions) > 0 {
 			m.GameVersion = v.GameVersions[0]
@@ -1446,7 +1473,7 @@ func performSync(ctx context.Context, w http.ResponseWriter, r *http.Request, db
                if prev, ok := existingByURL[key]; ok {
                         // Update fields if changed to reflect current scan
                         m.ID = prev.ID
-                        if prev.Name != m.Name || prev.IconURL != m.IconURL || prev.GameVersion != m.GameVersion || prev.Loader != m.Loader || prev.Channel != m.Channel || prev.CurrentVersion != m.CurrentVersion || prev.AvailableVersion != m.AvailableVersion || prev.AvailableChannel != m.AvailableChannel || prev.DownloadURL != m.DownloadURL {
+                        if prev.Name != m.Name || prev.IconURL != m.IconURL || prev.GameVersion != m.GameVersion || prev.Loader != m.Loader || prev.Channel != m.Channel || prev.CurrentVersion != m.CurrentVersion || prev.AvailableVersion != m.AvailableVersion || prev.AvailableChannel != m.AvailableChannel || prev.DownloadURL != m.DownloadURL || prev.MatchMethod != m.MatchMethod || (m.ClientSide != "" && prev.ClientSide != m.ClientSide) || (m.ServerSide != "" && prev.ServerSide != m.ServerSide) || (m.VersionID != "" && prev.VersionID != m.VersionID) {
                                 if err := dbpkg.UpdateMod(db, &m); err != nil {
                                         if ctx.Err() != nil {
                                                 return
@@ -1471,6 +1498,7 @@ func performSync(ctx context.Context, w http.ResponseWriter, r *http.Request, db
                                     Msg("updated mod for instance")
                         }
                         matched = append(matched, m)
+                        fileMods[f] = m.ID
                         prog.success()
                         _ = dbpkg.SetModSyncState(db, inst.ID, slug, ver, JobSucceeded)
                         continue
@@ -1499,33 +1527,33 @@ func performSync(ctx context.Context, w http.ResponseWriter, r *http.Request, db
                     Str("loader", m.Loader).
                     Msg("added mod to instance")
                matched = append(matched, m)
+               fileMods[f] = m.ID
                prog.success()
                _ = dbpkg.SetModSyncState(db, inst.ID, slug, ver, JobSucceeded)
     }
+    // Store scan results and content hashes by file, linked to the mod each
+    // jar matched
+    for _, f := range files {
+        j := jars[f]
+        if j == nil {
+            continue
+        }
+        var modID *int
+        if id, ok := fileMods[f]; ok {
+            modID = &id
+            _ = dbpkg.SetModContentHash(db, id, j.sha512)
+        }
+        recordJarScan(db, inst.ID, modID, f, j.sha256, findings[f])
+    }
+    _ = dbpkg.PruneJarScans(db, inst.ID, files)
+    gcBlobCache(db)
     // Build a quick set of existing jar filenames for presence checks
     fileSet := make(map[string]struct{}, len(files))
     for _, name := range files { fileSet[strings.ToLower(name)] = struct{}{} }
     // Delete mods from DB that have no corresponding jar on the server
     for _, em := range existingMods {
-        // Candidates: basename of download_url, or slug-currentVersion.jar
-        candidates := []string{}
-        if u, err := urlpkg.Parse(em.DownloadURL); err == nil {
-            if p := u.Path; p != "" {
-                if i := strings.LastIndex(p, "/"); i != -1 && i+1 < len(p) {
-                    if nm := p[i+1:]; nm != "" { candidates = append(candidates, strings.ToLower(nm)) }
-                }
-            }
-        }
-        if slug, err := parseModrinthSlug(em.URL); err == nil {
-            base := strings.TrimSpace(slug)
-            if base == "" { base = strings.TrimSpace(em.Name) }
-            if base == "" { base = "mod" }
-            ver := strings.TrimSpace(em.CurrentVersion)
-            if ver == "" { ver = "latest" }
-            candidates = append(candidates, strings.ToLower(base+"-"+ver+".jar"))
-        }
         present := false
-        for _, c := range candidates {
+        for _, c := range modFileCandidates(&em) {
             if _, ok := fileSet[c]; ok { present = true; break }
         }
         if !present {
@@ -1553,6 +1581,28 @@ func performSync(ctx context.Context, w http.ResponseWriter, r *http.Request, db
     }{*inst2, unmatched, currentMods})
 }
 
+// modFileCandidates returns the lower-cased jar names a tracked mod may be
+// installed under: the basename of its download URL, or slug-version.jar.
+func modFileCandidates(em *dbpkg.Mod) []string {
+    candidates := []string{}
+    if u, err := urlpkg.Parse(em.DownloadURL); err == nil {
+        if p := u.Path; p != "" {
+            if i := strings.LastIndex(p, "/"); i != -1 && i+1 < len(p) {
+                if nm := p[i+1:]; nm != "" { candidates = append(candidates, strings.ToLower(nm)) }
+            }
+        }
+    }
+    if slug, err := modSlug(em); err == nil {
+        base := strings.TrimSpace(slug)
+        if base == "" { base = strings.TrimSpace(em.Name) }
+        if base == "" { base = "mod" }
+        ver := strings.TrimSpace(em.CurrentVersion)
+        if ver == "" { ver = "latest" }
+        candidates = append(candidates, strings.ToLower(base+"-"+ver+".jar"))
+    }
+    return candidates
+}
+
 func dashboardHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		stats, err := dbpkg.GetDashboardStats(db)
@@ -1561,14 +1611,18 @@ func dashboardHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 		resp := struct {
-			Tracked      int               `json:"tracked"`
-			UpToDate     int               `json:"up_to_date"`
-			Outdated     int               `json:"outdated"`
-			OutdatedMods []dbpkg.Mod       `json:"outdated_mods"`
-			Recent       []dbpkg.ModUpdate `json:"recent_updates"`
-			LastSync     int64             `json:"last_sync"`
-			LatencyP50   int64             `json:"latency_p50"`
-			LatencyP95   int64             `json:"latency_p95"`
+			Tracked      int                   `json:"tracked"`
+			UpToDate     int                   `json:"up_to_date"`
+			Outdated     int                   `json:"outdated"`
+			OutdatedMods []dbpkg.Mod           `json:"outdated_mods"`
+			Recent       []dbpkg.ModUpdate     `json:"recent_updates"`
+			LastSync     int64                 `json:"last_sync"`
+			LatencyP50   int64                 `json:"latency_p50"`
+			LatencyP95   int64                 `json:"latency_p95"`
+			Cache        *artifacts.CacheStats `json:"artifact_cache,omitempty"`
+			UpdateCheck  *dbpkg.UpdateCheckRun `json:"last_update_check,omitempty"`
+			Budget       mr.Budget             `json:"modrinth_budget"`
+			Offline      *mr.MirrorManifest    `json:"modrinth_mirror,omitempty"`
 		}{
 			Tracked:      stats.Tracked,
 			UpToDate:     stats.UpToDate,
@@ -1578,6 +1632,10 @@ func dashboardHandler(db *sql.DB) http.HandlerFunc {
 			LastSync:     lastSync.Load(),
 			LatencyP50:   latencyP50.Load(),
 			LatencyP95:   latencyP95.Load(),
+			Cache:        blobCacheStats(),
+			UpdateCheck:  lastUpdateCheck(db),
+			Budget:       modClient.Budget(),
+			Offline:      offlineManifest(),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp)
@@ -1621,29 +1679,6 @@ func serveStatic(static fs.FS) http.HandlerFunc {
 	}
 }
 
-// CheckUpdates refreshes available versions for stored mods.
-func CheckUpdates(ctx context.Context, db *sql.DB) {
-	mods, err := dbpkg.ListAllMods(db)
-	if err != nil {
-		log.Error().Err(err).Msg("list mods")
-		return
-	}
-	for _, m := range mods {
-		slug, err := parseModrinthSlug(m.URL)
-		if err != nil {
-			continue
-		}
-		if err := populateAvailableVersion(ctx, &m, slug); err != nil {
-			continue
-		}
-		_, err = db.Exec(`UPDATE mods SET available_version=?, available_channel=?, download_url=? WHERE id=?`, m.AvailableVersion, m.AvailableChannel, m.DownloadURL, m.ID)
-		if err != nil {
-			log.Error().Err(err).Msg("update version")
-		}
-	}
-	lastSync.Store(time.Now().Unix())
-}
-
 type modMetadata struct {
     GameVersions []string   `json:"game_versions"`
     Loaders      []string   `json:"loaders"`
@@ -1739,11 +1774,11 @@ type uiVersion struct {
 }
 
 func fetchModMetadata(ctx context.Context, rawURL string) (*modMetadata, error) {
-	slug, err := parseModrinthSlug(rawURL)
-	if err != nil {
-		return nil, err
+	src, slug, ok := sourceForURL(rawURL)
+	if !ok {
+		return nil, errors.New("unsupported mod URL")
 	}
-    versions, err := modClient.Versions(ctx, slug, "", "")
+    versions, err := src.Versions(ctx, slug, "", "")
     if err != nil {
         return nil, err
     }
@@ -1795,264 +1830,6 @@ func fetchModMetadata(ctx context.Context, rawURL string) (*modMetadata, error)
 	return meta, nil
 }
 
-func populateProjectInfo(ctx context.Context, m *dbpkg.Mod, slug string) error {
-	info, err := modClient.Project(ctx, slug)
-	if err != nil {
-		return err
-	}
-	m.Name = info.Title
-	m.IconURL = info.IconURL
-	return nil
-}
-
-func populateVersions(ctx context.Context, m *dbpkg.Mod, slug string) error {
-	versions, err := guardedVersions(ctx, slug, m.GameVersion, m.Loader)
-	if err != nil {
-		return err
-	}
-	var current mr.Version
-	found := false
-	for _, v := range versions {
-		if strings.EqualFold(v.VersionType, m.Channel) {
-			current = v
-			found = true
-			break
-		}
-	}
-	if !found {
-		return errors.New("no version found for channel")
-	}
-	m.CurrentVersion = current.VersionNumber
-	if len(current.Files) > 0 {
-		m.DownloadURL = current.Files[0].URL
-	}
-	if err := populateAvailableVersion(ctx, m, slug); err != nil {
-		return err
-	}
-	return nil
-}
-
-func populateAvailableVersion(ctx context.Context, m *dbpkg.Mod, slug string) error {
-	versions, err := guardedVersions(ctx, slug, m.GameVersion, m.Loader)
-	if err != nil {
-		return err
-	}
-	order := []string{"release", "beta", "alpha"}
-	idx := map[string]int{"release": 0, "beta": 1, "alpha": 2}
-	start := idx[strings.ToLower(m.Channel)]
-	for i := 0; i <= start; i++ {
-		ch := order[i]
-		for _, v := range versions {
-			if strings.EqualFold(v.VersionType, ch) {
-				m.AvailableVersion = v.VersionNumber
-				m.AvailableChannel = ch
-				if len(v.Files) > 0 {
-					m.DownloadURL = v.Files[0].URL
-				}
-				return nil
-			}
-		}
-	}
-	m.AvailableVersion = m.CurrentVersion
-	m.AvailableChannel = m.Channel
-	return nil
-}
-
-func parseModrinthSlug(raw string) (string, error) {
-	u, err := urlpkg.Parse(raw)
-	if err != nil {
-		return "", err
-	}
-	parts := strings.Split(u.Path, "/")
-	for i, p := range parts {
-		if p == "mod" || p == "plugin" || p == "datapack" || p == "resourcepack" {
-			if i+1 < len(parts) {
-				return parts[i+1], nil
-			}
-		}
-	}
-	return "", errors.New("slug not found")
-}
-
-type jarMeta struct {
-	Slug      string
-	ID        string
-	Version   string
-	MCVersion string
-	Loader    string
-	Channel   string
-}
-
-func parseJarFilename(name string) jarMeta {
-	var meta jarMeta
-	name = strings.TrimSuffix(strings.ToLower(name), ".jar")
-	rep := strings.NewReplacer("[", "", "]", "", "(", "", ")", "", "{", "", "}", "", "#", "")
-	name = rep.Replace(name)
-	parts := strings.FieldsFunc(name, func(r rune) bool {
-		return r == '-' || r == '_' || r == '+'
-	})
-	if len(parts) == 0 {
-		return meta
-	}
-	semver := regexp.MustCompile(`^v?\d+(?:\.\d+){1,3}[^a-zA-Z]*$`)
-	mcver := regexp.MustCompile(`^1\.\d+(?:\.\d+)?$`)
-	loaders := map[string]struct{}{"fabric": {}, "forge": {}, "quilt": {}, "neoforge": {}}
-	channels := map[string]struct{}{"beta": {}, "alpha": {}, "rc": {}}
-
-	type sv struct {
-		idx int
-		val string
-	}
-	semvers := []sv{}
-	for i, p := range parts {
-		if strings.HasPrefix(p, "mc") {
-			v := strings.TrimPrefix(p, "mc")
-			if mcver.MatchString(v) && meta.MCVersion == "" {
-				meta.MCVersion = v
-				continue
-			}
-		}
-		if semver.MatchString(p) {
-			semvers = append(semvers, sv{i, strings.TrimPrefix(p, "v")})
-			continue
-		}
-		if _, ok := loaders[p]; ok {
-			meta.Loader = p
-			continue
-		}
-		if _, ok := channels[p]; ok {
-			meta.Channel = p
-			continue
-		}
-	}
-	verIdx := -1
-	if len(semvers) > 0 {
-		last := semvers[len(semvers)-1]
-		verIdx = last.idx
-		meta.Version = last.val
-		if len(semvers) > 1 {
-			prev := semvers[len(semvers)-2]
-			if mcver.MatchString(last.val) && !mcver.MatchString(prev.val) {
-				meta.Version = prev.val
-				verIdx = prev.idx
-				meta.MCVersion = last.val
-			} else if meta.MCVersion == "" {
-				for _, sv := range semvers[:len(semvers)-1] {
-					if mcver.MatchString(sv.val) {
-						meta.MCVersion = sv.val
-						break
-					}
-				}
-			}
-		}
-	}
-
-	for i, p := range parts {
-		if verIdx != -1 && i >= verIdx {
-			break
-		}
-		if _, ok := loaders[p]; ok && i > 0 {
-			continue
-		}
-		if strings.HasPrefix(p, "mc") {
-			v := strings.TrimPrefix(p, "mc")
-			if mcver.MatchString(v) {
-				continue
-			}
-		}
-		if mcver.MatchString(p) {
-			continue
-		}
-		if _, ok := channels[p]; ok && i > 0 {
-			continue
-		}
-		meta.Slug += p + "-"
-	}
-	meta.Slug = strings.Trim(meta.Slug, "-")
-	if meta.Slug != "" {
-		parts := strings.Split(meta.Slug, "-")
-		if len(parts) > 0 {
-			meta.ID = parts[0]
-		}
-	}
-	return meta
-}
-
-// normalizeCandidate prepares a filename-derived candidate string for lookup
-// - lowercases
-// - replaces spaces/underscores with dashes
-// - drops brackets and parentheses
-func normalizeCandidate(s string) string {
-    s = strings.ToLower(strings.TrimSpace(s))
-    repl := strings.NewReplacer("[", "", "]", "", "(", "", ")", "")
-    s = repl.Replace(s)
-    s = strings.ReplaceAll(s, " ", "-")
-    s = strings.ReplaceAll(s, "_", "-")
-    s = strings.Trim(s, "-")
-    return s
-}
-
-// normalizeVersion trims and simplifies version strings for matching.
-// - lowercase
-// - trim leading 'v'
-// - drop build metadata (+...)
-// - strip MC version suffixes like -1.21.5
-// - remove loader suffixes like -fabric, -neoforge, -forge, -quilt, -paper, -spigot, -bukkit
-// - collapse -b- tags (e.g., -b123)
-func normalizeVersion(s string) string {
-    s = strings.ToLower(strings.TrimSpace(s))
-    s = strings.TrimPrefix(s, "v")
-    if i := strings.Index(s, "+"); i >= 0 {
-        s = s[:i]
-    }
-    // strip mc version suffix like -1.21.5 or _1.20
-    reMC := regexp.MustCompile(`[-_](?:1\.\d+(?:\.\d+)?)$`)
-    s = reMC.ReplaceAllString(s, "")
-    // remove loader suffixes at end
-    reLoader := regexp.MustCompile(`[-_](fabric|neoforge|forge|quilt|paper|spigot|bukkit)$`)
-    s = reLoader.ReplaceAllString(s, "")
-    // collapse -b- build tags
-    reB := regexp.MustCompile(`[-_]?b\d+`)
-    s = reB.ReplaceAllString(s, "")
-    s = strings.Trim(s, "-_")
-    return s
-}
-
-func basenameFromURL(u string) string {
-    if u == "" { return "" }
-    if parsed, err := urlpkg.Parse(u); err == nil {
-        p := parsed.Path
-        if i := strings.LastIndex(p, "/"); i >= 0 && i+1 < len(p) {
-            return p[i+1:]
-        }
-        return p
-    }
-    return u
-}
-
-func tokenizeFilename(name string) map[string]struct{} {
-    name = strings.ToLower(name)
-    re := regexp.MustCompile(`[^a-z0-9]+`)
-    parts := re.Split(name, -1)
-    set := make(map[string]struct{}, len(parts))
-    for _, p := range parts {
-        p = strings.TrimSpace(p)
-        if len(p) == 0 { continue }
-        set[p] = struct{}{}
-    }
-    return set
-}
-
-func jaccard(a, b map[string]struct{}) float64 {
-    if len(a) == 0 || len(b) == 0 { return 0 }
-    inter := 0
-    union := len(a)
-    for t := range b { if _, ok := a[t]; ok { inter++ } else { union++ } }
-    if union == 0 { return 0 }
-    return float64(inter) / float64(union)
-}
-
-
 func New(db *sql.DB, dist fs.FS, svc *secrets.Service) http.Handler {
     r := chi.NewRouter()
 
@@ -2063,6 +1840,7 @@ func New(db *sql.DB, dist fs.FS, svc *secrets.Service) http.Handler {
 
 	r.Get("/favicon.ico", serveFavicon(dist))
 	r.Get("/api/meta/modrinth/loaders", modrinthLoadersHandler(db))
+	r.Get("/api/meta/modrinth/budget", modrinthBudgetHandler())
 	r.Get("/api/instances", listInstancesHandler(db))
 	r.Get("/api/instances/{id}", getInstanceHandler(db))
     r.With(requireAuth()).Get("/api/instances/{id:\\d+}/logs", listInstanceLogsHandler(db))
@@ -2071,8 +1849,29 @@ func New(db *sql.DB, dist fs.FS, svc *secrets.Service) http.Handler {
 	r.Put("/api/instances/{id}", updateInstanceHandler(db))
 	r.Delete("/api/instances/{id}", deleteInstanceHandler(db))
 	r.With(requireAuth()).Post("/api/instances/sync", listServersHandler(db))
+	r.With(requireAuth()).Post("/api/instances/import/mrpack", importMrpackHandler(db))
+	r.With(requireAuth()).Get("/api/instances/{id:\\d+}/export.mrpack", exportMrpackHandler(db))
+	r.With(requireAuth()).Post("/api/instances/{id:\\d+}/packwiz/import", importPackwizHandler(db))
+	r.With(requireAuth()).Get("/api/instances/{id:\\d+}/packwiz/export", exportPackwizHandler(db))
+	r.With(requireAuth()).Post("/api/instances/{id:\\d+}/packwiz/reconcile", reconcilePackwizHandler(db))
 	r.With(requireAuth()).Post("/api/instances/{id:\\d+}/sync", syncHandler(db))
 	r.With(requireAuth()).Get("/api/instances/{id:\\d+}/sync", methodNotAllowed)
+	r.With(requireAuth()).Post("/api/instances/{id:\\d+}/updates/plan", planUpdatesHandler(db))
+	r.With(requireAuth()).Post("/api/instances/{id:\\d+}/updates/apply", applyUpdatesHandler(db))
+	r.With(requireAuth()).Post("/api/instances/{id:\\d+}/manifest/plan", planManifestHandler(db))
+	r.With(requireAuth()).Post("/api/instances/{id:\\d+}/manifest/apply", applyManifestHandler(db))
+	r.With(requireAuth()).Get("/api/instances/{id:\\d+}/updates/batches/{batch:\\d+}", getUpdateBatchHandler(db))
+	r.With(requireAuth()).Get("/api/instances/{id:\\d+}/updates/batches/{batch:\\d+}/events", updateBatchEventsHandler(db))
+	r.With(requireAuth()).Get("/api/instances/{id:\\d+}/policy", getInstancePolicyHandler(db))
+	r.With(requireAuth()).Put("/api/instances/{id:\\d+}/policy", setInstancePolicyHandler(db))
+	r.With(requireAuth()).Get("/api/instances/{id:\\d+}/maintenance-window", getMaintenanceWindowHandler(db))
+	r.With(requireAuth()).Put("/api/instances/{id:\\d+}/maintenance-window", setMaintenanceWindowHandler(db))
+	r.With(requireAuth()).Delete("/api/instances/{id:\\d+}/maintenance-window", deleteMaintenanceWindowHandler(db))
+	r.With(requireAuth()).Get("/api/instances/{id:\\d+}/drift-check", getDriftCheckHandler(db))
+	r.With(requireAuth()).Put("/api/instances/{id:\\d+}/drift-check", setDriftCheckHandler(db))
+	r.With(requireAuth()).Delete("/api/instances/{id:\\d+}/drift-check", deleteDriftCheckHandler(db))
+	r.With(requireAuth()).Post("/api/instances/{id:\\d+}/drift-check/run", runDriftCheckHandler(db))
+	r.With(requireAuth()).Get("/api/instances/{id:\\d+}/scan", instanceScanHandler(db))
 	r.With(requireAuth()).Get("/api/jobs/{id:\\d+}", jobProgressHandler(db))
 	r.With(requireAuth()).Get("/api/jobs/{id:\\d+}/events", jobEventsHandler(db))
 	r.With(requireAuth()).Post("/api/jobs/{id:\\d+}/retry", retryFailedHandler(db))
@@ -2089,12 +1888,20 @@ func New(db *sql.DB, dist fs.FS, svc *secrets.Service) http.Handler {
     r.Post("/api/mods/metadata", metadataHandler())
     r.Get("/api/mods/search", searchModsHandler())
     r.Post("/api/mods", createModHandler(db))
+    r.Post("/api/mods/dependencies", modDependenciesHandler(db))
 	r.Get("/api/mods/{id}/check", checkModHandler(db))
 	r.Put("/api/mods/{id}", updateModHandler(db))
 	r.Delete("/api/mods/{id}", deleteModHandler(db))
 	r.Post("/api/mods/{id}/update", enqueueModUpdateHandler(db))
+	r.Post("/api/mods/{id}/rollback", rollbackModHandler(db))
+	r.With(requireAuth()).Get("/api/mods/{id:\\d+}/policy", getModPolicyHandler(db))
+	r.With(requireAuth()).Put("/api/mods/{id:\\d+}/policy", setModPolicyHandler(db))
+	r.With(requireAuth()).Delete("/api/mods/{id:\\d+}/policy", deleteModPolicyHandler(db))
 
 	r.With(requireAdmin()).Post("/api/pufferpanel/test", testPufferHandler())
+	r.With(requireAdmin()).Get("/api/pufferpanel/connections", listConnectionsHandler())
+	r.With(requireAdmin()).Get("/api/admin/modrinth-cache", modrinthCacheHandler(db))
+	r.With(requireAdmin()).Delete("/api/admin/modrinth-cache", purgeModrinthCacheHandler(db))
 
 	r.Group(func(g chi.Router) {
 		g.Use(requireAdmin())
@@ -2102,6 +1909,8 @@ func New(db *sql.DB, dist fs.FS, svc *secrets.Service) http.Handler {
 		g.Post("/api/settings/secret/{type}", setSecretHandler())
 		g.Delete("/api/settings/secret/{type}", deleteSecretHandler())
 		g.Get("/api/settings/secret/{type}/status", secretStatusHandler(svc))
+		g.Put("/api/pufferpanel/connections/{conn}", setConnectionHandler())
+		g.Delete("/api/pufferpanel/connections/{conn}", deleteConnectionHandler(db))
 	})
 	r.Get("/api/dashboard", dashboardHandler(db))
 
@@ -109,6 +109,43 @@ func (fakeModClient) Search(ctx context.Context, query string) (*mr.SearchResult
     }{{ProjectID: "1", Slug: query, Title: "Fake", Description: "", IconURL: "", Downloads: 0}}}, nil
 }
 
+func (fakeModClient) Version(ctx context.Context, id string) (*mr.Version, error) {
+	return nil, &mr.Error{Status: http.StatusNotFound}
+}
+
+func (fakeModClient) VersionsByHashes(ctx context.Context, hashes []string, algorithm string) (map[string]mr.Version, error) {
+	return map[string]mr.Version{}, nil
+}
+
+func (fakeModClient) LatestVersionsByHashes(ctx context.Context, hashes []string, algorithm string, loaders, gameVersions []string) (map[string]mr.Version, error) {
+	return map[string]mr.Version{}, nil
+}
+
+func (fakeModClient) Projects(ctx context.Context, ids []string) ([]mr.Project, error) {
+	return nil, nil
+}
+
+func (fakeModClient) VersionsByIDs(ctx context.Context, ids []string) ([]mr.Version, error) {
+	return nil, nil
+}
+
+func (fakeModClient) Requests() int64 { return 0 }
+
+// fakeLoaderTags is what the fake clients report as Modrinth's loaders.
+var fakeLoaderTags = []mr.LoaderTag{
+	{Name: "fabric", SupportedProjectTypes: []string{"mod"}},
+	{Name: "forge", SupportedProjectTypes: []string{"mod"}},
+	{Name: "neoforge", SupportedProjectTypes: []string{"mod"}},
+	{Name: "quilt", SupportedProjectTypes: []string{"mod"}},
+	{Name: "paper", SupportedProjectTypes: []string{"plugin"}},
+}
+
+func (fakeModClient) Budget() mr.Budget { return mr.Budget{} }
+
+func (fakeModClient) Loaders(ctx context.Context) ([]mr.LoaderTag, error) {
+	return fakeLoaderTags, nil
+}
+
 func (fakeModClient) Resolve(ctx context.Context, slug string) (*mr.Project, string, error) {
 	return &mr.Project{Title: "Fake", IconURL: ""}, slug, nil
 }
@@ -130,6 +167,34 @@ func (matchClient) Versions(ctx context.Context, slug, gameVersion, loader strin
 	}}, nil
 }
 
+func (matchClient) Version(ctx context.Context, id string) (*mr.Version, error) {
+	return nil, &mr.Error{Status: http.StatusNotFound}
+}
+
+func (matchClient) VersionsByHashes(ctx context.Context, hashes []string, algorithm string) (map[string]mr.Version, error) {
+	return map[string]mr.Version{}, nil
+}
+
+func (matchClient) LatestVersionsByHashes(ctx context.Context, hashes []string, algorithm string, loaders, gameVersions []string) (map[string]mr.Version, error) {
+	return map[string]mr.Version{}, nil
+}
+
+func (matchClient) Projects(ctx context.Context, ids []string) ([]mr.Project, error) {
+	return nil, nil
+}
+
+func (matchClient) VersionsByIDs(ctx context.Context, ids []string) ([]mr.Version, error) {
+	return nil, nil
+}
+
+func (matchClient) Requests() int64 { return 0 }
+
+func (matchClient) Budget() mr.Budget { return mr.Budget{} }
+
+func (matchClient) Loaders(ctx context.Context) ([]mr.LoaderTag, error) {
+	return fakeLoaderTags, nil
+}
+
 func (matchClient) Resolve(ctx context.Context, slug string) (*mr.Project, string, error) {
 	return &mr.Project{Title: "Sodium", IconURL: ""}, "sodium", nil
 }
@@ -148,6 +213,34 @@ func (errClient) Search(ctx context.Context, query string) (*mr.SearchResult, er
 	return nil, &mr.Error{Status: http.StatusUnauthorized}
 }
 
+func (errClient) Version(ctx context.Context, id string) (*mr.Version, error) {
+	return nil, &mr.Error{Status: http.StatusUnauthorized}
+}
+
+func (errClient) VersionsByHashes(ctx context.Context, hashes []string, algorithm string) (map[string]mr.Version, error) {
+	return nil, &mr.Error{Status: http.StatusUnauthorized}
+}
+
+func (errClient) LatestVersionsByHashes(ctx context.Context, hashes []string, algorithm string, loaders, gameVersions []string) (map[string]mr.Version, error) {
+	return nil, &mr.Error{Status: http.StatusUnauthorized}
+}
+
+func (errClient) Projects(ctx context.Context, ids []string) ([]mr.Project, error) {
+	return nil, &mr.Error{Status: http.StatusUnauthorized}
+}
+
+func (errClient) VersionsByIDs(ctx context.Context, ids []string) ([]mr.Version, error) {
+	return nil, &mr.Error{Status: http.StatusUnauthorized}
+}
+
+func (errClient) Requests() int64 { return 0 }
+
+func (errClient) Budget() mr.Budget { return mr.Budget{} }
+
+func (errClient) Loaders(ctx context.Context) ([]mr.LoaderTag, error) {
+	return fakeLoaderTags, nil
+}
+
 func (errClient) Resolve(ctx context.Context, slug string) (*mr.Project, string, error) {
 	return nil, "", &mr.Error{Status: http.StatusUnauthorized}
 }
@@ -167,7 +260,7 @@ func TestCreateModHandler_EnforceLoader(t *testing.T) {
 	db := openTestDB(t)
 	defer db.Close()
 
-	inst := &dbpkg.Instance{Name: "A", Loader: "fabric", EnforceSameLoader: true}
+	inst := &dbpkg.Instance{Name: "A", Loader: "fabric"}
 	if err := dbpkg.InsertInstance(db, inst); err != nil {
 		t.Fatalf("insert instance: %v", err)
 	}
@@ -413,7 +506,7 @@ func TestInstanceNameValidation(t *testing.T) {
 		t.Fatalf("expected 400 for long name, got %d", w.Code)
 	}
 
-	inst := dbpkg.Instance{Name: "ok", Loader: "fabric", EnforceSameLoader: true}
+	inst := dbpkg.Instance{Name: "ok", Loader: "fabric"}
 	if err := dbpkg.InsertInstance(db, &inst); err != nil {
 		t.Fatalf("insert inst: %v", err)
 	}
@@ -451,7 +544,7 @@ func TestSyncHandler_ScansMods(t *testing.T) {
 	if err := pppkg.Set(pppkg.Credentials{BaseURL: srv.URL, ClientID: "id", ClientSecret: "secret"}); err != nil {
 		t.Fatalf("set creds: %v", err)
 	}
-	inst := dbpkg.Instance{Name: "Inst", Loader: "", EnforceSameLoader: true}
+	inst := dbpkg.Instance{Name: "Inst", Loader: ""}
 	if err := dbpkg.InsertInstance(db, &inst); err != nil {
 		t.Fatalf("insert inst: %v", err)
 	}
@@ -582,7 +675,7 @@ func TestCreateModHandler_WarningWithoutEnforcement(t *testing.T) {
 	db := openTestDB(t)
 	defer db.Close()
 
-	inst := &dbpkg.Instance{Name: "A", Loader: "fabric", EnforceSameLoader: false}
+	inst := &dbpkg.Instance{Name: "A", Loader: "fabric"}
 	if err := dbpkg.InsertInstance(db, inst); err != nil {
 		t.Fatalf("insert instance: %v", err)
 	}
@@ -1019,7 +1112,7 @@ func TestInstancesSyncHandler_OK(t *testing.T) {
 		t.Fatalf("set creds: %v", err)
 	}
 	// pre-insert instance to verify name preservation
-	inst := dbpkg.Instance{Name: "Old", Loader: "fabric", EnforceSameLoader: true, PufferpanelServerID: "1"}
+	inst := dbpkg.Instance{Name: "Old", Loader: "fabric", PufferpanelServerID: "1"}
 	if err := dbpkg.InsertInstance(db, &inst); err != nil {
 		t.Fatalf("insert inst: %v", err)
 	}
@@ -1756,7 +1849,7 @@ func TestUpdateInstance_LoaderValidator(t *testing.T) {
     modrinthLoadersMu.Unlock()
 
     // Insert instance
-    inst := dbpkg.Instance{Name: "ok", Loader: "", EnforceSameLoader: true}
+    inst := dbpkg.Instance{Name: "ok", Loader: ""}
     if err := dbpkg.InsertInstance(db, &inst); err != nil { t.Fatalf("insert: %v", err) }
 
     // Reject vanilla
@@ -1850,6 +1943,27 @@ func (isoClient) Versions(ctx context.Context, slug, gameVersion, loader string)
         ID: "1", VersionNumber: "1.20.1", VersionType: "release", DatePublished: time.Now(), Loaders: []string{"fabric"}, Files: []mr.VersionFile{{URL: "http://example.com/file.jar"}},
     }}, nil
 }
+func (isoClient) Version(ctx context.Context, id string) (*mr.Version, error) {
+    return nil, &mr.Error{Status: http.StatusNotFound}
+}
+func (isoClient) VersionsByHashes(ctx context.Context, hashes []string, algorithm string) (map[string]mr.Version, error) {
+    return map[string]mr.Version{}, nil
+}
+func (isoClient) LatestVersionsByHashes(ctx context.Context, hashes []string, algorithm string, loaders, gameVersions []string) (map[string]mr.Version, error) {
+    return map[string]mr.Version{}, nil
+}
+func (isoClient) Projects(ctx context.Context, ids []string) ([]mr.Project, error) {
+    return nil, nil
+}
+func (isoClient) VersionsByIDs(ctx context.Context, ids []string) ([]mr.Version, error) {
+    return nil, nil
+}
+func (isoClient) Requests() int64 { return 0 }
+func (isoClient) Budget() mr.Budget { return mr.Budget{} }
+
+func (isoClient) Loaders(ctx context.Context) ([]mr.LoaderTag, error) {
+	return fakeLoaderTags, nil
+}
 func (isoClient) Resolve(ctx context.Context, slug string) (*mr.Project, string, error) {
     switch strings.ToLower(slug) {
     case "nochatreports": return &mr.Project{Title: "NoChatReports"}, "nochatreports", nil
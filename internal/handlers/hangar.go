@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	urlpkg "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	dbpkg "modsentinel/internal/db"
+	hg "modsentinel/internal/hangar"
+	mr "modsentinel/internal/modrinth"
+)
+
+type hangarClient interface {
+	Project(ctx context.Context, slug string) (*hg.Project, error)
+	Search(ctx context.Context, query, platform string) ([]hg.Project, error)
+	Versions(ctx context.Context, slug, platform, gameVersion string) ([]hg.Version, error)
+	VersionByHash(ctx context.Context, sha256 string) (*hg.Version, error)
+}
+
+var hgClient hangarClient = hg.NewClient()
+
+// pluginMeta is what a plugin jar declares about itself in plugin.yml,
+// paper-plugin.yml, bungee.yml or velocity-plugin.json.
+type pluginMeta struct {
+	name     string
+	version  string
+	platform string
+}
+
+var (
+	pluginNameRe    = regexp.MustCompile(`(?m)^name:\s*["']?([^"'\r\n#]+?)["']?\s*$`)
+	pluginVersionRe = regexp.MustCompile(`(?m)^version:\s*["']?([^"'\r\n#]+?)["']?\s*$`)
+)
+
+// parsePluginMetadata reads a plugin jar's descriptor. Only the top-level
+// name and version keys are needed, so YAML is matched line by line.
+func parsePluginMetadata(data []byte) pluginMeta {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return pluginMeta{}
+	}
+	for _, f := range zr.File {
+		var platform string
+		switch f.Name {
+		case "paper-plugin.yml", "plugin.yml":
+			platform = hg.PlatformPaper
+		case "bungee.yml":
+			platform = hg.PlatformWaterfall
+		case "velocity-plugin.json":
+			platform = hg.PlatformVelocity
+		default:
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		meta := pluginMeta{platform: platform}
+		if platform == hg.PlatformVelocity {
+			var v struct {
+				ID      string `json:"id"`
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			}
+			if json.Unmarshal(b, &v) != nil {
+				continue
+			}
+			meta.name, meta.version = v.Name, v.Version
+			if meta.name == "" {
+				meta.name = v.ID
+			}
+		} else {
+			if m := pluginNameRe.FindSubmatch(b); m != nil {
+				meta.name = strings.TrimSpace(string(m[1]))
+			}
+			if m := pluginVersionRe.FindSubmatch(b); m != nil {
+				meta.version = strings.TrimSpace(string(m[1]))
+			}
+		}
+		if meta.name != "" {
+			return meta
+		}
+	}
+	return pluginMeta{}
+}
+
+// hangarSource adapts hgClient to Source.
+type hangarSource struct{}
+
+func (hangarSource) Name() string { return dbpkg.SourceHangar }
+
+// ParseURL accepts project URLs such as
+// https://hangar.papermc.io/HelpChat/PlaceholderAPI, returning the project
+// slug without its owner.
+func (hangarSource) ParseURL(raw string) (string, bool) {
+	u, err := urlpkg.Parse(raw)
+	if err != nil || !strings.EqualFold(u.Hostname(), "hangar.papermc.io") {
+		return "", false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// ProjectURL links a project by slug alone. Hangar pages live under the
+// owner's namespace, so matches carry the full URL and this is a fallback.
+func (hangarSource) ProjectURL(slug string) string {
+	return "https://hangar.papermc.io/" + slug
+}
+
+func (hangarSource) Project(ctx context.Context, slug string) (*mr.Project, error) {
+	p, err := hgClient.Project(ctx, slug)
+	if err != nil {
+		return nil, projectNotFound(err, hg.IsNotFound(err))
+	}
+	return hangarProject(p), nil
+}
+
+func (hangarSource) Versions(ctx context.Context, slug, gameVersion, loader string) ([]mr.Version, error) {
+	platform := hg.PlatformForLoader(loader)
+	versions, err := hgClient.Versions(ctx, slug, platform, gameVersion)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]mr.Version, 0, len(versions))
+	for _, v := range versions {
+		out = append(out, hangarVersion(v, platform))
+	}
+	return out, nil
+}
+
+// Identify matches plugin jars by SHA-256, falling back to the name and
+// version in their descriptor. Jars without a plugin descriptor are skipped
+// so mod instances cost no Hangar requests.
+func (hangarSource) Identify(ctx context.Context, jars map[string]*jarInfo) map[string]*jarMatch {
+	out := make(map[string]*jarMatch)
+	for name, j := range jars {
+		if j.plugin.name == "" {
+			continue
+		}
+		m, err := matchPlugin(ctx, j)
+		if err != nil {
+			if ctx.Err() != nil {
+				return out
+			}
+			log.Ctx(ctx).Debug().Str("file", name).Err(err).Msg("hangar plugin lookup failed")
+			continue
+		}
+		if m != nil {
+			out[name] = m
+		}
+	}
+	return out
+}
+
+func (hangarSource) Download(ctx context.Context, v mr.Version) ([]byte, bool, error) {
+	f, ok := v.PrimaryFile()
+	if !ok || f.URL == "" {
+		return nil, false, errors.New("version has no files")
+	}
+	return fetchArtifact(ctx, f)
+}
+
+// matchPlugin identifies a plugin jar on Hangar. It returns nil without error
+// when Hangar does not know the plugin or the declared version.
+func matchPlugin(ctx context.Context, j *jarInfo) (*jarMatch, error) {
+	platform := j.plugin.platform
+	if v, err := hgClient.VersionByHash(ctx, j.sha256); err == nil {
+		p, err := hgClient.Project(ctx, strconv.Itoa(v.ProjectID))
+		if err != nil {
+			return nil, err
+		}
+		return newPluginMatch(p, *v, platform, MatchHash), nil
+	} else if !hg.IsNotFound(err) {
+		return nil, err
+	}
+	p, err := findPluginProject(ctx, j.plugin.name, platform)
+	if err != nil || p == nil {
+		return nil, err
+	}
+	versions, err := hgClient.Versions(ctx, p.Namespace.Slug, platform, "")
+	if err != nil {
+		return nil, err
+	}
+	want := normalizeVersion(j.plugin.version)
+	for _, v := range versions {
+		if normalizeVersion(v.Name) == want {
+			return newPluginMatch(p, v, platform, MatchMetadata), nil
+		}
+	}
+	return nil, nil
+}
+
+// findPluginProject resolves a declared plugin name to a project, trying it
+// as a slug before searching for an exact name match.
+func findPluginProject(ctx context.Context, name, platform string) (*hg.Project, error) {
+	p, err := hgClient.Project(ctx, name)
+	if err == nil {
+		return p, nil
+	}
+	if !hg.IsNotFound(err) {
+		return nil, err
+	}
+	res, err := hgClient.Search(ctx, name, platform)
+	if err != nil {
+		return nil, err
+	}
+	for i := range res {
+		if strings.EqualFold(res[i].Name, name) {
+			return &res[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func newPluginMatch(p *hg.Project, v hg.Version, platform, method string) *jarMatch {
+	mv := hangarVersion(v, platform)
+	m := &jarMatch{proj: hangarProject(p), slug: p.Namespace.Slug, ver: mv.VersionNumber, version: mv, method: method, url: p.URL()}
+	if len(mv.Loaders) > 0 {
+		m.loader = mv.Loaders[0]
+	}
+	return m
+}
+
+func hangarProject(p *hg.Project) *mr.Project {
+	return &mr.Project{ID: strconv.Itoa(p.ID), Slug: p.Namespace.Slug, Title: p.Name, IconURL: p.AvatarURL}
+}
+
+// hangarVersion converts a Hangar version to the download for platform. With
+// no platform, Paper is preferred, then the first platform published.
+func hangarVersion(v hg.Version, platform string) mr.Version {
+	if _, ok := v.Downloads[platform]; !ok {
+		platform = ""
+		if _, ok := v.Downloads[hg.PlatformPaper]; ok {
+			platform = hg.PlatformPaper
+		} else if ps := v.Platforms(); len(ps) > 0 {
+			platform = ps[0]
+		}
+	}
+	out := mr.Version{
+		ID:            strconv.Itoa(v.ID),
+		ProjectID:     strconv.Itoa(v.ProjectID),
+		VersionNumber: v.Name,
+		VersionType:   v.ChannelType(),
+		DatePublished: v.CreatedAt,
+		GameVersions:  append([]string(nil), v.PlatformDependencies[platform]...),
+	}
+	if platform == "" {
+		return out
+	}
+	out.Loaders = []string{strings.ToLower(platform)}
+	d := v.Downloads[platform]
+	if u := d.URL(); u != "" {
+		f := mr.VersionFile{URL: u, Filename: d.FileInfo.Name, Size: d.FileInfo.SizeBytes, Primary: true}
+		if d.FileInfo.SHA256Hash != "" {
+			f.Hashes = map[string]string{"sha256": d.FileInfo.SHA256Hash}
+		}
+		out.Files = []mr.VersionFile{f}
+	}
+	return out
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dbpkg "modsentinel/internal/db"
+	hg "modsentinel/internal/hangar"
+	pppkg "modsentinel/internal/pufferpanel"
+)
+
+// fakeHangarClient serves one Hangar project and knows no file hashes.
+type fakeHangarClient struct {
+	project  hg.Project
+	versions []hg.Version
+}
+
+func (c fakeHangarClient) Project(ctx context.Context, slug string) (*hg.Project, error) {
+	if slug != c.project.Namespace.Slug {
+		return nil, &hg.Error{Status: http.StatusNotFound, Message: "not found"}
+	}
+	p := c.project
+	return &p, nil
+}
+
+func (c fakeHangarClient) Search(ctx context.Context, query, platform string) ([]hg.Project, error) {
+	return nil, nil
+}
+
+func (c fakeHangarClient) Versions(ctx context.Context, slug, platform, gameVersion string) ([]hg.Version, error) {
+	return c.versions, nil
+}
+
+func (c fakeHangarClient) VersionByHash(ctx context.Context, sha256 string) (*hg.Version, error) {
+	return nil, &hg.Error{Status: http.StatusNotFound, Message: "not found"}
+}
+
+func pluginJar(t *testing.T, descriptor string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, err := zw.Create("plugin.yml")
+	if err != nil {
+		t.Fatalf("zip: %v", err)
+	}
+	f.Write([]byte(descriptor))
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParsePluginMetadata(t *testing.T) {
+	meta := parsePluginMetadata(pluginJar(t, "main: me.clip.placeholderapi.PlaceholderAPIPlugin\nname: PlaceholderAPI\nversion: '2.11.5'\ncommands:\n  papi:\n    description: x\n"))
+	if meta.name != "PlaceholderAPI" || meta.version != "2.11.5" || meta.platform != hg.PlatformPaper {
+		t.Fatalf("meta = %+v", meta)
+	}
+}
+
+func TestPerformSync_MatchesHangarPlugin(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+
+	inst := &dbpkg.Instance{Name: "paper", Loader: "paper"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	jar := pluginJar(t, "name: PlaceholderAPI\nversion: 2.11.5\n")
+	origGet, origList, origFetch := ppGetServer, ppListPath, ppFetchFile
+	defer func() { ppGetServer, ppListPath, ppFetchFile = origGet, origList, origFetch }()
+	ppGetServer = func(ctx context.Context, id string) (*pppkg.ServerDetail, error) {
+		return &pppkg.ServerDetail{ID: id}, nil
+	}
+	ppListPath = func(ctx context.Context, id, path string) ([]pppkg.FileEntry, error) {
+		if path != "plugins/" {
+			t.Errorf("listed %q, want plugins/", path)
+		}
+		return []pppkg.FileEntry{{Name: "PlaceholderAPI-2.11.5.jar"}}, nil
+	}
+	ppFetchFile = func(ctx context.Context, id, path string) ([]byte, error) { return jar, nil }
+
+	now := time.Now()
+	version := func(id int, name string, at time.Time) hg.Version {
+		v := hg.Version{ID: id, ProjectID: 3, Name: name, CreatedAt: at}
+		v.Channel.Name = "Release"
+		d := hg.Download{DownloadURL: "https://hangarcdn.papermc.io/plugins/HelpChat/PlaceholderAPI/versions/" + name + "/PAPER/PlaceholderAPI-" + name + ".jar"}
+		v.Downloads = map[string]hg.Download{hg.PlatformPaper: d}
+		v.PlatformDependencies = map[string][]string{hg.PlatformPaper: {"1.20.4"}}
+		return v
+	}
+	proj := hg.Project{ID: 3, Name: "PlaceholderAPI"}
+	proj.Namespace.Owner, proj.Namespace.Slug = "HelpChat", "PlaceholderAPI"
+	oldHG := hgClient
+	hgClient = fakeHangarClient{project: proj, versions: []hg.Version{version(11, "2.11.6", now), version(10, "2.11.5", now.Add(-time.Hour))}}
+	defer func() { hgClient = oldHG }()
+	resolved := 0
+	old := modClient
+	modClient = hashClient{resolved: &resolved}
+	defer func() { modClient = old }()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	performSync(context.Background(), w, req, db, inst, "srv", newJobProgress(), nil)
+
+	mods, err := dbpkg.ListMods(db, inst.ID)
+	if err != nil {
+		t.Fatalf("list mods: %v", err)
+	}
+	if len(mods) != 1 {
+		t.Fatalf("mods len=%d, want 1", len(mods))
+	}
+	m := mods[0]
+	if m.Source != dbpkg.SourceHangar || m.URL != "https://hangar.papermc.io/HelpChat/PlaceholderAPI" || m.MatchMethod != MatchMetadata {
+		t.Fatalf("unexpected mod: %+v", m)
+	}
+	if m.Loader != "paper" || m.CurrentVersion != "2.11.5" || m.AvailableVersion != "2.11.6" {
+		t.Fatalf("versions not resolved on Hangar: %+v", m)
+	}
+	if resolved != 0 {
+		t.Fatalf("name resolution ran %d times for a Hangar match", resolved)
+	}
+	scans, err := dbpkg.ListInstanceScans(db, inst.ID)
+	if err != nil {
+		t.Fatalf("list scans: %v", err)
+	}
+	if len(scans) != 1 || scans[0].File != "PlaceholderAPI-2.11.5.jar" || scans[0].ModID == nil || *scans[0].ModID != m.ID {
+		t.Fatalf("sync scans = %+v", scans)
+	}
+}
+
+func TestInstanceModFolder(t *testing.T) {
+	for loader, want := range map[string]string{
+		"paper": "plugins/", "Purpur": "plugins/", "folia": "plugins/", "spigot": "plugins/", "bukkit": "plugins/",
+		"velocity": "plugins/", "waterfall": "plugins/", "bungeecord": "plugins/",
+		"fabric": "mods/", "forge": "mods/", "": "mods/",
+	} {
+		if got := instanceModFolder(&dbpkg.Instance{Loader: loader}); got != want {
+			t.Errorf("%q: folder = %q, want %q", loader, got, want)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	cf "modsentinel/internal/curseforge"
+	dbpkg "modsentinel/internal/db"
+	mr "modsentinel/internal/modrinth"
+)
+
+// Match methods recorded on mods identified during sync.
+const (
+	MatchHash     = "hash"
+	MatchMetadata = "metadata"
+	MatchFilename = "filename"
+	// MatchFingerprint marks jars identified by CurseForge fingerprint.
+	MatchFingerprint = "fingerprint"
+	// MatchPackwiz marks mods imported from packwiz update metadata.
+	MatchPackwiz = "packwiz"
+)
+
+// hashLookupBatch caps the number of hashes sent per version_files request.
+const hashLookupBatch = 100
+
+// jarInfo holds what sync learns from a jar's bytes: content hashes and the
+// identifiers embedded in its loader metadata.
+type jarInfo struct {
+	sha1        string
+	sha256      string
+	sha512      string
+	fingerprint uint32
+	slug        string
+	version     string
+	loader      string
+	// plugin is the metadata of Bukkit-family and proxy plugins.
+	plugin pluginMeta
+}
+
+func newJarInfo(data []byte) *jarInfo {
+	s1 := sha1.Sum(data)
+	s256 := sha256.Sum256(data)
+	s512 := sha512.Sum512(data)
+	j := &jarInfo{sha1: hex.EncodeToString(s1[:]), sha256: hex.EncodeToString(s256[:]), sha512: hex.EncodeToString(s512[:]), fingerprint: cf.Fingerprint(data)}
+	slug, ver, loader := parseJarMetadata(data)
+	j.slug, j.version, j.loader = slug, ver, mapLoader(loader)
+	j.plugin = parsePluginMetadata(data)
+	return j
+}
+
+// jarMatch is the outcome of identifying a jar against a mod source. An empty
+// source means Modrinth. url overrides the source's ProjectURL for sources
+// whose project pages need more than the slug.
+type jarMatch struct {
+	proj    *mr.Project
+	slug    string
+	ver     string
+	version mr.Version
+	loader  string
+	method  string
+	source  string
+	url     string
+}
+
+// lookupJarHashes resolves jars in bulk through Modrinth's version_files
+// endpoint, keyed by jar filename. SHA-512 is tried first; SHA-1 covers
+// anything left over. Lookup errors are logged and leave jars unresolved so
+// name heuristics can still run.
+func lookupJarHashes(ctx context.Context, jars map[string]*jarInfo) map[string]mr.Version {
+	hits := make(map[string]mr.Version, len(jars))
+	for _, algo := range []string{"sha512", "sha1"} {
+		byHash := make(map[string][]string)
+		for name, j := range jars {
+			if _, ok := hits[name]; ok {
+				continue
+			}
+			h := j.sha512
+			if algo == "sha1" {
+				h = j.sha1
+			}
+			byHash[h] = append(byHash[h], name)
+		}
+		if len(byHash) == 0 {
+			break
+		}
+		hashes := make([]string, 0, len(byHash))
+		for h := range byHash {
+			hashes = append(hashes, h)
+		}
+		sort.Strings(hashes)
+		for start := 0; start < len(hashes); start += hashLookupBatch {
+			end := start + hashLookupBatch
+			if end > len(hashes) {
+				end = len(hashes)
+			}
+			res, err := modClient.VersionsByHashes(ctx, hashes[start:end], algo)
+			if err != nil {
+				log.Ctx(ctx).Debug().Err(err).Str("algorithm", algo).Int("hashes", end-start).Msg("modrinth hash lookup failed")
+				continue
+			}
+			for h, v := range res {
+				for _, name := range byHash[h] {
+					hits[name] = v
+				}
+			}
+		}
+	}
+	return hits
+}
+
+// matchJarByHash completes a hash hit with its project details.
+func matchJarByHash(ctx context.Context, v mr.Version, jar *jarInfo) (*jarMatch, error) {
+	proj, err := modClient.Project(ctx, v.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	slug := proj.Slug
+	if slug == "" {
+		slug = v.ProjectID
+	}
+	m := &jarMatch{proj: proj, slug: slug, ver: v.VersionNumber, version: v, method: MatchHash}
+	if jar != nil {
+		m.loader = jar.loader
+	}
+	return m, nil
+}
+
+func findVersion(versions []mr.Version, verNorm string) (mr.Version, bool) {
+	for _, vv := range versions {
+		if normalizeVersion(vv.VersionNumber) == verNorm {
+			return vv, true
+		}
+	}
+	return mr.Version{}, false
+}
+
+// matchJarByName identifies a jar from its embedded metadata, slug aliases and
+// filename, falling back to a Modrinth search scored by filename similarity.
+// On failure the returned match carries whatever slug/version was derived so
+// callers can record sync state.
+func matchJarByName(ctx context.Context, db *sql.DB, inst *dbpkg.Instance, serverID, f string, jar *jarInfo) (*jarMatch, error) {
+	meta := parseJarFilename(f)
+	res := &jarMatch{slug: meta.Slug, ver: meta.Version, method: MatchFilename}
+	// Prefer metadata in jar over filename when available
+	if jar != nil {
+		if jar.slug != "" {
+			res.slug = jar.slug
+			res.method = MatchMetadata
+		}
+		if jar.version != "" {
+			res.ver = jar.version
+		}
+		res.loader = jar.loader
+	}
+	// Build candidate alias key
+	base := strings.TrimSuffix(strings.ToLower(f), ".jar")
+	cand := meta.Slug
+	if cand == "" {
+		cand = base
+	}
+	cand = normalizeCandidate(cand)
+	// Check alias map first to avoid repeated searches
+	if cand != "" {
+		if mapped, ok, _ := dbpkg.GetAlias(db, inst.ID, cand); ok && mapped != "" {
+			res.slug = mapped
+		}
+	}
+	if res.slug == "" || res.ver == "" {
+		log.Debug().
+			Int("instance_id", inst.ID).
+			Str("server_id", serverID).
+			Str("file", f).
+			Bool("has_metadata", jar != nil).
+			Msg("modrinth match failed: missing slug or version")
+		return res, errors.New("missing slug or version")
+	}
+	// Resolve canonical slug; retry with the jar's own mod id when an alias
+	// or filename guess does not resolve.
+	proj, slug, err := modClient.Resolve(ctx, res.slug)
+	if err != nil && jar != nil && jar.slug != "" && jar.slug != res.slug {
+		proj, slug, err = modClient.Resolve(ctx, jar.slug)
+	}
+	if err != nil {
+		log.Debug().
+			Int("instance_id", inst.ID).
+			Str("server_id", serverID).
+			Str("file", f).
+			Str("slug", res.slug).
+			Str("version", res.ver).
+			Err(err).
+			Msg("modrinth resolve failed")
+		return res, err
+	}
+	res.proj, res.slug = proj, slug
+	// Remember alias mapping for future runs
+	if cand != "" && slug != "" {
+		_ = dbpkg.SetAlias(db, inst.ID, cand, slug)
+	}
+	versions, err := modClient.Versions(ctx, res.slug, "", "")
+	if err != nil {
+		log.Debug().
+			Int("instance_id", inst.ID).
+			Str("server_id", serverID).
+			Str("file", f).
+			Str("slug", res.slug).
+			Str("version", res.ver).
+			Err(err).
+			Msg("modrinth versions fetch failed")
+		return res, err
+	}
+	// First try normalized exact version match
+	verNorm := normalizeVersion(res.ver)
+	if v, ok := findVersion(versions, verNorm); ok {
+		res.version = v
+		return res, nil
+	}
+	// The alias may point elsewhere than the jar's own mod id; try that next.
+	if jar != nil && jar.slug != "" && jar.slug != res.slug {
+		if proj2, slug2, err2 := modClient.Resolve(ctx, jar.slug); err2 == nil {
+			if vers2, err3 := modClient.Versions(ctx, slug2, "", ""); err3 == nil {
+				if v, ok := findVersion(vers2, verNorm); ok {
+					res.proj, res.slug, res.version = proj2, slug2, v
+					return res, nil
+				}
+			}
+		}
+	}
+	// Fallback: search by normalized filename and try hits
+	query := meta.Slug
+	if strings.TrimSpace(query) == "" {
+		query = strings.TrimSuffix(f, ".jar")
+	}
+	query = normalizeCandidate(query)
+	if sr, errS := modClient.Search(ctx, query); errS == nil && len(sr.Hits) > 0 {
+		for i, hit := range sr.Hits {
+			if i >= 10 {
+				break
+			}
+			vers3, errV := modClient.Versions(ctx, hit.Slug, "", "")
+			if errV != nil {
+				continue
+			}
+			// First try normalized exact, then the newest version whose file
+			// name resembles the jar, preferring the instance loader.
+			v, ok := findVersion(vers3, verNorm)
+			if !ok {
+				v, ok = bestVersionByFilename(vers3, f, inst.Loader, meta.Loader, res.loader)
+			}
+			if !ok {
+				continue
+			}
+			proj3, errP := modClient.Project(ctx, hit.Slug)
+			if errP != nil {
+				continue
+			}
+			if cand != "" {
+				_ = dbpkg.SetAlias(db, inst.ID, cand, hit.Slug)
+			}
+			res.proj, res.slug, res.version, res.method = proj3, hit.Slug, v, MatchFilename
+			return res, nil
+		}
+	}
+	log.Debug().
+		Int("instance_id", inst.ID).
+		Str("server_id", serverID).
+		Str("file", f).
+		Str("slug", res.slug).
+		Str("version", res.ver).
+		Msg("modrinth match failed: version not found")
+	return res, fmt.Errorf("version %s not found", res.ver)
+}
+
+// bestVersionByFilename picks the newest version whose primary file name is
+// similar to the jar name. Candidates are narrowed by the instance loader,
+// then the filename loader hint, then the loader detected in the jar.
+func bestVersionByFilename(versions []mr.Version, file, instLoader, fileLoader, detectedLoader string) (mr.Version, bool) {
+	filterBy := func(list []mr.Version, want string) []mr.Version {
+		if strings.TrimSpace(want) == "" {
+			return nil
+		}
+		out := make([]mr.Version, 0, len(list))
+		for _, x := range list {
+			if len(x.Loaders) == 0 {
+				out = append(out, x)
+				continue
+			}
+			for _, ld := range x.Loaders {
+				if mapLoader(ld) == want {
+					out = append(out, x)
+					break
+				}
+			}
+		}
+		return out
+	}
+	var candidates []mr.Version
+	for _, want := range []string{mapLoader(instLoader), mapLoader(fileLoader), detectedLoader} {
+		if flt := filterBy(versions, want); len(flt) > 0 {
+			candidates = flt
+			break
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = versions
+	}
+	nameTokens := tokenizeFilename(file)
+	var best mr.Version
+	var bestTime time.Time
+	for _, vv := range candidates {
+		sim := 0.0
+		if len(vv.Files) > 0 {
+			sim = jaccard(nameTokens, tokenizeFilename(basenameFromURL(vv.Files[0].URL)))
+		}
+		if sim < 0.3 {
+			continue
+		}
+		if vv.DatePublished.After(bestTime) {
+			best = vv
+			bestTime = vv.DatePublished
+		}
+	}
+	return best, best.ID != ""
+}
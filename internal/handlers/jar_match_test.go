@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dbpkg "modsentinel/internal/db"
+	mr "modsentinel/internal/modrinth"
+	pppkg "modsentinel/internal/pufferpanel"
+)
+
+// hashClient knows one jar by its SHA-512 and fails name resolution, so any
+// match must come from the hash lookup.
+type hashClient struct {
+	fakeModClient
+	known    string
+	resolved *int
+}
+
+func (c hashClient) VersionsByHashes(ctx context.Context, hashes []string, algorithm string) (map[string]mr.Version, error) {
+	out := map[string]mr.Version{}
+	if algorithm != "sha512" {
+		return out, nil
+	}
+	for _, h := range hashes {
+		if h == c.known {
+			out[h] = mr.Version{ID: "v1", ProjectID: "AANobbMI", VersionNumber: "0.5.3", VersionType: "release", Loaders: []string{"fabric"}, Files: []mr.VersionFile{{URL: "https://cdn.modrinth.com/data/AANobbMI/versions/v1/sodium-fabric-0.5.3.jar"}}}
+		}
+	}
+	return out, nil
+}
+
+func (c hashClient) Project(ctx context.Context, slug string) (*mr.Project, error) {
+	return &mr.Project{ID: "AANobbMI", Slug: "sodium", Title: "Sodium"}, nil
+}
+
+func (c hashClient) Resolve(ctx context.Context, slug string) (*mr.Project, string, error) {
+	*c.resolved++
+	return nil, "", &mr.Error{Status: http.StatusNotFound, Message: "project not found"}
+}
+
+func TestPerformSync_MatchesByHash(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+
+	inst := &dbpkg.Instance{Name: "hash", Loader: "fabric"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	known := []byte("renamed jar bytes")
+	sum := sha512.Sum512(known)
+
+	origGet, origList, origFetch := ppGetServer, ppListPath, ppFetchFile
+	defer func() { ppGetServer, ppListPath, ppFetchFile = origGet, origList, origFetch }()
+	ppGetServer = func(ctx context.Context, id string) (*pppkg.ServerDetail, error) {
+		return &pppkg.ServerDetail{ID: id}, nil
+	}
+	ppListPath = func(ctx context.Context, id, path string) ([]pppkg.FileEntry, error) {
+		return []pppkg.FileEntry{{Name: "totally-renamed.jar"}, {Name: "unknown-1.0.jar"}}, nil
+	}
+	ppFetchFile = func(ctx context.Context, id, path string) ([]byte, error) {
+		if strings.HasSuffix(path, "totally-renamed.jar") {
+			return known, nil
+		}
+		return []byte("something else"), nil
+	}
+	resolved := 0
+	old := modClient
+	modClient = hashClient{known: hex.EncodeToString(sum[:]), resolved: &resolved}
+	defer func() { modClient = old }()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	prog := newJobProgress()
+	performSync(context.Background(), w, req, db, inst, "srv", prog, nil)
+
+	mods, err := dbpkg.ListMods(db, inst.ID)
+	if err != nil {
+		t.Fatalf("list mods: %v", err)
+	}
+	if len(mods) != 1 {
+		t.Fatalf("mods len=%d, want 1", len(mods))
+	}
+	m := mods[0]
+	if m.URL != "https://modrinth.com/mod/sodium" || m.CurrentVersion != "0.5.3" || m.MatchMethod != MatchHash {
+		t.Fatalf("unexpected mod: %+v", m)
+	}
+	// Only the jar Modrinth does not know falls back to name resolution.
+	if resolved != 1 {
+		t.Fatalf("resolve calls = %d, want 1", resolved)
+	}
+	_, _, _, failed, _, _ := prog.snapshot()
+	if failed != 1 {
+		t.Fatalf("failed = %d, want 1", failed)
+	}
+}
+
+func TestPerformSync_RecordsNameMatchMethod(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+
+	inst := &dbpkg.Instance{Name: "names", Loader: "fabric"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	origGet, origList, origFetch := ppGetServer, ppListPath, ppFetchFile
+	defer func() { ppGetServer, ppListPath, ppFetchFile = origGet, origList, origFetch }()
+	ppGetServer = func(ctx context.Context, id string) (*pppkg.ServerDetail, error) {
+		return &pppkg.ServerDetail{ID: id}, nil
+	}
+	ppListPath = func(ctx context.Context, id, path string) ([]pppkg.FileEntry, error) {
+		return []pppkg.FileEntry{{Name: "NoChatReports-1.20.1-fabric.jar"}}, nil
+	}
+	ppFetchFile = func(ctx context.Context, id, path string) ([]byte, error) { return []byte("not a zip"), nil }
+	old := modClient
+	modClient = isoClient{}
+	defer func() { modClient = old }()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	performSync(context.Background(), w, req, db, inst, "srv", newJobProgress(), nil)
+
+	mods, err := dbpkg.ListMods(db, inst.ID)
+	if err != nil {
+		t.Fatalf("list mods: %v", err)
+	}
+	if len(mods) != 1 || mods[0].MatchMethod != MatchFilename {
+		t.Fatalf("unexpected mods: %+v", mods)
+	}
+}
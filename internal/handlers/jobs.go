@@ -11,6 +11,7 @@ import (
 	"sync/atomic"
 
 	dbpkg "modsentinel/internal/db"
+	mr "modsentinel/internal/modrinth"
 	"modsentinel/internal/telemetry"
 )
 
@@ -152,6 +153,8 @@ func StartJobQueue(ctx context.Context, db *sql.DB) func(context.Context) {
 	runCtx, cancel := context.WithCancel(ctx)
 	runWg.Add(1)
 	go worker(runCtx)
+	// Drift checks may queue syncs to reconcile, so they run with the queue.
+	go runDriftLoop(runCtx, db)
 	if err := dbpkg.ResetRunningSyncJobs(db); err == nil {
 		ids, err := dbpkg.ListQueuedSyncJobs(db)
 		if err == nil {
@@ -282,7 +285,8 @@ func runJob(ctx context.Context, job *dbpkg.SyncJob) {
 		}
 		return
 	}
-	baseCtx := context.WithoutCancel(ctx)
+	// Sync jobs yield the Modrinth rate limit to interactive requests.
+	baseCtx := mr.WithPriority(context.WithoutCancel(ctx), mr.PriorityBackground)
 	jobCtx, cancel := context.WithCancel(baseCtx)
 	jobCancels.Store(job.ID, cancel)
 	defer jobCancels.Delete(job.ID)
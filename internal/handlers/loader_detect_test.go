@@ -2,14 +2,13 @@ package handlers
 
 import (
     "context"
-    "io"
     "net/http"
     "net/http/httptest"
-    "strings"
     "testing"
     "time"
 
     dbpkg "modsentinel/internal/db"
+    mr "modsentinel/internal/modrinth"
     pppkg "modsentinel/internal/pufferpanel"
 )
 
@@ -207,10 +206,10 @@ func TestLoaderDetect_UnsupportedTag_DefaultsToRequiresLoader(t *testing.T) {
         return &pppkg.ServerDefinition{Data: map[string]pppkg.Variable{}}, nil
     }
     ppGetServerDefinitionRaw = func(_ context.Context, _ string) (map[string]any, error) {
-        return map[string]any{"environment": map[string]any{"display": "Babric Server"}}
+        return map[string]any{"environment": map[string]any{"display": "Babric Server"}}, nil
     }
     ppGetServerData = func(_ context.Context, _ string) (*pppkg.ServerData, error) {
-        return &pppkg.ServerData{Data: map[string]pppkg.ValueWrapper{}}
+        return &pppkg.ServerData{Data: map[string]pppkg.ValueWrapper{}}, nil
     }
 
     rr := httptest.NewRecorder()
@@ -233,15 +232,9 @@ func TestLoaderDetect_UnsupportedTag_DefaultsToRequiresLoader(t *testing.T) {
 
 // Test that fetchModrinthLoaders filters out the vanilla tag.
 func TestFetchModrinthLoaders_FiltersVanilla(t *testing.T) {
-    prev := http.DefaultClient
-    t.Cleanup(func(){ http.DefaultClient = prev })
-    http.DefaultClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
-        if req.URL.Host != "api.modrinth.com" || req.URL.Path != "/v2/tag/loader" {
-            return &http.Response{StatusCode: 404, Body: io.NopCloser(strings.NewReader("not found"))}
-        }
-        body := `[{"name":"Fabric","icon":"<svg>","supported_project_types":["mod"]},{"name":"Vanilla","icon":"","supported_project_types":[]}]`
-        return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(body)), Header: make(http.Header)}
-    })}
+    old := modClient
+    t.Cleanup(func(){ modClient = old })
+    modClient = loaderClient{tags: []mr.LoaderTag{{Name: "Fabric", Icon: "<svg>", SupportedProjectTypes: []string{"mod"}}, {Name: "Vanilla"}}}
     tags, err := fetchModrinthLoaders(context.Background())
     if err != nil { t.Fatalf("fetch: %v", err) }
     if len(tags) != 1 || tags[0].ID != "fabric" {
@@ -249,6 +242,14 @@ func TestFetchModrinthLoaders_FiltersVanilla(t *testing.T) {
     }
 }
 
+// loaderClient reports a fixed set of Modrinth loader tags.
+type loaderClient struct {
+    fakeModClient
+    tags []mr.LoaderTag
+}
+
+func (c loaderClient) Loaders(ctx context.Context) ([]mr.LoaderTag, error) { return c.tags, nil }
+
 type roundTripFunc func(*http.Request) *http.Response
 func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r), nil }
 
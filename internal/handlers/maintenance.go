@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	dbpkg "modsentinel/internal/db"
+	"modsentinel/internal/httpx"
+	"modsentinel/internal/maintenance"
+	"modsentinel/internal/telemetry"
+)
+
+var (
+	// maintenanceTick is how often deferred updates are checked against
+	// their instance's window.
+	maintenanceTick = time.Minute
+	// windowNow allows tests to move the clock.
+	windowNow = time.Now
+	// maintenanceLocks serializes maintenance runs per instance.
+	maintenanceLocks sync.Map // map[int]chan struct{}
+)
+
+func maintenanceLock(instID int) chan struct{} {
+	v, _ := maintenanceLocks.LoadOrStore(instID, make(chan struct{}, 1))
+	return v.(chan struct{})
+}
+
+// parseWindow evaluates a stored window.
+func parseWindow(w *dbpkg.MaintenanceWindow) (*maintenance.Window, error) {
+	return maintenance.Parse(w.Schedule, time.Duration(w.DurationMinutes)*time.Minute, w.Timezone)
+}
+
+// instanceWindow returns an instance's window, or nils when it has none.
+func instanceWindow(db *sql.DB, instID int) (*dbpkg.MaintenanceWindow, *maintenance.Window, error) {
+	w, err := dbpkg.GetMaintenanceWindow(db, instID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	sched, err := parseWindow(w)
+	if err != nil {
+		return nil, nil, err
+	}
+	return w, sched, nil
+}
+
+// enqueueScheduledUpdateJob enqueues an unattended update. Instances with a
+// maintenance window defer it until the window opens.
+func enqueueScheduledUpdateJob(ctx context.Context, db *sql.DB, m *dbpkg.Mod, key string) (int, bool, error) {
+	_, sched, err := instanceWindow(db, m.InstanceID)
+	if err != nil {
+		return 0, false, err
+	}
+	id, err := queueUpdateJob(ctx, db, m.ID, "", key, sched)
+	return id, sched != nil, err
+}
+
+// runMaintenanceLoop starts due maintenance runs every maintenanceTick until
+// ctx ends.
+func runMaintenanceLoop(ctx context.Context, db *sql.DB) {
+	t := time.NewTicker(maintenanceTick)
+	defer t.Stop()
+	for {
+		runDueMaintenance(ctx, db)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// runDueMaintenance starts a run for every instance with deferred updates
+// whose window is open or was removed. Instances already in a run are
+// skipped until the next tick.
+func runDueMaintenance(ctx context.Context, db *sql.DB) {
+	pending, err := dbpkg.ListDeferredModUpdates(db)
+	if err != nil {
+		log.Error().Err(err).Msg("list deferred updates")
+		return
+	}
+	for instID, ids := range pending {
+		inst, err := dbpkg.GetInstance(db, instID)
+		if err != nil {
+			continue
+		}
+		w, sched, err := instanceWindow(db, instID)
+		if err != nil {
+			log.Error().Err(err).Int("instance_id", instID).Msg("invalid maintenance window")
+			continue
+		}
+		if sched != nil && !sched.Open(windowNow()) {
+			continue
+		}
+		lock := maintenanceLock(instID)
+		select {
+		case lock <- struct{}{}:
+		default:
+			continue
+		}
+		go func() {
+			defer func() { <-lock }()
+			runMaintenance(ctx, db, inst, w != nil && w.RestartServer, ids)
+		}()
+	}
+}
+
+// runMaintenance applies an instance's deferred updates one at a time. When
+// the server cannot be stopped for a restart, the updates fail instead.
+func runMaintenance(ctx context.Context, db *sql.DB, inst *dbpkg.Instance, stopServer bool, ids []int) {
+	telemetry.Event("maintenance_started", map[string]string{
+		"instance_id": strconv.Itoa(inst.ID),
+		"updates":     strconv.Itoa(len(ids)),
+		"stop_server": strconv.FormatBool(stopServer),
+	})
+	ran := false
+	err := applyWithServerControl(ctx, db, inst, stopServer, func() bool {
+		ran = true
+		applied := false
+		for _, id := range ids {
+			if runDeferredJob(ctx, db, id, nil) == StateSucceeded {
+				applied = true
+			}
+		}
+		return applied
+	})
+	if !ran {
+		for _, id := range ids {
+			runDeferredJob(ctx, db, id, err)
+		}
+	}
+}
+
+// runDeferredJob leases and runs a deferred job synchronously, or fails it
+// with cause. It returns the job's final state.
+func runDeferredJob(ctx context.Context, db *sql.DB, id int, cause error) UpdateJobState {
+	if ok, _ := dbpkg.LeaseModUpdate(db, id); !ok {
+		return ""
+	}
+	mu, err := dbpkg.GetModUpdate(db, id)
+	if err != nil {
+		return ""
+	}
+	p, _ := updateJobs.LoadOrStore(id, &updateJob{id: id, events: make([]sseMsg, 0, 16), db: db, updID: id})
+	uj := p.(*updateJob)
+	uj.emitState(StateRunning, nil)
+	if cause != nil {
+		uj.emitState(StateFailed, map[string]any{"error": cause.Error()})
+		return StateFailed
+	}
+	runUpdateJob(ctx, db, uj, mu.ModID)
+	return uj.state
+}
+
+// applyWithServerControl runs apply, which reports whether any update was
+// installed. With stopServer set and a PufferPanel server linked, the server
+// is stopped first and started again afterwards; apply is skipped when the
+// stop fails. Otherwise an instance that restarts after updates is restarted
+// once at the end instead of after every job. Each server action is recorded
+// in mod_events.
+func applyWithServerControl(ctx context.Context, db *sql.DB, inst *dbpkg.Instance, stopServer bool, apply func() bool) error {
+	serverID := strings.TrimSpace(inst.PufferpanelServerID)
+	if serverID == "" {
+		apply()
+		return nil
+	}
+	holdRestart(inst.ID)
+	defer releaseRestart(inst.ID)
+	if !stopServer {
+		if !apply() || !inst.RestartAfterUpdate {
+			return nil
+		}
+		if err := restartServerAndWait(ctx, inst); err != nil {
+			recordServerEvent(db, inst, "server_restart_failed", err)
+			return err
+		}
+		recordServerEvent(db, inst, "server_restarted", nil)
+		return nil
+	}
+	pc, err := powerFor(inst)
+	if err == nil {
+		err = pc.StopServer(ctx, serverID)
+	}
+	if err != nil {
+		recordServerEvent(db, inst, "server_stop_failed", err)
+		return err
+	}
+	recordServerEvent(db, inst, "server_stopped", nil)
+	apply()
+	// Bring the server back even when shutdown cancelled ctx mid-run.
+	startCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+	if err := pc.StartServer(startCtx, serverID); err != nil {
+		recordServerEvent(db, inst, "server_start_failed", err)
+		return err
+	}
+	recordServerEvent(db, inst, "server_started", nil)
+	return nil
+}
+
+func recordServerEvent(db *sql.DB, inst *dbpkg.Instance, action string, err error) {
+	_ = dbpkg.InsertEvent(db, &dbpkg.ModEvent{InstanceID: inst.ID, Action: action, ModName: inst.Name})
+	data := map[string]string{"instance_id": strconv.Itoa(inst.ID), "action": action}
+	if err != nil {
+		log.Error().Err(err).Int("instance_id", inst.ID).Str("action", action).Msg("maintenance server control")
+		data["error"] = err.Error()
+	}
+	telemetry.Event("maintenance_server", data)
+}
+
+// waitForWindow blocks until sched is open, returning false when ctx ends
+// first.
+func waitForWindow(ctx context.Context, sched *maintenance.Window) bool {
+	for {
+		now := windowNow()
+		next := sched.NextOpen(now)
+		if !next.After(now) {
+			return true
+		}
+		wait := next.Sub(now)
+		if wait > maintenanceTick {
+			wait = maintenanceTick
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(wait):
+		}
+	}
+}
+
+// maintenanceWindowOut is the API shape of a window with its current state.
+type maintenanceWindowOut struct {
+	*dbpkg.MaintenanceWindow
+	Open     bool       `json:"open"`
+	NextOpen time.Time  `json:"next_open"`
+	ClosesAt *time.Time `json:"closes_at,omitempty"`
+}
+
+func newMaintenanceWindowOut(w *dbpkg.MaintenanceWindow, sched *maintenance.Window) maintenanceWindowOut {
+	now := windowNow()
+	out := maintenanceWindowOut{MaintenanceWindow: w, Open: sched.Open(now), NextOpen: sched.NextOpen(now)}
+	if out.Open {
+		end := sched.ClosesAt(now)
+		out.ClosesAt = &end
+	}
+	return out
+}
+
+// loadWindowInstance resolves the {id} URL param to an instance.
+func loadWindowInstance(w http.ResponseWriter, r *http.Request, db *sql.DB) *dbpkg.Instance {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		httpx.Write(w, r, httpx.BadRequest("invalid id"))
+		return nil
+	}
+	inst, err := dbpkg.GetInstance(db, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			httpx.Write(w, r, httpx.NotFound("instance not found"))
+			return nil
+		}
+		httpx.Write(w, r, httpx.Internal(err))
+		return nil
+	}
+	return inst
+}
+
+func getMaintenanceWindowHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inst := loadWindowInstance(w, r, db)
+		if inst == nil {
+			return
+		}
+		win, sched, err := instanceWindow(db, inst.ID)
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		if win == nil {
+			httpx.Write(w, r, httpx.NotFound("no maintenance window"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(newMaintenanceWindowOut(win, sched))
+	}
+}
+
+func setMaintenanceWindowHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inst := loadWindowInstance(w, r, db)
+		if inst == nil {
+			return
+		}
+		var win dbpkg.MaintenanceWindow
+		if err := json.NewDecoder(r.Body).Decode(&win); err != nil {
+			httpx.Write(w, r, httpx.BadRequest("invalid json"))
+			return
+		}
+		win.InstanceID = inst.ID
+		win.Schedule = strings.TrimSpace(win.Schedule)
+		win.Timezone = strings.TrimSpace(win.Timezone)
+		if win.Timezone == "" {
+			win.Timezone = "UTC"
+		}
+		sched, err := parseWindow(&win)
+		if err != nil {
+			httpx.Write(w, r, httpx.BadRequest("validation failed").WithDetails(map[string]string{"window": err.Error()}))
+			return
+		}
+		if err := dbpkg.SetMaintenanceWindow(db, &win); err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		kickMaintenance(db)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newMaintenanceWindowOut(&win, sched))
+	}
+}
+
+func deleteMaintenanceWindowHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inst := loadWindowInstance(w, r, db)
+		if inst == nil {
+			return
+		}
+		if err := dbpkg.DeleteMaintenanceWindow(db, inst.ID); err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		kickMaintenance(db)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// kickMaintenance runs due maintenance now rather than on the next tick, so
+// a window that opens or disappears takes effect immediately.
+func kickMaintenance(db *sql.DB) {
+	if updatesCtx == nil || updatesCtx.Err() != nil {
+		return
+	}
+	go runDueMaintenance(updatesCtx, db)
+}
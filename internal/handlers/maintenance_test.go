@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	dbpkg "modsentinel/internal/db"
+)
+
+func TestDeferredUpdates_WaitForWindowAndRestartServer(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	inst := &dbpkg.Instance{Name: "srv", Loader: "fabric", PufferpanelServerID: "s1"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	m := &dbpkg.Mod{Name: "lib", URL: "https://modrinth.com/mod/lib", InstanceID: inst.ID, CurrentVersion: "1.0.0", Channel: "release", Loader: "fabric"}
+	if err := dbpkg.InsertMod(db, m); err != nil {
+		t.Fatalf("insert mod: %v", err)
+	}
+	if err := dbpkg.SetMaintenanceWindow(db, &dbpkg.MaintenanceWindow{InstanceID: inst.ID, Schedule: "0 4 * * *", DurationMinutes: 60, Timezone: "UTC", RestartServer: true}); err != nil {
+		t.Fatalf("set window: %v", err)
+	}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	oldNow := windowNow
+	windowNow = func() time.Time { return now }
+	defer func() { windowNow = oldNow }()
+	var calls []string
+	oldStop, oldStart := ppStopServer, ppStartServer
+	ppStopServer = func(ctx context.Context, id string) error { calls = append(calls, "stop:"+id); return nil }
+	ppStartServer = func(ctx context.Context, id string) error { calls = append(calls, "start:"+id); return nil }
+	defer func() { ppStopServer, ppStartServer = oldStop, oldStart }()
+
+	id, deferred, err := enqueueScheduledUpdateJob(context.Background(), db, m, "auto:test")
+	if err != nil || !deferred {
+		t.Fatalf("enqueue: id=%d deferred=%v err=%v", id, deferred, err)
+	}
+	defer updateJobs.Delete(id)
+
+	runDueMaintenance(context.Background(), db)
+	if mu, _ := dbpkg.GetModUpdate(db, id); mu.Status != "Queued" || len(calls) != 0 {
+		t.Fatalf("ran outside window: status=%s calls=%v", mu.Status, calls)
+	}
+
+	now = time.Date(2024, 6, 2, 4, 30, 0, 0, time.UTC)
+	runDueMaintenance(context.Background(), db)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// The mod has no available version, so the update itself fails.
+	if st := waitUpdateJob(ctx, getUpdateJob(id)); st != StateFailed {
+		t.Fatalf("state = %q", st)
+	}
+	lock := maintenanceLock(inst.ID)
+	lock <- struct{}{}
+	<-lock
+	if len(calls) != 2 || calls[0] != "stop:s1" || calls[1] != "start:s1" {
+		t.Fatalf("calls = %v", calls)
+	}
+	evs, err := dbpkg.ListEvents(db, inst.ID, 10)
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(evs) != 2 || evs[0].Action != "server_started" || evs[1].Action != "server_stopped" {
+		t.Fatalf("events = %+v", evs)
+	}
+}
+
+func TestRunMaintenance_StopFailureFailsUpdates(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	inst := &dbpkg.Instance{Name: "srv", Loader: "fabric", PufferpanelServerID: "s1"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	m := &dbpkg.Mod{Name: "lib", URL: "https://modrinth.com/mod/lib", InstanceID: inst.ID, CurrentVersion: "1.0.0", AvailableVersion: "1.1.0", Channel: "release", Loader: "fabric"}
+	if err := dbpkg.InsertMod(db, m); err != nil {
+		t.Fatalf("insert mod: %v", err)
+	}
+	oldStop := ppStopServer
+	ppStopServer = func(ctx context.Context, id string) error { return errors.New("daemon offline") }
+	defer func() { ppStopServer = oldStop }()
+	started := false
+	oldStart := ppStartServer
+	ppStartServer = func(ctx context.Context, id string) error { started = true; return nil }
+	defer func() { ppStartServer = oldStart }()
+
+	id, err := queueUpdateJob(context.Background(), db, m.ID, "", "auto:stop", nil)
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	defer updateJobs.Delete(id)
+	runMaintenance(context.Background(), db, inst, true, []int{id})
+
+	mu, err := dbpkg.GetModUpdate(db, id)
+	if err != nil {
+		t.Fatalf("get update: %v", err)
+	}
+	if mu.Status != string(StateFailed) || mu.Error != "daemon offline" || started {
+		t.Fatalf("update %+v, started=%v", mu, started)
+	}
+	evs, _ := dbpkg.ListEvents(db, inst.ID, 10)
+	if len(evs) != 1 || evs[0].Action != "server_stop_failed" {
+		t.Fatalf("events = %+v", evs)
+	}
+}
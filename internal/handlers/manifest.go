@@ -0,0 +1,625 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"modsentinel/internal/backend"
+	dbpkg "modsentinel/internal/db"
+	"modsentinel/internal/httpx"
+	"modsentinel/internal/manifest"
+	mr "modsentinel/internal/modrinth"
+	pppkg "modsentinel/internal/pufferpanel"
+	"modsentinel/internal/telemetry"
+)
+
+// Actions of manifest plan items.
+const (
+	planActionInstall = "install"
+	planActionUpdate  = "update"
+	planActionRemove  = "remove"
+)
+
+// maxManifestSize bounds a manifest request body.
+const maxManifestSize = 1 << 20
+
+// manifestFieldChange is an instance setting a manifest changes.
+type manifestFieldChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// manifestPlan is what applying a manifest would change on an instance.
+// Removals come first so a swapped mod is gone before its replacement
+// lands. ServerDrift is set when the server's jars differ from the tracked
+// mods the plan was computed against.
+type manifestPlan struct {
+	InstanceID  int                  `json:"instance_id"`
+	Loader      *manifestFieldChange `json:"loader,omitempty"`
+	GameVersion *manifestFieldChange `json:"game_version,omitempty"`
+	Items       []updatePlanItem     `json:"items"`
+	Unchanged   int                  `json:"unchanged"`
+	TotalSize   int64                `json:"total_size"`
+	ServerDrift *serverDriftReport   `json:"server_drift,omitempty"`
+	Warnings    []string             `json:"warnings,omitempty"`
+}
+
+// blockers maps each blocked item's slug to its reasons.
+func (p *manifestPlan) blockers() map[string]string {
+	out := map[string]string{}
+	for _, it := range p.Items {
+		if len(it.Blockers) > 0 {
+			out[it.Slug] = strings.Join(it.Blockers, "; ")
+		}
+	}
+	return out
+}
+
+// readManifestRequest resolves the instance and parses the manifest sent as
+// the request body. It writes the error response and returns nil on
+// failure.
+func readManifestRequest(w http.ResponseWriter, r *http.Request, db *sql.DB) (*dbpkg.Instance, *manifest.Manifest) {
+	inst := loadWindowInstance(w, r, db)
+	if inst == nil {
+		return nil, nil
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxManifestSize))
+	if err != nil {
+		httpx.Write(w, r, httpx.BadRequest("manifest too large"))
+		return nil, nil
+	}
+	man, err := manifest.Parse(data)
+	if err != nil {
+		httpx.Write(w, r, httpx.BadRequest(err.Error()))
+		return nil, nil
+	}
+	details := map[string]string{}
+	if man.Loader != "" && !strings.EqualFold(man.Loader, inst.Loader) && !isValidLoader(r.Context(), man.Loader) {
+		details["loader"] = "invalid"
+	}
+	for i, m := range man.Mods {
+		if _, ok := lookupSource(m.Source); !ok {
+			details[fmt.Sprintf("mods[%d].source", i)] = "invalid"
+		}
+	}
+	if len(details) > 0 {
+		httpx.Write(w, r, httpx.BadRequest("validation failed").WithDetails(details))
+		return nil, nil
+	}
+	return inst, man
+}
+
+// planManifest compares a manifest with the instance's tracked mods. Mods
+// at another version are updated and untracked ones installed, both to the
+// exact version declared; tracked mods the manifest omits are removed.
+// Downgrades, unknown versions and dependencies the manifest does not list
+// block their item.
+func planManifest(ctx context.Context, db *sql.DB, inst *dbpkg.Instance, man *manifest.Manifest) (*manifestPlan, error) {
+	plan := &manifestPlan{InstanceID: inst.ID, Items: []updatePlanItem{}}
+	target := *inst
+	if man.Loader != "" && !strings.EqualFold(man.Loader, inst.Loader) {
+		plan.Loader = &manifestFieldChange{From: inst.Loader, To: man.Loader}
+		target.Loader = man.Loader
+	}
+	if man.GameVersion != "" && man.GameVersion != inst.GameVersion {
+		plan.GameVersion = &manifestFieldChange{From: inst.GameVersion, To: man.GameVersion}
+		target.GameVersion = man.GameVersion
+	}
+	mods, err := dbpkg.ListMods(db, inst.ID)
+	if err != nil {
+		return nil, err
+	}
+	tracked := map[string]*dbpkg.Mod{}
+	for i := range mods {
+		m := &mods[i]
+		slug, err := modSlug(m)
+		if err != nil {
+			continue
+		}
+		key := manifest.Mod{Source: m.Source, Slug: slug}.Key()
+		if _, ok := tracked[key]; !ok {
+			tracked[key] = m
+		}
+	}
+	declared := map[string]bool{}
+	for _, want := range man.Mods {
+		declared[strings.ToLower(want.Slug)] = true
+	}
+
+	kept := map[int]bool{}
+	var changes []updatePlanItem
+	for _, want := range man.Mods {
+		src, _ := lookupSource(want.Source)
+		item := updatePlanItem{Source: src.Name(), Slug: want.Slug, ToVersion: want.Version, Dependencies: []depInstall{}}
+		if m, ok := tracked[want.Key()]; ok {
+			kept[m.ID] = true
+			if m.CurrentVersion == want.Version {
+				plan.Unchanged++
+				continue
+			}
+			item.Action, item.ModID, item.Name, item.FromVersion, item.Channel = planActionUpdate, m.ID, m.Name, m.CurrentVersion, m.Channel
+			if m.CurrentVersion != "" && compareVersions(want.Version, m.CurrentVersion) < 0 {
+				item.Blockers = append(item.Blockers, "older than the installed "+m.CurrentVersion+"; roll the mod back instead")
+			}
+		} else {
+			item.Action = planActionInstall
+			p, err := src.Project(ctx, want.Slug)
+			if err != nil {
+				if !errors.Is(err, errProjectNotFound) {
+					return nil, err
+				}
+				item.Name = want.Slug
+				item.Blockers = append(item.Blockers, "project not found on "+src.Name())
+				changes = append(changes, item)
+				continue
+			}
+			item.Name = p.Title
+		}
+		if err := resolveManifestVersion(ctx, db, &target, src, &item, declared); err != nil {
+			return nil, err
+		}
+		plan.TotalSize += item.Size
+		changes = append(changes, item)
+	}
+	// ListMods is newest first; remove in insertion order.
+	for i := len(mods) - 1; i >= 0; i-- {
+		m := &mods[i]
+		if kept[m.ID] {
+			continue
+		}
+		slug, _ := modSlug(m)
+		plan.Items = append(plan.Items, updatePlanItem{
+			Action:       planActionRemove,
+			ModID:        m.ID,
+			Source:       m.Source,
+			Name:         m.Name,
+			Slug:         slug,
+			FromVersion:  m.CurrentVersion,
+			Channel:      m.Channel,
+			Dependencies: []depInstall{},
+		})
+	}
+	plan.Items = append(plan.Items, changes...)
+
+	if strings.TrimSpace(inst.PufferpanelServerID) != "" {
+		rep, err := diffDrift(ctx, db, inst)
+		switch {
+		case err != nil:
+			plan.Warnings = append(plan.Warnings, "server not checked for drift: "+err.Error())
+		case rep.drifted():
+			plan.ServerDrift = rep
+			plan.Warnings = append(plan.Warnings, "server jars differ from the tracked mods; sync the instance to plan against what is installed")
+		}
+	}
+	return plan, nil
+}
+
+// resolveManifestVersion finds item's target version on src and fills in
+// its file and dependencies. Dependencies the manifest declares are left to
+// their own items; the others block the item, since the next apply would
+// remove them again.
+func resolveManifestVersion(ctx context.Context, db *sql.DB, inst *dbpkg.Instance, src Source, item *updatePlanItem, declared map[string]bool) error {
+	versions, err := src.Versions(ctx, item.Slug, "", "")
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(versions, func(v mr.Version) bool { return v.VersionNumber == item.ToVersion })
+	if i < 0 {
+		item.Blockers = append(item.Blockers, "version "+item.ToVersion+" not found")
+		return nil
+	}
+	v := versions[i]
+	item.VersionID = v.ID
+	item.Channel = strings.ToLower(v.VersionType)
+	if f, ok := v.PrimaryFile(); ok {
+		item.URL, item.Size, item.File = f.URL, f.Size, f.Filename
+		if item.File == "" {
+			item.File = artifactFileName(f.URL, item.Slug, v.VersionNumber)
+		}
+	}
+	if inst.GameVersion != "" && len(v.GameVersions) > 0 && !slices.Contains(v.GameVersions, inst.GameVersion) {
+		item.Warnings = append(item.Warnings, "not published for Minecraft "+inst.GameVersion)
+	}
+	if inst.Loader != "" && len(v.Loaders) > 0 && !slices.ContainsFunc(v.Loaders, func(l string) bool { return strings.EqualFold(l, inst.Loader) }) {
+		item.Warnings = append(item.Warnings, "not published for "+inst.Loader)
+	}
+	if !resolvesDependencies(src) {
+		return nil
+	}
+	deps, err := resolveDependencies(ctx, db, inst, item.Slug, v)
+	if err != nil {
+		return err
+	}
+	item.Warnings = append(item.Warnings, deps.Warnings...)
+	item.Blockers = append(item.Blockers, deps.Blockers...)
+	for _, d := range deps.Install {
+		if !declared[strings.ToLower(d.Slug)] {
+			item.Blockers = append(item.Blockers, "requires "+d.Slug+", which the manifest does not list")
+		}
+	}
+	return nil
+}
+
+// planManifestHandler returns what applying the manifest in the request
+// body would change on the instance.
+func planManifestHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inst, man := readManifestRequest(w, r, db)
+		if inst == nil {
+			return
+		}
+		plan, err := planManifest(r.Context(), db, inst, man)
+		if err != nil {
+			writeModrinthError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(plan)
+	}
+}
+
+// applyManifestHandler plans the manifest in the request body and applies
+// it: mod changes as one batch on the update queue, then the loader and game
+// version once that batch succeeds. Plans with blockers are refused. It
+// returns { batch_id, plan }, without a batch when no mod changes.
+func applyManifestHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		policy := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("on_failure")))
+		if policy == "" {
+			policy = BatchStopOnFailure
+		}
+		if policy != BatchStopOnFailure && policy != BatchContinueOnFailure {
+			httpx.Write(w, r, httpx.BadRequest("validation failed").WithDetails(map[string]string{"on_failure": "oneof=stop continue"}))
+			return
+		}
+		inst, man := readManifestRequest(w, r, db)
+		if inst == nil {
+			return
+		}
+		if inst.RequiresLoader && man.Loader == "" {
+			telemetry.Event("action_blocked", map[string]string{"action": "manifest_apply", "reason": "loader_required", "instance_id": strconv.Itoa(inst.ID)})
+			httpx.Write(w, r, httpx.LoaderRequired())
+			return
+		}
+		if updatesCh == nil {
+			httpx.Write(w, r, httpx.Unavailable("update queue not running"))
+			return
+		}
+		plan, err := planManifest(r.Context(), db, inst, man)
+		if err != nil {
+			writeModrinthError(w, r, err)
+			return
+		}
+		if blocked := plan.blockers(); len(blocked) > 0 {
+			httpx.Write(w, r, httpx.Conflict("manifest plan has blockers").WithDetails(blocked))
+			return
+		}
+		retarget := plan.Loader != nil || plan.GameVersion != nil
+		var batchID int
+		if len(plan.Items) > 0 {
+			placeholders, saved, err := prepareManifestItems(db, inst, plan.Items)
+			if err != nil {
+				httpx.Write(w, r, httpx.Internal(err))
+				return
+			}
+			batchID, err = dbpkg.InsertUpdateBatch(db, inst.ID, policy, len(plan.Items))
+			if err != nil {
+				restorePolicies(db, saved)
+				removePlaceholders(db, placeholders)
+				httpx.Write(w, r, httpx.Internal(err))
+				return
+			}
+			b := &dbpkg.UpdateBatch{ID: batchID, InstanceID: inst.ID, OnFailure: policy, Status: "Running", Total: len(plan.Items)}
+			ev := &updateJob{id: batchID, events: make([]sseMsg, 0, 16)}
+			updateBatches.Store(batchID, ev)
+			ctx := updatesCtx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			items := append([]updatePlanItem(nil), plan.Items...)
+			go func() {
+				runUpdateBatch(ctx, db, b, items, ev)
+				restorePolicies(db, saved)
+				removePlaceholders(db, placeholders)
+				if retarget && b.Status == string(StateSucceeded) {
+					if err := retargetInstance(db, inst.ID, man); err != nil {
+						log.Warn().Err(err).Int("instance_id", inst.ID).Int("batch_id", b.ID).Msg("apply manifest loader and game version failed")
+					}
+				}
+			}()
+		} else if retarget {
+			if err := retargetInstance(db, inst.ID, man); err != nil {
+				httpx.Write(w, r, httpx.Internal(err))
+				return
+			}
+		}
+		telemetry.Event("manifest_applied", map[string]string{
+			"instance_id": strconv.Itoa(inst.ID),
+			"batch_id":    strconv.Itoa(batchID),
+			"items":       strconv.Itoa(len(plan.Items)),
+		})
+		log.Info().Int("instance_id", inst.ID).Int("batch_id", batchID).Int("items", len(plan.Items)).Msg("manifest applied")
+		w.Header().Set("Content-Type", "application/json")
+		if batchID != 0 {
+			w.WriteHeader(http.StatusAccepted)
+		}
+		json.NewEncoder(w).Encode(struct {
+			BatchID int           `json:"batch_id,omitempty"`
+			Plan    *manifestPlan `json:"plan"`
+		}{batchID, plan})
+	}
+}
+
+// retargetInstance sets the loader and game version the manifest names on
+// the instance. It runs once the manifest's mods are in place so a failed
+// batch leaves the instance describing the mods it still has.
+func retargetInstance(db *sql.DB, instID int, man *manifest.Manifest) error {
+	inst, err := dbpkg.GetInstance(db, instID)
+	if err != nil {
+		return err
+	}
+	if man.Loader != "" {
+		inst.Loader, inst.RequiresLoader = man.Loader, false
+	}
+	if man.GameVersion != "" {
+		inst.GameVersion = man.GameVersion
+	}
+	return dbpkg.UpdateInstance(db, inst)
+}
+
+// prepareManifestItems readies plan items for the update queue. Updated and
+// installed mods are pinned to their manifest version for the batch; installs
+// are tracked as placeholders without a current version, which runUpdateJob
+// fills in. It returns the placeholder IDs and the policies the pins
+// replaced, for restorePolicies once the batch ends.
+func prepareManifestItems(db *sql.DB, inst *dbpkg.Instance, items []updatePlanItem) ([]int, map[int]*dbpkg.UpdatePolicy, error) {
+	var placeholders []int
+	saved := map[int]*dbpkg.UpdatePolicy{}
+	undo := func(err error) ([]int, map[int]*dbpkg.UpdatePolicy, error) {
+		restorePolicies(db, saved)
+		removePlaceholders(db, placeholders)
+		return nil, nil, err
+	}
+	for i := range items {
+		it := &items[i]
+		switch it.Action {
+		case planActionInstall:
+			m := dbpkg.Mod{
+				Name:             it.Name,
+				URL:              sourceModURL(it.Source, it.Slug),
+				GameVersion:      inst.GameVersion,
+				Loader:           inst.Loader,
+				Channel:          it.Channel,
+				AvailableVersion: it.ToVersion,
+				AvailableChannel: it.Channel,
+				InstanceID:       inst.ID,
+				Source:           it.Source,
+			}
+			if err := dbpkg.InsertMod(db, &m); err != nil {
+				return undo(err)
+			}
+			it.ModID = m.ID
+			placeholders = append(placeholders, m.ID)
+		case planActionUpdate:
+			if _, err := db.Exec(`UPDATE mods SET available_version=?, available_channel=? WHERE id=?`, it.ToVersion, it.Channel, it.ModID); err != nil {
+				return undo(err)
+			}
+		default:
+			continue
+		}
+		pol, err := dbpkg.GetModPolicy(db, it.ModID)
+		if err != nil {
+			return undo(err)
+		}
+		prev := *pol
+		saved[it.ModID] = &prev
+		allowMajor := true
+		pol.Pin, pol.AllowMajor = it.ToVersion, &allowMajor
+		if err := dbpkg.SetModPolicy(db, it.ModID, pol); err != nil {
+			return undo(err)
+		}
+	}
+	return placeholders, saved, nil
+}
+
+// restorePolicies puts back the mod policies a manifest batch pinned over,
+// dropping overrides the mods did not have before.
+func restorePolicies(db *sql.DB, saved map[int]*dbpkg.UpdatePolicy) {
+	for id, pol := range saved {
+		var err error
+		if *pol == (dbpkg.UpdatePolicy{}) {
+			err = dbpkg.DeleteModPolicy(db, id)
+		} else {
+			err = dbpkg.SetModPolicy(db, id, pol)
+		}
+		if err != nil {
+			log.Warn().Err(err).Int("mod_id", id).Msg("restore mod policy failed")
+		}
+	}
+}
+
+// removePlaceholders stops tracking installs that never landed.
+func removePlaceholders(db *sql.DB, ids []int) {
+	for _, id := range ids {
+		if m, err := dbpkg.GetMod(db, id); err == nil && m.CurrentVersion == "" {
+			if err := dbpkg.DeleteMod(db, id); err != nil {
+				log.Warn().Err(err).Int("mod_id", id).Msg("remove install placeholder failed")
+			}
+		}
+	}
+}
+
+// enqueueRemoveJob queues removal of a mod on the update queue.
+func enqueueRemoveJob(ctx context.Context, db *sql.DB, modID int, key string) (int, error) {
+	m, err := dbpkg.GetMod(db, modID)
+	if err != nil {
+		return 0, err
+	}
+	updID, err := dbpkg.InsertModRemoveQueued(db, modID, m.CurrentVersion, key)
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := updateJobs.Load(updID); !ok {
+		uj := &updateJob{id: updID, events: make([]sseMsg, 0, 16), db: db, updID: updID}
+		updateJobs.Store(updID, uj)
+		uj.emitState(StateQueued, nil)
+	}
+	if updatesCh != nil {
+		select {
+		case updatesCh <- updID:
+		default:
+		}
+	}
+	return updID, nil
+}
+
+// runRemoveJob deletes a mod's jars from the instance's server, verifies
+// they are gone and stops tracking the mod, mirroring the state machine of
+// runUpdateJob. Jars are those scanned for the mod and the names sync would
+// look for. The first jar and a snapshot of the mod are kept as a rollback
+// point, and deleted jars are put back when the removal fails.
+func runRemoveJob(ctx context.Context, db *sql.DB, uj *updateJob, mu *dbpkg.ModUpdateRow) {
+	fail := func(msg string) {
+		uj.emitState(StateFailed, map[string]any{"error": msg})
+		telemetry.Event("mod_remove_failed", map[string]string{
+			"job_id": strconv.Itoa(uj.id),
+			"mod_id": strconv.Itoa(mu.ModID),
+			"error":  msg,
+		})
+	}
+	m, err := dbpkg.GetMod(db, mu.ModID)
+	if errors.Is(err, sql.ErrNoRows) {
+		uj.emitState(StateSucceeded, map[string]any{"mod_id": mu.ModID, "reason": "already_removed"})
+		return
+	}
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	inst, err := dbpkg.GetInstance(db, m.InstanceID)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	var prevFile, prevSum string
+	var prevJar []byte
+	var restore func()
+	if serverID := strings.TrimSpace(inst.PufferpanelServerID); serverID != "" {
+		acquireUpdate(inst.ID)
+		defer releaseUpdate(inst.ID)
+		srv := backendFor(inst)
+		folder := instanceModFolder(inst)
+		names := map[string]bool{}
+		for _, c := range modFileCandidates(m) {
+			names[c] = true
+		}
+		scans, err := dbpkg.ListInstanceScans(db, inst.ID)
+		if err != nil {
+			fail(err.Error())
+			return
+		}
+		for _, sc := range scans {
+			if sc.ModID != nil && *sc.ModID == m.ID {
+				names[strings.ToLower(sc.File)] = true
+			}
+		}
+		var files []backend.FileEntry
+		if _, err := withRetryCount(ctx, func() error {
+			var e error
+			files, e = srv.ListPath(ctx, serverID, folder)
+			return e
+		}); err != nil && !errors.Is(err, backend.ErrNotFound) {
+			fail(err.Error())
+			return
+		}
+		var targets []string
+		for _, f := range files {
+			if !f.IsDir && names[strings.ToLower(f.Name)] {
+				targets = append(targets, f.Name)
+			}
+		}
+		jars := make(map[string][]byte, len(targets))
+		for _, name := range targets {
+			var data []byte
+			if _, err := withRetryCount(ctx, func() error {
+				var e error
+				data, e = srv.FetchFile(ctx, serverID, folder+name)
+				return e
+			}); err != nil {
+				fail(err.Error())
+				return
+			}
+			jars[name] = data
+			cacheJar(data, nil)
+		}
+		var deleted []string
+		restore = func() {
+			for _, name := range deleted {
+				if _, err := withRetryCount(ctx, func() error { return srv.PutFile(ctx, serverID, folder+name, jars[name]) }); err != nil {
+					log.Warn().Err(err).Int("mod_id", m.ID).Str("file", folder+name).Msg("restore removed jar failed")
+				}
+			}
+		}
+		for _, name := range targets {
+			uj.emitState(StateRemovingOld, map[string]any{"file": name})
+			_, delErr := withRetryCount(ctx, func() error { return srv.DeleteFile(ctx, serverID, folder+name) })
+			var pe *pppkg.Error
+			if delErr != nil && !errors.Is(delErr, backend.ErrNotFound) && !(errors.As(delErr, &pe) && pe.Status == http.StatusNotFound) {
+				restore()
+				fail(delErr.Error())
+				return
+			}
+			deleted = append(deleted, name)
+		}
+		if len(targets) > 0 {
+			prevFile, prevJar = folder+targets[0], jars[targets[0]]
+			s := sha512.Sum512(prevJar)
+			prevSum = hex.EncodeToString(s[:])
+		}
+		if len(targets) > 0 {
+			removed := true
+			if files, err := srv.ListPath(ctx, serverID, folder); err == nil {
+				removed = !slices.ContainsFunc(targets, func(name string) bool { return hasFile(files, name) })
+			}
+			uj.emitState(StateVerifyingRemoval, map[string]any{"files": targets, "removed": removed})
+			if !removed {
+				uj.emitState(StatePartialSuccess, map[string]any{"hint": "Jar still present; please delete it manually from the server."})
+				return
+			}
+		}
+	}
+
+	uj.emitState(StateUpdatingDB, map[string]any{"mod_id": m.ID})
+	snapshot, _ := json.Marshal(m)
+	if err := dbpkg.SetModUpdateRemovedMod(db, mu.ID, string(snapshot)); err != nil {
+		log.Warn().Err(err).Int("update_id", mu.ID).Msg("record removed mod failed")
+	}
+	if err := dbpkg.DeleteMod(db, m.ID); err != nil {
+		if restore != nil {
+			restore()
+		}
+		uj.emitState(StateFailed, map[string]any{"error": err.Error(), "hint": "DB update failed."})
+		return
+	}
+	recordRollbackPoint(db, mu.ID, m, prevFile, prevJar, prevSum)
+	_ = dbpkg.InsertEvent(db, &dbpkg.ModEvent{InstanceID: m.InstanceID, ModID: &m.ID, Action: "deleted", ModName: m.Name, From: m.CurrentVersion})
+	telemetry.Event("mod_removed", map[string]string{
+		"job_id": strconv.Itoa(uj.id),
+		"mod_id": strconv.Itoa(m.ID),
+		"from":   m.CurrentVersion,
+	})
+	uj.emitState(StateSucceeded, map[string]any{"mod_id": m.ID})
+}
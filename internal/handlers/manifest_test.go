@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"modsentinel/internal/backend"
+	cf "modsentinel/internal/curseforge"
+	dbpkg "modsentinel/internal/db"
+	"modsentinel/internal/manifest"
+	mr "modsentinel/internal/modrinth"
+)
+
+func TestManifest_PlanAndApply(t *testing.T) {
+	updateJobs.Range(func(k, _ any) bool { updateJobs.Delete(k); return true })
+	db := setupDB(t)
+	defer db.Close()
+	inst := &dbpkg.Instance{Name: "gitops", Loader: "fabric", GameVersion: "1.20.1", Backend: backend.Local, PufferpanelServerID: "srv"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatal(err)
+	}
+	// InsertInstance leaves the game version unset.
+	if err := dbpkg.UpdateInstance(db, inst); err != nil {
+		t.Fatal(err)
+	}
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("jar:" + r.URL.Path))
+	}))
+	defer cdn.Close()
+	version := func(slug, number string) mr.Version {
+		v := depVersion(number, slug, "release", time.Now())
+		v.Files[0].URL = cdn.URL + "/" + slug + "-" + number + ".jar"
+		v.Files[0].Hashes = map[string]string{"sha512": sha512Hex("jar:/" + slug + "-" + number + ".jar")}
+		return v
+	}
+	broken := version("broken", "1.0")
+	broken.Files[0].Hashes = map[string]string{"sha512": sha512Hex("other")}
+	old := modClient
+	modClient = depClient{versions: map[string][]mr.Version{
+		"lib":    {version("lib", "1.1.0"), version("lib", "1.0.0")},
+		"newmod": {version("newmod", "0.9")},
+		"keep":   {version("keep", "3.0")},
+		"broken": {broken},
+	}}
+	defer func() { modClient = old }()
+	track := func(slug, v string) *dbpkg.Mod {
+		m := &dbpkg.Mod{Name: slug, URL: "https://modrinth.com/mod/" + slug, Channel: "release", CurrentVersion: v, InstanceID: inst.ID}
+		if err := dbpkg.InsertMod(db, m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	lib, gone := track("lib", "1.0.0"), track("gone", "2.0")
+	track("keep", "3.0")
+	// The batch pins lib to its manifest version, then restores this.
+	autoApply := true
+	if err := dbpkg.SetModPolicy(db, lib.ID, &dbpkg.UpdatePolicy{AutoApply: &autoApply}); err != nil {
+		t.Fatal(err)
+	}
+	server := fakeBackend{
+		"mods/lib-1.0.0.jar": []byte("lib"),
+		"mods/gone-2.0.jar":  []byte("gone"),
+		"mods/keep-3.0.jar":  []byte("keep"),
+		// Not tracked; installing newmod must leave it alone.
+		"mods/newmod-extra-1.0.jar": []byte("extra"),
+	}
+	server.install(t, backend.Local)
+
+	doc := "game_version: 1.20.2\nmods:\n  - slug: lib\n    version: 1.1.0\n  - slug: newmod\n    version: '0.9'\n  - slug: keep\n    version: '3.0'\n"
+	call := func(h http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", strconv.Itoa(inst.ID))
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		h(w, req)
+		return w
+	}
+
+	w := call(planManifestHandler(db), doc)
+	if w.Code != http.StatusOK {
+		t.Fatalf("plan status %d: %s", w.Code, w.Body.String())
+	}
+	var plan manifestPlan
+	if err := json.Unmarshal(w.Body.Bytes(), &plan); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, it := range plan.Items {
+		got = append(got, it.Action+":"+it.Slug+":"+it.FromVersion+">"+it.ToVersion)
+	}
+	if want := "remove:gone:2.0> update:lib:1.0.0>1.1.0 install:newmod:>0.9"; strings.Join(got, " ") != want || plan.Unchanged != 1 {
+		t.Fatalf("plan items = %v, unchanged %d", got, plan.Unchanged)
+	}
+	if plan.GameVersion == nil || plan.GameVersion.To != "1.20.2" || plan.Loader != nil ||
+		plan.ServerDrift == nil || len(plan.ServerDrift.Added) != 1 || plan.ServerDrift.Added[0].File != "newmod-extra-1.0.jar" {
+		t.Fatalf("plan = %+v", plan)
+	}
+
+	// Downgrades block the plan and apply refuses it.
+	man, err := manifest.Parse([]byte("mods:\n  - slug: lib\n    version: 1.0.0-rc1\n  - slug: keep\n    version: '3.0'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocked, err := planManifest(context.Background(), db, inst, man)
+	if err != nil || len(blocked.blockers()) != 1 || blocked.blockers()["lib"] == "" {
+		t.Fatalf("blocked plan = %+v, %v", blocked, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := StartUpdateQueue(ctx, db)
+	defer func() { stop(context.Background()); updatesCh = nil }()
+	if w := call(applyManifestHandler(db), "mods:\n  - slug: lib\n    version: 0.1.0\n"); w.Code != http.StatusConflict {
+		t.Fatalf("blocked apply status %d", w.Code)
+	}
+
+	// waitBatch waits for a batch and for the instance settings applied after it.
+	waitBatch := func(id int) *dbpkg.UpdateBatch {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			b, err := dbpkg.GetUpdateBatch(db, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := dbpkg.GetInstance(db, inst.ID)
+			if b.FinishedAt != "" && (b.Status != string(StateSucceeded) || got.GameVersion != inst.GameVersion) || time.Now().After(deadline) {
+				return b
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	w = call(applyManifestHandler(db), doc)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("apply status %d: %s", w.Code, w.Body.String())
+	}
+	var ack struct {
+		BatchID int `json:"batch_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &ack); err != nil || ack.BatchID == 0 {
+		t.Fatalf("apply response %s", w.Body.String())
+	}
+	if b := waitBatch(ack.BatchID); b.Status != string(StateSucceeded) || b.Succeeded != 3 {
+		t.Fatalf("batch = %+v", b)
+	}
+
+	if _, err := dbpkg.GetMod(db, gone.ID); err == nil {
+		t.Fatal("removed mod still tracked")
+	}
+	if m, _ := dbpkg.GetMod(db, lib.ID); m.CurrentVersion != "1.1.0" {
+		t.Fatalf("lib = %+v", m)
+	}
+	if pol, _ := dbpkg.GetModPolicy(db, lib.ID); pol.Pin != "" || pol.AllowMajor != nil || pol.AutoApply == nil || !*pol.AutoApply {
+		t.Fatalf("lib policy = %+v", pol)
+	}
+	mods, err := dbpkg.ListMods(db, inst.ID)
+	if err != nil || len(mods) != 3 {
+		t.Fatalf("mods = %+v, %v", mods, err)
+	}
+	if mods[0].Name != "NEWMOD" || mods[0].CurrentVersion != "0.9" {
+		t.Fatalf("installed = %+v", mods[0])
+	}
+	if pol, _ := dbpkg.GetModPolicy(db, mods[0].ID); *pol != (dbpkg.UpdatePolicy{}) {
+		t.Fatalf("installed policy = %+v", pol)
+	}
+	for file, want := range map[string]bool{"mods/gone-2.0.jar": false, "mods/lib-1.0.0.jar": false, "mods/lib-1.1.0.jar": true, "mods/newmod-0.9.jar": true, "mods/keep-3.0.jar": true, "mods/newmod-extra-1.0.jar": true} {
+		if _, ok := server[file]; ok != want {
+			t.Fatalf("%s present = %v", file, ok)
+		}
+	}
+	if got, _ := dbpkg.GetInstance(db, inst.ID); got.GameVersion != "1.20.2" {
+		t.Fatalf("instance game version = %q", got.GameVersion)
+	}
+
+	// Applying again changes nothing.
+	w = call(applyManifestHandler(db), doc)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "batch_id") {
+		t.Fatalf("reapply status %d: %s", w.Code, w.Body.String())
+	}
+
+	// A failed batch leaves the instance's game version alone.
+	w = call(applyManifestHandler(db), "game_version: 1.21\nmods:\n  - slug: lib\n    version: 1.1.0\n  - slug: newmod\n    version: '0.9'\n  - slug: keep\n    version: '3.0'\n  - slug: broken\n    version: '1.0'\n")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("failing apply status %d: %s", w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &ack); err != nil || ack.BatchID == 0 {
+		t.Fatalf("failing apply response %s", w.Body.String())
+	}
+	if b := waitBatch(ack.BatchID); b.Status != string(StateFailed) {
+		t.Fatalf("failing batch = %+v", b)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for mods, _ := dbpkg.ListMods(db, inst.ID); len(mods) != 3 && time.Now().Before(deadline); mods, _ = dbpkg.ListMods(db, inst.ID) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got, _ := dbpkg.GetInstance(db, inst.ID); got.GameVersion != "1.20.2" {
+		t.Fatalf("instance game version after failed batch = %q", got.GameVersion)
+	}
+}
+
+func TestPlanManifest_MissingProjectIsBlocker(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	inst := &dbpkg.Instance{Name: "gitops", Loader: "fabric"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatal(err)
+	}
+	oldCF := cfClient
+	cfClient = fakeCFClient{mod: cf.Mod{ID: 238222, Slug: "jei", Name: "JEI"}}
+	defer func() { cfClient = oldCF }()
+
+	man, err := manifest.Parse([]byte("mods:\n  - source: curseforge\n    slug: nope\n    version: '1.0'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := planManifest(context.Background(), db, inst, man)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if blocked := plan.blockers(); blocked["nope"] != "project not found on curseforge" {
+		t.Fatalf("blockers = %v", blocked)
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	dbpkg "modsentinel/internal/db"
+	"modsentinel/internal/httpx"
+	mr "modsentinel/internal/modrinth"
+	"modsentinel/internal/telemetry"
+)
+
+// modrinthCacheListLimit caps the entries returned by the admin listing.
+const modrinthCacheListLimit = 200
+
+// dbResponseStore persists Modrinth responses in the modrinth_cache table.
+type dbResponseStore struct {
+	db *sql.DB
+}
+
+func (s dbResponseStore) GetResponse(key string) (*mr.CachedResponse, error) {
+	e, err := dbpkg.GetModrinthCacheEntry(s.db, key)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	return &mr.CachedResponse{Key: e.Key, Endpoint: e.Endpoint, Body: e.Body, ETag: e.ETag, FetchedAt: e.FetchedAt, ExpiresAt: e.ExpiresAt}, nil
+}
+
+func (s dbResponseStore) PutResponse(r *mr.CachedResponse) error {
+	return dbpkg.PutModrinthCacheEntry(s.db, &dbpkg.ModrinthCacheEntry{Key: r.Key, Endpoint: r.Endpoint, Body: r.Body, ETag: r.ETag, FetchedAt: r.FetchedAt, ExpiresAt: r.ExpiresAt})
+}
+
+// SetModrinthCache persists Modrinth responses in db behind the client's
+// in-memory cache.
+func SetModrinthCache(db *sql.DB) {
+	if c, ok := modClient.(*mr.Client); ok {
+		c.SetStore(dbResponseStore{db: db})
+	}
+}
+
+// offlineMirror is set when Modrinth is answered from a local mirror.
+var offlineMirror *mr.Mirror
+
+// SetModrinthMirror answers all Modrinth requests from m instead of the
+// network.
+func SetModrinthMirror(m *mr.Mirror) {
+	offlineMirror = m
+	if c, ok := modClient.(*mr.Client); ok {
+		c.SetMirror(m)
+	}
+}
+
+// offlineManifest describes the offline mirror for the dashboard, or nil
+// when Modrinth is reached over the network.
+func offlineManifest() *mr.MirrorManifest {
+	if offlineMirror == nil {
+		return nil
+	}
+	m := offlineMirror.Manifest()
+	return &m
+}
+
+// modrinthCacheHandler lists the persisted Modrinth responses per endpoint
+// along with the most recent entries, optionally for one endpoint.
+func modrinthCacheHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpoint := r.URL.Query().Get("endpoint")
+		stats, err := dbpkg.ModrinthCacheStatsByEndpoint(db, time.Now())
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		entries, err := dbpkg.ListModrinthCacheEntries(db, endpoint, modrinthCacheListLimit)
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		ttls := make(map[string]int64, len(mr.EndpointTTLs))
+		for name, ttl := range mr.EndpointTTLs {
+			ttls[name] = int64(ttl.Seconds())
+		}
+		if stats == nil {
+			stats = []dbpkg.ModrinthCacheStats{}
+		}
+		if entries == nil {
+			entries = []dbpkg.ModrinthCacheEntry{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(struct {
+			Endpoints []dbpkg.ModrinthCacheStats `json:"endpoints"`
+			Entries   []dbpkg.ModrinthCacheEntry `json:"entries"`
+			TTLs      map[string]int64           `json:"ttl_seconds"`
+		}{stats, entries, ttls})
+	}
+}
+
+// purgeModrinthCacheHandler deletes persisted Modrinth responses by key,
+// by endpoint, or all of them, and drops the in-memory tier so purged
+// responses are refetched.
+func purgeModrinthCacheHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		endpoint, key := q.Get("endpoint"), q.Get("key")
+		if _, ok := mr.EndpointTTLs[endpoint]; endpoint != "" && !ok {
+			httpx.Write(w, r, httpx.BadRequest("unknown endpoint"))
+			return
+		}
+		n, err := dbpkg.PurgeModrinthCache(db, endpoint, key)
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		if c, ok := modClient.(*mr.Client); ok {
+			c.PurgeMemory()
+		}
+		telemetry.Event("modrinth_cache_purge", map[string]string{
+			"endpoint": endpoint,
+			"removed":  strconv.FormatInt(n, 10),
+		})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int64{"removed": n})
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dbpkg "modsentinel/internal/db"
+	mr "modsentinel/internal/modrinth"
+)
+
+func TestModrinthCacheAdmin_ListAndPurge(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	now := time.Now()
+	for _, e := range []dbpkg.ModrinthCacheEntry{
+		{Key: "GET https://api.modrinth.com/v2/project/sodium", Endpoint: "project", Body: []byte(`{"slug":"sodium"}`), ETag: `"a"`, FetchedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{Key: "GET https://api.modrinth.com/v2/project/sodium/version", Endpoint: "versions", Body: []byte(`[]`), FetchedAt: now, ExpiresAt: now.Add(-time.Minute)},
+	} {
+		e := e
+		if err := dbpkg.PutModrinthCacheEntry(db, &e); err != nil {
+			t.Fatalf("put: %v", err)
+		}
+	}
+	svc, _, _ := initSecrets(t, db)
+	h := New(db, os.DirFS("."), svc)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/modrinth-cache", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("list status %d: %s", rr.Code, rr.Body.String())
+	}
+	var out struct {
+		Endpoints []dbpkg.ModrinthCacheStats `json:"endpoints"`
+		Entries   []dbpkg.ModrinthCacheEntry `json:"entries"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(out.Endpoints) != 2 || len(out.Entries) != 2 {
+		t.Fatalf("listing = %+v", out)
+	}
+	for _, st := range out.Endpoints {
+		if st.Endpoint == "versions" && st.Expired != 1 {
+			t.Fatalf("versions stats = %+v, want one expired", st)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/admin/modrinth-cache?endpoint=bogus", nil)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("bogus purge status %d", rr.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/admin/modrinth-cache?endpoint=versions", nil)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("purge status %d: %s", rr.Code, rr.Body.String())
+	}
+	if e, err := dbpkg.GetModrinthCacheEntry(db, "GET https://api.modrinth.com/v2/project/sodium/version"); err != nil || e != nil {
+		t.Fatalf("versions entry = %+v, %v; want purged", e, err)
+	}
+	if e, err := dbpkg.GetModrinthCacheEntry(db, "GET https://api.modrinth.com/v2/project/sodium"); err != nil || e == nil || e.ETag != `"a"` {
+		t.Fatalf("project entry = %+v, %v; want kept", e, err)
+	}
+}
+
+func TestCheckUpdates_OfflineMirror(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	dir := t.TempDir()
+	now := time.Now().UTC()
+	write := func(name string, v any) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("mirror.json", mr.MirrorManifest{Format: 1, GeneratedAt: now, Projects: []string{"sodium"}})
+	write("tags/loader.json", fakeLoaderTags)
+	write("projects/AANobbMI.json", mr.Project{ID: "AANobbMI", Slug: "sodium", Title: "Sodium", Updated: now})
+	write("projects/AANobbMI.versions.json", []mr.Version{
+		{ID: "s05", ProjectID: "AANobbMI", VersionNumber: "0.5.0", VersionType: "release", DatePublished: now, GameVersions: []string{"1.20.1"}, Loaders: []string{"fabric"},
+			Files: []mr.VersionFile{{URL: "https://cdn.modrinth.com/data/AANobbMI/sodium-0.5.jar", Filename: "sodium-0.5.jar", Primary: true}}},
+		{ID: "s04", ProjectID: "AANobbMI", VersionNumber: "0.4.0", VersionType: "release", DatePublished: now.Add(-time.Hour), GameVersions: []string{"1.20.1"}, Loaders: []string{"fabric"}},
+	})
+	mirror, err := mr.OpenMirror(dir)
+	if err != nil {
+		t.Fatalf("open mirror: %v", err)
+	}
+
+	old := modClient
+	modClient = mr.NewClient()
+	defer func() { modClient = old; offlineMirror = nil }()
+	SetModrinthMirror(mirror)
+
+	inst := &dbpkg.Instance{Name: "air-gapped", Loader: "fabric", GameVersion: "1.20.1"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	m := &dbpkg.Mod{Name: "Sodium", URL: "https://modrinth.com/mod/sodium", InstanceID: inst.ID, GameVersion: "1.20.1", Loader: "fabric", CurrentVersion: "0.4.0", Channel: "release"}
+	if err := dbpkg.InsertMod(db, m); err != nil {
+		t.Fatalf("insert mod: %v", err)
+	}
+	CheckUpdates(context.Background(), db)
+	got, err := dbpkg.GetMod(db, m.ID)
+	if err != nil {
+		t.Fatalf("get mod: %v", err)
+	}
+	if got.AvailableVersion != "0.5.0" {
+		t.Fatalf("available = %q, want 0.5.0 from the mirror", got.AvailableVersion)
+	}
+	if offlineManifest() == nil {
+		t.Fatalf("dashboard should report the mirror")
+	}
+}
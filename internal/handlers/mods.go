@@ -9,10 +9,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	urlpkg "net/url"
 	"regexp"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -23,7 +23,6 @@ import (
 	dbpkg "modsentinel/internal/db"
 	"modsentinel/internal/httpx"
 	mr "modsentinel/internal/modrinth"
-	pppkg "modsentinel/internal/pufferpanel"
 	"modsentinel/internal/telemetry"
 )
 
@@ -163,7 +162,7 @@ func createInstanceHandler(db *sql.DB) http.HandlerFunc {
         name := req.Name
         // Only auto-derive name when snake_case field is provided by the frontend flow
         if name == "" && serverIDSnake != "" {
-            if s, err := ppGetServer(r.Context(), serverIDSnake); err == nil && s != nil {
+            if s, err := onConnection(serverBackends[req.Backend], req.ConnectionID).GetServer(r.Context(), serverIDSnake); err == nil && s != nil {
                 name = sanitizeName(s.Name)
                 rn := []rune(name)
                 if len(rn) > dbpkg.InstanceNameMaxLen {
@@ -183,13 +182,13 @@ func createInstanceHandler(db *sql.DB) http.HandlerFunc {
             }
             name = base
         }
-        inst := dbpkg.Instance{ID: 0, Name: name, Loader: strings.ToLower(req.Loader), PufferpanelServerID: serverID}
+        inst := dbpkg.Instance{ID: 0, Name: name, Loader: strings.ToLower(req.Loader), PufferpanelServerID: serverID, Backend: req.Backend, ConnectionID: req.ConnectionID}
         tx, err := db.BeginTx(r.Context(), nil)
         if err != nil {
             httpx.Write(w, r, httpx.Internal(err))
             return
         }
-        res, err := tx.Exec(`INSERT INTO instances(name, loader, pufferpanel_server_id) VALUES(?,?,?)`, inst.Name, inst.Loader, inst.PufferpanelServerID)
+        res, err := tx.Exec(`INSERT INTO instances(name, loader, pufferpanel_server_id, backend, connection_id) VALUES(?,?,?,?,NULLIF(?,''))`, inst.Name, inst.Loader, inst.PufferpanelServerID, inst.Backend, inst.ConnectionID)
 		if err != nil {
 			tx.Rollback()
 			httpx.Write(w, r, httpx.Internal(err))
@@ -227,6 +226,10 @@ func updateInstanceHandler(db *sql.DB) http.HandlerFunc {
         // Optional manual override for Minecraft version. When provided,
         // we treat the value as a manual setting and clear any PufferPanel key.
         GameVersion *string `json:"gameVersion"`
+        // Number of previous jars kept per mod for rollback; 0 disables
+        RollbackRetention *int `json:"rollback_retention"`
+        // Restart the PufferPanel server after updates apply
+        RestartAfterUpdate *bool `json:"restart_after_update"`
     }
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			httpx.Write(w, r, httpx.BadRequest("invalid json"))
@@ -257,6 +260,16 @@ func updateInstanceHandler(db *sql.DB) http.HandlerFunc {
             "instance_id": strconv.Itoa(inst.ID),
         })
     }
+    if req.RollbackRetention != nil {
+        if *req.RollbackRetention < 0 || *req.RollbackRetention > 50 {
+            httpx.Write(w, r, httpx.BadRequest("validation failed").WithDetails(map[string]string{"rollback_retention": "range"}))
+            return
+        }
+        inst.RollbackRetention = *req.RollbackRetention
+    }
+    if req.RestartAfterUpdate != nil {
+        inst.RestartAfterUpdate = *req.RestartAfterUpdate
+    }
     if req.GameVersion != nil {
         gv := strings.TrimSpace(*req.GameVersion)
         inst.GameVersion = gv
@@ -271,6 +284,14 @@ func updateInstanceHandler(db *sql.DB) http.HandlerFunc {
 			httpx.Write(w, r, httpx.Internal(err))
 			return
 		}
+    if req.RollbackRetention != nil {
+        // Apply a lowered retention to jars already kept
+        if mods, err := dbpkg.ListMods(db, inst.ID); err == nil {
+            for _, m := range mods {
+                pruneArtifacts(db, m.ID, inst.RollbackRetention)
+            }
+        }
+    }
 		w.Header().Set("Content-Type", "application/json")
 		w.Header().Set("Cache-Control", "no-store")
         json.NewEncoder(w).Encode(projectInstance(*inst))
@@ -345,12 +366,80 @@ func metadataHandler() http.HandlerFunc {
 	}
 }
 
+// modDependenciesHandler previews the dependencies that adding a mod would
+// install on an instance, along with warnings and blockers.
+func modDependenciesHandler(db *sql.DB) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        var req struct {
+            dbpkg.Mod
+            VersionID string `json:"version_id"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            httpx.Write(w, r, httpx.BadRequest("invalid json"))
+            return
+        }
+        m := req.Mod
+        if err := validatePayload(&m); err != nil {
+            httpx.Write(w, r, err)
+            return
+        }
+        inst, err := dbpkg.GetInstance(db, m.InstanceID)
+        if err != nil {
+            if errors.Is(err, sql.ErrNoRows) {
+                httpx.Write(w, r, httpx.NotFound("instance not found"))
+                return
+            }
+            httpx.Write(w, r, httpx.Internal(err))
+            return
+        }
+        src, slug, err := resolveModSource(&m)
+        if err != nil {
+            httpx.Write(w, r, httpx.BadRequest(err.Error()))
+            return
+        }
+        var target *mr.Version
+        if vid := strings.TrimSpace(req.VersionID); vid != "" {
+            target, err = sourceVersion(r.Context(), src, slug, vid)
+            if err != nil {
+                writeModrinthError(w, r, err)
+                return
+            }
+        } else {
+            versions, err := src.Versions(r.Context(), slug, m.GameVersion, m.Loader)
+            if err != nil {
+                writeModrinthError(w, r, err)
+                return
+            }
+            for i := range versions {
+                if m.Channel == "" || strings.EqualFold(versions[i].VersionType, m.Channel) {
+                    target = &versions[i]
+                    break
+                }
+            }
+            if target == nil {
+                httpx.Write(w, r, httpx.BadRequest("no version found for channel"))
+                return
+            }
+        }
+        plan, err := resolveDependencies(r.Context(), db, inst, slug, *target)
+        if err != nil {
+            writeModrinthError(w, r, err)
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        w.Header().Set("Cache-Control", "no-store")
+        json.NewEncoder(w).Encode(plan)
+    }
+}
+
 func createModHandler(db *sql.DB) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         // Accept core mod fields plus an optional explicit version id chosen in the wizard
         var req struct {
             dbpkg.Mod
             VersionID string `json:"version_id"`
+            // SkipDependencies installs only the requested mod
+            SkipDependencies bool `json:"skip_dependencies"`
         }
         if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
             httpx.Write(w, r, httpx.BadRequest("invalid json"))
@@ -376,7 +465,7 @@ func createModHandler(db *sql.DB) http.HandlerFunc {
             // No enforcement; surface as a warning for clients that care
             warning = "loader mismatch"
         }
-        slug, err := parseModrinthSlug(m.URL)
+        src, slug, err := resolveModSource(&m)
         if err != nil {
             httpx.Write(w, r, httpx.BadRequest(err.Error()))
             return
@@ -385,12 +474,13 @@ func createModHandler(db *sql.DB) http.HandlerFunc {
             writeModrinthError(w, r, err)
             return
         }
-        // If client provided an explicit Modrinth version ID, honor it.
+        // If client provided an explicit version ID, honor it.
         // Keep the selected file URL separate so later enrichment does not overwrite it.
         selectedURL := ""
         selectedVersion := ""
+        var target mr.Version
         if vid := strings.TrimSpace(req.VersionID); vid != "" {
-            versions, err := guardedVersions(r.Context(), slug, m.GameVersion, m.Loader)
+            versions, err := src.Versions(r.Context(), slug, m.GameVersion, m.Loader)
             if err != nil {
                 writeModrinthError(w, r, err)
                 return
@@ -398,7 +488,9 @@ func createModHandler(db *sql.DB) http.HandlerFunc {
             found := false
             for _, v := range versions {
                 if v.ID == vid {
+                    target = v
                     m.CurrentVersion = v.VersionNumber
+                    m.ProjectID, m.VersionID = v.ProjectID, v.ID
                     m.Channel = strings.ToLower(v.VersionType)
                     if len(v.Files) > 0 {
                         m.DownloadURL = v.Files[0].URL
@@ -422,15 +514,49 @@ func createModHandler(db *sql.DB) http.HandlerFunc {
                 writeModrinthError(w, r, err)
                 return
             }
+            versions, err := src.Versions(r.Context(), slug, m.GameVersion, m.Loader)
+            if err != nil {
+                writeModrinthError(w, r, err)
+                return
+            }
+            for _, v := range versions {
+                if v.VersionNumber == m.CurrentVersion {
+                    target = v
+                    break
+                }
+            }
         }
-        if err := dbpkg.InsertMod(db, &m); err != nil {
-            httpx.Write(w, r, httpx.Internal(err))
-            return
+        var plan *depPlan
+        if !req.SkipDependencies {
+            plan, err = resolveDependencies(r.Context(), db, inst, slug, target)
+            if err != nil {
+                writeModrinthError(w, r, err)
+                return
+            }
+            if len(plan.Blockers) > 0 {
+                httpx.Write(w, r, httpx.Conflict(strings.Join(plan.Blockers, "; ")))
+                return
+            }
+        }
+        // Install dependencies first so a failure leaves the requested mod untracked
+        var installed []depInstall
+        var warnings []string
+        if plan != nil {
+            warnings = plan.Warnings
+            if _, err := installDependencies(r.Context(), db, inst, plan); err != nil {
+                var blocked *jarBlockedError
+                if errors.As(err, &blocked) {
+                    httpx.Write(w, r, httpx.Conflict("failed to install dependencies: "+err.Error()))
+                    return
+                }
+                httpx.Write(w, r, httpx.BadGateway("failed to install dependencies: "+err.Error()))
+                return
+            }
+            installed = plan.Install
         }
-        // Log event: mod added (best-effort)
-        _ = dbpkg.InsertEvent(db, &dbpkg.ModEvent{InstanceID: m.InstanceID, ModID: &m.ID, Action: "added", ModName: m.Name, To: m.CurrentVersion})
         // If this instance is linked to PufferPanel, attempt to download the selected file
         // and upload it to the appropriate folder on the server (mods/ or plugins/).
+        // Jars the scanner blocks are refused before the mod is tracked.
         // Use the explicitly selected version file if provided, otherwise fall back to current m.DownloadURL.
         dlURL := m.DownloadURL
         verForName := m.CurrentVersion
@@ -441,11 +567,7 @@ func createModHandler(db *sql.DB) http.HandlerFunc {
             }
         }
         if inst.PufferpanelServerID != "" && dlURL != "" {
-            folder := "mods/"
-            switch strings.ToLower(inst.Loader) {
-            case "paper", "spigot", "bukkit":
-                folder = "plugins/"
-            }
+            folder := instanceModFolder(inst)
             // Derive filename from URL path; fallback to slug-version.jar
             filename := func(raw string) string {
                 if u, err := urlpkg.Parse(raw); err == nil {
@@ -471,34 +593,36 @@ func createModHandler(db *sql.DB) http.HandlerFunc {
                 }
                 return base + "-" + ver + ".jar"
             }(dlURL)
-            // Fetch file bytes
-            reqDL, err := http.NewRequestWithContext(r.Context(), http.MethodGet, dlURL, nil)
+            // Fetch file bytes, from the jar cache when the version's hashes are known
+            file := fileForURL([]mr.Version{target}, dlURL)
+            data, _, err := fetchArtifact(r.Context(), file)
             if err == nil {
-                resp, err := http.DefaultClient.Do(reqDL)
-                if err == nil {
-                    defer resp.Body.Close()
-                    if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-                        data, _ := io.ReadAll(resp.Body)
-                        if len(data) > 0 {
-                            if err := pppkg.PutFile(r.Context(), inst.PufferpanelServerID, folder+filename, data); err != nil {
-                                // Surface as a non-fatal warning
-                                if warning == "" {
-                                    warning = "failed to upload file to PufferPanel"
-                                }
-                            }
-                        } else if warning == "" {
-                            warning = "failed to download selected file"
-                        }
-                    } else if warning == "" {
-                        warning = "failed to download selected file"
-                    }
-                } else if warning == "" {
+                _, err = file.Verify(data)
+            }
+            if err != nil {
+                if warning == "" {
                     warning = "failed to download selected file"
                 }
-            } else if warning == "" {
-                warning = "failed to download selected file"
+            } else if err := uploadJar(r.Context(), db, inst, nil, folder+filename, data); err != nil {
+                var blocked *jarBlockedError
+                if errors.As(err, &blocked) {
+                    httpx.Write(w, r, httpx.Conflict(err.Error()))
+                    return
+                }
+                // Surface as a non-fatal warning
+                if warning == "" {
+                    warning = "failed to upload file to PufferPanel"
+                }
+            } else {
+                cacheJar(data, file.Hashes)
             }
         }
+        if err := dbpkg.InsertMod(db, &m); err != nil {
+            httpx.Write(w, r, httpx.Internal(err))
+            return
+        }
+        // Log event: mod added (best-effort)
+        _ = dbpkg.InsertEvent(db, &dbpkg.ModEvent{InstanceID: m.InstanceID, ModID: &m.ID, Action: "added", ModName: m.Name, To: m.CurrentVersion})
         mods, err := dbpkg.ListMods(db, m.InstanceID)
         if err != nil {
             httpx.Write(w, r, httpx.Internal(err))
@@ -507,9 +631,11 @@ func createModHandler(db *sql.DB) http.HandlerFunc {
         w.Header().Set("Content-Type", "application/json")
         w.Header().Set("Cache-Control", "no-store")
         json.NewEncoder(w).Encode(struct {
-            Mods    []dbpkg.Mod `json:"mods"`
-            Warning string      `json:"warning,omitempty"`
-        }{mods, warning})
+            Mods         []dbpkg.Mod  `json:"mods"`
+            Warning      string       `json:"warning,omitempty"`
+            Warnings     []string     `json:"warnings,omitempty"`
+            Dependencies []depInstall `json:"dependencies,omitempty"`
+        }{mods, warning, warnings, installed})
     }
 }
 
@@ -533,12 +659,17 @@ func checkModHandler(db *sql.DB) http.HandlerFunc {
                 return
             }
         }
-		slug, err := parseModrinthSlug(m.URL)
+		slug, err := modSlug(m)
 		if err != nil {
 			httpx.Write(w, r, httpx.BadRequest(err.Error()))
 			return
 		}
-		if err := populateAvailableVersion(r.Context(), m, slug); err != nil {
+		pol, err := dbpkg.GetEffectivePolicy(db, m)
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		if err := populateAvailableVersionFor(r.Context(), m, slug, pol); err != nil {
 			writeModrinthError(w, r, err)
 			return
 		}
@@ -579,7 +710,7 @@ func updateModHandler(db *sql.DB) http.HandlerFunc {
                 return
             }
         }
-		slug, err := parseModrinthSlug(m.URL)
+		_, slug, err := resolveModSource(&m)
 		if err != nil {
 			httpx.Write(w, r, httpx.BadRequest(err.Error()))
 			return
@@ -592,20 +723,10 @@ func updateModHandler(db *sql.DB) http.HandlerFunc {
 			writeModrinthError(w, r, err)
 			return
 		}
-        if err := dbpkg.UpdateMod(db, &m); err != nil {
-            httpx.Write(w, r, httpx.Internal(err))
-            return
-        }
-        if prev.CurrentVersion != m.CurrentVersion {
-            _ = dbpkg.InsertEvent(db, &dbpkg.ModEvent{InstanceID: m.InstanceID, ModID: &m.ID, Action: "updated", ModName: m.Name, From: prev.CurrentVersion, To: m.CurrentVersion})
-        }
         // If instance is linked to PufferPanel and the version changed, reflect update on server
+        // before recording it, so a jar the scanner blocks leaves the mod unchanged
         if inst, err2 := dbpkg.GetInstance(db, m.InstanceID); err2 == nil && inst.PufferpanelServerID != "" {
-            folder := "mods/"
-            switch strings.ToLower(inst.Loader) {
-            case "paper", "spigot", "bukkit":
-                folder = "plugins/"
-            }
+            folder := instanceModFolder(inst)
             // Helper to derive filename from URL or fallback slug-version.jar
             deriveName := func(rawURL, slug, defName, version string) string {
                 if u, err := urlpkg.Parse(rawURL); err == nil {
@@ -624,45 +745,54 @@ func updateModHandler(db *sql.DB) http.HandlerFunc {
                 if ver == "" { ver = "latest" }
                 return base + "-" + ver + ".jar"
             }
-            oldSlug, _ := parseModrinthSlug(prev.URL)
-            newSlug, _ := parseModrinthSlug(m.URL)
+            oldSlug, _ := modSlug(prev)
+            newSlug, _ := modSlug(&m)
             oldName := deriveName(prev.DownloadURL, oldSlug, prev.Name, prev.CurrentVersion)
             newName := deriveName(m.DownloadURL, newSlug, m.Name, m.CurrentVersion)
             if oldName != newName || prev.CurrentVersion != m.CurrentVersion {
                 // Upload new first, verify, then delete old
                 uploaded := false
+                var blocked *jarBlockedError
                 if m.DownloadURL != "" {
-                    if reqDL, err := http.NewRequestWithContext(r.Context(), http.MethodGet, m.DownloadURL, nil); err == nil {
-                        if resp, err := http.DefaultClient.Do(reqDL); err == nil {
-                            defer resp.Body.Close()
-                            if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-                                if data, err := io.ReadAll(resp.Body); err == nil && len(data) > 0 {
-                                    if err := pppkg.PutFile(r.Context(), inst.PufferpanelServerID, folder+newName, data); err == nil {
-                                        if files, err := pppkg.ListPath(r.Context(), inst.PufferpanelServerID, folder); err == nil {
-        for _, f := range files {
-                                                if !f.IsDir && strings.EqualFold(f.Name, newName) { uploaded = true; break }
-                                            }
-                                        }
+                    versions, _ := modVersions(r.Context(), &m, newSlug, m.GameVersion, m.Loader)
+                    file := fileForURL(versions, m.DownloadURL)
+                    if data, _, err := fetchArtifact(r.Context(), file); err == nil {
+                        if _, err := file.Verify(data); err == nil {
+                            if err := uploadJar(r.Context(), db, inst, &prev.ID, folder+newName, data); err == nil {
+                                cacheJar(data, file.Hashes)
+                                if files, err := backendFor(inst).ListPath(r.Context(), inst.PufferpanelServerID, folder); err == nil {
+                                    for _, f := range files {
+                                        if !f.IsDir && strings.EqualFold(f.Name, newName) { uploaded = true; break }
                                     }
                                 }
+                            } else if errors.As(err, &blocked) {
+                                httpx.Write(w, r, httpx.Conflict(err.Error()))
+                                return
                             }
                         }
                     }
                 }
                 if uploaded {
-                    if files, err := pppkg.ListPath(r.Context(), inst.PufferpanelServerID, folder); err == nil {
+                    if files, err := backendFor(inst).ListPath(r.Context(), inst.PufferpanelServerID, folder); err == nil {
                         for _, f := range files {
                             if !f.IsDir && strings.EqualFold(f.Name, oldName) {
-                                _ = pppkg.DeleteFile(r.Context(), inst.PufferpanelServerID, folder+oldName)
+                                _ = backendFor(inst).DeleteFile(r.Context(), inst.PufferpanelServerID, folder+oldName)
                                 break
                             }
                         }
                     } else {
-                        _ = pppkg.DeleteFile(r.Context(), inst.PufferpanelServerID, folder+oldName)
+                        _ = backendFor(inst).DeleteFile(r.Context(), inst.PufferpanelServerID, folder+oldName)
                     }
                 }
             }
         }
+        if err := dbpkg.UpdateMod(db, &m); err != nil {
+            httpx.Write(w, r, httpx.Internal(err))
+            return
+        }
+        if prev.CurrentVersion != m.CurrentVersion {
+            _ = dbpkg.InsertEvent(db, &dbpkg.ModEvent{InstanceID: m.InstanceID, ModID: &m.ID, Action: "updated", ModName: m.Name, From: prev.CurrentVersion, To: m.CurrentVersion})
+        }
         mods, err := dbpkg.ListMods(db, m.InstanceID)
         if err != nil {
             httpx.Write(w, r, httpx.Internal(err))
@@ -699,12 +829,8 @@ func deleteModHandler(db *sql.DB) http.HandlerFunc {
         if mb, err := dbpkg.GetMod(db, id); err == nil { before = mb }
         if m, err := dbpkg.GetMod(db, id); err == nil {
             if inst, err2 := dbpkg.GetInstance(db, m.InstanceID); err2 == nil && inst.PufferpanelServerID != "" {
-                folder := "mods/"
-                switch strings.ToLower(inst.Loader) {
-                case "paper", "spigot", "bukkit":
-                    folder = "plugins/"
-                }
-                slug, _ := parseModrinthSlug(m.URL)
+                folder := instanceModFolder(inst)
+                slug, _ := modSlug(m)
                 // Candidate names: URL basename then slug-version.jar
                 candidates := []string{}
                 if u, err := urlpkg.Parse(m.DownloadURL); err == nil {
@@ -720,14 +846,14 @@ func deleteModHandler(db *sql.DB) http.HandlerFunc {
                 ver := strings.TrimSpace(m.CurrentVersion)
                 if ver == "" { ver = "latest" }
                 candidates = append(candidates, base+"-"+ver+".jar")
-                if files, err := pppkg.ListPath(r.Context(), inst.PufferpanelServerID, folder); err == nil {
+                if files, err := backendFor(inst).ListPath(r.Context(), inst.PufferpanelServerID, folder); err == nil {
                     present := map[string]bool{}
                     for _, f := range files { present[strings.ToLower(f.Name)] = true }
                     for _, nm := range candidates {
-                        if present[strings.ToLower(nm)] { _ = pppkg.DeleteFile(r.Context(), inst.PufferpanelServerID, folder+nm); break }
+                        if present[strings.ToLower(nm)] { _ = backendFor(inst).DeleteFile(r.Context(), inst.PufferpanelServerID, folder+nm); break }
                     }
                 } else {
-                    for _, nm := range candidates { _ = pppkg.DeleteFile(r.Context(), inst.PufferpanelServerID, folder+nm) }
+                    for _, nm := range candidates { _ = backendFor(inst).DeleteFile(r.Context(), inst.PufferpanelServerID, folder+nm) }
                 }
             }
         }
@@ -763,8 +889,8 @@ func applyUpdateHandler(db *sql.DB) http.HandlerFunc {
             httpx.Write(w, r, httpx.Internal(err))
             return
         }
-        // Determine target version (the available one) and its file URL from Modrinth
-        slug, err := parseModrinthSlug(prev.URL)
+        // Determine target version (the available one) and its file URL from its source
+        slug, err := modSlug(prev)
         if err != nil {
             httpx.Write(w, r, httpx.BadRequest("invalid mod URL"))
             return
@@ -774,7 +900,7 @@ func applyUpdateHandler(db *sql.DB) http.HandlerFunc {
             return
         }
         // Fetch all versions for the project; avoid over-filtering so we can match exact version_number
-        versions, err := modClient.Versions(r.Context(), slug, "", "")
+        versions, err := modVersions(r.Context(), prev, slug, "", "")
         if err != nil {
             writeModrinthError(w, r, err)
             return
@@ -792,19 +918,16 @@ func applyUpdateHandler(db *sql.DB) http.HandlerFunc {
             httpx.Write(w, r, httpx.BadRequest("selected update not found"))
             return
         }
-        if len(newVer.Files) == 0 || strings.TrimSpace(newVer.Files[0].URL) == "" {
+        file, ok := newVer.PrimaryFile()
+        if !ok || strings.TrimSpace(file.URL) == "" {
             httpx.Write(w, r, httpx.BadRequest("no downloadable file for update"))
             return
         }
-        targetURL := newVer.Files[0].URL
+        targetURL := file.URL
 
         // Mirror change to PufferPanel if configured: upload new first, verify, then delete old
         if inst, err2 := dbpkg.GetInstance(db, prev.InstanceID); err2 == nil && inst.PufferpanelServerID != "" {
-            folder := "mods/"
-            switch strings.ToLower(inst.Loader) {
-            case "paper", "spigot", "bukkit":
-                folder = "plugins/"
-            }
+            folder := instanceModFolder(inst)
             deriveName := func(rawURL, slug, defName, version string) string {
                 if u, err := urlpkg.Parse(rawURL); err == nil {
                     p := u.Path
@@ -820,47 +943,36 @@ func applyUpdateHandler(db *sql.DB) http.HandlerFunc {
                 if ver == "" { ver = "latest" }
                 return base + "-" + ver + ".jar"
             }
-            oldSlug, _ := parseModrinthSlug(prev.URL)
+            oldSlug, _ := modSlug(prev)
             oldName := deriveName(prev.DownloadURL, oldSlug, prev.Name, prev.CurrentVersion)
             newName := deriveName(targetURL, slug, prev.Name, prev.AvailableVersion)
 
-            // Download new artifact
-            reqDL, err := http.NewRequestWithContext(r.Context(), http.MethodGet, targetURL, nil)
-            if err != nil {
-                httpx.Write(w, r, httpx.Internal(err))
-                return
-            }
-            resp, err := http.DefaultClient.Do(reqDL)
-            if err != nil {
-                httpx.Write(w, r, httpx.Internal(err))
+            // Download new artifact, from the jar cache when available
+            data, _, err := fetchArtifact(r.Context(), file)
+            if errors.Is(err, errArtifactTooLarge) {
+                httpx.Write(w, r, httpx.BadRequest("update file too large"))
                 return
             }
-            defer resp.Body.Close()
-            if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+            var dlErr *downloadError
+            if errors.As(err, &dlErr) {
                 httpx.Write(w, r, httpx.BadRequest("failed to download update file"))
                 return
             }
-            // Prevent excessive memory usage for unexpectedly large artifacts
-            const maxArtifactSize = 128 << 20 // 128 MiB
-            if resp.ContentLength > maxArtifactSize {
-                httpx.Write(w, r, httpx.BadRequest("update file too large"))
-                return
-            }
-            data, err := io.ReadAll(io.LimitReader(resp.Body, maxArtifactSize+1))
-            if err != nil || len(data) == 0 {
-                httpx.Write(w, r, httpx.Internal(fmt.Errorf("invalid file content")))
+            if err != nil {
+                httpx.Write(w, r, httpx.Internal(err))
                 return
             }
-            if len(data) > maxArtifactSize {
-                httpx.Write(w, r, httpx.BadRequest("update file too large"))
+            if _, err := file.Verify(data); err != nil {
+                httpx.Write(w, r, httpx.BadGateway(err.Error()))
                 return
             }
-            if err := pppkg.PutFile(r.Context(), inst.PufferpanelServerID, folder+newName, data); err != nil {
-                writePPError(w, r, err)
+            if err := uploadJar(r.Context(), db, inst, &prev.ID, folder+newName, data); err != nil {
+                writeUploadError(w, r, err)
                 return
             }
+            cacheJar(data, file.Hashes)
             // Verify presence
-            if files, err := pppkg.ListPath(r.Context(), inst.PufferpanelServerID, folder); err == nil {
+            if files, err := backendFor(inst).ListPath(r.Context(), inst.PufferpanelServerID, folder); err == nil {
                 present := false
                 for _, f := range files {
                     if !f.IsDir && strings.EqualFold(f.Name, newName) { present = true; break }
@@ -874,14 +986,14 @@ func applyUpdateHandler(db *sql.DB) http.HandlerFunc {
                 return
             }
             // Delete old (best-effort)
-            if files, err := pppkg.ListPath(r.Context(), inst.PufferpanelServerID, folder); err == nil {
+            if files, err := backendFor(inst).ListPath(r.Context(), inst.PufferpanelServerID, folder); err == nil {
                 for _, f := range files {
-                    if !f.IsDir && strings.EqualFold(f.Name, oldName) { _ = pppkg.DeleteFile(r.Context(), inst.PufferpanelServerID, folder+oldName); break }
+                    if !f.IsDir && strings.EqualFold(f.Name, oldName) { _ = backendFor(inst).DeleteFile(r.Context(), inst.PufferpanelServerID, folder+oldName); break }
                 }
-            } else { _ = pppkg.DeleteFile(r.Context(), inst.PufferpanelServerID, folder+oldName) }
+            } else { _ = backendFor(inst).DeleteFile(r.Context(), inst.PufferpanelServerID, folder+oldName) }
         }
         // Now commit DB update to reflect PufferPanel (only after upload verified)
-        if _, err := db.Exec(`UPDATE mods SET current_version=?, channel=?, download_url=? WHERE id=?`, prev.AvailableVersion, prev.AvailableChannel, targetURL, prev.ID); err != nil {
+        if _, err := db.Exec(`UPDATE mods SET current_version=?, channel=?, download_url=?, version_id=NULLIF(?, '') WHERE id=?`, prev.AvailableVersion, prev.AvailableChannel, targetURL, newVer.ID, prev.ID); err != nil {
             httpx.Write(w, r, httpx.Internal(err))
             return
         }
@@ -937,17 +1049,36 @@ func enqueueModUpdateHandler(db *sql.DB) http.HandlerFunc {
 }
 
 func populateProjectInfo(ctx context.Context, m *dbpkg.Mod, slug string) error {
-	info, err := modClient.Project(ctx, slug)
+	src, err := sourceForMod(m)
+	if err != nil {
+		return err
+	}
+	info, err := src.Project(ctx, slug)
 	if err != nil {
 		return err
 	}
 	m.Name = info.Title
 	m.IconURL = info.IconURL
+	m.ClientSide, m.ServerSide = info.ClientSide, info.ServerSide
 	return nil
 }
 
+// fileForURL returns the file of versions served from rawURL, keeping its
+// published hashes so the download can be verified and served from the jar
+// cache. Unknown URLs yield a file without hashes.
+func fileForURL(versions []mr.Version, rawURL string) mr.VersionFile {
+	for _, v := range versions {
+		for _, f := range v.Files {
+			if f.URL == rawURL {
+				return f
+			}
+		}
+	}
+	return mr.VersionFile{URL: rawURL}
+}
+
 func populateVersions(ctx context.Context, m *dbpkg.Mod, slug string) error {
-	versions, err := guardedVersions(ctx, slug, m.GameVersion, m.Loader)
+	versions, err := modVersions(ctx, m, slug, m.GameVersion, m.Loader)
 	if err != nil {
 		return err
 	}
@@ -964,6 +1095,7 @@ func populateVersions(ctx context.Context, m *dbpkg.Mod, slug string) error {
 		return errors.New("no version found for channel")
 	}
 	m.CurrentVersion = current.VersionNumber
+	m.ProjectID, m.VersionID = current.ProjectID, current.ID
 	if len(current.Files) > 0 {
 		m.DownloadURL = current.Files[0].URL
 	}
@@ -974,25 +1106,50 @@ func populateVersions(ctx context.Context, m *dbpkg.Mod, slug string) error {
 }
 
 func populateAvailableVersion(ctx context.Context, m *dbpkg.Mod, slug string) error {
-	versions, err := guardedVersions(ctx, slug, m.GameVersion, m.Loader)
+	return populateAvailableVersionFor(ctx, m, slug, dbpkg.ResolvePolicy(dbpkg.UpdatePolicy{}, dbpkg.UpdatePolicy{}, m.Channel))
+}
+
+// populateAvailableVersionFor picks the newest version pol allows: the pinned
+// version when pinned, otherwise the most stable channel at or above the
+// floor, skipping major bumps when they are denied.
+func populateAvailableVersionFor(ctx context.Context, m *dbpkg.Mod, slug string, pol dbpkg.EffectivePolicy) error {
+	versions, err := modVersions(ctx, m, slug, m.GameVersion, m.Loader)
 	if err != nil {
 		return err
 	}
-	order := []string{"release", "beta", "alpha"}
-	idx := map[string]int{"release": 0, "beta": 1, "alpha": 2}
-	start := idx[strings.ToLower(m.Channel)]
-	for i := 0; i <= start; i++ {
-		ch := order[i]
+	if pol.Pin != "" {
+		m.AvailableVersion = m.CurrentVersion
+		m.AvailableChannel = m.Channel
 		for _, v := range versions {
-			if strings.EqualFold(v.VersionType, ch) {
+			if v.VersionNumber == pol.Pin {
 				m.AvailableVersion = v.VersionNumber
-				m.AvailableChannel = ch
+				m.AvailableChannel = strings.ToLower(v.VersionType)
 				if len(v.Files) > 0 {
 					m.DownloadURL = v.Files[0].URL
 				}
-				return nil
+				break
 			}
 		}
+		return nil
+	}
+	idx := map[string]int{"release": 0, "beta": 1, "alpha": 2}
+	floor := idx[strings.ToLower(pol.MinChannel)]
+	// Versions are newest first: offer the newest on a channel at or above
+	// the floor, so a newer beta wins over an older release.
+	for _, v := range versions {
+		ch := strings.ToLower(v.VersionType)
+		if i, ok := idx[ch]; !ok || i > floor {
+			continue
+		}
+		if !pol.AllowMajor && isMajorBump(m.CurrentVersion, v.VersionNumber) {
+			continue
+		}
+		m.AvailableVersion = v.VersionNumber
+		m.AvailableChannel = ch
+		if len(v.Files) > 0 {
+			m.DownloadURL = v.Files[0].URL
+		}
+		return nil
 	}
 	m.AvailableVersion = m.CurrentVersion
 	m.AvailableChannel = m.Channel
@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	urlpkg "net/url"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	dbpkg "modsentinel/internal/db"
+	"modsentinel/internal/httpx"
+	mr "modsentinel/internal/modrinth"
+	"modsentinel/internal/mrpack"
+	"modsentinel/internal/telemetry"
+)
+
+// maxMrpackUpload bounds an uploaded modpack, overrides included.
+const maxMrpackUpload = 512 << 20
+
+// mrpackImportResult reports what an import created and pushed.
+type mrpackImportResult struct {
+	Instance  instanceOut       `json:"instance"`
+	Mods      []dbpkg.Mod       `json:"mods"`
+	Untracked []string          `json:"untracked"`
+	Pushed    int               `json:"pushed"`
+	Overrides int               `json:"overrides"`
+	Failed    map[string]string `json:"failed,omitempty"`
+}
+
+// importMrpackHandler creates an instance from an uploaded .mrpack. The
+// pack's minecraft and loader dependencies set the instance's game version
+// and loader; server-side files Modrinth knows by hash become tracked mods.
+// With push=true the files and server overrides are uploaded to server_id.
+func importMrpackHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxMrpackUpload)
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			httpx.Write(w, r, httpx.BadRequest("invalid upload"))
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			httpx.Write(w, r, httpx.BadRequest("missing file"))
+			return
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			httpx.Write(w, r, httpx.BadRequest("invalid upload"))
+			return
+		}
+		pack, err := mrpack.Read(data)
+		if err != nil {
+			httpx.Write(w, r, httpx.BadRequest(err.Error()))
+			return
+		}
+		if pack.GameVersion() == "" {
+			httpx.Write(w, r, httpx.BadRequest("pack has no minecraft dependency"))
+			return
+		}
+		serverID := strings.TrimSpace(r.FormValue("server_id"))
+		push, _ := strconv.ParseBool(r.FormValue("push"))
+		if push && serverID == "" {
+			httpx.Write(w, r, httpx.BadRequest("push requires server_id"))
+			return
+		}
+		name := sanitizeName(r.FormValue("name"))
+		if name == "" {
+			name = sanitizeName(pack.Index.Name)
+		}
+		if name == "" {
+			name = "Modpack"
+		}
+		if rn := []rune(name); len(rn) > dbpkg.InstanceNameMaxLen {
+			name = string(rn[:dbpkg.InstanceNameMaxLen])
+		}
+
+		jars, err := identifyPackJars(r.Context(), pack)
+		if err != nil {
+			writeModrinthError(w, r, err)
+			return
+		}
+		res, err := importMrpack(r.Context(), db, pack, jars, name, serverID, push)
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		telemetry.Event("mrpack_import", map[string]string{
+			"instance_id": strconv.Itoa(res.Instance.ID),
+			"mods":        strconv.Itoa(len(res.Mods)),
+			"untracked":   strconv.Itoa(len(res.Untracked)),
+			"pushed":      strconv.Itoa(res.Pushed),
+			"failed":      strconv.Itoa(len(res.Failed)),
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// packJar is a server-side jar of a pack and, when Modrinth knows its
+// hash, the version and project it belongs to.
+type packJar struct {
+	file    mrpack.File
+	version *mr.Version
+	project *mr.Project
+}
+
+// identifyPackJars looks up the pack's server-side jars on Modrinth by
+// SHA-512, in one request for versions and one for projects.
+func identifyPackJars(ctx context.Context, pack *mrpack.Pack) ([]packJar, error) {
+	var jars []packJar
+	hashes := make([]string, 0, len(pack.Index.Files))
+	for _, f := range pack.Index.Files {
+		if !f.OnServer() || !isModPath(f.Path) {
+			continue
+		}
+		jars = append(jars, packJar{file: f})
+		hashes = append(hashes, f.Hashes["sha512"])
+	}
+	versions, err := modClient.VersionsByHashes(ctx, hashes, "sha512")
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, v := range versions {
+		if !slices.Contains(ids, v.ProjectID) {
+			ids = append(ids, v.ProjectID)
+		}
+	}
+	projects := map[string]mr.Project{}
+	if len(ids) > 0 {
+		list, err := modClient.Projects(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range list {
+			projects[p.ID] = p
+		}
+	}
+	for i := range jars {
+		v, ok := versions[jars[i].file.Hashes["sha512"]]
+		if !ok {
+			continue
+		}
+		if p, ok := projects[v.ProjectID]; ok {
+			jars[i].version, jars[i].project = &v, &p
+		}
+	}
+	return jars, nil
+}
+
+// importMrpack creates the instance and its mods, then pushes the pack when
+// asked. Push failures are reported per file rather than undoing the import.
+func importMrpack(ctx context.Context, db *sql.DB, pack *mrpack.Pack, jars []packJar, name, serverID string, push bool) (*mrpackImportResult, error) {
+	loader, _ := pack.Loader()
+	gameVersion := pack.GameVersion()
+
+	inst := &dbpkg.Instance{Name: name, Loader: loader, PufferpanelServerID: serverID}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		return nil, err
+	}
+	stored, err := dbpkg.GetInstance(db, inst.ID)
+	if err != nil {
+		return nil, err
+	}
+	inst = stored
+	inst.GameVersion = gameVersion
+	if err := dbpkg.UpdateInstance(db, inst); err != nil {
+		_ = dbpkg.DeleteInstance(db, inst.ID, nil)
+		return nil, err
+	}
+
+	res := &mrpackImportResult{Mods: []dbpkg.Mod{}, Untracked: []string{}}
+	fileMods := map[string]int{}
+	for _, j := range jars {
+		f, v, p := j.file, j.version, j.project
+		if v == nil {
+			res.Untracked = append(res.Untracked, f.Path)
+			continue
+		}
+		m := dbpkg.Mod{
+			Name:           p.Title,
+			IconURL:        p.IconURL,
+			URL:            "https://modrinth.com/mod/" + p.Slug,
+			GameVersion:    gameVersion,
+			Loader:         loader,
+			Channel:        strings.ToLower(v.VersionType),
+			CurrentVersion: v.VersionNumber,
+			DownloadURL:    f.Downloads[0],
+			InstanceID:     inst.ID,
+			MatchMethod:    MatchHash,
+			Source:         dbpkg.SourceModrinth,
+			ClientSide:     p.ClientSide,
+			ServerSide:     p.ServerSide,
+			ProjectID:      v.ProjectID,
+			VersionID:      v.ID,
+		}
+		if err := populateAvailableVersion(ctx, &m, p.Slug); err != nil {
+			log.Warn().Err(err).Str("slug", p.Slug).Msg("mrpack import: check available version")
+		}
+		if err := dbpkg.InsertMod(db, &m); err != nil {
+			_ = dbpkg.DeleteInstance(db, inst.ID, nil)
+			return nil, err
+		}
+		_ = dbpkg.SetModContentHash(db, m.ID, f.Hashes["sha512"])
+		_ = dbpkg.InsertEvent(db, &dbpkg.ModEvent{InstanceID: inst.ID, ModID: &m.ID, Action: "added", ModName: m.Name, To: m.CurrentVersion})
+		_ = dbpkg.SetModSyncState(db, inst.ID, p.Slug, m.CurrentVersion, JobSucceeded)
+		fileMods[f.Path] = m.ID
+		res.Mods = append(res.Mods, m)
+	}
+	if inst, err = dbpkg.GetInstance(db, inst.ID); err != nil {
+		return nil, err
+	}
+	res.Instance = projectInstance(*inst)
+
+	if push {
+		res.Failed = map[string]string{}
+		pushMrpack(ctx, db, inst, pack, fileMods, res)
+	}
+	return res, nil
+}
+
+// pushMrpack uploads the pack's server files and overrides to the
+// instance's server. Jars are verified against the pack's hashes and
+// scanned like any other install.
+func pushMrpack(ctx context.Context, db *sql.DB, inst *dbpkg.Instance, pack *mrpack.Pack, fileMods map[string]int, res *mrpackImportResult) {
+	for _, f := range pack.Index.Files {
+		if !f.OnServer() {
+			continue
+		}
+		data, err := fetchPackFile(ctx, f)
+		if err == nil && strings.HasSuffix(strings.ToLower(f.Path), ".jar") {
+			var modID *int
+			if id, ok := fileMods[f.Path]; ok {
+				modID = &id
+			}
+			if findings, blocked := scanJar(db, inst.ID, modID, path.Base(f.Path), data); blocked {
+				err = errors.New(blockReason(findings))
+			}
+		}
+		if err == nil {
+			_, err = withRetryCount(ctx, func() error { return backendFor(inst).PutFile(ctx, inst.PufferpanelServerID, f.Path, data) })
+		}
+		if err != nil {
+			res.Failed[f.Path] = err.Error()
+			continue
+		}
+		res.Pushed++
+	}
+	overrides := pack.ServerOverrideFiles()
+	names := make([]string, 0, len(overrides))
+	for p := range overrides {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+	for _, p := range names {
+		data := overrides[p]
+		if _, err := withRetryCount(ctx, func() error { return backendFor(inst).PutFile(ctx, inst.PufferpanelServerID, p, data) }); err != nil {
+			res.Failed[p] = err.Error()
+			continue
+		}
+		res.Overrides++
+	}
+}
+
+// fetchPackFile returns a pack file from the jar cache or its first allowed
+// download, verified against the pack's hashes.
+func fetchPackFile(ctx context.Context, f mrpack.File) ([]byte, error) {
+	if data, ok := cachedArtifact(mr.VersionFile{Hashes: f.Hashes}); ok {
+		return data, nil
+	}
+	var lastErr error = errors.New("no allowed download")
+	for _, raw := range f.Downloads {
+		u, err := urlpkg.Parse(raw)
+		if err != nil || u.Scheme != "https" || !slices.Contains(mrpack.AllowedDownloadHosts, u.Host) {
+			continue
+		}
+		vf := mr.VersionFile{URL: raw, Hashes: f.Hashes}
+		data, _, err := fetchArtifact(ctx, vf)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if _, err := vf.Verify(data); err != nil {
+			lastErr = err
+			continue
+		}
+		cacheJar(data, map[string]string{"sha1": f.Hashes["sha1"]})
+		return data, nil
+	}
+	return nil, fmt.Errorf("download %s: %w", f.Path, lastErr)
+}
+
+// isModPath reports whether a pack path is a jar in the mods or plugins
+// folder.
+func isModPath(p string) bool {
+	dir, file := path.Split(p)
+	return (dir == "mods/" || dir == "plugins/") && strings.HasSuffix(strings.ToLower(file), ".jar")
+}
+
+// exportMrpackHandler builds a .mrpack from an instance's Modrinth mods so
+// players can install the same set in a launcher. With side=client the pack
+// keeps only the mods whose project is required on the client. Packs for
+// modded loaders need loader_version, which ModSentinel does not track.
+func exportMrpackHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.Write(w, r, httpx.BadRequest("invalid id"))
+			return
+		}
+		inst, err := dbpkg.GetInstance(db, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			httpx.Write(w, r, httpx.NotFound("instance not found"))
+			return
+		}
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		q := r.URL.Query()
+		side := q.Get("side")
+		if side != "" && side != "client" {
+			httpx.Write(w, r, httpx.BadRequest("side must be client"))
+			return
+		}
+		if inst.GameVersion == "" {
+			httpx.Write(w, r, httpx.BadRequest("instance has no game version"))
+			return
+		}
+		deps := map[string]string{mrpack.DependencyMinecraft: inst.GameVersion}
+		if key := mrpack.DependencyFor(inst.Loader); key != "" {
+			lv := strings.TrimSpace(q.Get("loader_version"))
+			if lv == "" {
+				httpx.Write(w, r, httpx.BadRequest("loader_version required").WithDetails(map[string]string{"loader": inst.Loader}))
+				return
+			}
+			deps[key] = lv
+		}
+		mods, err := dbpkg.ListMods(db, inst.ID)
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		files, skipped, err := mrpackFiles(r.Context(), db, inst, mods, side == "client")
+		if err != nil {
+			writeModrinthError(w, r, err)
+			return
+		}
+		pack := &mrpack.Pack{Index: mrpack.Index{
+			FormatVersion: 1,
+			Game:          "minecraft",
+			VersionID:     time.Now().UTC().Format("2006.01.02"),
+			Name:          inst.Name,
+			Files:         files,
+			Dependencies:  deps,
+		}}
+		var buf bytes.Buffer
+		if err := mrpack.Write(&buf, pack); err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		if len(skipped) > 0 {
+			log.Info().Int("instance_id", inst.ID).Strs("mods", skipped).Msg("mrpack export: skipped mods without a Modrinth file")
+		}
+		telemetry.Event("mrpack_export", map[string]string{
+			"instance_id": strconv.Itoa(inst.ID),
+			"side":        side,
+			"files":       strconv.Itoa(len(files)),
+			"skipped":     strconv.Itoa(len(skipped)),
+		})
+		filename := inst.Name
+		if side != "" {
+			filename += "-" + side
+		}
+		w.Header().Set("Content-Type", "application/x-modrinth-modpack+zip")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename + ".mrpack"}))
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Mrpack-Skipped", strconv.Itoa(len(skipped)))
+		w.Write(buf.Bytes())
+	}
+}
+
+// mrpackFiles returns the pack files of an instance's Modrinth mods; with
+// clientOnly, only those required on the client. Mods from other sources or
+// without a resolvable file are returned by name.
+func mrpackFiles(ctx context.Context, db *sql.DB, inst *dbpkg.Instance, mods []dbpkg.Mod, clientOnly bool) ([]mrpack.File, []string, error) {
+	tracked, skipped, err := resolveTrackedFiles(ctx, db, mods, dbpkg.SourceModrinth)
+	if err != nil {
+		return nil, nil, err
+	}
+	files := []mrpack.File{}
+	for _, t := range tracked {
+		env := &mrpack.Env{Client: packSide(t.mod.ClientSide), Server: packSide(t.mod.ServerSide)}
+		if clientOnly && env.Client != mrpack.EnvRequired {
+			continue
+		}
+		if t.file.Hashes["sha1"] == "" || t.file.Hashes["sha512"] == "" {
+			skipped = append(skipped, t.mod.Name)
+			continue
+		}
+		files = append(files, mrpack.File{
+			Path:      instanceModFolder(inst) + t.file.Filename,
+			Hashes:    map[string]string{"sha1": t.file.Hashes["sha1"], "sha512": t.file.Hashes["sha512"]},
+			Env:       env,
+			Downloads: []string{t.file.URL},
+			FileSize:  t.file.Size,
+		})
+	}
+	return files, skipped, nil
+}
+
+// packSide maps a Modrinth side-support value to a pack env value. Unknown
+// support is treated as required so the file is never left out.
+func packSide(s string) string {
+	switch s {
+	case mrpack.EnvRequired, mrpack.EnvOptional, mrpack.EnvUnsupported:
+		return s
+	}
+	return mrpack.EnvRequired
+}
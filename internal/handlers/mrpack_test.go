@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	dbpkg "modsentinel/internal/db"
+	mr "modsentinel/internal/modrinth"
+	"modsentinel/internal/mrpack"
+)
+
+// packClient knows versions by SHA-512 and the projects they belong to.
+type packClient struct {
+	fakeModClient
+	byHash   map[string]mr.Version
+	projects []mr.Project
+}
+
+func (c packClient) VersionsByHashes(ctx context.Context, hashes []string, algorithm string) (map[string]mr.Version, error) {
+	out := map[string]mr.Version{}
+	for _, h := range hashes {
+		if v, ok := c.byHash[h]; ok {
+			out[h] = v
+		}
+	}
+	return out, nil
+}
+
+func (c packClient) Projects(ctx context.Context, ids []string) ([]mr.Project, error) {
+	return c.projects, nil
+}
+
+func packFile(path, body string, env *mrpack.Env) mrpack.File {
+	sum := sha1.Sum([]byte(body))
+	return mrpack.File{
+		Path:      path,
+		Hashes:    map[string]string{"sha1": hex.EncodeToString(sum[:]), "sha512": sha512Hex(body)},
+		Downloads: []string{"https://cdn.modrinth.com/data/" + path},
+		Env:       env,
+		FileSize:  int64(len(body)),
+	}
+}
+
+// multipartPack encodes a pack and form fields as an upload request.
+func multipartPack(t *testing.T, idx mrpack.Index, overrides map[string]string, fields map[string]string) *http.Request {
+	t.Helper()
+	var pack bytes.Buffer
+	zw := zip.NewWriter(&pack)
+	w, _ := zw.Create(mrpack.IndexName)
+	json.NewEncoder(w).Encode(idx)
+	for name, body := range overrides {
+		w, _ := zw.Create(name)
+		w.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "pack.mrpack")
+	fw.Write(pack.Bytes())
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/instances/import/mrpack", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestImportMrpack_CreatesTrackedInstanceAndPushes(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	jars := map[string]string{
+		"mods/sodium.jar":  "sodium jar",
+		"mods/custom.jar":  "custom jar",
+		"mods/zoomify.jar": "client only",
+	}
+	idx := mrpack.Index{
+		FormatVersion: 1, Game: "minecraft", VersionID: "1.0.0", Name: "Test Pack",
+		Files: []mrpack.File{
+			packFile("mods/sodium.jar", jars["mods/sodium.jar"], nil),
+			packFile("mods/custom.jar", jars["mods/custom.jar"], &mrpack.Env{Client: mrpack.EnvRequired, Server: mrpack.EnvRequired}),
+			packFile("mods/zoomify.jar", jars["mods/zoomify.jar"], &mrpack.Env{Client: mrpack.EnvRequired, Server: mrpack.EnvUnsupported}),
+		},
+		Dependencies: map[string]string{"minecraft": "1.20.1", "fabric-loader": "0.15.11"},
+	}
+	v := depVersion("0.5.0", "AANobbMI", "release", time.Now())
+	old := modClient
+	modClient = packClient{
+		byHash:   map[string]mr.Version{sha512Hex("sodium jar"): v},
+		projects: []mr.Project{{ID: "AANobbMI", Slug: "sodium", Title: "Sodium"}},
+	}
+	defer func() { modClient = old }()
+	prevClient := artifactClient
+	t.Cleanup(func() { artifactClient = prevClient })
+	artifactClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+		p := strings.TrimPrefix(req.URL.Path, "/data/")
+		body, ok := jars[p]
+		if req.URL.Host != "cdn.modrinth.com" || !ok {
+			return &http.Response{StatusCode: 404, Body: io.NopCloser(strings.NewReader(""))}
+		}
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}
+	})}
+	server := fakeServer{}
+	server.install(t)
+
+	req := multipartPack(t, idx, map[string]string{
+		"overrides/config/sodium.json":       "{}",
+		"server-overrides/server.properties": "motd=pack",
+		"client-overrides/options.txt":       "fov:90",
+	}, map[string]string{"server_id": "s1", "push": "true"})
+	rr := httptest.NewRecorder()
+	importMrpackHandler(db)(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rr.Code, rr.Body.String())
+	}
+	var res mrpackImportResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if res.Instance.Name != "Test Pack" || res.Instance.Loader != "fabric" || res.Instance.GameVersion != "1.20.1" || res.Instance.PufferpanelServerID != "s1" {
+		t.Fatalf("instance = %+v", res.Instance)
+	}
+	if len(res.Mods) != 1 || res.Mods[0].URL != "https://modrinth.com/mod/sodium" || res.Mods[0].CurrentVersion != "0.5.0" {
+		t.Fatalf("mods = %+v", res.Mods)
+	}
+	if len(res.Untracked) != 1 || res.Untracked[0] != "mods/custom.jar" {
+		t.Fatalf("untracked = %v", res.Untracked)
+	}
+	if sum, _ := dbpkg.GetModContentHash(db, res.Mods[0].ID); sum != sha512Hex("sodium jar") {
+		t.Fatalf("content hash = %q", sum)
+	}
+	if res.Pushed != 2 || res.Overrides != 2 || len(res.Failed) != 0 {
+		t.Fatalf("push = %d files, %d overrides, failed %v", res.Pushed, res.Overrides, res.Failed)
+	}
+	if string(server["mods/sodium.jar"]) != "sodium jar" || string(server["server.properties"]) != "motd=pack" || string(server["config/sodium.json"]) != "{}" {
+		t.Fatalf("server = %v", server)
+	}
+	if _, ok := server["mods/zoomify.jar"]; ok {
+		t.Fatalf("client-only jar pushed")
+	}
+	if _, ok := server["options.txt"]; ok {
+		t.Fatalf("client override pushed")
+	}
+}
+
+func TestImportMrpack_RejectsPushWithoutServer(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	idx := mrpack.Index{FormatVersion: 1, Game: "minecraft", Dependencies: map[string]string{"minecraft": "1.20.1"}}
+	rr := httptest.NewRecorder()
+	importMrpackHandler(db)(rr, multipartPack(t, idx, nil, map[string]string{"push": "true"}))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("status %d", rr.Code)
+	}
+}
+
+// exportClient adds per-slug version listings to packClient.
+type exportClient struct {
+	packClient
+	versions map[string][]mr.Version
+}
+
+func (c exportClient) Versions(ctx context.Context, slug, gameVersion, loader string) ([]mr.Version, error) {
+	return c.versions[slug], nil
+}
+
+func (c exportClient) VersionsByIDs(ctx context.Context, ids []string) ([]mr.Version, error) {
+	var out []mr.Version
+	for _, vs := range c.versions {
+		for _, v := range vs {
+			if slices.Contains(ids, v.ID) {
+				out = append(out, v)
+			}
+		}
+	}
+	return out, nil
+}
+
+func TestExportMrpack_FullAndClientPacks(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	inst := &dbpkg.Instance{Name: "Survival", Loader: "fabric"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatal(err)
+	}
+	inst, _ = dbpkg.GetInstance(db, inst.ID)
+	inst.GameVersion = "1.20.1"
+	if err := dbpkg.UpdateInstance(db, inst); err != nil {
+		t.Fatal(err)
+	}
+	sodium := dbpkg.Mod{Name: "Sodium", URL: "https://modrinth.com/mod/sodium", GameVersion: "1.20.1", Loader: "fabric", CurrentVersion: "0.5.0", InstanceID: inst.ID}
+	lithium := dbpkg.Mod{Name: "Lithium", URL: "https://modrinth.com/mod/lithium", GameVersion: "1.20.1", Loader: "fabric", CurrentVersion: "0.11.2", InstanceID: inst.ID, ClientSide: "optional", ServerSide: "required"}
+	jei := dbpkg.Mod{Name: "JEI", URL: "https://www.curseforge.com/minecraft/mc-mods/jei", InstanceID: inst.ID, Source: dbpkg.SourceCurseForge}
+	for _, m := range []*dbpkg.Mod{&sodium, &lithium, &jei} {
+		if err := dbpkg.InsertMod(db, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = dbpkg.SetModContentHash(db, sodium.ID, sha512Hex("sodium jar"))
+
+	fileOf := func(name, body string) mr.VersionFile {
+		f := packFile("mods/"+name, body, nil)
+		return mr.VersionFile{URL: "https://cdn.modrinth.com/data/" + name, Filename: name, Size: f.FileSize, Primary: true, Hashes: f.Hashes}
+	}
+	sv := depVersion("0.5.0", "AANobbMI", "release", time.Now())
+	sv.Files = []mr.VersionFile{fileOf("sodium.jar", "sodium jar")}
+	lv := depVersion("0.11.2", "gvQqBUqZ", "release", time.Now())
+	lv.Files = []mr.VersionFile{fileOf("lithium.jar", "lithium jar")}
+	old := modClient
+	modClient = exportClient{
+		packClient: packClient{
+			byHash:   map[string]mr.Version{sha512Hex("sodium jar"): sv},
+			projects: []mr.Project{{ID: "AANobbMI", Slug: "sodium", Title: "Sodium", ClientSide: "required", ServerSide: "optional"}},
+		},
+		versions: map[string][]mr.Version{"lithium": {lv}},
+	}
+	defer func() { modClient = old }()
+
+	export := func(query string) (*httptest.ResponseRecorder, *mrpack.Pack) {
+		t.Helper()
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", strconv.Itoa(inst.ID))
+		req := httptest.NewRequest(http.MethodGet, "/api/instances/"+strconv.Itoa(inst.ID)+"/export.mrpack?"+query, nil)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+		exportMrpackHandler(db)(rr, req)
+		if rr.Code != http.StatusOK {
+			return rr, nil
+		}
+		p, err := mrpack.Read(rr.Body.Bytes())
+		if err != nil {
+			t.Fatalf("read export: %v", err)
+		}
+		return rr, p
+	}
+
+	if rr, _ := export(""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("missing loader_version: status %d", rr.Code)
+	}
+	rr, full := export("loader_version=0.15.11")
+	if full == nil {
+		t.Fatalf("status %d: %s", rr.Code, rr.Body.String())
+	}
+	if l, v := full.Loader(); l != "fabric" || v != "0.15.11" || full.GameVersion() != "1.20.1" || full.Index.Name != "Survival" {
+		t.Fatalf("index = %+v", full.Index)
+	}
+	if rr.Header().Get("X-Mrpack-Skipped") != "1" {
+		t.Fatalf("skipped = %q", rr.Header().Get("X-Mrpack-Skipped"))
+	}
+	files := map[string]mrpack.File{}
+	for _, f := range full.Index.Files {
+		files[f.Path] = f
+	}
+	s, l := files["mods/sodium.jar"], files["mods/lithium.jar"]
+	if len(files) != 2 || s.Env == nil || *s.Env != (mrpack.Env{Client: "required", Server: "optional"}) || *l.Env != (mrpack.Env{Client: "optional", Server: "required"}) {
+		t.Fatalf("files = %+v", full.Index.Files)
+	}
+	if s.Hashes["sha512"] != sha512Hex("sodium jar") || s.Downloads[0] != "https://cdn.modrinth.com/data/sodium.jar" || l.FileSize != int64(len("lithium jar")) {
+		t.Fatalf("files = %+v", full.Index.Files)
+	}
+	// Side support and resolved versions are cached on the mods.
+	if m, _ := dbpkg.GetMod(db, sodium.ID); m.ClientSide != "required" || m.ServerSide != "optional" || m.VersionID != "0.5.0" {
+		t.Fatalf("sodium = %+v", m)
+	}
+	if m, _ := dbpkg.GetMod(db, lithium.ID); m.ProjectID != "gvQqBUqZ" || m.VersionID != "0.11.2" {
+		t.Fatalf("lithium = %+v", m)
+	}
+
+	_, client := export("side=client&loader_version=0.15.11")
+	if client == nil || len(client.Index.Files) != 1 || client.Index.Files[0].Path != "mods/sodium.jar" {
+		t.Fatalf("client pack = %+v", client)
+	}
+}
+
+func TestExportMrpackHandler_Errors(t *testing.T) {
+	db := setupDB(t)
+	export := func(id string) int {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		req := httptest.NewRequest(http.MethodGet, "/api/instances/"+id+"/export.mrpack", nil)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+		exportMrpackHandler(db)(rr, req)
+		return rr.Code
+	}
+	if code := export("abc"); code != http.StatusBadRequest {
+		t.Fatalf("bad id: status %d", code)
+	}
+	if code := export("99"); code != http.StatusNotFound {
+		t.Fatalf("missing instance: status %d", code)
+	}
+	db.Close()
+	if code := export("99"); code != http.StatusInternalServerError {
+		t.Fatalf("closed db: status %d", code)
+	}
+}
@@ -0,0 +1,686 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	urlpkg "net/url"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	cf "modsentinel/internal/curseforge"
+	dbpkg "modsentinel/internal/db"
+	"modsentinel/internal/httpx"
+	mr "modsentinel/internal/modrinth"
+	"modsentinel/internal/packwiz"
+	"modsentinel/internal/telemetry"
+)
+
+// maxPackwizUpload bounds an uploaded, zipped packwiz pack.
+const maxPackwizUpload = 64 << 20
+
+// packwizInstance loads the instance named in the route.
+func packwizInstance(db *sql.DB, r *http.Request) (*dbpkg.Instance, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return nil, httpx.BadRequest("invalid id")
+	}
+	inst, err := dbpkg.GetInstance(db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, httpx.NotFound("instance not found")
+	}
+	if err != nil {
+		return nil, httpx.Internal(err)
+	}
+	return inst, nil
+}
+
+// readPackwizRequest loads the pack a request names: a zip uploaded in the
+// multipart field file, a pack.toml URL in the url field or JSON body, or
+// else the URL the instance was last imported from. It returns the pack and
+// the URL it came from, if any.
+func readPackwizRequest(w http.ResponseWriter, r *http.Request, db *sql.DB, inst *dbpkg.Instance) (*packwiz.Tree, string, error) {
+	var rawURL string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		r.Body = http.MaxBytesReader(w, r.Body, maxPackwizUpload)
+		if err := r.ParseMultipartForm(8 << 20); err != nil {
+			return nil, "", httpx.BadRequest("invalid upload")
+		}
+		if file, _, err := r.FormFile("file"); err == nil {
+			data, err := io.ReadAll(file)
+			file.Close()
+			if err != nil {
+				return nil, "", httpx.BadRequest("invalid upload")
+			}
+			tree, err := packwiz.ReadZip(data)
+			if err != nil {
+				return nil, "", httpx.BadRequest(err.Error())
+			}
+			return tree, "", nil
+		}
+		rawURL = r.FormValue("url")
+	} else if r.Body != nil {
+		var req struct {
+			URL string `json:"url"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			return nil, "", httpx.BadRequest("invalid json")
+		}
+		rawURL = req.URL
+	}
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		stored, err := dbpkg.GetPackwizSource(db, inst.ID)
+		if err != nil {
+			return nil, "", httpx.Internal(err)
+		}
+		if stored == "" {
+			return nil, "", httpx.BadRequest("file or url required")
+		}
+		rawURL = stored
+	}
+	tree, err := fetchPackwiz(r.Context(), rawURL)
+	if err != nil {
+		return nil, "", httpx.BadRequest(err.Error())
+	}
+	return tree, rawURL, nil
+}
+
+// errPrivateAddress reports a pack URL that resolves to an address on the
+// host's own network.
+var errPrivateAddress = errors.New("pack url must resolve to a public address")
+
+// packwizClient fetches packs from user-supplied URLs. It connects directly,
+// never through a proxy, and only to public addresses, so a pack URL cannot
+// reach services on the host or its private network.
+var packwizClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: dialPublicOnly}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+// dialPublicOnly refuses connections to loopback, private, link-local,
+// multicast and unspecified addresses. It runs after name resolution, so
+// DNS names pointing at such addresses are refused too.
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("%s: %w", host, errPrivateAddress)
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, which netip does not
+// count as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// fetchPackwiz reads a pack served over HTTP, such as a raw view of a git
+// repository, resolving indexed files against the pack.toml URL.
+func fetchPackwiz(ctx context.Context, rawURL string) (*packwiz.Tree, error) {
+	base, err := urlpkg.Parse(rawURL)
+	if err != nil || (base.Scheme != "https" && base.Scheme != "http") || base.Host == "" {
+		return nil, errors.New("url must be an http(s) pack.toml URL")
+	}
+	if path.Base(base.Path) != packwiz.PackFile {
+		base.Path = strings.TrimSuffix(base.Path, "/") + "/" + packwiz.PackFile
+	}
+	return packwiz.Read(func(name string) ([]byte, error) {
+		u := base.ResolveReference(&urlpkg.URL{Path: name})
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := packwizClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return nil, &downloadError{Status: resp.StatusCode}
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, packwiz.MaxFileSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > packwiz.MaxFileSize {
+			return nil, fmt.Errorf("%s: too large", name)
+		}
+		return data, nil
+	})
+}
+
+// packwizMod is a server-side mod of a pack and, when its source knows it,
+// the project and version it installs.
+type packwizMod struct {
+	path    string
+	mod     packwiz.Mod
+	source  string
+	project *mr.Project
+	version *mr.Version
+}
+
+// identifyPackwizMods resolves a pack's server-side mods through their
+// update metadata: Modrinth versions and projects in bulk, CurseForge files
+// one by one. Modrinth mods without update metadata are looked up by their
+// download hash.
+func identifyPackwizMods(ctx context.Context, tree *packwiz.Tree) ([]packwizMod, []string, error) {
+	names := make([]string, 0, len(tree.Mods))
+	for name := range tree.Mods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var mods []packwizMod
+	var warnings, versionIDs []string
+	hashes := map[string][]string{}
+	for _, name := range names {
+		m := tree.Mods[name]
+		if !m.OnServer() {
+			continue
+		}
+		pm := packwizMod{path: name, mod: m}
+		switch {
+		case m.Update != nil && m.Update.Modrinth != nil:
+			pm.source = dbpkg.SourceModrinth
+			versionIDs = append(versionIDs, m.Update.Modrinth.Version)
+		case m.Update != nil && m.Update.CurseForge != nil:
+			pm.source = dbpkg.SourceCurseForge
+		case m.Download.HashFormat == "sha1" || m.Download.HashFormat == "sha512":
+			pm.source = dbpkg.SourceModrinth
+			hashes[m.Download.HashFormat] = append(hashes[m.Download.HashFormat], m.Download.Hash)
+		}
+		mods = append(mods, pm)
+	}
+
+	versions := map[string]mr.Version{}
+	if len(versionIDs) > 0 {
+		list, err := modClient.VersionsByIDs(ctx, versionIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, v := range list {
+			versions[v.ID] = v
+		}
+	}
+	byHash := map[string]mr.Version{}
+	for algo, hs := range hashes {
+		res, err := modClient.VersionsByHashes(ctx, hs, algo)
+		if err != nil {
+			return nil, nil, err
+		}
+		for h, v := range res {
+			byHash[algo+":"+strings.ToLower(h)] = v
+		}
+	}
+	var projectIDs []string
+	for i := range mods {
+		pm := &mods[i]
+		if pm.source != dbpkg.SourceModrinth {
+			continue
+		}
+		var v mr.Version
+		var ok bool
+		if u := pm.mod.Update; u != nil && u.Modrinth != nil {
+			v, ok = versions[u.Modrinth.Version]
+		} else {
+			v, ok = byHash[pm.mod.Download.HashFormat+":"+strings.ToLower(pm.mod.Download.Hash)]
+		}
+		if ok {
+			pm.version = &v
+			if !slices.Contains(projectIDs, v.ProjectID) {
+				projectIDs = append(projectIDs, v.ProjectID)
+			}
+		}
+	}
+	if len(projectIDs) > 0 {
+		list, err := modClient.Projects(ctx, projectIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+		projects := make(map[string]mr.Project, len(list))
+		for _, p := range list {
+			projects[p.ID] = p
+		}
+		for i := range mods {
+			if v := mods[i].version; v != nil {
+				if p, ok := projects[v.ProjectID]; ok {
+					mods[i].project = &p
+				} else {
+					mods[i].version = nil
+				}
+			}
+		}
+	}
+
+	for i := range mods {
+		pm := &mods[i]
+		if pm.source != dbpkg.SourceCurseForge {
+			continue
+		}
+		u := pm.mod.Update.CurseForge
+		f, err := cfClient.File(ctx, u.ProjectID, u.FileID)
+		var mod *cf.Mod
+		if err == nil {
+			mod, err = cfClient.Mod(ctx, u.ProjectID)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, nil, ctx.Err()
+			}
+			warnings = append(warnings, fmt.Sprintf("%s: %v", pm.mod.Name, err))
+			if errors.Is(err, cf.ErrNoAPIKey) {
+				break
+			}
+			continue
+		}
+		v := curseForgeVersion(*f)
+		pm.version, pm.project = &v, curseForgeProject(mod)
+	}
+	return mods, warnings, nil
+}
+
+// packwizImportResult reports how an import changed an instance's mods.
+type packwizImportResult struct {
+	Instance  instanceOut `json:"instance"`
+	Added     []dbpkg.Mod `json:"added"`
+	Updated   []dbpkg.Mod `json:"updated"`
+	Unchanged int         `json:"unchanged"`
+	Untracked []string    `json:"untracked"`
+	Warnings  []string    `json:"warnings,omitempty"`
+}
+
+// importPackwizHandler tracks a packwiz pack's server-side mods on an
+// instance. Mods already tracked are moved to the pack's version; tracked
+// mods missing from the pack are left alone and show up in reconcile. Packs
+// given by URL are remembered for later reconciles.
+func importPackwizHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inst, err := packwizInstance(db, r)
+		if err != nil {
+			httpx.Write(w, r, err)
+			return
+		}
+		if inst.RequiresLoader {
+			telemetry.Event("action_blocked", map[string]string{"action": "packwiz_import", "reason": "loader_required", "instance_id": strconv.Itoa(inst.ID)})
+			httpx.Write(w, r, httpx.LoaderRequired())
+			return
+		}
+		tree, src, err := readPackwizRequest(w, r, db, inst)
+		if err != nil {
+			httpx.Write(w, r, err)
+			return
+		}
+		mods, warnings, err := identifyPackwizMods(r.Context(), tree)
+		if err != nil {
+			writeModrinthError(w, r, err)
+			return
+		}
+		res, err := importPackwiz(r.Context(), db, inst, tree, mods)
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		res.Warnings = append(warnings, res.Warnings...)
+		if src != "" {
+			if err := dbpkg.SetPackwizSource(db, inst.ID, src); err != nil {
+				httpx.Write(w, r, httpx.Internal(err))
+				return
+			}
+		}
+		telemetry.Event("packwiz_import", map[string]string{
+			"instance_id": strconv.Itoa(inst.ID),
+			"added":       strconv.Itoa(len(res.Added)),
+			"updated":     strconv.Itoa(len(res.Updated)),
+			"untracked":   strconv.Itoa(len(res.Untracked)),
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// importPackwiz upserts the identified pack mods by project URL.
+func importPackwiz(ctx context.Context, db *sql.DB, inst *dbpkg.Instance, tree *packwiz.Tree, mods []packwizMod) (*packwizImportResult, error) {
+	res := &packwizImportResult{Added: []dbpkg.Mod{}, Updated: []dbpkg.Mod{}, Untracked: []string{}}
+	if loader, _ := tree.Loader(); loader != "" && inst.Loader != "" && !strings.EqualFold(loader, inst.Loader) {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("pack targets %s, instance uses %s", loader, inst.Loader))
+	}
+	if inst.GameVersion == "" && tree.GameVersion() != "" {
+		inst.GameVersion = tree.GameVersion()
+		if err := dbpkg.UpdateInstance(db, inst); err != nil {
+			return nil, err
+		}
+	}
+	existing, err := dbpkg.ListMods(db, inst.ID)
+	if err != nil {
+		return nil, err
+	}
+	byURL := make(map[string]dbpkg.Mod, len(existing))
+	for _, m := range existing {
+		byURL[strings.TrimSpace(strings.ToLower(m.URL))] = m
+	}
+	for _, pm := range mods {
+		if pm.version == nil || pm.project == nil {
+			res.Untracked = append(res.Untracked, pm.mod.Name)
+			continue
+		}
+		v, p := pm.version, pm.project
+		m := dbpkg.Mod{
+			Name:           p.Title,
+			IconURL:        p.IconURL,
+			URL:            sourceModURL(pm.source, p.Slug),
+			GameVersion:    inst.GameVersion,
+			Loader:         inst.Loader,
+			Channel:        strings.ToLower(v.VersionType),
+			CurrentVersion: v.VersionNumber,
+			DownloadURL:    pm.mod.Download.URL,
+			InstanceID:     inst.ID,
+			MatchMethod:    MatchPackwiz,
+			Source:         pm.source,
+			ClientSide:     p.ClientSide,
+			ServerSide:     p.ServerSide,
+			ProjectID:      v.ProjectID,
+			VersionID:      v.ID,
+		}
+		if f, ok := v.PrimaryFile(); ok && m.DownloadURL == "" {
+			m.DownloadURL = f.URL
+		}
+		if err := populateAvailableVersion(ctx, &m, p.Slug); err != nil {
+			log.Warn().Err(err).Str("slug", p.Slug).Msg("packwiz import: check available version")
+		}
+		prev, ok := byURL[strings.ToLower(m.URL)]
+		if !ok {
+			if err := dbpkg.InsertMod(db, &m); err != nil {
+				return nil, err
+			}
+			_ = dbpkg.InsertEvent(db, &dbpkg.ModEvent{InstanceID: inst.ID, ModID: &m.ID, Action: "added", ModName: m.Name, To: m.CurrentVersion})
+			res.Added = append(res.Added, m)
+			continue
+		}
+		if prev.CurrentVersion == m.CurrentVersion && prev.VersionID == m.VersionID {
+			res.Unchanged++
+			continue
+		}
+		m.ID = prev.ID
+		if err := dbpkg.UpdateMod(db, &m); err != nil {
+			return nil, err
+		}
+		_ = dbpkg.InsertEvent(db, &dbpkg.ModEvent{InstanceID: inst.ID, ModID: &m.ID, Action: "updated", ModName: m.Name, From: prev.CurrentVersion, To: m.CurrentVersion})
+		res.Updated = append(res.Updated, m)
+	}
+	stored, err := dbpkg.GetInstance(db, inst.ID)
+	if err != nil {
+		return nil, err
+	}
+	res.Instance = projectInstance(*stored)
+	return res, nil
+}
+
+// exportPackwizHandler writes an instance's Modrinth and CurseForge mods as
+// a zipped packwiz pack with update metadata, ready to commit to git. The
+// optional loader_version fills the loader entry of [versions].
+func exportPackwizHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inst, err := packwizInstance(db, r)
+		if err != nil {
+			httpx.Write(w, r, err)
+			return
+		}
+		mods, err := dbpkg.ListMods(db, inst.ID)
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		tracked, skipped, err := resolveTrackedFiles(r.Context(), db, mods, dbpkg.SourceModrinth, dbpkg.SourceCurseForge)
+		if err != nil {
+			writeModrinthError(w, r, err)
+			return
+		}
+		tree := &packwiz.Tree{
+			Pack:  packwiz.Pack{Name: inst.Name, Versions: map[string]string{}},
+			Mods:  map[string]packwiz.Mod{},
+			Files: map[string][]byte{},
+		}
+		if inst.GameVersion != "" {
+			tree.Pack.Versions[packwiz.VersionMinecraft] = inst.GameVersion
+		}
+		if lv := strings.TrimSpace(r.URL.Query().Get("loader_version")); lv != "" && inst.Loader != "" {
+			tree.Pack.Versions[strings.ToLower(inst.Loader)] = lv
+		}
+		for _, t := range tracked {
+			m, ok := packwizModFor(t)
+			if !ok {
+				skipped = append(skipped, t.mod.Name)
+				continue
+			}
+			tree.Mods[instanceModFolder(inst)+t.slug+packwiz.MetafileSuffix] = m
+		}
+		files, err := packwiz.Write(tree)
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		var buf bytes.Buffer
+		if err := packwiz.WriteZip(&buf, files); err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		telemetry.Event("packwiz_export", map[string]string{
+			"instance_id": strconv.Itoa(inst.ID),
+			"mods":        strconv.Itoa(len(tree.Mods)),
+			"skipped":     strconv.Itoa(len(skipped)),
+		})
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", inst.Name+"-packwiz.zip"))
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Packwiz-Skipped", strconv.Itoa(len(skipped)))
+		w.Write(buf.Bytes())
+	}
+}
+
+// packwizModFor describes a tracked mod as a metafile. CurseForge mods use
+// metadata mode so packwiz asks the CurseForge API for the download.
+func packwizModFor(t trackedFile) (packwiz.Mod, bool) {
+	m := packwiz.Mod{Name: t.mod.Name, Filename: t.file.Filename, Side: packwiz.Side(t.mod.ClientSide, t.mod.ServerSide)}
+	if t.file.Filename == "" {
+		return m, false
+	}
+	switch t.mod.Source {
+	case dbpkg.SourceCurseForge:
+		projectID, err1 := strconv.Atoi(t.version.ProjectID)
+		fileID, err2 := strconv.Atoi(t.version.ID)
+		if err1 != nil || err2 != nil || t.file.Hashes["sha1"] == "" {
+			return m, false
+		}
+		m.Download = packwiz.Download{Mode: packwiz.DownloadModeCurseForge, HashFormat: "sha1", Hash: t.file.Hashes["sha1"]}
+		m.Update = &packwiz.Update{CurseForge: &packwiz.CurseForgeUpdate{ProjectID: projectID, FileID: fileID}}
+	default:
+		m.Download = packwiz.Download{URL: t.file.URL, HashFormat: "sha512", Hash: t.file.Hashes["sha512"]}
+		if m.Download.Hash == "" {
+			m.Download.HashFormat, m.Download.Hash = "sha1", t.file.Hashes["sha1"]
+		}
+		if m.Download.Hash == "" || m.Download.URL == "" {
+			return m, false
+		}
+		m.Update = &packwiz.Update{Modrinth: &packwiz.ModrinthUpdate{ModID: t.version.ProjectID, Version: t.version.ID}}
+	}
+	return m, true
+}
+
+// driftItem is one mod that differs between a pack and what it is compared
+// with; Pack and Current name the jar on either side.
+type driftItem struct {
+	Name    string `json:"name"`
+	Pack    string `json:"pack,omitempty"`
+	Current string `json:"current,omitempty"`
+}
+
+// driftReport lists mods only in the pack (missing), only in ModSentinel
+// or on the server (extra), and in both at a different version (changed).
+type driftReport struct {
+	Missing []driftItem `json:"missing"`
+	Extra   []driftItem `json:"extra"`
+	Changed []driftItem `json:"changed"`
+	InSync  int         `json:"in_sync"`
+}
+
+// packwizDrift is the result of a reconcile.
+type packwizDrift struct {
+	Source      string       `json:"source,omitempty"`
+	Tracked     driftReport  `json:"tracked"`
+	Server      *driftReport `json:"server,omitempty"`
+	ServerError string       `json:"server_error,omitempty"`
+}
+
+// driftEntry keys a mod for comparison: by project where known, else by
+// file name.
+type driftEntry struct {
+	key, version, file, name string
+}
+
+// reconcilePackwizHandler reports drift between a packwiz pack and the
+// instance: against tracked mods by project and version, and against the
+// server's mods folder by file name when the instance is linked.
+func reconcilePackwizHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inst, err := packwizInstance(db, r)
+		if err != nil {
+			httpx.Write(w, r, err)
+			return
+		}
+		tree, src, err := readPackwizRequest(w, r, db, inst)
+		if err != nil {
+			httpx.Write(w, r, err)
+			return
+		}
+		mods, err := dbpkg.ListMods(db, inst.ID)
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		tracked, unresolved, err := resolveTrackedFiles(r.Context(), db, mods, dbpkg.SourceModrinth, dbpkg.SourceCurseForge)
+		if err != nil {
+			writeModrinthError(w, r, err)
+			return
+		}
+		var packByProject, packByFile []driftEntry
+		for _, name := range sortedKeys(tree.Mods) {
+			m := tree.Mods[name]
+			if !m.OnServer() {
+				continue
+			}
+			e := driftEntry{key: "file:" + strings.ToLower(m.Filename), file: m.Filename, name: m.Name}
+			packByFile = append(packByFile, e)
+			switch {
+			case m.Update != nil && m.Update.Modrinth != nil:
+				e.key, e.version = dbpkg.SourceModrinth+":"+m.Update.Modrinth.ModID, m.Update.Modrinth.Version
+			case m.Update != nil && m.Update.CurseForge != nil:
+				e.key, e.version = dbpkg.SourceCurseForge+":"+strconv.Itoa(m.Update.CurseForge.ProjectID), strconv.Itoa(m.Update.CurseForge.FileID)
+			}
+			packByProject = append(packByProject, e)
+		}
+		current := make([]driftEntry, 0, len(tracked)+len(unresolved))
+		for _, t := range tracked {
+			current = append(current, driftEntry{key: t.mod.Source + ":" + t.version.ProjectID, version: t.version.ID, file: t.file.Filename, name: t.mod.Name})
+		}
+		for _, name := range unresolved {
+			current = append(current, driftEntry{key: "name:" + strings.ToLower(name), name: name})
+		}
+		res := packwizDrift{Source: src, Tracked: compareDrift(packByProject, current)}
+
+		if serverID := strings.TrimSpace(inst.PufferpanelServerID); serverID != "" {
+			entries, err := backendFor(inst).ListPath(r.Context(), serverID, instanceModFolder(inst))
+			if err != nil {
+				res.ServerError = err.Error()
+			} else {
+				var onServer []driftEntry
+				for _, e := range entries {
+					if !e.IsDir && strings.HasSuffix(strings.ToLower(e.Name), ".jar") {
+						onServer = append(onServer, driftEntry{key: "file:" + strings.ToLower(e.Name), file: e.Name, name: e.Name})
+					}
+				}
+				report := compareDrift(packByFile, onServer)
+				res.Server = &report
+			}
+		}
+		telemetry.Event("packwiz_reconcile", map[string]string{
+			"instance_id": strconv.Itoa(inst.ID),
+			"missing":     strconv.Itoa(len(res.Tracked.Missing)),
+			"extra":       strconv.Itoa(len(res.Tracked.Extra)),
+			"changed":     strconv.Itoa(len(res.Tracked.Changed)),
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// compareDrift matches pack entries to current ones by key, falling back
+// to the file name for pack mods without update metadata.
+func compareDrift(pack, current []driftEntry) driftReport {
+	rep := driftReport{Missing: []driftItem{}, Extra: []driftItem{}, Changed: []driftItem{}}
+	byKey := make(map[string]int, 2*len(current))
+	for i, c := range current {
+		byKey[c.key] = i
+		if c.file != "" {
+			if _, ok := byKey["file:"+strings.ToLower(c.file)]; !ok {
+				byKey["file:"+strings.ToLower(c.file)] = i
+			}
+		}
+	}
+	used := make([]bool, len(current))
+	for _, p := range pack {
+		i, ok := byKey[p.key]
+		if !ok || used[i] {
+			rep.Missing = append(rep.Missing, driftItem{Name: p.name, Pack: p.file})
+			continue
+		}
+		used[i] = true
+		c := current[i]
+		if (p.version != "" && p.version != c.version) || (p.version == "" && !strings.EqualFold(p.file, c.file)) {
+			rep.Changed = append(rep.Changed, driftItem{Name: p.name, Pack: p.file, Current: c.file})
+			continue
+		}
+		rep.InSync++
+	}
+	for i, c := range current {
+		if !used[i] {
+			rep.Extra = append(rep.Extra, driftItem{Name: c.name, Current: c.file})
+		}
+	}
+	return rep
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	cf "modsentinel/internal/curseforge"
+	dbpkg "modsentinel/internal/db"
+	mr "modsentinel/internal/modrinth"
+	"modsentinel/internal/packwiz"
+	pppkg "modsentinel/internal/pufferpanel"
+)
+
+func packwizRequest(t *testing.T, method string, instID int, target string, body io.Reader, contentType string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(method, "/api/instances/"+strconv.Itoa(instID)+target, body)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", strconv.Itoa(instID))
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestPackwiz_ReconcileImportExport(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	inst := &dbpkg.Instance{Name: "Survival", Loader: "fabric", PufferpanelServerID: "s1"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatal(err)
+	}
+	inst, _ = dbpkg.GetInstance(db, inst.ID)
+
+	version := func(id, project, file string) mr.Version {
+		v := depVersion(id, project, "release", time.Now())
+		f := packFile("mods/"+file, file, nil)
+		v.Files = []mr.VersionFile{{URL: "https://cdn.modrinth.com/data/" + project + "/" + file, Filename: file, Primary: true, Hashes: f.Hashes}}
+		return v
+	}
+	sodium := version("0.5.0", "AANobbMI", "sodium-0.5.0.jar")
+	lithiumOld := version("0.11.1", "gvQqBUqZ", "lithium-0.11.1.jar")
+	lithium := version("0.11.2", "gvQqBUqZ", "lithium-0.11.2.jar")
+	ferrite := version("6.0.1", "uXXizFIs", "ferrite.jar")
+	old := modClient
+	modClient = exportClient{
+		packClient: packClient{projects: []mr.Project{
+			{ID: "AANobbMI", Slug: "sodium", Title: "Sodium", ClientSide: "required", ServerSide: "optional"},
+			{ID: "gvQqBUqZ", Slug: "lithium", Title: "Lithium", ClientSide: "optional", ServerSide: "optional"},
+			{ID: "uXXizFIs", Slug: "ferrite-core", Title: "FerriteCore"},
+		}},
+		versions: map[string][]mr.Version{"sodium": {sodium}, "lithium": {lithium, lithiumOld}, "ferrite-core": {ferrite}},
+	}
+	defer func() { modClient = old }()
+	var jeiFile cf.File
+	json.Unmarshal([]byte(`{"id":4712868,"modId":238222,"displayName":"15.2","fileName":"jei-15.2.jar","downloadUrl":"https://edge.forgecdn.net/files/jei-15.2.jar","hashes":[{"value":"`+strings.Repeat("a", 40)+`","algo":1}]}`), &jeiFile)
+	oldCF := cfClient
+	cfClient = fakeCFClient{mod: cf.Mod{ID: 238222, Slug: "jei", Name: "JEI"}, files: []cf.File{jeiFile}}
+	defer func() { cfClient = oldCF }()
+	origList := ppListPath
+	defer func() { ppListPath = origList }()
+	ppListPath = func(ctx context.Context, id, path string) ([]pppkg.FileEntry, error) {
+		return []pppkg.FileEntry{{Name: "sodium-0.5.0.jar"}, {Name: "lithium-0.11.1.jar"}, {Name: "ferrite.jar"}}, nil
+	}
+
+	// Lithium is tracked at an older version and FerriteCore is not in the pack.
+	for _, m := range []*dbpkg.Mod{
+		{Name: "Lithium", URL: "https://modrinth.com/mod/lithium", CurrentVersion: "0.11.1", InstanceID: inst.ID, ProjectID: "gvQqBUqZ", VersionID: "0.11.1"},
+		{Name: "FerriteCore", URL: "https://modrinth.com/mod/ferrite-core", CurrentVersion: "6.0.1", InstanceID: inst.ID, VersionID: "6.0.1"},
+	} {
+		if err := dbpkg.InsertMod(db, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	modrinthMeta := func(name string, v mr.Version, side string) packwiz.Mod {
+		f := v.Files[0]
+		return packwiz.Mod{Name: name, Filename: f.Filename, Side: side,
+			Download: packwiz.Download{URL: f.URL, HashFormat: "sha512", Hash: f.Hashes["sha512"]},
+			Update:   &packwiz.Update{Modrinth: &packwiz.ModrinthUpdate{ModID: v.ProjectID, Version: v.ID}}}
+	}
+	files, err := packwiz.Write(&packwiz.Tree{
+		Pack: packwiz.Pack{Name: "Survival", Versions: map[string]string{"minecraft": "1.20.1", "fabric": "0.15.11"}},
+		Mods: map[string]packwiz.Mod{
+			"mods/sodium.pw.toml":  modrinthMeta("Sodium", sodium, packwiz.SideBoth),
+			"mods/lithium.pw.toml": modrinthMeta("Lithium", lithium, packwiz.SideBoth),
+			"mods/zoomify.pw.toml": {Name: "Zoomify", Filename: "zoomify.jar", Side: packwiz.SideClient, Download: packwiz.Download{URL: "https://cdn.modrinth.com/z.jar", HashFormat: "sha1", Hash: "1"}},
+			"mods/jei.pw.toml": {Name: "JEI", Filename: "jei-15.2.jar",
+				Download: packwiz.Download{Mode: packwiz.DownloadModeCurseForge, HashFormat: "sha1", Hash: jeiFile.SHA1()},
+				Update:   &packwiz.Update{CurseForge: &packwiz.CurseForgeUpdate{ProjectID: 238222, FileID: 4712868}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reconcile an uploaded pack before importing it.
+	var zipped, body bytes.Buffer
+	if err := packwiz.WriteZip(&zipped, files); err != nil {
+		t.Fatal(err)
+	}
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "pack.zip")
+	fw.Write(zipped.Bytes())
+	mw.Close()
+	rr := httptest.NewRecorder()
+	reconcilePackwizHandler(db)(rr, packwizRequest(t, http.MethodPost, inst.ID, "/packwiz/reconcile", &body, mw.FormDataContentType()))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("reconcile status %d: %s", rr.Code, rr.Body.String())
+	}
+	var drift packwizDrift
+	json.Unmarshal(rr.Body.Bytes(), &drift)
+	tr := drift.Tracked
+	if len(tr.Missing) != 2 || len(tr.Changed) != 1 || tr.Changed[0].Pack != "lithium-0.11.2.jar" || tr.Changed[0].Current != "lithium-0.11.1.jar" || len(tr.Extra) != 1 || tr.Extra[0].Name != "FerriteCore" {
+		t.Fatalf("tracked drift = %+v", tr)
+	}
+	if s := drift.Server; s == nil || s.InSync != 1 || len(s.Missing) != 2 || len(s.Extra) != 2 {
+		t.Fatalf("server drift = %+v", drift.Server)
+	}
+
+	// Import from a URL, which is remembered for later reconciles.
+	prevClient := packwizClient
+	t.Cleanup(func() { packwizClient = prevClient })
+	packwizClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+		data, ok := files[strings.TrimPrefix(req.URL.Path, "/team/pack/main/")]
+		if req.URL.Host != "raw.example.com" || !ok {
+			return &http.Response{StatusCode: 404, Body: io.NopCloser(strings.NewReader(""))}
+		}
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewReader(data)), Header: http.Header{}}
+	})}
+	rr = httptest.NewRecorder()
+	importPackwizHandler(db)(rr, packwizRequest(t, http.MethodPost, inst.ID, "/packwiz/import", strings.NewReader(`{"url":"https://raw.example.com/team/pack/main/pack.toml"}`), "application/json"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("import status %d: %s", rr.Code, rr.Body.String())
+	}
+	var res packwizImportResult
+	json.Unmarshal(rr.Body.Bytes(), &res)
+	if len(res.Added) != 2 || len(res.Updated) != 1 || res.Updated[0].CurrentVersion != "0.11.2" || len(res.Untracked) != 0 || res.Instance.GameVersion != "1.20.1" {
+		t.Fatalf("import = %+v", res)
+	}
+	if src, _ := dbpkg.GetPackwizSource(db, inst.ID); src != "https://raw.example.com/team/pack/main/pack.toml" {
+		t.Fatalf("source = %q", src)
+	}
+
+	rr = httptest.NewRecorder()
+	reconcilePackwizHandler(db)(rr, packwizRequest(t, http.MethodPost, inst.ID, "/packwiz/reconcile", nil, ""))
+	drift = packwizDrift{}
+	json.Unmarshal(rr.Body.Bytes(), &drift)
+	if tr := drift.Tracked; rr.Code != http.StatusOK || tr.InSync != 3 || len(tr.Missing)+len(tr.Changed) != 0 || len(tr.Extra) != 1 {
+		t.Fatalf("reconcile after import %d = %+v", rr.Code, drift)
+	}
+
+	// Export writes metafiles with update metadata for both sources.
+	rr = httptest.NewRecorder()
+	exportPackwizHandler(db)(rr, packwizRequest(t, http.MethodGet, inst.ID, "/packwiz/export?loader_version=0.15.11", nil, ""))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("export status %d: %s", rr.Code, rr.Body.String())
+	}
+	tree, err := packwiz.ReadZip(rr.Body.Bytes())
+	if err != nil {
+		t.Fatalf("read export: %v", err)
+	}
+	if l, v := tree.Loader(); l != "fabric" || v != "0.15.11" || len(tree.Mods) != 4 {
+		t.Fatalf("export = %+v", tree)
+	}
+	if m := tree.Mods["mods/sodium.pw.toml"]; m.Update == nil || m.Update.Modrinth.Version != "0.5.0" || m.Download.Hash != sodium.Files[0].Hashes["sha512"] {
+		t.Fatalf("sodium = %+v", m)
+	}
+	if m := tree.Mods["mods/jei.pw.toml"]; m.Update == nil || m.Update.CurseForge.FileID != 4712868 || m.Download.Mode != packwiz.DownloadModeCurseForge {
+		t.Fatalf("jei = %+v", m)
+	}
+}
+
+func TestFetchPackwiz_RefusesPrivateAddresses(t *testing.T) {
+	for addr, public := range map[string]bool{
+		"93.184.216.34:443":     true,
+		"[2606:4700::1111]:443": true,
+		"127.0.0.1:80":          false,
+		"10.0.0.5:443":          false,
+		"192.168.1.1:443":       false,
+		"169.254.169.254:80":    false,
+		"100.64.0.1:443":        false,
+		"0.0.0.0:80":            false,
+		"[::1]:443":             false,
+		"[fd00::1]:443":         false,
+		"[::ffff:127.0.0.1]:80": false,
+	} {
+		err := dialPublicOnly("tcp", addr, nil)
+		if (err == nil) != public || (err != nil && !errors.Is(err, errPrivateAddress)) {
+			t.Errorf("dialPublicOnly(%s) = %v", addr, err)
+		}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("private server reached: %s", r.URL)
+	}))
+	defer srv.Close()
+	if _, err := fetchPackwiz(context.Background(), srv.URL+"/pack.toml"); !errors.Is(err, errPrivateAddress) {
+		t.Fatalf("fetch err = %v", err)
+	}
+}
+
+func TestPackwizInstance_Errors(t *testing.T) {
+	db := setupDB(t)
+	lookup := func(id string) int {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		req := httptest.NewRequest(http.MethodGet, "/api/instances/"+id+"/packwiz/export", nil)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+		exportPackwizHandler(db)(rr, req)
+		return rr.Code
+	}
+	if code := lookup("abc"); code != http.StatusBadRequest {
+		t.Fatalf("bad id: status %d", code)
+	}
+	if code := lookup("99"); code != http.StatusNotFound {
+		t.Fatalf("missing instance: status %d", code)
+	}
+	db.Close()
+	if code := lookup("99"); code != http.StatusInternalServerError {
+		t.Fatalf("closed db: status %d", code)
+	}
+}
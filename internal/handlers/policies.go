@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	dbpkg "modsentinel/internal/db"
+	"modsentinel/internal/httpx"
+	"modsentinel/internal/telemetry"
+)
+
+// versionMajor returns the major component of the first dotted number in a
+// version string, after normalizeVersion has dropped loader and game
+// version suffixes.
+func versionMajor(v string) (int, bool) {
+	tokens := strings.FieldsFunc(normalizeVersion(v), func(r rune) bool { return !(r >= '0' && r <= '9' || r == '.') })
+	for _, tok := range tokens {
+		i := strings.Index(tok, ".")
+		if i <= 0 {
+			continue
+		}
+		if n, err := strconv.Atoi(tok[:i]); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// isMajorBump reports whether to raises the major version of from. Versions
+// without a recognizable major are never treated as major bumps.
+func isMajorBump(from, to string) bool {
+	a, okA := versionMajor(from)
+	b, okB := versionMajor(to)
+	return okA && okB && b > a
+}
+
+// policyBlocksUpdate explains why pol forbids updating m to its available
+// version, or returns "" when the update is allowed.
+func policyBlocksUpdate(pol dbpkg.EffectivePolicy, m *dbpkg.Mod) string {
+	if pol.Pin != "" && m.AvailableVersion != pol.Pin {
+		return "pinned to " + pol.Pin
+	}
+	if !pol.AllowMajor && isMajorBump(m.CurrentVersion, m.AvailableVersion) {
+		return "major version bump denied by policy"
+	}
+	return ""
+}
+
+// autoApplyUpdates enqueues the pending updates of mods whose policy applies
+// them unattended, deferred to the instance's maintenance window if it has
+// one. Keys include the target version so each version is attempted once.
+func autoApplyUpdates(ctx context.Context, db *sql.DB, mods []dbpkg.Mod, policies map[int]dbpkg.EffectivePolicy) {
+	blocked := map[int]bool{}
+	for i := range mods {
+		m := &mods[i]
+		pol := policies[m.ID]
+		if !pol.AutoApply || m.AvailableVersion == "" || m.AvailableVersion == m.CurrentVersion {
+			continue
+		}
+		if _, ok := blocked[m.InstanceID]; !ok {
+			inst, err := dbpkg.GetInstance(db, m.InstanceID)
+			blocked[m.InstanceID] = err != nil || inst.RequiresLoader
+		}
+		if blocked[m.InstanceID] || policyBlocksUpdate(pol, m) != "" {
+			continue
+		}
+		key := fmt.Sprintf("auto:%d:%s", m.ID, m.AvailableVersion)
+		jobID, deferred, err := enqueueScheduledUpdateJob(ctx, db, m, key)
+		if err != nil {
+			log.Error().Err(err).Int("mod_id", m.ID).Msg("enqueue auto update")
+			continue
+		}
+		telemetry.Event("auto_update_enqueued", map[string]string{
+			"mod_id":      strconv.Itoa(m.ID),
+			"instance_id": strconv.Itoa(m.InstanceID),
+			"job_id":      strconv.Itoa(jobID),
+			"to":          m.AvailableVersion,
+			"deferred":    strconv.FormatBool(deferred),
+		})
+	}
+}
+
+// validatePolicy checks a policy payload; pins are only accepted on mods.
+func validatePolicy(p *dbpkg.UpdatePolicy, allowPin bool) error {
+	p.MinChannel = strings.ToLower(strings.TrimSpace(p.MinChannel))
+	p.Pin = strings.TrimSpace(p.Pin)
+	fields := map[string]string{}
+	switch p.MinChannel {
+	case "", "release", "beta", "alpha":
+	default:
+		fields["min_channel"] = "invalid"
+	}
+	if p.Pin != "" && !allowPin {
+		fields["pin"] = "unsupported"
+	}
+	if len(fields) > 0 {
+		return httpx.BadRequest("validation failed").WithDetails(fields)
+	}
+	return nil
+}
+
+func getInstancePolicyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.Write(w, r, httpx.BadRequest("invalid id"))
+			return
+		}
+		if _, err := dbpkg.GetInstance(db, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				httpx.Write(w, r, httpx.NotFound("instance not found"))
+				return
+			}
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		p, err := dbpkg.GetInstancePolicy(db, id)
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(p)
+	}
+}
+
+func setInstancePolicyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.Write(w, r, httpx.BadRequest("invalid id"))
+			return
+		}
+		var p dbpkg.UpdatePolicy
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			httpx.Write(w, r, httpx.BadRequest("invalid json"))
+			return
+		}
+		if err := validatePolicy(&p, false); err != nil {
+			httpx.Write(w, r, err)
+			return
+		}
+		if _, err := dbpkg.GetInstance(db, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				httpx.Write(w, r, httpx.NotFound("instance not found"))
+				return
+			}
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		if err := dbpkg.SetInstancePolicy(db, id, &p); err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+	}
+}
+
+// modPolicyOut pairs a mod's own override with the policy in effect.
+type modPolicyOut struct {
+	Policy    *dbpkg.UpdatePolicy   `json:"policy"`
+	Effective dbpkg.EffectivePolicy `json:"effective"`
+}
+
+func loadPolicyMod(w http.ResponseWriter, r *http.Request, db *sql.DB) *dbpkg.Mod {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		httpx.Write(w, r, httpx.BadRequest("invalid id"))
+		return nil
+	}
+	m, err := dbpkg.GetMod(db, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			httpx.Write(w, r, httpx.NotFound("mod not found"))
+			return nil
+		}
+		httpx.Write(w, r, httpx.Internal(err))
+		return nil
+	}
+	return m
+}
+
+func writeModPolicy(w http.ResponseWriter, r *http.Request, db *sql.DB, m *dbpkg.Mod) {
+	p, err := dbpkg.GetModPolicy(db, m.ID)
+	if err != nil {
+		httpx.Write(w, r, httpx.Internal(err))
+		return
+	}
+	eff, err := dbpkg.GetEffectivePolicy(db, m)
+	if err != nil {
+		httpx.Write(w, r, httpx.Internal(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(modPolicyOut{Policy: p, Effective: eff})
+}
+
+func getModPolicyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if m := loadPolicyMod(w, r, db); m != nil {
+			writeModPolicy(w, r, db, m)
+		}
+	}
+}
+
+func setModPolicyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m := loadPolicyMod(w, r, db)
+		if m == nil {
+			return
+		}
+		var p dbpkg.UpdatePolicy
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			httpx.Write(w, r, httpx.BadRequest("invalid json"))
+			return
+		}
+		if err := validatePolicy(&p, true); err != nil {
+			httpx.Write(w, r, err)
+			return
+		}
+		if err := dbpkg.SetModPolicy(db, m.ID, &p); err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		writeModPolicy(w, r, db, m)
+	}
+}
+
+func deleteModPolicyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m := loadPolicyMod(w, r, db)
+		if m == nil {
+			return
+		}
+		if err := dbpkg.DeleteModPolicy(db, m.ID); err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		writeModPolicy(w, r, db, m)
+	}
+}
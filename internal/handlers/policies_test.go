@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dbpkg "modsentinel/internal/db"
+	mr "modsentinel/internal/modrinth"
+)
+
+func policyVersions() []mr.Version {
+	now := time.Now()
+	return []mr.Version{
+		depVersion("2.0.0", "lib", "release", now),
+		depVersion("1.6.0-beta.1", "lib", "beta", now.Add(-time.Hour)),
+		depVersion("1.5.0", "lib", "release", now.Add(-2*time.Hour)),
+	}
+}
+
+func TestPopulateAvailableVersionFor(t *testing.T) {
+	old := modClient
+	modClient = depClient{versions: map[string][]mr.Version{"lib": policyVersions()}}
+	defer func() { modClient = old }()
+
+	cases := []struct {
+		name string
+		pol  dbpkg.EffectivePolicy
+		want string
+	}{
+		{"default", dbpkg.EffectivePolicy{MinChannel: "release", AllowMajor: true}, "2.0.0"},
+		{"deny major", dbpkg.EffectivePolicy{MinChannel: "release"}, "1.5.0"},
+		{"beta floor prefers newer beta", dbpkg.EffectivePolicy{MinChannel: "beta"}, "1.6.0-beta.1"},
+		{"alpha floor allows release", dbpkg.EffectivePolicy{MinChannel: "alpha", AllowMajor: true}, "2.0.0"},
+		{"pinned", dbpkg.EffectivePolicy{Pin: "1.5.0", AllowMajor: true}, "1.5.0"},
+		{"pin missing", dbpkg.EffectivePolicy{Pin: "9.9.9", AllowMajor: true}, "1.0.0"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := &dbpkg.Mod{URL: "https://modrinth.com/mod/lib", CurrentVersion: "1.0.0", Channel: "release"}
+			if err := populateAvailableVersionFor(context.Background(), m, "lib", c.pol); err != nil {
+				t.Fatalf("populate: %v", err)
+			}
+			if m.AvailableVersion != c.want {
+				t.Fatalf("available = %q, want %q", m.AvailableVersion, c.want)
+			}
+		})
+	}
+}
+
+func TestIsMajorBump(t *testing.T) {
+	for _, c := range []struct {
+		from, to string
+		want     bool
+	}{
+		{"1.9.2", "2.0.0", true},
+		{"jei-15.2.0", "jei-16.0.1", true},
+		{"0.5.3+mc1.20.1", "0.6.0+mc1.20.1", false},
+		{"build-12", "build-13", false},
+	} {
+		if got := isMajorBump(c.from, c.to); got != c.want {
+			t.Fatalf("isMajorBump(%q, %q) = %v", c.from, c.to, got)
+		}
+	}
+}
+
+func TestCheckUpdates_AutoApplyRespectsPolicy(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	old := modClient
+	modClient = depClient{versions: map[string][]mr.Version{"lib": policyVersions()}}
+	defer func() { modClient = old }()
+
+	inst := &dbpkg.Instance{Name: "auto", Loader: "fabric"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	yes, no := true, false
+	if err := dbpkg.SetInstancePolicy(db, inst.ID, &dbpkg.UpdatePolicy{AutoApply: &yes}); err != nil {
+		t.Fatalf("set instance policy: %v", err)
+	}
+	insert := func(name string, pol *dbpkg.UpdatePolicy) *dbpkg.Mod {
+		m := &dbpkg.Mod{Name: name, URL: "https://modrinth.com/mod/lib", InstanceID: inst.ID, CurrentVersion: "1.0.0", Channel: "release", Loader: "fabric"}
+		if err := dbpkg.InsertMod(db, m); err != nil {
+			t.Fatalf("insert mod: %v", err)
+		}
+		if pol != nil {
+			if err := dbpkg.SetModPolicy(db, m.ID, pol); err != nil {
+				t.Fatalf("set mod policy: %v", err)
+			}
+		}
+		return m
+	}
+	auto := insert("auto", nil)
+	pinned := insert("pinned", &dbpkg.UpdatePolicy{Pin: "1.0.0"})
+	manual := insert("manual", &dbpkg.UpdatePolicy{AutoApply: &no, AllowMajor: &no})
+
+	CheckUpdates(context.Background(), db)
+
+	ids, err := dbpkg.ListQueuedModUpdates(db)
+	if err != nil {
+		t.Fatalf("list queued: %v", err)
+	}
+	defer func() {
+		for _, id := range ids {
+			updateJobs.Delete(id)
+		}
+	}()
+	if len(ids) != 1 {
+		t.Fatalf("queued = %v, want one auto update", ids)
+	}
+	mu, err := dbpkg.GetModUpdate(db, ids[0])
+	if err != nil {
+		t.Fatalf("get update: %v", err)
+	}
+	if mu.ModID != auto.ID || mu.ToVersion != "2.0.0" {
+		t.Fatalf("queued %+v, want mod %d to 2.0.0", mu, auto.ID)
+	}
+	for _, c := range []struct {
+		m    *dbpkg.Mod
+		want string
+	}{{pinned, "1.0.0"}, {manual, "1.5.0"}} {
+		got, err := dbpkg.GetMod(db, c.m.ID)
+		if err != nil {
+			t.Fatalf("get mod: %v", err)
+		}
+		if got.AvailableVersion != c.want {
+			t.Fatalf("%s available = %q, want %q", got.Name, got.AvailableVersion, c.want)
+		}
+	}
+}
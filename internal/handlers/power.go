@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	dbpkg "modsentinel/internal/db"
+)
+
+var (
+	// restartTimeout bounds how long a restarted server may take to report
+	// running again.
+	restartTimeout = 3 * time.Minute
+	// restartPollInterval is how often the server status is polled.
+	restartPollInterval = 5 * time.Second
+
+	// restartHolds counts runs per instance that restart the server
+	// themselves once all their updates are in, so jobs skip their own.
+	restartHoldMu sync.Mutex
+	restartHolds  = map[int]int{}
+)
+
+func holdRestart(instID int) {
+	restartHoldMu.Lock()
+	restartHolds[instID]++
+	restartHoldMu.Unlock()
+}
+
+func releaseRestart(instID int) {
+	restartHoldMu.Lock()
+	if restartHolds[instID] <= 1 {
+		delete(restartHolds, instID)
+	} else {
+		restartHolds[instID]--
+	}
+	restartHoldMu.Unlock()
+}
+
+func restartHeld(instID int) bool {
+	restartHoldMu.Lock()
+	defer restartHoldMu.Unlock()
+	return restartHolds[instID] > 0
+}
+
+// waitServerOnline polls the instance's server until it reports running,
+// failing after restartTimeout.
+func waitServerOnline(ctx context.Context, inst *dbpkg.Instance) error {
+	ctx, cancel := context.WithTimeout(ctx, restartTimeout)
+	defer cancel()
+	srv := backendFor(inst)
+	for {
+		running, err := srv.ServerStatus(ctx, inst.PufferpanelServerID)
+		if err == nil && running {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return fmt.Errorf("server did not come back online: %w", err)
+			}
+			return fmt.Errorf("server did not come back online within %s", restartTimeout)
+		case <-time.After(restartPollInterval):
+		}
+	}
+}
+
+// restartServerAndWait restarts the instance's server and waits for it to
+// come online.
+func restartServerAndWait(ctx context.Context, inst *dbpkg.Instance) error {
+	pc, err := powerFor(inst)
+	if err == nil {
+		err = pc.RestartServer(ctx, inst.PufferpanelServerID)
+	}
+	if err != nil {
+		return fmt.Errorf("restart failed: %w", err)
+	}
+	return waitServerOnline(ctx, inst)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	dbpkg "modsentinel/internal/db"
+)
+
+func TestRunUpdateJob_RestartsAfterUpdate(t *testing.T) {
+	oldTimeout, oldPoll := restartTimeout, restartPollInterval
+	restartTimeout, restartPollInterval = 50*time.Millisecond, time.Millisecond
+	defer func() { restartTimeout, restartPollInterval = oldTimeout, oldPoll }()
+
+	cases := []struct {
+		name     string
+		comesUp  bool
+		held     bool
+		want     UpdateJobState
+		restarts int
+	}{
+		{"online", true, false, StateSucceeded, 1},
+		{"timeout", false, false, StateFailed, 1},
+		{"held by batch", true, true, StateSucceeded, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := setupDB(t)
+			defer db.Close()
+			m, _ := pendingUpdate(t, db, "jar", nil)
+			inst, _ := dbpkg.GetInstance(db, m.InstanceID)
+			inst.RestartAfterUpdate = true
+			if err := dbpkg.UpdateInstance(db, inst); err != nil {
+				t.Fatalf("update inst: %v", err)
+			}
+
+			restarts, polls := 0, 0
+			oldRestart, oldStatus := ppRestartServer, ppServerStatus
+			ppRestartServer = func(ctx context.Context, id string) error { restarts++; return nil }
+			ppServerStatus = func(ctx context.Context, id string) (bool, error) {
+				polls++
+				if polls < 3 {
+					return false, errors.New("starting")
+				}
+				return tc.comesUp, nil
+			}
+			defer func() { ppRestartServer, ppServerStatus = oldRestart, oldStatus }()
+			if tc.held {
+				holdRestart(inst.ID)
+				defer releaseRestart(inst.ID)
+			}
+
+			uj := &updateJob{id: 1, db: db}
+			runUpdateJob(context.Background(), db, uj, m.ID)
+			if uj.state != tc.want || restarts != tc.restarts {
+				t.Fatalf("state = %s, restarts = %d, events = %+v", uj.state, restarts, uj.snapshotEvents())
+			}
+			var saw []UpdateJobState
+			for _, ev := range uj.snapshotEvents() {
+				if p, ok := ev.Data.(map[string]any); ok {
+					if st := p["state"].(UpdateJobState); st == StateRestarting || st == StateWaitingOnline {
+						saw = append(saw, st)
+					}
+				}
+			}
+			if tc.restarts > 0 && (len(saw) != 2 || saw[0] != StateRestarting) {
+				t.Fatalf("restart states = %v", saw)
+			}
+			if got, _ := dbpkg.GetMod(db, m.ID); got.CurrentVersion != "1.1.0" {
+				t.Fatalf("update not applied: %+v", got)
+			}
+		})
+	}
+}
+
+func TestApplyWithServerControl_RestartsOncePerRun(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	inst := &dbpkg.Instance{ID: 7, Name: "srv", PufferpanelServerID: "s1", RestartAfterUpdate: true}
+	restarts := 0
+	oldRestart, oldStatus := ppRestartServer, ppServerStatus
+	ppRestartServer = func(ctx context.Context, id string) error { restarts++; return nil }
+	ppServerStatus = func(ctx context.Context, id string) (bool, error) { return true, nil }
+	defer func() { ppRestartServer, ppServerStatus = oldRestart, oldStatus }()
+
+	err := applyWithServerControl(context.Background(), db, inst, false, func() bool {
+		if !restartHeld(inst.ID) {
+			t.Errorf("jobs would restart individually")
+		}
+		return true
+	})
+	if err != nil || restarts != 1 || restartHeld(inst.ID) {
+		t.Fatalf("err = %v, restarts = %d, held = %v", err, restarts, restartHeld(inst.ID))
+	}
+	// Nothing installed, nothing to restart.
+	if err := applyWithServerControl(context.Background(), db, inst, false, func() bool { return false }); err != nil || restarts != 1 {
+		t.Fatalf("err = %v, restarts = %d", err, restarts)
+	}
+	evs, _ := dbpkg.ListEvents(db, inst.ID, 10)
+	if len(evs) != 1 || evs[0].Action != "server_restarted" {
+		t.Fatalf("events = %+v", evs)
+	}
+}
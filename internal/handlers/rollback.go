@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"modsentinel/internal/artifacts"
+	"modsentinel/internal/backend"
+	dbpkg "modsentinel/internal/db"
+	"modsentinel/internal/httpx"
+	pppkg "modsentinel/internal/pufferpanel"
+	"modsentinel/internal/telemetry"
+)
+
+// artifactStore retains replaced jars for rollback; nil disables retention.
+var artifactStore *artifacts.Store
+
+// SetArtifactStore configures where replaced jars are kept for rollback.
+func SetArtifactStore(s *artifacts.Store) {
+	artifactStore = s
+}
+
+// recordRollbackPoint marks a finished update as revertible. The previous
+// jar is kept when the instance retains artifacts, and older jars beyond the
+// instance's retention are pruned. prevSum keys the previous jar in the
+// artifact cache so it can be restored when no copy was retained.
+func recordRollbackPoint(db *sql.DB, updID int, prev *dbpkg.Mod, prevFile string, prevJar []byte, prevSum string) {
+	if updID == 0 {
+		return
+	}
+	inst, err := dbpkg.GetInstance(db, prev.InstanceID)
+	if err != nil {
+		return
+	}
+	stored := ""
+	if artifactStore != nil && inst.RollbackRetention > 0 && len(prevJar) > 0 && prevFile != "" {
+		if p, err := artifactStore.Put(artifacts.UpdateKey(updID), path.Base(prevFile), prevJar); err == nil {
+			stored = p
+		} else {
+			log.Warn().Err(err).Int("mod_id", prev.ID).Int("update_id", updID).Msg("retain previous jar failed")
+		}
+	}
+	if err := dbpkg.SetModUpdateRollback(db, updID, prevFile, prev.DownloadURL, prev.Channel, stored, prevSum); err != nil {
+		log.Warn().Err(err).Int("update_id", updID).Msg("record rollback point failed")
+		return
+	}
+	pruneArtifacts(db, prev.ID, inst.RollbackRetention)
+}
+
+// previousJar returns the jar an update replaced, from the artifact store or
+// else from the artifact cache.
+func previousJar(point *dbpkg.ModUpdateRow) ([]byte, error) {
+	if artifactStore != nil && point.ArtifactPath != "" {
+		if data, err := artifactStore.Get(point.ArtifactPath); err == nil {
+			return data, nil
+		}
+	}
+	if blobCache != nil && point.PreviousSHA512 != "" {
+		if data, ok := blobCache.Get("sha512", point.PreviousSHA512); ok {
+			return data, nil
+		}
+	}
+	return nil, errors.New("previous jar is no longer retained")
+}
+
+// pruneArtifacts keeps the newest keep retained jars of a mod.
+func pruneArtifacts(db *sql.DB, modID, keep int) {
+	rows, err := dbpkg.ListRetainedArtifacts(db, modID)
+	if err != nil {
+		return
+	}
+	if keep < 0 {
+		keep = 0
+	}
+	for i := keep; i < len(rows); i++ {
+		if artifactStore != nil {
+			if err := artifactStore.Remove(rows[i].ArtifactPath); err != nil {
+				log.Warn().Err(err).Str("path", rows[i].ArtifactPath).Msg("prune artifact failed")
+				continue
+			}
+		}
+		_ = dbpkg.ClearModUpdateArtifact(db, rows[i].ID)
+	}
+}
+
+// rollbackModHandler queues a job restoring the version a mod had before its
+// latest applied update and returns { job_id }. For a mod that is no longer
+// tracked it restores the mod its latest removal dropped. Progress is
+// streamed through the same job events as updates.
+func rollbackModHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.Write(w, r, httpx.BadRequest("invalid id"))
+			return
+		}
+		var point *dbpkg.ModUpdateRow
+		m, err := dbpkg.GetMod(db, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			if point, err = dbpkg.LatestRemovalPoint(db, id); err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					httpx.Write(w, r, httpx.NotFound("mod not found"))
+					return
+				}
+				httpx.Write(w, r, httpx.Internal(err))
+				return
+			}
+			m, err = removedMod(point)
+		}
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		inst, err := dbpkg.GetInstance(db, m.InstanceID)
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		if inst.RequiresLoader {
+			telemetry.Event("action_blocked", map[string]string{"action": "rollback", "reason": "loader_required", "instance_id": strconv.Itoa(inst.ID)})
+			httpx.Write(w, r, httpx.LoaderRequired())
+			return
+		}
+		if point == nil {
+			point, err = dbpkg.LatestRollbackPoint(db, m.ID)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					httpx.Write(w, r, httpx.Conflict("no update to roll back"))
+					return
+				}
+				httpx.Write(w, r, httpx.Internal(err))
+				return
+			}
+			if point.ToVersion != m.CurrentVersion {
+				httpx.Write(w, r, httpx.Conflict("mod changed since the last update"))
+				return
+			}
+		}
+		if point.PreviousFile != "" && point.ArtifactPath == "" && !(blobCache != nil && blobCache.Has(point.PreviousSHA512)) {
+			httpx.Write(w, r, httpx.Conflict("previous jar is no longer retained"))
+			return
+		}
+		from := m.CurrentVersion
+		if point.Kind == dbpkg.ModUpdateKindRemove {
+			from = ""
+		}
+		updID, err := dbpkg.InsertModRollbackQueued(db, m.ID, point.ID, from, point.FromVersion)
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		if _, ok := updateJobs.Load(updID); !ok {
+			uj := &updateJob{id: updID, events: make([]sseMsg, 0, 16), db: db, updID: updID}
+			updateJobs.Store(updID, uj)
+			uj.emitState(StateQueued, nil)
+		}
+		if updatesCh != nil {
+			select {
+			case updatesCh <- updID:
+			default:
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			JobID int `json:"job_id"`
+		}{updID})
+	}
+}
+
+// runRollbackJob restores the jar and version recorded by update row
+// mu.RollbackOf, mirroring the state machine of runUpdateJob.
+func runRollbackJob(ctx context.Context, db *sql.DB, uj *updateJob, mu *dbpkg.ModUpdateRow) {
+	fail := func(msg string) {
+		uj.emitState(StateFailed, map[string]any{"error": msg})
+		telemetry.Event("mod_rollback_failed", map[string]string{
+			"job_id": strconv.Itoa(uj.id),
+			"mod_id": strconv.Itoa(mu.ModID),
+			"error":  msg,
+		})
+	}
+	point, err := dbpkg.GetModUpdate(db, mu.RollbackOf)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	if point.Kind == dbpkg.ModUpdateKindRemove {
+		runRestoreJob(ctx, db, uj, point, fail)
+		return
+	}
+	m, err := dbpkg.GetMod(db, mu.ModID)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	if !point.RollbackReady || point.ToVersion != m.CurrentVersion {
+		fail("mod changed since the last update")
+		return
+	}
+	inst, err := dbpkg.GetInstance(db, m.InstanceID)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	if serverID := strings.TrimSpace(inst.PufferpanelServerID); serverID != "" && point.PreviousFile != "" {
+		acquireUpdate(inst.ID)
+		defer releaseUpdate(inst.ID)
+		data, err := previousJar(point)
+		if err != nil {
+			fail(err.Error())
+			return
+		}
+		folder := path.Dir(point.PreviousFile) + "/"
+		restoreName := path.Base(point.PreviousFile)
+		slug, _ := modSlug(m)
+		currentName := artifactFileName(m.DownloadURL, slug, m.CurrentVersion)
+
+		uj.emitState(StateUploadingNew, map[string]any{"file": restoreName, "size": len(data)})
+		srv := backendFor(inst)
+		if _, err := withRetryCount(ctx, func() error { return srv.PutFile(ctx, serverID, folder+restoreName, data) }); err != nil {
+			fail(err.Error())
+			return
+		}
+		uj.emitState(StateVerifyingNew, map[string]any{"file": restoreName, "size": len(data)})
+		var files []backend.FileEntry
+		if _, err := withRetryCount(ctx, func() error {
+			var e error
+			files, e = srv.ListPath(ctx, serverID, folder)
+			return e
+		}); err != nil {
+			fail(err.Error())
+			return
+		}
+		if !hasFile(files, restoreName) {
+			fail("rollback verification failed")
+			return
+		}
+		if !strings.EqualFold(currentName, restoreName) && hasFile(files, currentName) {
+			uj.emitState(StateRemovingOld, map[string]any{"file": currentName})
+			_, delErr := withRetryCount(ctx, func() error { return srv.DeleteFile(ctx, serverID, folder+currentName) })
+			var pe *pppkg.Error
+			if delErr != nil && !errors.Is(delErr, backend.ErrNotFound) && !(errors.As(delErr, &pe) && pe.Status == http.StatusNotFound) {
+				uj.emitState(StatePartialSuccess, map[string]any{"file": currentName, "hint": "Newer file could not be removed; please delete it manually from the server."})
+				return
+			}
+			removed := true
+			if files, err := srv.ListPath(ctx, serverID, folder); err == nil {
+				removed = !hasFile(files, currentName)
+			}
+			uj.emitState(StateVerifyingRemoval, map[string]any{"file": currentName, "removed": removed})
+			if !removed {
+				uj.emitState(StatePartialSuccess, map[string]any{"file": currentName, "hint": "Newer file still present; please delete it manually from the server."})
+				return
+			}
+		}
+	}
+
+	uj.emitState(StateUpdatingDB, map[string]any{"mod_id": m.ID})
+	if _, err := db.Exec(`UPDATE mods SET current_version=?, channel=COALESCE(NULLIF(?, ''), channel), download_url=?, version_id=NULL WHERE id=?`, point.FromVersion, point.PreviousChannel, point.PreviousDownloadURL, m.ID); err != nil {
+		uj.emitState(StateFailed, map[string]any{"error": err.Error(), "hint": "DB update failed."})
+		return
+	}
+	if err := dbpkg.ConsumeRollbackPoint(db, point.ID); err != nil {
+		log.Warn().Err(err).Int("update_id", point.ID).Msg("consume rollback point failed")
+	}
+	if artifactStore != nil && point.ArtifactPath != "" {
+		_ = artifactStore.Remove(point.ArtifactPath)
+	}
+	_ = dbpkg.InsertEvent(db, &dbpkg.ModEvent{InstanceID: m.InstanceID, ModID: &m.ID, Action: "rolled_back", ModName: m.Name, From: m.CurrentVersion, To: point.FromVersion})
+	telemetry.Event("mod_rollback", map[string]string{
+		"job_id": strconv.Itoa(uj.id),
+		"mod_id": strconv.Itoa(m.ID),
+		"from":   m.CurrentVersion,
+		"to":     point.FromVersion,
+	})
+	uj.emitState(StateSucceeded, map[string]any{"mod_id": m.ID, "version": point.FromVersion})
+}
+
+// removedMod decodes the mod a removal stopped tracking.
+func removedMod(point *dbpkg.ModUpdateRow) (*dbpkg.Mod, error) {
+	var m dbpkg.Mod
+	if err := json.Unmarshal([]byte(point.RemovedMod), &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// runRestoreJob reverts the removal recorded by point: the retained jar is
+// put back on the server and the mod is tracked again under its ID.
+func runRestoreJob(ctx context.Context, db *sql.DB, uj *updateJob, point *dbpkg.ModUpdateRow, fail func(string)) {
+	m, err := removedMod(point)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	if !point.RollbackReady {
+		fail("mod changed since it was removed")
+		return
+	}
+	if _, err := dbpkg.GetMod(db, m.ID); !errors.Is(err, sql.ErrNoRows) {
+		fail("mod is tracked again")
+		return
+	}
+	inst, err := dbpkg.GetInstance(db, m.InstanceID)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	if serverID := strings.TrimSpace(inst.PufferpanelServerID); serverID != "" && point.PreviousFile != "" {
+		acquireUpdate(inst.ID)
+		defer releaseUpdate(inst.ID)
+		data, err := previousJar(point)
+		if err != nil {
+			fail(err.Error())
+			return
+		}
+		folder := path.Dir(point.PreviousFile) + "/"
+		restoreName := path.Base(point.PreviousFile)
+		uj.emitState(StateUploadingNew, map[string]any{"file": restoreName, "size": len(data)})
+		srv := backendFor(inst)
+		if _, err := withRetryCount(ctx, func() error { return srv.PutFile(ctx, serverID, folder+restoreName, data) }); err != nil {
+			fail(err.Error())
+			return
+		}
+		uj.emitState(StateVerifyingNew, map[string]any{"file": restoreName, "size": len(data)})
+		var files []backend.FileEntry
+		if _, err := withRetryCount(ctx, func() error {
+			var e error
+			files, e = srv.ListPath(ctx, serverID, folder)
+			return e
+		}); err != nil {
+			fail(err.Error())
+			return
+		}
+		if !hasFile(files, restoreName) {
+			fail("rollback verification failed")
+			return
+		}
+	}
+
+	uj.emitState(StateUpdatingDB, map[string]any{"mod_id": m.ID})
+	if err := dbpkg.RestoreMod(db, m); err != nil {
+		uj.emitState(StateFailed, map[string]any{"error": err.Error(), "hint": "DB update failed."})
+		return
+	}
+	if err := dbpkg.ConsumeRollbackPoint(db, point.ID); err != nil {
+		log.Warn().Err(err).Int("update_id", point.ID).Msg("consume rollback point failed")
+	}
+	if artifactStore != nil && point.ArtifactPath != "" {
+		_ = artifactStore.Remove(point.ArtifactPath)
+	}
+	_ = dbpkg.InsertEvent(db, &dbpkg.ModEvent{InstanceID: m.InstanceID, ModID: &m.ID, Action: "rolled_back", ModName: m.Name, To: m.CurrentVersion})
+	telemetry.Event("mod_restored", map[string]string{
+		"job_id": strconv.Itoa(uj.id),
+		"mod_id": strconv.Itoa(m.ID),
+		"to":     m.CurrentVersion,
+	})
+	uj.emitState(StateSucceeded, map[string]any{"mod_id": m.ID, "version": m.CurrentVersion})
+}
+
+func hasFile(files []backend.FileEntry, name string) bool {
+	for _, f := range files {
+		if !f.IsDir && strings.EqualFold(f.Name, name) {
+			return true
+		}
+	}
+	return false
+}
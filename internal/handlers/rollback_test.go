@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"modsentinel/internal/artifacts"
+	"modsentinel/internal/backend"
+	dbpkg "modsentinel/internal/db"
+	pppkg "modsentinel/internal/pufferpanel"
+)
+
+// fakeServer is an in-memory PufferPanel file tree keyed by path.
+type fakeServer map[string][]byte
+
+func (fs fakeServer) install(t *testing.T) {
+	t.Helper()
+	origPut, origList, origDel := ppPutFile, ppListPath, ppDeleteFile
+	t.Cleanup(func() { ppPutFile, ppListPath, ppDeleteFile = origPut, origList, origDel })
+	ppPutFile = func(ctx context.Context, id, path string, data []byte) error {
+		fs[path] = data
+		return nil
+	}
+	ppDeleteFile = func(ctx context.Context, id, path string) error {
+		if _, ok := fs[path]; !ok {
+			return pppkg.ErrNotFound
+		}
+		delete(fs, path)
+		return nil
+	}
+	ppListPath = func(ctx context.Context, id, folder string) ([]pppkg.FileEntry, error) {
+		var out []pppkg.FileEntry
+		for p := range fs {
+			if strings.HasPrefix(p, folder) {
+				out = append(out, pppkg.FileEntry{Name: strings.TrimPrefix(p, folder)})
+			}
+		}
+		return out, nil
+	}
+}
+
+// appliedUpdate records a succeeded update of m from 0.5.2 to its current
+// version and returns the mod_updates row ID.
+func appliedUpdate(t *testing.T, db *sql.DB, m *dbpkg.Mod, prevJar []byte) int {
+	t.Helper()
+	updID, _, err := dbpkg.InsertModUpdateQueued(db, m.ID, "0.5.2", m.CurrentVersion, "k:"+m.CurrentVersion)
+	if err != nil {
+		t.Fatalf("insert update: %v", err)
+	}
+	if err := dbpkg.MarkModUpdateFinished(db, updID, string(StateSucceeded), ""); err != nil {
+		t.Fatalf("finish update: %v", err)
+	}
+	prev := *m
+	prev.CurrentVersion = "0.5.2"
+	prev.DownloadURL = "https://cdn.example/sodium-0.5.2.jar"
+	recordRollbackPoint(db, updID, &prev, "mods/sodium-0.5.2.jar", prevJar, sha512Hex(string(prevJar)))
+	return updID
+}
+
+func TestRollbackRestoresPreviousJar(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	oldStore := artifactStore
+	artifactStore = artifacts.New(t.TempDir())
+	defer func() { artifactStore = oldStore }()
+
+	inst := &dbpkg.Instance{Name: "rb", Loader: "fabric", PufferpanelServerID: "srv"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	m := &dbpkg.Mod{Name: "Sodium", URL: "https://modrinth.com/mod/sodium", Channel: "release", CurrentVersion: "0.5.3", AvailableVersion: "0.5.3", DownloadURL: "https://cdn.example/sodium-0.5.3.jar", InstanceID: inst.ID}
+	if err := dbpkg.InsertMod(db, m); err != nil {
+		t.Fatalf("insert mod: %v", err)
+	}
+	server := fakeServer{"mods/sodium-0.5.3.jar": []byte("new")}
+	server.install(t)
+	updID := appliedUpdate(t, db, m, []byte("old"))
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", strconv.Itoa(m.ID))
+	req := httptest.NewRequest(http.MethodPost, "/api/mods/"+strconv.Itoa(m.ID)+"/rollback", nil)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+	rollbackModHandler(db)(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	var ack struct {
+		JobID int `json:"job_id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&ack); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	mu, err := dbpkg.GetModUpdate(db, ack.JobID)
+	if err != nil || mu.Kind != dbpkg.ModUpdateKindRollback || mu.RollbackOf != updID {
+		t.Fatalf("rollback row = %+v, %v", mu, err)
+	}
+
+	uj := getUpdateJob(ack.JobID)
+	runRollbackJob(context.Background(), db, uj, mu)
+	if uj.state != StateSucceeded {
+		t.Fatalf("state = %s, events = %+v", uj.state, uj.snapshotEvents())
+	}
+	if string(server["mods/sodium-0.5.2.jar"]) != "old" {
+		t.Fatalf("previous jar not restored: %v", server)
+	}
+	if _, ok := server["mods/sodium-0.5.3.jar"]; ok {
+		t.Fatalf("newer jar not removed: %v", server)
+	}
+	got, _ := dbpkg.GetMod(db, m.ID)
+	if got.CurrentVersion != "0.5.2" || got.DownloadURL != "https://cdn.example/sodium-0.5.2.jar" {
+		t.Fatalf("mod not reverted: %+v", got)
+	}
+	if _, err := dbpkg.LatestRollbackPoint(db, m.ID); err != sql.ErrNoRows {
+		t.Fatalf("rollback point not consumed: %v", err)
+	}
+	if rows, _ := dbpkg.ListRetainedArtifacts(db, m.ID); len(rows) != 0 {
+		t.Fatalf("artifact still retained: %+v", rows)
+	}
+
+	// Nothing left to undo.
+	w = httptest.NewRecorder()
+	rollbackModHandler(db)(w, req)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("second rollback status=%d", w.Code)
+	}
+}
+
+func TestRecordRollbackPointPrunesToRetention(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	oldStore := artifactStore
+	artifactStore = artifacts.New(t.TempDir())
+	defer func() { artifactStore = oldStore }()
+
+	inst := &dbpkg.Instance{Name: "prune", Loader: "fabric", PufferpanelServerID: "srv"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	inst.RollbackRetention = 2
+	if err := dbpkg.UpdateInstance(db, inst); err != nil {
+		t.Fatalf("update inst: %v", err)
+	}
+	m := &dbpkg.Mod{Name: "Sodium", URL: "https://modrinth.com/mod/sodium", InstanceID: inst.ID}
+	if err := dbpkg.InsertMod(db, m); err != nil {
+		t.Fatalf("insert mod: %v", err)
+	}
+	var ids []int
+	for _, v := range []string{"0.5.3", "0.5.4", "0.5.5"} {
+		m.CurrentVersion = v
+		ids = append(ids, appliedUpdate(t, db, m, []byte(v)))
+	}
+	rows, err := dbpkg.ListRetainedArtifacts(db, m.ID)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(rows) != 2 || rows[0].ID != ids[2] || rows[1].ID != ids[1] {
+		t.Fatalf("retained = %+v", rows)
+	}
+	if _, err := artifactStore.Get(artifacts.UpdateKey(ids[0]) + "/sodium-0.5.2.jar"); err == nil {
+		t.Fatalf("pruned jar still on disk")
+	}
+}
+
+func TestRollbackRestoresRemovedMod(t *testing.T) {
+	updateJobs.Range(func(k, _ any) bool { updateJobs.Delete(k); return true })
+	db := setupDB(t)
+	defer db.Close()
+	oldStore := artifactStore
+	artifactStore = artifacts.New(t.TempDir())
+	defer func() { artifactStore = oldStore }()
+
+	inst := &dbpkg.Instance{Name: "rm", Loader: "fabric", Backend: backend.Local, PufferpanelServerID: "srv"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	inst.RollbackRetention = 1
+	if err := dbpkg.UpdateInstance(db, inst); err != nil {
+		t.Fatalf("update inst: %v", err)
+	}
+	m := &dbpkg.Mod{Name: "Sodium", URL: "https://modrinth.com/mod/sodium", Channel: "release", CurrentVersion: "0.5.3", DownloadURL: "https://cdn.example/sodium-0.5.3.jar", InstanceID: inst.ID}
+	if err := dbpkg.InsertMod(db, m); err != nil {
+		t.Fatalf("insert mod: %v", err)
+	}
+	server := fakeBackend{"mods/sodium-0.5.3.jar": []byte("jar")}
+	server.install(t, backend.Local)
+
+	updID, err := enqueueRemoveJob(context.Background(), db, m.ID, "rm:sodium")
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	mu, err := dbpkg.GetModUpdate(db, updID)
+	if err != nil {
+		t.Fatalf("get update: %v", err)
+	}
+	uj := getUpdateJob(updID)
+	runRemoveJob(context.Background(), db, uj, mu)
+	if uj.state != StateSucceeded {
+		t.Fatalf("remove state = %s, events = %+v", uj.state, uj.snapshotEvents())
+	}
+	if _, ok := server["mods/sodium-0.5.3.jar"]; ok {
+		t.Fatalf("jar not removed: %v", server)
+	}
+	if _, err := dbpkg.GetMod(db, m.ID); err != sql.ErrNoRows {
+		t.Fatalf("mod still tracked: %v", err)
+	}
+	if rows, _ := dbpkg.ListRetainedArtifacts(db, m.ID); len(rows) != 1 || rows[0].ID != updID {
+		t.Fatalf("removed jar not retained: %+v", rows)
+	}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", strconv.Itoa(m.ID))
+	req := httptest.NewRequest(http.MethodPost, "/api/mods/"+strconv.Itoa(m.ID)+"/rollback", nil)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+	rollbackModHandler(db)(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	var ack struct {
+		JobID int `json:"job_id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&ack); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	rb, err := dbpkg.GetModUpdate(db, ack.JobID)
+	if err != nil || rb.Kind != dbpkg.ModUpdateKindRollback || rb.RollbackOf != updID {
+		t.Fatalf("rollback row = %+v, %v", rb, err)
+	}
+	uj = getUpdateJob(ack.JobID)
+	runRollbackJob(context.Background(), db, uj, rb)
+	if uj.state != StateSucceeded {
+		t.Fatalf("rollback state = %s, events = %+v", uj.state, uj.snapshotEvents())
+	}
+	if string(server["mods/sodium-0.5.3.jar"]) != "jar" {
+		t.Fatalf("removed jar not restored: %v", server)
+	}
+	got, err := dbpkg.GetMod(db, m.ID)
+	if err != nil || got.CurrentVersion != "0.5.3" || got.DownloadURL != m.DownloadURL {
+		t.Fatalf("mod not restored: %+v, %v", got, err)
+	}
+	if _, err := dbpkg.LatestRemovalPoint(db, m.ID); err != sql.ErrNoRows {
+		t.Fatalf("removal point not consumed: %v", err)
+	}
+}
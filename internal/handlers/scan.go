@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+
+	dbpkg "modsentinel/internal/db"
+	"modsentinel/internal/httpx"
+	"modsentinel/internal/scan"
+	"modsentinel/internal/telemetry"
+)
+
+// jarScanner checks jars before upload and during sync. Without a
+// configured blocklist only the built-in rules apply.
+var jarScanner = scan.New(nil)
+
+// SetScanner configures the scanner used for jars, e.g. with a blocklist.
+func SetScanner(s *scan.Scanner) {
+	jarScanner = s
+}
+
+// blockReason describes the first finding that blocks an install.
+func blockReason(findings []scan.Finding) string {
+	for _, f := range findings {
+		if f.Severity == scan.SeverityHigh {
+			return fmt.Sprintf("jar blocked by scan: %s (%s)", f.Detail, f.Rule)
+		}
+	}
+	return ""
+}
+
+// scanJar scans a jar on an instance and stores the result for file. It
+// reports whether a finding should stop the install.
+func scanJar(db *sql.DB, instID int, modID *int, file string, data []byte) ([]scan.Finding, bool) {
+	findings := jarScanner.Scan(data)
+	sum := sha256.Sum256(data)
+	return findings, recordJarScan(db, instID, modID, file, hex.EncodeToString(sum[:]), findings)
+}
+
+// jarBlockedError reports a jar the scanner refused to install.
+type jarBlockedError struct {
+	Findings []scan.Finding
+}
+
+func (e *jarBlockedError) Error() string { return blockReason(e.Findings) }
+
+// uploadJar scans a jar and uploads it to p on the instance's server. Jars
+// with blocking findings are refused with a *jarBlockedError before anything
+// is written.
+func uploadJar(ctx context.Context, db *sql.DB, inst *dbpkg.Instance, modID *int, p string, data []byte) error {
+	if findings, blocked := scanJar(db, inst.ID, modID, path.Base(p), data); blocked {
+		return &jarBlockedError{Findings: findings}
+	}
+	return backendFor(inst).PutFile(ctx, inst.PufferpanelServerID, p, data)
+}
+
+// writeUploadError writes an uploadJar failure: a conflict for blocked jars,
+// the backend error otherwise.
+func writeUploadError(w http.ResponseWriter, r *http.Request, err error) {
+	var be *jarBlockedError
+	if errors.As(err, &be) {
+		httpx.Write(w, r, httpx.Conflict(err.Error()))
+		return
+	}
+	writePPError(w, r, err)
+}
+
+// recordJarScan stores the findings of a jar and reports whether they block
+// installing it.
+func recordJarScan(db *sql.DB, instID int, modID *int, file, sha256 string, findings []scan.Finding) bool {
+	rec := dbpkg.JarScan{InstanceID: instID, ModID: modID, File: file, SHA256: sha256, Findings: make([]dbpkg.ScanFinding, 0, len(findings))}
+	for _, f := range findings {
+		rec.Findings = append(rec.Findings, dbpkg.ScanFinding{Rule: f.Rule, Severity: string(f.Severity), Entry: f.Entry, Detail: f.Detail})
+	}
+	if err := dbpkg.RecordJarScan(db, &rec); err != nil {
+		log.Error().Err(err).Int("instance_id", instID).Str("file", file).Msg("record jar scan")
+	}
+	if len(findings) == 0 {
+		return false
+	}
+	blocked := scan.Blocking(findings)
+	telemetry.Event("jar_scan_findings", map[string]string{
+		"instance_id": strconv.Itoa(instID),
+		"file":        file,
+		"findings":    strconv.Itoa(len(findings)),
+		"blocked":     strconv.FormatBool(blocked),
+	})
+	return blocked
+}
+
+// instanceScanOut summarizes the stored scans of an instance.
+type instanceScanOut struct {
+	InstanceID int             `json:"instance_id"`
+	Flagged    int             `json:"flagged"`
+	Blocked    int             `json:"blocked"`
+	Scans      []dbpkg.JarScan `json:"scans"`
+}
+
+func instanceScanHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inst := loadWindowInstance(w, r, db)
+		if inst == nil {
+			return
+		}
+		scans, err := dbpkg.ListInstanceScans(db, inst.ID)
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		out := instanceScanOut{InstanceID: inst.ID, Scans: scans}
+		for _, s := range scans {
+			if len(s.Findings) == 0 {
+				continue
+			}
+			out.Flagged++
+			for _, f := range s.Findings {
+				if f.Severity == string(scan.SeverityHigh) {
+					out.Blocked++
+					break
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(out)
+	}
+}
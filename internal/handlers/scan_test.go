@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"modsentinel/internal/backend"
+	dbpkg "modsentinel/internal/db"
+	mr "modsentinel/internal/modrinth"
+	"modsentinel/internal/scan"
+)
+
+func getInstanceScans(t *testing.T, h http.HandlerFunc, instID int) instanceScanOut {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/instances/"+strconv.Itoa(instID)+"/scan", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", strconv.Itoa(instID))
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+	h(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var out instanceScanOut
+	if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return out
+}
+
+func TestRunUpdateJob_BlocksFlaggedJar(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	m, server := pendingUpdate(t, db, "jar", nil)
+	sum := sha256.Sum256([]byte("jar"))
+	old := jarScanner
+	SetScanner(scan.New(map[string]string{hex.EncodeToString(sum[:]): "known stealer"}))
+	defer SetScanner(old)
+
+	uj := &updateJob{id: 1, db: db}
+	runUpdateJob(context.Background(), db, uj, m.ID)
+	if uj.state != StateFailed {
+		t.Fatalf("state = %s, events = %+v", uj.state, uj.snapshotEvents())
+	}
+	if _, uploaded := server["mods/lib-1.1.0.jar"]; uploaded {
+		t.Fatalf("flagged jar uploaded: %v", server)
+	}
+
+	out := getInstanceScans(t, instanceScanHandler(db), m.InstanceID)
+	if out.Blocked != 1 || len(out.Scans) != 1 {
+		t.Fatalf("scans = %+v", out)
+	}
+	s := out.Scans[0]
+	if s.ModID == nil || *s.ModID != m.ID || s.File != "lib-1.1.0.jar" || len(s.Findings) != 1 || s.Findings[0].Rule != scan.RuleBlocklist {
+		t.Fatalf("scan = %+v", s)
+	}
+}
+
+func TestRunUpdateJob_RecordsCleanScan(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	m, _ := pendingUpdate(t, db, "jar", nil)
+
+	uj := &updateJob{id: 1, db: db}
+	runUpdateJob(context.Background(), db, uj, m.ID)
+	if uj.state != StateSucceeded {
+		t.Fatalf("state = %s, events = %+v", uj.state, uj.snapshotEvents())
+	}
+	out := getInstanceScans(t, instanceScanHandler(db), m.InstanceID)
+	if out.Flagged != 0 || len(out.Scans) != 1 || len(out.Scans[0].Findings) != 0 {
+		t.Fatalf("scans = %+v", out)
+	}
+}
+
+func TestCreateModHandler_RefusesFlaggedJars(t *testing.T) {
+	for _, flagged := range []string{"app", "lib"} {
+		t.Run(flagged, func(t *testing.T) {
+			db := setupDB(t)
+			defer db.Close()
+			inst := &dbpkg.Instance{Name: "scan", Loader: "fabric", Backend: backend.Local, PufferpanelServerID: "srv"}
+			if err := dbpkg.InsertInstance(db, inst); err != nil {
+				t.Fatal(err)
+			}
+			cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("jar:" + r.URL.Path))
+			}))
+			defer cdn.Close()
+			server := fakeBackend{}
+			server.install(t, backend.Local)
+
+			app := depVersion("app-1", "app", "release", time.Now(), mr.Dependency{ProjectID: "lib", DependencyType: mr.DependencyRequired})
+			app.Files[0].URL = cdn.URL + "/app-1.jar"
+			lib := depVersion("lib-1", "lib", "release", time.Now())
+			lib.Files[0].URL = cdn.URL + "/lib-1.jar"
+			old := modClient
+			modClient = depClient{versions: map[string][]mr.Version{"app": {app}, "lib": {lib}}}
+			defer func() { modClient = old }()
+			sum := sha256.Sum256([]byte("jar:/" + flagged + "-1.jar"))
+			oldScanner := jarScanner
+			SetScanner(scan.New(map[string]string{hex.EncodeToString(sum[:]): "known stealer"}))
+			defer SetScanner(oldScanner)
+
+			payload := `{"url":"https://modrinth.com/mod/app","game_version":"1.20.1","loader":"fabric","channel":"release","version_id":"app-1","instance_id":` + strconv.Itoa(inst.ID) + `}`
+			w := httptest.NewRecorder()
+			createModHandler(db)(w, httptest.NewRequest(http.MethodPost, "/api/mods", strings.NewReader(payload)))
+			if w.Code != http.StatusConflict {
+				t.Fatalf("status %d: %s", w.Code, w.Body.String())
+			}
+			if _, ok := server["mods/"+flagged+"-1.jar"]; ok {
+				t.Fatalf("flagged jar uploaded: %v", server)
+			}
+			if _, ok := server["mods/app-1.jar"]; ok {
+				t.Fatal("mod uploaded despite a flagged jar")
+			}
+			mods, err := dbpkg.ListMods(db, inst.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range mods {
+				if m.Name == "APP" {
+					t.Fatalf("mod tracked despite a flagged jar: %+v", mods)
+				}
+			}
+			if out := getInstanceScans(t, instanceScanHandler(db), inst.ID); out.Blocked != 1 {
+				t.Fatalf("scans = %+v", out)
+			}
+		})
+	}
+}
+
+func TestInstallDependencies_RefusesFlaggedJar(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	inst := &dbpkg.Instance{Name: "deps", Loader: "fabric", Backend: backend.Local, PufferpanelServerID: "srv"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatal(err)
+	}
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("jar:" + r.URL.Path))
+	}))
+	defer cdn.Close()
+	server := fakeBackend{}
+	server.install(t, backend.Local)
+	sum := sha256.Sum256([]byte("jar:/lib-1.jar"))
+	old := jarScanner
+	SetScanner(scan.New(map[string]string{hex.EncodeToString(sum[:]): "known stealer"}))
+	defer SetScanner(old)
+
+	plan := &depPlan{Install: []depInstall{{Slug: "lib", Name: "Lib", Version: "1", DownloadURL: cdn.URL + "/lib-1.jar"}}}
+	mods, err := installDependencies(context.Background(), db, inst, plan)
+	var blocked *jarBlockedError
+	if !errors.As(err, &blocked) || len(mods) != 0 {
+		t.Fatalf("installed %+v, err %v", mods, err)
+	}
+	if len(server) != 0 {
+		t.Fatalf("flagged dependency uploaded: %v", server)
+	}
+}
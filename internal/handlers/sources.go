@@ -0,0 +1,417 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	urlpkg "net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	dbpkg "modsentinel/internal/db"
+	mr "modsentinel/internal/modrinth"
+)
+
+// errProjectNotFound is matched by the errors sources return for projects
+// they do not have.
+var errProjectNotFound = errors.New("project not found")
+
+// notFoundError is a source's own error for a missing project that also
+// matches errProjectNotFound.
+type notFoundError struct{ err error }
+
+func (e *notFoundError) Error() string   { return e.err.Error() }
+func (e *notFoundError) Unwrap() []error { return []error{errProjectNotFound, e.err} }
+
+// projectNotFound marks err as errProjectNotFound when notFound is set.
+func projectNotFound(err error, notFound bool) error {
+	if err == nil || !notFound {
+		return err
+	}
+	return &notFoundError{err}
+}
+
+// Source is a provider mods can be tracked on and updated from. Projects and
+// versions use Modrinth's shapes as the common model; a version's ID and
+// ProjectID are whatever identifiers the source uses.
+type Source interface {
+	// Name is stored on mods tracked on this source, e.g. "modrinth".
+	Name() string
+	// ParseURL returns the project slug of a project URL, reporting false
+	// when the URL does not belong to this source.
+	ParseURL(raw string) (string, bool)
+	// ProjectURL returns the canonical project URL for slug.
+	ProjectURL(slug string) string
+	// Project fetches project info by slug. Errors for projects the source
+	// does not have match errProjectNotFound.
+	Project(ctx context.Context, slug string) (*mr.Project, error)
+	// Versions lists a project's versions, newest first. Empty filters are
+	// not applied.
+	Versions(ctx context.Context, slug, gameVersion, loader string) ([]mr.Version, error)
+	// Identify matches jars by content, keyed by jar filename. Jars the
+	// source does not know are omitted.
+	Identify(ctx context.Context, jars map[string]*jarInfo) map[string]*jarMatch
+	// Download fetches the primary file of a version, from the jar cache
+	// when one of its published hashes is cached. The bool reports a cache
+	// hit.
+	Download(ctx context.Context, v mr.Version) ([]byte, bool, error)
+}
+
+// VersionSource is implemented by sources that can fetch a single version
+// by ID instead of listing every version of the project.
+type VersionSource interface {
+	VersionByID(ctx context.Context, id string) (*mr.Version, error)
+}
+
+// DependencySource is implemented by sources whose versions list their
+// dependencies as Modrinth project and version IDs.
+type DependencySource interface {
+	// DependencyMetadata reports whether resolveDependencies can plan the
+	// dependencies of this source's versions.
+	DependencyMetadata() bool
+}
+
+var (
+	sourcesMu sync.RWMutex
+	sources   []Source
+)
+
+func init() {
+	RegisterSource(modrinthSource{})
+	RegisterSource(curseforgeSource{})
+	RegisterSource(hangarSource{})
+}
+
+// RegisterSource adds s to the registry, replacing any source of the same
+// name. Sources are consulted in registration order when identifying jars.
+func RegisterSource(s Source) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	for i, cur := range sources {
+		if cur.Name() == s.Name() {
+			sources[i] = s
+			return
+		}
+	}
+	sources = append(sources, s)
+}
+
+func registeredSources() []Source {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+	return append([]Source(nil), sources...)
+}
+
+// lookupSource returns the source registered under name. An empty name is
+// Modrinth, the source of mods tracked before sources existed.
+func lookupSource(name string) (Source, bool) {
+	if name == "" {
+		name = dbpkg.SourceModrinth
+	}
+	for _, s := range registeredSources() {
+		if s.Name() == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// sourceForMod returns the source m is tracked on.
+func sourceForMod(m *dbpkg.Mod) (Source, error) {
+	s, ok := lookupSource(m.Source)
+	if !ok {
+		return nil, fmt.Errorf("unknown mod source %q", m.Source)
+	}
+	return s, nil
+}
+
+// sourceForURL finds the source a project URL belongs to and its slug.
+func sourceForURL(raw string) (Source, string, bool) {
+	for _, s := range registeredSources() {
+		if slug, ok := s.ParseURL(raw); ok {
+			return s, slug, true
+		}
+	}
+	return nil, "", false
+}
+
+// resolveModSource sets m.Source from its URL and returns the source and slug.
+func resolveModSource(m *dbpkg.Mod) (Source, string, error) {
+	s, slug, ok := sourceForURL(m.URL)
+	if !ok {
+		return nil, "", errors.New("unsupported mod URL")
+	}
+	m.Source = s.Name()
+	return s, slug, nil
+}
+
+// sourceModURL returns the canonical project URL of slug on the named source.
+func sourceModURL(name, slug string) string {
+	if s, ok := lookupSource(name); ok {
+		return s.ProjectURL(slug)
+	}
+	return modrinthSource{}.ProjectURL(slug)
+}
+
+// modSlug parses the project slug from m's URL according to its source.
+func modSlug(m *dbpkg.Mod) (string, error) {
+	s, err := sourceForMod(m)
+	if err != nil {
+		return "", err
+	}
+	slug, ok := s.ParseURL(m.URL)
+	if !ok {
+		return "", errors.New("slug not found")
+	}
+	return slug, nil
+}
+
+// modVersions lists the versions of m's project on its source.
+func modVersions(ctx context.Context, m *dbpkg.Mod, slug, gameVersion, loader string) ([]mr.Version, error) {
+	s, err := sourceForMod(m)
+	if err != nil {
+		return nil, err
+	}
+	return s.Versions(ctx, slug, gameVersion, loader)
+}
+
+// resolvesDependencies reports whether versions from src carry dependency
+// metadata that resolveDependencies understands.
+func resolvesDependencies(src Source) bool {
+	d, ok := src.(DependencySource)
+	return ok && d.DependencyMetadata()
+}
+
+// sourceVersion finds version id of slug on src, listing the project's
+// versions when src cannot fetch one directly.
+func sourceVersion(ctx context.Context, src Source, slug, id string) (*mr.Version, error) {
+	if vs, ok := src.(VersionSource); ok {
+		return vs.VersionByID(ctx, id)
+	}
+	versions, err := src.Versions(ctx, slug, "", "")
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		if versions[i].ID == id {
+			return &versions[i], nil
+		}
+	}
+	return nil, errors.New("version not found")
+}
+
+// identifyJars asks each registered source, in order, to identify the jars
+// earlier sources did not know.
+func identifyJars(ctx context.Context, jars map[string]*jarInfo) map[string]*jarMatch {
+	hits := make(map[string]*jarMatch, len(jars))
+	for _, s := range registeredSources() {
+		pending := make(map[string]*jarInfo, len(jars))
+		for name, j := range jars {
+			if _, ok := hits[name]; !ok && j != nil {
+				pending[name] = j
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+		for name, m := range s.Identify(ctx, pending) {
+			m.source = s.Name()
+			hits[name] = m
+		}
+	}
+	return hits
+}
+
+// modrinthSource adapts modClient to Source.
+type modrinthSource struct{}
+
+func (modrinthSource) Name() string { return dbpkg.SourceModrinth }
+
+func (modrinthSource) ParseURL(raw string) (string, bool) {
+	if u, err := urlpkg.Parse(raw); err == nil && u.Host != "" && !strings.HasSuffix(strings.ToLower(u.Hostname()), "modrinth.com") {
+		return "", false
+	}
+	slug, err := parseModrinthSlug(raw)
+	return slug, err == nil
+}
+
+func (modrinthSource) ProjectURL(slug string) string { return "https://modrinth.com/mod/" + slug }
+
+func (modrinthSource) Project(ctx context.Context, slug string) (*mr.Project, error) {
+	p, err := modClient.Project(ctx, slug)
+	var me *mr.Error
+	return p, projectNotFound(err, errors.As(err, &me) && me.Status == http.StatusNotFound)
+}
+
+func (modrinthSource) Versions(ctx context.Context, slug, gameVersion, loader string) ([]mr.Version, error) {
+	if gameVersion == "" && loader == "" {
+		return modClient.Versions(ctx, slug, "", "")
+	}
+	return guardedVersions(ctx, slug, gameVersion, loader)
+}
+
+func (modrinthSource) Identify(ctx context.Context, jars map[string]*jarInfo) map[string]*jarMatch {
+	out := make(map[string]*jarMatch)
+	for name, v := range lookupJarHashes(ctx, jars) {
+		m, err := matchJarByHash(ctx, v, jars[name])
+		if err != nil {
+			if ctx.Err() != nil {
+				return out
+			}
+			log.Ctx(ctx).Debug().Str("file", name).Err(err).Msg("modrinth project fetch for hash match failed")
+			continue
+		}
+		out[name] = m
+	}
+	return out
+}
+
+func (modrinthSource) VersionByID(ctx context.Context, id string) (*mr.Version, error) {
+	return modClient.Version(ctx, id)
+}
+
+func (modrinthSource) DependencyMetadata() bool { return true }
+
+func (modrinthSource) Download(ctx context.Context, v mr.Version) ([]byte, bool, error) {
+	f, ok := v.PrimaryFile()
+	if !ok {
+		return nil, false, errors.New("version has no files")
+	}
+	return fetchArtifact(ctx, f)
+}
+
+// trackedFile is the source version and file a tracked mod is installed
+// from.
+type trackedFile struct {
+	mod     dbpkg.Mod
+	slug    string
+	version mr.Version
+	file    mr.VersionFile
+}
+
+// resolveTrackedFiles resolves the installed files of mods on the named
+// sources. Modrinth versions are fetched in bulk by stored version ID or by
+// the installed jar's hash; anything else is matched by version number.
+// Missing Modrinth side support and resolved version IDs are cached on the
+// mods. Mods of other sources, or whose file cannot be resolved, are
+// returned by name.
+func resolveTrackedFiles(ctx context.Context, db *sql.DB, mods []dbpkg.Mod, names ...string) ([]trackedFile, []string, error) {
+	var out []trackedFile
+	var skipped, missing, ids []string
+	sums := map[int]string{}
+	for _, m := range mods {
+		src := m.Source
+		if src == "" {
+			src = dbpkg.SourceModrinth
+		}
+		slug, err := modSlug(&m)
+		if err != nil || !slices.Contains(names, src) {
+			skipped = append(skipped, m.Name)
+			continue
+		}
+		m.Source = src
+		out = append(out, trackedFile{mod: m, slug: slug})
+		if src != dbpkg.SourceModrinth {
+			continue
+		}
+		if m.ClientSide == "" || m.ServerSide == "" {
+			missing = append(missing, slug)
+		}
+		sums[m.ID], _ = dbpkg.GetModContentHash(db, m.ID)
+		if m.VersionID != "" {
+			ids = append(ids, m.VersionID)
+		}
+	}
+	if len(missing) > 0 {
+		projects, err := modClient.Projects(ctx, missing)
+		if err != nil {
+			return nil, nil, err
+		}
+		bySlug := make(map[string]mr.Project, 2*len(projects))
+		for _, p := range projects {
+			bySlug[strings.ToLower(p.Slug)] = p
+			bySlug[strings.ToLower(p.ID)] = p
+		}
+		for i := range out {
+			m := &out[i].mod
+			p, ok := bySlug[strings.ToLower(out[i].slug)]
+			if !ok || m.Source != dbpkg.SourceModrinth || (m.ClientSide != "" && m.ServerSide != "") {
+				continue
+			}
+			m.ClientSide, m.ServerSide = p.ClientSide, p.ServerSide
+			_ = dbpkg.SetModSides(db, m.ID, p.ClientSide, p.ServerSide)
+		}
+	}
+	byID := map[string]mr.Version{}
+	if len(ids) > 0 {
+		list, err := modClient.VersionsByIDs(ctx, ids)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, v := range list {
+			byID[v.ID] = v
+		}
+	}
+	var hashes []string
+	for _, t := range out {
+		if _, ok := byID[t.mod.VersionID]; !ok && sums[t.mod.ID] != "" {
+			hashes = append(hashes, sums[t.mod.ID])
+		}
+	}
+	byHash := map[string]mr.Version{}
+	if len(hashes) > 0 {
+		var err error
+		if byHash, err = modClient.VersionsByHashes(ctx, hashes, "sha512"); err != nil {
+			return nil, nil, err
+		}
+	}
+	resolved := out[:0]
+	for _, t := range out {
+		v, ok := byID[t.mod.VersionID]
+		if !ok && sums[t.mod.ID] != "" {
+			v, ok = byHash[sums[t.mod.ID]]
+		}
+		if !ok {
+			versions, err := modVersions(ctx, &t.mod, t.slug, t.mod.GameVersion, t.mod.Loader)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, cand := range versions {
+				if cand.VersionNumber == t.mod.CurrentVersion {
+					v, ok = cand, true
+					break
+				}
+			}
+		}
+		f, found := installedFile(v, sums[t.mod.ID])
+		if !ok || !found {
+			skipped = append(skipped, t.mod.Name)
+			continue
+		}
+		if v.ID != t.mod.VersionID {
+			_ = dbpkg.SetModVersionRef(db, t.mod.ID, v.ProjectID, v.ID)
+			t.mod.ProjectID, t.mod.VersionID = v.ProjectID, v.ID
+		}
+		t.version, t.file = v, completeHashes(f)
+		resolved = append(resolved, t)
+	}
+	return resolved, skipped, nil
+}
+
+// installedFile picks the file of v matching the installed jar's SHA-512,
+// falling back to the primary file when the jar's hash is not known.
+func installedFile(v mr.Version, sha512 string) (mr.VersionFile, bool) {
+	if sha512 != "" {
+		for _, f := range v.Files {
+			if strings.EqualFold(f.Hashes["sha512"], sha512) {
+				return f, true
+			}
+		}
+	}
+	return v.PrimaryFile()
+}
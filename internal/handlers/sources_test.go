@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	dbpkg "modsentinel/internal/db"
+	mr "modsentinel/internal/modrinth"
+)
+
+func TestSourceForURL(t *testing.T) {
+	cases := []struct {
+		raw, source, slug string
+	}{
+		{"https://modrinth.com/mod/sodium", dbpkg.SourceModrinth, "sodium"},
+		{"https://modrinth.com/plugin/luckperms", dbpkg.SourceModrinth, "luckperms"},
+		{"https://www.curseforge.com/minecraft/mc-mods/jei", dbpkg.SourceCurseForge, "jei"},
+		{"https://www.curseforge.com/minecraft/mc-mods/jei/files/1234", dbpkg.SourceCurseForge, "jei"},
+		{"https://www.curseforge.com/minecraft/bukkit-plugins/essx", dbpkg.SourceCurseForge, "essx"},
+		{"https://hangar.papermc.io/HelpChat/PlaceholderAPI", dbpkg.SourceHangar, "PlaceholderAPI"},
+	}
+	for _, c := range cases {
+		src, slug, ok := sourceForURL(c.raw)
+		if !ok || src.Name() != c.source || slug != c.slug {
+			t.Fatalf("sourceForURL(%q) = %v, %q, %v", c.raw, src, slug, ok)
+		}
+	}
+	if _, _, ok := sourceForURL("https://example.com/mod/sodium"); ok {
+		t.Fatalf("expected no source for unknown host")
+	}
+}
+
+// stubSource stands in for a third-party source in registry tests.
+type stubSource struct {
+	modrinthSource
+	name string
+}
+
+func (s stubSource) Name() string { return s.name }
+
+func (s stubSource) Identify(ctx context.Context, jars map[string]*jarInfo) map[string]*jarMatch {
+	out := map[string]*jarMatch{}
+	for name := range jars {
+		out[name] = &jarMatch{proj: &mr.Project{Title: s.name}, slug: name}
+	}
+	return out
+}
+
+func TestRegisterSource_ReplacesByName(t *testing.T) {
+	orig := registeredSources()
+	defer func() {
+		sourcesMu.Lock()
+		sources = orig
+		sourcesMu.Unlock()
+	}()
+	RegisterSource(stubSource{name: "private"})
+	RegisterSource(stubSource{name: dbpkg.SourceCurseForge})
+	got := registeredSources()
+	if len(got) != len(orig)+1 {
+		t.Fatalf("sources = %d, want %d", len(got), len(orig)+1)
+	}
+	if _, ok := got[1].(stubSource); !ok || got[1].Name() != dbpkg.SourceCurseForge {
+		t.Fatalf("curseforge not replaced in place: %T", got[1])
+	}
+	// Modrinth is consulted first, so the stub only sees what it left
+	// unidentified; with no Modrinth client hits, that is every jar.
+	old := modClient
+	modClient = hashClient{resolved: new(int)}
+	defer func() { modClient = old }()
+	ids := identifyJars(context.Background(), map[string]*jarInfo{"a.jar": newJarInfo([]byte("a"))})
+	if m := ids["a.jar"]; m == nil || m.source != dbpkg.SourceCurseForge {
+		t.Fatalf("identify = %+v", m)
+	}
+	if s, ok := lookupSource(""); !ok || s.Name() != dbpkg.SourceModrinth {
+		t.Fatalf("empty source name should resolve to modrinth")
+	}
+}
+
+// listOnlySource lists versions but has no optional capabilities.
+type listOnlySource struct {
+	curseforgeSource
+	versions []mr.Version
+}
+
+func (s listOnlySource) Versions(ctx context.Context, slug, gameVersion, loader string) ([]mr.Version, error) {
+	return s.versions, nil
+}
+
+func TestSourceCapabilities(t *testing.T) {
+	for _, src := range []Source{modrinthSource{}, curseforgeSource{}, hangarSource{}} {
+		if got, want := resolvesDependencies(src), src.Name() == dbpkg.SourceModrinth; got != want {
+			t.Fatalf("resolvesDependencies(%s) = %v", src.Name(), got)
+		}
+	}
+	src := listOnlySource{versions: []mr.Version{{ID: "1"}, {ID: "2", VersionNumber: "2.0"}}}
+	if v, err := sourceVersion(context.Background(), src, "jei", "2"); err != nil || v.VersionNumber != "2.0" {
+		t.Fatalf("sourceVersion = %+v, %v", v, err)
+	}
+	if _, err := sourceVersion(context.Background(), src, "jei", "3"); err == nil {
+		t.Fatal("expected missing version error")
+	}
+}
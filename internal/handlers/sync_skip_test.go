@@ -5,7 +5,6 @@ import (
     "context"
     "testing"
 
-    "github.com/rs/zerolog"
     "github.com/rs/zerolog/log"
     dbpkg "modsentinel/internal/db"
     pppkg "modsentinel/internal/pufferpanel"
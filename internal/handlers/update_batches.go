@@ -0,0 +1,524 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	dbpkg "modsentinel/internal/db"
+	"modsentinel/internal/httpx"
+	"modsentinel/internal/telemetry"
+)
+
+// Batch failure policies.
+const (
+	BatchStopOnFailure     = "stop"
+	BatchContinueOnFailure = "continue"
+)
+
+// BatchWaitingForWindow is the status of a batch held until its instance's
+// maintenance window opens.
+const BatchWaitingForWindow = "WaitingForWindow"
+
+// updatePlanItem describes one pending mod update and what it would change.
+// Manifest plans also install and remove mods; Action tells them apart and is
+// empty for updates planned from available versions.
+type updatePlanItem struct {
+	Action       string       `json:"action,omitempty"`
+	ModID        int          `json:"mod_id"`
+	Source       string       `json:"source,omitempty"`
+	Name         string       `json:"name"`
+	Slug         string       `json:"slug"`
+	FromVersion  string       `json:"from_version"`
+	ToVersion    string       `json:"to_version"`
+	Channel      string       `json:"channel"`
+	VersionID    string       `json:"version_id,omitempty"`
+	File         string       `json:"file,omitempty"`
+	URL          string       `json:"url,omitempty"`
+	Size         int64        `json:"size"`
+	Dependencies []depInstall `json:"dependencies"`
+	Warnings     []string     `json:"warnings,omitempty"`
+	Blockers     []string     `json:"blockers,omitempty"`
+}
+
+// updatePlan lists every pending update of an instance.
+type updatePlan struct {
+	InstanceID int              `json:"instance_id"`
+	Items      []updatePlanItem `json:"items"`
+	TotalSize  int64            `json:"total_size"`
+}
+
+// updateBatches holds in-memory event streams for batches keyed by ID.
+var updateBatches sync.Map // map[int]*updateJob
+
+// planInstanceUpdates computes the pending updates of inst. When only is
+// non-empty, just those mod IDs are considered.
+func planInstanceUpdates(ctx context.Context, db *sql.DB, inst *dbpkg.Instance, only map[int]bool) (*updatePlan, error) {
+	mods, err := dbpkg.ListMods(db, inst.ID)
+	if err != nil {
+		return nil, err
+	}
+	plan := &updatePlan{InstanceID: inst.ID, Items: []updatePlanItem{}}
+	// ListMods is newest first; plan in insertion order.
+	for i := len(mods) - 1; i >= 0; i-- {
+		m := mods[i]
+		if len(only) > 0 && !only[m.ID] {
+			continue
+		}
+		if strings.TrimSpace(m.AvailableVersion) == "" || m.AvailableVersion == m.CurrentVersion {
+			continue
+		}
+		item := updatePlanItem{
+			ModID:        m.ID,
+			Name:         m.Name,
+			FromVersion:  m.CurrentVersion,
+			ToVersion:    m.AvailableVersion,
+			Channel:      m.AvailableChannel,
+			Dependencies: []depInstall{},
+		}
+		slug, err := modSlug(&m)
+		if err != nil {
+			item.Blockers = append(item.Blockers, "invalid mod URL")
+			plan.Items = append(plan.Items, item)
+			continue
+		}
+		item.Slug = slug
+		pol, err := dbpkg.GetEffectivePolicy(db, &m)
+		if err != nil {
+			return nil, err
+		}
+		if reason := policyBlocksUpdate(pol, &m); reason != "" {
+			item.Blockers = append(item.Blockers, reason)
+			plan.Items = append(plan.Items, item)
+			continue
+		}
+		versions, err := modVersions(ctx, &m, slug, "", "")
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, v := range versions {
+			if v.VersionNumber != m.AvailableVersion {
+				continue
+			}
+			found = true
+			item.VersionID = v.ID
+			if f, ok := v.PrimaryFile(); ok {
+				item.URL = f.URL
+				item.Size = f.Size
+				item.File = f.Filename
+				if item.File == "" {
+					item.File = artifactFileName(f.URL, slug, v.VersionNumber)
+				}
+			}
+			if src, err := sourceForMod(&m); err != nil || !resolvesDependencies(src) {
+				break
+			}
+			deps, err := resolveDependencies(ctx, db, inst, slug, v)
+			if err != nil {
+				return nil, err
+			}
+			item.Dependencies = deps.Install
+			item.Warnings = deps.Warnings
+			item.Blockers = deps.Blockers
+			break
+		}
+		if !found {
+			item.Blockers = append(item.Blockers, "selected update not found")
+		}
+		plan.TotalSize += item.Size
+		plan.Items = append(plan.Items, item)
+	}
+	return plan, nil
+}
+
+type updatesRequest struct {
+	ModIDs    []int  `json:"mod_ids"`
+	OnFailure string `json:"on_failure"`
+}
+
+// loadUpdatesRequest resolves the instance and optional body shared by the
+// plan and apply endpoints. It writes the error response and returns nil on
+// failure.
+func loadUpdatesRequest(w http.ResponseWriter, r *http.Request, db *sql.DB) (*dbpkg.Instance, *updatesRequest) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		httpx.Write(w, r, httpx.BadRequest("invalid id"))
+		return nil, nil
+	}
+	var req updatesRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpx.Write(w, r, httpx.BadRequest("invalid json"))
+			return nil, nil
+		}
+	}
+	inst, err := dbpkg.GetInstance(db, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			httpx.Write(w, r, httpx.NotFound("instance not found"))
+			return nil, nil
+		}
+		httpx.Write(w, r, httpx.Internal(err))
+		return nil, nil
+	}
+	return inst, &req
+}
+
+func modIDSet(ids []int) map[int]bool {
+	out := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		out[id] = true
+	}
+	return out
+}
+
+// planUpdatesHandler returns every pending update of an instance with the
+// target version, file, size and dependency changes.
+func planUpdatesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inst, req := loadUpdatesRequest(w, r, db)
+		if inst == nil {
+			return
+		}
+		plan, err := planInstanceUpdates(r.Context(), db, inst, modIDSet(req.ModIDs))
+		if err != nil {
+			writeModrinthError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(plan)
+	}
+}
+
+// applyUpdatesHandler plans the instance's pending updates and runs them as
+// one batch on the update queue. It returns { batch_id, plan }.
+func applyUpdatesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inst, req := loadUpdatesRequest(w, r, db)
+		if inst == nil {
+			return
+		}
+		policy := strings.ToLower(strings.TrimSpace(req.OnFailure))
+		if policy == "" {
+			policy = BatchStopOnFailure
+		}
+		if policy != BatchStopOnFailure && policy != BatchContinueOnFailure {
+			httpx.Write(w, r, httpx.BadRequest("validation failed").WithDetails(map[string]string{"on_failure": "oneof=stop continue"}))
+			return
+		}
+		if inst.RequiresLoader {
+			telemetry.Event("action_blocked", map[string]string{"action": "update_all", "reason": "loader_required", "instance_id": strconv.Itoa(inst.ID)})
+			httpx.Write(w, r, httpx.LoaderRequired())
+			return
+		}
+		if updatesCh == nil {
+			httpx.Write(w, r, httpx.Unavailable("update queue not running"))
+			return
+		}
+		plan, err := planInstanceUpdates(r.Context(), db, inst, modIDSet(req.ModIDs))
+		if err != nil {
+			writeModrinthError(w, r, err)
+			return
+		}
+		if len(plan.Items) == 0 {
+			httpx.Write(w, r, httpx.Conflict("no pending updates"))
+			return
+		}
+		batchID, err := dbpkg.InsertUpdateBatch(db, inst.ID, policy, len(plan.Items))
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		b := &dbpkg.UpdateBatch{ID: batchID, InstanceID: inst.ID, OnFailure: policy, Status: "Running", Total: len(plan.Items)}
+		ev := &updateJob{id: batchID, events: make([]sseMsg, 0, 16)}
+		updateBatches.Store(batchID, ev)
+		ctx := updatesCtx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		go runUpdateBatch(ctx, db, b, plan.Items, ev)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(struct {
+			BatchID int         `json:"batch_id"`
+			Plan    *updatePlan `json:"plan"`
+		}{batchID, plan})
+	}
+}
+
+// runUpdateBatch enqueues the batch's updates one at a time and waits for
+// each to finish. Items with blockers are skipped. A failed update stops the
+// remaining items under the stop policy. When the instance has a maintenance
+// window, the batch waits for it to open and, if the window asks for it, runs
+// with the server stopped. Post-update restarts happen once per batch.
+func runUpdateBatch(ctx context.Context, db *sql.DB, b *dbpkg.UpdateBatch, items []updatePlanItem, ev *updateJob) {
+	progress := func(finished bool) {
+		_ = dbpkg.UpdateBatchProgress(db, b, finished)
+		name := "progress"
+		if finished {
+			name = "done"
+		}
+		ev.emit(name, map[string]any{
+			"batch_id":  b.ID,
+			"status":    b.Status,
+			"total":     b.Total,
+			"processed": b.Succeeded + b.Failed + b.Skipped,
+			"succeeded": b.Succeeded,
+			"failed":    b.Failed,
+			"skipped":   b.Skipped,
+		})
+	}
+	result := func(it updatePlanItem, jobID int, state, errMsg string) {
+		ev.emit("item", map[string]any{
+			"batch_id": b.ID,
+			"mod_id":   it.ModID,
+			"action":   it.Action,
+			"name":     it.Name,
+			"from":     it.FromVersion,
+			"to":       it.ToVersion,
+			"job_id":   jobID,
+			"state":    state,
+			"error":    errMsg,
+		})
+	}
+	skip := func(it updatePlanItem, reason string) {
+		b.Skipped++
+		result(it, 0, "Skipped", reason)
+		progress(false)
+	}
+	progress(false)
+	inst, err := dbpkg.GetInstance(db, b.InstanceID)
+	if err != nil {
+		inst = &dbpkg.Instance{ID: b.InstanceID}
+	}
+	win, sched, err := instanceWindow(db, b.InstanceID)
+	if err != nil {
+		log.Error().Err(err).Int("instance_id", b.InstanceID).Msg("invalid maintenance window; applying now")
+	}
+	if sched != nil {
+		if now := windowNow(); !sched.Open(now) {
+			b.Status = BatchWaitingForWindow
+			ev.emit("waiting", map[string]any{"batch_id": b.ID, "opens_at": sched.NextOpen(now)})
+			progress(false)
+		}
+		lock := maintenanceLock(b.InstanceID)
+		ready := waitForWindow(ctx, sched)
+		if ready {
+			select {
+			case lock <- struct{}{}:
+				defer func() { <-lock }()
+			case <-ctx.Done():
+				ready = false
+			}
+		}
+		b.Status = "Running"
+		if !ready {
+			for _, it := range items {
+				skip(it, "update queue stopped")
+			}
+			finishUpdateBatch(b)
+			progress(true)
+			return
+		}
+		progress(false)
+	}
+	stopped, ran := false, false
+	runItems := func() bool {
+		ran = true
+		for _, it := range items {
+			if stopped {
+				skip(it, "batch stopped after a failure")
+				continue
+			}
+			if len(it.Blockers) > 0 {
+				skip(it, strings.Join(it.Blockers, "; "))
+				continue
+			}
+			jobID, err := enqueueBatchItem(ctx, db, b.ID, it)
+			var state UpdateJobState
+			errMsg := ""
+			if err != nil {
+				state, errMsg = StateFailed, err.Error()
+			} else {
+				_ = dbpkg.SetModUpdateBatch(db, jobID, b.ID)
+				state = waitUpdateJob(ctx, getUpdateJob(jobID))
+				if state != StateSucceeded {
+					if mu, err := dbpkg.GetModUpdate(db, jobID); err == nil {
+						errMsg = mu.Error
+					}
+				}
+			}
+			switch state {
+			case StateSucceeded:
+				b.Succeeded++
+			case "":
+				// Queue shut down; the job is requeued on next start.
+				b.Skipped++
+				result(it, jobID, "Skipped", "update queue stopped")
+				stopped = true
+				progress(false)
+				continue
+			default:
+				b.Failed++
+				if b.OnFailure == BatchStopOnFailure {
+					stopped = true
+				}
+			}
+			result(it, jobID, string(state), errMsg)
+			progress(false)
+		}
+		return b.Succeeded > 0
+	}
+	stopServer := win != nil && win.RestartServer
+	if err := applyWithServerControl(ctx, db, inst, stopServer, runItems); err != nil && !ran {
+		for _, it := range items {
+			skip(it, "server stop failed: "+err.Error())
+		}
+	}
+	finishUpdateBatch(b)
+	progress(true)
+}
+
+// enqueueBatchItem queues the job carrying out one batch item.
+func enqueueBatchItem(ctx context.Context, db *sql.DB, batchID int, it updatePlanItem) (int, error) {
+	key := fmt.Sprintf("batch:%d:%d", batchID, it.ModID)
+	if it.Action == planActionRemove {
+		return enqueueRemoveJob(ctx, db, it.ModID, key)
+	}
+	return queueUpdateJob(ctx, db, it.ModID, it.ToVersion, key, nil)
+}
+
+// finishUpdateBatch derives a batch's final status from its counters.
+func finishUpdateBatch(b *dbpkg.UpdateBatch) {
+	switch {
+	case b.Failed == 0 && b.Skipped == 0:
+		b.Status = string(StateSucceeded)
+	case b.Succeeded == 0:
+		b.Status = string(StateFailed)
+	default:
+		b.Status = string(StatePartialSuccess)
+	}
+	telemetry.Event("update_batch_finished", map[string]string{
+		"batch_id":    strconv.Itoa(b.ID),
+		"instance_id": strconv.Itoa(b.InstanceID),
+		"status":      b.Status,
+		"succeeded":   strconv.Itoa(b.Succeeded),
+		"failed":      strconv.Itoa(b.Failed),
+		"skipped":     strconv.Itoa(b.Skipped),
+	})
+}
+
+// waitUpdateJob blocks until uj reaches a terminal state and returns it, or
+// returns "" when ctx ends first.
+func waitUpdateJob(ctx context.Context, uj *updateJob) UpdateJobState {
+	if uj == nil {
+		return StateFailed
+	}
+	ch := uj.subscribe()
+	defer uj.unsubscribe(ch)
+	for {
+		if st, ok := terminalUpdateState(uj.snapshotEvents()); ok {
+			return st
+		}
+		select {
+		case <-ctx.Done():
+			return ""
+		case <-ch:
+		}
+	}
+}
+
+func terminalUpdateState(events []sseMsg) (UpdateJobState, bool) {
+	if len(events) == 0 {
+		return "", false
+	}
+	payload, ok := events[len(events)-1].Data.(map[string]any)
+	if !ok {
+		return "", false
+	}
+	st, _ := payload["state"].(UpdateJobState)
+	switch st {
+	case StateSucceeded, StateFailed, StatePartialSuccess:
+		return st, true
+	}
+	return "", false
+}
+
+// batchItemOut is the API shape of a batch's mod update.
+type batchItemOut struct {
+	JobID       int    `json:"job_id"`
+	ModID       int    `json:"mod_id"`
+	FromVersion string `json:"from_version"`
+	ToVersion   string `json:"to_version"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+}
+
+// loadBatch resolves the {batch} URL param for the {id} instance.
+func loadBatch(w http.ResponseWriter, r *http.Request, db *sql.DB) *dbpkg.UpdateBatch {
+	instID, err1 := strconv.Atoi(chi.URLParam(r, "id"))
+	batchID, err2 := strconv.Atoi(chi.URLParam(r, "batch"))
+	if err1 != nil || err2 != nil {
+		httpx.Write(w, r, httpx.BadRequest("invalid id"))
+		return nil
+	}
+	b, err := dbpkg.GetUpdateBatch(db, batchID)
+	if err != nil || b.InstanceID != instID {
+		httpx.Write(w, r, httpx.NotFound("batch not found"))
+		return nil
+	}
+	return b
+}
+
+// getUpdateBatchHandler returns a batch's aggregate progress and per-mod results.
+func getUpdateBatchHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b := loadBatch(w, r, db)
+		if b == nil {
+			return
+		}
+		rows, err := dbpkg.ListBatchModUpdates(db, b.ID)
+		if err != nil {
+			httpx.Write(w, r, httpx.Internal(err))
+			return
+		}
+		items := make([]batchItemOut, 0, len(rows))
+		for _, mu := range rows {
+			items = append(items, batchItemOut{JobID: mu.ID, ModID: mu.ModID, FromVersion: mu.FromVersion, ToVersion: mu.ToVersion, Status: mu.Status, Error: mu.Error})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(struct {
+			*dbpkg.UpdateBatch
+			Items []batchItemOut `json:"items"`
+		}{b, items})
+	}
+}
+
+// updateBatchEventsHandler streams batch progress ("progress"), per-mod
+// results ("item") and the final summary ("done") as SSE.
+func updateBatchEventsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b := loadBatch(w, r, db)
+		if b == nil {
+			return
+		}
+		v, ok := updateBatches.Load(b.ID)
+		if !ok {
+			httpx.Write(w, r, httpx.NotFound("batch events expired"))
+			return
+		}
+		streamUpdateJob(w, r, v.(*updateJob))
+	}
+}
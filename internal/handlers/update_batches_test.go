@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dbpkg "modsentinel/internal/db"
+	mr "modsentinel/internal/modrinth"
+)
+
+func TestPlanInstanceUpdates(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	inst := &dbpkg.Instance{Name: "plan", Loader: "fabric", GameVersion: "1.20.1"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	for _, m := range []*dbpkg.Mod{
+		{Name: "Sodium", URL: "https://modrinth.com/mod/sodium", CurrentVersion: "0.5.2", AvailableVersion: "sodium-2", InstanceID: inst.ID},
+		{Name: "Lithium", URL: "https://modrinth.com/mod/lithium", CurrentVersion: "1.0", AvailableVersion: "1.0", InstanceID: inst.ID},
+		{Name: "Gone", URL: "https://modrinth.com/mod/gone", CurrentVersion: "1", AvailableVersion: "2", InstanceID: inst.ID},
+	} {
+		if err := dbpkg.InsertMod(db, m); err != nil {
+			t.Fatalf("insert mod: %v", err)
+		}
+	}
+
+	now := time.Now()
+	target := depVersion("sodium-2", "sodium", "release", now, mr.Dependency{ProjectID: "api", DependencyType: mr.DependencyRequired})
+	target.Files = []mr.VersionFile{
+		{URL: "https://cdn.example/sodium-2-sources.jar", Filename: "sodium-2-sources.jar", Size: 7},
+		{URL: "https://cdn.example/sodium-2.jar", Filename: "sodium-2.jar", Size: 42, Primary: true},
+	}
+	old := modClient
+	modClient = depClient{versions: map[string][]mr.Version{
+		"sodium": {target},
+		"api":    {depVersion("api-1", "api", "release", now)},
+	}}
+	defer func() { modClient = old }()
+
+	plan, err := planInstanceUpdates(context.Background(), db, inst, nil)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if len(plan.Items) != 2 {
+		t.Fatalf("items = %+v, want 2", plan.Items)
+	}
+	it := plan.Items[0]
+	if it.Name != "Sodium" || it.File != "sodium-2.jar" || it.Size != 42 || it.VersionID != "sodium-2" {
+		t.Fatalf("unexpected item: %+v", it)
+	}
+	if len(it.Dependencies) != 1 || it.Dependencies[0].VersionID != "api-1" {
+		t.Fatalf("unexpected dependencies: %+v", it.Dependencies)
+	}
+	if plan.Items[1].Name != "Gone" || len(plan.Items[1].Blockers) != 1 {
+		t.Fatalf("missing target not blocked: %+v", plan.Items[1])
+	}
+	if plan.TotalSize != 42 {
+		t.Fatalf("total size = %d", plan.TotalSize)
+	}
+
+	only, err := planInstanceUpdates(context.Background(), db, inst, map[int]bool{plan.Items[1].ModID: true})
+	if err != nil || len(only.Items) != 1 || only.Items[0].Name != "Gone" {
+		t.Fatalf("filtered plan = %+v, %v", only, err)
+	}
+}
+
+func TestRunUpdateBatch_FailurePolicy(t *testing.T) {
+	cases := []struct {
+		policy                     string
+		succeeded, failed, skipped int
+		status                     UpdateJobState
+	}{
+		{BatchStopOnFailure, 1, 1, 1, StatePartialSuccess},
+		{BatchContinueOnFailure, 2, 1, 0, StatePartialSuccess},
+	}
+	for _, tc := range cases {
+		t.Run(tc.policy, func(t *testing.T) {
+			// Job IDs restart with every database.
+			updateJobs.Range(func(k, _ any) bool { updateJobs.Delete(k); return true })
+			db := setupDB(t)
+			defer db.Close()
+			inst := &dbpkg.Instance{Name: "batch", Loader: "fabric", GameVersion: "1.20.1"}
+			if err := dbpkg.InsertInstance(db, inst); err != nil {
+				t.Fatalf("insert inst: %v", err)
+			}
+			var items []updatePlanItem
+			for _, slug := range []string{"alpha", "broken", "gamma"} {
+				m := &dbpkg.Mod{Name: slug, URL: "https://modrinth.com/mod/" + slug, CurrentVersion: "1", AvailableVersion: slug + "-2", InstanceID: inst.ID}
+				if err := dbpkg.InsertMod(db, m); err != nil {
+					t.Fatalf("insert mod: %v", err)
+				}
+				items = append(items, updatePlanItem{ModID: m.ID, Name: m.Name, FromVersion: "1", ToVersion: m.AvailableVersion})
+			}
+			now := time.Now()
+			old := modClient
+			// "broken" has no matching version, so its job fails.
+			modClient = depClient{versions: map[string][]mr.Version{
+				"alpha": {depVersion("alpha-3", "alpha", "release", now), depVersion("alpha-2", "alpha", "release", now)},
+				"gamma": {depVersion("gamma-2", "gamma", "release", now)},
+			}}
+			defer func() { modClient = old }()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stop := StartUpdateQueue(ctx, db)
+			defer func() { stop(context.Background()); updatesCh = nil }()
+
+			// A newer release found after planning must not change the batch.
+			if _, err := db.Exec(`UPDATE mods SET available_version='alpha-3' WHERE id=?`, items[0].ModID); err != nil {
+				t.Fatal(err)
+			}
+
+			id, err := dbpkg.InsertUpdateBatch(db, inst.ID, tc.policy, len(items))
+			if err != nil {
+				t.Fatalf("insert batch: %v", err)
+			}
+			b := &dbpkg.UpdateBatch{ID: id, InstanceID: inst.ID, OnFailure: tc.policy, Status: "Running", Total: len(items)}
+			ev := &updateJob{id: id}
+			runUpdateBatch(ctx, db, b, items, ev)
+
+			if b.Succeeded != tc.succeeded || b.Failed != tc.failed || b.Skipped != tc.skipped || b.Status != string(tc.status) {
+				t.Fatalf("batch = %+v", b)
+			}
+			events := ev.snapshotEvents()
+			if last := events[len(events)-1]; last.Event != "done" {
+				t.Fatalf("last event = %+v", last)
+			}
+			stored, err := dbpkg.GetUpdateBatch(db, id)
+			if err != nil || stored.Status != b.Status || stored.FinishedAt == "" {
+				t.Fatalf("stored batch = %+v, %v", stored, err)
+			}
+			rows, err := dbpkg.ListBatchModUpdates(db, id)
+			if err != nil || len(rows) != tc.succeeded+tc.failed {
+				t.Fatalf("batch rows = %+v, %v", rows, err)
+			}
+			if got, _ := dbpkg.GetMod(db, items[0].ModID); got.CurrentVersion != "alpha-2" {
+				t.Fatalf("alpha not updated: %+v", got)
+			}
+			gamma, _ := dbpkg.GetMod(db, items[2].ModID)
+			if want := map[string]string{BatchStopOnFailure: "1", BatchContinueOnFailure: "gamma-2"}[tc.policy]; gamma.CurrentVersion != want {
+				t.Fatalf("gamma version = %q, want %q", gamma.CurrentVersion, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	dbpkg "modsentinel/internal/db"
+	mr "modsentinel/internal/modrinth"
+	"modsentinel/internal/telemetry"
+)
+
+// Batch sizes for the bulk Modrinth lookups; project IDs travel in the query
+// string so they are kept smaller.
+const (
+	updateCheckHashBatch    = 500
+	updateCheckProjectBatch = 100
+)
+
+// updateCheckGroup keys mods sharing the filters of a bulk version lookup.
+type updateCheckGroup struct {
+	gameVersion string
+	loader      string
+}
+
+// CheckUpdates refreshes available versions for stored mods. Modrinth mods
+// with a known jar hash are resolved in bulk per (game version, loader);
+// the rest list their project's versions, skipping projects Modrinth
+// reports unchanged since the previous run. Each run is recorded with the
+// number of Modrinth requests it used, and runs at background priority.
+func CheckUpdates(ctx context.Context, db *sql.DB) {
+	ctx = mr.WithPriority(ctx, mr.PriorityBackground)
+	run := dbpkg.UpdateCheckRun{StartedAt: time.Now()}
+	startRequests := modClient.Requests()
+	mods, err := dbpkg.ListAllMods(db)
+	if err != nil {
+		log.Error().Err(err).Msg("list mods")
+		return
+	}
+	run.Mods = len(mods)
+	policies := make(map[int]dbpkg.EffectivePolicy, len(mods))
+	slugs := make(map[int]string, len(mods))
+	for i := range mods {
+		m := &mods[i]
+		slug, err := modSlug(m)
+		if err != nil {
+			continue
+		}
+		pol, err := dbpkg.GetEffectivePolicy(db, m)
+		if err != nil {
+			log.Error().Err(err).Int("mod_id", m.ID).Msg("load update policy")
+			continue
+		}
+		slugs[m.ID] = slug
+		policies[m.ID] = pol
+	}
+
+	done := checkUpdatesBulk(ctx, db, mods, policies)
+	run.Batched = len(done)
+	unchanged := unchangedModrinthMods(ctx, db, mods, slugs, done)
+	for i := range mods {
+		m := &mods[i]
+		slug, ok := slugs[m.ID]
+		if !ok || done[m.ID] || unchanged[m.ID] {
+			continue
+		}
+		run.Fallback++
+		if err := populateAvailableVersionFor(ctx, m, slug, policies[m.ID]); err != nil {
+			continue
+		}
+		saveAvailableVersion(db, m)
+	}
+	autoApplyUpdates(ctx, db, mods, policies)
+	lastSync.Store(time.Now().Unix())
+
+	run.FinishedAt = time.Now()
+	run.Requests = modClient.Requests() - startRequests
+	if err := dbpkg.InsertUpdateCheckRun(db, &run); err != nil {
+		log.Error().Err(err).Msg("record update check")
+	}
+	telemetry.Event("update_check", map[string]string{
+		"mods":        strconv.Itoa(run.Mods),
+		"batched":     strconv.Itoa(run.Batched),
+		"fallback":    strconv.Itoa(run.Fallback),
+		"requests":    strconv.FormatInt(run.Requests, 10),
+		"duration_ms": strconv.FormatInt(run.FinishedAt.Sub(run.StartedAt).Milliseconds(), 10),
+	})
+}
+
+func saveAvailableVersion(db *sql.DB, m *dbpkg.Mod) {
+	_, err := db.Exec(`UPDATE mods SET available_version=?, available_channel=?, download_url=? WHERE id=?`, m.AvailableVersion, m.AvailableChannel, m.DownloadURL, m.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("update version")
+	}
+}
+
+// checkUpdatesBulk resolves Modrinth mods with a known jar hash through
+// version_files/update, one request per group and batch. It returns the
+// IDs of mods it settled; the newest compatible version is only taken when
+// populateAvailableVersionFor would pick it too, so pinned mods, betas and
+// denied major bumps are left to the per-project path.
+func checkUpdatesBulk(ctx context.Context, db *sql.DB, mods []dbpkg.Mod, policies map[int]dbpkg.EffectivePolicy) map[int]bool {
+	done := map[int]bool{}
+	hashes, err := dbpkg.ListModContentHashes(db)
+	if err != nil {
+		log.Error().Err(err).Msg("list mod hashes")
+		return done
+	}
+	groups := map[updateCheckGroup][]*dbpkg.Mod{}
+	for i := range mods {
+		m := &mods[i]
+		pol, ok := policies[m.ID]
+		if !ok || pol.Pin != "" || hashes[m.ID] == "" || (m.Source != "" && m.Source != dbpkg.SourceModrinth) {
+			continue
+		}
+		g := updateCheckGroup{gameVersion: m.GameVersion, loader: m.Loader}
+		if m.Loader != "" && !isValidLoader(ctx, m.Loader) {
+			// Match guardedVersions: an unknown loader drops both filters.
+			g = updateCheckGroup{}
+		}
+		groups[g] = append(groups[g], m)
+	}
+	for g, members := range groups {
+		var loaders, gameVersions []string
+		if g.loader != "" {
+			loaders = []string{g.loader}
+		}
+		if g.gameVersion != "" {
+			gameVersions = []string{g.gameVersion}
+		}
+		for start := 0; start < len(members); start += updateCheckHashBatch {
+			batch := members[start:min(start+updateCheckHashBatch, len(members))]
+			list := make([]string, 0, len(batch))
+			for _, m := range batch {
+				list = append(list, hashes[m.ID])
+			}
+			latest, err := modClient.LatestVersionsByHashes(ctx, list, "sha512", loaders, gameVersions)
+			if err != nil {
+				log.Warn().Err(err).Str("game_version", g.gameVersion).Str("loader", g.loader).Msg("bulk update check")
+				continue
+			}
+			for _, m := range batch {
+				v, ok := latest[hashes[m.ID]]
+				if !ok || !strings.EqualFold(v.VersionType, "release") {
+					continue
+				}
+				if !policies[m.ID].AllowMajor && isMajorBump(m.CurrentVersion, v.VersionNumber) {
+					continue
+				}
+				m.AvailableVersion = v.VersionNumber
+				m.AvailableChannel = "release"
+				if len(v.Files) > 0 {
+					m.DownloadURL = v.Files[0].URL
+				}
+				saveAvailableVersion(db, m)
+				done[m.ID] = true
+			}
+		}
+	}
+	return done
+}
+
+// unchangedModrinthMods returns the Modrinth mods, not settled by the bulk
+// lookup, whose project has not changed since the previous run began and
+// whose policy has not been edited since. Their stored availability still
+// holds, so their versions need not be listed again.
+func unchangedModrinthMods(ctx context.Context, db *sql.DB, mods []dbpkg.Mod, slugs map[int]string, done map[int]bool) map[int]bool {
+	out := map[int]bool{}
+	last, err := dbpkg.LastUpdateCheckRun(db)
+	if err != nil || last == nil {
+		return out
+	}
+	instChanged, modChanged, err := dbpkg.PolicyChangesSince(db, last.StartedAt)
+	if err != nil {
+		log.Error().Err(err).Msg("list policy changes")
+		return out
+	}
+	pending := map[string][]*dbpkg.Mod{}
+	for i := range mods {
+		m := &mods[i]
+		slug, ok := slugs[m.ID]
+		if !ok || done[m.ID] || m.AvailableVersion == "" || (m.Source != "" && m.Source != dbpkg.SourceModrinth) {
+			continue
+		}
+		if instChanged[m.InstanceID] || modChanged[m.ID] {
+			continue
+		}
+		key := strings.ToLower(slug)
+		pending[key] = append(pending[key], m)
+	}
+	ids := make([]string, 0, len(pending))
+	for slug := range pending {
+		ids = append(ids, slug)
+	}
+	for start := 0; start < len(ids); start += updateCheckProjectBatch {
+		projects, err := modClient.Projects(ctx, ids[start:min(start+updateCheckProjectBatch, len(ids))])
+		if err != nil {
+			log.Warn().Err(err).Msg("bulk project lookup")
+			continue
+		}
+		for _, p := range projects {
+			if p.Updated.IsZero() || !p.Updated.Before(last.StartedAt) {
+				continue
+			}
+			for _, key := range []string{strings.ToLower(p.Slug), strings.ToLower(p.ID)} {
+				for _, m := range pending[key] {
+					out[m.ID] = true
+				}
+			}
+		}
+	}
+	return out
+}
+
+// lastUpdateCheck returns the latest update check for the dashboard, or nil.
+func lastUpdateCheck(db *sql.DB) *dbpkg.UpdateCheckRun {
+	run, err := dbpkg.LastUpdateCheckRun(db)
+	if err != nil {
+		log.Error().Err(err).Msg("load last update check")
+		return nil
+	}
+	return run
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dbpkg "modsentinel/internal/db"
+	mr "modsentinel/internal/modrinth"
+)
+
+// bulkClient answers bulk hash lookups from latest and counts every call
+// as one request.
+type bulkClient struct {
+	depClient
+	latest   map[string]mr.Version
+	updated  time.Time
+	bulk     *[][]string
+	listed   *[]string
+	requests *int64
+}
+
+func (c bulkClient) LatestVersionsByHashes(ctx context.Context, hashes []string, algorithm string, loaders, gameVersions []string) (map[string]mr.Version, error) {
+	*c.requests++
+	*c.bulk = append(*c.bulk, append([]string(nil), hashes...))
+	out := map[string]mr.Version{}
+	for _, h := range hashes {
+		if v, ok := c.latest[h]; ok {
+			out[h] = v
+		}
+	}
+	return out, nil
+}
+
+func (c bulkClient) Projects(ctx context.Context, ids []string) ([]mr.Project, error) {
+	*c.requests++
+	out := make([]mr.Project, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, mr.Project{ID: id, Slug: id, Updated: c.updated})
+	}
+	return out, nil
+}
+
+func (c bulkClient) Versions(ctx context.Context, slug, gameVersion, loader string) ([]mr.Version, error) {
+	*c.requests++
+	*c.listed = append(*c.listed, slug)
+	return c.depClient.Versions(ctx, slug, gameVersion, loader)
+}
+
+func (c bulkClient) Requests() int64 { return *c.requests }
+
+func TestCheckUpdates_BatchesByHash(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	now := time.Now()
+	var bulk [][]string
+	var listed []string
+	var requests int64
+	client := bulkClient{
+		depClient: depClient{versions: map[string][]mr.Version{
+			"solo": {depVersion("3.1.0", "solo", "release", now)},
+			"beta": {depVersion("1.1.0", "beta", "release", now)},
+		}},
+		latest: map[string]mr.Version{
+			"hash-a": depVersion("1.2.0", "alpha", "release", now),
+			"hash-b": depVersion("2.0.0-beta.1", "beta", "beta", now),
+		},
+		updated:  now.Add(-48 * time.Hour),
+		bulk:     &bulk,
+		listed:   &listed,
+		requests: &requests,
+	}
+	old := modClient
+	modClient = client
+	defer func() { modClient = old }()
+
+	inst := &dbpkg.Instance{Name: "bulk", Loader: "fabric", GameVersion: "1.20.1"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	insert := func(slug, current, hash string) *dbpkg.Mod {
+		m := &dbpkg.Mod{Name: slug, URL: "https://modrinth.com/mod/" + slug, InstanceID: inst.ID, GameVersion: "1.20.1", CurrentVersion: current, Channel: "release"}
+		if err := dbpkg.InsertMod(db, m); err != nil {
+			t.Fatalf("insert mod: %v", err)
+		}
+		if hash != "" {
+			if err := dbpkg.SetModContentHash(db, m.ID, hash); err != nil {
+				t.Fatalf("set hash: %v", err)
+			}
+		}
+		return m
+	}
+	alpha := insert("alpha", "1.0.0", "hash-a")
+	beta := insert("beta", "1.0.0", "hash-b")
+	solo := insert("solo", "3.0.0", "")
+
+	CheckUpdates(context.Background(), db)
+
+	if len(bulk) != 1 || len(bulk[0]) != 2 {
+		t.Fatalf("bulk lookups = %v, want one lookup of both hashes", bulk)
+	}
+	// The bulk answer for beta is a beta, so it is listed like solo.
+	if len(listed) != 2 {
+		t.Fatalf("listed = %v, want beta and solo", listed)
+	}
+	for _, c := range []struct {
+		m    *dbpkg.Mod
+		want string
+	}{{alpha, "1.2.0"}, {beta, "1.1.0"}, {solo, "3.1.0"}} {
+		got, err := dbpkg.GetMod(db, c.m.ID)
+		if err != nil {
+			t.Fatalf("get mod: %v", err)
+		}
+		if got.AvailableVersion != c.want {
+			t.Fatalf("%s available = %q, want %q", got.Name, got.AvailableVersion, c.want)
+		}
+	}
+	run, err := dbpkg.LastUpdateCheckRun(db)
+	if err != nil || run == nil {
+		t.Fatalf("last run = %v, %v", run, err)
+	}
+	if run.Mods != 3 || run.Batched != 1 || run.Fallback != 2 || run.Requests != 3 {
+		t.Fatalf("run = %+v", run)
+	}
+
+	// Nothing changed on Modrinth since, so the second run lists no versions.
+	listed = nil
+	CheckUpdates(context.Background(), db)
+	if len(listed) != 0 {
+		t.Fatalf("second run listed %v, want none", listed)
+	}
+	run, err = dbpkg.LastUpdateCheckRun(db)
+	if err != nil || run == nil {
+		t.Fatalf("last run = %v, %v", run, err)
+	}
+	if run.Fallback != 0 || run.Requests != 2 {
+		t.Fatalf("second run = %+v, want one bulk and one project lookup", run)
+	}
+}
@@ -2,10 +2,11 @@ package handlers
 
 import (
     "context"
+    "crypto/sha512"
     "database/sql"
+    "encoding/hex"
     "encoding/json"
     "fmt"
-    "io"
     "net/http"
     urlpkg "net/url"
     "strings"
@@ -15,7 +16,10 @@ import (
     "time"
     "strconv"
     
+    "modsentinel/internal/backend"
     dbpkg "modsentinel/internal/db"
+    "modsentinel/internal/maintenance"
+    mr "modsentinel/internal/modrinth"
     pppkg "modsentinel/internal/pufferpanel"
     "modsentinel/internal/telemetry"
 )
@@ -142,11 +146,16 @@ type UpdateJobState string
 const (
     StateQueued           UpdateJobState = "Queued"
     StateRunning          UpdateJobState = "Running"
+    StateInstallingDeps   UpdateJobState = "InstallingDependencies"
+    StateVerifyingDownload UpdateJobState = "VerifyingDownload"
+    StateScanning         UpdateJobState = "Scanning"
     StateUploadingNew     UpdateJobState = "UploadingNew"
     StateVerifyingNew     UpdateJobState = "VerifyingNew"
     StateRemovingOld      UpdateJobState = "RemovingOld"
     StateVerifyingRemoval UpdateJobState = "VerifyingRemoval"
     StateUpdatingDB       UpdateJobState = "UpdatingDB"
+    StateRestarting       UpdateJobState = "Restarting"
+    StateWaitingOnline    UpdateJobState = "WaitingOnline"
     StateSucceeded        UpdateJobState = "Succeeded"
     StateFailed           UpdateJobState = "Failed"
     StatePartialSuccess   UpdateJobState = "PartialSuccess"
@@ -244,6 +253,8 @@ var (
     jobIDByUpdID sync.Map      // map[int]jobID
     jobIDByKey   sync.Map      // map[string]jobID
     updatesCh    chan int
+    // updatesCtx scopes work started on behalf of the update queue
+    updatesCtx   context.Context
 )
 
 func init() {
@@ -307,17 +318,38 @@ func enqueueUpdateJob(ctx context.Context, db *sql.DB, modID int) (int, error) {
 
 // enqueueUpdateJobWithKey enqueues using a client-supplied idempotency key.
 func enqueueUpdateJobWithKey(ctx context.Context, db *sql.DB, modID int, key string) (int, error) {
+    return queueUpdateJob(ctx, db, modID, "", key, nil)
+}
+
+// queueUpdateJob inserts a queued job that updates the mod to toV, or to its
+// available version when toV is empty. With a window, the job is deferred
+// to the maintenance run instead of being handed to the worker.
+func queueUpdateJob(ctx context.Context, db *sql.DB, modID int, toV, key string, window *maintenance.Window) (int, error) {
     prev, _ := dbpkg.GetMod(db, modID)
     fromV := prev.CurrentVersion
-    toV := prev.AvailableVersion
+    if strings.TrimSpace(toV) == "" {
+        toV = prev.AvailableVersion
+    }
     updID, _, err := dbpkg.InsertModUpdateQueued(db, modID, fromV, toV, key)
     if err != nil {
         return 0, err
     }
+    if window != nil {
+        if err := dbpkg.DeferModUpdate(db, updID); err != nil {
+            return 0, err
+        }
+    }
     if _, ok := updateJobs.Load(updID); !ok {
         uj := &updateJob{id: updID, events: make([]sseMsg, 0, 16), db: db, updID: updID}
         updateJobs.Store(updID, uj)
-        uj.emitState(StateQueued, nil)
+        var details map[string]any
+        if window != nil {
+            details = map[string]any{"waiting_for_window": window.NextOpen(windowNow())}
+        }
+        uj.emitState(StateQueued, details)
+    }
+    if window != nil {
+        return updID, nil
     }
     if updatesCh != nil {
         select { case updatesCh <- updID: default: }
@@ -326,41 +358,70 @@ func enqueueUpdateJobWithKey(ctx context.Context, db *sql.DB, modID int, key str
 }
 
 // StartUpdateQueue launches background worker to process queued mod updates.
+// The returned func stops the worker and waits for it to exit, or for
+// waitCtx to end.
 func StartUpdateQueue(ctx context.Context, db *sql.DB) func(context.Context) {
-    updatesCh = make(chan int, 32)
+    ch := make(chan int, 32)
+    updatesCh = ch
+    stopCtx, cancel := context.WithCancel(ctx)
+    updatesCtx = stopCtx
     // Requeue running tasks on startup
     _ = dbpkg.ResetRunningModUpdates(db)
     // Seed queued jobs
     if ids, err := dbpkg.ListQueuedModUpdates(db); err == nil {
         go func() {
-            for _, id := range ids { updatesCh <- id }
+            for _, id := range ids {
+                select {
+                case ch <- id:
+                case <-stopCtx.Done():
+                    return
+                }
+            }
         }()
     }
-    stopCtx, cancel := context.WithCancel(ctx)
+    go runMaintenanceLoop(stopCtx, db)
+    // The worker reads ch rather than updatesCh so callers may clear the
+    // global once stop has returned.
+    done := make(chan struct{})
     go func() {
+        defer close(done)
         for {
             select {
             case <-stopCtx.Done():
                 return
-            case id := <-updatesCh:
+            case id := <-ch:
                 if id == 0 { continue }
+                // Load job row to get mod id
+                mu, err := dbpkg.GetModUpdate(db, id)
+                if err != nil { continue }
+                // Deferred jobs belong to the maintenance run
+                if mu.Deferred { continue }
                 // Lease the job; skip if already running/picked up
                 if ok, _ := dbpkg.LeaseModUpdate(db, id); !ok {
                     continue
                 }
-                // Load job row to get mod id
-                mu, err := dbpkg.GetModUpdate(db, id)
-                if err != nil { continue }
                 p, _ := updateJobs.LoadOrStore(id, &updateJob{id: id, events: make([]sseMsg, 0, 16), db: db, updID: id})
                 uj := p.(*updateJob)
                 uj.emitState(StateRunning, nil)
+                if mu.Kind == dbpkg.ModUpdateKindRollback {
+                    go runRollbackJob(stopCtx, db, uj, mu)
+                    continue
+                }
+                if mu.Kind == dbpkg.ModUpdateKindRemove {
+                    go runRemoveJob(stopCtx, db, uj, mu)
+                    continue
+                }
                 go runUpdateJob(stopCtx, db, uj, mu.ModID)
             }
         }
     }()
     return func(waitCtx context.Context) {
         cancel()
-        close(updatesCh)
+        select {
+        case <-done:
+        case <-waitCtx.Done():
+        }
+        close(ch)
     }
 }
 
@@ -376,16 +437,32 @@ func runUpdateJob(ctx context.Context, db *sql.DB, uj *updateJob, modID int) {
         uj.emitState(StateFailed, map[string]any{"error": err.Error()})
         return
     }
-    slug, err := parseModrinthSlug(prev.URL)
+    src, err := sourceForMod(prev)
+    if err != nil {
+        uj.emitState(StateFailed, map[string]any{"error": err.Error()})
+        return
+    }
+    slug, err := modSlug(prev)
     if err != nil {
         uj.emitState(StateFailed, map[string]any{"error": "invalid mod URL"})
         return
     }
+    // Install the version the job was queued for; a later update check may
+    // have moved available_version on since.
+    if mu, err := dbpkg.GetModUpdate(db, uj.updID); err == nil && strings.TrimSpace(mu.ToVersion) != "" {
+        prev.AvailableVersion = mu.ToVersion
+    }
     if strings.TrimSpace(prev.AvailableVersion) == "" || prev.AvailableVersion == prev.CurrentVersion {
         uj.emitState(StateFailed, map[string]any{"error": "no update available"})
         return
     }
-    versions, err := modClient.Versions(ctx, slug, "", "")
+    if pol, err := dbpkg.GetEffectivePolicy(db, prev); err == nil {
+        if reason := policyBlocksUpdate(pol, prev); reason != "" {
+            uj.emitState(StateFailed, map[string]any{"error": reason})
+            return
+        }
+    }
+    versions, err := src.Versions(ctx, slug, "", "")
     if err != nil {
         // Try to serialize the error
         b, _ := json.Marshal(err)
@@ -393,10 +470,15 @@ func runUpdateJob(ctx context.Context, db *sql.DB, uj *updateJob, modID int) {
         return
     }
     var targetURL string
+    var target mr.Version
     for _, vv := range versions {
         if vv.VersionNumber == prev.AvailableVersion {
-            if len(vv.Files) > 0 {
-                targetURL = strings.TrimSpace(vv.Files[0].URL)
+            target = vv
+            if vv.VersionType != "" {
+                prev.AvailableChannel = strings.ToLower(vv.VersionType)
+            }
+            if f, ok := vv.PrimaryFile(); ok {
+                targetURL = strings.TrimSpace(f.URL)
             }
             break
         }
@@ -406,18 +488,44 @@ func runUpdateJob(ctx context.Context, db *sql.DB, uj *updateJob, modID int) {
         return
     }
 
+    // Install required dependencies of the new version before swapping jars.
+    if inst, err2 := dbpkg.GetInstance(db, prev.InstanceID); err2 == nil && resolvesDependencies(src) {
+        plan, err := resolveDependencies(ctx, db, inst, slug, target)
+        if err != nil {
+            uj.emitState(StateFailed, map[string]any{"error": err.Error()})
+            return
+        }
+        if len(plan.Blockers) > 0 {
+            uj.emitState(StateFailed, map[string]any{"error": strings.Join(plan.Blockers, "; "), "warnings": plan.Warnings})
+            return
+        }
+        if len(plan.Install) > 0 || len(plan.Warnings) > 0 {
+            uj.emitState(StateInstallingDeps, map[string]any{"dependencies": plan.Install, "warnings": plan.Warnings})
+        }
+        if _, err := installDependencies(ctx, db, inst, plan); err != nil {
+            uj.emitState(StateFailed, map[string]any{"error": err.Error()})
+            return
+        }
+    }
+
+
+    // Manifest installs track a placeholder without a current version: they
+    // upload the new jar and never replace or remove an existing one.
+    installing := strings.TrimSpace(prev.CurrentVersion) == ""
 
     // Upload to PufferPanel first, if configured
     var ppOldAbs, ppNewAbs string
+    // Replaced jar, kept for rollback once the update succeeds
+    var prevFile string
+    var prevJar []byte
+    // SHA-512 of the installed and the new jar, keys in the artifact cache
+    prevSum, _ := dbpkg.GetModContentHash(db, prev.ID)
+    var newSum string
     if inst, err2 := dbpkg.GetInstance(db, prev.InstanceID); err2 == nil && strings.TrimSpace(inst.PufferpanelServerID) != "" {
         // Per-instance mutex: prevent concurrent updates on the same server/instance
         acquireUpdate(inst.ID)
         defer releaseUpdate(inst.ID)
-        folder := "mods/"
-        switch strings.ToLower(inst.Loader) {
-        case "paper", "spigot", "bukkit":
-            folder = "plugins/"
-        }
+        folder := instanceModFolder(inst)
         deriveName := func(rawURL, slug, defName, version string) string {
             if u, err := urlpkg.Parse(rawURL); err == nil {
                 p := u.Path
@@ -433,14 +541,17 @@ func runUpdateJob(ctx context.Context, db *sql.DB, uj *updateJob, modID int) {
             if ver == "" { ver = "latest" }
             return base + "-" + ver + ".jar"
         }
-        oldSlug, _ := parseModrinthSlug(prev.URL)
+        oldSlug, _ := modSlug(prev)
         oldName := deriveName(prev.DownloadURL, oldSlug, prev.Name, prev.CurrentVersion)
         newName := deriveName(targetURL, slug, prev.Name, prev.AvailableVersion)
         // Planning: determine the exact old file present, if any, by scanning server files for slug match
         plannedOld := folder + oldName
         installedFile := ""
         installedVersion := ""
-        if files, err := ppListPath(ctx, inst.PufferpanelServerID, folder); err == nil {
+        if installing {
+            // Nothing to replace; a jar whose name merely contains the slug
+            // belongs to another mod.
+        } else if files, err := backendFor(inst).ListPath(ctx, inst.PufferpanelServerID, folder); err == nil {
             lslug := strings.ToLower(strings.TrimSpace(oldSlug))
             for _, f := range files {
                 if f.IsDir { continue }
@@ -474,7 +585,7 @@ func runUpdateJob(ctx context.Context, db *sql.DB, uj *updateJob, modID int) {
             "installed_version": installedVersion,
         })
         // Track if filenames are identical (overwrite plan)
-        sameFile := strings.EqualFold(strings.TrimSpace(plannedOld), strings.TrimSpace(folder+newName))
+        sameFile := !installing && strings.EqualFold(strings.TrimSpace(plannedOld), strings.TrimSpace(folder+newName))
         telemetry.Event("mod_update_assert", map[string]string{
             "job_id": strconv.Itoa(uj.id),
             "mod_id": strconv.Itoa(prev.ID),
@@ -490,63 +601,90 @@ func runUpdateJob(ctx context.Context, db *sql.DB, uj *updateJob, modID int) {
             }
         }
 
-        // If same filename, capture pre-upload size to detect overwrite vs no-op
-        preSize := -1
+        // If same filename, capture the jar being overwritten to detect a no-op
         if sameFile {
-            if b0, err0 := pppkg.FetchFile(ctx, inst.PufferpanelServerID, strings.TrimPrefix(plannedOld, "/")); err0 == nil {
-                preSize = len(b0)
+            if b0, err0 := backendFor(inst).FetchFile(ctx, inst.PufferpanelServerID, strings.TrimPrefix(plannedOld, "/")); err0 == nil {
+                prevJar = b0
+            }
+        }
+        // Keep the jar being replaced so the update can be rolled back
+        if !installing {
+            prevFile = plannedOld
+        }
+        if prevJar == nil && prevFile != "" && artifactStore != nil && inst.RollbackRetention > 0 {
+            if b0, err0 := backendFor(inst).FetchFile(ctx, inst.PufferpanelServerID, plannedOld); err0 == nil {
+                prevJar = b0
             }
         }
 
-        // Download artifact
-        reqDL, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL, nil)
-        if err != nil {
-            uj.emitState(StateFailed, map[string]any{"error": err.Error()})
-            return
+        if len(prevJar) > 0 {
+            cacheJar(prevJar, nil)
+            s := sha512.Sum512(prevJar)
+            prevSum = hex.EncodeToString(s[:])
         }
-        var resp *http.Response
+
+        // Download artifact from the cache or the mod's source
+        var data []byte
+        var cached bool
         stepStart := time.Now()
         attempts, err := withRetryCount(ctx, func() error {
             var e error
-            resp, e = http.DefaultClient.Do(reqDL)
-            if e != nil {
-                return e
-            }
-            if resp.StatusCode == 429 || resp.StatusCode >= 500 {
-                io.Copy(io.Discard, resp.Body)
-                resp.Body.Close()
-                return fmt.Errorf("transient upstream %d", resp.StatusCode)
-            }
-            return nil
+            data, cached, e = src.Download(ctx, target)
+            return e
         })
         if err != nil {
             uj.emitState(StateFailed, map[string]any{"error": err.Error()})
             return
         }
-        defer resp.Body.Close()
-        if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-            uj.emitState(StateFailed, map[string]any{"error": fmt.Sprintf("download failed: %d", resp.StatusCode)})
-            return
-        }
-        data, err := io.ReadAll(resp.Body)
-        if err != nil || len(data) == 0 {
-            uj.emitState(StateFailed, map[string]any{"error": "invalid file content"})
-            return
-        }
         telemetry.Event("mod_update_step", map[string]string{
             "job_id":   strconv.Itoa(uj.id),
             "mod_id":   strconv.Itoa(prev.ID),
             "step":     "Download",
             "ms":       strconv.FormatInt(time.Since(stepStart).Milliseconds(), 10),
             "attempt":  strconv.Itoa(attempts),
+            "cached":   strconv.FormatBool(cached),
             "pp_path_old": ppOldAbs,
             "pp_path_new": ppNewAbs,
         })
+        // Reject corrupted or tampered downloads before touching the server
+        file, _ := target.PrimaryFile()
+        uj.emitState(StateVerifyingDownload, map[string]any{"file": file.Filename, "size": len(data)})
+        algo, err := file.Verify(data)
+        if err != nil {
+            uj.emitState(StateFailed, map[string]any{"error": err.Error(), "hint": "Downloaded file does not match the published hash; nothing was uploaded."})
+            telemetry.Event("mod_update_failed", map[string]string{
+                "job_id": strconv.Itoa(uj.id),
+                "mod_id": strconv.Itoa(prev.ID),
+                "error":  "hash_mismatch",
+                "algorithm": algo,
+            })
+            return
+        }
+        telemetry.Event("mod_update_step", map[string]string{
+            "job_id":    strconv.Itoa(uj.id),
+            "mod_id":    strconv.Itoa(prev.ID),
+            "step":      "VerifyingDownload",
+            "algorithm": algo,
+        })
+        // Refuse jars that match the blocklist or malware rules
+        uj.emitState(StateScanning, map[string]any{"file": newName})
+        if findings, blocked := scanJar(db, inst.ID, &prev.ID, newName, data); blocked {
+            uj.emitState(StateFailed, map[string]any{"error": blockReason(findings), "findings": findings, "hint": "The new jar was flagged by the malware scanner; nothing was uploaded."})
+            telemetry.Event("mod_update_failed", map[string]string{
+                "job_id": strconv.Itoa(uj.id),
+                "mod_id": strconv.Itoa(prev.ID),
+                "error":  "scan_blocked",
+            })
+            return
+        }
+        cacheJar(data, file.Hashes)
         // compute expected attributes
         expSize := len(data)
+        expDigest := sha512.Sum512(data)
+        newSum = hex.EncodeToString(expDigest[:])
         uj.emitState(StateUploadingNew, map[string]any{"file": newName, "size": expSize})
         stepStart = time.Now()
-        attempts, err = withRetryCount(ctx, func() error { return pppkg.PutFile(ctx, inst.PufferpanelServerID, folder+newName, data) })
+        attempts, err = withRetryCount(ctx, func() error { return backendFor(inst).PutFile(ctx, inst.PufferpanelServerID, folder+newName, data) })
         if err != nil {
             uj.emitState(StateFailed, map[string]any{"error": err.Error()})
             return
@@ -561,11 +699,11 @@ func runUpdateJob(ctx context.Context, db *sql.DB, uj *updateJob, modID int) {
             "pp_path_new": ppNewAbs,
         })
         uj.emitState(StateVerifyingNew, map[string]any{"file": newName, "size": expSize})
-        var files []pppkg.FileEntry
+        var files []backend.FileEntry
         stepStart = time.Now()
         attempts, err = withRetryCount(ctx, func() error {
             var e error
-            files, e = ppListPath(ctx, inst.PufferpanelServerID, folder)
+            files, e = backendFor(inst).ListPath(ctx, inst.PufferpanelServerID, folder)
             return e
         })
         if err == nil {
@@ -590,13 +728,13 @@ func runUpdateJob(ctx context.Context, db *sql.DB, uj *updateJob, modID int) {
             "pp_path_old": ppOldAbs,
             "pp_path_new": ppNewAbs,
         })
-        // verify by fetching uploaded file and comparing size
+        // verify by fetching uploaded file and comparing its hash
         stepStart = time.Now()
         var b []byte
-        attempts, err = withRetryCount(ctx, func() error { var er error; b, er = pppkg.FetchFile(ctx, inst.PufferpanelServerID, folder+newName); return er })
+        attempts, err = withRetryCount(ctx, func() error { var er error; b, er = backendFor(inst).FetchFile(ctx, inst.PufferpanelServerID, folder+newName); return er })
         if err == nil {
-            if len(b) != expSize {
-                uj.emitState(StateFailed, map[string]any{"error": fmt.Sprintf("size mismatch: expected %d got %d", expSize, len(b))})
+            if got := sha512.Sum512(b); got != expDigest {
+                uj.emitState(StateFailed, map[string]any{"error": fmt.Sprintf("uploaded file hash mismatch: expected sha512 %x got %x (%d of %d bytes)", expDigest, got, len(b), expSize)})
                 return
             }
         } else {
@@ -612,9 +750,13 @@ func runUpdateJob(ctx context.Context, db *sql.DB, uj *updateJob, modID int) {
             "pp_path_old": ppOldAbs,
             "pp_path_new": ppNewAbs,
         })
-        // If same filename, treat as overwrite: skip delete; verify content changed (by size if we captured preSize)
+        // Installs leave every other jar in place
+        if installing {
+            goto UPDATE_DB
+        }
+        // If same filename, treat as overwrite: skip delete; the content changed unless the overwritten jar hashes the same
         if sameFile {
-            if preSize >= 0 && preSize == len(b) {
+            if prevJar != nil && sha512.Sum512(prevJar) == expDigest {
                 // nothing changed; already current
                 uj.emitState(StateSucceeded, map[string]any{"mod_id": prev.ID, "version": prev.CurrentVersion, "reason": "already_current"})
                 return
@@ -631,22 +773,22 @@ func runUpdateJob(ctx context.Context, db *sql.DB, uj *updateJob, modID int) {
         stepStart = time.Now()
         attempts, err = withRetryCount(ctx, func() error {
             var e error
-            files, e = ppListPath(ctx, inst.PufferpanelServerID, folder)
+            files, e = backendFor(inst).ListPath(ctx, inst.PufferpanelServerID, folder)
             return e
         })
         if err == nil {
             for _, f := range files {
                 if !f.IsDir && strings.EqualFold(f.Name, oldName) {
-                    _, delErr = withRetryCount(ctx, func() error { return pppkg.DeleteFile(ctx, inst.PufferpanelServerID, folder+oldName) })
+                    _, delErr = withRetryCount(ctx, func() error { return backendFor(inst).DeleteFile(ctx, inst.PufferpanelServerID, folder+oldName) })
                     break
                 }
             }
         } else {
-            _, delErr = withRetryCount(ctx, func() error { return pppkg.DeleteFile(ctx, inst.PufferpanelServerID, folder+oldName) })
+            _, delErr = withRetryCount(ctx, func() error { return backendFor(inst).DeleteFile(ctx, inst.PufferpanelServerID, folder+oldName) })
         }
         // Treat 404 (not found) as success: nothing to remove
         if delErr != nil {
-            if errors.Is(delErr, pppkg.ErrNotFound) {
+            if errors.Is(delErr, backend.ErrNotFound) {
                 delErr = nil
             } else {
                 var pe *pppkg.Error
@@ -695,7 +837,7 @@ func runUpdateJob(ctx context.Context, db *sql.DB, uj *updateJob, modID int) {
         stepStart = time.Now()
         attempts, err = withRetryCount(ctx, func() error {
             var e error
-            files, e = ppListPath(ctx, inst.PufferpanelServerID, folder)
+            files, e = backendFor(inst).ListPath(ctx, inst.PufferpanelServerID, folder)
             return e
         })
         if err == nil {
@@ -728,7 +870,7 @@ func runUpdateJob(ctx context.Context, db *sql.DB, uj *updateJob, modID int) {
 UPDATE_DB:
     uj.emitState(StateUpdatingDB, map[string]any{"mod_id": prev.ID})
     stepStart := time.Now()
-    if _, err := db.Exec(`UPDATE mods SET current_version=?, channel=?, download_url=? WHERE id=?`, prev.AvailableVersion, prev.AvailableChannel, targetURL, prev.ID); err != nil {
+    if _, err := db.Exec(`UPDATE mods SET current_version=?, channel=?, download_url=?, version_id=NULLIF(?, '') WHERE id=?`, prev.AvailableVersion, prev.AvailableChannel, targetURL, target.ID, prev.ID); err != nil {
         uj.emitState(StateFailed, map[string]any{"error": err.Error(), "hint": "DB update failed."})
         telemetry.Event("mod_update_failed", map[string]string{
             "job_id": strconv.Itoa(uj.id),
@@ -747,11 +889,44 @@ UPDATE_DB:
         "pp_path_new": ppNewAbs,
     })
     _ = dbpkg.InsertUpdateIfNew(db, prev.ID, prev.AvailableVersion)
+    if newSum != "" {
+        _ = dbpkg.SetModContentHash(db, prev.ID, newSum)
+    }
     m, err := dbpkg.GetMod(db, prev.ID)
     if err != nil {
         uj.emitState(StateFailed, map[string]any{"error": err.Error()})
         return
     }
     _ = dbpkg.InsertEvent(db, &dbpkg.ModEvent{InstanceID: m.InstanceID, ModID: &m.ID, Action: "updated", ModName: m.Name, From: prev.CurrentVersion, To: m.CurrentVersion})
+    if !installing {
+        recordRollbackPoint(db, uj.updID, prev, prevFile, prevJar, prevSum)
+    }
+    gcBlobCache(db)
+    // Optionally restart the server so the new jar loads, unless a batch or
+    // maintenance run restarts it once for all its updates.
+    if inst, err := dbpkg.GetInstance(db, m.InstanceID); err == nil && inst.RestartAfterUpdate &&
+        strings.TrimSpace(inst.PufferpanelServerID) != "" && !restartHeld(inst.ID) {
+        uj.emitState(StateRestarting, map[string]any{"server_id": inst.PufferpanelServerID})
+        stepStart = time.Now()
+        pc, err := powerFor(inst)
+        if err == nil {
+            err = pc.RestartServer(ctx, inst.PufferpanelServerID)
+        }
+        if err != nil {
+            uj.emitState(StateFailed, map[string]any{"error": "restart failed: " + err.Error(), "hint": "The update was applied; restart the server manually."})
+            return
+        }
+        uj.emitState(StateWaitingOnline, map[string]any{"timeout_seconds": int(restartTimeout.Seconds())})
+        if err := waitServerOnline(ctx, inst); err != nil {
+            uj.emitState(StateFailed, map[string]any{"error": err.Error(), "hint": "The update was applied; check the server console."})
+            return
+        }
+        telemetry.Event("mod_update_step", map[string]string{
+            "job_id": strconv.Itoa(uj.id),
+            "mod_id": strconv.Itoa(prev.ID),
+            "step":   "Restarting",
+            "ms":     strconv.FormatInt(time.Since(stepStart).Milliseconds(), 10),
+        })
+    }
     uj.emitState(StateSucceeded, map[string]any{"mod_id": m.ID, "version": m.CurrentVersion})
 }
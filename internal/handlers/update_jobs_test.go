@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dbpkg "modsentinel/internal/db"
+	mr "modsentinel/internal/modrinth"
+)
+
+// pendingUpdate sets up a PufferPanel-linked instance whose mod "lib" can
+// update from 1.0.0 to 1.1.0. The CDN serves body; hashes are published for
+// the new file. It returns the mod and the fake server's files.
+func pendingUpdate(t *testing.T, db *sql.DB, body string, hashes map[string]string) (*dbpkg.Mod, fakeServer) {
+	t.Helper()
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(cdn.Close)
+	inst := &dbpkg.Instance{Name: "srv", Loader: "fabric", PufferpanelServerID: "s1"}
+	if err := dbpkg.InsertInstance(db, inst); err != nil {
+		t.Fatalf("insert inst: %v", err)
+	}
+	m := &dbpkg.Mod{Name: "lib", URL: "https://modrinth.com/mod/lib", InstanceID: inst.ID, CurrentVersion: "1.0.0", AvailableVersion: "1.1.0", Channel: "release", Loader: "fabric"}
+	if err := dbpkg.InsertMod(db, m); err != nil {
+		t.Fatalf("insert mod: %v", err)
+	}
+	v := depVersion("1.1.0", "lib", "release", time.Now())
+	v.Files[0].URL = cdn.URL + "/lib-1.1.0.jar"
+	v.Files[0].Hashes = hashes
+	old := modClient
+	modClient = depClient{versions: map[string][]mr.Version{"lib": {v}}}
+	t.Cleanup(func() { modClient = old })
+	server := fakeServer{"mods/lib-1.0.0.jar": []byte("old")}
+	server.install(t)
+	oldFetch := ppFetchFile
+	ppFetchFile = func(ctx context.Context, id, path string) ([]byte, error) { return server[path], nil }
+	t.Cleanup(func() { ppFetchFile = oldFetch })
+	return m, server
+}
+
+func sha512Hex(s string) string {
+	sum := sha512.Sum512([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestRunUpdateJob_VerifiesDownloadHash(t *testing.T) {
+	cases := []struct {
+		name   string
+		hashes map[string]string
+		want   UpdateJobState
+	}{
+		{"match", map[string]string{"sha512": sha512Hex("jar")}, StateSucceeded},
+		{"mismatch", map[string]string{"sha512": sha512Hex("tampered")}, StateFailed},
+		{"unpublished", nil, StateSucceeded},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := setupDB(t)
+			defer db.Close()
+			m, server := pendingUpdate(t, db, "jar", tc.hashes)
+
+			uj := &updateJob{id: 1, db: db}
+			runUpdateJob(context.Background(), db, uj, m.ID)
+			if uj.state != tc.want {
+				t.Fatalf("state = %s, events = %+v", uj.state, uj.snapshotEvents())
+			}
+			verified := false
+			for _, ev := range uj.snapshotEvents() {
+				if p, ok := ev.Data.(map[string]any); ok && p["state"] == StateVerifyingDownload {
+					verified = true
+				}
+			}
+			if !verified {
+				t.Fatalf("no VerifyingDownload state: %+v", uj.snapshotEvents())
+			}
+			_, uploaded := server["mods/lib-1.1.0.jar"]
+			if uploaded != (tc.want == StateSucceeded) {
+				t.Fatalf("uploaded = %v, server = %v", uploaded, server)
+			}
+		})
+	}
+}
+
+func TestRunUpdateJob_VerifiesUploadedHash(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	m, server := pendingUpdate(t, db, "jar", nil)
+	// The panel stores a truncated copy of the same size.
+	orig := ppPutFile
+	ppPutFile = func(ctx context.Context, id, path string, data []byte) error {
+		server[path] = []byte("ja\x00")
+		return nil
+	}
+	defer func() { ppPutFile = orig }()
+
+	uj := &updateJob{id: 1, db: db}
+	runUpdateJob(context.Background(), db, uj, m.ID)
+	if uj.state != StateFailed {
+		t.Fatalf("state = %s, events = %+v", uj.state, uj.snapshotEvents())
+	}
+	if got, _ := dbpkg.GetMod(db, m.ID); got.CurrentVersion != "1.0.0" {
+		t.Fatalf("mod updated despite corrupt upload: %+v", got)
+	}
+}
+
+func TestRunUpdateJob_UsesPrimaryFile(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	m, server := pendingUpdate(t, db, "jar", nil)
+	c := modClient.(depClient)
+	v := c.versions["lib"][0]
+	primary := v.Files[0]
+	primary.Primary = true
+	v.Files = []mr.VersionFile{{URL: "https://cdn.invalid/lib-1.1.0-sources.jar"}, primary}
+	c.versions["lib"][0] = v
+
+	uj := &updateJob{id: 1, db: db}
+	runUpdateJob(context.Background(), db, uj, m.ID)
+	if uj.state != StateSucceeded {
+		t.Fatalf("state = %s, events = %+v", uj.state, uj.snapshotEvents())
+	}
+	if _, ok := server["mods/lib-1.1.0.jar"]; !ok {
+		t.Fatalf("primary file not uploaded: %v", server)
+	}
+	if got, _ := dbpkg.GetMod(db, m.ID); got.DownloadURL != primary.URL || got.VersionID != v.ID {
+		t.Fatalf("download url = %q, version id = %q", got.DownloadURL, got.VersionID)
+	}
+}
+
+func TestRunUpdateJob_OverwriteSameNameComparesHash(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	m, server := pendingUpdate(t, db, "new", nil)
+	c := modClient.(depClient)
+	f := &c.versions["lib"][0].Files[0]
+	f.URL = strings.TrimSuffix(f.URL, "lib-1.1.0.jar") + "lib.jar"
+	// The overwritten jar has the same name and size as the new one.
+	delete(server, "mods/lib-1.0.0.jar")
+	server["mods/lib.jar"] = []byte("old")
+
+	uj := &updateJob{id: 1, db: db}
+	runUpdateJob(context.Background(), db, uj, m.ID)
+	if uj.state != StateSucceeded {
+		t.Fatalf("state = %s, events = %+v", uj.state, uj.snapshotEvents())
+	}
+	if string(server["mods/lib.jar"]) != "new" {
+		t.Fatalf("jar not overwritten: %v", server)
+	}
+	if got, _ := dbpkg.GetMod(db, m.ID); got.CurrentVersion != "1.1.0" {
+		t.Fatalf("mod not updated after overwrite: %+v", got)
+	}
+}
@@ -0,0 +1,469 @@
+// Package hangar is a client for the Hangar API, PaperMC's plugin repository,
+// used as the source of Paper, Velocity and Waterfall plugins.
+package hangar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	urlpkg "net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"modsentinel/internal/telemetry"
+)
+
+const (
+	userAgent      = "ModSentinel/1.0 (+https://github.com/nl2109/ModSentinel)"
+	defaultBaseURL = "https://hangar.papermc.io"
+	// versionsPageSize is the page size used when listing versions.
+	versionsPageSize = 25
+)
+
+// Platforms Hangar publishes versions for.
+const (
+	PlatformPaper     = "PAPER"
+	PlatformVelocity  = "VELOCITY"
+	PlatformWaterfall = "WATERFALL"
+)
+
+// platformsByLoader maps instance loaders to the Hangar platform whose
+// downloads they run.
+var platformsByLoader = map[string]string{
+	"paper":      PlatformPaper,
+	"purpur":     PlatformPaper,
+	"folia":      PlatformPaper,
+	"spigot":     PlatformPaper,
+	"bukkit":     PlatformPaper,
+	"velocity":   PlatformVelocity,
+	"waterfall":  PlatformWaterfall,
+	"bungeecord": PlatformWaterfall,
+}
+
+// PlatformForLoader returns the Hangar platform for an instance loader, or ""
+// when Hangar has no plugins for it.
+func PlatformForLoader(loader string) string {
+	return platformsByLoader[strings.ToLower(strings.TrimSpace(loader))]
+}
+
+// Client wraps HTTP access to the Hangar API.
+type Client struct {
+	http    *http.Client
+	base    string
+	sf      singleflight.Group
+	ttl     time.Duration
+	cache   map[string]cacheEntry
+	mu      sync.Mutex
+	backoff time.Duration
+}
+
+type cacheEntry struct {
+	data []byte
+	exp  time.Time
+}
+
+// NewClient returns a Client with sane defaults.
+func NewClient() *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = 5 * time.Second
+	transport.ResponseHeaderTimeout = 10 * time.Second
+	transport.ExpectContinueTimeout = 1 * time.Second
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 10
+	transport.MaxConnsPerHost = 10
+	transport.IdleConnTimeout = 90 * time.Second
+
+	return &Client{
+		http:  &http.Client{Timeout: 30 * time.Second, Transport: transport},
+		base:  defaultBaseURL,
+		ttl:   5 * time.Minute,
+		cache: make(map[string]cacheEntry),
+	}
+}
+
+// Kind categorizes Hangar errors.
+type Kind string
+
+const (
+	KindTimeout     Kind = "timeout"
+	KindCanceled    Kind = "canceled"
+	KindRateLimited Kind = "rate_limited"
+	KindServer      Kind = "server_error"
+	KindClient      Kind = "client_error"
+)
+
+// Error represents a normalized Hangar API error.
+type Error struct {
+	Kind    Kind
+	Status  int
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return "hangar error"
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// IsNotFound reports whether err is a Hangar 404.
+func IsNotFound(err error) bool {
+	var he *Error
+	return errors.As(err, &he) && he.Status == http.StatusNotFound
+}
+
+// randDuration returns a random duration between 0 and max.
+// It is declared as a variable to allow tests to stub out randomness.
+var randDuration = func(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// sleep is declared as a variable so tests can stub out actual sleeping.
+var sleep = time.Sleep
+
+func (c *Client) url(path string, params urlpkg.Values) string {
+	base := c.base
+	if base == "" {
+		base = defaultBaseURL
+	}
+	u := strings.TrimRight(base, "/") + "/api/v1" + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	return u
+}
+
+// do executes the request with retry/backoff and decodes JSON into v.
+func (c *Client) do(req *http.Request, v interface{}) error {
+	cacheKey := req.Method + " " + req.URL.String()
+	if c.ttl > 0 {
+		c.mu.Lock()
+		if e, ok := c.cache[cacheKey]; ok {
+			if time.Now().Before(e.exp) {
+				data := e.data
+				c.mu.Unlock()
+				if v != nil {
+					return json.Unmarshal(data, v)
+				}
+				return nil
+			}
+			delete(c.cache, cacheKey)
+		}
+		c.mu.Unlock()
+	}
+	data, err, _ := c.sf.Do(cacheKey, func() (interface{}, error) {
+		c.mu.Lock()
+		bo := c.backoff
+		c.mu.Unlock()
+		if bo > 0 {
+			sleep(bo + randDuration(bo))
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("User-Agent", userAgent)
+		var resp *http.Response
+		var err error
+		var dur time.Duration
+		urlStr := req.URL.Redacted()
+		for i := 0; i < 3; i++ {
+			start := time.Now()
+			resp, err = c.http.Do(req)
+			dur = time.Since(start)
+			attempt := strconv.Itoa(i + 1)
+			if err != nil {
+				telemetry.Event("hangar_request", map[string]string{
+					"method":      req.Method,
+					"url":         urlStr,
+					"status":      "error",
+					"duration_ms": strconv.FormatInt(dur.Milliseconds(), 10),
+					"attempt":     attempt,
+				})
+				kind := KindClient
+				switch {
+				case errors.Is(err, context.Canceled):
+					kind = KindCanceled
+				case errors.Is(err, context.DeadlineExceeded):
+					kind = KindTimeout
+				case func() bool {
+					ne, ok := err.(net.Error)
+					return ok && ne.Timeout()
+				}():
+					kind = KindTimeout
+				}
+				telemetry.Event("hangar_result", map[string]string{
+					"outcome":     "error",
+					"kind":        string(kind),
+					"duration_ms": strconv.FormatInt(dur.Milliseconds(), 10),
+				})
+				return nil, &Error{Kind: kind, Err: err}
+			}
+			telemetry.Event("hangar_request", map[string]string{
+				"method":      req.Method,
+				"url":         urlStr,
+				"status":      strconv.Itoa(resp.StatusCode),
+				"duration_ms": strconv.FormatInt(dur.Milliseconds(), 10),
+				"attempt":     attempt,
+			})
+			if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+				delay := time.Duration(1<<i) * 250 * time.Millisecond
+				if ra := resp.Header.Get("Retry-After"); ra != "" {
+					if secs, err := strconv.Atoi(ra); err == nil {
+						if raDelay := time.Duration(secs) * time.Second; raDelay > delay {
+							delay = raDelay
+						}
+					} else if t, err := http.ParseTime(ra); err == nil {
+						if raDelay := time.Until(t); raDelay > delay {
+							delay = raDelay
+						}
+					}
+				}
+				resp.Body.Close()
+				if i == 2 {
+					break
+				}
+				sleep(delay + randDuration(delay))
+				continue
+			}
+			break
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			kind := KindClient
+			c.mu.Lock()
+			if resp.StatusCode == http.StatusTooManyRequests {
+				kind = KindRateLimited
+				if c.backoff == 0 {
+					c.backoff = time.Second
+				} else {
+					c.backoff *= 2
+					if c.backoff > time.Minute {
+						c.backoff = time.Minute
+					}
+				}
+			} else {
+				if resp.StatusCode >= 500 {
+					kind = KindServer
+				}
+				c.backoff = 0
+			}
+			c.mu.Unlock()
+			telemetry.Event("hangar_result", map[string]string{
+				"outcome":     "error",
+				"kind":        string(kind),
+				"status":      strconv.Itoa(resp.StatusCode),
+				"duration_ms": strconv.FormatInt(dur.Milliseconds(), 10),
+			})
+			var apiErr struct {
+				Message string `json:"message"`
+			}
+			b, _ := io.ReadAll(resp.Body)
+			if err := json.Unmarshal(b, &apiErr); err == nil && apiErr.Message != "" {
+				return nil, &Error{Kind: kind, Status: resp.StatusCode, Message: apiErr.Message}
+			}
+			return nil, &Error{Kind: kind, Status: resp.StatusCode, Message: resp.Status}
+		}
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		if c.ttl > 0 {
+			if c.cache == nil {
+				c.cache = make(map[string]cacheEntry)
+			}
+			c.cache[cacheKey] = cacheEntry{data: b, exp: time.Now().Add(c.ttl)}
+		}
+		c.backoff = 0
+		c.mu.Unlock()
+		telemetry.Event("hangar_result", map[string]string{
+			"outcome":     "success",
+			"status":      strconv.Itoa(resp.StatusCode),
+			"duration_ms": strconv.FormatInt(dur.Milliseconds(), 10),
+		})
+		return b, nil
+	})
+	if err != nil {
+		return err
+	}
+	if v != nil {
+		return json.Unmarshal(data.([]byte), v)
+	}
+	return nil
+}
+
+// Project is a Hangar plugin project.
+type Project struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Namespace struct {
+		Owner string `json:"owner"`
+		Slug  string `json:"slug"`
+	} `json:"namespace"`
+	AvatarURL string `json:"avatarUrl"`
+}
+
+// URL returns the project's page on Hangar.
+func (p Project) URL() string {
+	return defaultBaseURL + "/" + p.Namespace.Owner + "/" + p.Namespace.Slug
+}
+
+// Download is a version's file for one platform. Externally hosted files have
+// only an ExternalURL.
+type Download struct {
+	FileInfo struct {
+		Name       string `json:"name"`
+		SizeBytes  int64  `json:"sizeBytes"`
+		SHA256Hash string `json:"sha256Hash"`
+	} `json:"fileInfo"`
+	ExternalURL string `json:"externalUrl"`
+	DownloadURL string `json:"downloadUrl"`
+}
+
+// URL returns the address the file can be fetched from.
+func (d Download) URL() string {
+	if d.DownloadURL != "" {
+		return d.DownloadURL
+	}
+	return d.ExternalURL
+}
+
+// Version is a release of a project, with one download per platform.
+type Version struct {
+	ID        int       `json:"id"`
+	ProjectID int       `json:"projectId"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	Channel   struct {
+		Name string `json:"name"`
+	} `json:"channel"`
+	Downloads            map[string]Download `json:"downloads"`
+	PlatformDependencies map[string][]string `json:"platformDependencies"`
+}
+
+// ChannelType maps the version's channel to release, beta or alpha. Hangar
+// channels are named by their owners; unrecognized names count as releases.
+func (v Version) ChannelType() string {
+	name := strings.ToLower(v.Channel.Name)
+	switch {
+	case strings.Contains(name, "beta"):
+		return "beta"
+	case strings.Contains(name, "alpha"), strings.Contains(name, "snapshot"), strings.Contains(name, "dev"):
+		return "alpha"
+	}
+	return "release"
+}
+
+// Platforms returns the platforms the version has downloads for, sorted.
+func (v Version) Platforms() []string {
+	out := make([]string, 0, len(v.Downloads))
+	for p := range v.Downloads {
+		out = append(out, p)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Project fetches a project by slug or numeric ID.
+func (c *Client) Project(ctx context.Context, slug string) (*Project, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url("/projects/"+urlpkg.PathEscape(slug), nil), nil)
+	if err != nil {
+		return nil, err
+	}
+	var p Project
+	if err := c.do(req, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Search finds projects by name, optionally limited to a platform.
+func (c *Client) Search(ctx context.Context, query, platform string) ([]Project, error) {
+	params := urlpkg.Values{}
+	params.Set("q", query)
+	params.Set("limit", strconv.Itoa(versionsPageSize))
+	if platform != "" {
+		params.Set("platform", platform)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url("/projects", params), nil)
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Result []Project `json:"result"`
+	}
+	if err := c.do(req, &res); err != nil {
+		return nil, err
+	}
+	return res.Result, nil
+}
+
+// Versions lists a project's versions, newest first, optionally filtered by
+// platform and game version. A game version is only sent with a platform.
+func (c *Client) Versions(ctx context.Context, slug, platform, gameVersion string) ([]Version, error) {
+	params := urlpkg.Values{}
+	if platform != "" {
+		params.Set("platform", platform)
+		if gameVersion != "" {
+			params.Set("platformVersion", gameVersion)
+		}
+	}
+	params.Set("limit", strconv.Itoa(versionsPageSize))
+	var out []Version
+	for offset := 0; ; offset += versionsPageSize {
+		params.Set("offset", strconv.Itoa(offset))
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url("/projects/"+urlpkg.PathEscape(slug)+"/versions", params), nil)
+		if err != nil {
+			return nil, err
+		}
+		var res struct {
+			Pagination struct {
+				Count int `json:"count"`
+			} `json:"pagination"`
+			Result []Version `json:"result"`
+		}
+		if err := c.do(req, &res); err != nil {
+			return nil, err
+		}
+		out = append(out, res.Result...)
+		if len(res.Result) == 0 || len(out) >= res.Pagination.Count {
+			break
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// VersionByHash finds the version owning a file with the given SHA-256 hash.
+func (c *Client) VersionByHash(ctx context.Context, sha256 string) (*Version, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(fmt.Sprintf("/versions/hash/%s", urlpkg.PathEscape(sha256)), nil), nil)
+	if err != nil {
+		return nil, err
+	}
+	var v Version
+	if err := c.do(req, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
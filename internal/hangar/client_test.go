@@ -0,0 +1,77 @@
+package hangar
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVersionsPaginatesAndFilters(t *testing.T) {
+	var gotPlatform, gotGameVersion string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/projects/PlaceholderAPI/versions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		gotPlatform = r.URL.Query().Get("platform")
+		gotGameVersion = r.URL.Query().Get("platformVersion")
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		var res []Version
+		for i := offset; i < offset+versionsPageSize && i < 30; i++ {
+			res = append(res, Version{ID: i, Name: "2." + strconv.Itoa(i), CreatedAt: time.Unix(int64(i), 0)})
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"pagination": map[string]int{"limit": versionsPageSize, "offset": offset, "count": 30},
+			"result":     res,
+		})
+	}))
+	defer ts.Close()
+	c := &Client{http: ts.Client(), base: ts.URL}
+	versions, err := c.Versions(context.Background(), "PlaceholderAPI", PlatformPaper, "1.20.4")
+	if err != nil {
+		t.Fatalf("Versions: %v", err)
+	}
+	if len(versions) != 30 || versions[0].ID != 29 {
+		t.Fatalf("versions = %d, first = %d", len(versions), versions[0].ID)
+	}
+	if gotPlatform != "PAPER" || gotGameVersion != "1.20.4" {
+		t.Fatalf("platform = %q, platformVersion = %q", gotPlatform, gotGameVersion)
+	}
+}
+
+func TestVersionByHash(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/versions/hash/abc" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Not found"}`))
+			return
+		}
+		w.Write([]byte(`{"id":7,"projectId":3,"name":"2.11.5","channel":{"name":"Release"},"downloads":{"PAPER":{"fileInfo":{"name":"PlaceholderAPI-2.11.5.jar","sizeBytes":10},"downloadUrl":"https://hangarcdn.papermc.io/p.jar"},"VELOCITY":{"externalUrl":"https://example.com/v.jar"}},"platformDependencies":{"PAPER":["1.20.4"]}}`))
+	}))
+	defer ts.Close()
+	c := &Client{http: ts.Client(), base: ts.URL}
+	v, err := c.VersionByHash(context.Background(), "abc")
+	if err != nil {
+		t.Fatalf("VersionByHash: %v", err)
+	}
+	if v.ProjectID != 3 || v.ChannelType() != "release" || v.Downloads[PlatformVelocity].URL() != "https://example.com/v.jar" {
+		t.Fatalf("version = %+v", v)
+	}
+	if p := v.Platforms(); len(p) != 2 || p[0] != PlatformPaper {
+		t.Fatalf("platforms = %v", p)
+	}
+	if _, err := c.VersionByHash(context.Background(), "def"); !IsNotFound(err) {
+		t.Fatalf("err = %v, want not found", err)
+	}
+}
+
+func TestPlatformForLoader(t *testing.T) {
+	for loader, want := range map[string]string{"paper": PlatformPaper, "Spigot": PlatformPaper, "velocity": PlatformVelocity, "fabric": ""} {
+		if got := PlatformForLoader(loader); got != want {
+			t.Fatalf("PlatformForLoader(%q) = %q, want %q", loader, got, want)
+		}
+	}
+}
@@ -61,6 +61,11 @@ func BadGateway(msg string) *HTTPError {
 	return &HTTPError{status: http.StatusBadGateway, code: "bad_gateway", message: msg}
 }
 
+// Conflict returns a 409 HTTPError.
+func Conflict(msg string) *HTTPError {
+	return &HTTPError{status: http.StatusConflict, code: "conflict", message: msg}
+}
+
 // TooManyRequests returns a 429 HTTPError.
 func TooManyRequests(msg string) *HTTPError {
 	return &HTTPError{status: http.StatusTooManyRequests, code: "rate_limited", message: msg}
@@ -0,0 +1,202 @@
+// Package localfs serves game servers from directories on the ModSentinel
+// host, for servers run without a panel. A server's ID is its directory,
+// which must lie in or beneath an allowlisted root.
+package localfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"modsentinel/internal/backend"
+)
+
+// Backend is the backend.ServerBackend for the allowlisted directories.
+type Backend struct {
+	roots []string
+}
+
+var _ backend.ServerBackend = (*Backend)(nil)
+
+// MaxFileSize bounds a file read from a server directory.
+const MaxFileSize = 256 << 20
+
+// maxFileSize is the bound FetchFile applies; tests lower it.
+var maxFileSize int64 = MaxFileSize
+
+// New returns a backend confined to roots, which must be absolute.
+func New(roots []string) (*Backend, error) {
+	b := &Backend{}
+	for _, r := range roots {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		if !filepath.IsAbs(r) {
+			return nil, fmt.Errorf("local root %q is not absolute", r)
+		}
+		b.roots = append(b.roots, filepath.ToSlash(filepath.Clean(r)))
+	}
+	if len(b.roots) == 0 {
+		return nil, errors.New("no local roots configured")
+	}
+	return b, nil
+}
+
+// ListServers returns the allowlisted directories that exist.
+func (b *Backend) ListServers(ctx context.Context) ([]backend.Server, error) {
+	out := make([]backend.Server, 0, len(b.roots))
+	for _, r := range b.roots {
+		if fi, err := os.Stat(filepath.FromSlash(r)); err == nil && fi.IsDir() {
+			out = append(out, backend.Server{ID: r, Name: path.Base(r)})
+		}
+	}
+	return out, nil
+}
+
+// GetServer checks that a directory is allowlisted and exists.
+func (b *Backend) GetServer(ctx context.Context, serverID string) (*backend.Server, error) {
+	r, err := b.open(serverID)
+	if err != nil {
+		return nil, err
+	}
+	r.Close()
+	dir := path.Clean(filepath.ToSlash(serverID))
+	return &backend.Server{ID: dir, Name: path.Base(dir)}, nil
+}
+
+// open opens a server directory as an os.Root, so no path or symlink
+// inside it can reach files outside. Symlinks in the directory itself are
+// resolved first, so a link beneath a root cannot point the server outside.
+func (b *Backend) open(serverID string) (*os.Root, error) {
+	dir := filepath.ToSlash(serverID)
+	if !path.IsAbs(dir) || !backend.InRoots(b.roots, dir) {
+		return nil, backend.ErrForbidden
+	}
+	real, err := filepath.EvalSymlinks(filepath.FromSlash(path.Clean(dir)))
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	if !backend.InRoots(b.realRoots(), filepath.ToSlash(real)) {
+		return nil, backend.ErrForbidden
+	}
+	r, err := os.OpenRoot(real)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	return r, nil
+}
+
+// realRoots returns the roots with symlinks resolved. Roots that cannot be
+// resolved are kept as configured.
+func (b *Backend) realRoots() []string {
+	out := make([]string, len(b.roots))
+	for i, r := range b.roots {
+		out[i] = r
+		if real, err := filepath.EvalSymlinks(filepath.FromSlash(r)); err == nil {
+			out[i] = filepath.ToSlash(real)
+		}
+	}
+	return out
+}
+
+// ListPath lists a directory of the server.
+func (b *Backend) ListPath(ctx context.Context, serverID, p string) ([]backend.FileEntry, error) {
+	r, err := b.open(serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := r.Open(backend.RelPath(p))
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	defer f.Close()
+	entries, err := f.ReadDir(-1)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	files := make([]backend.FileEntry, 0, len(entries))
+	for _, e := range entries {
+		fe := backend.FileEntry{Name: e.Name(), IsDir: e.IsDir()}
+		if fi, err := e.Info(); err == nil {
+			fe.Size, fe.ModTime = fi.Size(), fi.ModTime()
+		}
+		files = append(files, fe)
+	}
+	return files, nil
+}
+
+// FetchFile reads a file of the server.
+func (b *Backend) FetchFile(ctx context.Context, serverID, p string) ([]byte, error) {
+	r, err := b.open(serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := r.Open(backend.RelPath(p))
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxFileSize+1))
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	if int64(len(data)) > maxFileSize {
+		return nil, fmt.Errorf("%s: %w", p, backend.ErrTooLarge)
+	}
+	return data, nil
+}
+
+// PutFile creates or replaces a file of the server.
+func (b *Backend) PutFile(ctx context.Context, serverID, p string, data []byte) error {
+	r, err := b.open(serverID)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := r.OpenFile(backend.RelPath(p), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return mapErr(err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// DeleteFile removes a file of the server.
+func (b *Backend) DeleteFile(ctx context.Context, serverID, p string) error {
+	r, err := b.open(serverID)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return mapErr(r.Remove(backend.RelPath(p)))
+}
+
+// ServerStatus is unsupported; local processes are not managed.
+func (b *Backend) ServerStatus(ctx context.Context, serverID string) (bool, error) {
+	return false, backend.ErrUnsupported
+}
+
+// mapErr maps missing and forbidden files to the backend errors.
+func mapErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, fs.ErrNotExist):
+		return backend.ErrNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return backend.ErrForbidden
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+package localfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"modsentinel/internal/backend"
+)
+
+func TestBackendConfinesToRoots(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "servers")
+	srv := filepath.Join(root, "survival")
+	if err := os.MkdirAll(filepath.Join(srv, "mods"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "secret.txt"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(base, "secret.txt"), filepath.Join(srv, "mods", "escape.jar")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New([]string{"relative/dir"}); err == nil {
+		t.Fatal("relative root accepted")
+	}
+	b, err := New([]string{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := b.PutFile(ctx, srv, "/mods/sodium.jar", []byte("jar")); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if data, err := b.FetchFile(ctx, srv, "mods/sodium.jar"); err != nil || string(data) != "jar" {
+		t.Fatalf("fetch = %q, %v", data, err)
+	}
+	files, err := b.ListPath(ctx, srv, "mods/")
+	if err != nil || len(files) != 2 {
+		t.Fatalf("files = %v, %v", files, err)
+	}
+	if err := b.DeleteFile(ctx, srv, "mods/sodium.jar"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := b.DeleteFile(ctx, srv, "mods/sodium.jar"); !errors.Is(err, backend.ErrNotFound) {
+		t.Fatalf("delete missing err = %v", err)
+	}
+
+	// Paths climbing out of the server stay inside it, symlinks may not
+	// leave it, and servers must be allowlisted.
+	if _, err := b.FetchFile(ctx, srv, "../../secret.txt"); !errors.Is(err, backend.ErrNotFound) {
+		t.Fatalf("traversal err = %v", err)
+	}
+	if data, err := b.FetchFile(ctx, srv, "mods/escape.jar"); err == nil {
+		t.Fatalf("read through symlink: %q", data)
+	}
+	if _, err := b.GetServer(ctx, base); !errors.Is(err, backend.ErrForbidden) {
+		t.Fatalf("server outside roots err = %v", err)
+	}
+	if _, err := b.ListPath(ctx, root+"/../", "."); !errors.Is(err, backend.ErrForbidden) {
+		t.Fatalf("server climbing out of roots err = %v", err)
+	}
+	if s, err := b.GetServer(ctx, srv); err != nil || s.Name != "survival" {
+		t.Fatalf("server = %+v, %v", s, err)
+	}
+
+	// A symlinked server directory must resolve inside the roots.
+	if err := os.Symlink("/", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GetServer(ctx, filepath.Join(root, "link")); !errors.Is(err, backend.ErrForbidden) {
+		t.Fatalf("symlinked server err = %v", err)
+	}
+	if _, err := b.ListPath(ctx, filepath.Join(root, "link"), "etc"); !errors.Is(err, backend.ErrForbidden) {
+		t.Fatalf("list through symlinked server err = %v", err)
+	}
+	if err := os.Symlink(srv, filepath.Join(root, "alias")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GetServer(ctx, filepath.Join(root, "alias")); err != nil {
+		t.Fatalf("symlink within roots err = %v", err)
+	}
+}
+
+func TestFetchFileRefusesLargeFiles(t *testing.T) {
+	srv := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srv, "big.jar"), []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := New([]string{srv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := maxFileSize
+	maxFileSize = 9
+	defer func() { maxFileSize = old }()
+	if data, err := b.FetchFile(context.Background(), srv, "big.jar"); !errors.Is(err, backend.ErrTooLarge) {
+		t.Fatalf("fetch = %d bytes, %v", len(data), err)
+	}
+	maxFileSize = 10
+	if data, err := b.FetchFile(context.Background(), srv, "big.jar"); err != nil || len(data) != 10 {
+		t.Fatalf("fetch = %d bytes, %v", len(data), err)
+	}
+}
@@ -0,0 +1,80 @@
+// Package maintenance evaluates per-instance maintenance windows: cron
+// schedules marking when a window opens, each kept open for a fixed duration.
+package maintenance
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// MaxDuration bounds how long a window may stay open.
+const MaxDuration = 7 * 24 * time.Hour
+
+// Window is a parsed maintenance window.
+type Window struct {
+	Schedule string
+	Duration time.Duration
+	Location *time.Location
+	sched    cron.Schedule
+}
+
+// Parse validates a standard five-field cron schedule (or a descriptor such
+// as @daily), a window duration and an IANA timezone. An empty timezone
+// means UTC.
+func Parse(schedule string, duration time.Duration, timezone string) (*Window, error) {
+	schedule = strings.TrimSpace(schedule)
+	if schedule == "" {
+		return nil, errors.New("schedule required")
+	}
+	if strings.Contains(schedule, "TZ=") {
+		return nil, errors.New("set the timezone separately")
+	}
+	if duration <= 0 || duration > MaxDuration {
+		return nil, fmt.Errorf("duration must be between 1m and %s", MaxDuration)
+	}
+	timezone = strings.TrimSpace(timezone)
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", timezone)
+	}
+	sched, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return nil, err
+	}
+	if spec, ok := sched.(*cron.SpecSchedule); ok {
+		spec.Location = loc
+	}
+	return &Window{Schedule: schedule, Duration: duration, Location: loc, sched: sched}, nil
+}
+
+// Open reports whether t falls inside an occurrence of the window, counting
+// from the scheduled start up to, but excluding, start plus Duration.
+func (w *Window) Open(t time.Time) bool {
+	start := w.sched.Next(t.Add(-w.Duration))
+	return !start.After(t)
+}
+
+// NextOpen returns t when the window is open, otherwise the next time it
+// opens.
+func (w *Window) NextOpen(t time.Time) time.Time {
+	if w.Open(t) {
+		return t
+	}
+	return w.sched.Next(t)
+}
+
+// ClosesAt returns when the occurrence open at t ends, or the zero time when
+// the window is closed.
+func (w *Window) ClosesAt(t time.Time) time.Time {
+	if !w.Open(t) {
+		return time.Time{}
+	}
+	return w.sched.Next(t.Add(-w.Duration)).Add(w.Duration)
+}
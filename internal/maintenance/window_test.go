@@ -0,0 +1,56 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowOpenInTimezone(t *testing.T) {
+	w, err := Parse("0 3 * * *", 2*time.Hour, "Europe/Berlin")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	berlin := w.Location
+	cases := []struct {
+		at   time.Time
+		open bool
+	}{
+		{time.Date(2024, 6, 1, 2, 59, 0, 0, berlin), false},
+		{time.Date(2024, 6, 1, 3, 0, 0, 0, berlin), true},
+		{time.Date(2024, 6, 1, 4, 59, 59, 0, berlin), true},
+		{time.Date(2024, 6, 1, 5, 0, 0, 0, berlin), false},
+		// 01:30 UTC is 03:30 in Berlin during summer time.
+		{time.Date(2024, 6, 1, 1, 30, 0, 0, time.UTC), true},
+	}
+	for _, c := range cases {
+		if got := w.Open(c.at); got != c.open {
+			t.Fatalf("Open(%s) = %v, want %v", c.at, got, c.open)
+		}
+	}
+	closed := time.Date(2024, 6, 1, 12, 0, 0, 0, berlin)
+	if next := w.NextOpen(closed); !next.Equal(time.Date(2024, 6, 2, 3, 0, 0, 0, berlin)) {
+		t.Fatalf("NextOpen = %s", next)
+	}
+	open := time.Date(2024, 6, 1, 3, 30, 0, 0, berlin)
+	if end := w.ClosesAt(open); !end.Equal(time.Date(2024, 6, 1, 5, 0, 0, 0, berlin)) {
+		t.Fatalf("ClosesAt = %s", end)
+	}
+}
+
+func TestParseRejectsInvalid(t *testing.T) {
+	for _, c := range []struct {
+		schedule string
+		d        time.Duration
+		tz       string
+	}{
+		{"", time.Hour, ""},
+		{"61 * * * *", time.Hour, ""},
+		{"0 3 * * *", 0, ""},
+		{"0 3 * * *", time.Hour, "Mars/Olympus"},
+		{"CRON_TZ=UTC 0 3 * * *", time.Hour, ""},
+	} {
+		if _, err := Parse(c.schedule, c.d, c.tz); err == nil {
+			t.Fatalf("Parse(%q, %s, %q) accepted", c.schedule, c.d, c.tz)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Package manifest reads instance manifests: files kept in version control
+// that declare the loader, game version and pinned mods an instance should
+// run. Manifests are YAML; JSON documents are accepted as well.
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MaxMods bounds the mods a manifest may declare.
+const MaxMods = 1000
+
+// Manifest is the desired state of an instance. Empty Loader and
+// GameVersion leave the instance's values unchanged.
+type Manifest struct {
+	Loader      string `yaml:"loader,omitempty" json:"loader,omitempty"`
+	GameVersion string `yaml:"game_version,omitempty" json:"game_version,omitempty"`
+	Mods        []Mod  `yaml:"mods" json:"mods"`
+}
+
+// Mod is a project pinned to one version. Source names the provider the
+// project is on; empty means Modrinth.
+type Mod struct {
+	Source  string `yaml:"source,omitempty" json:"source,omitempty"`
+	Slug    string `yaml:"slug" json:"slug"`
+	Version string `yaml:"version" json:"version"`
+}
+
+// Key identifies the project of m within a manifest.
+func (m Mod) Key() string {
+	src := m.Source
+	if src == "" {
+		src = "modrinth"
+	}
+	return src + ":" + strings.ToLower(m.Slug)
+}
+
+// Parse reads and validates a manifest. Unknown fields are rejected so
+// typos do not silently drop settings. Values are trimmed, and loader and
+// source names lowercased.
+func Parse(data []byte) (*Manifest, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var m Manifest
+	if err := dec.Decode(&m); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("manifest is empty")
+		}
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	m.Loader = strings.ToLower(strings.TrimSpace(m.Loader))
+	m.GameVersion = strings.TrimSpace(m.GameVersion)
+	if len(m.Mods) > MaxMods {
+		return nil, fmt.Errorf("manifest declares more than %d mods", MaxMods)
+	}
+	seen := make(map[string]int, len(m.Mods))
+	for i := range m.Mods {
+		mod := &m.Mods[i]
+		mod.Source = strings.ToLower(strings.TrimSpace(mod.Source))
+		mod.Slug = strings.TrimSpace(mod.Slug)
+		mod.Version = strings.TrimSpace(mod.Version)
+		if mod.Slug == "" {
+			return nil, fmt.Errorf("mods[%d]: slug is required", i)
+		}
+		if mod.Version == "" {
+			return nil, fmt.Errorf("mods[%d]: version is required for %s", i, mod.Slug)
+		}
+		if j, ok := seen[mod.Key()]; ok {
+			return nil, fmt.Errorf("mods[%d]: %s is already declared by mods[%d]", i, mod.Slug, j)
+		}
+		seen[mod.Key()] = i
+	}
+	return &m, nil
+}
@@ -0,0 +1,49 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseYAMLAndJSON(t *testing.T) {
+	yamlDoc := `
+loader: Fabric
+game_version: 1.20.1
+mods:
+  - slug: sodium
+    version: mc1.20.1-0.5.8
+  - source: CurseForge
+    slug: jei
+    version: " 15.2.0.27 "
+`
+	jsonDoc := `{"loader":"fabric","game_version":"1.20.1","mods":[{"slug":"sodium","version":"mc1.20.1-0.5.8"},{"source":"curseforge","slug":"jei","version":"15.2.0.27"}]}`
+	for name, doc := range map[string]string{"yaml": yamlDoc, "json": jsonDoc} {
+		m, err := Parse([]byte(doc))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if m.Loader != "fabric" || m.GameVersion != "1.20.1" || len(m.Mods) != 2 {
+			t.Fatalf("%s: manifest = %+v", name, m)
+		}
+		if got := m.Mods[1]; got.Source != "curseforge" || got.Version != "15.2.0.27" || got.Key() != "curseforge:jei" {
+			t.Fatalf("%s: mod = %+v", name, got)
+		}
+		if m.Mods[0].Key() != "modrinth:sodium" {
+			t.Fatalf("%s: key = %q", name, m.Mods[0].Key())
+		}
+	}
+}
+
+func TestParseRejectsInvalidManifests(t *testing.T) {
+	for doc, want := range map[string]string{
+		"":                          "empty",
+		"loader: fabric\nmod: []":   "field mod not found",
+		"mods:\n  - version: '1.0'": "slug is required",
+		"mods:\n  - slug: sodium":   "version is required",
+		"mods: [{slug: Sodium, version: 1}, {slug: sodium, version: 2}]": "already declared",
+	} {
+		if _, err := Parse([]byte(doc)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("Parse(%q) err = %v, want %q", doc, err, want)
+		}
+	}
+}
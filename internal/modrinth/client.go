@@ -1,23 +1,32 @@
 package modrinth
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"math/rand"
 	"net"
 	"net/http"
 	urlpkg "net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unicode"
 
 	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
 
 	"modsentinel/internal/telemetry"
 	tokenpkg "modsentinel/internal/token"
@@ -37,6 +46,14 @@ type Client struct {
 	cache   map[string]cacheEntry
 	mu      sync.Mutex
 	backoff time.Duration
+	// requests counts HTTP requests sent, retries included.
+	requests atomic.Int64
+	// limiter paces all callers to the reported per-minute limit; budget is
+	// the rate-limit state from the latest response. Both are guarded by mu.
+	limiter *rate.Limiter
+	budget  Budget
+	// store is the optional persistent cache tier behind cache.
+	store Store
 }
 
 type cacheEntry struct {
@@ -60,12 +77,276 @@ func NewClient() *Client {
 	transport.IdleConnTimeout = 90 * time.Second
 
 	return &Client{
-		http:  &http.Client{Timeout: 30 * time.Second, Transport: transport},
-		ttl:   5 * time.Minute,
-		cache: make(map[string]cacheEntry),
+		http:    &http.Client{Timeout: 30 * time.Second, Transport: transport},
+		ttl:     5 * time.Minute,
+		cache:   make(map[string]cacheEntry),
+		limiter: rate.NewLimiter(perMinute(defaultRateLimit), burstFor(defaultRateLimit)),
 	}
 }
 
+// defaultRateLimit is Modrinth's documented requests per minute, assumed
+// until a response reports the actual limit.
+const defaultRateLimit = 300
+
+// backgroundReserve is the share of each rate-limit window background
+// requests leave to interactive ones.
+const backgroundReserve = 0.2
+
+func perMinute(n int) rate.Limit { return rate.Limit(float64(n) / 60) }
+
+func burstFor(n int) int { return max(1, n/10) }
+
+// Priority orders callers competing for the rate limit.
+type Priority int
+
+const (
+	// PriorityInteractive is for requests a user is waiting on, such as
+	// search and project metadata. It is the default.
+	PriorityInteractive Priority = iota
+	// PriorityBackground is for scheduled work such as update checks and
+	// sync. It waits for the next window rather than spend the reserve.
+	PriorityBackground
+)
+
+type priorityKey struct{}
+
+// WithPriority returns a context whose Modrinth requests use p.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+func priorityFrom(ctx context.Context) Priority {
+	p, _ := ctx.Value(priorityKey{}).(Priority)
+	return p
+}
+
+// Budget is the rate-limit state Modrinth last reported.
+type Budget struct {
+	// Known is false until a response carried rate-limit headers.
+	Known     bool      `json:"known"`
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+	// Waiting counts requests currently held back by the throttle.
+	Waiting int `json:"waiting"`
+	// Throttled counts requests ever held back until a window reset.
+	Throttled int64 `json:"throttled"`
+}
+
+// Budget returns the current rate-limit budget.
+func (c *Client) Budget() Budget {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.budget
+}
+
+// CachedResponse is a GET response kept in the persistent cache tier.
+type CachedResponse struct {
+	Key       string
+	Endpoint  string
+	Body      []byte
+	ETag      string
+	FetchedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Store persists GET responses across restarts. GetResponse returns nil for
+// unknown keys.
+type Store interface {
+	GetResponse(key string) (*CachedResponse, error)
+	PutResponse(r *CachedResponse) error
+}
+
+// SetStore adds s as a persistent cache tier behind the in-memory cache.
+func (c *Client) SetStore(s Store) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store = s
+}
+
+// PurgeMemory drops the in-memory cache tier.
+func (c *Client) PurgeMemory() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache = make(map[string]cacheEntry)
+}
+
+// EndpointTTLs is how long persisted responses are served without
+// revalidation. Loaders, project metadata and single versions rarely
+// change; version lists and batched project lookups go stale quickly.
+var EndpointTTLs = map[string]time.Duration{
+	"loaders":  24 * time.Hour,
+	"project":  12 * time.Hour,
+	"version":  24 * time.Hour,
+	"versions": 10 * time.Minute,
+	"projects": 10 * time.Minute,
+}
+
+// endpointOf names the persisted endpoint a GET URL belongs to, or "" for
+// responses that are not persisted, such as search.
+func endpointOf(u *urlpkg.URL) string {
+	p := strings.TrimPrefix(u.Path, "/v2/")
+	parts := strings.Split(p, "/")
+	switch {
+	case p == "tag/loader":
+		return "loaders"
+	case p == "projects":
+		return "projects"
+	case p == "versions":
+		return "version"
+	case len(parts) == 2 && parts[0] == "project":
+		return "project"
+	case len(parts) == 3 && parts[0] == "project" && parts[2] == "version":
+		return "versions"
+	case len(parts) == 2 && parts[0] == "version":
+		return "version"
+	}
+	return ""
+}
+
+// stored returns the persisted response for key, if any.
+func (c *Client) stored(key string) *CachedResponse {
+	c.mu.Lock()
+	st := c.store
+	c.mu.Unlock()
+	if st == nil {
+		return nil
+	}
+	r, err := st.GetResponse(key)
+	if err != nil {
+		telemetry.Event("modrinth_store_error", map[string]string{"op": "get", "error": err.Error()})
+		return nil
+	}
+	return r
+}
+
+// persist saves a response to the persistent tier with its endpoint's TTL.
+func (c *Client) persist(r *CachedResponse) {
+	c.mu.Lock()
+	st := c.store
+	c.mu.Unlock()
+	if st == nil {
+		return
+	}
+	r.FetchedAt = time.Now()
+	r.ExpiresAt = r.FetchedAt.Add(EndpointTTLs[r.Endpoint])
+	if err := st.PutResponse(r); err != nil {
+		telemetry.Event("modrinth_store_error", map[string]string{"op": "put", "error": err.Error()})
+	}
+}
+
+// remember keeps a response body in the in-memory tier.
+func (c *Client) remember(key string, b []byte) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cache == nil {
+		c.cache = make(map[string]cacheEntry)
+	}
+	c.cache[key] = cacheEntry{data: b, exp: time.Now().Add(c.ttl)}
+}
+
+// waitFor blocks for d or until ctx is done. It is declared as a variable so
+// tests can stub out waiting.
+var waitFor = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// budgetDelay returns how long a request of priority p must wait for the
+// window to reset: interactive requests only once the budget is spent,
+// background ones once it falls to the reserve.
+func (c *Client) budgetDelay(p Priority, now time.Time) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := c.budget
+	if !b.Known || !now.Before(b.ResetAt) {
+		return 0
+	}
+	floor := 0
+	if p == PriorityBackground {
+		floor = int(float64(b.Limit) * backgroundReserve)
+	}
+	if b.Remaining > floor {
+		return 0
+	}
+	return b.ResetAt.Sub(now)
+}
+
+// throttle holds a request until the budget and the token bucket allow it,
+// then counts it against the remaining budget.
+func (c *Client) throttle(ctx context.Context) error {
+	p := priorityFrom(ctx)
+	counted := false
+	for {
+		d := c.budgetDelay(p, time.Now())
+		if d <= 0 {
+			break
+		}
+		c.mu.Lock()
+		c.budget.Waiting++
+		if !counted {
+			c.budget.Throttled++
+			counted = true
+		}
+		c.mu.Unlock()
+		telemetry.Event("modrinth_throttled", map[string]string{
+			"priority": strconv.Itoa(int(p)),
+			"wait_ms":  strconv.FormatInt(d.Milliseconds(), 10),
+		})
+		err := waitFor(ctx, d)
+		c.mu.Lock()
+		c.budget.Waiting--
+		c.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	lim := c.limiter
+	c.mu.Unlock()
+	if lim != nil {
+		if err := lim.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	if c.budget.Known && c.budget.Remaining > 0 {
+		c.budget.Remaining--
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// recordBudget updates the budget from X-Ratelimit-* headers, retuning the
+// token bucket when the limit changes.
+func (c *Client) recordBudget(h http.Header) {
+	limit, errL := strconv.Atoi(h.Get("X-Ratelimit-Limit"))
+	remaining, errR := strconv.Atoi(h.Get("X-Ratelimit-Remaining"))
+	reset, errS := strconv.Atoi(h.Get("X-Ratelimit-Reset"))
+	if errL != nil || errR != nil || errS != nil || limit <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.limiter != nil && c.budget.Limit != limit {
+		c.limiter.SetLimit(perMinute(limit))
+		c.limiter.SetBurst(burstFor(limit))
+	}
+	c.budget.Known = true
+	c.budget.Limit = limit
+	c.budget.Remaining = remaining
+	c.budget.ResetAt = time.Now().Add(time.Duration(reset) * time.Second)
+}
+
 // Error represents a normalized Modrinth API error.
 // Kind categorizes Modrinth errors.
 type Kind string
@@ -123,8 +404,22 @@ func redactURL(u *urlpkg.URL) string {
 }
 
 // do executes the request with retry/backoff and decodes JSON into v.
+// Request bodies are buffered so they can be replayed on retry and are part
+// of the cache/singleflight key.
 func (c *Client) do(req *http.Request, v interface{}) error {
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+		body = b
+	}
 	key := req.Method + " " + req.URL.String()
+	if len(body) > 0 {
+		key += " " + string(body)
+	}
 	if c.ttl > 0 {
 		c.mu.Lock()
 		if e, ok := c.cache[key]; ok {
@@ -143,6 +438,25 @@ func (c *Client) do(req *http.Request, v interface{}) error {
 		c.mu.Unlock()
 	}
 	data, err, _ := c.sf.Do(key, func() (interface{}, error) {
+		// Persisted GET responses are served while fresh and revalidated
+		// with their ETag once stale.
+		var prev *CachedResponse
+		endpoint := ""
+		if req.Method == http.MethodGet {
+			endpoint = endpointOf(req.URL)
+		}
+		if endpoint != "" {
+			if prev = c.stored(key); prev != nil {
+				if time.Now().Before(prev.ExpiresAt) {
+					c.remember(key, prev.Body)
+					telemetry.Event("modrinth_result", map[string]string{"outcome": "success", "cache": "store"})
+					return prev.Body, nil
+				}
+				if prev.ETag != "" {
+					req.Header.Set("If-None-Match", prev.ETag)
+				}
+			}
+		}
 		c.mu.Lock()
 		bo := c.backoff
 		c.mu.Unlock()
@@ -159,7 +473,20 @@ func (c *Client) do(req *http.Request, v interface{}) error {
 		var dur time.Duration
 		urlStr := redactURL(req.URL)
 		for i := 0; i < 3; i++ {
+			if body != nil {
+				req.Body = io.NopCloser(bytes.NewReader(body))
+			}
+			if err := c.throttle(req.Context()); err != nil {
+				// The token bucket reports waits past the deadline
+				// before it passes; treat those as timeouts too.
+				kind := KindTimeout
+				if errors.Is(err, context.Canceled) {
+					kind = KindCanceled
+				}
+				return nil, &Error{Kind: kind, Err: err}
+			}
 			start := time.Now()
+			c.requests.Add(1)
 			resp, err = c.http.Do(req)
 			dur = time.Since(start)
 			attempt := strconv.Itoa(i + 1)
@@ -198,6 +525,7 @@ func (c *Client) do(req *http.Request, v interface{}) error {
 				"duration_ms": strconv.FormatInt(dur.Milliseconds(), 10),
 				"attempt":     attempt,
 			})
+			c.recordBudget(resp.Header)
 			if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
 				base := 250 * time.Millisecond
 				delay := time.Duration(1<<i) * base
@@ -230,6 +558,19 @@ func (c *Client) do(req *http.Request, v interface{}) error {
 			return nil, &Error{Kind: KindServer, Message: "no response"}
 		}
 		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotModified && prev != nil {
+			c.persist(prev)
+			c.remember(key, prev.Body)
+			telemetry.Event("modrinth_result", map[string]string{
+				"outcome":     "success",
+				"status":      strconv.Itoa(resp.StatusCode),
+				"duration_ms": strconv.FormatInt(dur.Milliseconds(), 10),
+			})
+			c.mu.Lock()
+			c.backoff = 0
+			c.mu.Unlock()
+			return prev.Body, nil
+		}
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 			telemetry.Event("modrinth_error", map[string]string{"status": strconv.Itoa(resp.StatusCode)})
 			kind := KindClient
@@ -284,13 +625,9 @@ func (c *Client) do(req *http.Request, v interface{}) error {
 			})
 			return nil, err
 		}
-		if c.ttl > 0 {
-			c.mu.Lock()
-			if c.cache == nil {
-				c.cache = make(map[string]cacheEntry)
-			}
-			c.cache[key] = cacheEntry{data: b, exp: time.Now().Add(c.ttl)}
-			c.mu.Unlock()
+		c.remember(key, b)
+		if endpoint != "" {
+			c.persist(&CachedResponse{Key: key, Endpoint: endpoint, Body: b, ETag: resp.Header.Get("ETag")})
 		}
 		telemetry.Event("modrinth_result", map[string]string{
 			"outcome":     "success",
@@ -313,13 +650,27 @@ func (c *Client) do(req *http.Request, v interface{}) error {
 	return nil
 }
 
+// Requests returns the number of HTTP requests the client has sent,
+// retries included. Cached and deduplicated calls are not counted.
+func (c *Client) Requests() int64 {
+	return c.requests.Load()
+}
+
 // Project represents a Modrinth project.
 type Project struct {
+	ID      string `json:"id"`
+	Slug    string `json:"slug"`
 	Title   string `json:"title"`
 	IconURL string `json:"icon_url"`
+	// ClientSide and ServerSide state whether the project is required,
+	// optional, unsupported or unknown on each side.
+	ClientSide string `json:"client_side"`
+	ServerSide string `json:"server_side"`
+	// Updated is when the project or any of its versions last changed.
+	Updated time.Time `json:"updated"`
 }
 
-// Project fetches project information by slug.
+// Project fetches project information by slug or project ID.
 func (c *Client) Project(ctx context.Context, slug string) (*Project, error) {
 	url := fmt.Sprintf("https://api.modrinth.com/v2/project/%s", slug)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
@@ -333,19 +684,189 @@ func (c *Client) Project(ctx context.Context, slug string) (*Project, error) {
 	return &p, nil
 }
 
+// Projects fetches several projects by ID or slug in a single request.
+// Unknown projects are omitted from the result.
+func (c *Client) Projects(ctx context.Context, ids []string) ([]Project, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	sorted := append([]string(nil), ids...)
+	sort.Strings(sorted)
+	list, err := json.Marshal(sorted)
+	if err != nil {
+		return nil, err
+	}
+	url := "https://api.modrinth.com/v2/projects?ids=" + urlpkg.QueryEscape(string(list))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out []Project
+	if err := c.do(req, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LoaderTag is a mod loader Modrinth knows.
+type LoaderTag struct {
+	Icon                  string   `json:"icon"`
+	Name                  string   `json:"name"`
+	SupportedProjectTypes []string `json:"supported_project_types"`
+}
+
+// Loaders fetches the loader tags.
+func (c *Client) Loaders(ctx context.Context) ([]LoaderTag, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.modrinth.com/v2/tag/loader", nil)
+	if err != nil {
+		return nil, err
+	}
+	var tags []LoaderTag
+	if err := c.do(req, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
 // Version represents a Modrinth project version.
 type Version struct {
 	ID            string        `json:"id"`
+	ProjectID     string        `json:"project_id"`
 	VersionNumber string        `json:"version_number"`
 	VersionType   string        `json:"version_type"`
 	DatePublished time.Time     `json:"date_published"`
 	GameVersions  []string      `json:"game_versions"`
 	Loaders       []string      `json:"loaders"`
 	Files         []VersionFile `json:"files"`
+	Dependencies  []Dependency  `json:"dependencies"`
 }
 
 type VersionFile struct {
-	URL string `json:"url"`
+	URL      string `json:"url"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	Primary  bool   `json:"primary"`
+	// Hashes maps an algorithm (sha512, sha1) to the file's hex digest.
+	Hashes map[string]string `json:"hashes"`
+}
+
+// HashMismatchError reports downloaded bytes that differ from the published
+// file.
+type HashMismatchError struct {
+	Algorithm string
+	Expected  string
+	Actual    string
+}
+
+func (e *HashMismatchError) Error() string {
+	return fmt.Sprintf("%s mismatch: expected %s, got %s", e.Algorithm, e.Expected, e.Actual)
+}
+
+// hashAlgorithms lists the supported digests, strongest first.
+var hashAlgorithms = []struct {
+	name string
+	new  func() hash.Hash
+}{
+	{"sha512", sha512.New},
+	{"sha256", sha256.New},
+	{"sha1", sha1.New},
+}
+
+// Verify checks data against the strongest hash published for the file and
+// returns the algorithm used. Files without a supported hash return "" and
+// no error.
+func (f VersionFile) Verify(data []byte) (string, error) {
+	for _, a := range hashAlgorithms {
+		want := strings.ToLower(strings.TrimSpace(f.Hashes[a.name]))
+		if want == "" {
+			continue
+		}
+		h := a.new()
+		h.Write(data)
+		if got := hex.EncodeToString(h.Sum(nil)); got != want {
+			return a.name, &HashMismatchError{Algorithm: a.name, Expected: want, Actual: got}
+		}
+		return a.name, nil
+	}
+	return "", nil
+}
+
+// Verifiable reports whether the file publishes a hash Verify can check.
+func (f VersionFile) Verifiable() bool {
+	for _, a := range hashAlgorithms {
+		if strings.TrimSpace(f.Hashes[a.name]) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// PrimaryFile returns the file flagged primary, falling back to the first.
+func (v Version) PrimaryFile() (VersionFile, bool) {
+	for _, f := range v.Files {
+		if f.Primary {
+			return f, true
+		}
+	}
+	if len(v.Files) > 0 {
+		return v.Files[0], true
+	}
+	return VersionFile{}, false
+}
+
+// Dependency types reported by Modrinth.
+const (
+	DependencyRequired     = "required"
+	DependencyOptional     = "optional"
+	DependencyIncompatible = "incompatible"
+	DependencyEmbedded     = "embedded"
+)
+
+// Dependency links a version to another project or specific version.
+// Either VersionID or ProjectID may be empty.
+type Dependency struct {
+	VersionID      string `json:"version_id"`
+	ProjectID      string `json:"project_id"`
+	FileName       string `json:"file_name"`
+	DependencyType string `json:"dependency_type"`
+}
+
+// Version fetches a single version by its ID.
+func (c *Client) Version(ctx context.Context, id string) (*Version, error) {
+	url := fmt.Sprintf("https://api.modrinth.com/v2/version/%s", id)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	var v Version
+	if err := c.do(req, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// VersionsByIDs fetches versions by ID in one request. Unknown IDs are
+// omitted from the result.
+func (c *Client) VersionsByIDs(ctx context.Context, ids []string) ([]Version, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	sorted := append([]string(nil), ids...)
+	sort.Strings(sorted)
+	list, err := json.Marshal(sorted)
+	if err != nil {
+		return nil, err
+	}
+	url := "https://api.modrinth.com/v2/versions?ids=" + urlpkg.QueryEscape(string(list))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out []Version
+	if err := c.do(req, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
 // Versions fetches versions for a project filtered by game version and loader.
@@ -372,6 +893,67 @@ func (c *Client) Versions(ctx context.Context, slug, gameVersion, loader string)
 	return v, nil
 }
 
+// VersionsByHashes looks up the versions owning the given file hashes in a
+// single request. algorithm is "sha1" or "sha512". The result is keyed by
+// hash; hashes unknown to Modrinth are omitted.
+func (c *Client) VersionsByHashes(ctx context.Context, hashes []string, algorithm string) (map[string]Version, error) {
+	if len(hashes) == 0 {
+		return map[string]Version{}, nil
+	}
+	// Sort a copy so equal sets share cache and singleflight entries.
+	sorted := append([]string(nil), hashes...)
+	sort.Strings(sorted)
+	body, err := json.Marshal(struct {
+		Hashes    []string `json:"hashes"`
+		Algorithm string   `json:"algorithm"`
+	}{sorted, algorithm})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.modrinth.com/v2/version_files", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	out := map[string]Version{}
+	if err := c.do(req, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LatestVersionsByHashes returns, for each file hash, the newest version of
+// the owning project compatible with the given loaders and game versions,
+// in a single request. Empty filters are not applied. The result is keyed
+// by hash; hashes unknown to Modrinth or without a compatible version are
+// omitted.
+func (c *Client) LatestVersionsByHashes(ctx context.Context, hashes []string, algorithm string, loaders, gameVersions []string) (map[string]Version, error) {
+	if len(hashes) == 0 {
+		return map[string]Version{}, nil
+	}
+	sorted := append([]string(nil), hashes...)
+	sort.Strings(sorted)
+	body, err := json.Marshal(struct {
+		Hashes       []string `json:"hashes"`
+		Algorithm    string   `json:"algorithm"`
+		Loaders      []string `json:"loaders,omitempty"`
+		GameVersions []string `json:"game_versions,omitempty"`
+	}{sorted, algorithm, loaders, gameVersions})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.modrinth.com/v2/version_files/update", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	out := map[string]Version{}
+	if err := c.do(req, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // SearchResult represents a Modrinth search response.
 type SearchResult struct {
     Hits []struct {
@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -994,3 +997,355 @@ func TestSearchRecoversAfterTimeout(t *testing.T) {
 		t.Fatalf("unexpected result: %+v", res)
 	}
 }
+
+// Test that VersionsByHashes posts the sorted hash set and decodes the hash-keyed response.
+func TestVersionsByHashes(t *testing.T) {
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodPost || req.URL.Path != "/v2/version_files" {
+			t.Fatalf("unexpected request %s %s", req.Method, req.URL.Path)
+		}
+		var body struct {
+			Hashes    []string `json:"hashes"`
+			Algorithm string   `json:"algorithm"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+		if body.Algorithm != "sha512" {
+			t.Fatalf("algorithm = %q; want sha512", body.Algorithm)
+		}
+		if !reflect.DeepEqual(body.Hashes, []string{"aaa", "bbb"}) {
+			t.Fatalf("hashes = %v; want [aaa bbb]", body.Hashes)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"aaa":{"id":"v1","project_id":"P1","version_number":"1.0"}}`)),
+			Header:     make(http.Header),
+		}, nil
+	})
+	c := &Client{http: &http.Client{Transport: rt}}
+	got, err := c.VersionsByHashes(context.Background(), []string{"bbb", "aaa"}, "sha512")
+	if err != nil {
+		t.Fatalf("VersionsByHashes: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("len = %d; want 1", len(got))
+	}
+	if v := got["aaa"]; v.ProjectID != "P1" || v.VersionNumber != "1.0" {
+		t.Fatalf("unexpected version: %+v", v)
+	}
+}
+
+func TestVersionDecodesDependencies(t *testing.T) {
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path != "/v2/version/abc" {
+			t.Fatalf("unexpected path %s", req.URL.Path)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body: io.NopCloser(strings.NewReader(`{"id":"abc","project_id":"P1","dependencies":[` +
+				`{"project_id":"P7oDxbP4","dependency_type":"required"},` +
+				`{"version_id":"v9","project_id":"P9","dependency_type":"incompatible"}]}`)),
+			Header: make(http.Header),
+		}, nil
+	})
+	c := &Client{http: &http.Client{Transport: rt}}
+	v, err := c.Version(context.Background(), "abc")
+	if err != nil {
+		t.Fatalf("Version: %v", err)
+	}
+	want := []Dependency{
+		{ProjectID: "P7oDxbP4", DependencyType: DependencyRequired},
+		{VersionID: "v9", ProjectID: "P9", DependencyType: DependencyIncompatible},
+	}
+	if !reflect.DeepEqual(v.Dependencies, want) {
+		t.Fatalf("dependencies = %+v; want %+v", v.Dependencies, want)
+	}
+}
+
+func TestVersionFileVerify(t *testing.T) {
+	var f VersionFile
+	body := `{"url":"https://cdn.modrinth.com/a.jar","filename":"a.jar","size":3,"primary":true,` +
+		`"hashes":{"sha1":"a9993e364706816aba3e25717850c26c9cd0d89d",` +
+		`"sha512":"ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f"}}`
+	if err := json.Unmarshal([]byte(body), &f); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if algo, err := f.Verify([]byte("abc")); err != nil || algo != "sha512" {
+		t.Fatalf("Verify = %q, %v", algo, err)
+	}
+	algo, err := f.Verify([]byte("abd"))
+	var mismatch *HashMismatchError
+	if !errors.As(err, &mismatch) || algo != "sha512" || mismatch.Expected != f.Hashes["sha512"] {
+		t.Fatalf("Verify tampered = %q, %v", algo, err)
+	}
+	if algo, err := (VersionFile{}).Verify([]byte("abc")); err != nil || algo != "" {
+		t.Fatalf("Verify without hashes = %q, %v", algo, err)
+	}
+}
+
+// Test that request bodies are replayed when a POST is retried.
+func TestClientRetryReplaysBody(t *testing.T) {
+	var attempts int32
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		b, _ := io.ReadAll(req.Body)
+		if !strings.Contains(string(b), `"hashes":["abc"]`) {
+			t.Fatalf("attempt %d body = %s", atomic.LoadInt32(&attempts)+1, b)
+		}
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return &http.Response{
+				StatusCode: http.StatusInternalServerError,
+				Body:       io.NopCloser(strings.NewReader("{}")),
+				Header:     make(http.Header),
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{}`)),
+			Header:     make(http.Header),
+		}, nil
+	})
+	oldRand := randDuration
+	randDuration = func(time.Duration) time.Duration { return 0 }
+	defer func() { randDuration = oldRand }()
+	oldSleep := sleep
+	sleep = func(time.Duration) {}
+	defer func() { sleep = oldSleep }()
+	c := &Client{http: &http.Client{Transport: rt}}
+	if _, err := c.VersionsByHashes(context.Background(), []string{"abc"}, "sha1"); err != nil {
+		t.Fatalf("VersionsByHashes: %v", err)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 2 {
+		t.Fatalf("attempts = %d, want 2", got)
+	}
+}
+
+func TestLatestVersionsByHashes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v2/version_files/update" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var body struct {
+			Hashes       []string `json:"hashes"`
+			Algorithm    string   `json:"algorithm"`
+			Loaders      []string `json:"loaders"`
+			GameVersions []string `json:"game_versions"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		if !reflect.DeepEqual(body.Hashes, []string{"aaa", "bbb"}) || body.Algorithm != "sha512" {
+			t.Errorf("body = %+v", body)
+		}
+		if !reflect.DeepEqual(body.Loaders, []string{"fabric"}) || !reflect.DeepEqual(body.GameVersions, []string{"1.20.1"}) {
+			t.Errorf("filters = %v %v", body.Loaders, body.GameVersions)
+		}
+		w.Write([]byte(`{"bbb":{"id":"v2","project_id":"P2","version_number":"2.0","version_type":"release"}}`))
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		req.URL.Scheme = u.Scheme
+		req.URL.Host = u.Host
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	c := &Client{http: &http.Client{Transport: rt}}
+	got, err := c.LatestVersionsByHashes(context.Background(), []string{"bbb", "aaa"}, "sha512", []string{"fabric"}, []string{"1.20.1"})
+	if err != nil {
+		t.Fatalf("LatestVersionsByHashes: %v", err)
+	}
+	if len(got) != 1 || got["bbb"].ID != "v2" {
+		t.Fatalf("got %+v", got)
+	}
+	if c.Requests() != 1 {
+		t.Fatalf("requests = %d, want 1", c.Requests())
+	}
+}
+
+func TestProjectsBatch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/projects" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var ids []string
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("ids")), &ids); err != nil {
+			t.Errorf("decode ids: %v", err)
+		}
+		if !reflect.DeepEqual(ids, []string{"lithium", "sodium"}) {
+			t.Errorf("ids = %v", ids)
+		}
+		w.Write([]byte(`[{"id":"AANobbMI","slug":"sodium","title":"Sodium","updated":"2024-05-01T10:00:00Z"},` +
+			`{"id":"gvQqBUqZ","slug":"lithium","title":"Lithium","updated":"2024-04-01T10:00:00Z"}]`))
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		req.URL.Scheme = u.Scheme
+		req.URL.Host = u.Host
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	c := &Client{http: &http.Client{Transport: rt}}
+	got, err := c.Projects(context.Background(), []string{"sodium", "lithium"})
+	if err != nil {
+		t.Fatalf("Projects: %v", err)
+	}
+	if len(got) != 2 || got[0].Slug != "sodium" || !got[0].Updated.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("got %+v", got)
+	}
+	if none, err := c.Projects(context.Background(), nil); err != nil || none != nil || c.Requests() != 1 {
+		t.Fatalf("empty Projects = %v, %v after %d requests", none, err, c.Requests())
+	}
+}
+
+// Test that the budget follows the X-Ratelimit headers and that background
+// requests wait for the window to reset once only the reserve is left,
+// while interactive requests may spend it.
+func TestClientRateLimitBudget(t *testing.T) {
+	var remaining int32 = 61
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		h := make(http.Header)
+		h.Set("X-Ratelimit-Limit", "300")
+		h.Set("X-Ratelimit-Remaining", strconv.Itoa(int(atomic.AddInt32(&remaining, -1))))
+		h.Set("X-Ratelimit-Reset", "30")
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{}`)), Header: h}, nil
+	})
+	var waits []time.Duration
+	oldWait := waitFor
+	waitFor = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return context.Canceled
+	}
+	defer func() { waitFor = oldWait }()
+	c := &Client{http: &http.Client{Transport: rt}}
+
+	if _, err := c.Project(context.Background(), "a"); err != nil {
+		t.Fatalf("Project: %v", err)
+	}
+	b := c.Budget()
+	if !b.Known || b.Limit != 300 || b.Remaining != 60 || time.Until(b.ResetAt) <= 25*time.Second {
+		t.Fatalf("budget = %+v", b)
+	}
+
+	bg := WithPriority(context.Background(), PriorityBackground)
+	_, err := c.Project(bg, "b")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Kind != KindCanceled {
+		t.Fatalf("background Project err = %v, want canceled while waiting", err)
+	}
+	if len(waits) != 1 || waits[0] <= 25*time.Second {
+		t.Fatalf("waits = %v, want one wait for the reset", waits)
+	}
+	if b := c.Budget(); b.Throttled != 1 || b.Waiting != 0 {
+		t.Fatalf("budget after throttle = %+v", b)
+	}
+
+	if _, err := c.Project(context.Background(), "c"); err != nil {
+		t.Fatalf("interactive Project: %v", err)
+	}
+	if len(waits) != 1 {
+		t.Fatalf("interactive request waited: %v", waits)
+	}
+}
+
+// memStore is an in-memory Store.
+type memStore struct {
+	mu      sync.Mutex
+	entries map[string]*CachedResponse
+}
+
+func (s *memStore) GetResponse(key string) (*CachedResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		cp := *e
+		return &cp, nil
+	}
+	return nil, nil
+}
+
+func (s *memStore) PutResponse(r *CachedResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := *r
+	s.entries[r.Key] = &cp
+	return nil
+}
+
+// Test that persisted responses survive a new client and are revalidated
+// with their ETag once stale.
+func TestClientStoreRevalidatesWithETag(t *testing.T) {
+	var requests int32
+	var ifNoneMatch string
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&requests, 1)
+		ifNoneMatch = req.Header.Get("If-None-Match")
+		if ifNoneMatch == `"v1"` {
+			return &http.Response{StatusCode: http.StatusNotModified, Body: io.NopCloser(strings.NewReader("")), Header: http.Header{}}, nil
+		}
+		h := http.Header{}
+		h.Set("ETag", `"v1"`)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{"id":"AANobbMI","slug":"sodium","title":"Sodium"}`)), Header: h}, nil
+	})
+	store := &memStore{entries: map[string]*CachedResponse{}}
+	c := &Client{http: &http.Client{Transport: rt}}
+	c.SetStore(store)
+	if _, err := c.Project(context.Background(), "sodium"); err != nil {
+		t.Fatalf("project: %v", err)
+	}
+	if len(store.entries) != 1 {
+		t.Fatalf("stored %d entries, want 1", len(store.entries))
+	}
+	var entry *CachedResponse
+	for _, e := range store.entries {
+		entry = e
+	}
+	if entry.Endpoint != "project" || entry.ETag != `"v1"` || entry.ExpiresAt.Sub(entry.FetchedAt) != EndpointTTLs["project"] {
+		t.Fatalf("entry = %+v", entry)
+	}
+
+	// A restarted client answers from the store while the entry is fresh.
+	c2 := &Client{http: &http.Client{Transport: rt}}
+	c2.SetStore(store)
+	p, err := c2.Project(context.Background(), "sodium")
+	if err != nil || p.Title != "Sodium" {
+		t.Fatalf("project from store = %+v, %v", p, err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Fatalf("requests = %d, want 1", got)
+	}
+
+	// Once stale it is revalidated; a 304 keeps the stored body.
+	entry.ExpiresAt = time.Now().Add(-time.Minute)
+	c3 := &Client{http: &http.Client{Transport: rt}}
+	c3.SetStore(store)
+	p, err = c3.Project(context.Background(), "sodium")
+	if err != nil || p.Slug != "sodium" {
+		t.Fatalf("revalidated project = %+v, %v", p, err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 || ifNoneMatch != `"v1"` {
+		t.Fatalf("requests = %d, If-None-Match = %q", got, ifNoneMatch)
+	}
+	if !store.entries[entry.Key].ExpiresAt.After(time.Now()) {
+		t.Fatalf("entry not refreshed: %+v", store.entries[entry.Key])
+	}
+}
+
+func TestEndpointOf(t *testing.T) {
+	for raw, want := range map[string]string{
+		"https://api.modrinth.com/v2/tag/loader":             "loaders",
+		"https://api.modrinth.com/v2/project/sodium":         "project",
+		"https://api.modrinth.com/v2/project/sodium/version": "versions",
+		"https://api.modrinth.com/v2/version/abc":            "version",
+		"https://api.modrinth.com/v2/projects?ids=[]":        "projects",
+		"https://api.modrinth.com/v2/versions?ids=[]":        "version",
+		"https://api.modrinth.com/v2/search?query=x":         "",
+	} {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := endpointOf(u); got != want {
+			t.Fatalf("endpointOf(%s) = %q, want %q", raw, got, want)
+		}
+	}
+}
@@ -0,0 +1,474 @@
+package modrinth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A mirror is a directory holding exported Modrinth metadata and jars so
+// the client can run without network access:
+//
+//	mirror.json                 manifest
+//	tags/loader.json            loader tags
+//	projects/<id>.json          project
+//	projects/<id>.versions.json every version of the project, newest first
+//	blobs/<sha512>              version files
+const (
+	mirrorManifest = "mirror.json"
+	mirrorFormat   = 1
+)
+
+// Hosts served from a mirror; requests to any other host are passed on.
+var mirrorHosts = map[string]bool{"api.modrinth.com": true, "cdn.modrinth.com": true}
+
+// ErrNotMirrored describes Modrinth requests a mirror cannot answer.
+var ErrNotMirrored = errors.New("not available in offline mirror")
+
+// MirrorManifest describes a mirror directory.
+type MirrorManifest struct {
+	Format      int       `json:"format"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Projects    []string  `json:"projects"`
+}
+
+// Mirror serves Modrinth API responses and version files from a mirror
+// directory. It is an http.RoundTripper; requests to hosts other than
+// Modrinth's go to Next, or fail when Next is nil.
+type Mirror struct {
+	Next http.RoundTripper
+
+	dir      string
+	manifest MirrorManifest
+	loaders  []LoaderTag
+	projects map[string]*Project // by lower-case slug and ID
+	versions map[string][]Version
+	byID     map[string]Version
+	byHash   map[string]Version // by "algorithm:digest"
+	blobs    map[string]string  // file URL to sha512
+}
+
+// OpenMirror loads the mirror in dir.
+func OpenMirror(dir string) (*Mirror, error) {
+	m := &Mirror{
+		dir:      dir,
+		projects: map[string]*Project{},
+		versions: map[string][]Version{},
+		byID:     map[string]Version{},
+		byHash:   map[string]Version{},
+		blobs:    map[string]string{},
+	}
+	if err := readJSON(filepath.Join(dir, mirrorManifest), &m.manifest); err != nil {
+		return nil, fmt.Errorf("read mirror manifest: %w", err)
+	}
+	if m.manifest.Format != mirrorFormat {
+		return nil, fmt.Errorf("unsupported mirror format %d", m.manifest.Format)
+	}
+	if err := readJSON(filepath.Join(dir, "tags", "loader.json"), &m.loaders); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read mirror loaders: %w", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "projects", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if strings.HasSuffix(f, ".versions.json") {
+			continue
+		}
+		var p Project
+		if err := readJSON(f, &p); err != nil {
+			return nil, fmt.Errorf("read mirror project %s: %w", filepath.Base(f), err)
+		}
+		var vs []Version
+		if err := readJSON(strings.TrimSuffix(f, ".json")+".versions.json", &vs); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("read mirror versions of %s: %w", p.Slug, err)
+		}
+		m.add(&p, vs)
+	}
+	return m, nil
+}
+
+func (m *Mirror) add(p *Project, vs []Version) {
+	m.projects[strings.ToLower(p.ID)] = p
+	m.projects[strings.ToLower(p.Slug)] = p
+	m.versions[p.ID] = vs
+	for _, v := range vs {
+		m.byID[v.ID] = v
+		for _, f := range v.Files {
+			for algo, d := range f.Hashes {
+				m.byHash[algo+":"+strings.ToLower(d)] = v
+			}
+			if d := f.Hashes["sha512"]; d != "" && f.URL != "" {
+				if _, err := os.Stat(m.blobPath(d)); err == nil {
+					m.blobs[f.URL] = strings.ToLower(d)
+				}
+			}
+		}
+	}
+}
+
+// Manifest returns the mirror's manifest.
+func (m *Mirror) Manifest() MirrorManifest { return m.manifest }
+
+func (m *Mirror) blobPath(sha512 string) string {
+	return filepath.Join(m.dir, "blobs", strings.ToLower(sha512))
+}
+
+// RoundTrip answers Modrinth API and CDN requests from the mirror.
+func (m *Mirror) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !mirrorHosts[req.URL.Host] {
+		if m.Next == nil {
+			return nil, fmt.Errorf("%s: offline mode", req.URL.Host)
+		}
+		return m.Next.RoundTrip(req)
+	}
+	if sum, ok := m.blobs[req.URL.String()]; ok && req.Method == http.MethodGet {
+		f, err := os.Open(m.blobPath(sum))
+		if err != nil {
+			return nil, err
+		}
+		return mirrorResponse(req, http.StatusOK, f), nil
+	}
+	v, status := m.answer(req)
+	if status != http.StatusOK {
+		body := fmt.Sprintf(`{"error":"not_found","description":%q}`, ErrNotMirrored.Error())
+		return mirrorResponse(req, status, io.NopCloser(strings.NewReader(body))), nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return mirrorResponse(req, http.StatusOK, io.NopCloser(bytes.NewReader(b))), nil
+}
+
+func mirrorResponse(req *http.Request, status int, body io.ReadCloser) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       body,
+		Request:    req,
+	}
+}
+
+// answer resolves an API request to the value to encode, mirroring the
+// endpoints Client uses.
+func (m *Mirror) answer(req *http.Request) (any, int) {
+	if req.URL.Host != "api.modrinth.com" {
+		return nil, http.StatusNotFound
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	parts := strings.Split(path, "/")
+	q := req.URL.Query()
+	switch {
+	case req.Method == http.MethodGet && path == "tag/loader":
+		return m.loaders, http.StatusOK
+	case req.Method == http.MethodGet && path == "projects":
+		var ids []string
+		if err := json.Unmarshal([]byte(q.Get("ids")), &ids); err != nil {
+			return nil, http.StatusBadRequest
+		}
+		out := []Project{}
+		for _, id := range ids {
+			if p, ok := m.projects[strings.ToLower(id)]; ok {
+				out = append(out, *p)
+			}
+		}
+		return out, http.StatusOK
+	case req.Method == http.MethodGet && path == "versions":
+		var ids []string
+		if err := json.Unmarshal([]byte(q.Get("ids")), &ids); err != nil {
+			return nil, http.StatusBadRequest
+		}
+		out := []Version{}
+		for _, id := range ids {
+			if v, ok := m.byID[id]; ok {
+				out = append(out, v)
+			}
+		}
+		return out, http.StatusOK
+	case req.Method == http.MethodGet && path == "search":
+		return m.search(q.Get("query")), http.StatusOK
+	case req.Method == http.MethodGet && len(parts) == 2 && parts[0] == "project":
+		if p, ok := m.projects[strings.ToLower(parts[1])]; ok {
+			return p, http.StatusOK
+		}
+	case req.Method == http.MethodGet && len(parts) == 3 && parts[0] == "project" && parts[2] == "version":
+		p, ok := m.projects[strings.ToLower(parts[1])]
+		if !ok {
+			break
+		}
+		var loaders, games []string
+		json.Unmarshal([]byte(q.Get("loaders")), &loaders)
+		json.Unmarshal([]byte(q.Get("game_versions")), &games)
+		return m.compatible(p.ID, loaders, games), http.StatusOK
+	case req.Method == http.MethodGet && len(parts) == 2 && parts[0] == "version":
+		if v, ok := m.byID[parts[1]]; ok {
+			return v, http.StatusOK
+		}
+	case req.Method == http.MethodPost && (path == "version_files" || path == "version_files/update"):
+		var body struct {
+			Hashes       []string `json:"hashes"`
+			Algorithm    string   `json:"algorithm"`
+			Loaders      []string `json:"loaders"`
+			GameVersions []string `json:"game_versions"`
+		}
+		if req.Body == nil || json.NewDecoder(req.Body).Decode(&body) != nil {
+			return nil, http.StatusBadRequest
+		}
+		out := map[string]Version{}
+		for _, h := range body.Hashes {
+			v, ok := m.byHash[body.Algorithm+":"+strings.ToLower(h)]
+			if !ok {
+				continue
+			}
+			if path == "version_files" {
+				out[h] = v
+				continue
+			}
+			if latest := m.compatible(v.ProjectID, body.Loaders, body.GameVersions); len(latest) > 0 {
+				out[h] = latest[0]
+			}
+		}
+		return out, http.StatusOK
+	}
+	return nil, http.StatusNotFound
+}
+
+// compatible returns the project's versions matching any of the loaders and
+// game versions, newest first. Empty filters match everything.
+func (m *Mirror) compatible(projectID string, loaders, games []string) []Version {
+	out := []Version{}
+	for _, v := range m.versions[projectID] {
+		if matchesAny(v.Loaders, loaders) && matchesAny(v.GameVersions, games) {
+			out = append(out, v)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].DatePublished.After(out[j].DatePublished) })
+	return out
+}
+
+func matchesAny(have, want []string) bool {
+	if len(want) == 0 {
+		return true
+	}
+	for _, w := range want {
+		for _, h := range have {
+			if strings.EqualFold(h, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// search matches the query against mirrored slugs and titles.
+func (m *Mirror) search(query string) SearchResult {
+	query = strings.ToLower(strings.TrimSpace(query))
+	var res SearchResult
+	seen := map[string]bool{}
+	for _, p := range m.projects {
+		if seen[p.ID] {
+			continue
+		}
+		seen[p.ID] = true
+		if !strings.Contains(strings.ToLower(p.Slug), query) && !strings.Contains(strings.ToLower(p.Title), query) {
+			continue
+		}
+		res.Hits = append(res.Hits, struct {
+			ProjectID   string `json:"project_id"`
+			Slug        string `json:"slug"`
+			Title       string `json:"title"`
+			Description string `json:"description"`
+			IconURL     string `json:"icon_url"`
+			Downloads   int    `json:"downloads"`
+		}{ProjectID: p.ID, Slug: p.Slug, Title: p.Title, IconURL: p.IconURL})
+	}
+	sort.Slice(res.Hits, func(i, j int) bool { return res.Hits[i].Slug < res.Hits[j].Slug })
+	return res
+}
+
+// SetMirror makes the client answer every request from m. Offline clients
+// neither pace requests nor persist responses.
+func (c *Client) SetMirror(m *Mirror) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.http = &http.Client{Transport: m}
+	c.limiter = nil
+	c.store = nil
+	c.cache = make(map[string]cacheEntry)
+}
+
+// MirrorExport summarises an export-mirror run.
+type MirrorExport struct {
+	Projects []string
+	Versions int
+	Blobs    int
+	Bytes    int64
+}
+
+// ExportMirror writes the given projects, their versions and the files of
+// their newest keep versions into dir, merging with an existing mirror.
+// Required dependencies of exported files are exported as well.
+func ExportMirror(ctx context.Context, c *Client, dir string, slugs []string, keep int) (*MirrorExport, error) {
+	for _, sub := range []string{"tags", "projects", "blobs"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	manifest := MirrorManifest{Format: mirrorFormat}
+	if err := readJSON(filepath.Join(dir, mirrorManifest), &manifest); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read mirror manifest: %w", err)
+	}
+	tags, err := c.Loaders(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loaders: %w", err)
+	}
+	if err := writeJSON(filepath.Join(dir, "tags", "loader.json"), tags); err != nil {
+		return nil, err
+	}
+
+	out := &MirrorExport{}
+	done := map[string]bool{}
+	exported := map[string]bool{}
+	queue := append([]string(nil), slugs...)
+	for len(queue) > 0 {
+		slug := queue[0]
+		queue = queue[1:]
+		if done[strings.ToLower(slug)] {
+			continue
+		}
+		p, err := c.Project(ctx, slug)
+		if err != nil {
+			return nil, fmt.Errorf("project %s: %w", slug, err)
+		}
+		if exported[p.ID] {
+			continue
+		}
+		exported[p.ID] = true
+		done[strings.ToLower(slug)] = true
+		done[strings.ToLower(p.ID)] = true
+		vs, err := c.Versions(ctx, p.ID, "", "")
+		if err != nil {
+			return nil, fmt.Errorf("versions of %s: %w", p.Slug, err)
+		}
+		sort.SliceStable(vs, func(i, j int) bool { return vs[i].DatePublished.After(vs[j].DatePublished) })
+		for i := range vs {
+			if i >= keep {
+				break
+			}
+			for j := range vs[i].Files {
+				n, err := exportBlob(ctx, c, dir, &vs[i].Files[j])
+				if err != nil {
+					return nil, fmt.Errorf("%s %s: %w", p.Slug, vs[i].VersionNumber, err)
+				}
+				if n > 0 {
+					out.Blobs++
+					out.Bytes += n
+				}
+			}
+			for _, d := range vs[i].Dependencies {
+				if d.DependencyType == DependencyRequired && d.ProjectID != "" && !done[strings.ToLower(d.ProjectID)] {
+					queue = append(queue, d.ProjectID)
+				}
+			}
+		}
+		if err := writeJSON(filepath.Join(dir, "projects", p.ID+".json"), p); err != nil {
+			return nil, err
+		}
+		if err := writeJSON(filepath.Join(dir, "projects", p.ID+".versions.json"), vs); err != nil {
+			return nil, err
+		}
+		out.Projects = append(out.Projects, p.Slug)
+		out.Versions += len(vs)
+	}
+
+	seen := map[string]bool{}
+	for _, s := range manifest.Projects {
+		seen[s] = true
+	}
+	for _, s := range out.Projects {
+		if !seen[s] {
+			manifest.Projects = append(manifest.Projects, s)
+		}
+	}
+	sort.Strings(manifest.Projects)
+	manifest.Format = mirrorFormat
+	manifest.GeneratedAt = time.Now().UTC()
+	if err := writeJSON(filepath.Join(dir, mirrorManifest), manifest); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// exportBlob downloads f into the mirror unless it is already there and
+// returns the bytes written. Files without a sha512 get one computed.
+func exportBlob(ctx context.Context, c *Client, dir string, f *VersionFile) (int64, error) {
+	if d := f.Hashes["sha512"]; d != "" {
+		if _, err := os.Stat(filepath.Join(dir, "blobs", strings.ToLower(d))); err == nil {
+			return 0, nil
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("download %s: %s", f.Filename, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Verify(data); err != nil {
+		return 0, err
+	}
+	sum := sha512.Sum512(data)
+	d := hex.EncodeToString(sum[:])
+	if f.Hashes == nil {
+		f.Hashes = map[string]string{}
+	}
+	f.Hashes["sha512"] = d
+	path := filepath.Join(dir, "blobs", d)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
+
+func readJSON(path string, v any) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func writeJSON(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
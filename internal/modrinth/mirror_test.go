@@ -0,0 +1,144 @@
+package modrinth
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeModrinth serves a small Modrinth: sodium, which requires fabric-api.
+func fakeModrinth(t *testing.T) (http.RoundTripper, map[string][]byte) {
+	t.Helper()
+	jars := map[string][]byte{
+		"https://cdn.modrinth.com/data/AANobbMI/sodium-0.5.jar": []byte("sodium 0.5"),
+		"https://cdn.modrinth.com/data/AANobbMI/sodium-0.4.jar": []byte("sodium 0.4"),
+		"https://cdn.modrinth.com/data/P7dR8mSH/fabric-api.jar": []byte("fabric api"),
+	}
+	file := func(url string) VersionFile {
+		sum := sha512.Sum512(jars[url])
+		return VersionFile{URL: url, Filename: filepath.Base(url), Primary: true, Hashes: map[string]string{"sha512": hex.EncodeToString(sum[:])}}
+	}
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	projects := map[string]Project{
+		"sodium":   {ID: "AANobbMI", Slug: "sodium", Title: "Sodium", Updated: now},
+		"P7dR8mSH": {ID: "P7dR8mSH", Slug: "fabric-api", Title: "Fabric API", Updated: now},
+	}
+	versions := map[string][]Version{
+		"AANobbMI": {
+			{ID: "s05", ProjectID: "AANobbMI", VersionNumber: "0.5.0", VersionType: "release", DatePublished: now, GameVersions: []string{"1.20.1"}, Loaders: []string{"fabric"},
+				Files: []VersionFile{file("https://cdn.modrinth.com/data/AANobbMI/sodium-0.5.jar")}, Dependencies: []Dependency{{ProjectID: "P7dR8mSH", DependencyType: DependencyRequired}}},
+			{ID: "s04", ProjectID: "AANobbMI", VersionNumber: "0.4.0", VersionType: "release", DatePublished: now.Add(-24 * time.Hour), GameVersions: []string{"1.20.1"}, Loaders: []string{"fabric"},
+				Files: []VersionFile{file("https://cdn.modrinth.com/data/AANobbMI/sodium-0.4.jar")}},
+			{ID: "s03", ProjectID: "AANobbMI", VersionNumber: "0.3.0", VersionType: "release", DatePublished: now.Add(-48 * time.Hour), GameVersions: []string{"1.19.4"}, Loaders: []string{"quilt"},
+				Files: []VersionFile{{URL: "https://cdn.modrinth.com/data/AANobbMI/sodium-0.3.jar", Filename: "sodium-0.3.jar", Hashes: map[string]string{"sha512": "abc"}}}},
+		},
+		"P7dR8mSH": {
+			{ID: "f1", ProjectID: "P7dR8mSH", VersionNumber: "0.90.0", VersionType: "release", DatePublished: now, GameVersions: []string{"1.20.1"}, Loaders: []string{"fabric"},
+				Files: []VersionFile{file("https://cdn.modrinth.com/data/P7dR8mSH/fabric-api.jar")}},
+		},
+	}
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		var v any
+		switch p := strings.TrimPrefix(req.URL.Path, "/v2/"); {
+		case req.URL.Host == "cdn.modrinth.com":
+			b, ok := jars[req.URL.String()]
+			if !ok {
+				return &http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found", Body: io.NopCloser(strings.NewReader(""))}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(string(b)))}, nil
+		case p == "tag/loader":
+			v = []LoaderTag{{Name: "fabric"}, {Name: "quilt"}}
+		case strings.HasPrefix(p, "project/") && strings.HasSuffix(p, "/version"):
+			v = versions[strings.TrimSuffix(strings.TrimPrefix(p, "project/"), "/version")]
+		case strings.HasPrefix(p, "project/"):
+			proj, ok := projects[strings.TrimPrefix(p, "project/")]
+			if !ok {
+				return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader(`{}`)), Header: http.Header{}}, nil
+			}
+			v = proj
+		}
+		b, _ := json.Marshal(v)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(string(b))), Header: http.Header{}}, nil
+	})
+	return rt, jars
+}
+
+func TestExportMirrorServesOffline(t *testing.T) {
+	rt, jars := fakeModrinth(t)
+	dir := t.TempDir()
+	online := &Client{http: &http.Client{Transport: rt}}
+	res, err := ExportMirror(context.Background(), online, dir, []string{"sodium"}, 2)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	// fabric-api is pulled in as a required dependency; the two newest
+	// sodium versions and fabric-api have their files downloaded.
+	if len(res.Projects) != 2 || res.Versions != 4 || res.Blobs != 3 {
+		t.Fatalf("export = %+v", res)
+	}
+
+	m, err := OpenMirror(dir)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if got := m.Manifest().Projects; len(got) != 2 || got[0] != "fabric-api" || got[1] != "sodium" {
+		t.Fatalf("manifest projects = %v", got)
+	}
+	c := &Client{}
+	c.SetMirror(m)
+	ctx := context.Background()
+
+	p, err := c.Project(ctx, "AANobbMI")
+	if err != nil || p.Slug != "sodium" {
+		t.Fatalf("project = %+v, %v", p, err)
+	}
+	vs, err := c.Versions(ctx, "sodium", "1.20.1", "fabric")
+	if err != nil || len(vs) != 2 || vs[0].VersionNumber != "0.5.0" {
+		t.Fatalf("versions = %+v, %v", vs, err)
+	}
+	old := vs[1].Files[0].Hashes["sha512"]
+	byHash, err := c.VersionsByHashes(ctx, []string{old}, "sha512")
+	if err != nil || byHash[old].ID != "s04" {
+		t.Fatalf("by hash = %+v, %v", byHash, err)
+	}
+	latest, err := c.LatestVersionsByHashes(ctx, []string{old}, "sha512", []string{"fabric"}, []string{"1.20.1"})
+	if err != nil || latest[old].ID != "s05" {
+		t.Fatalf("latest = %+v, %v", latest, err)
+	}
+	proj, slug, err := c.Resolve(ctx, "Fabric API")
+	if err != nil || slug != "fabric-api" || proj.ID != "P7dR8mSH" {
+		t.Fatalf("resolve = %+v, %q, %v", proj, slug, err)
+	}
+	tags, err := c.Loaders(ctx)
+	if err != nil || len(tags) != 2 {
+		t.Fatalf("loaders = %+v, %v", tags, err)
+	}
+	if _, err := c.Project(ctx, "lithium"); err == nil {
+		t.Fatalf("expected unmirrored project to fail")
+	}
+
+	dl := &http.Client{Transport: m}
+	resp, err := dl.Get(vs[0].Files[0].URL)
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != string(jars[vs[0].Files[0].URL]) {
+		t.Fatalf("blob = %q", b)
+	}
+	if _, err := dl.Get("https://example.com/"); err == nil {
+		t.Fatalf("expected other hosts to fail without Next")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "blobs", "abc")); !os.IsNotExist(err) {
+		t.Fatalf("old version file should not be exported: %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+// Package mrpack reads and writes Modrinth modpacks (.mrpack): a zip holding
+// modrinth.index.json plus override folders copied over the instance.
+package mrpack
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// IndexName is the index file at the root of a pack.
+const IndexName = "modrinth.index.json"
+
+// Override folders; server- and client-overrides apply after overrides on
+// their side only.
+const (
+	OverridesDir       = "overrides/"
+	ServerOverridesDir = "server-overrides/"
+	ClientOverridesDir = "client-overrides/"
+)
+
+// Env support values for a file on one side.
+const (
+	EnvRequired    = "required"
+	EnvOptional    = "optional"
+	EnvUnsupported = "unsupported"
+)
+
+// Dependency keys naming the game and loader versions a pack targets.
+const (
+	DependencyMinecraft = "minecraft"
+)
+
+// loaderDependencies maps index dependency keys to ModSentinel loaders.
+var loaderDependencies = map[string]string{
+	"fabric-loader": "fabric",
+	"quilt-loader":  "quilt",
+	"forge":         "forge",
+	"neoforge":      "neoforge",
+}
+
+// DependencyFor returns the index dependency key of a loader, or "".
+func DependencyFor(loader string) string {
+	for k, v := range loaderDependencies {
+		if v == strings.ToLower(loader) {
+			return k
+		}
+	}
+	return ""
+}
+
+// AllowedDownloadHosts are the hosts the format permits in downloads.
+var AllowedDownloadHosts = []string{"cdn.modrinth.com", "github.com", "raw.githubusercontent.com", "gitlab.com"}
+
+// Index is modrinth.index.json.
+type Index struct {
+	FormatVersion int               `json:"formatVersion"`
+	Game          string            `json:"game"`
+	VersionID     string            `json:"versionId"`
+	Name          string            `json:"name"`
+	Summary       string            `json:"summary,omitempty"`
+	Files         []File            `json:"files"`
+	Dependencies  map[string]string `json:"dependencies"`
+}
+
+// File is a file the pack downloads into the instance.
+type File struct {
+	Path      string            `json:"path"`
+	Hashes    map[string]string `json:"hashes"`
+	Env       *Env              `json:"env,omitempty"`
+	Downloads []string          `json:"downloads"`
+	FileSize  int64             `json:"fileSize"`
+}
+
+// Env states whether a file is needed on the client and the server.
+type Env struct {
+	Client string `json:"client"`
+	Server string `json:"server"`
+}
+
+// OnServer reports whether the file belongs on a server. Files without env
+// data are needed on both sides.
+func (f File) OnServer() bool {
+	return f.Env == nil || f.Env.Server != EnvUnsupported
+}
+
+// OnClient reports whether the file belongs on a client.
+func (f File) OnClient() bool {
+	return f.Env == nil || f.Env.Client != EnvUnsupported
+}
+
+// Pack is a parsed modpack. Overrides map instance-relative paths to file
+// contents, per override folder.
+type Pack struct {
+	Index           Index
+	Overrides       map[string][]byte
+	ServerOverrides map[string][]byte
+	ClientOverrides map[string][]byte
+}
+
+// Loader returns the ModSentinel loader the pack targets and its version,
+// or empty strings for vanilla packs.
+func (p *Pack) Loader() (string, string) {
+	keys := make([]string, 0, len(p.Index.Dependencies))
+	for k := range p.Index.Dependencies {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if l, ok := loaderDependencies[k]; ok {
+			return l, p.Index.Dependencies[k]
+		}
+	}
+	return "", ""
+}
+
+// GameVersion returns the Minecraft version the pack targets.
+func (p *Pack) GameVersion() string {
+	return p.Index.Dependencies[DependencyMinecraft]
+}
+
+// ServerOverrideFiles returns the overrides a server receives, with
+// server-overrides taking precedence.
+func (p *Pack) ServerOverrideFiles() map[string][]byte {
+	out := make(map[string][]byte, len(p.Overrides)+len(p.ServerOverrides))
+	for k, v := range p.Overrides {
+		out[k] = v
+	}
+	for k, v := range p.ServerOverrides {
+		out[k] = v
+	}
+	return out
+}
+
+// Read parses a pack, rejecting unsafe paths and files without a sha1 and
+// sha512 as the format requires.
+func Read(data []byte) (*Pack, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("open pack: %w", err)
+	}
+	p := &Pack{Overrides: map[string][]byte{}, ServerOverrides: map[string][]byte{}, ClientOverrides: map[string][]byte{}}
+	found := false
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+		if zf.Name == IndexName {
+			b, err := readZipFile(zf)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(b, &p.Index); err != nil {
+				return nil, fmt.Errorf("parse %s: %w", IndexName, err)
+			}
+			found = true
+			continue
+		}
+		for dir, dst := range map[string]map[string][]byte{OverridesDir: p.Overrides, ServerOverridesDir: p.ServerOverrides, ClientOverridesDir: p.ClientOverrides} {
+			rel, ok := strings.CutPrefix(zf.Name, dir)
+			if !ok {
+				continue
+			}
+			if err := CheckPath(rel); err != nil {
+				return nil, fmt.Errorf("override %s: %w", zf.Name, err)
+			}
+			b, err := readZipFile(zf)
+			if err != nil {
+				return nil, err
+			}
+			dst[rel] = b
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("missing %s", IndexName)
+	}
+	if p.Index.FormatVersion != 1 {
+		return nil, fmt.Errorf("unsupported format version %d", p.Index.FormatVersion)
+	}
+	if p.Index.Game != "minecraft" {
+		return nil, fmt.Errorf("unsupported game %q", p.Index.Game)
+	}
+	for _, f := range p.Index.Files {
+		if err := CheckPath(f.Path); err != nil {
+			return nil, fmt.Errorf("file %s: %w", f.Path, err)
+		}
+		if f.Hashes["sha1"] == "" || f.Hashes["sha512"] == "" {
+			return nil, fmt.Errorf("file %s: missing sha1 or sha512", f.Path)
+		}
+		if len(f.Downloads) == 0 {
+			return nil, fmt.Errorf("file %s: no downloads", f.Path)
+		}
+	}
+	return p, nil
+}
+
+// Write encodes p as a pack. The index must be valid per Read; overrides
+// are written in path order so equal packs produce equal archives.
+func Write(w io.Writer, p *Pack) error {
+	for _, f := range p.Index.Files {
+		if err := CheckPath(f.Path); err != nil {
+			return fmt.Errorf("file %s: %w", f.Path, err)
+		}
+		if f.Hashes["sha1"] == "" || f.Hashes["sha512"] == "" {
+			return fmt.Errorf("file %s: missing sha1 or sha512", f.Path)
+		}
+	}
+	zw := zip.NewWriter(w)
+	idx, err := json.MarshalIndent(p.Index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeZipFile(zw, IndexName, idx); err != nil {
+		return err
+	}
+	for _, o := range []struct {
+		dir   string
+		files map[string][]byte
+	}{{OverridesDir, p.Overrides}, {ServerOverridesDir, p.ServerOverrides}, {ClientOverridesDir, p.ClientOverrides}} {
+		names := make([]string, 0, len(o.files))
+		for name := range o.files {
+			if err := CheckPath(name); err != nil {
+				return fmt.Errorf("override %s: %w", name, err)
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := writeZipFile(zw, o.dir+name, o.files[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(data)
+	return err
+}
+
+// CheckPath rejects absolute paths and paths escaping the instance.
+func CheckPath(p string) error {
+	if p == "" || strings.Contains(p, "\\") || strings.HasPrefix(p, "/") {
+		return errors.New("invalid path")
+	}
+	clean := path.Clean(p)
+	if clean != p || clean == ".." || strings.HasPrefix(clean, "../") {
+		return errors.New("path escapes instance")
+	}
+	return nil
+}
+
+// maxEntrySize bounds a single decompressed pack entry.
+const maxEntrySize = 256 << 20
+
+func readZipFile(zf *zip.File) ([]byte, error) {
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, maxEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxEntrySize {
+		return nil, fmt.Errorf("%s: entry too large", zf.Name)
+	}
+	return b, nil
+}
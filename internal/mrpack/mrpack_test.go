@@ -0,0 +1,113 @@
+package mrpack
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func buildPack(t *testing.T, idx Index, extra map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create(IndexName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewEncoder(w).Encode(idx); err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range extra {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadPack(t *testing.T) {
+	idx := Index{
+		FormatVersion: 1, Game: "minecraft", VersionID: "1.0", Name: "Pack",
+		Files: []File{
+			{Path: "mods/a.jar", Hashes: map[string]string{"sha1": "1", "sha512": "5"}, Downloads: []string{"https://cdn.modrinth.com/a.jar"}},
+			{Path: "mods/client.jar", Hashes: map[string]string{"sha1": "1", "sha512": "5"}, Downloads: []string{"https://cdn.modrinth.com/c.jar"}, Env: &Env{Client: EnvRequired, Server: EnvUnsupported}},
+		},
+		Dependencies: map[string]string{"minecraft": "1.20.1", "fabric-loader": "0.15.11"},
+	}
+	p, err := Read(buildPack(t, idx, map[string]string{
+		"overrides/config/a.toml":        "base",
+		"server-overrides/config/a.toml": "server",
+		"client-overrides/options.txt":   "client",
+	}))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if l, v := p.Loader(); l != "fabric" || v != "0.15.11" {
+		t.Fatalf("loader = %q %q", l, v)
+	}
+	if p.GameVersion() != "1.20.1" {
+		t.Fatalf("game version = %q", p.GameVersion())
+	}
+	if !p.Index.Files[0].OnServer() || p.Index.Files[1].OnServer() {
+		t.Fatalf("env not honoured")
+	}
+	ov := p.ServerOverrideFiles()
+	if len(ov) != 1 || string(ov["config/a.toml"]) != "server" {
+		t.Fatalf("server overrides = %v", ov)
+	}
+}
+
+func TestReadPackRejectsUnsafe(t *testing.T) {
+	base := Index{FormatVersion: 1, Game: "minecraft", Dependencies: map[string]string{"minecraft": "1.20.1"}}
+	cases := map[string][]byte{
+		"traversal": buildPack(t, Index{FormatVersion: 1, Game: "minecraft", Files: []File{{Path: "../evil.jar", Hashes: map[string]string{"sha1": "1", "sha512": "5"}, Downloads: []string{"https://cdn.modrinth.com/x"}}}}, nil),
+		"absolute":  buildPack(t, Index{FormatVersion: 1, Game: "minecraft", Files: []File{{Path: "/etc/passwd", Hashes: map[string]string{"sha1": "1", "sha512": "5"}, Downloads: []string{"https://cdn.modrinth.com/x"}}}}, nil),
+		"no hashes": buildPack(t, Index{FormatVersion: 1, Game: "minecraft", Files: []File{{Path: "mods/a.jar", Downloads: []string{"https://cdn.modrinth.com/x"}}}}, nil),
+		"override":  buildPack(t, base, map[string]string{"overrides/../../x": "x"}),
+		"game":      buildPack(t, Index{FormatVersion: 1, Game: "terraria"}, nil),
+	}
+	for name, data := range cases {
+		if _, err := Read(data); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	in := &Pack{
+		Index: Index{
+			FormatVersion: 1, Game: "minecraft", VersionID: "2024.05.01", Name: "Exported",
+			Files:        []File{{Path: "mods/a.jar", Hashes: map[string]string{"sha1": "1", "sha512": "5"}, Downloads: []string{"https://cdn.modrinth.com/a.jar"}, FileSize: 3, Env: &Env{Client: EnvRequired, Server: EnvOptional}}},
+			Dependencies: map[string]string{"minecraft": "1.20.1", "quilt-loader": "0.26.0"},
+		},
+		Overrides: map[string][]byte{"config/a.toml": []byte("a")},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, in); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	out, err := Read(buf.Bytes())
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if l, v := out.Loader(); l != "quilt" || v != "0.26.0" {
+		t.Fatalf("loader = %q %q", l, v)
+	}
+	if len(out.Index.Files) != 1 || out.Index.Files[0].Env.Server != EnvOptional || out.Index.Files[0].FileSize != 3 {
+		t.Fatalf("files = %+v", out.Index.Files)
+	}
+	if string(out.Overrides["config/a.toml"]) != "a" {
+		t.Fatalf("overrides = %v", out.Overrides)
+	}
+
+	in.Index.Files[0].Hashes = map[string]string{"sha512": "5"}
+	if err := Write(&bytes.Buffer{}, in); err == nil {
+		t.Fatalf("expected missing sha1 to be rejected")
+	}
+}
@@ -0,0 +1,371 @@
+// Package packwiz reads and writes packwiz modpacks: pack.toml, the index it
+// points at, and a .pw.toml metafile per mod describing where the jar is
+// downloaded from and how packwiz updates it.
+package packwiz
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"modsentinel/internal/mrpack"
+)
+
+// PackFile is the pack definition at the root of a pack.
+const PackFile = "pack.toml"
+
+// IndexName is where Write puts the index.
+const IndexName = "index.toml"
+
+// PackFormat is the format version Write declares.
+const PackFormat = "packwiz:1.1.0"
+
+// MetafileSuffix marks mod metafiles.
+const MetafileSuffix = ".pw.toml"
+
+// Sides a mod is installed on.
+const (
+	SideBoth   = "both"
+	SideClient = "client"
+	SideServer = "server"
+)
+
+// DownloadModeCurseForge leaves the download URL to the CurseForge API.
+const DownloadModeCurseForge = "metadata:curseforge"
+
+// VersionMinecraft is the [versions] key of the game version.
+const VersionMinecraft = "minecraft"
+
+// loaderKeys are the [versions] keys naming a loader, which match
+// ModSentinel's loader names.
+var loaderKeys = []string{"fabric", "forge", "neoforge", "quilt"}
+
+// maxFiles bounds the entries of an index.
+const maxFiles = 10000
+
+// Pack is pack.toml.
+type Pack struct {
+	Name        string            `toml:"name"`
+	Author      string            `toml:"author,omitempty"`
+	Version     string            `toml:"version,omitempty"`
+	Description string            `toml:"description,omitempty"`
+	PackFormat  string            `toml:"pack-format"`
+	Index       IndexRef          `toml:"index"`
+	Versions    map[string]string `toml:"versions"`
+}
+
+// IndexRef points pack.toml at its index.
+type IndexRef struct {
+	File       string `toml:"file"`
+	HashFormat string `toml:"hash-format"`
+	Hash       string `toml:"hash"`
+}
+
+// Index lists the files of a pack with their hashes.
+type Index struct {
+	HashFormat string      `toml:"hash-format"`
+	Files      []IndexFile `toml:"files"`
+}
+
+// IndexFile is an index entry; metafiles describe mods rather than being
+// copied into the instance.
+type IndexFile struct {
+	File       string `toml:"file"`
+	Hash       string `toml:"hash"`
+	HashFormat string `toml:"hash-format,omitempty"`
+	Alias      string `toml:"alias,omitempty"`
+	Metafile   bool   `toml:"metafile,omitempty"`
+	Preserve   bool   `toml:"preserve,omitempty"`
+}
+
+// Mod is a .pw.toml metafile.
+type Mod struct {
+	Name     string   `toml:"name"`
+	Filename string   `toml:"filename"`
+	Side     string   `toml:"side,omitempty"`
+	Download Download `toml:"download"`
+	Update   *Update  `toml:"update,omitempty"`
+}
+
+// Download says where a mod's jar comes from and its hash.
+type Download struct {
+	URL        string `toml:"url,omitempty"`
+	HashFormat string `toml:"hash-format"`
+	Hash       string `toml:"hash"`
+	Mode       string `toml:"mode,omitempty"`
+}
+
+// Update holds the metadata packwiz uses to update a mod.
+type Update struct {
+	Modrinth   *ModrinthUpdate   `toml:"modrinth,omitempty"`
+	CurseForge *CurseForgeUpdate `toml:"curseforge,omitempty"`
+}
+
+// ModrinthUpdate names a Modrinth project and version by ID.
+type ModrinthUpdate struct {
+	ModID   string `toml:"mod-id"`
+	Version string `toml:"version"`
+}
+
+// CurseForgeUpdate names a CurseForge project and file by ID.
+type CurseForgeUpdate struct {
+	FileID    int `toml:"file-id"`
+	ProjectID int `toml:"project-id"`
+}
+
+// OnServer reports whether the mod is installed on servers.
+func (m Mod) OnServer() bool { return m.Side != SideClient }
+
+// Tree is a parsed pack. Mods are keyed by metafile path and Files holds
+// the other indexed files, both relative to the pack root.
+type Tree struct {
+	Pack  Pack
+	Mods  map[string]Mod
+	Files map[string][]byte
+}
+
+// GameVersion returns the Minecraft version the pack targets.
+func (t *Tree) GameVersion() string { return t.Pack.Versions[VersionMinecraft] }
+
+// Loader returns the loader the pack targets and its version, or empty
+// strings for vanilla packs.
+func (t *Tree) Loader() (string, string) {
+	for _, k := range loaderKeys {
+		if v, ok := t.Pack.Versions[k]; ok {
+			return k, v
+		}
+	}
+	return "", ""
+}
+
+// Getter returns a pack file by its path relative to the pack root.
+type Getter func(name string) ([]byte, error)
+
+// Read parses a pack through get, verifying the index and every indexed
+// file against their hashes.
+func Read(get Getter) (*Tree, error) {
+	t := &Tree{Mods: map[string]Mod{}, Files: map[string][]byte{}}
+	data, err := get(PackFile)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", PackFile, err)
+	}
+	if _, err := toml.Decode(string(data), &t.Pack); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", PackFile, err)
+	}
+	if t.Pack.PackFormat != "" && !strings.HasPrefix(t.Pack.PackFormat, "packwiz:") {
+		return nil, fmt.Errorf("unsupported pack format %q", t.Pack.PackFormat)
+	}
+	if err := mrpack.CheckPath(t.Pack.Index.File); err != nil {
+		return nil, fmt.Errorf("index %q: %w", t.Pack.Index.File, err)
+	}
+	data, err = get(t.Pack.Index.File)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", t.Pack.Index.File, err)
+	}
+	if err := verify(t.Pack.Index.HashFormat, t.Pack.Index.Hash, data); err != nil {
+		return nil, fmt.Errorf("%s: %w", t.Pack.Index.File, err)
+	}
+	var idx Index
+	if _, err := toml.Decode(string(data), &idx); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", t.Pack.Index.File, err)
+	}
+	if len(idx.Files) > maxFiles {
+		return nil, fmt.Errorf("index lists %d files, more than %d", len(idx.Files), maxFiles)
+	}
+	// Index paths are relative to the index's folder.
+	dir := path.Dir(t.Pack.Index.File)
+	for _, f := range idx.Files {
+		name := path.Join(dir, f.File)
+		if err := mrpack.CheckPath(f.File); err != nil || mrpack.CheckPath(name) != nil {
+			return nil, fmt.Errorf("file %q: unsafe path", f.File)
+		}
+		data, err := get(name)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+		format := f.HashFormat
+		if format == "" {
+			format = idx.HashFormat
+		}
+		if err := verify(format, f.Hash, data); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if !f.Metafile && !strings.HasSuffix(name, MetafileSuffix) {
+			t.Files[name] = data
+			continue
+		}
+		var m Mod
+		if _, err := toml.Decode(string(data), &m); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", name, err)
+		}
+		if m.Filename == "" || path.Base(m.Filename) != m.Filename {
+			return nil, fmt.Errorf("%s: invalid filename %q", name, m.Filename)
+		}
+		t.Mods[name] = m
+	}
+	return t, nil
+}
+
+// ReadZip parses a zipped pack. The pack may sit in a single top-level
+// folder, as in archives of a git repository.
+func ReadZip(data []byte) (*Tree, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("open zip: %w", err)
+	}
+	files := map[string]*zip.File{}
+	root := ""
+	found := false
+	for _, zf := range zr.File {
+		files[zf.Name] = zf
+		if path.Base(zf.Name) != PackFile {
+			continue
+		}
+		dir := strings.TrimSuffix(zf.Name, PackFile)
+		if !found || len(dir) < len(root) {
+			root, found = dir, true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("missing %s", PackFile)
+	}
+	return Read(func(name string) ([]byte, error) {
+		zf, ok := files[root+name]
+		if !ok {
+			return nil, errors.New("not in archive")
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(io.LimitReader(rc, MaxFileSize))
+	})
+}
+
+// MaxFileSize bounds a single pack file read from an archive.
+const MaxFileSize = 16 << 20
+
+// Write encodes t as pack files keyed by path, indexing every mod and file
+// with sha256 as packwiz does.
+func Write(t *Tree) (map[string][]byte, error) {
+	out := make(map[string][]byte, len(t.Mods)+len(t.Files)+2)
+	idx := Index{HashFormat: "sha256"}
+	for name, m := range t.Mods {
+		if err := mrpack.CheckPath(name); err != nil {
+			return nil, fmt.Errorf("mod %s: %w", name, err)
+		}
+		data, err := encode(m)
+		if err != nil {
+			return nil, err
+		}
+		out[name] = data
+		idx.Files = append(idx.Files, IndexFile{File: name, Hash: hexHash(sha256.New(), data), Metafile: true})
+	}
+	for name, data := range t.Files {
+		if err := mrpack.CheckPath(name); err != nil {
+			return nil, fmt.Errorf("file %s: %w", name, err)
+		}
+		out[name] = data
+		idx.Files = append(idx.Files, IndexFile{File: name, Hash: hexHash(sha256.New(), data)})
+	}
+	sort.Slice(idx.Files, func(i, j int) bool { return idx.Files[i].File < idx.Files[j].File })
+	data, err := encode(idx)
+	if err != nil {
+		return nil, err
+	}
+	out[IndexName] = data
+	p := t.Pack
+	if p.PackFormat == "" {
+		p.PackFormat = PackFormat
+	}
+	p.Index = IndexRef{File: IndexName, HashFormat: "sha256", Hash: hexHash(sha256.New(), data)}
+	if out[PackFile], err = encode(p); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// WriteZip archives pack files in path order.
+func WriteZip(w io.Writer, files map[string][]byte) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	zw := zip.NewWriter(w)
+	for _, name := range names {
+		fw, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// Side returns the packwiz side of a mod from Modrinth's client and server
+// support: mods unsupported on one side are installed on the other only.
+func Side(client, server string) string {
+	switch {
+	case client == "unsupported" && server != "unsupported":
+		return SideServer
+	case server == "unsupported" && client != "unsupported":
+		return SideClient
+	}
+	return SideBoth
+}
+
+func encode(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// newHash returns the hash of a packwiz hash format.
+func newHash(format string) (hash.Hash, error) {
+	switch strings.ToLower(format) {
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "md5":
+		return md5.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported hash format %q", format)
+}
+
+func verify(format, want string, data []byte) error {
+	h, err := newHash(format)
+	if err != nil {
+		return err
+	}
+	if got := hexHash(h, data); !strings.EqualFold(got, want) {
+		return fmt.Errorf("%s mismatch: got %s, want %s", format, got, want)
+	}
+	return nil
+}
+
+func hexHash(h hash.Hash, data []byte) string {
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
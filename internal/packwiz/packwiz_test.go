@@ -0,0 +1,100 @@
+package packwiz
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func samplePack() *Tree {
+	return &Tree{
+		Pack: Pack{Name: "Survival", Versions: map[string]string{"minecraft": "1.20.1", "fabric": "0.15.11"}},
+		Mods: map[string]Mod{
+			"mods/sodium.pw.toml": {
+				Name: "Sodium", Filename: "sodium-0.5.8.jar", Side: SideClient,
+				Download: Download{URL: "https://cdn.modrinth.com/data/AANobbMI/sodium-0.5.8.jar", HashFormat: "sha512", Hash: "abc"},
+				Update:   &Update{Modrinth: &ModrinthUpdate{ModID: "AANobbMI", Version: "v1"}},
+			},
+			"mods/jei.pw.toml": {
+				Name: "JEI", Filename: "jei-15.2.jar",
+				Download: Download{Mode: DownloadModeCurseForge, HashFormat: "sha1", Hash: "def"},
+				Update:   &Update{CurseForge: &CurseForgeUpdate{ProjectID: 238222, FileID: 4712868}},
+			},
+		},
+		Files: map[string][]byte{"config/sodium.json": []byte("{}")},
+	}
+}
+
+// zipFiles archives files under prefix, as git hosts do.
+func zipFiles(t *testing.T, prefix string, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(prefix + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriteReadRoundTrip(t *testing.T) {
+	files, err := Write(samplePack())
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if !strings.Contains(string(files[PackFile]), `pack-format = "packwiz:1.1.0"`) {
+		t.Fatalf("pack.toml = %s", files[PackFile])
+	}
+	tree, err := ReadZip(zipFiles(t, "survival-main/", files))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if tree.GameVersion() != "1.20.1" {
+		t.Fatalf("game version = %q", tree.GameVersion())
+	}
+	if l, v := tree.Loader(); l != "fabric" || v != "0.15.11" {
+		t.Fatalf("loader = %q %q", l, v)
+	}
+	sodium := tree.Mods["mods/sodium.pw.toml"]
+	if sodium.Update == nil || sodium.Update.Modrinth.Version != "v1" || sodium.OnServer() {
+		t.Fatalf("sodium = %+v", sodium)
+	}
+	jei := tree.Mods["mods/jei.pw.toml"]
+	if jei.Update == nil || jei.Update.CurseForge.FileID != 4712868 || jei.Download.Mode != DownloadModeCurseForge {
+		t.Fatalf("jei = %+v", jei)
+	}
+	if string(tree.Files["config/sodium.json"]) != "{}" {
+		t.Fatalf("files = %v", tree.Files)
+	}
+}
+
+func TestReadRejectsTamperedFiles(t *testing.T) {
+	files, err := Write(samplePack())
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	files["mods/jei.pw.toml"] = append(files["mods/jei.pw.toml"], '\n')
+	if _, err := ReadZip(zipFiles(t, "", files)); err == nil || !strings.Contains(err.Error(), "mismatch") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestSide(t *testing.T) {
+	for _, c := range []struct{ client, server, want string }{
+		{"required", "unsupported", SideClient},
+		{"unsupported", "required", SideServer},
+		{"optional", "required", SideBoth},
+		{"", "", SideBoth},
+	} {
+		if got := Side(c.client, c.server); got != c.want {
+			t.Fatalf("Side(%q, %q) = %q, want %q", c.client, c.server, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package pterodactyl
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"modsentinel/internal/backend"
+)
+
+// Backend is the backend.ServerBackend for the stored panel credentials.
+type Backend struct{}
+
+var (
+	_ backend.ServerBackend   = Backend{}
+	_ backend.PowerController = Backend{}
+)
+
+// maxPages bounds server list pagination.
+const maxPages = 50
+
+// stopPollInterval is how often StopServer checks that a server exited.
+var stopPollInterval = 2 * time.Second
+
+type serverObject struct {
+	Attributes struct {
+		Identifier string `json:"identifier"`
+		Name       string `json:"name"`
+	} `json:"attributes"`
+}
+
+func (o serverObject) server() backend.Server {
+	return backend.Server{ID: o.Attributes.Identifier, Name: o.Attributes.Name}
+}
+
+// ListServers returns every server the API key can access.
+func (Backend) ListServers(ctx context.Context) ([]backend.Server, error) {
+	c, err := getCreds()
+	if err != nil {
+		return nil, err
+	}
+	var out []backend.Server
+	for page := 1; page <= maxPages; page++ {
+		body, err := do(ctx, c, http.MethodGet, "/api/client", url.Values{"page": {strconv.Itoa(page)}}, nil)
+		if err != nil {
+			return nil, err
+		}
+		var list struct {
+			Data []serverObject `json:"data"`
+			Meta struct {
+				Pagination struct {
+					TotalPages int `json:"total_pages"`
+				} `json:"pagination"`
+			} `json:"meta"`
+		}
+		if err := json.Unmarshal(body, &list); err != nil {
+			return nil, err
+		}
+		for _, o := range list.Data {
+			out = append(out, o.server())
+		}
+		if page >= list.Meta.Pagination.TotalPages {
+			break
+		}
+	}
+	return out, nil
+}
+
+// GetServer fetches a single server by identifier.
+func (Backend) GetServer(ctx context.Context, serverID string) (*backend.Server, error) {
+	c, err := getCreds()
+	if err != nil {
+		return nil, err
+	}
+	body, err := do(ctx, c, http.MethodGet, serverPath(serverID, ""), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var o serverObject
+	if err := json.Unmarshal(body, &o); err != nil {
+		return nil, err
+	}
+	s := o.server()
+	return &s, nil
+}
+
+// ListPath lists a directory of the server.
+func (Backend) ListPath(ctx context.Context, serverID, dir string) ([]backend.FileEntry, error) {
+	c, err := getCreds()
+	if err != nil {
+		return nil, err
+	}
+	body, err := do(ctx, c, http.MethodGet, serverPath(serverID, "/files/list"), url.Values{"directory": {filePath(dir)}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Data []struct {
+			Attributes struct {
+				Name       string    `json:"name"`
+				IsFile     bool      `json:"is_file"`
+				Size       int64     `json:"size"`
+				ModifiedAt time.Time `json:"modified_at"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+	files := make([]backend.FileEntry, 0, len(list.Data))
+	for _, f := range list.Data {
+		a := f.Attributes
+		files = append(files, backend.FileEntry{Name: a.Name, IsDir: !a.IsFile, Size: a.Size, ModTime: a.ModifiedAt})
+	}
+	return files, nil
+}
+
+// FetchFile downloads a file through a signed URL, which unlike the
+// contents endpoint returns binary files intact.
+func (Backend) FetchFile(ctx context.Context, serverID, p string) ([]byte, error) {
+	c, err := getCreds()
+	if err != nil {
+		return nil, err
+	}
+	body, err := do(ctx, c, http.MethodGet, serverPath(serverID, "/files/download"), url.Values{"file": {filePath(p)}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var signed struct {
+		Attributes struct {
+			URL string `json:"url"`
+		} `json:"attributes"`
+	}
+	if err := json.Unmarshal(body, &signed); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, signed.Attributes.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return send(httpClient, req)
+}
+
+// PutFile writes data to a file, creating or replacing it.
+func (Backend) PutFile(ctx context.Context, serverID, p string, data []byte) error {
+	c, err := getCreds()
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	_, err = do(ctx, c, http.MethodPost, serverPath(serverID, "/files/write"), url.Values{"file": {filePath(p)}}, data, "application/octet-stream")
+	return err
+}
+
+// DeleteFile removes a file.
+func (Backend) DeleteFile(ctx context.Context, serverID, p string) error {
+	c, err := getCreds()
+	if err != nil {
+		return err
+	}
+	req, _ := json.Marshal(map[string]any{"root": path.Dir(filePath(p)), "files": []string{path.Base(p)}})
+	_, err = do(ctx, c, http.MethodPost, serverPath(serverID, "/files/delete"), nil, req)
+	return err
+}
+
+// ServerStatus reports whether the server's process is running.
+func (Backend) ServerStatus(ctx context.Context, serverID string) (bool, error) {
+	state, err := currentState(ctx, serverID)
+	return state == "running", err
+}
+
+func currentState(ctx context.Context, serverID string) (string, error) {
+	c, err := getCreds()
+	if err != nil {
+		return "", err
+	}
+	body, err := do(ctx, c, http.MethodGet, serverPath(serverID, "/resources"), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	var res struct {
+		Attributes struct {
+			CurrentState string `json:"current_state"`
+		} `json:"attributes"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", err
+	}
+	return res.Attributes.CurrentState, nil
+}
+
+// StopServer sends the stop signal and waits for the server to go offline,
+// as the panel returns before the process exits.
+func (Backend) StopServer(ctx context.Context, serverID string) error {
+	if err := power(ctx, serverID, "stop"); err != nil {
+		return err
+	}
+	for {
+		state, err := currentState(ctx, serverID)
+		if err != nil {
+			return err
+		}
+		if state == "offline" {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(stopPollInterval):
+		}
+	}
+}
+
+// StartServer sends the start signal.
+func (Backend) StartServer(ctx context.Context, serverID string) error {
+	return power(ctx, serverID, "start")
+}
+
+// RestartServer sends the restart signal.
+func (Backend) RestartServer(ctx context.Context, serverID string) error {
+	return power(ctx, serverID, "restart")
+}
+
+func power(ctx context.Context, serverID, signal string) error {
+	c, err := getCreds()
+	if err != nil {
+		return err
+	}
+	req, _ := json.Marshal(map[string]string{"signal": signal})
+	_, err = do(ctx, c, http.MethodPost, serverPath(serverID, "/power"), nil, req)
+	return err
+}
@@ -0,0 +1,151 @@
+package pterodactyl
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+
+	"modsentinel/internal/backend"
+	dbpkg "modsentinel/internal/db"
+	"modsentinel/internal/secrets"
+	"modsentinel/internal/settings"
+)
+
+// fakePanel serves the client API endpoints Backend uses for one server.
+type fakePanel struct {
+	files map[string][]byte
+	state string
+}
+
+func (p *fakePanel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer ptlc_key" && r.URL.Path != "/signed" {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"errors":[{"code":"AuthenticationException","status":"401","detail":"Unauthenticated."}]}`)
+		return
+	}
+	q := r.URL.Query()
+	switch r.URL.Path {
+	case "/api/client":
+		if q.Get("page") == "1" {
+			io.WriteString(w, `{"data":[{"attributes":{"identifier":"1a2b3c4d","name":"Survival"}}],"meta":{"pagination":{"total_pages":2}}}`)
+		} else {
+			io.WriteString(w, `{"data":[{"attributes":{"identifier":"5e6f7a8b","name":"Creative"}}],"meta":{"pagination":{"total_pages":2}}}`)
+		}
+	case "/api/client/servers/1a2b3c4d/files/list":
+		type attrs struct {
+			Name   string `json:"name"`
+			IsFile bool   `json:"is_file"`
+		}
+		var data []map[string]attrs
+		dir := strings.TrimSuffix(q.Get("directory"), "/") + "/"
+		for name := range p.files {
+			if strings.HasPrefix(name, dir) {
+				data = append(data, map[string]attrs{"attributes": {Name: strings.TrimPrefix(name, dir), IsFile: true}})
+			}
+		}
+		if data == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	case "/api/client/servers/1a2b3c4d/files/write":
+		body, _ := io.ReadAll(r.Body)
+		p.files[q.Get("file")] = body
+		w.WriteHeader(http.StatusNoContent)
+	case "/api/client/servers/1a2b3c4d/files/download":
+		io.WriteString(w, `{"attributes":{"url":"http://`+r.Host+`/signed?file=`+q.Get("file")+`"}}`)
+	case "/signed":
+		w.Write(p.files[q.Get("file")])
+	case "/api/client/servers/1a2b3c4d/files/delete":
+		var req struct {
+			Root  string   `json:"root"`
+			Files []string `json:"files"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		for _, f := range req.Files {
+			delete(p.files, req.Root+"/"+f)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "/api/client/servers/1a2b3c4d/resources":
+		io.WriteString(w, `{"attributes":{"current_state":"`+p.state+`"}}`)
+	case "/api/client/servers/1a2b3c4d/power":
+		var req struct{ Signal string }
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Signal == "stop" {
+			p.state = "offline"
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func setup(t *testing.T, base string) {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if err := dbpkg.Init(db); err != nil {
+		t.Fatal(err)
+	}
+	Init(secrets.NewService(db), settings.New(db))
+	if err := Set(Credentials{BaseURL: base + "/", APIKey: "ptlc_key"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackendFilesServersAndPower(t *testing.T) {
+	panel := &fakePanel{files: map[string][]byte{"/mods/sodium.jar": []byte("old")}, state: "running"}
+	srv := httptest.NewServer(panel)
+	defer srv.Close()
+	setup(t, srv.URL)
+	ctx := context.Background()
+	var b Backend
+
+	servers, err := b.ListServers(ctx)
+	if err != nil || len(servers) != 2 || servers[1].ID != "5e6f7a8b" {
+		t.Fatalf("servers = %v, %v", servers, err)
+	}
+	jar := []byte{0x50, 0x4b, 0x03, 0x04, 0x00, 0xff}
+	if err := b.PutFile(ctx, "1a2b3c4d", "mods/lithium.jar", jar); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if got, err := b.FetchFile(ctx, "1a2b3c4d", "mods/lithium.jar"); err != nil || string(got) != string(jar) {
+		t.Fatalf("fetch = %v, %v", got, err)
+	}
+	if err := b.DeleteFile(ctx, "1a2b3c4d", "mods/sodium.jar"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	files, err := b.ListPath(ctx, "1a2b3c4d", "mods/")
+	if err != nil || len(files) != 1 || files[0].Name != "lithium.jar" || files[0].IsDir {
+		t.Fatalf("files = %v, %v", files, err)
+	}
+	if _, err := b.ListPath(ctx, "1a2b3c4d", "plugins/"); !errors.Is(err, backend.ErrNotFound) {
+		t.Fatalf("missing folder err = %v", err)
+	}
+	if running, err := b.ServerStatus(ctx, "1a2b3c4d"); err != nil || !running {
+		t.Fatalf("status = %v, %v", running, err)
+	}
+	if err := b.StopServer(ctx, "1a2b3c4d"); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if running, _ := b.ServerStatus(ctx, "1a2b3c4d"); running {
+		t.Fatal("server still running after stop")
+	}
+
+	var pe *Error
+	if err := TestConnection(ctx, Credentials{BaseURL: srv.URL, APIKey: "wrong"}); !errors.As(err, &pe) || pe.Status != http.StatusUnauthorized || pe.Detail != "Unauthenticated." {
+		t.Fatalf("test connection err = %v", err)
+	}
+}
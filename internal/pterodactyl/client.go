@@ -0,0 +1,112 @@
+package pterodactyl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"modsentinel/internal/backend"
+)
+
+// Error represents an error response from the panel.
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+}
+
+func (e *Error) Error() string {
+	if e.Detail != "" {
+		return e.Detail
+	}
+	return http.StatusText(e.Status)
+}
+
+// parseError constructs an error from status and body; missing and
+// forbidden resources map to the backend errors.
+func parseError(status int, body []byte) error {
+	switch status {
+	case http.StatusNotFound:
+		return backend.ErrNotFound
+	case http.StatusForbidden:
+		return backend.ErrForbidden
+	}
+	e := &Error{Status: status}
+	var resp struct {
+		Errors []struct {
+			Code   string `json:"code"`
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &resp); err == nil && len(resp.Errors) > 0 {
+		e.Code, e.Detail = resp.Errors[0].Code, resp.Errors[0].Detail
+	}
+	return e
+}
+
+// maxBody bounds responses read from the panel, which include mod jars.
+const maxBody = 256 << 20
+
+// httpClient performs panel requests; tests may replace it.
+var httpClient = &http.Client{Timeout: 60 * time.Second}
+
+// do sends an authenticated request to path under the panel URL and returns
+// the response body, or an error for non-2xx responses. Bodies are JSON
+// unless contentType says otherwise.
+func do(ctx context.Context, c Credentials, method, path string, query url.Values, body []byte, contentType ...string) ([]byte, error) {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = query.Encode()
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), rd)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		ct := "application/json"
+		if len(contentType) > 0 {
+			ct = contentType[0]
+		}
+		req.Header.Set("Content-Type", ct)
+	}
+	return send(httpClient, req)
+}
+
+func send(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, parseError(resp.StatusCode, data)
+	}
+	return data, nil
+}
+
+// serverPath returns the client API path of a server resource.
+func serverPath(serverID, resource string) string {
+	return "/api/client/servers/" + serverID + resource
+}
+
+// filePath makes a server-relative path absolute, as the panel expects.
+func filePath(p string) string {
+	return "/" + strings.TrimPrefix(p, "/")
+}
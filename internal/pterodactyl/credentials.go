@@ -0,0 +1,130 @@
+// Package pterodactyl manages servers on a Pterodactyl or Pelican panel
+// through its client API, authenticating with a client API key.
+package pterodactyl
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"modsentinel/internal/backend"
+	"modsentinel/internal/secrets"
+	"modsentinel/internal/settings"
+)
+
+// Credentials represents the stored panel URL and client API key.
+type Credentials struct {
+	BaseURL string `json:"base_url"`
+	APIKey  string `json:"api_key"`
+}
+
+const (
+	baseURLKey = "pterodactyl.base_url"
+	// APIKeySecret names the secret holding the client API key.
+	APIKeySecret = "pterodactyl.api_key"
+)
+
+var (
+	secSvc *secrets.Service
+	cfgSvc *settings.Store
+)
+
+// Init sets the services used for credential storage.
+func Init(sec *secrets.Service, cfg *settings.Store) {
+	secSvc = sec
+	cfgSvc = cfg
+}
+
+// Set stores the credentials, keeping the API key in secrets.
+func Set(c Credentials) error {
+	if secSvc == nil || cfgSvc == nil {
+		return nil
+	}
+	if err := validateCreds(&c); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if err := cfgSvc.Set(ctx, baseURLKey, c.BaseURL); err != nil {
+		return err
+	}
+	return secSvc.Set(ctx, APIKeySecret, []byte(c.APIKey))
+}
+
+// Get retrieves stored credentials for internal use.
+func Get() (Credentials, error) {
+	if secSvc == nil || cfgSvc == nil {
+		return Credentials{}, nil
+	}
+	ctx := context.Background()
+	base, err := cfgSvc.Get(ctx, baseURLKey)
+	if err != nil {
+		return Credentials{}, err
+	}
+	key, err := secSvc.Get(ctx, APIKeySecret)
+	if err != nil {
+		return Credentials{}, err
+	}
+	return Credentials{BaseURL: base, APIKey: string(key)}, nil
+}
+
+// Config returns stored credentials without the API key for HTTP responses.
+func Config() (Credentials, error) {
+	c, err := Get()
+	if err != nil {
+		return Credentials{}, err
+	}
+	c.APIKey = ""
+	return c, nil
+}
+
+// Clear removes stored credentials.
+func Clear() error {
+	if secSvc == nil || cfgSvc == nil {
+		return nil
+	}
+	ctx := context.Background()
+	secSvc.Delete(ctx, APIKeySecret)
+	cfgSvc.Delete(ctx, baseURLKey)
+	return nil
+}
+
+// TestConnection checks the credentials by fetching the key's account.
+func TestConnection(ctx context.Context, c Credentials) error {
+	if err := validateCreds(&c); err != nil {
+		return err
+	}
+	_, err := do(ctx, c, "GET", "/api/client/account", nil, nil)
+	return err
+}
+
+func validateCreds(c *Credentials) error {
+	if c.BaseURL == "" {
+		return &backend.ConfigError{Reason: "base_url required"}
+	}
+	u, err := url.Parse(c.BaseURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return &backend.ConfigError{Reason: "invalid base_url"}
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawQuery = ""
+	u.Fragment = ""
+	c.BaseURL = u.String()
+	if strings.TrimSpace(c.APIKey) == "" {
+		return &backend.ConfigError{Reason: "api_key required"}
+	}
+	return nil
+}
+
+func getCreds() (Credentials, error) {
+	c, err := Get()
+	if err != nil {
+		return Credentials{}, err
+	}
+	if c.BaseURL == "" && c.APIKey == "" {
+		return Credentials{}, &backend.ConfigError{Reason: "Pterodactyl credentials not configured"}
+	}
+	if err := validateCreds(&c); err != nil {
+		return Credentials{}, err
+	}
+	return c, nil
+}
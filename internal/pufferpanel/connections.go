@@ -0,0 +1,166 @@
+package pufferpanel
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultConnection is the ID of the connection configured through Set,
+// which instances without a connection use.
+const DefaultConnection = "default"
+
+// connectionsKey holds the named connections as JSON.
+const connectionsKey = "puffer.connections"
+
+// Connection is a PufferPanel installation ModSentinel connects to.
+type Connection struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	BaseURL string `json:"base_url"`
+}
+
+var connIDRE = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// ValidConnectionID reports whether id can name a connection. Empty means
+// the default connection.
+func ValidConnectionID(id string) bool {
+	return id == "" || connIDRE.MatchString(id)
+}
+
+// canonicalConnection validates a connection ID, mapping empty to the
+// default connection.
+func canonicalConnection(id string) (string, error) {
+	if !ValidConnectionID(id) {
+		return "", &ConfigError{Reason: "invalid connection id"}
+	}
+	if id == "" {
+		return DefaultConnection, nil
+	}
+	return id, nil
+}
+
+// connKeys names the settings, secrets and OAuth record of a connection.
+type connKeys struct {
+	baseURL, scopes, deepScan, clientID, clientSecret, token string
+}
+
+// keysFor returns the storage keys of a connection. The default connection
+// keeps the keys used before connections were named.
+func keysFor(id string) connKeys {
+	if id == DefaultConnection {
+		return connKeys{baseURLKey, scopesKey, deepScanKey, clientIDKey, clientSecretKey, "pufferpanel"}
+	}
+	p := "puffer." + id + "."
+	return connKeys{p + "base_url", p + "scopes", p + "deep_scan", p + "oauth_client_id", p + "oauth_client_secret", "pufferpanel." + id}
+}
+
+type namedConn struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func loadConnections(ctx context.Context) ([]namedConn, error) {
+	raw, err := cfgSvc.Get(ctx, connectionsKey)
+	if err != nil || raw == "" {
+		return nil, err
+	}
+	var conns []namedConn
+	if err := json.Unmarshal([]byte(raw), &conns); err != nil {
+		return nil, err
+	}
+	return conns, nil
+}
+
+func storeConnections(ctx context.Context, conns []namedConn) error {
+	b, err := json.Marshal(conns)
+	if err != nil {
+		return err
+	}
+	return cfgSvc.Set(ctx, connectionsKey, string(b))
+}
+
+// saveConnection adds or renames a named connection.
+func saveConnection(ctx context.Context, id, name string) error {
+	conns, err := loadConnections(ctx)
+	if err != nil {
+		return err
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		name = id
+	}
+	i := slices.IndexFunc(conns, func(c namedConn) bool { return c.ID == id })
+	if i < 0 {
+		conns = append(conns, namedConn{ID: id, Name: name})
+	} else {
+		conns[i].Name = name
+	}
+	return storeConnections(ctx, conns)
+}
+
+func removeConnection(ctx context.Context, id string) error {
+	conns, err := loadConnections(ctx)
+	if err != nil {
+		return err
+	}
+	return storeConnections(ctx, slices.DeleteFunc(conns, func(c namedConn) bool { return c.ID == id }))
+}
+
+// Connections returns the configured connections, the default one first
+// when it has credentials.
+func Connections() ([]Connection, error) {
+	if secSvc == nil || cfgSvc == nil {
+		return nil, nil
+	}
+	var out []Connection
+	def, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	if def.BaseURL != "" {
+		out = append(out, Connection{ID: DefaultConnection, Name: DefaultConnection, BaseURL: def.BaseURL})
+	}
+	conns, err := loadConnections(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range conns {
+		base, err := cfgSvc.Get(context.Background(), keysFor(c.ID).baseURL)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Connection{ID: c.ID, Name: c.Name, BaseURL: base})
+	}
+	return out, nil
+}
+
+// connectionIDs returns the IDs of the default and all named connections.
+func connectionIDs() []string {
+	ids := []string{DefaultConnection}
+	if cfgSvc == nil {
+		return ids
+	}
+	conns, _ := loadConnections(context.Background())
+	for _, c := range conns {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+type connectionKey struct{}
+
+// WithConnection returns a context whose PufferPanel calls use the given
+// connection. Empty means the default connection.
+func WithConnection(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, connectionKey{}, id)
+}
+
+// connectionFromContext returns the connection selected by ctx.
+func connectionFromContext(ctx context.Context) string {
+	if v, ok := ctx.Value(connectionKey{}).(string); ok && v != "" {
+		return v
+	}
+	return DefaultConnection
+}
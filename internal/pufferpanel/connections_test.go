@@ -0,0 +1,84 @@
+package pufferpanel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakePanelFor serves one server named name to clients with secret.
+func fakePanelFor(t *testing.T, secret, name string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2/token":
+			r.ParseForm()
+			if r.PostForm.Get("client_secret") != secret {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error":"invalid_client"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"access_token":"tok-%s","expires_in":3600}`, secret)
+		case "/api/servers":
+			if r.Header.Get("Authorization") != "Bearer tok-"+secret {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, `{"paging":{"page":1,"size":1,"total":1},"servers":[{"id":"%s1","name":"%s"}]}`, name, name)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestConnectionsKeepSeparateCredentialsAndCaches(t *testing.T) {
+	setup(t)
+	resetToken()
+	serverCache = sync.Map{}
+	eu := fakePanelFor(t, "eu-secret", "eu")
+	us := fakePanelFor(t, "us-secret", "us")
+	if err := Set(Credentials{BaseURL: eu.URL, ClientID: "id", ClientSecret: "eu-secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConnection("us", "US panel", Credentials{BaseURL: us.URL, ClientID: "id", ClientSecret: "us-secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConnection("Bad ID", "", Credentials{BaseURL: us.URL, ClientID: "id", ClientSecret: "x"}); err == nil {
+		t.Fatal("invalid connection id accepted")
+	}
+
+	conns, err := Connections()
+	if err != nil || len(conns) != 2 || conns[0].ID != DefaultConnection || conns[1].ID != "us" || conns[1].Name != "US panel" || conns[1].BaseURL != us.URL {
+		t.Fatalf("connections = %+v, %v", conns, err)
+	}
+	ctx := context.Background()
+	for conn, want := range map[string]string{"": "eu", DefaultConnection: "eu", "us": "us"} {
+		svs, err := ListServers(WithConnection(ctx, conn))
+		if err != nil || len(svs) != 1 || svs[0].Name != want {
+			t.Fatalf("servers of %q = %v, %v", conn, svs, err)
+		}
+	}
+	if host := APIHost(); host != eu.URL+" "+us.URL {
+		t.Fatalf("api host = %q", host)
+	}
+
+	if err := ClearConnection("us"); err != nil {
+		t.Fatal(err)
+	}
+	var ce *ConfigError
+	if _, err := ListServers(WithConnection(ctx, "us")); !errors.As(err, &ce) {
+		t.Fatalf("cleared connection err = %v", err)
+	}
+	if conns, _ := Connections(); len(conns) != 1 {
+		t.Fatalf("connections after clear = %+v", conns)
+	}
+	if host := APIHost(); host != eu.URL {
+		t.Fatalf("api host after clear = %q", host)
+	}
+}
@@ -3,6 +3,7 @@ package pufferpanel
 import (
 	"context"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -34,7 +35,7 @@ const (
 var (
 	secSvc  *secrets.Service
 	cfgSvc  *settings.Store
-	baseURL atomic.Value // string
+	baseURL atomic.Value // string; hosts of all connections
 )
 
 // Init sets the services used for credential storage.
@@ -44,58 +45,114 @@ func Init(sec *secrets.Service, cfg *settings.Store, tok *oauth.Service) {
 	tokSvc = tok
 }
 
-// Set stores the credentials securely.
+// Set stores the credentials of the default connection.
 func Set(c Credentials) error {
+	return SetConnection(DefaultConnection, "", c)
+}
+
+// Get retrieves the default connection's credentials for internal use.
+func Get() (Credentials, error) {
+	return GetConnection(DefaultConnection)
+}
+
+// Config returns the default connection's credentials without sensitive
+// fields for HTTP responses.
+func Config() (Credentials, error) {
+	c, err := Get()
+	if err != nil {
+		return Credentials{}, err
+	}
+	if c == (Credentials{}) {
+		return c, nil
+	}
+	c.ClientID = ""
+	c.ClientSecret = ""
+	return c, nil
+}
+
+// Exists reports whether credentials are stored for the default connection.
+func Exists() (bool, error) {
+	if secSvc == nil {
+		return false, nil
+	}
+	return secSvc.Exists(context.Background(), clientSecretKey)
+}
+
+// Clear removes the default connection's credentials.
+func Clear() error {
+	return ClearConnection(DefaultConnection)
+}
+
+// SetConnection stores the credentials of a connection securely, adding it
+// to the named connections unless it is the default one.
+func SetConnection(id, name string, c Credentials) error {
 	if secSvc == nil || cfgSvc == nil {
 		return nil
 	}
+	id, err := canonicalConnection(id)
+	if err != nil {
+		return err
+	}
 	if err := validateCreds(&c); err != nil {
 		return err
 	}
 	ctx := context.Background()
-	if err := cfgSvc.Set(ctx, baseURLKey, c.BaseURL); err != nil {
+	k := keysFor(id)
+	if err := cfgSvc.Set(ctx, k.baseURL, c.BaseURL); err != nil {
 		return err
 	}
-	if err := cfgSvc.Set(ctx, scopesKey, c.Scopes); err != nil {
+	if err := cfgSvc.Set(ctx, k.scopes, c.Scopes); err != nil {
 		return err
 	}
-	if err := cfgSvc.Set(ctx, deepScanKey, strconv.FormatBool(c.DeepScan)); err != nil {
+	if err := cfgSvc.Set(ctx, k.deepScan, strconv.FormatBool(c.DeepScan)); err != nil {
 		return err
 	}
-	if err := secSvc.Set(ctx, clientIDKey, []byte(c.ClientID)); err != nil {
+	if err := secSvc.Set(ctx, k.clientID, []byte(c.ClientID)); err != nil {
 		return err
 	}
-	if err := secSvc.Set(ctx, clientSecretKey, []byte(c.ClientSecret)); err != nil {
+	if err := secSvc.Set(ctx, k.clientSecret, []byte(c.ClientSecret)); err != nil {
 		return err
 	}
-	resetToken()
-	baseURL.Store(parseHost(c.BaseURL))
+	if id != DefaultConnection {
+		if err := saveConnection(ctx, id, name); err != nil {
+			return err
+		}
+	}
+	resetConnToken(id)
+	baseURL.Store("")
+	startRefresh(id)
 	return nil
 }
 
-// Get retrieves stored credentials for internal use.
-func Get() (Credentials, error) {
+// GetConnection retrieves the stored credentials of a connection for
+// internal use. Unknown connections have empty credentials.
+func GetConnection(id string) (Credentials, error) {
 	if secSvc == nil || cfgSvc == nil {
 		return Credentials{}, nil
 	}
+	id, err := canonicalConnection(id)
+	if err != nil {
+		return Credentials{}, err
+	}
 	ctx := context.Background()
-	base, err := cfgSvc.Get(ctx, baseURLKey)
+	k := keysFor(id)
+	base, err := cfgSvc.Get(ctx, k.baseURL)
 	if err != nil {
 		return Credentials{}, err
 	}
-	scopes, err := cfgSvc.Get(ctx, scopesKey)
+	scopes, err := cfgSvc.Get(ctx, k.scopes)
 	if err != nil {
 		return Credentials{}, err
 	}
-	deepStr, err := cfgSvc.Get(ctx, deepScanKey)
+	deepStr, err := cfgSvc.Get(ctx, k.deepScan)
 	if err != nil {
 		return Credentials{}, err
 	}
-	idb, err := secSvc.Get(ctx, clientIDKey)
+	idb, err := secSvc.Get(ctx, k.clientID)
 	if err != nil {
 		return Credentials{}, err
 	}
-	secb, err := secSvc.Get(ctx, clientSecretKey)
+	secb, err := secSvc.Get(ctx, k.clientSecret)
 	if err != nil {
 		return Credentials{}, err
 	}
@@ -110,59 +167,46 @@ func Get() (Credentials, error) {
 		return Credentials{}, err
 	}
 	if c.BaseURL != origBase {
-		if err := cfgSvc.Set(ctx, baseURLKey, c.BaseURL); err != nil {
+		if err := cfgSvc.Set(ctx, k.baseURL, c.BaseURL); err != nil {
 			return Credentials{}, err
 		}
 	}
 	if c.Scopes != origScopes {
-		if err := cfgSvc.Set(ctx, scopesKey, c.Scopes); err != nil {
+		if err := cfgSvc.Set(ctx, k.scopes, c.Scopes); err != nil {
 			return Credentials{}, err
 		}
 	}
 	if strconv.FormatBool(c.DeepScan) != origDeep {
-		if err := cfgSvc.Set(ctx, deepScanKey, strconv.FormatBool(c.DeepScan)); err != nil {
+		if err := cfgSvc.Set(ctx, k.deepScan, strconv.FormatBool(c.DeepScan)); err != nil {
 			return Credentials{}, err
 		}
 	}
-	baseURL.Store(parseHost(c.BaseURL))
-	return c, nil
-}
-
-// Config returns stored credentials without sensitive fields for HTTP responses.
-func Config() (Credentials, error) {
-	c, err := Get()
-	if err != nil {
-		return Credentials{}, err
-	}
-	if c == (Credentials{}) {
-		return c, nil
-	}
-	c.ClientID = ""
-	c.ClientSecret = ""
 	return c, nil
 }
 
-// Exists reports whether credentials are stored.
-func Exists() (bool, error) {
-	if secSvc == nil {
-		return false, nil
-	}
-	return secSvc.Exists(context.Background(), clientSecretKey)
-}
-
-// Clear removes stored credentials.
-func Clear() error {
+// ClearConnection removes a connection's credentials, its tokens and, for
+// named connections, the connection itself.
+func ClearConnection(id string) error {
 	if secSvc == nil || cfgSvc == nil {
 		return nil
 	}
+	id, err := canonicalConnection(id)
+	if err != nil {
+		return err
+	}
 	ctx := context.Background()
-	resetToken()
+	k := keysFor(id)
+	stopRefresh(id)
+	resetConnToken(id)
 	baseURL.Store("")
-	secSvc.Delete(ctx, clientIDKey)
-	secSvc.Delete(ctx, clientSecretKey)
-	cfgSvc.Delete(ctx, baseURLKey)
-	cfgSvc.Delete(ctx, scopesKey)
-	cfgSvc.Delete(ctx, deepScanKey)
+	secSvc.Delete(ctx, k.clientID)
+	secSvc.Delete(ctx, k.clientSecret)
+	cfgSvc.Delete(ctx, k.baseURL)
+	cfgSvc.Delete(ctx, k.scopes)
+	cfgSvc.Delete(ctx, k.deepScan)
+	if id != DefaultConnection {
+		return removeConnection(ctx, id)
+	}
 	return nil
 }
 
@@ -213,18 +257,24 @@ func validateCreds(c *Credentials) error {
 	return nil
 }
 
-func getCreds() (Credentials, error) {
-	c, err := Get()
+// getCreds returns the credentials of the connection selected by ctx.
+func getCreds(ctx context.Context) (Credentials, error) {
+	id := connectionFromContext(ctx)
+	c, err := GetConnection(id)
 	if err != nil {
 		return Credentials{}, err
 	}
+	if c == (Credentials{}) && id != DefaultConnection {
+		return Credentials{}, &ConfigError{Reason: "PufferPanel connection " + id + " not configured"}
+	}
 	if err := validateCreds(&c); err != nil {
 		return Credentials{}, err
 	}
 	return c, nil
 }
 
-// APIHost returns the PufferPanel base URL host for CSP connect-src directives.
+// APIHost returns the base URL hosts of all connections, separated by
+// spaces, for CSP connect-src directives.
 func APIHost() string {
 	if v := baseURL.Load(); v != nil {
 		if s, ok := v.(string); ok {
@@ -233,11 +283,17 @@ func APIHost() string {
 			}
 		}
 	}
-	c, err := Get()
+	conns, err := Connections()
 	if err != nil {
 		return ""
 	}
-	h := parseHost(c.BaseURL)
+	var hosts []string
+	for _, c := range conns {
+		if h := parseHost(c.BaseURL); h != "" && !slices.Contains(hosts, h) {
+			hosts = append(hosts, h)
+		}
+	}
+	h := strings.Join(hosts, " ")
 	baseURL.Store(h)
 	return h
 }
@@ -20,7 +20,7 @@ type ServerData struct {
 
 // GetServerData fetches the current data values for a server.
 func GetServerData(ctx context.Context, id string) (*ServerData, error) {
-    creds, err := getCreds()
+    creds, err := getCreds(ctx)
     if err != nil { return nil, err }
     u, err := url.Parse(creds.BaseURL)
     if err != nil { return nil, err }
@@ -26,7 +26,7 @@ type ServerDefinition struct {
 
 // GetServerDefinition fetches the template definition for a server.
 func GetServerDefinition(ctx context.Context, id string) (*ServerDefinition, error) {
-    creds, err := getCreds()
+    creds, err := getCreds(ctx)
     if err != nil { return nil, err }
     u, err := url.Parse(creds.BaseURL)
     if err != nil { return nil, err }
@@ -53,7 +53,7 @@ func GetServerDefinition(ctx context.Context, id string) (*ServerDefinition, err
 
 // GetServerDefinitionRaw fetches the full template definition JSON as a generic map.
 func GetServerDefinitionRaw(ctx context.Context, id string) (map[string]any, error) {
-    creds, err := getCreds()
+    creds, err := getCreds(ctx)
     if err != nil { return nil, err }
     u, err := url.Parse(creds.BaseURL)
     if err != nil { return nil, err }
@@ -2,9 +2,10 @@ package pufferpanel
 
 import (
 	"encoding/json"
-	"errors"
 	"net/http"
 	"strings"
+
+	"modsentinel/internal/backend"
 )
 
 // Error represents an error response from PufferPanel.
@@ -46,13 +47,11 @@ func parseError(status int, body []byte) error {
 }
 
 // ConfigError represents a configuration problem before reaching PufferPanel.
-type ConfigError struct{ Reason string }
-
-func (e *ConfigError) Error() string { return e.Reason }
+type ConfigError = backend.ConfigError
 
 var (
 	// ErrNotFound is returned when the requested resource does not exist.
-	ErrNotFound = errors.New("not_found")
+	ErrNotFound = backend.ErrNotFound
 	// ErrForbidden is returned when access is denied.
-	ErrForbidden = errors.New("forbidden")
+	ErrForbidden = backend.ErrForbidden
 )
@@ -9,17 +9,16 @@ import (
 	"net/url"
 	"sort"
 	"strings"
+
+	"modsentinel/internal/backend"
 )
 
 // FileEntry represents a file or directory returned by PufferPanel's file listing API.
-type FileEntry struct {
-	Name  string `json:"name"`
-	IsDir bool   `json:"is_dir"`
-}
+type FileEntry = backend.FileEntry
 
 // listFiles retrieves the contents of the given path for a server.
 func listFiles(ctx context.Context, serverID, path string) ([]FileEntry, error) {
-	creds, err := getCreds()
+	creds, err := getCreds(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -52,7 +51,7 @@ func listFiles(ctx context.Context, serverID, path string) ([]FileEntry, error)
 
 // FetchFile retrieves raw bytes for the given path on a server.
 func FetchFile(ctx context.Context, serverID, path string) ([]byte, error) {
-	creds, err := getCreds()
+	creds, err := getCreds(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -105,7 +104,7 @@ func ListJarFiles(ctx context.Context, serverID string) ([]string, error) {
 
 // ListPath retrieves file or directory entries under the given path.
 func ListPath(ctx context.Context, serverID, path string) ([]FileEntry, error) {
-	creds, err := getCreds()
+	creds, err := getCreds(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -135,7 +134,7 @@ func ListPath(ctx context.Context, serverID, path string) ([]FileEntry, error) {
 
 // PutFile uploads file contents to the given path.
 func PutFile(ctx context.Context, serverID, path string, data []byte) error {
-	creds, err := getCreds()
+	creds, err := getCreds(ctx)
 	if err != nil {
 		return err
 	}
@@ -162,7 +161,7 @@ func PutFile(ctx context.Context, serverID, path string, data []byte) error {
 
 // DeleteFile removes the file at the given path.
 func DeleteFile(ctx context.Context, serverID, path string) error {
-	creds, err := getCreds()
+	creds, err := getCreds(ctx)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,90 @@
+package pufferpanel
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// StopServer stops a server and waits for its process to exit.
+func StopServer(ctx context.Context, serverID string) error {
+	return serverAction(ctx, serverID, "stop", true)
+}
+
+// StartServer starts a server without waiting for it to come online.
+func StartServer(ctx context.Context, serverID string) error {
+	return serverAction(ctx, serverID, "start", false)
+}
+
+// RestartServer stops a server, waiting for it to exit, then starts it.
+func RestartServer(ctx context.Context, serverID string) error {
+	if err := StopServer(ctx, serverID); err != nil {
+		return err
+	}
+	return StartServer(ctx, serverID)
+}
+
+// ServerStatus reports whether a server's process is running.
+func ServerStatus(ctx context.Context, serverID string) (bool, error) {
+	creds, err := getCreds(ctx)
+	if err != nil {
+		return false, err
+	}
+	u, err := url.Parse(creds.BaseURL)
+	if err != nil {
+		return false, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/servers/" + serverID + "/status"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	client := newClient(u)
+	status, body, err := doAuthRequest(ctx, client, req)
+	if err != nil {
+		return false, err
+	}
+	if status < 200 || status >= 300 {
+		return false, parseError(status, body)
+	}
+	var st struct {
+		Running bool `json:"running"`
+	}
+	if err := json.Unmarshal(body, &st); err != nil {
+		return false, err
+	}
+	return st.Running, nil
+}
+
+// serverAction posts a power action to a server.
+func serverAction(ctx context.Context, serverID, action string, wait bool) error {
+	creds, err := getCreds(ctx)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(creds.BaseURL)
+	if err != nil {
+		return err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/servers/" + serverID + "/" + action
+	if wait {
+		q := u.Query()
+		q.Set("wait", "true")
+		u.RawQuery = q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	client := newClient(u)
+	status, body, err := doAuthRequest(ctx, client, req)
+	if err != nil {
+		return err
+	}
+	if status < 200 || status >= 300 {
+		return parseError(status, body)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package pufferpanel
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPowerActions(t *testing.T) {
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/oauth2/token":
+			fmt.Fprint(w, `{"access_token":"tok","expires_in":3600}`)
+		case r.Method == http.MethodPost && (r.URL.Path == "/api/servers/1/stop" || r.URL.Path == "/api/servers/1/start"):
+			calls = append(calls, r.URL.Path+"?"+r.URL.RawQuery)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	setupFiles(t)
+	if err := Set(Credentials{BaseURL: srv.URL, ClientID: "id", ClientSecret: "secret"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := StopServer(context.Background(), "1"); err != nil {
+		t.Fatalf("StopServer: %v", err)
+	}
+	if err := StartServer(context.Background(), "1"); err != nil {
+		t.Fatalf("StartServer: %v", err)
+	}
+	if len(calls) != 2 || calls[0] != "/api/servers/1/stop?wait=true" || calls[1] != "/api/servers/1/start?" {
+		t.Fatalf("calls = %v", calls)
+	}
+	if err := StartServer(context.Background(), "2"); err == nil {
+		t.Fatalf("expected error for unknown server")
+	}
+}
+
+func TestRestartAndStatus(t *testing.T) {
+	running := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/oauth2/token":
+			fmt.Fprint(w, `{"access_token":"tok","expires_in":3600}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/api/servers/1/stop":
+			running = false
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/api/servers/1/start":
+			running = true
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodGet && r.URL.Path == "/api/servers/1/status":
+			fmt.Fprintf(w, `{"running":%t}`, running)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	setupFiles(t)
+	if err := Set(Credentials{BaseURL: srv.URL, ClientID: "id", ClientSecret: "secret"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := StopServer(context.Background(), "1"); err != nil {
+		t.Fatalf("StopServer: %v", err)
+	}
+	if up, err := ServerStatus(context.Background(), "1"); err != nil || up {
+		t.Fatalf("status after stop = %v, %v", up, err)
+	}
+	if err := RestartServer(context.Background(), "1"); err != nil {
+		t.Fatalf("RestartServer: %v", err)
+	}
+	if up, err := ServerStatus(context.Background(), "1"); err != nil || !up {
+		t.Fatalf("status after restart = %v, %v", up, err)
+	}
+}
@@ -12,14 +12,12 @@ import (
 
 	"golang.org/x/sync/singleflight"
 
+	"modsentinel/internal/backend"
 	"modsentinel/internal/telemetry"
 )
 
 // Server represents a PufferPanel server.
-type Server struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-}
+type Server = backend.Server
 
 type paging struct {
 	Page  int    `json:"page"`
@@ -37,7 +35,7 @@ var (
 	serverGroup singleflight.Group
 	maxServers  = 1000
 	serverTTL   = 2 * time.Second
-	serverCache sync.Map // map[baseURL]cacheEntry
+	serverCache sync.Map // map[connection|baseURL]cacheEntry
 )
 
 type cacheEntry struct {
@@ -45,7 +43,8 @@ type cacheEntry struct {
 	exp     time.Time
 }
 
-// ListServers fetches available servers from PufferPanel.
+// ListServers fetches available servers from the PufferPanel connection
+// selected by ctx.
 func ListServers(ctx context.Context) ([]Server, error) {
 	svs, _, err := ListServersWithStatus(ctx)
 	return svs, err
@@ -72,11 +71,12 @@ func ListServersWithStatus(ctx context.Context) (servers []Server, upstreamStatu
 		})
 	}()
 
-	creds, err := getCreds()
+	creds, err := getCreds(ctx)
 	if err != nil {
 		return nil, 0, err
 	}
-	if v, ok := serverCache.Load(creds.BaseURL); ok {
+	key := connectionFromContext(ctx) + "|" + creds.BaseURL
+	if v, ok := serverCache.Load(key); ok {
 		ent := v.(cacheEntry)
 		if time.Now().Before(ent.exp) {
 			cacheHit = true
@@ -85,14 +85,14 @@ func ListServersWithStatus(ctx context.Context) (servers []Server, upstreamStatu
 	}
 	var shared bool
 	var v any
-	v, err, shared = serverGroup.Do(creds.BaseURL, func() (any, error) {
+	v, err, shared = serverGroup.Do(key, func() (any, error) {
 		svs, status, err := fetchServers(ctx, creds)
 		if err != nil {
 			upstreamStatus = status
 			return nil, err
 		}
 		upstreamStatus = status
-		serverCache.Store(creds.BaseURL, cacheEntry{servers: svs, exp: time.Now().Add(serverTTL)})
+		serverCache.Store(key, cacheEntry{servers: svs, exp: time.Now().Add(serverTTL)})
 		return svs, nil
 	})
 	deduped = shared
@@ -162,7 +162,7 @@ type ServerDetail struct {
 
 // GetServer fetches details for a single server.
 func GetServer(ctx context.Context, id string) (*ServerDetail, error) {
-	creds, err := getCreds()
+	creds, err := getCreds(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -16,13 +16,21 @@ import (
 	"modsentinel/internal/oauth"
 )
 
-var (
-	tokenMu     sync.Mutex
-	cachedToken string
-	tokenExpiry time.Time
+var tokSvc *oauth.Service
 
-	tokSvc *oauth.Service
-)
+// tokenState caches the access token of one connection.
+type tokenState struct {
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+var tokens sync.Map // map[connection ID]*tokenState
+
+func tokenFor(id string) *tokenState {
+	v, _ := tokens.LoadOrStore(id, &tokenState{})
+	return v.(*tokenState)
+}
 
 // fetchToken retrieves a new access token. If refresh is empty it performs the
 // client credentials flow; otherwise it attempts a refresh_token grant.
@@ -97,55 +105,59 @@ func fetchToken(ctx context.Context, c Credentials, refresh string) (access, new
 	return res.AccessToken, res.RefreshToken, exp, nil
 }
 
-// getToken returns a cached access token or fetches a new one if expired.
+// getToken returns a cached access token for the connection selected by
+// ctx or fetches a new one if expired.
 func getToken(ctx context.Context) (string, error) {
-	tokenMu.Lock()
-	defer tokenMu.Unlock()
-	if cachedToken != "" && time.Now().Before(tokenExpiry.Add(-10*time.Second)) {
-		return cachedToken, nil
+	id := connectionFromContext(ctx)
+	recKey := keysFor(id).token
+	st := tokenFor(id)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.token != "" && time.Now().Before(st.expiry.Add(-10*time.Second)) {
+		return st.token, nil
 	}
-	creds, err := getCreds()
+	creds, err := getCreds(ctx)
 	if err != nil {
 		return "", err
 	}
 	var rec oauth.Record
 	if tokSvc != nil {
-		rec, err = tokSvc.Get(ctx, "pufferpanel")
+		rec, err = tokSvc.Get(ctx, recKey)
 		if err != nil {
 			return "", err
 		}
 	}
 	if rec.AccessToken != "" {
 		if time.Now().Before(rec.Expiry.Add(-10 * time.Second)) {
-			cachedToken = rec.AccessToken
-			tokenExpiry = rec.Expiry
-			return cachedToken, nil
+			st.token = rec.AccessToken
+			st.expiry = rec.Expiry
+			return st.token, nil
 		}
 		if rec.RefreshToken != "" {
 			at, rt, exp, err := fetchToken(ctx, creds, rec.RefreshToken)
 			if err == nil {
-				cachedToken = at
-				tokenExpiry = exp
+				st.token = at
+				st.expiry = exp
 				if tokSvc != nil {
-					tokSvc.Store(ctx, "pufferpanel", oauth.Record{Subject: rec.Subject, Scope: creds.Scopes, AccessToken: at, RefreshToken: rt, Expiry: exp})
+					tokSvc.Store(ctx, recKey, oauth.Record{Subject: rec.Subject, Scope: creds.Scopes, AccessToken: at, RefreshToken: rt, Expiry: exp})
 				}
-				return cachedToken, nil
+				return st.token, nil
 			}
-			log.Error().Err(err).Msg("refresh pufferpanel token")
+			log.Error().Err(err).Str("connection", id).Msg("refresh pufferpanel token")
 		}
 	}
 	at, rt, exp, err := fetchToken(ctx, creds, "")
 	if err != nil {
 		return "", err
 	}
-	cachedToken = at
-	tokenExpiry = exp
+	st.token = at
+	st.expiry = exp
 	if tokSvc != nil {
-		if err := tokSvc.Store(ctx, "pufferpanel", oauth.Record{Scope: creds.Scopes, AccessToken: at, RefreshToken: rt, Expiry: exp}); err != nil {
-			log.Error().Err(err).Msg("store pufferpanel token")
+		if err := tokSvc.Store(ctx, recKey, oauth.Record{Scope: creds.Scopes, AccessToken: at, RefreshToken: rt, Expiry: exp}); err != nil {
+			log.Error().Err(err).Str("connection", id).Msg("store pufferpanel token")
 		}
 	}
-	return cachedToken, nil
+	return st.token, nil
 }
 
 // AddAuth attaches the Authorization header with a bearer token.
@@ -168,7 +180,7 @@ func doAuthRequest(ctx context.Context, client *http.Client, req *http.Request)
 		return status, body, err
 	}
 	if status == http.StatusUnauthorized {
-		resetToken()
+		resetConnToken(connectionFromContext(ctx))
 		if err := AddAuth(ctx, req); err != nil {
 			return 0, nil, err
 		}
@@ -177,65 +189,117 @@ func doAuthRequest(ctx context.Context, client *http.Client, req *http.Request)
 	return status, body, nil
 }
 
-// resetToken clears the cached token.
-func resetToken() {
-	tokenMu.Lock()
-	cachedToken = ""
-	tokenExpiry = time.Time{}
-	tokenMu.Unlock()
+// resetToken clears the default connection's cached token.
+func resetToken() { resetConnToken(DefaultConnection) }
+
+// resetConnToken clears the cached and stored tokens of a connection.
+func resetConnToken(id string) {
+	st := tokenFor(id)
+	st.mu.Lock()
+	st.token = ""
+	st.expiry = time.Time{}
+	st.mu.Unlock()
 	if tokSvc != nil {
-		tokSvc.Clear(context.Background(), "pufferpanel")
+		tokSvc.Clear(context.Background(), keysFor(id).token)
 	}
 }
 
-// StartRefresh launches a background goroutine that refreshes the stored
-// OAuth tokens five minutes before expiry. Repeated failures back off
-// exponentially.
+// refresh tracks the refresh loop of each connection.
+var refresh struct {
+	mu    sync.Mutex
+	ctx   context.Context
+	loops map[string]context.CancelFunc
+}
+
+// StartRefresh launches a background goroutine per connection that
+// refreshes its stored OAuth tokens five minutes before expiry. Repeated
+// failures back off exponentially. Connections added later get their own
+// goroutine until ctx ends.
 func StartRefresh(ctx context.Context) {
 	if tokSvc == nil {
 		return
 	}
-	go func() {
-		backoff := time.Second
-		for {
-			select {
-			case <-ctx.Done():
+	refresh.mu.Lock()
+	for _, cancel := range refresh.loops {
+		cancel()
+	}
+	refresh.ctx = ctx
+	refresh.loops = map[string]context.CancelFunc{}
+	refresh.mu.Unlock()
+	for _, id := range connectionIDs() {
+		startRefresh(id)
+	}
+}
+
+// startRefresh starts the refresh loop of a connection once StartRefresh
+// has been called.
+func startRefresh(id string) {
+	refresh.mu.Lock()
+	defer refresh.mu.Unlock()
+	if refresh.ctx == nil || refresh.ctx.Err() != nil || refresh.loops[id] != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(refresh.ctx)
+	refresh.loops[id] = cancel
+	go refreshLoop(ctx, id)
+}
+
+// stopRefresh stops the refresh loop of a removed connection.
+func stopRefresh(id string) {
+	refresh.mu.Lock()
+	defer refresh.mu.Unlock()
+	if cancel := refresh.loops[id]; cancel != nil {
+		cancel()
+		delete(refresh.loops, id)
+	}
+}
+
+func refreshLoop(ctx context.Context, id string) {
+	recKey := keysFor(id).token
+	cctx := WithConnection(ctx, id)
+	backoff := time.Second
+	sleep := func(d time.Duration) bool {
+		select {
+		case <-time.After(d):
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for ctx.Err() == nil {
+		rec, err := tokSvc.Get(ctx, recKey)
+		if err != nil || rec.AccessToken == "" || rec.RefreshToken == "" {
+			if !sleep(time.Minute) {
 				return
-			default:
 			}
-			rec, err := tokSvc.Get(ctx, "pufferpanel")
-			if err != nil || rec.AccessToken == "" || rec.RefreshToken == "" {
-				time.Sleep(time.Minute)
-				continue
+			continue
+		}
+		if wait := time.Until(rec.Expiry.Add(-5 * time.Minute)); wait > 0 && !sleep(wait) {
+			return
+		}
+		creds, err := getCreds(cctx)
+		if err != nil {
+			log.Error().Err(err).Str("connection", id).Msg("pufferpanel creds for refresh")
+			if !sleep(backoff) {
+				return
 			}
-			wait := time.Until(rec.Expiry.Add(-5 * time.Minute))
-			if wait > 0 {
-				select {
-				case <-time.After(wait):
-				case <-ctx.Done():
-					return
-				}
+			if backoff < time.Minute*10 {
+				backoff *= 2
 			}
-			creds, err := getCreds()
-			if err != nil {
-				log.Error().Err(err).Msg("pufferpanel creds for refresh")
-				time.Sleep(backoff)
-				if backoff < time.Minute*10 {
-					backoff *= 2
-				}
-				continue
+			continue
+		}
+		at, rt, exp, err := fetchToken(ctx, creds, rec.RefreshToken)
+		if err != nil {
+			log.Error().Err(err).Str("connection", id).Msg("refresh pufferpanel token")
+			if !sleep(backoff) {
+				return
 			}
-			at, rt, exp, err := fetchToken(ctx, creds, rec.RefreshToken)
-			if err != nil {
-				log.Error().Err(err).Msg("refresh pufferpanel token")
-				time.Sleep(backoff)
-				if backoff < time.Minute*10 {
-					backoff *= 2
-				}
-				continue
+			if backoff < time.Minute*10 {
+				backoff *= 2
 			}
-			backoff = time.Second
-			tokSvc.Store(ctx, "pufferpanel", oauth.Record{Subject: rec.Subject, Scope: creds.Scopes, AccessToken: at, RefreshToken: rt, Expiry: exp})
+			continue
 		}
-	}()
+		backoff = time.Second
+		tokSvc.Store(ctx, recKey, oauth.Record{Subject: rec.Subject, Scope: creds.Scopes, AccessToken: at, RefreshToken: rt, Expiry: exp})
+	}
 }
@@ -126,9 +126,10 @@ func TestAddAuthCachesAndRefreshesToken(t *testing.T) {
 		t.Fatalf("token calls = %d, want 1", tokenCalls)
 	}
 
-	tokenMu.Lock()
-	tokenExpiry = time.Now().Add(-time.Second)
-	tokenMu.Unlock()
+	st := tokenFor(DefaultConnection)
+	st.mu.Lock()
+	st.expiry = time.Now().Add(-time.Second)
+	st.mu.Unlock()
 	tokSvc.Store(context.Background(), "pufferpanel", oauth.Record{AccessToken: "tok1", Expiry: time.Now().Add(-time.Second)})
 	req3, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/data", nil)
 	if err := AddAuth(ctx, req3); err != nil {
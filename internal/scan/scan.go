@@ -0,0 +1,238 @@
+// Package scan inspects mod jars for known-bad hashes and code patterns
+// used by malware before they are installed.
+package scan
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Severity ranks findings. Only SeverityHigh blocks updates.
+type Severity string
+
+const (
+	SeverityHigh   Severity = "high"
+	SeverityMedium Severity = "medium"
+)
+
+// Rule names reported in findings.
+const (
+	RuleBlocklist     = "blocklist"
+	RuleSignature     = "signature"
+	RuleClassLoader   = "classloader_stager"
+	RuleRuntimeExec   = "runtime_exec"
+	RuleNativeLibrary = "native_library"
+)
+
+// Finding is a single rule match. Entry names the archive entry that
+// matched, with nested jars joined by "!/"; it is empty for whole-file
+// matches.
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Entry    string   `json:"entry,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+// Blocking reports whether any finding should stop an install.
+func Blocking(findings []Finding) bool {
+	for _, f := range findings {
+		if f.Severity == SeverityHigh {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// maxDepth bounds how deeply jar-in-jar archives are opened.
+	maxDepth = 3
+	// maxEntrySize caps how much of one entry is read, so a compressed
+	// bomb cannot exhaust memory.
+	maxEntrySize = 64 << 20
+)
+
+// signatures are byte strings found only in known malware families.
+var signatures = []struct{ pattern, name string }{
+	{"dev/neko/nekoclient", "Fractureiser stage 0"},
+	{"dev/neko/nekoinjector", "Fractureiser injector"},
+	{"85.217.144.130", "Fractureiser C2 address"},
+	{"files-8ie.pages.dev", "Fractureiser payload host"},
+	{"skyrage", "Skyrage loader"},
+}
+
+var nativeExts = map[string]bool{".dll": true, ".so": true, ".dylib": true, ".jnilib": true}
+
+// Scanner checks jars against a hash blocklist and built-in rules. The zero
+// value applies the built-in rules only.
+type Scanner struct {
+	blocked map[string]string // lower-case hex digest -> reason
+}
+
+// New returns a Scanner for the given blocklist of hex digests (SHA-1,
+// SHA-256 or SHA-512) to reasons.
+func New(blocklist map[string]string) *Scanner {
+	b := make(map[string]string, len(blocklist))
+	for h, reason := range blocklist {
+		b[strings.ToLower(strings.TrimSpace(h))] = reason
+	}
+	return &Scanner{blocked: b}
+}
+
+// LoadBlocklist reads a blocklist file with one hex digest per line,
+// optionally followed by a reason. Blank lines and lines starting with '#'
+// are skipped. A missing file yields an empty blocklist.
+func LoadBlocklist(file string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	out := map[string]string{}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash, reason, _ := strings.Cut(line, " ")
+		hash = strings.ToLower(hash)
+		if _, err := hex.DecodeString(hash); err != nil || hashAlgorithm(hash) == "" {
+			return nil, fmt.Errorf("%s:%d: invalid hash %q", file, n, hash)
+		}
+		out[hash] = strings.TrimSpace(reason)
+	}
+	return out, sc.Err()
+}
+
+func hashAlgorithm(hex string) string {
+	switch len(hex) {
+	case 40:
+		return "sha1"
+	case 64:
+		return "sha256"
+	case 128:
+		return "sha512"
+	}
+	return ""
+}
+
+// Len returns the number of blocklisted hashes.
+func (s *Scanner) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.blocked)
+}
+
+// Scan inspects a jar and returns its findings. Data that is not a zip
+// archive is only checked against the blocklist.
+func (s *Scanner) Scan(data []byte) []Finding {
+	var out []Finding
+	s.scan(data, "", 0, &out)
+	return out
+}
+
+func (s *Scanner) scan(data []byte, prefix string, depth int, out *[]Finding) {
+	if f, ok := s.checkHashes(data); ok {
+		f.Entry = strings.TrimSuffix(prefix, "!/")
+		*out = append(*out, f)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return
+	}
+	for _, zf := range zr.File {
+		name := zf.Name
+		entry := prefix + name
+		lower := strings.ToLower(name)
+		ext := path.Ext(lower)
+		if nativeExts[ext] {
+			*out = append(*out, Finding{Rule: RuleNativeLibrary, Severity: SeverityMedium, Entry: entry, Detail: "bundles native library " + path.Base(name)})
+			continue
+		}
+		if ext != ".class" && ext != ".jar" {
+			continue
+		}
+		if ext == ".jar" && depth >= maxDepth {
+			continue
+		}
+		body, err := readEntry(zf)
+		if err != nil {
+			continue
+		}
+		if ext == ".jar" {
+			s.scan(body, entry+"!/", depth+1, out)
+			continue
+		}
+		*out = append(*out, scanClass(body, entry)...)
+	}
+}
+
+func readEntry(zf *zip.File) ([]byte, error) {
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, maxEntrySize))
+}
+
+func (s *Scanner) checkHashes(data []byte) (Finding, bool) {
+	if s.Len() == 0 {
+		return Finding{}, false
+	}
+	s1 := sha1.Sum(data)
+	s256 := sha256.Sum256(data)
+	s512 := sha512.Sum512(data)
+	for _, sum := range [][]byte{s1[:], s256[:], s512[:]} {
+		h := hex.EncodeToString(sum)
+		reason, ok := s.blocked[h]
+		if !ok {
+			continue
+		}
+		detail := hashAlgorithm(h) + " " + h + " is blocklisted"
+		if reason != "" {
+			detail += ": " + reason
+		}
+		return Finding{Rule: RuleBlocklist, Severity: SeverityHigh, Detail: detail}, true
+	}
+	return Finding{}, false
+}
+
+// scanClass matches constant pool strings of a class file. Class and member
+// names are stored as plain UTF-8, so substring checks are enough.
+func scanClass(b []byte, entry string) []Finding {
+	var out []Finding
+	for _, sig := range signatures {
+		if bytes.Contains(b, []byte(sig.pattern)) {
+			out = append(out, Finding{Rule: RuleSignature, Severity: SeverityHigh, Entry: entry, Detail: "matches " + sig.name})
+		}
+	}
+	has := func(s string) bool { return bytes.Contains(b, []byte(s)) }
+	// A stager builds a class loader over a remote or decoded location
+	// and invokes the loaded code reflectively.
+	loader := has("java/net/URLClassLoader") || (has("java/lang/ClassLoader") && has("defineClass"))
+	reflective := has("loadClass") && (has("getMethod") || has("getDeclaredMethod")) && has("invoke")
+	hidden := has("java/util/Base64") || has("openConnection") || has("openStream")
+	if loader && reflective && hidden {
+		out = append(out, Finding{Rule: RuleClassLoader, Severity: SeverityHigh, Entry: entry, Detail: "loads and invokes classes from a decoded or remote source"})
+	}
+	if (has("java/lang/Runtime") && has("exec")) || has("java/lang/ProcessBuilder") {
+		out = append(out, Finding{Rule: RuleRuntimeExec, Severity: SeverityMedium, Entry: entry, Detail: "starts external processes"})
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+package scan
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func makeJar(t *testing.T, entries map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range entries {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zip: %v", err)
+		}
+		f.Write(body)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func rules(fs []Finding) map[string]Finding {
+	out := map[string]Finding{}
+	for _, f := range fs {
+		out[f.Rule] = f
+	}
+	return out
+}
+
+func TestScan_CleanJar(t *testing.T) {
+	jar := makeJar(t, map[string][]byte{
+		"fabric.mod.json":         []byte(`{"id":"sodium"}`),
+		"me/jellysquid/Mod.class": []byte("java/lang/Object java/util/List"),
+	})
+	if got := New(nil).Scan(jar); len(got) != 0 {
+		t.Fatalf("findings = %+v", got)
+	}
+}
+
+func TestScan_Rules(t *testing.T) {
+	stager := []byte("java/net/URLClassLoader loadClass getMethod invoke java/util/Base64")
+	inner := makeJar(t, map[string][]byte{"a/b.class": []byte("dev/neko/nekoclient/Client")})
+	jar := makeJar(t, map[string][]byte{
+		"x/Loader.class":          stager,
+		"x/Exec.class":            []byte("java/lang/ProcessBuilder start"),
+		"natives/lib.dll":         {0x4d, 0x5a},
+		"META-INF/jars/inner.jar": inner,
+	})
+	got := rules(New(nil).Scan(jar))
+	if f := got[RuleClassLoader]; f.Entry != "x/Loader.class" || f.Severity != SeverityHigh {
+		t.Fatalf("classloader finding = %+v", f)
+	}
+	if f := got[RuleSignature]; f.Entry != "META-INF/jars/inner.jar!/a/b.class" {
+		t.Fatalf("nested signature finding = %+v", f)
+	}
+	if f := got[RuleRuntimeExec]; f.Severity != SeverityMedium {
+		t.Fatalf("exec finding = %+v", f)
+	}
+	if f := got[RuleNativeLibrary]; f.Entry != "natives/lib.dll" {
+		t.Fatalf("native finding = %+v", f)
+	}
+}
+
+func TestScan_Blocklist(t *testing.T) {
+	jar := makeJar(t, map[string][]byte{"a.class": []byte("ok")})
+	sum := sha256.Sum256(jar)
+	file := filepath.Join(t.TempDir(), "blocklist.txt")
+	content := "# known bad\n\n" + hex.EncodeToString(sum[:]) + " stolen session jar\n"
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	bl, err := LoadBlocklist(file)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	fs := New(bl).Scan(jar)
+	if len(fs) != 1 || fs[0].Rule != RuleBlocklist || !Blocking(fs) {
+		t.Fatalf("findings = %+v", fs)
+	}
+	if Blocking([]Finding{{Rule: RuleNativeLibrary, Severity: SeverityMedium}}) {
+		t.Fatal("medium finding blocks")
+	}
+}
+
+func TestLoadBlocklist(t *testing.T) {
+	if bl, err := LoadBlocklist(filepath.Join(t.TempDir(), "missing")); err != nil || len(bl) != 0 {
+		t.Fatalf("missing file = %v, %v", bl, err)
+	}
+	file := filepath.Join(t.TempDir(), "bad.txt")
+	os.WriteFile(file, []byte("abc123\n"), 0o644)
+	if _, err := LoadBlocklist(file); err == nil {
+		t.Fatal("expected error for short hash")
+	}
+}
@@ -0,0 +1,176 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+	"sync"
+
+	"modsentinel/internal/backend"
+)
+
+// Backend is the backend.ServerBackend for the stored SFTP host.
+type Backend struct{}
+
+var _ backend.ServerBackend = Backend{}
+
+// MaxFileSize bounds a file read from the host.
+const MaxFileSize = 256 << 20
+
+// pool holds the connection shared by all requests, which is redialed
+// when the credentials change or the connection breaks.
+var pool struct {
+	mu  sync.Mutex
+	cl  *client
+	key string
+}
+
+// connKey identifies the connection credentials.
+func connKey(c Credentials) string {
+	return strings.Join([]string{c.Host, c.User, c.HostKey, c.PrivateKey}, "\x00")
+}
+
+func dropConn() {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if pool.cl != nil {
+		pool.cl.Close()
+		pool.cl = nil
+	}
+}
+
+// conn returns the shared connection, dialing it when needed, and whether
+// it was reused.
+func conn(ctx context.Context, c Credentials) (*client, bool, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	key := connKey(c)
+	if pool.cl != nil && pool.key == key {
+		return pool.cl, true, nil
+	}
+	if pool.cl != nil {
+		pool.cl.Close()
+		pool.cl = nil
+	}
+	cl, err := dial(ctx, c)
+	if err != nil {
+		return nil, false, err
+	}
+	pool.cl, pool.key = cl, key
+	return cl, false, nil
+}
+
+// with runs fn on the connection with the server directory resolved. A
+// reused connection that turns out to be broken is redialed once.
+func with(ctx context.Context, serverID string, fn func(cl *client, dir string) error) error {
+	c, err := getCreds()
+	if err != nil {
+		return err
+	}
+	dir := path.Clean(serverID)
+	if !path.IsAbs(serverID) || !backend.InRoots(c.Paths, dir) {
+		return backend.ErrForbidden
+	}
+	for {
+		cl, reused, err := conn(ctx, c)
+		if err != nil {
+			return err
+		}
+		cl.mu.Lock()
+		err = fn(cl, dir)
+		cl.mu.Unlock()
+		if !isTransportErr(err) {
+			return err
+		}
+		pool.mu.Lock()
+		if pool.cl == cl {
+			pool.cl.Close()
+			pool.cl = nil
+		}
+		pool.mu.Unlock()
+		if !reused || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+// ListServers returns the allowlisted directories that exist.
+func (Backend) ListServers(ctx context.Context) ([]backend.Server, error) {
+	c, err := getCreds()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]backend.Server, 0, len(c.Paths))
+	for _, p := range c.Paths {
+		err := with(ctx, p, func(cl *client, dir string) error {
+			fi, err := cl.stat(ctx, dir)
+			if err == nil && fi.IsDir() {
+				out = append(out, backend.Server{ID: dir, Name: path.Base(dir)})
+			}
+			return err
+		})
+		if err != nil && !errors.Is(err, backend.ErrNotFound) {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// GetServer checks that a directory is allowlisted and exists.
+func (Backend) GetServer(ctx context.Context, serverID string) (*backend.Server, error) {
+	var s *backend.Server
+	err := with(ctx, serverID, func(cl *client, dir string) error {
+		fi, err := cl.stat(ctx, dir)
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return backend.ErrNotFound
+		}
+		s = &backend.Server{ID: dir, Name: path.Base(dir)}
+		return nil
+	})
+	return s, err
+}
+
+// ListPath lists a directory of the server.
+func (Backend) ListPath(ctx context.Context, serverID, p string) ([]backend.FileEntry, error) {
+	var files []backend.FileEntry
+	err := with(ctx, serverID, func(cl *client, dir string) error {
+		var err error
+		files, err = cl.readDir(ctx, path.Join(dir, backend.RelPath(p)))
+		return err
+	})
+	return files, err
+}
+
+// FetchFile reads a file of the server.
+func (Backend) FetchFile(ctx context.Context, serverID, p string) ([]byte, error) {
+	var data []byte
+	err := with(ctx, serverID, func(cl *client, dir string) error {
+		var err error
+		data, err = cl.readFile(ctx, path.Join(dir, backend.RelPath(p)), MaxFileSize)
+		return err
+	})
+	return data, err
+}
+
+// PutFile creates or replaces a file of the server.
+func (Backend) PutFile(ctx context.Context, serverID, p string, data []byte) error {
+	return with(ctx, serverID, func(cl *client, dir string) error {
+		return cl.writeFile(ctx, path.Join(dir, backend.RelPath(p)), data)
+	})
+}
+
+// DeleteFile removes a file of the server.
+func (Backend) DeleteFile(ctx context.Context, serverID, p string) error {
+	return with(ctx, serverID, func(cl *client, dir string) error {
+		return cl.remove(ctx, path.Join(dir, backend.RelPath(p)))
+	})
+}
+
+// ServerStatus is unsupported; SFTP gives no access to server processes.
+func (Backend) ServerStatus(ctx context.Context, serverID string) (bool, error) {
+	return false, backend.ErrUnsupported
+}
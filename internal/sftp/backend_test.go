@@ -0,0 +1,204 @@
+package sftp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sftppkg "github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	_ "modernc.org/sqlite"
+
+	"modsentinel/internal/backend"
+	dbpkg "modsentinel/internal/db"
+	"modsentinel/internal/secrets"
+	"modsentinel/internal/settings"
+)
+
+// serveSFTP serves SFTP over the local filesystem until the channel
+// closes.
+func serveSFTP(ch io.ReadWriteCloser) {
+	srv, err := sftppkg.NewServer(ch)
+	if err != nil {
+		ch.Close()
+		return
+	}
+	srv.Serve()
+	srv.Close()
+}
+
+// startSSH serves the sftp subsystem to clients holding userKey and returns
+// the address and host key.
+func startSSH(t *testing.T, userKey ssh.PublicKey) (string, ssh.PublicKey) {
+	t.Helper()
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if meta.User() == "mc" && string(key.Marshal()) == string(userKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized")
+		},
+	}
+	cfg.AddHostKey(hostSigner)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(nc, cfg)
+				if err != nil {
+					nc.Close()
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for nch := range chans {
+					ch, chReqs, err := nch.Accept()
+					if err != nil {
+						continue
+					}
+					go func() {
+						for req := range chReqs {
+							ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+							req.Reply(ok, nil)
+							if ok {
+								go serveSFTP(ch)
+							}
+						}
+					}()
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), hostSigner.PublicKey()
+}
+
+func TestBackendOverSSH(t *testing.T) {
+	_, userPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(userPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userSigner, err := ssh.NewSignerFromKey(userPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, hostPub := startSSH(t, userSigner.PublicKey())
+
+	root := filepath.ToSlash(t.TempDir())
+	srv := root + "/servers/survival"
+	if err := os.MkdirAll(srv+"/mods", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(root+"/secret.txt", []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if err := dbpkg.Init(db); err != nil {
+		t.Fatal(err)
+	}
+	Init(secrets.NewService(db), settings.New(db))
+	t.Cleanup(dropConn)
+	creds := Credentials{
+		Host:       addr,
+		User:       "mc",
+		PrivateKey: string(pem.EncodeToMemory(block)),
+		HostKey:    ssh.FingerprintSHA256(hostPub),
+		Paths:      []string{root + "/servers/survival/"},
+	}
+	ctx := context.Background()
+	if err := TestConnection(ctx, creds); err != nil {
+		t.Fatalf("test connection: %v", err)
+	}
+	if err := Set(creds); err != nil {
+		t.Fatal(err)
+	}
+	var b Backend
+
+	servers, err := b.ListServers(ctx)
+	if err != nil || len(servers) != 1 || servers[0].ID != srv || servers[0].Name != "survival" {
+		t.Fatalf("servers = %v, %v", servers, err)
+	}
+	jar := make([]byte, 3*32<<10+7)
+	rand.Read(jar)
+	if err := b.PutFile(ctx, srv, "mods/sodium.jar", jar); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if got, err := b.FetchFile(ctx, srv, "/mods/sodium.jar"); err != nil || string(got) != string(jar) {
+		t.Fatalf("fetch = %d bytes, %v", len(got), err)
+	}
+	// Files over the limit are refused rather than truncated.
+	pool.mu.Lock()
+	cl := pool.cl
+	pool.mu.Unlock()
+	if got, err := cl.readFile(ctx, srv+"/mods/sodium.jar", len(jar)-1); !errors.Is(err, backend.ErrTooLarge) {
+		t.Fatalf("read over limit = %d bytes, %v", len(got), err)
+	}
+	files, err := b.ListPath(ctx, srv, "mods/")
+	if err != nil || len(files) != 1 || files[0].Name != "sodium.jar" || files[0].IsDir {
+		t.Fatalf("files = %v, %v", files, err)
+	}
+	if err := b.DeleteFile(ctx, srv, "mods/sodium.jar"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := b.FetchFile(ctx, srv, "mods/sodium.jar"); !errors.Is(err, backend.ErrNotFound) {
+		t.Fatalf("fetch deleted err = %v", err)
+	}
+
+	// Servers outside the allowlist and paths climbing out of a server are
+	// refused or stay inside it.
+	if _, err := b.GetServer(ctx, root); !errors.Is(err, backend.ErrForbidden) {
+		t.Fatalf("server outside paths err = %v", err)
+	}
+	if _, err := b.FetchFile(ctx, srv, "../../secret.txt"); !errors.Is(err, backend.ErrNotFound) {
+		t.Fatalf("traversal err = %v", err)
+	}
+
+	// A dropped connection is redialed.
+	pool.mu.Lock()
+	pool.cl.conn.Close()
+	pool.mu.Unlock()
+	if _, err := b.GetServer(ctx, srv); err != nil {
+		t.Fatalf("after reconnect: %v", err)
+	}
+
+	// The host key is pinned, and the offered one is reported.
+	bad := creds
+	bad.HostKey = "SHA256:AAAA"
+	var ce *backend.ConfigError
+	if err := TestConnection(ctx, bad); !errors.As(err, &ce) || !strings.Contains(ce.Reason, ssh.FingerprintSHA256(hostPub)) {
+		t.Fatalf("host key mismatch err = %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	sftppkg "github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"modsentinel/internal/backend"
+)
+
+// StatusError is a failed SFTP request.
+type StatusError struct {
+	Code uint32
+	Msg  string
+}
+
+func (e *StatusError) Error() string {
+	if e.Msg != "" {
+		return "sftp: " + e.Msg
+	}
+	return fmt.Sprintf("sftp: status %d", e.Code)
+}
+
+// mapErr maps a failed request to the backend errors or a StatusError.
+// Other errors broke the connection and are returned as they are.
+func mapErr(err error) error {
+	var se *sftppkg.StatusError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, fs.ErrNotExist):
+		return backend.ErrNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return backend.ErrForbidden
+	case errors.As(err, &se):
+		return &StatusError{Code: se.Code, Msg: strings.TrimPrefix(se.Error(), "sftp: ")}
+	}
+	return err
+}
+
+// isTransportErr reports whether err broke the connection rather than
+// failing a single request.
+func isTransportErr(err error) bool {
+	var se *StatusError
+	return err != nil && !errors.Is(err, backend.ErrNotFound) && !errors.Is(err, backend.ErrForbidden) &&
+		!errors.Is(err, backend.ErrTooLarge) && !errors.As(err, &se)
+}
+
+// client is an SFTP session over an SSH connection. Requests are sent one
+// at a time.
+type client struct {
+	mu   sync.Mutex
+	conn *ssh.Client
+	sc   *sftppkg.Client
+}
+
+// dialTimeout bounds connecting and the SSH handshake.
+var dialTimeout = 15 * time.Second
+
+func dial(ctx context.Context, c Credentials) (*client, error) {
+	signer, err := ssh.ParsePrivateKey([]byte(c.PrivateKey))
+	if err != nil {
+		return nil, &backend.ConfigError{Reason: "invalid private_key"}
+	}
+	cfg := &ssh.ClientConfig{
+		User:            c.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: checkHostKey(c.HostKey),
+		Timeout:         dialTimeout,
+	}
+	d := net.Dialer{Timeout: dialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", c.Host)
+	if err != nil {
+		return nil, err
+	}
+	nc.SetDeadline(time.Now().Add(dialTimeout))
+	sc, chans, reqs, err := ssh.NewClientConn(nc, c.Host, cfg)
+	if err != nil {
+		nc.Close()
+		var ce *backend.ConfigError
+		if errors.As(err, &ce) {
+			return nil, ce
+		}
+		return nil, err
+	}
+	conn := ssh.NewClient(sc, chans, reqs)
+	cl, err := start(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	nc.SetDeadline(time.Time{})
+	return cl, nil
+}
+
+// checkHostKey accepts only the host key with the given SHA256 fingerprint,
+// reporting the offered fingerprint otherwise.
+func checkHostKey(want string) ssh.HostKeyCallback {
+	want = strings.TrimPrefix(strings.TrimSpace(want), "SHA256:")
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		got := ssh.FingerprintSHA256(key)
+		switch {
+		case want == "":
+			return &backend.ConfigError{Reason: "host_key required; server offers " + got}
+		case strings.TrimPrefix(got, "SHA256:") != want:
+			return &backend.ConfigError{Reason: "host key mismatch; server offers " + got}
+		}
+		return nil
+	}
+}
+
+// start opens the sftp subsystem.
+func start(conn *ssh.Client) (*client, error) {
+	sc, err := sftppkg.NewClient(conn)
+	if err != nil {
+		return nil, err
+	}
+	return &client{conn: conn, sc: sc}, nil
+}
+
+func (cl *client) Close() error {
+	cl.sc.Close()
+	return cl.conn.Close()
+}
+
+// do runs a request, mapping its error. The SFTP client takes no context,
+// so closing the connection unblocks a request the context abandons.
+func (cl *client) do(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { cl.conn.Close() })
+	defer stop()
+	if err := fn(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return mapErr(err)
+	}
+	return nil
+}
+
+func (cl *client) stat(ctx context.Context, p string) (fs.FileInfo, error) {
+	var fi fs.FileInfo
+	err := cl.do(ctx, func() error {
+		var err error
+		fi, err = cl.sc.Stat(p)
+		return err
+	})
+	return fi, err
+}
+
+func (cl *client) readDir(ctx context.Context, p string) ([]backend.FileEntry, error) {
+	var out []backend.FileEntry
+	err := cl.do(ctx, func() error {
+		entries, err := cl.sc.ReadDir(p)
+		if err != nil {
+			return err
+		}
+		for _, fi := range entries {
+			if fi.Name() == "." || fi.Name() == ".." {
+				continue
+			}
+			out = append(out, backend.FileEntry{Name: fi.Name(), IsDir: fi.IsDir(), Size: fi.Size(), ModTime: fi.ModTime()})
+		}
+		return nil
+	})
+	return out, err
+}
+
+// readFile reads p, failing with backend.ErrTooLarge rather than returning
+// a truncated file when it exceeds limit bytes.
+func (cl *client) readFile(ctx context.Context, p string, limit int) ([]byte, error) {
+	var data []byte
+	err := cl.do(ctx, func() error {
+		f, err := cl.sc.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		data, err = io.ReadAll(io.LimitReader(f, int64(limit)+1))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("%s: %w", p, backend.ErrTooLarge)
+	}
+	return data, nil
+}
+
+func (cl *client) writeFile(ctx context.Context, p string, data []byte) error {
+	return cl.do(ctx, func() error {
+		f, err := cl.sc.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
+
+func (cl *client) remove(ctx context.Context, p string) error {
+	return cl.do(ctx, func() error { return cl.sc.Remove(p) })
+}
@@ -0,0 +1,195 @@
+// Package sftp manages game servers on hosts reachable over SFTP, for
+// servers run without a panel. It authenticates with a private key and
+// pins the host key by fingerprint. A server's ID is its directory on the
+// host, which must lie in or beneath an allowlisted path.
+package sftp
+
+import (
+	"context"
+	"net"
+	"path"
+	"strings"
+
+	"modsentinel/internal/backend"
+	"modsentinel/internal/secrets"
+	"modsentinel/internal/settings"
+)
+
+// Credentials represents the stored host, user, keys and allowlisted paths.
+type Credentials struct {
+	// Host is host:port; the port defaults to 22.
+	Host string `json:"host"`
+	User string `json:"user"`
+	// PrivateKey is a PEM or OpenSSH private key without a passphrase.
+	PrivateKey string `json:"private_key"`
+	// HostKey is the SHA256 fingerprint of the server's host key.
+	HostKey string `json:"host_key"`
+	// Paths are the absolute directories servers may live in.
+	Paths []string `json:"paths"`
+}
+
+const (
+	hostKey    = "sftp.host"
+	userKey    = "sftp.user"
+	hostKeyKey = "sftp.host_key"
+	pathsKey   = "sftp.paths"
+	// PrivateKeySecret names the secret holding the private key.
+	PrivateKeySecret = "sftp.private_key"
+)
+
+var (
+	secSvc *secrets.Service
+	cfgSvc *settings.Store
+)
+
+// Init sets the services used for credential storage.
+func Init(sec *secrets.Service, cfg *settings.Store) {
+	secSvc = sec
+	cfgSvc = cfg
+}
+
+// Set stores the credentials, keeping the private key in secrets.
+func Set(c Credentials) error {
+	if secSvc == nil || cfgSvc == nil {
+		return nil
+	}
+	if err := validateCreds(&c); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	for k, v := range map[string]string{
+		hostKey:    c.Host,
+		userKey:    c.User,
+		hostKeyKey: c.HostKey,
+		pathsKey:   strings.Join(c.Paths, "\n"),
+	} {
+		if err := cfgSvc.Set(ctx, k, v); err != nil {
+			return err
+		}
+	}
+	if err := secSvc.Set(ctx, PrivateKeySecret, []byte(c.PrivateKey)); err != nil {
+		return err
+	}
+	dropConn()
+	return nil
+}
+
+// Get retrieves stored credentials for internal use.
+func Get() (Credentials, error) {
+	if secSvc == nil || cfgSvc == nil {
+		return Credentials{}, nil
+	}
+	ctx := context.Background()
+	var c Credentials
+	var paths string
+	for k, v := range map[string]*string{
+		hostKey:    &c.Host,
+		userKey:    &c.User,
+		hostKeyKey: &c.HostKey,
+		pathsKey:   &paths,
+	} {
+		s, err := cfgSvc.Get(ctx, k)
+		if err != nil {
+			return Credentials{}, err
+		}
+		*v = s
+	}
+	if paths != "" {
+		c.Paths = strings.Split(paths, "\n")
+	}
+	key, err := secSvc.Get(ctx, PrivateKeySecret)
+	if err != nil {
+		return Credentials{}, err
+	}
+	c.PrivateKey = string(key)
+	return c, nil
+}
+
+// Config returns stored credentials without the private key for HTTP
+// responses.
+func Config() (Credentials, error) {
+	c, err := Get()
+	if err != nil {
+		return Credentials{}, err
+	}
+	c.PrivateKey = ""
+	return c, nil
+}
+
+// Clear removes stored credentials.
+func Clear() error {
+	if secSvc == nil || cfgSvc == nil {
+		return nil
+	}
+	ctx := context.Background()
+	secSvc.Delete(ctx, PrivateKeySecret)
+	for _, k := range []string{hostKey, userKey, hostKeyKey, pathsKey} {
+		cfgSvc.Delete(ctx, k)
+	}
+	dropConn()
+	return nil
+}
+
+// TestConnection checks the credentials by logging in and reading the
+// allowlisted paths.
+func TestConnection(ctx context.Context, c Credentials) error {
+	if err := validateCreds(&c); err != nil {
+		return err
+	}
+	cl, err := dial(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+	for _, p := range c.Paths {
+		if _, err := cl.stat(ctx, p); err != nil {
+			return &backend.ConfigError{Reason: "path " + p + ": " + err.Error()}
+		}
+	}
+	return nil
+}
+
+func validateCreds(c *Credentials) error {
+	c.Host = strings.TrimSpace(c.Host)
+	if c.Host == "" {
+		return &backend.ConfigError{Reason: "host required"}
+	}
+	if _, _, err := net.SplitHostPort(c.Host); err != nil {
+		c.Host = net.JoinHostPort(strings.Trim(c.Host, "[]"), "22")
+	}
+	if strings.TrimSpace(c.User) == "" {
+		return &backend.ConfigError{Reason: "user required"}
+	}
+	if strings.TrimSpace(c.PrivateKey) == "" {
+		return &backend.ConfigError{Reason: "private_key required"}
+	}
+	var paths []string
+	for _, p := range c.Paths {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if !path.IsAbs(p) {
+			return &backend.ConfigError{Reason: "paths must be absolute"}
+		}
+		paths = append(paths, path.Clean(p))
+	}
+	if len(paths) == 0 {
+		return &backend.ConfigError{Reason: "paths required"}
+	}
+	c.Paths = paths
+	return nil
+}
+
+func getCreds() (Credentials, error) {
+	c, err := Get()
+	if err != nil {
+		return Credentials{}, err
+	}
+	if c.Host == "" && c.PrivateKey == "" {
+		return Credentials{}, &backend.ConfigError{Reason: "SFTP credentials not configured"}
+	}
+	if err := validateCreds(&c); err != nil {
+		return Credentials{}, err
+	}
+	return c, nil
+}
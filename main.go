@@ -1,15 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"embed"
 	"bufio"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"syscall"
@@ -19,14 +25,23 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"modsentinel/internal/artifacts"
+	"modsentinel/internal/backend"
+	"modsentinel/internal/curseforge"
 	dbpkg "modsentinel/internal/db"
 	"modsentinel/internal/handlers"
 	"modsentinel/internal/httpx"
+	"modsentinel/internal/localfs"
 	logx "modsentinel/internal/logx"
+	"modsentinel/internal/manifest"
+	mr "modsentinel/internal/modrinth"
 	oauth "modsentinel/internal/oauth"
+	"modsentinel/internal/pterodactyl"
 	pppkg "modsentinel/internal/pufferpanel"
+	"modsentinel/internal/scan"
 	"modsentinel/internal/secrets"
 	settingspkg "modsentinel/internal/settings"
+	"modsentinel/internal/sftp"
 	tokenpkg "modsentinel/internal/token"
 
 	_ "modernc.org/sqlite"
@@ -116,11 +131,55 @@ func main() {
 		log.Fatal().Err(err).Msg("migrate db")
 	}
 	keyFile := filepath.Join(filepath.Dir(path), "secret.key")
+	handlers.SetArtifactStore(artifacts.New(filepath.Join(filepath.Dir(path), "artifacts")))
+	cacheMB := int64(2048)
+	if v := strings.TrimSpace(os.Getenv("MODSENTINEL_CACHE_MAX_MB")); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			log.Fatal().Str("value", v).Msg("invalid MODSENTINEL_CACHE_MAX_MB")
+		}
+		cacheMB = n
+	}
+	handlers.SetBlobCache(artifacts.NewCache(filepath.Join(filepath.Dir(path), "cache"), cacheMB<<20))
+	handlers.SetModrinthCache(db)
+	if dir := strings.TrimSpace(os.Getenv("MODSENTINEL_MODRINTH_MIRROR")); dir != "" {
+		mirror, err := mr.OpenMirror(dir)
+		if err != nil {
+			log.Fatal().Err(err).Str("dir", dir).Msg("open modrinth mirror")
+		}
+		// Jar downloads use the default client; only Modrinth hosts are
+		// answered locally.
+		mirror.Next = http.DefaultTransport
+		http.DefaultClient.Transport = mirror
+		handlers.SetModrinthMirror(mirror)
+		log.Info().Str("dir", dir).Int("projects", len(mirror.Manifest().Projects)).Msg("modrinth offline mirror enabled")
+	}
+	blocklistPath := strings.TrimSpace(os.Getenv("MODSENTINEL_SCAN_BLOCKLIST"))
+	if blocklistPath == "" {
+		blocklistPath = filepath.Join(filepath.Dir(path), "blocklist.txt")
+	}
+	blocklist, err := scan.LoadBlocklist(blocklistPath)
+	if err != nil {
+		log.Fatal().Err(err).Str("path", blocklistPath).Msg("load scan blocklist")
+	}
+	handlers.SetScanner(scan.New(blocklist))
+	log.Info().Int("hashes", len(blocklist)).Str("path", blocklistPath).Msg("jar scanner ready")
 	svc := secrets.NewService(db, keyFile)
 	cfg := settingspkg.New(db)
 	oauthSvc := oauth.New(db)
 	tokenpkg.Init(svc)
+	curseforge.Init(svc)
 	pppkg.Init(svc, cfg, oauthSvc)
+	pterodactyl.Init(svc, cfg)
+	sftp.Init(svc, cfg)
+	if roots := strings.TrimSpace(os.Getenv("MODSENTINEL_LOCAL_ROOTS")); roots != "" {
+		local, err := localfs.New(filepath.SplitList(roots))
+		if err != nil {
+			log.Fatal().Err(err).Msg("invalid MODSENTINEL_LOCAL_ROOTS")
+		}
+		handlers.SetServerBackend(backend.Local, local)
+		log.Info().Str("roots", roots).Msg("local server backend enabled")
+	}
 
 	// Optional: seed Modrinth token from environment for local testing
 	if envTok := strings.TrimSpace(os.Getenv("MODSENTINEL_MODRINTH_TOKEN")); envTok != "" {
@@ -131,16 +190,24 @@ func main() {
 			log.Info().Str("token", redacted).Msg("modrinth token provided via env")
 		}
 	}
+	if envKey := strings.TrimSpace(os.Getenv("MODSENTINEL_CURSEFORGE_API_KEY")); envKey != "" {
+		if err := curseforge.SetAPIKey(envKey); err != nil {
+			log.Warn().Err(err).Msg("failed to set curseforge api key from env")
+		} else {
+			log.Info().Str("key", logx.Secret(envKey)).Msg("curseforge api key provided via env")
+		}
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	scheduler := gocron.NewScheduler(time.UTC)
-	scheduler.Every(1).Hour().Do(func() { handlers.CheckUpdates(ctx, db) })
-	scheduler.StartAsync()
 	pppkg.StartRefresh(ctx)
     stopJobs := handlers.StartJobQueue(ctx, db)
     stopUpdates := handlers.StartUpdateQueue(ctx, db)
+	// Hourly update check; auto-apply policies enqueue onto the update queue
+	scheduler := gocron.NewScheduler(time.UTC)
+	scheduler.Every(1).Hour().Do(func() { handlers.CheckUpdates(ctx, db) })
+	scheduler.StartAsync()
 
 	r := handlers.New(db, distFS, svc)
 	var shuttingDown atomic.Bool
@@ -209,12 +276,108 @@ func adminMain(args []string) {
 		os.Exit(1)
 	}
 	switch args[0] {
+	case "export-mirror":
+		exportMirrorMain(args[1:])
+	case "manifest":
+		manifestMain(args[1:])
 	default:
 		fmt.Fprintln(os.Stderr, "unknown admin command")
 		os.Exit(1)
 	}
 }
 
+// exportMirrorMain builds an offline Modrinth mirror for the given slugs.
+func exportMirrorMain(args []string) {
+	fs := flag.NewFlagSet("export-mirror", flag.ExitOnError)
+	dir := fs.String("dir", "modrinth-mirror", "mirror directory to create or extend")
+	keep := fs.Int("versions", 5, "newest versions per project whose files are downloaded")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: modsentinel admin export-mirror [-dir DIR] [-versions N] <slug>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 || *keep < 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	res, err := mr.ExportMirror(ctx, mr.NewClient(), *dir, fs.Args(), *keep)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export-mirror: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("exported %d projects (%d versions, %d files, %d bytes) to %s\n", len(res.Projects), res.Versions, res.Blobs, res.Bytes, *dir)
+}
+
+// manifestMain plans an instance manifest on a running server, or applies
+// it with -apply, and prints the JSON response. ADMIN_TOKEN is sent as the
+// bearer token when set.
+func manifestMain(args []string) {
+	fs := flag.NewFlagSet("manifest", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:8080", "ModSentinel base URL")
+	instance := fs.Int("instance", 0, "instance ID")
+	apply := fs.Bool("apply", false, "apply the plan instead of only printing it")
+	onFailure := fs.String("on-failure", handlers.BatchStopOnFailure, "when applying, stop or continue after a failed change")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: modsentinel admin manifest -instance ID [-server URL] [-apply [-on-failure stop|continue]] <manifest.yaml>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *instance <= 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err == nil {
+		_, err = manifest.Parse(data)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "manifest: %v\n", err)
+		os.Exit(1)
+	}
+	action := "plan"
+	if *apply {
+		action = "apply"
+	}
+	target := fmt.Sprintf("%s/api/instances/%d/manifest/%s", strings.TrimRight(*server, "/"), *instance, action)
+	if *apply {
+		target += "?on_failure=" + url.QueryEscape(*onFailure)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "manifest: %v\n", err)
+		os.Exit(1)
+	}
+	req.Header.Set("Content-Type", "application/yaml")
+	if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "manifest %s: %v\n", action, err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "manifest %s: %v\n", action, err)
+		os.Exit(1)
+	}
+	var out bytes.Buffer
+	if json.Indent(&out, body, "", "  ") != nil {
+		out.Reset()
+		out.Write(body)
+	}
+	if resp.StatusCode >= 300 {
+		fmt.Fprintf(os.Stderr, "manifest %s: %s\n%s\n", action, resp.Status, out.String())
+		os.Exit(1)
+	}
+	fmt.Println(out.String())
+}
+
 func withShutdown(next http.Handler, flag *atomic.Bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if flag.Load() {
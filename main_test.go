@@ -17,7 +17,7 @@ func openTestDB(t *testing.T) *sql.DB {
 	if err := initDB(db); err != nil {
 		t.Fatalf("init db: %v", err)
 	}
-	inst := &Instance{Name: "Test", Loader: "fabric", EnforceSameLoader: true}
+	inst := &Instance{Name: "Test", Loader: "fabric"}
 	if err := insertInstance(db, inst); err != nil {
 		t.Fatalf("insert instance: %v", err)
 	}